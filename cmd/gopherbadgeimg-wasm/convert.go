@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// jsonOptions are the options of convert, as JavaScript passes them: a JSON
+// object such as {"dither": "atkinson", "invert": true}, every field being
+// optional
+type jsonOptions struct {
+	// Dither is one of badgeimg.DitherAlgorithms, or none
+	Dither string `json:"dither"`
+	// Threshold is from 1 to 255, 0 for none
+	Threshold int  `json:"threshold"`
+	Invert    bool `json:"invert"`
+	// Linear thresholds and inverts in linear light
+	Linear bool `json:"linear"`
+	// Background is a solid color, as badgeimg.ParseColor parses it
+	Background string `json:"background"`
+}
+
+// parseOptions parses the options of convert, "" being the defaults
+func parseOptions(data string) (badgeimg.Options, error) {
+	var opts badgeimg.Options
+	if strings.TrimSpace(data) == "" {
+		return opts, nil
+	}
+	var parsed jsonOptions
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&parsed); err != nil {
+		return opts, fmt.Errorf("invalid options: %w", err)
+	}
+	if parsed.Dither != "none" {
+		if err := badgeimg.CheckDither(parsed.Dither); err != nil {
+			return opts, err
+		}
+	}
+	if parsed.Threshold < 0 || parsed.Threshold > 255 {
+		return opts, errors.New("the threshold must be between 1 and 255, or 0 for none")
+	}
+	opts.Dither, opts.Threshold, opts.Invert, opts.Linear = parsed.Dither, parsed.Threshold, parsed.Invert, parsed.Linear
+	if parsed.Background != "" {
+		c, err := parseBackground(parsed.Background)
+		if err != nil {
+			return opts, err
+		}
+		opts.Background = c
+	}
+	return opts, nil
+}
+
+// parseBackground parses the background color, which must be solid
+func parseBackground(s string) (color.Color, error) {
+	c, err := badgeimg.ParseColor(s)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, a := c.RGBA(); a != 0xffff {
+		return nil, fmt.Errorf("%w `%s`: it is translucent, the background must be solid", badgeimg.ErrColor, s)
+	}
+	return c, nil
+}
+
+// convert decodes an image (PNG, JPEG or GIF) and converts it to width by
+// height as the options say. It returns the packed bytes and a preview of
+// them, the RGBA pixels of what the panel shows.
+func convert(data []byte, width, height int, options string) ([]byte, []byte, error) {
+	opts, err := parseOptions(options)
+	if err != nil {
+		return nil, nil, err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decoding the image: %w", err)
+	}
+	packed, err := badgeimg.Convert(src, width, height, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	gray, err := badgeimg.BytesToImg(width, height, packed, badgeimg.LayoutBadger)
+	if err != nil {
+		return nil, nil, err
+	}
+	preview := image.NewRGBA(gray.Rect)
+	draw.Draw(preview, preview.Rect, gray, image.Point{}, draw.Src)
+	return packed, preview.Pix, nil
+}
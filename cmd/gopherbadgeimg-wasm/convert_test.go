@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	opts, err := parseOptions(`{"dither": "atkinson", "invert": true, "background": "#ffffff"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Dither != "atkinson" || !opts.Invert || opts.Background != (color.NRGBA{0xff, 0xff, 0xff, 0xff}) {
+		t.Errorf("unexpected options %+v", opts)
+	}
+	for _, data := range []string{"", "{}", `{"dither": "none"}`, `{"threshold": 128}`, `{"background": "white"}`, `{"background": "rgb(0, 0, 0)"}`} {
+		if _, err := parseOptions(data); err != nil {
+			t.Errorf("%s: %v", data, err)
+		}
+	}
+	for _, data := range []string{
+		"{",
+		`{"colour": "red"}`,
+		`{"dither": "wobbly"}`,
+		`{"threshold": 256}`,
+		`{"background": "whitish"}`,
+		`{"background": "#fffff"}`,
+		`{"background": "rgba(0, 0, 0, 0.5)"}`,
+	} {
+		if _, err := parseOptions(data); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+
+	packed, preview, err := convert(buf.Bytes(), 8, 8, `{"invert": true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed, bytes.Repeat([]byte{0xff}, 8)) {
+		t.Errorf("expected a black image, got % x", packed)
+	}
+	// black pixels are opaque black in the preview
+	if len(preview) != 8*8*4 || !bytes.Equal(preview[:4], []byte{0, 0, 0, 0xff}) {
+		t.Errorf("unexpected preview of %d bytes starting with % x", len(preview), preview[:min(len(preview), 4)])
+	}
+
+	if _, _, err := convert([]byte("not an image"), 8, 8, ""); err == nil {
+		t.Error("expected an error for an invalid image")
+	}
+	if _, _, err := convert(buf.Bytes(), 3, 3, ""); err == nil {
+		t.Error("expected an error for a size that isn't a whole number of bytes")
+	}
+}
+
+// TestBuildWasm checks that the command builds for the browser
+func TestBuildWasm(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping the wasm build in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	cmd := exec.Command(gobin, "vet", ".")
+	cmd.Env = append(os.Environ(), "GOOS=js", "GOARCH=wasm")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%v\n%s", err, strings.TrimSpace(string(out)))
+	}
+}
@@ -0,0 +1,12 @@
+module github.com/conejoninja/badger2040/cmd/gopherbadgeimg-wasm
+
+go 1.22.5
+
+require github.com/conejoninja/badger2040/cmd/gopherbadgeimg v0.0.0
+
+require (
+	github.com/makeworld-the-better-one/dither v1.0.0 // indirect
+	golang.org/x/image v0.18.0 // indirect
+)
+
+replace github.com/conejoninja/badger2040/cmd/gopherbadgeimg => ../gopherbadgeimg
@@ -0,0 +1,13 @@
+//go:build !(js && wasm)
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, "gopherbadgeimg-wasm runs in a browser: build it with GOOS=js GOARCH=wasm (see README.md)")
+	os.Exit(1)
+}
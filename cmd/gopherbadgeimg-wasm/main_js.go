@@ -0,0 +1,76 @@
+//go:build js && wasm
+
+// Command gopherbadgeimg-wasm exports the conversion of gopherbadgeimg to
+// JavaScript, for converting badge images in a browser: it sets the global
+// function
+//
+//	convert(imageBytes, width, height, optionsJSON)
+//
+// which takes the bytes of an image as a Uint8Array and returns a promise of
+// {packed, preview}: the packed bytes as a Uint8Array, and the RGBA pixels of
+// a width by height preview as a Uint8ClampedArray, ready for new ImageData.
+// The promise is rejected with an Error when the image can't be converted.
+package main
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+func main() {
+	js.Global().Set("convert", js.FuncOf(jsConvert))
+	// keep the exported function alive
+	select {}
+}
+
+// jsConvert is the convert function exported to JavaScript
+func jsConvert(this js.Value, args []js.Value) any {
+	executor := js.FuncOf(func(this js.Value, promise []js.Value) any {
+		resolve, reject := promise[0], promise[1]
+		go func() {
+			defer func() {
+				// a panic would take the whole module down with it
+				if r := recover(); r != nil {
+					reject.Invoke(jsError(fmt.Errorf("convert: %v", r)))
+				}
+			}()
+			result, err := convertArgs(args)
+			if err != nil {
+				reject.Invoke(jsError(err))
+				return
+			}
+			resolve.Invoke(result)
+		}()
+		return nil
+	})
+	defer executor.Release()
+	return js.Global().Get("Promise").New(executor)
+}
+
+// convertArgs runs convert on the arguments of the JavaScript function
+func convertArgs(args []js.Value) (any, error) {
+	if len(args) < 3 || args[0].Type() != js.TypeObject || args[1].Type() != js.TypeNumber || args[2].Type() != js.TypeNumber {
+		return nil, fmt.Errorf("convert takes (imageBytes: Uint8Array, width: number, height: number, optionsJSON?: string)")
+	}
+	data := make([]byte, args[0].Get("length").Int())
+	js.CopyBytesToGo(data, args[0])
+	options := ""
+	if len(args) > 3 && args[3].Type() == js.TypeString {
+		options = args[3].String()
+	}
+
+	packed, preview, err := convert(data, args[1].Int(), args[2].Int(), options)
+	if err != nil {
+		return nil, err
+	}
+	jsPacked := js.Global().Get("Uint8Array").New(len(packed))
+	js.CopyBytesToJS(jsPacked, packed)
+	jsPreview := js.Global().Get("Uint8ClampedArray").New(len(preview))
+	js.CopyBytesToJS(jsPreview, preview)
+	return map[string]any{"packed": jsPacked, "preview": jsPreview}, nil
+}
+
+// jsError returns err as a JavaScript Error
+func jsError(err error) js.Value {
+	return js.Global().Get("Error").New(err.Error())
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// -anchor letterboxes images instead of stretching them to -ratio: they are
+// scaled to fit it keeping their aspect ratio, and the rest of the canvas is
+// padded with -background, white by default. The anchor is where the image
+// sits in the canvas, all the padding going to the other side: left pins it
+// to the left edge, top-right to the top right corner, and center splits the
+// padding in two, the odd pixel going right or down.
+
+// anchors are the values of -anchor
+var anchors = []string{"center", "left", "right", "top", "bottom", "top-left", "top-right", "bottom-left", "bottom-right"}
+
+// anchorOffset returns where an image sits within a canvas that is free
+// pixels larger, when placed at anchor
+func anchorOffset(anchor string, free image.Point) image.Point {
+	var at image.Point
+	switch anchor {
+	case "left", "top-left", "bottom-left":
+	case "right", "top-right", "bottom-right":
+		at.X = free.X
+	default:
+		at.X = free.X / 2
+	}
+	switch anchor {
+	case "top", "top-left", "top-right":
+	case "bottom", "bottom-left", "bottom-right":
+		at.Y = free.Y
+	default:
+		at.Y = free.Y / 2
+	}
+	return at
+}
+
+// letterbox returns src scaled to fit x by y keeping its aspect ratio, placed
+// at -anchor on a canvas of -background, or white. With -no-upscale, an image
+// that fits already is placed at 1:1 instead of being scaled up.
+func (o *Options) letterbox(src image.Image, x, y int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, x, y))
+	var page color.Color = color.White
+	if o.Background != nil {
+		page = o.Background
+	}
+	draw.Draw(dst, dst.Rect, image.NewUniform(page), image.Point{}, draw.Src)
+	_, vector := src.(rasterizer)
+	if b := src.Bounds(); o.NoUpscale && !vector && b.Dx() <= x && b.Dy() <= y {
+		at := anchorOffset(o.Anchor, image.Pt(x-b.Dx(), y-b.Dy()))
+		draw.Draw(dst, image.Rectangle{at, at.Add(b.Size())}, src, b.Min, draw.Over)
+		return dst
+	}
+	drawFitted(dst, dst.Rect, src, o.Anchor)
+	return dst
+}
+
+// checkUpscale warns that src, the image of in, is scaled up to x by y, which
+// blurs it, or with -no-upscale refuses to. Stretching scales an image up
+// when it is smaller than x by y either way, letterboxing when it is smaller
+// both ways, and -marquee when it is shorter than y. Vector images are drawn
+// at any size.
+func (o *Options) checkUpscale(in Input, src image.Image, x, y int) error {
+	if _, vector := src.(rasterizer); vector {
+		return nil
+	}
+	b := src.Bounds()
+	if o.Marquee {
+		x = b.Dx()
+	}
+	switch {
+	case o.Anchor != "" && (o.NoUpscale || b.Dx() >= x || b.Dy() >= y):
+		return nil
+	case b.Dx() >= x && b.Dy() >= y:
+		return nil
+	}
+	hint := "-no-upscale -anchor center places it at 1:1 in the middle instead"
+	switch {
+	case o.Marquee:
+		hint = "use a taller image"
+	case o.Anchor != "":
+		hint = "-no-upscale places it at 1:1 instead"
+	}
+	if o.NoUpscale {
+		smaller := "smaller"
+		switch {
+		case b.Dx() >= x:
+			smaller = "shorter"
+		case b.Dy() >= y:
+			smaller = "narrower"
+		}
+		if !o.Marquee {
+			hint = "use -anchor center to place it at 1:1 in the middle, padded with -background"
+		}
+		return fmt.Errorf("error: %s is %dx%d, %s than %dx%d, and -no-upscale won't scale it up: %s", in, b.Dx(), b.Dy(), smaller, x, y, hint)
+	}
+	logger.Warnf("%s is %dx%d, scaling it up to %dx%d blurs it: %s", in, b.Dx(), b.Dy(), x, y, hint)
+	return nil
+}
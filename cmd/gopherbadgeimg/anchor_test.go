@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func TestAnchor(t *testing.T) {
+	dir := t.TempDir()
+	// a tall image, black on the left and white on the right, so that it
+	// reads the same way wherever it goes
+	tall := filepath.Join(dir, "tall.png")
+	writeCheckerboard(t, tall, 16, 32, 2, 1)
+	// one whose padding doesn't split evenly
+	odd := filepath.Join(dir, "odd.png")
+	writeCheckerboard(t, odd, 15, 32, 1, 1)
+
+	for _, test := range []struct {
+		src, anchor string
+		want        string
+	}{
+		{tall, "left", strings.Repeat("#", 8) + strings.Repeat(".", 24)},
+		{tall, "right", strings.Repeat(".", 16) + strings.Repeat("#", 8) + strings.Repeat(".", 8)},
+		{tall, "center", strings.Repeat(".", 8) + strings.Repeat("#", 8) + strings.Repeat(".", 16)},
+		{tall, "bottom-left", strings.Repeat("#", 8) + strings.Repeat(".", 24)},
+		{odd, "center", strings.Repeat(".", 8) + strings.Repeat("#", 15) + strings.Repeat(".", 9)},
+	} {
+		out := filepath.Join(t.TempDir(), "out.bin")
+		if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "32x32", "-anchor", test.anchor, "-o", out, test.src); code != 0 {
+			t.Fatalf("%s: expected exit code 0, got %d and\n%s", test.anchor, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := badgeimg.BytesToImg(32, 32, data, badgeimg.LayoutBadger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the image is as tall as the ratio, so every row is the same
+		want := "32 32\n" + strings.Repeat(test.want+"\n", 32)
+		if got := grayPixels(img); got != want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.anchor, want, got)
+		}
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-anchor", "middle"}, "invalid -anchor `middle`"},
+		{[]string{"-anchor", "left", "-marquee"}, "can't be used with -anchor"},
+	} {
+		args := append([]string{"-outmode", "none", "-ratio", "32x32"}, test.args...)
+		if code, _, errOut := runCLI(t, append(args, tall)...); code != exitUsage || !strings.Contains(errOut, test.want) {
+			t.Errorf("%v: expected exit code 2 and %q, got %d and\n%s", test.args, test.want, code, errOut)
+		}
+	}
+}
+
+func TestNoUpscale(t *testing.T) {
+	dir := t.TempDir()
+	// black all over, smaller than 16x16 both ways
+	small := filepath.Join(dir, "small.png")
+	writeCheckerboard(t, small, 8, 4, 1, 1)
+	// wider than 16x16, but shorter
+	wide := filepath.Join(dir, "wide.png")
+	writeCheckerboard(t, wide, 32, 8, 1, 1)
+
+	blank := strings.Repeat(".", 16) + "\n"
+	for _, test := range []struct {
+		anchor string
+		want   string
+	}{
+		// the padding splits evenly around the image, which keeps its size
+		{"center", strings.Repeat(blank, 6) + strings.Repeat("...."+strings.Repeat("#", 8)+"....\n", 4) + strings.Repeat(blank, 6)},
+		{"bottom-right", strings.Repeat(blank, 12) + strings.Repeat(strings.Repeat(".", 8)+strings.Repeat("#", 8)+"\n", 4)},
+	} {
+		out := filepath.Join(t.TempDir(), "out.bin")
+		code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "16x16", "-no-upscale", "-anchor", test.anchor, "-o", out, small)
+		if code != 0 || strings.Contains(errOut, "warning") {
+			t.Fatalf("%s: expected exit code 0 and no warning, got %d and\n%s", test.anchor, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := badgeimg.BytesToImg(16, 16, data, badgeimg.LayoutBadger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := grayPixels(img); got != "16 16\n"+test.want {
+			t.Errorf("%s: expected\n16 16\n%s\ngot\n%s", test.anchor, test.want, got)
+		}
+	}
+
+	for _, test := range []struct {
+		args []string
+		src  string
+		code int
+		want string
+	}{
+		{[]string{"-no-upscale"}, small, exitFailure, "small.png is 8x4, smaller than 16x16, and -no-upscale won't scale it up: use -anchor center"},
+		{[]string{"-no-upscale"}, wide, exitFailure, "wide.png is 32x8, shorter than 16x16"},
+		{[]string{"-no-upscale", "-ratio", "32x32"}, wide, exitFailure, "wide.png is 32x8, shorter than 32x32"},
+		{nil, small, 0, "warning: " + small + " is 8x4, scaling it up to 16x16 blurs it: -no-upscale -anchor center"},
+		{[]string{"-anchor", "center"}, small, 0, "scaling it up to 16x16 blurs it: -no-upscale places it at 1:1 instead"},
+	} {
+		args := append([]string{"-outmode", "none", "-ratio", "16x16"}, test.args...)
+		if code, _, errOut := runCLI(t, append(args, test.src)...); code != test.code || !strings.Contains(errOut, test.want) {
+			t.Errorf("%v: expected exit code %d and %q, got %d and\n%s", test.args, test.code, test.want, code, errOut)
+		}
+	}
+	// letterboxing the wide image fits it by shrinking it, not scaling it up
+	if code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "16x16", "-anchor", "center", wide); code != 0 || strings.Contains(errOut, "warning") {
+		t.Errorf("expected no warning letterboxing a wider image, got %d and\n%s", code, errOut)
+	}
+}
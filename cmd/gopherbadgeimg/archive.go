@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+// archiveExts are the archive types whose image entries can be converted
+var archiveExts = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// imageExts are the entries of an archive that are treated as images
+var imageExts = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true,
+	".webp": true, ".svg": true, ".ico": true,
+	".pbm": true, ".pgm": true, ".ppm": true, ".pnm": true,
+}
+
+// archiveExt returns the archive extension name ends with, if any
+func archiveExt(name string) string {
+	lower := strings.ToLower(name)
+	// check the longest extensions first so .tar.gz isn't taken for a .gz
+	for i := len(archiveExts) - 1; i >= 0; i-- {
+		if strings.HasSuffix(lower, archiveExts[i]) {
+			return archiveExts[i]
+		}
+	}
+	return ""
+}
+
+// splitArchivePath recognizes "archive.zip" and "archive.zip:inner/path.png",
+// returning the archive and the (possibly empty) entry within it.
+func splitArchivePath(infile string) (archive, entry string, ok bool) {
+	if infile == stdinName || IsURL(infile) {
+		return "", "", false
+	}
+	if archiveExt(infile) != "" {
+		return infile, "", true
+	}
+	lower := strings.ToLower(infile)
+	for _, ext := range archiveExts {
+		if i := strings.LastIndex(lower, ext+":"); i >= 0 {
+			return infile[:i+len(ext)], infile[i+len(ext)+1:], true
+		}
+	}
+	return "", "", false
+}
+
+// sanitizeEntryName turns an archive entry name into a relative slash
+// separated path that can't escape the output directory: ".." elements and
+// leading slashes are dropped.
+func sanitizeEntryName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = path.Clean("/" + name)
+	return strings.TrimLeft(name, "/")
+}
+
+// ReadArchive returns the image entries of a zip or tar(.gz) archive, or only
+// the one named entry when entry isn't empty.
+//
+// Each input is named after its entry path without the extension, so
+// assets/icons/heart.png becomes assets/icons/heart-<ratio>.bin.
+func ReadArchive(archive, entry string) ([]Input, error) {
+	if err := checkInputFile(archive); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode().IsRegular() && info.Size() == 0 {
+		return nil, checkEmpty(archive, nil)
+	}
+
+	var inputs []Input
+	// wanted returns the clean name of an entry to convert, skipping the
+	// others
+	wanted := func(name string) (string, bool) {
+		clean := sanitizeEntryName(name)
+		if entry != "" && clean != sanitizeEntryName(entry) {
+			return "", false
+		}
+		if ext := strings.ToLower(path.Ext(clean)); !imageExts[ext] {
+			logger.Debugf("skipping %s:%s: not an image", archive, name)
+			return "", false
+		}
+		return clean, true
+	}
+	// entries are read whole and kept until the conversions start, so each
+	// is limited to -max-download, as downloads are, before anything knows
+	// how many pixels it claims
+	tooLarge := func(name string) error {
+		return fmt.Errorf("%s:%s is over the %d byte limit set by -max-download", archive, name, maxDownload)
+	}
+	add := func(name, clean string, r io.Reader) error {
+		data, err := io.ReadAll(io.LimitReader(r, maxDownload+1))
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", name, err)
+		}
+		if int64(len(data)) > maxDownload {
+			return tooLarge(name)
+		}
+		inputs = append(inputs, Input{
+			Path: archive + ":" + clean,
+			Name: strings.TrimSuffix(clean, path.Ext(clean)),
+			Data: data,
+		})
+		return nil
+	}
+
+	if archiveExt(archive) == ".zip" {
+		if !info.Mode().IsRegular() {
+			// the directory of a zip archive is at its end
+			return nil, fmt.Errorf("%s is a named pipe, zip archives can only be read from regular files", archive)
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return nil, err
+		}
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() {
+				continue
+			}
+			clean, ok := wanted(zf.Name)
+			if !ok {
+				continue
+			}
+			if zf.UncompressedSize64 > uint64(maxDownload) {
+				return nil, tooLarge(zf.Name)
+			}
+			rc, err := zf.Open()
+			if err != nil {
+				return nil, fmt.Errorf("error reading %s: %w", zf.Name, err)
+			}
+			err = add(zf.Name, clean, rc)
+			rc.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		var r io.Reader = f
+		if ext := archiveExt(archive); ext == ".tar.gz" || ext == ".tgz" {
+			gz, err := gzip.NewReader(f)
+			if err != nil {
+				return nil, err
+			}
+			defer gz.Close()
+			r = gz
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if hdr.Typeflag != tar.TypeReg {
+				if hdr.Typeflag != tar.TypeDir {
+					logger.Debugf("skipping %s:%s: not a regular file", archive, hdr.Name)
+				}
+				continue
+			}
+			clean, ok := wanted(hdr.Name)
+			if !ok {
+				continue
+			}
+			if hdr.Size > maxDownload {
+				return nil, tooLarge(hdr.Name)
+			}
+			if err := add(hdr.Name, clean, tr); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if entry != "" && len(inputs) == 0 {
+		return nil, fmt.Errorf("%s has no image named %s", archive, entry)
+	}
+	return inputs, nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// convertArchive converts every image in archive to profile sized bin files
+// inside dir, returning the number of entries that failed.
+func convertArchive(t *testing.T, dir, archive string) int {
+	t.Helper()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio = "bin", "profile"
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	inputs, err := opts.CollectInputs(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed := 0
+	for _, in := range inputs {
+		if _, err := opts.convertInput(in, 120, 128); err != nil {
+			failed++
+		}
+	}
+	return failed
+}
+
+func TestZipArchive(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "pack.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range map[string][]byte{
+		"gopher.png":              png,
+		"icons/small/gopher.png":  png,
+		"README.txt":              []byte("not an image"),
+		"../../escape/gopher.png": png,
+		"icons/empty-dir/":        nil,
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	if failed := convertArchive(t, dir, "pack.zip"); failed != 0 {
+		t.Fatalf("expected every image to convert, %d failed", failed)
+	}
+	for _, name := range []string{"gopher-profile.bin", "icons/small/gopher-profile.bin", "escape/gopher-profile.bin"} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+			continue
+		}
+		if info.Size() != 120*128/8 {
+			t.Errorf("%s is %d bytes, expected %d", name, info.Size(), 120*128/8)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "README-profile.bin")); err == nil {
+		t.Error("expected the non-image entry to be skipped")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "..", "..", "escape")); err == nil {
+		t.Error("entry escaped the output directory")
+	}
+
+	// a single entry can be picked out of the archive
+	inputs, err := NewOptions().CollectInputs(filepath.Join(dir, "pack.zip") + ":icons/small/gopher.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) != 1 || inputs[0].Name != "icons/small/gopher" {
+		t.Errorf("expected only icons/small/gopher, got %v", inputs)
+	}
+}
+
+func TestTarGzArchiveWithCorruptImage(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "pack.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	entries := []struct {
+		name string
+		data []byte
+	}{
+		{"a.png", png},
+		{"b.png", png[:len(png)/2]},
+		{"c/d.png", png},
+	}
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write(e.data)
+	}
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	if failed := convertArchive(t, dir, "pack.tar.gz"); failed != 1 {
+		t.Fatalf("expected exactly the corrupt image to fail, %d failed", failed)
+	}
+	for _, name := range []string{"a-profile.bin", "c/d-profile.bin"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b-profile.bin")); err == nil {
+		t.Error("expected no output for the corrupt image")
+	}
+}
+
+func TestArchiveEntryLimit(t *testing.T) {
+	oldMax := maxDownload
+	defer func() { maxDownload = oldMax }()
+	maxDownload = 1024
+
+	dir := t.TempDir()
+	big := make([]byte, 4096)
+	zipPath := filepath.Join(dir, "pack.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for _, name := range []string{"notes.txt", "small.png", "big.png"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "small.png" {
+			w.Write(big[:512])
+		} else {
+			w.Write(big)
+		}
+	}
+	zw.Close()
+	f.Close()
+
+	tarPath := filepath.Join(dir, "pack.tar.gz")
+	f, err = os.Create(tarPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "big.png", Mode: 0o644, Size: int64(len(big)), Typeflag: tar.TypeReg})
+	tw.Write(big)
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	for _, archive := range []string{zipPath, tarPath} {
+		if _, err := ReadArchive(archive, ""); err == nil || !strings.Contains(err.Error(), "big.png is over the 1024 byte limit set by -max-download") {
+			t.Errorf("%s: expected big.png to be over the limit, got %v", archive, err)
+		}
+	}
+	// entries that aren't converted aren't limited
+	inputs, err := ReadArchive(zipPath, "small.png")
+	if err != nil || len(inputs) != 1 {
+		t.Errorf("expected small.png alone to be read, got %v, %v", inputs, err)
+	}
+}
@@ -0,0 +1,130 @@
+// Package badgeimg converts between images and the packed buffers of the
+// badge's e-ink display, one bit per pixel, a set bit being black.
+//
+// It is the part of gopherbadgeimg that firmware tests and other tools can
+// import, down to Convert, which turns any image into a packed buffer. It
+// does no file I/O, so it builds for browsers too (GOOS=js GOARCH=wasm).
+package badgeimg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// ErrBufferSize is returned for a buffer that doesn't hold exactly an image
+// of the given size
+var ErrBufferSize = errors.New("buffer size doesn't match the image size")
+
+// Pack packs an x by y black and white image with layout, as ImgToBytes does
+// once it has dithered it: black pixels are set, any other color is clear.
+// The size must be one layout validates.
+//
+// The pixels of *image.RGBA and *image.Gray images, which are what
+// conversions pack, are read straight from their Pix slice: going through At
+// costs an interface call and a color conversion per pixel, most of the time
+// spent packing. Other images, and images smaller than x by y, whose missing
+// pixels At reads as transparent black, go through packAt.
+func Pack(x, y int, img image.Image, layout Layout) []byte {
+	b := img.Bounds()
+	if b.Dx() >= x && b.Dy() >= y {
+		switch img := img.(type) {
+		case *image.RGBA:
+			return packPix(x, y, img.Pix[img.PixOffset(b.Min.X, b.Min.Y):], img.Stride, 4, layout)
+		case *image.Gray:
+			return packPix(x, y, img.Pix[img.PixOffset(b.Min.X, b.Min.Y):], img.Stride, 1, layout)
+		}
+	}
+	return packAt(x, y, img, layout)
+}
+
+// packPix is Pack for the pixels in pix, the rows of an image stride bytes
+// apart, each pixel taking size bytes: 4 for RGBA, black when its color bytes
+// are all 0 whatever its alpha as in packAt, or 1 for gray, black at 0
+func packPix(x, y int, pix []byte, stride, size int, layout Layout) []byte {
+	bits := make([]byte, layout.BufferLen(x, y))
+	// the offset of each pixel, see BitIndex, steps from one pixel of a row
+	// to the next rather than being worked out for each of them, unless
+	// lines are padded or in pages
+	stepped := layout.ScanOrder != PageMajor && layout.RowPadding == 0
+	step := 1
+	if layout.ScanOrder == ColumnMajor {
+		step = y
+	}
+	for j := 0; j < y; j++ {
+		row := pix[j*stride : j*stride+x*size]
+		offset := j * x
+		if layout.ScanOrder == ColumnMajor {
+			offset = j
+		}
+		for p := 0; p < len(row); p, offset = p+size, offset+step {
+			if row[p] != 0 || size == 4 && row[p+1]|row[p+2] != 0 {
+				continue
+			}
+			if !stepped {
+				n, mask := layout.bit(x, y, p/size, j)
+				bits[n] |= mask
+			} else {
+				bits[offset>>3] |= layout.Mask(offset)
+			}
+		}
+	}
+	return bits
+}
+
+// packAt is Pack for any image, reading its pixels through At
+func packAt(x, y int, img image.Image, layout Layout) []byte {
+	bits := make([]byte, layout.BufferLen(x, y))
+	b := img.Bounds()
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			r, g, bl, _ := img.At(b.Min.X+i, b.Min.Y+j).RGBA()
+			if r+g+bl == 0 {
+				n, mask := layout.bit(x, y, i, j)
+				bits[n] |= mask
+			}
+		}
+	}
+	return bits
+}
+
+// BytesToImg unpacks an x by y image packed with layout, the reverse of
+// Pack: set bits are black and clear bits white. Only the first plane of
+// layouts with several is read.
+func BytesToImg(x, y int, bits []byte, layout Layout) (*image.Gray, error) {
+	if err := layout.Validate(x, y); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBufferSize, err)
+	}
+	if n := layout.BufferLen(x, y); len(bits) != n {
+		return nil, fmt.Errorf("%w: a %dx%d image is %d bytes, got %d", ErrBufferSize, x, y, n, len(bits))
+	}
+	img := image.NewGray(image.Rect(0, 0, x, y))
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			n, mask := layout.bit(x, y, i, j)
+			if bits[n]&mask != 0 {
+				img.SetGray(i, j, color.Gray{Y: 0})
+			} else {
+				img.SetGray(i, j, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	return img, nil
+}
+
+// Repack returns the x by y image bits, packed with from, packed with to
+// instead
+func Repack(x, y int, bits []byte, from, to Layout) ([]byte, error) {
+	if from.normalized() == to.normalized() {
+		return bits, nil
+	}
+	if err := to.Validate(x, y); err != nil {
+		return nil, err
+	}
+	img, err := BytesToImg(x, y, bits, from)
+	if err != nil {
+		return nil, err
+	}
+	return Pack(x, y, img, to), nil
+}
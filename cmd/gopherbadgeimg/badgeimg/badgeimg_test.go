@@ -0,0 +1,419 @@
+package badgeimg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+)
+
+// layouts holds every scan and bit order, padded and with several planes,
+// along with the presets of LayoutNames
+var layouts = []Layout{
+	LayoutBadger,
+	{ScanOrder: ColumnMajor, BitOrder: LSBFirst},
+	LayoutRowMSB,
+	{ScanOrder: RowMajor, BitOrder: LSBFirst},
+	LayoutBadgerOS,
+	{ScanOrder: ColumnMajor, BitOrder: LSBFirst, RowPadding: 2},
+	LayoutSSD1306,
+	{ScanOrder: PageMajor, BitOrder: MSBFirst, PlaneCount: 2},
+	{ScanOrder: RowMajor, BitOrder: MSBFirst, RowPadding: 4, PlaneCount: 3},
+}
+
+// sizes holds odd and even dimensions whose pixels fill whole bytes, some of
+// which aren't whole pages of 8 rows: tests skip the sizes a layout doesn't
+// validate
+var sizes = [][2]int{{8, 1}, {1, 8}, {3, 8}, {8, 5}, {16, 16}, {120, 128}, {246, 128}}
+
+// randomGray returns an x by y image of random black and white pixels
+func randomGray(rng *rand.Rand, x, y int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, x, y))
+	for i := range img.Pix {
+		if rng.Intn(2) == 0 {
+			img.Pix[i] = 0xff
+		}
+	}
+	return img
+}
+
+func TestBytesToImgRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, layout := range layouts {
+		for _, size := range sizes {
+			x, y := size[0], size[1]
+			if layout.Validate(x, y) != nil || layout.BufferLen(x, y) != x*y/8 {
+				// random padding and planes don't come back
+				continue
+			}
+			t.Run(fmt.Sprintf("%v/%dx%d", layout, x, y), func(t *testing.T) {
+				for n := 0; n < 20; n++ {
+					bits := make([]byte, x*y/8)
+					rng.Read(bits)
+					img, err := BytesToImg(x, y, bits, layout)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got := Pack(x, y, img, layout); !bytes.Equal(got, bits) {
+						t.Fatalf("expected % x back, got % x", bits, got)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestPackRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for _, layout := range layouts {
+		for _, size := range sizes {
+			x, y := size[0], size[1]
+			if layout.Validate(x, y) != nil {
+				continue
+			}
+			src := randomGray(rng, x, y)
+			img, err := BytesToImg(x, y, Pack(x, y, src, layout), layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(img.Pix, src.Pix) {
+				t.Errorf("%v %dx%d: expected the same pixels back", layout, x, y)
+			}
+		}
+	}
+}
+
+func TestBytesToImgLayout(t *testing.T) {
+	// an image with only pixel (1, 0) black: in an 8x2 image, the third
+	// pixel scanning columns, the second scanning rows
+	tests := []struct {
+		layout Layout
+		x, y   int
+		want   []byte
+	}{
+		{LayoutBadger, 8, 2, []byte{0x20, 0x00}},
+		{Layout{ScanOrder: ColumnMajor, BitOrder: LSBFirst}, 8, 2, []byte{0x04, 0x00}},
+		{LayoutRowMSB, 8, 2, []byte{0x40, 0x00}},
+		{Layout{ScanOrder: RowMajor, BitOrder: LSBFirst}, 8, 2, []byte{0x02, 0x00}},
+		// rows of 8 pixels are whole bytes already
+		{LayoutBadgerOS, 8, 2, []byte{0x40, 0x00}},
+		{Layout{ScanOrder: RowMajor, BitOrder: MSBFirst, RowPadding: 2}, 8, 2, []byte{0x40, 0x00, 0x00, 0x00}},
+		// the second plane is left clear
+		{Layout{ScanOrder: ColumnMajor, BitOrder: MSBFirst, PlaneCount: 2}, 8, 2, []byte{0x20, 0x00, 0x00, 0x00}},
+		// the rows of 3 pixels are padded to a byte each
+		{LayoutBadgerOS, 3, 2, []byte{0x40, 0x00}},
+		// the second column of the first page, its top row in the low bit
+		{LayoutSSD1306, 2, 8, []byte{0x00, 0x01}},
+		{Layout{ScanOrder: PageMajor, BitOrder: MSBFirst}, 2, 8, []byte{0x00, 0x80}},
+	}
+	for _, test := range tests {
+		img, err := BytesToImg(test.x, test.y, test.want, test.layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < test.x; i++ {
+			for j := 0; j < test.y; j++ {
+				black := i == 1 && j == 0
+				if got := img.GrayAt(i, j).Y == 0; got != black {
+					t.Errorf("%v: expected pixel (%d, %d) black=%v", test.layout, i, j, black)
+				}
+			}
+		}
+		src := image.NewGray(image.Rect(0, 0, test.x, test.y))
+		for i := range src.Pix {
+			src.Pix[i] = 0xff
+		}
+		src.SetGray(1, 0, color.Gray{})
+		if got := Pack(test.x, test.y, src, test.layout); !bytes.Equal(got, test.want) {
+			t.Errorf("%v: expected % x, got % x", test.layout, test.want, got)
+		}
+	}
+}
+
+func TestRepack(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	for _, from := range layouts {
+		for _, to := range layouts {
+			for _, size := range sizes {
+				x, y := size[0], size[1]
+				if from.Validate(x, y) != nil || to.Validate(x, y) != nil {
+					continue
+				}
+				src := randomGray(rng, x, y)
+				packed := Pack(x, y, src, from)
+				got, err := Repack(x, y, packed, from, to)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := Pack(x, y, src, to); !bytes.Equal(got, want) {
+					t.Errorf("%v to %v at %dx%d: expected % x, got % x", from, to, x, y, want, got)
+				}
+				back, err := Repack(x, y, got, to, from)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(back, packed) {
+					t.Errorf("%v to %v and back at %dx%d: expected % x, got % x", from, to, x, y, packed, back)
+				}
+			}
+		}
+	}
+}
+
+// oddSizes are the widths and heights TestBitIndex crosses, odd and even,
+// shorter and longer than a byte and a page
+var oddSizes = []int{1, 2, 3, 7, 8, 9, 13, 16, 24}
+
+// TestBitIndex checks that every path reading or writing packed images
+// agrees on where each pixel is, for every layout and every size of
+// oddSizes it validates: a random image is packed, unpacked, read back a
+// pixel at a time, drawn on a Framebuffer and encoded as a PBM, and any two
+// disagreeing on a single pixel fail.
+func TestBitIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	for _, layout := range layouts {
+		for _, x := range oddSizes {
+			for _, y := range oddSizes {
+				if layout.Validate(x, y) != nil {
+					continue
+				}
+				t.Run(fmt.Sprintf("%v/%dx%d", layout, x, y), func(t *testing.T) {
+					testBitIndex(t, rng, layout, x, y)
+				})
+			}
+		}
+	}
+}
+
+func testBitIndex(t *testing.T, rng *rand.Rand, layout Layout, x, y int) {
+	// every pixel has a bit of its own in the first plane
+	seen := map[int]bool{}
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			n := BitIndex(layout, i, j, x, y)
+			if n < 0 || n >= layout.planeLen(x, y)*8 || seen[n] {
+				t.Fatalf("pixel (%d, %d) is bit %d, out of the plane or shared", i, j, n)
+			}
+			seen[n] = true
+		}
+	}
+
+	src := randomGray(rng, x, y)
+	rgba := image.NewRGBA(src.Rect)
+	draw.Draw(rgba, rgba.Rect, src, image.Point{}, draw.Src)
+	bits := Pack(x, y, src, layout)
+	for name, other := range map[string][]byte{
+		"Pack of RGBA": Pack(x, y, rgba, layout),
+		"packAt":       packAt(x, y, src, layout),
+	} {
+		if !bytes.Equal(other, bits) {
+			t.Errorf("%s packs % x, Pack of gray % x", name, other, bits)
+		}
+	}
+	banded := make([]byte, layout.BufferLen(x, y))
+	for top := 0; top < y; top += 3 {
+		packBand(x, y, rgba.SubImage(image.Rect(0, top, x, min(top+3, y))).(*image.RGBA), layout, banded)
+	}
+	if !bytes.Equal(banded, bits) {
+		t.Errorf("packBand packs % x, Pack % x", banded, bits)
+	}
+
+	img, err := BytesToImg(x, y, bits, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fb, err := WrapFramebuffer(bits, x, y, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drawn, err := NewFramebuffer(x, y, layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pbm bytes.Buffer
+	if err := EncodePBM(&pbm, x, y, bits, layout); err != nil {
+		t.Fatal(err)
+	}
+	rows := bytes.SplitN(pbm.Bytes(), []byte("\n"), 3)[2]
+	stride := (x + 7) / 8
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			black := src.GrayAt(i, j).Y == 0
+			drawn.SetBlack(i, j, black)
+			for name, got := range map[string]bool{
+				"BytesToImg":  img.GrayAt(i, j).Y == 0,
+				"PixelAt":     layout.PixelAt(bits, x, y, i, j),
+				"Framebuffer": fb.Black(i, j),
+				"EncodePBM":   rows[j*stride+i/8]&(0x80>>uint(i%8)) != 0,
+			} {
+				if got != black {
+					t.Fatalf("%s reads pixel (%d, %d) black=%v, the source has it black=%v", name, i, j, got, black)
+				}
+			}
+		}
+	}
+	if !bytes.Equal(drawn.Bits, bits) {
+		t.Errorf("a Framebuffer draws % x, Pack % x", drawn.Bits, bits)
+	}
+}
+
+func TestLayoutValidate(t *testing.T) {
+	tests := []struct {
+		layout Layout
+		x, y   int
+		length int
+		err    bool
+	}{
+		{LayoutBadger, 246, 128, 3936, false},
+		{LayoutBadger, 3, 3, 0, true},
+		{LayoutBadger, 0, 8, 0, true},
+		{LayoutRowMSB, 3, 8, 3, false},
+		// 3 pixels take a byte, 296 take 37 bytes
+		{LayoutBadgerOS, 3, 3, 3, false},
+		{LayoutBadgerOS, 296, 128, 4736, false},
+		{Layout{ScanOrder: ColumnMajor, BitOrder: MSBFirst, RowPadding: 4}, 2, 12, 8, false},
+		{LayoutSSD1306, 128, 64, 1024, false},
+		{LayoutSSD1306, 8, 12, 0, true},
+		{Layout{ScanOrder: PageMajor, BitOrder: LSBFirst, PlaneCount: 2}, 128, 64, 2048, false},
+		{Layout{ScanOrder: 3}, 8, 8, 0, true},
+		{Layout{BitOrder: 2}, 8, 8, 0, true},
+		{Layout{RowPadding: -1}, 8, 8, 0, true},
+		{Layout{PlaneCount: -1}, 8, 8, 0, true},
+	}
+	for _, test := range tests {
+		err := test.layout.Validate(test.x, test.y)
+		if (err != nil) != test.err {
+			t.Errorf("%v at %dx%d: expected an error: %v, got %v", test.layout, test.x, test.y, test.err, err)
+		}
+		if err == nil && test.layout.BufferLen(test.x, test.y) != test.length {
+			t.Errorf("%v at %dx%d: expected %d bytes, got %d", test.layout, test.x, test.y, test.length, test.layout.BufferLen(test.x, test.y))
+		}
+	}
+}
+
+func TestLookupLayout(t *testing.T) {
+	for _, name := range LayoutNames {
+		layout, err := LookupLayout(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if layout.String() != name {
+			t.Errorf("expected the %s layout to be called %s, got %s", name, name, layout)
+		}
+	}
+	if layout, err := LookupLayout(""); err != nil || layout != LayoutBadger {
+		t.Errorf("expected the default layout to be the badge's, got %v, %v", layout, err)
+	}
+	if _, err := LookupLayout("ssd1309"); !errors.Is(err, ErrUnknownLayout) {
+		t.Errorf("expected ErrUnknownLayout, got %v", err)
+	}
+	// the zero Layout, and one plane, are the badge's
+	if (Layout{PlaneCount: 1}).String() != "badger" {
+		t.Errorf("expected a plane to be the badger layout, got %v", Layout{PlaneCount: 1})
+	}
+	custom := Layout{ScanOrder: RowMajor, BitOrder: LSBFirst, RowPadding: 4, PlaneCount: 2}
+	if got, want := custom.String(), "row-major lsb-first, lines padded to 4 byte(s), 2 planes"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, want := fmt.Sprintf("%#v", LayoutSSD1306), "badgeimg.LayoutSSD1306"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if got, want := fmt.Sprintf("%#v", custom), "badgeimg.Layout{ScanOrder: badgeimg.RowMajor, BitOrder: badgeimg.LSBFirst, RowPadding: 4, PlaneCount: 2}"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
+
+func TestBytesToImgSize(t *testing.T) {
+	for _, test := range []struct {
+		x, y, n int
+	}{
+		{8, 8, 7},
+		{8, 8, 9},
+		{3, 3, 1},
+		{0, 8, 0},
+	} {
+		if _, err := BytesToImg(test.x, test.y, make([]byte, test.n), LayoutBadger); !errors.Is(err, ErrBufferSize) {
+			t.Errorf("%dx%d from %d bytes: expected ErrBufferSize, got %v", test.x, test.y, test.n, err)
+		}
+	}
+}
+
+// randomPixel returns a color that is black one time in three, with any
+// alpha, and else has random channels, some of which may be 0
+func randomPixel(rng *rand.Rand) color.RGBA {
+	if rng.Intn(3) == 0 {
+		return color.RGBA{A: uint8(rng.Intn(256))}
+	}
+	c := color.RGBA{uint8(rng.Intn(256)), uint8(rng.Intn(256)), uint8(rng.Intn(256)), 0xff}
+	switch rng.Intn(4) {
+	case 0:
+		c.R = 0
+	case 1:
+		c.G, c.B = 0, 0
+	}
+	return c
+}
+
+func TestPackFastPath(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	for _, layout := range layouts {
+		for _, size := range sizes {
+			x, y := size[0], size[1]
+			// a margin around the image, so that subimages start away from
+			// the origin and their rows are shorter than the stride
+			rgba := image.NewRGBA(image.Rect(-3, -2, x+5, y+4))
+			gray := image.NewGray(rgba.Rect)
+			for j := rgba.Rect.Min.Y; j < rgba.Rect.Max.Y; j++ {
+				for i := rgba.Rect.Min.X; i < rgba.Rect.Max.X; i++ {
+					rgba.SetRGBA(i, j, randomPixel(rng))
+					gray.SetGray(i, j, color.Gray{uint8(rng.Intn(3)) * 0x7f})
+				}
+			}
+			if layout.Validate(x, y) != nil {
+				continue
+			}
+			for _, img := range []image.Image{
+				rgba,
+				gray,
+				rgba.SubImage(image.Rect(2, 1, 2+x, 1+y)),
+				gray.SubImage(image.Rect(2, 1, 2+x, 1+y)),
+			} {
+				if got, want := Pack(x, y, img, layout), packAt(x, y, img, layout); !bytes.Equal(got, want) {
+					t.Errorf("%v %dx%d %T at %v: expected % x, got % x", layout, x, y, img, img.Bounds().Min, want, got)
+				}
+			}
+		}
+	}
+}
+
+// BenchmarkPack packs a dithered splash image reading its pixels straight
+// from Pix, and through At: pix should be several times faster.
+func BenchmarkPack(b *testing.B) {
+	src := image.NewRGBA(image.Rect(0, 0, 246, 128))
+	for y := 0; y < 128; y++ {
+		for x := 0; x < 246; x++ {
+			src.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 0xFF})
+		}
+	}
+	img, err := Monochrome(src, Options{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, bench := range []struct {
+		name string
+		pack func(x, y int, img image.Image, layout Layout) []byte
+	}{
+		{"pix", Pack},
+		{"at", packAt},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				bench.pack(246, 128, img, LayoutBadger)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package badgeimg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"time"
+
+	"golang.org/x/image/draw"
+)
+
+// ErrBands is matched by the errors of ConvertBands for options that can't
+// convert an image band by band
+var ErrBands = errors.New("can't convert in bands")
+
+// ConvertBands is Convert for images far larger than the display, such as
+// the banners of marquees and sprite sheets: rather than scaling src to a
+// width by height RGBA image, 32 bits per pixel, and dithering and packing
+// that, it does each in turn for a band of rows at a time, band rows high,
+// reusing the memory of one band for the next, and writes the packed image
+// to w. A banner 10000 pixels wide and 128 high takes 640 kB in bands of 16
+// rows rather than 5 MB.
+//
+// Only what works pixel by pixel can be done in bands: a Threshold, no
+// dithering, or the ordered bayer dither, whose pattern is set by where each
+// pixel sits in the whole image so that bands meet without seams. Error
+// diffusion spreads the error of each pixel onto the rows below, and
+// ThresholdAuto picks a threshold from the whole image, so they return
+// ErrBands.
+//
+// Row-major layouts are written band by band, as each is packed, as are
+// page-major ones for bands of whole pages of 8 rows; the bytes of a band
+// must be whole, band rows of width pixels filling whole bytes when they
+// aren't padded. Column-major layouts, such as LayoutBadger, put pixels of
+// every band in each byte, so they are packed into a buffer of a bit per
+// pixel, written once complete.
+func ConvertBands(w io.Writer, src image.Image, width, height, band int, opts Options) error {
+	if err := opts.Layout.Validate(width, height); err != nil {
+		return err
+	}
+	if err := opts.checkBands(width, band); err != nil {
+		return err
+	}
+	size := src.Bounds().Size()
+	opts.Logger.Debugf("converting a %dx%d image to %dx%d in bands of %d rows, %s", size.X, size.Y, width, height, band, opts.Method())
+	start := time.Now()
+	// the planes after the first are left clear, see Layout.PlaneCount
+	layout := opts.Layout
+	layout.PlaneCount = 0
+	var packed []byte
+	if layout.ScanOrder == ColumnMajor {
+		packed = make([]byte, layout.BufferLen(width, height))
+	}
+	pix := make([]byte, width*min(band, height)*4)
+	for top := 0; top < height; top += band {
+		bottom := min(top+band, height)
+		img := &image.RGBA{Pix: pix[:width*(bottom-top)*4], Stride: width * 4, Rect: image.Rect(0, top, width, bottom)}
+		if err := opts.convertBand(img, src, width, height); err != nil {
+			return err
+		}
+		if packed != nil {
+			packBand(width, height, img, layout, packed)
+			continue
+		}
+		// a band of whole bytes is packed alone as it is in the whole image
+		if _, err := w.Write(Pack(width, bottom-top, img, layout)); err != nil {
+			return err
+		}
+	}
+	opts.Logger.Timef(start, "converted in bands")
+	rest := make([]byte, layout.BufferLen(width, height)*(opts.Layout.planes()-1))
+	for _, data := range [][]byte{packed, rest} {
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkBands returns ErrBands when opts can't convert images width pixels
+// wide in bands of band rows
+func (opts Options) checkBands(width, band int) error {
+	switch {
+	case band <= 0:
+		return fmt.Errorf("%w: bands of %d rows have no pixels", ErrBands, band)
+	case opts.Threshold == ThresholdAuto:
+		return fmt.Errorf("%w: Otsu's method picks a threshold from the whole image", ErrBands)
+	case opts.Threshold > 0, opts.Dither == "none":
+	case opts.Matrix != nil || opts.Dither != "bayer":
+		return fmt.Errorf("%w %s, which spreads the error of each pixel onto the rows below: use bayer, a threshold or no dithering", ErrBands, opts.Method())
+	}
+	switch l := opts.Layout; {
+	case l.ScanOrder == PageMajor && band%8 != 0:
+		return fmt.Errorf("%w: bands of %d rows aren't made of whole pages of 8 rows", ErrBands, band)
+	case l.ScanOrder == RowMajor && l.RowPadding == 0 && width*band%8 != 0:
+		return fmt.Errorf("%w: bands of %d rows of %d pixels don't fill whole bytes", ErrBands, band, width)
+	}
+	return nil
+}
+
+// convertBand scales the rows of src that img, a band of a width by height
+// image, holds into it, and reduces them to black and white as Convert does
+func (opts Options) convertBand(img *image.RGBA, src image.Image, width, height int) error {
+	var page color.Color = color.Transparent
+	if opts.Background != nil {
+		page = opts.Background
+	}
+	draw.Draw(img, img.Rect, image.NewUniform(page), image.Point{}, draw.Src)
+	// the scaler maps the whole image, and only draws the rows in img
+	draw.NearestNeighbor.Scale(img, image.Rect(0, 0, width, height), src, src.Bounds(), draw.Over, nil)
+	if opts.Invert {
+		opts.invert(img)
+	}
+	opts.gamma(img)
+	// bayer dithers each pixel by its coordinates, which the band keeps
+	dst, err := Monochrome(img, opts)
+	if err != nil {
+		return err
+	}
+	if dst != img {
+		copy(img.Pix, dst.Pix)
+	}
+	return nil
+}
+
+// packBand packs img, a band of an x by y black and white image, into bits,
+// the image packed whole with layout
+func packBand(x, y int, img *image.RGBA, layout Layout, bits []byte) {
+	b := img.Rect
+	for j := b.Min.Y; j < b.Max.Y; j++ {
+		for i := b.Min.X; i < b.Max.X; i++ {
+			p := img.PixOffset(i, j)
+			if img.Pix[p]|img.Pix[p+1]|img.Pix[p+2] == 0 {
+				n, mask := layout.bit(x, y, i, j)
+				bits[n] |= mask
+			}
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package badgeimg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"runtime"
+	"testing"
+)
+
+// fade returns an x by y image shading from black to white across, and
+// from opaque to half transparent down
+func fade(x, y int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, x, y))
+	for j := range y {
+		for i := range x {
+			v := uint8(i * 0xff / max(1, x-1))
+			img.SetNRGBA(i, j, color.NRGBA{v, v, 0xff - v, uint8(0xff - j*0x80/y)})
+		}
+	}
+	return img
+}
+
+func TestConvertBands(t *testing.T) {
+	// scaled up across and down the other way, so that the bands start at
+	// source rows the scaler has to work out
+	src := fade(37, 61)
+	for _, opts := range []Options{
+		{Dither: "bayer"},
+		{Dither: "bayer", Invert: true, Gamma: 1.8, Background: color.White},
+		{Dither: "bayer", Linear: true},
+		{Threshold: 0x60},
+		{Dither: "none"},
+	} {
+		for _, layout := range []Layout{LayoutBadger, LayoutBadgerOS, LayoutRowMSB, LayoutSSD1306, {ScanOrder: RowMajor, PlaneCount: 2}} {
+			opts.Layout = layout
+			want, err := Convert(src, 48, 32, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// bands that split the 4x4 bayer pattern, and one larger than
+			// the image
+			for _, band := range []int{1, 3, 8, 16, 24, 100} {
+				if opts.checkBands(48, band) != nil {
+					// page-major bands of part of a page
+					continue
+				}
+				var got bytes.Buffer
+				if err := ConvertBands(&got, src, 48, 32, band, opts); err != nil {
+					t.Fatalf("%s, %v, bands of %d: %v", opts.Method(), layout, band, err)
+				}
+				if !bytes.Equal(got.Bytes(), want) {
+					t.Errorf("%s, %v, bands of %d: expected the packed image of Convert\n% x\ngot\n% x", opts.Method(), layout, band, want, got.Bytes())
+				}
+			}
+		}
+	}
+}
+
+func TestConvertBandsErrors(t *testing.T) {
+	src := fade(16, 16)
+	for _, test := range []struct {
+		opts  Options
+		width int
+		band  int
+		want  string
+	}{
+		{Options{}, 16, 8, "can't convert in bands dithering with floyd-steinberg, which spreads the error"},
+		{Options{Dither: "atkinson"}, 16, 8, "dithering with atkinson"},
+		{Options{Threshold: ThresholdAuto}, 16, 8, "Otsu's method"},
+		{Options{Dither: "bayer"}, 16, 0, "bands of 0 rows have no pixels"},
+		{Options{Dither: "bayer", Layout: LayoutSSD1306}, 16, 12, "bands of 12 rows aren't made of whole pages of 8 rows"},
+		{Options{Dither: "bayer", Layout: LayoutRowMSB}, 12, 3, "bands of 3 rows of 12 pixels don't fill whole bytes"},
+	} {
+		err := ConvertBands(&bytes.Buffer{}, src, test.width, 16, test.band, test.opts)
+		if !errors.Is(err, ErrBands) || !bytes.Contains([]byte(err.Error()), []byte(test.want)) {
+			t.Errorf("%s, bands of %d: expected ErrBands and %q, got %v", test.opts.Method(), test.band, test.want, err)
+		}
+	}
+}
+
+// bandsAlloc returns how many bytes converting src to a 10000x128 banner
+// with opts allocates, in bands of 16 rows or whole
+func bandsAlloc(t testing.TB, src image.Image, opts Options, bands bool) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var err error
+	if bands {
+		err = ConvertBands(&bytes.Buffer{}, src, 10000, 128, 16, opts)
+	} else {
+		_, err = Convert(src, 10000, 128, opts)
+	}
+	runtime.ReadMemStats(&after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+// BenchmarkConvertBands converts a 10000x128 banner whole and in bands of 16
+// rows, dithered with bayer. The bands should take a fraction of the memory,
+// the 5 MB RGBA image of the whole banner never being made: that is checked
+// without dithering, as the dither package allocates a color for every pixel
+// it reads, which is garbage as soon as it is read, whether in bands or not.
+func BenchmarkConvertBands(b *testing.B) {
+	src := fade(2500, 32)
+	opts := Options{Dither: "bayer", Layout: LayoutRowMSB}
+	for _, bands := range []bool{false, true} {
+		name := "whole"
+		if bands {
+			name = "bands"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				bandsAlloc(b, src, opts, bands)
+			}
+		})
+	}
+	opts.Dither = "none"
+	if whole, bands := bandsAlloc(b, src, opts, false), bandsAlloc(b, src, opts, true); bands > whole/4 {
+		b.Errorf("expected the bands to allocate under a quarter of the %d bytes of the whole banner, they allocated %d", whole, bands)
+	} else {
+		b.Logf("the whole banner allocated %d bytes, the bands %d", whole, bands)
+	}
+}
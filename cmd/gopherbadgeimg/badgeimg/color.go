@@ -0,0 +1,173 @@
+package badgeimg
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrColor is matched by the errors of ParseColor
+var ErrColor = errors.New("invalid color")
+
+// namedColors are the color names ParseColor knows: the 16 basic colors of
+// CSS, their usual aliases, the grays and a few more
+var namedColors = map[string]color.NRGBA{
+	"black":          {0x00, 0x00, 0x00, 0xff},
+	"silver":         {0xc0, 0xc0, 0xc0, 0xff},
+	"gray":           {0x80, 0x80, 0x80, 0xff},
+	"grey":           {0x80, 0x80, 0x80, 0xff},
+	"white":          {0xff, 0xff, 0xff, 0xff},
+	"maroon":         {0x80, 0x00, 0x00, 0xff},
+	"red":            {0xff, 0x00, 0x00, 0xff},
+	"purple":         {0x80, 0x00, 0x80, 0xff},
+	"fuchsia":        {0xff, 0x00, 0xff, 0xff},
+	"magenta":        {0xff, 0x00, 0xff, 0xff},
+	"green":          {0x00, 0x80, 0x00, 0xff},
+	"lime":           {0x00, 0xff, 0x00, 0xff},
+	"olive":          {0x80, 0x80, 0x00, 0xff},
+	"yellow":         {0xff, 0xff, 0x00, 0xff},
+	"navy":           {0x00, 0x00, 0x80, 0xff},
+	"blue":           {0x00, 0x00, 0xff, 0xff},
+	"teal":           {0x00, 0x80, 0x80, 0xff},
+	"aqua":           {0x00, 0xff, 0xff, 0xff},
+	"cyan":           {0x00, 0xff, 0xff, 0xff},
+	"darkgray":       {0xa9, 0xa9, 0xa9, 0xff},
+	"darkgrey":       {0xa9, 0xa9, 0xa9, 0xff},
+	"dimgray":        {0x69, 0x69, 0x69, 0xff},
+	"dimgrey":        {0x69, 0x69, 0x69, 0xff},
+	"lightgray":      {0xd3, 0xd3, 0xd3, 0xff},
+	"lightgrey":      {0xd3, 0xd3, 0xd3, 0xff},
+	"gainsboro":      {0xdc, 0xdc, 0xdc, 0xff},
+	"whitesmoke":     {0xf5, 0xf5, 0xf5, 0xff},
+	"slategray":      {0x70, 0x80, 0x90, 0xff},
+	"slategrey":      {0x70, 0x80, 0x90, 0xff},
+	"lightslategray": {0x77, 0x88, 0x99, 0xff},
+	"lightslategrey": {0x77, 0x88, 0x99, 0xff},
+	"darkslategray":  {0x2f, 0x4f, 0x4f, 0xff},
+	"darkslategrey":  {0x2f, 0x4f, 0x4f, 0xff},
+	"orange":         {0xff, 0xa5, 0x00, 0xff},
+	"rebeccapurple":  {0x66, 0x33, 0x99, 0xff},
+	"transparent":    {0x00, 0x00, 0x00, 0x00},
+}
+
+// ParseColor parses a color the way CSS writes it: a name such as white or
+// rebeccapurple, in any case, #RGB, #RGBA, #RRGGBB or #RRGGBBAA, or
+// rgb(r, g, b) and rgba(r, g, b, a). The components of rgb() and rgba() are
+// from 0 to 255 or percentages, and the alpha of rgba() from 0 to 1 or a
+// percentage. The color is returned as a color.NRGBA; its errors match
+// ErrColor and name the component at fault.
+func ParseColor(s string) (color.Color, error) {
+	c, err := parseColor(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("%w `%s`: %v", ErrColor, s, err)
+	}
+	return c, nil
+}
+
+// ColorName returns the name ParseColor knows c by, the first one
+// alphabetically when it has several, such as aqua and cyan
+func ColorName(c color.Color) (string, bool) {
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	var found string
+	for name, named := range namedColors {
+		if named == nrgba && (found == "" || name < found) {
+			found = name
+		}
+	}
+	return found, found != ""
+}
+
+func parseColor(s string) (color.NRGBA, error) {
+	lower := strings.ToLower(s)
+	switch {
+	case s == "":
+		return color.NRGBA{}, errors.New("it is empty")
+	case strings.HasPrefix(s, "#"):
+		return parseHex(s[1:])
+	case strings.HasPrefix(lower, "rgba("):
+		return parseRGB(s[len("rgba("):], 4)
+	case strings.HasPrefix(lower, "rgb("):
+		return parseRGB(s[len("rgb("):], 3)
+	}
+	if c, ok := namedColors[lower]; ok {
+		return c, nil
+	}
+	return color.NRGBA{}, errors.New("unknown color name, use a CSS name such as white, #RRGGBB or rgb(r, g, b)")
+}
+
+// parseHex parses the hex digits of a #RGB, #RGBA, #RRGGBB or #RRGGBBAA
+// color
+func parseHex(hex string) (color.NRGBA, error) {
+	for i := range len(hex) {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", rune(hex[i])) {
+			return color.NRGBA{}, fmt.Errorf("`%c` isn't a hex digit", hex[i])
+		}
+	}
+	if len(hex) == 3 || len(hex) == 4 {
+		long := make([]byte, 0, 2*len(hex))
+		for i := range len(hex) {
+			long = append(long, hex[i], hex[i])
+		}
+		hex = string(long)
+	}
+	if len(hex) != 6 && len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("%d hex digits, expected #RGB, #RGBA, #RRGGBB or #RRGGBBAA", len(hex))
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	v, _ := strconv.ParseUint(hex, 16, 32)
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// rgbComponents name the components of rgb() and rgba()
+var rgbComponents = [4]string{"red", "green", "blue", "alpha"}
+
+// parseRGB parses the n components of rgb() or rgba(), and the closing
+// parenthesis
+func parseRGB(args string, n int) (color.NRGBA, error) {
+	function := "rgb()"
+	if n == 4 {
+		function = "rgba()"
+	}
+	args, ok := strings.CutSuffix(strings.TrimSpace(args), ")")
+	if !ok {
+		return color.NRGBA{}, fmt.Errorf("%s must end with its closing parenthesis", function)
+	}
+	fields := strings.Split(args, ",")
+	if len(fields) != n {
+		return color.NRGBA{}, fmt.Errorf("%s takes %d components separated by commas, got %d", function, n, len(fields))
+	}
+	var v [4]uint8
+	v[3] = 0xff
+	for i, field := range fields {
+		field = strings.TrimSpace(field)
+		name := rgbComponents[i]
+		number, percent := strings.CutSuffix(field, "%")
+		f, err := strconv.ParseFloat(number, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) || number == "" {
+			return color.NRGBA{}, fmt.Errorf("%s `%s` isn't a number", name, field)
+		}
+		switch {
+		case percent:
+			if f < 0 || f > 100 {
+				return color.NRGBA{}, fmt.Errorf("%s is %s, it must be from 0%% to 100%%", name, field)
+			}
+			f = f * 255 / 100
+		case i == 3:
+			if f < 0 || f > 1 {
+				return color.NRGBA{}, fmt.Errorf("%s is %s, it must be from 0 to 1", name, field)
+			}
+			f *= 255
+		default:
+			if f < 0 || f > 255 {
+				return color.NRGBA{}, fmt.Errorf("%s is %s, it must be from 0 to 255", name, field)
+			}
+		}
+		v[i] = uint8(math.Round(f))
+	}
+	return color.NRGBA{v[0], v[1], v[2], v[3]}, nil
+}
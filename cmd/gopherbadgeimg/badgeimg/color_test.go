@@ -0,0 +1,120 @@
+package badgeimg
+
+import (
+	"errors"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	for _, test := range []struct {
+		s    string
+		want color.NRGBA
+	}{
+		{"black", color.NRGBA{0, 0, 0, 0xff}},
+		{"White", color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{"  red ", color.NRGBA{0xff, 0, 0, 0xff}},
+		{"silver", color.NRGBA{0xc0, 0xc0, 0xc0, 0xff}},
+		{"gray", color.NRGBA{0x80, 0x80, 0x80, 0xff}},
+		{"grey", color.NRGBA{0x80, 0x80, 0x80, 0xff}},
+		{"maroon", color.NRGBA{0x80, 0, 0, 0xff}},
+		{"purple", color.NRGBA{0x80, 0, 0x80, 0xff}},
+		{"fuchsia", color.NRGBA{0xff, 0, 0xff, 0xff}},
+		{"green", color.NRGBA{0, 0x80, 0, 0xff}},
+		{"lime", color.NRGBA{0, 0xff, 0, 0xff}},
+		{"olive", color.NRGBA{0x80, 0x80, 0, 0xff}},
+		{"yellow", color.NRGBA{0xff, 0xff, 0, 0xff}},
+		{"navy", color.NRGBA{0, 0, 0x80, 0xff}},
+		{"blue", color.NRGBA{0, 0, 0xff, 0xff}},
+		{"teal", color.NRGBA{0, 0x80, 0x80, 0xff}},
+		{"AQUA", color.NRGBA{0, 0xff, 0xff, 0xff}},
+		{"darkgrey", color.NRGBA{0xa9, 0xa9, 0xa9, 0xff}},
+		{"lightgray", color.NRGBA{0xd3, 0xd3, 0xd3, 0xff}},
+		{"dimgray", color.NRGBA{0x69, 0x69, 0x69, 0xff}},
+		{"rebeccapurple", color.NRGBA{0x66, 0x33, 0x99, 0xff}},
+		{"transparent", color.NRGBA{}},
+		{"#fff", color.NRGBA{0xff, 0xff, 0xff, 0xff}},
+		{"#F0a", color.NRGBA{0xff, 0x00, 0xaa, 0xff}},
+		{"#f008", color.NRGBA{0xff, 0, 0, 0x88}},
+		{"#663399", color.NRGBA{0x66, 0x33, 0x99, 0xff}},
+		{"#66339980", color.NRGBA{0x66, 0x33, 0x99, 0x80}},
+		{"#00000000", color.NRGBA{}},
+		{"rgb(255, 128, 0)", color.NRGBA{0xff, 0x80, 0, 0xff}},
+		{"RGB(0,0,0)", color.NRGBA{0, 0, 0, 0xff}},
+		{"rgb( 10 , 20 , 30 )", color.NRGBA{10, 20, 30, 0xff}},
+		{"rgb(100%, 50%, 0%)", color.NRGBA{0xff, 0x80, 0, 0xff}},
+		{"rgb(127.6, 0, 0)", color.NRGBA{0x80, 0, 0, 0xff}},
+		{"rgba(255, 0, 0, 0.5)", color.NRGBA{0xff, 0, 0, 0x80}},
+		{"rgba(255, 0, 0, 50%)", color.NRGBA{0xff, 0, 0, 0x80}},
+		{"rgba(0, 0, 0, 0)", color.NRGBA{}},
+		{"rgba(0, 0, 0, 1)", color.NRGBA{0, 0, 0, 0xff}},
+	} {
+		c, err := ParseColor(test.s)
+		if err != nil {
+			t.Errorf("%q: %v", test.s, err)
+			continue
+		}
+		if c != test.want {
+			t.Errorf("%q: expected %v, got %v", test.s, test.want, c)
+		}
+	}
+
+	for _, test := range []struct {
+		s, want string
+	}{
+		{"", "invalid color ``: it is empty"},
+		{"   ", "it is empty"},
+		{"blurple", "invalid color `blurple`: unknown color name"},
+		{"#", "0 hex digits"},
+		{"#ff", "2 hex digits, expected #RGB, #RGBA, #RRGGBB or #RRGGBBAA"},
+		{"#fffff", "5 hex digits"},
+		{"#fffffff", "7 hex digits"},
+		{"#fffffffff", "9 hex digits"},
+		{"#ffg", "`g` isn't a hex digit"},
+		{"#12345z", "`z` isn't a hex digit"},
+		{"# fff", "` ` isn't a hex digit"},
+		{"rgb(1, 2, 3", "rgb() must end with its closing parenthesis"},
+		{"rgb(1, 2)", "rgb() takes 3 components separated by commas, got 2"},
+		{"rgb(1, 2, 3, 4)", "rgb() takes 3 components separated by commas, got 4"},
+		{"rgba(1, 2, 3)", "rgba() takes 4 components separated by commas, got 3"},
+		{"rgb(1 2 3)", "rgb() takes 3 components separated by commas, got 1"},
+		{"rgb(256, 0, 0)", "red is 256, it must be from 0 to 255"},
+		{"rgb(0, -1, 0)", "green is -1, it must be from 0 to 255"},
+		{"rgb(0, 0, 101%)", "blue is 101%, it must be from 0% to 100%"},
+		{"rgb(0, x, 0)", "green `x` isn't a number"},
+		{"rgb(0, 0, )", "blue `` isn't a number"},
+		{"rgb(0, 0, %)", "blue `%` isn't a number"},
+		{"rgb(NaN, 0, 0)", "red `NaN` isn't a number"},
+		{"rgb(Inf, 0, 0)", "red `Inf` isn't a number"},
+		{"rgba(0, 0, 0, 2)", "alpha is 2, it must be from 0 to 1"},
+		{"rgba(0, 0, 0, 255)", "alpha is 255, it must be from 0 to 1"},
+		{"rgba(0, 0, 0, -10%)", "alpha is -10%, it must be from 0% to 100%"},
+	} {
+		_, err := ParseColor(test.s)
+		if !errors.Is(err, ErrColor) || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%q: expected ErrColor and %q, got %v", test.s, test.want, err)
+		}
+	}
+}
+
+func TestColorName(t *testing.T) {
+	for _, test := range []struct {
+		c    color.Color
+		want string
+	}{
+		{color.Black, "black"},
+		{color.RGBA{0xff, 0, 0, 0xff}, "red"},
+		// aliases give the first name alphabetically
+		{color.NRGBA{0, 0xff, 0xff, 0xff}, "aqua"},
+		{color.Gray{Y: 0x80}, "gray"},
+		{color.NRGBA{}, "transparent"},
+	} {
+		if name, ok := ColorName(test.c); !ok || name != test.want {
+			t.Errorf("%v: expected %q, got %q", test.c, test.want, name)
+		}
+	}
+	if name, ok := ColorName(color.RGBA{0x12, 0x34, 0x56, 0xff}); ok {
+		t.Errorf("expected #123456 to have no name, got %q", name)
+	}
+}
@@ -0,0 +1,223 @@
+package badgeimg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"time"
+
+	"github.com/makeworld-the-better-one/dither"
+	"golang.org/x/image/draw"
+)
+
+// Options are the settings of Convert. The zero value converts images the
+// way gopherbadgeimg does by default.
+type Options struct {
+	// Dither is one of DitherAlgorithms, "" for the default, or none to
+	// leave the colors alone so that only black pixels are set
+	Dither string
+	// Matrix, if set, dithers with this error diffusion matrix instead of
+	// Dither, such as one of those of the dither package
+	Matrix dither.ErrorDiffusionMatrix
+	// Threshold, from 1 to 255, converts without dithering instead: pixels
+	// darker than it become black and the others white. ThresholdAuto picks
+	// it for every image, and 0 leaves it off.
+	Threshold int
+	// Invert inverts the colors of the image before it is dithered
+	Invert bool
+	// Linear thresholds, inverts and applies Gamma to images in linear light
+	// rather than to their gamma-encoded sRGB values (see linear.go)
+	Linear bool
+	// Gamma, from 0.1 to 5, applies a power curve to the scaled image before
+	// it is dithered, a gamma above 1 lightening the midtones (see Gamma).
+	// 0 and 1 leave it alone.
+	Gamma float64
+	// Background is the color transparent pixels are composited onto, nil
+	// for black
+	Background color.Color
+	// Layout is how the pixels are packed, the zero Layout being
+	// LayoutBadger
+	Layout Layout
+	// Width and Height are the size ConvertReader converts images to, and
+	// Encoding how it writes them; Convert is given the size instead
+	Width, Height int
+	Encoding      Encoding
+	// Logger, if set, is told the details of each conversion and the time
+	// its stages take, at LevelDebug and LevelTrace
+	Logger *Logger
+}
+
+// ErrSize is returned for images that can't be packed at the size asked for
+var ErrSize = errors.New("invalid image size")
+
+// ErrBadRatio is matched by the errors of sizes, such as 128x64, that can't
+// be parsed
+var ErrBadRatio = errors.New("invalid ratio")
+
+// Convert scales src to width by height and packs it with the Layout of opts,
+// for the badge's display by default, dithering it to black and white as opts
+// say. It is what gopherbadgeimg does with raster images, without any file
+// I/O.
+func Convert(src image.Image, width, height int, opts Options) ([]byte, error) {
+	if err := opts.Layout.Validate(width, height); err != nil {
+		return nil, err
+	}
+	size := src.Bounds().Size()
+	opts.Logger.Debugf("converting a %dx%d image to %dx%d, %s", size.X, size.Y, width, height, opts.Method())
+	start := time.Now()
+	dst := Scale(src, width, height, opts.Background)
+	if opts.Invert {
+		opts.invert(dst)
+	}
+	opts.gamma(dst)
+	opts.Logger.Timef(start, "scaled")
+	start = time.Now()
+	dst, err := Monochrome(dst, opts)
+	if err != nil {
+		return nil, err
+	}
+	opts.Logger.Timef(start, "dithered")
+	start = time.Now()
+	packed := Pack(width, height, dst, opts.Layout)
+	opts.Logger.Timef(start, "packed")
+	return packed, nil
+}
+
+// Method describes how Monochrome reduces images to black and white with
+// opts, such as "dithering with atkinson"
+func (opts Options) Method() string {
+	switch {
+	case opts.Threshold == ThresholdAuto && opts.Linear:
+		return "with a threshold picked by Otsu's method in linear light"
+	case opts.Threshold == ThresholdAuto:
+		return "with a threshold picked by Otsu's method"
+	case opts.Threshold > 0 && opts.Linear:
+		return fmt.Sprintf("with a threshold of %d in linear light", opts.Threshold)
+	case opts.Threshold > 0:
+		return fmt.Sprintf("with a threshold of %d", opts.Threshold)
+	case opts.Dither == "none":
+		return "without dithering"
+	case opts.Matrix != nil:
+		return "dithering with a custom matrix"
+	case opts.Dither == "":
+		return "dithering with " + DitherAlgorithms[0]
+	}
+	return "dithering with " + opts.Dither
+}
+
+// Scale returns src scaled to width by height with nearest neighbor
+// sampling, composited onto background, or onto black when it's nil
+func Scale(src image.Image, width, height int, background color.Color) *image.RGBA {
+	// create a new, rectangular image that's the size we want
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	// transparent pixels end up as whatever is below them; without a
+	// background that's the all-zero (black) pixels of the new image
+	if background != nil {
+		draw.Draw(dst, dst.Rect, image.NewUniform(background), image.Point{}, draw.Src)
+	}
+	// use NearestNeighbor algo to fit our original image into the smaller (or bigger!?) image
+	draw.NearestNeighbor.Scale(dst, dst.Rect, src, src.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// Invert turns img into its negative, in place
+func Invert(img *image.RGBA) {
+	// pixels are alpha-premultiplied
+	for p := 0; p < len(img.Pix); p += 4 {
+		a := img.Pix[p+3]
+		img.Pix[p], img.Pix[p+1], img.Pix[p+2] = a-img.Pix[p], a-img.Pix[p+1], a-img.Pix[p+2]
+	}
+}
+
+// invert inverts img in place, in linear light if opts say so
+func (opts Options) invert(img *image.RGBA) {
+	if opts.Linear {
+		InvertLinear(img)
+		return
+	}
+	Invert(img)
+}
+
+// gamma applies the Gamma of opts to img in place, in linear light if opts
+// say so
+func (opts Options) gamma(img *image.RGBA) {
+	if opts.Linear {
+		GammaLinear(img, opts.Gamma)
+		return
+	}
+	Gamma(img, opts.Gamma)
+}
+
+// Threshold turns the pixels of img darker than threshold black and the
+// others white, by their luminance, in place
+func Threshold(img *image.RGBA, threshold int) {
+	for p := 0; p < len(img.Pix); p += 4 {
+		c := color.RGBA{img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3]}
+		v := uint8(0)
+		if int(color.GrayModel.Convert(c).(color.Gray).Y) >= threshold {
+			v = 0xff
+		}
+		img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = v, v, v, 0xff
+	}
+}
+
+// autoThreshold returns the threshold of img by Otsu's method, or
+// FallbackThreshold for images of a single shade
+func (opts Options) autoThreshold(img *image.RGBA) int {
+	threshold, ok := Otsu(Histogram(img, opts.Linear))
+	if !ok {
+		opts.Logger.Warnf("the image is a single shade, which Otsu's method can't split: using a threshold of %d", threshold)
+		return threshold
+	}
+	opts.Logger.Debugf("Otsu's method picked a threshold of %d", threshold)
+	return threshold
+}
+
+// Monochrome reduces img to the black and white of the badge's display with
+// the Threshold or Dither of opts, and returns the result, which may be img
+// itself
+func Monochrome(img *image.RGBA, opts Options) (*image.RGBA, error) {
+	switch {
+	case opts.Threshold > 0 || opts.Threshold == ThresholdAuto:
+		// a hard cut instead of dithering, for line art and text
+		threshold := opts.Threshold
+		if threshold == ThresholdAuto {
+			threshold = opts.autoThreshold(img)
+		}
+		if opts.Linear {
+			ThresholdLinear(img, threshold)
+		} else {
+			Threshold(img, threshold)
+		}
+		return img, nil
+	case opts.Dither == "none":
+		// useful for some images which are already black and white
+		return img, nil
+	}
+	// Our e-ink display uses one bit for each pixel, on or off,
+	// so white or black are our only color options
+	palette := []color.Color{
+		color.Black,
+		color.White,
+	}
+	// using our palette, create a dithering struct
+	// and dither our image to get some false shading.
+	// read more here: https://en.wikipedia.org/wiki/Floyd%E2%80%93Steinberg_dithering
+	d, err := opts.Ditherer(palette)
+	if err != nil {
+		return nil, err
+	}
+	dithered := d.Dither(img)
+	// this nil check is necessary since the library will often write
+	// the dithered image to img, but not always. Read their docs for more info
+	if dithered == nil {
+		return img, nil
+	}
+	// docs claim image is guaranteed to be of this type when not nil, but it's good to check anyway
+	rgba, ok := dithered.(*image.RGBA)
+	if !ok {
+		return nil, fmt.Errorf("typeof dithered should have been `*image.RGBA` but was `%T`", dithered)
+	}
+	return rgba, nil
+}
@@ -0,0 +1,64 @@
+package badgeimg
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+// uniform returns an x by y image of a single color
+func uniform(x, y int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, x, y))
+	draw.Draw(img, img.Rect, image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+func TestConvert(t *testing.T) {
+	black, white := bytes.Repeat([]byte{0xff}, 8), make([]byte, 8)
+	gray := color.Gray{Y: 0x80}
+	tests := []struct {
+		name string
+		src  image.Image
+		opts Options
+		want []byte
+	}{
+		{"black", uniform(4, 4, color.Black), Options{}, black},
+		{"white", uniform(4, 4, color.White), Options{}, white},
+		{"inverted", uniform(4, 4, color.White), Options{Invert: true}, black},
+		{"transparent", uniform(4, 4, color.Transparent), Options{Dither: "none"}, black},
+		{"background", uniform(4, 4, color.Transparent), Options{Background: color.White}, white},
+		{"darker than the threshold", uniform(4, 4, gray), Options{Threshold: 0x81}, black},
+		{"lighter than the threshold", uniform(4, 4, gray), Options{Threshold: 0x80}, white},
+	}
+	for _, test := range tests {
+		got, err := Convert(test.src, 8, 8, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, test.want) {
+			t.Errorf("%s: expected % x, got % x", test.name, test.want, got)
+		}
+	}
+
+	// dithering turns a gray into a mix of black and white pixels
+	got, err := Convert(uniform(16, 16, gray), 16, 16, Options{Dither: "bayer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(got, make([]byte, 32)) || bytes.Equal(got, bytes.Repeat([]byte{0xff}, 32)) {
+		t.Errorf("expected a mix of black and white pixels, got % x", got)
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	src := uniform(4, 4, color.White)
+	if _, err := Convert(src, 3, 3, Options{}); !errors.Is(err, ErrSize) {
+		t.Errorf("expected ErrSize, got %v", err)
+	}
+	if _, err := Convert(src, 8, 8, Options{Dither: "wobbly"}); !errors.Is(err, ErrUnknownDither) {
+		t.Errorf("expected ErrUnknownDither, got %v", err)
+	}
+}
@@ -0,0 +1,75 @@
+package badgeimg
+
+import (
+	"bufio"
+	"image"
+	"io"
+	"sync"
+)
+
+// decoder is a format registered with RegisterDecoder
+type decoder struct {
+	name   string
+	magic  []byte
+	decode func(io.Reader) (image.Image, error)
+}
+
+var (
+	decodersMu sync.RWMutex
+	decoders   []decoder
+)
+
+// RegisterDecoder registers the decoder of an image format the standard
+// library has none for, such as HEIC or AVIF, for Decode, ConvertReader and
+// gopherbadgeimg to use. Data starting with magic is decoded with decode;
+// like the magic of image.RegisterFormat, a '?' in it matches any byte.
+// Registered decoders are tried in the order they were registered, before
+// the formats of image.RegisterFormat, so that one can take over a format
+// the tool recognizes but can't convert. It is meant to be called from an
+// init function, but is safe to call at any time.
+func RegisterDecoder(name string, magic []byte, decode func(io.Reader) (image.Image, error)) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+	decoders = append(decoders, decoder{name: name, magic: magic, decode: decode})
+}
+
+// Decoders returns the names of the decoders registered with
+// RegisterDecoder, in the order they were registered
+func Decoders() []string {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	names := make([]string, len(decoders))
+	for i, d := range decoders {
+		names[i] = d.name
+	}
+	return names
+}
+
+// Decode decodes an image from r with the first registered decoder whose
+// magic it starts with, or else as image.Decode does. It returns the name of
+// the format along with the image.
+func Decode(r io.Reader) (image.Image, string, error) {
+	br := bufio.NewReader(r)
+	decodersMu.RLock()
+	registered := decoders
+	decodersMu.RUnlock()
+	for _, d := range registered {
+		head, err := br.Peek(len(d.magic))
+		if err != nil || !matchMagic(d.magic, head) {
+			continue
+		}
+		img, err := d.decode(br)
+		return img, d.name, err
+	}
+	return image.Decode(br)
+}
+
+// matchMagic reports whether head matches magic, '?' matching any byte
+func matchMagic(magic, head []byte) bool {
+	for i, b := range magic {
+		if b != '?' && b != head[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package badgeimg
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	var decoded []string
+	RegisterDecoder("fake", []byte("FA?E"), func(r io.Reader) (image.Image, error) {
+		data, err := io.ReadAll(r)
+		decoded = append(decoded, string(data))
+		return image.NewGray(image.Rect(0, 0, 8, 8)), err
+	})
+	if names := Decoders(); len(names) == 0 || names[len(names)-1] != "fake" {
+		t.Errorf("expected the fake decoder to be listed, got %v", names)
+	}
+	for _, magic := range []string{"FAKE", "FA_E"} {
+		img, format, err := Decode(bytes.NewReader([]byte(magic + " image")))
+		if err != nil || format != "fake" || img.Bounds().Dx() != 8 {
+			t.Errorf("%s: expected the fake decoder to decode it, got %q and %v", magic, format, err)
+		}
+	}
+	if len(decoded) != 2 || decoded[0] != "FAKE image" {
+		t.Errorf("expected the decoder to read the whole data, got %q", decoded)
+	}
+
+	// other formats are decoded as image.Decode does
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	if _, format, err := Decode(&buf); err != nil || format != "png" {
+		t.Errorf("expected a PNG, got %q and %v", format, err)
+	}
+	if _, _, err := Decode(bytes.NewReader([]byte("FAK"))); err != image.ErrFormat {
+		t.Errorf("expected data shorter than the magic to be unknown, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package badgeimg
+
+import (
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+
+	"github.com/makeworld-the-better-one/dither"
+)
+
+// DitherAlgorithms are the names of the supported dithering algorithms, in
+// the order gopherbadgeimg -compare lays them out. The first one is the
+// default.
+var DitherAlgorithms = []string{"floyd-steinberg", "atkinson", "bayer"}
+
+// ditherConfigs set each of DitherAlgorithms up on a Ditherer
+var ditherConfigs = map[string]func(d *dither.Ditherer){
+	"floyd-steinberg": func(d *dither.Ditherer) { d.Matrix = dither.FloydSteinberg },
+	// Atkinson only spreads 3/4 of the error, which keeps highlights and
+	// shadows clean at the cost of some detail
+	"atkinson": func(d *dither.Ditherer) { d.Matrix = dither.Atkinson },
+	// an ordered dither, whose regular pattern doesn't crawl between frames
+	"bayer": func(d *dither.Ditherer) { d.Mapper = dither.Bayer(4, 4, 1.0) },
+}
+
+// ErrUnknownDither is returned for a dithering algorithm that isn't one of
+// DitherAlgorithms
+var ErrUnknownDither = errors.New("unknown dithering algorithm")
+
+// CheckDither returns ErrUnknownDither when name isn't one of
+// DitherAlgorithms, or empty for the default one
+func CheckDither(name string) error {
+	if _, ok := ditherConfigs[name]; !ok && name != "" {
+		return fmt.Errorf("%w `%s`, use one of: %s", ErrUnknownDither, name, strings.Join(DitherAlgorithms, ", "))
+	}
+	return nil
+}
+
+// NewDitherer returns a Ditherer for colors using the algorithm called name,
+// or the default one when name is empty
+func NewDitherer(name string, colors []color.Color) (*dither.Ditherer, error) {
+	if err := CheckDither(name); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = DitherAlgorithms[0]
+	}
+	d := dither.NewDitherer(colors)
+	ditherConfigs[name](d)
+	return d, nil
+}
+
+// Ditherer returns a Ditherer for colors diffusing the error with the Matrix
+// of opts, or else using its Dither algorithm
+func (opts Options) Ditherer(colors []color.Color) (*dither.Ditherer, error) {
+	if opts.Matrix == nil {
+		return NewDitherer(opts.Dither, colors)
+	}
+	d := dither.NewDitherer(colors)
+	d.Matrix = opts.Matrix
+	return d, nil
+}
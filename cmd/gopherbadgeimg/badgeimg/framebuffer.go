@@ -0,0 +1,150 @@
+package badgeimg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+// BlackWhite is the color model of a Framebuffer: colors darker than mid
+// gray, by their luminance, become black and the others white, as a Threshold
+// of 128 has them. Like color.GrayModel it ignores alpha.
+var BlackWhite color.Model = color.ModelFunc(blackWhite)
+
+var (
+	black = color.Gray{Y: 0}
+	white = color.Gray{Y: 0xff}
+)
+
+func blackWhite(c color.Color) color.Color {
+	if color.GrayModel.Convert(c).(color.Gray).Y < 0x80 {
+		return black
+	}
+	return white
+}
+
+// Framebuffer is a black and white image drawn straight into packed memory,
+// such as the buffer a display driver sends: it implements draw.Image, so
+// the draw packages and font rendering can draw onto it, a set bit being
+// black as everywhere else. Only the first plane of layouts with several is
+// drawn on.
+type Framebuffer struct {
+	// Bits is the packed image
+	Bits []byte
+	// Width and Height are its size, which Layout validates
+	Width, Height int
+	Layout        Layout
+}
+
+// NewFramebuffer returns a white w by h Framebuffer packed with layout
+func NewFramebuffer(w, h int, layout Layout) (*Framebuffer, error) {
+	if err := layout.Validate(w, h); err != nil {
+		return nil, err
+	}
+	return &Framebuffer{Bits: make([]byte, layout.BufferLen(w, h)), Width: w, Height: h, Layout: layout}, nil
+}
+
+// WrapFramebuffer returns a Framebuffer drawing on bits, a w by h image
+// packed with layout, in place
+func WrapFramebuffer(bits []byte, w, h int, layout Layout) (*Framebuffer, error) {
+	if err := layout.Validate(w, h); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBufferSize, err)
+	}
+	if n := layout.BufferLen(w, h); len(bits) != n {
+		return nil, fmt.Errorf("%w: a %dx%d image is %d bytes, got %d", ErrBufferSize, w, h, n, len(bits))
+	}
+	return &Framebuffer{Bits: bits, Width: w, Height: h, Layout: layout}, nil
+}
+
+// ColorModel returns BlackWhite
+func (fb *Framebuffer) ColorModel() color.Model {
+	return BlackWhite
+}
+
+// Bounds returns the rectangle of the image, starting at (0, 0)
+func (fb *Framebuffer) Bounds() image.Rectangle {
+	return image.Rect(0, 0, fb.Width, fb.Height)
+}
+
+// At returns the color of the pixel at (x, y), black or white, and white
+// outside of the image as the blank display is
+func (fb *Framebuffer) At(x, y int) color.Color {
+	if fb.Black(x, y) {
+		return black
+	}
+	return white
+}
+
+// Black reports whether the pixel at (x, y) is black, its bit set
+func (fb *Framebuffer) Black(x, y int) bool {
+	if !(image.Point{x, y}.In(fb.Bounds())) {
+		return false
+	}
+	return fb.Layout.PixelAt(fb.Bits, fb.Width, fb.Height, x, y)
+}
+
+// Set sets the pixel at (x, y) to c, converted by BlackWhite. It does nothing
+// outside of the image.
+func (fb *Framebuffer) Set(x, y int, c color.Color) {
+	fb.SetBlack(x, y, blackWhite(c) == black)
+}
+
+// SetBlack sets the bit of the pixel at (x, y), black, or clears it. It does
+// nothing outside of the image.
+func (fb *Framebuffer) SetBlack(x, y int, on bool) {
+	if !(image.Point{x, y}.In(fb.Bounds())) {
+		return
+	}
+	n, mask := fb.Layout.bit(fb.Width, fb.Height, x, y)
+	if on {
+		fb.Bits[n] |= mask
+	} else {
+		fb.Bits[n] &^= mask
+	}
+}
+
+// Clear turns the whole image white
+func (fb *Framebuffer) Clear() {
+	clear(fb.Bits[:fb.Layout.planeLen(fb.Width, fb.Height)])
+}
+
+// Invert turns the image into its negative, black pixels becoming white and
+// white ones black. The padding of the lines stays clear.
+func (fb *Framebuffer) Invert() {
+	if n := fb.Layout.planeLen(fb.Width, fb.Height); n*8 == fb.Width*fb.Height {
+		// every bit is a pixel
+		for i := range fb.Bits[:n] {
+			fb.Bits[i] = ^fb.Bits[i]
+		}
+		return
+	}
+	for i := 0; i < fb.Width; i++ {
+		for j := 0; j < fb.Height; j++ {
+			n, mask := fb.Layout.bit(fb.Width, fb.Height, i, j)
+			fb.Bits[n] ^= mask
+		}
+	}
+}
+
+// CopyRegion copies the pixels of r in src to fb, r.Min going to dp, as
+// draw.Draw with draw.Src does: what falls outside of either image is left
+// out. src may be fb itself, and the regions may overlap.
+func (fb *Framebuffer) CopyRegion(dp image.Point, src *Framebuffer, r image.Rectangle) {
+	// the offset from a source pixel to where it goes stays the same as the
+	// regions are clipped
+	d := dp.Sub(r.Min)
+	dr := r.Intersect(src.Bounds()).Add(d).Intersect(fb.Bounds())
+	if dr.Empty() {
+		return
+	}
+	sp := dr.Min.Sub(d)
+	if src == fb {
+		// read the pixels before they are overwritten
+		src = &Framebuffer{Bits: append([]byte(nil), fb.Bits...), Width: fb.Width, Height: fb.Height, Layout: fb.Layout}
+	}
+	for j := 0; j < dr.Dy(); j++ {
+		for i := 0; i < dr.Dx(); i++ {
+			fb.SetBlack(dr.Min.X+i, dr.Min.Y+j, src.Black(sp.X+i, sp.Y+j))
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package badgeimg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// grayNoise returns an x by y image of random shades of gray
+func grayNoise(rng *rand.Rand, x, y int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, x, y))
+	rng.Read(img.Pix)
+	return img
+}
+
+func TestFramebufferDraw(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	for _, layout := range layouts {
+		for _, size := range sizes {
+			x, y := size[0], size[1]
+			if layout.Validate(x, y) != nil {
+				continue
+			}
+			t.Run(fmt.Sprintf("%v/%dx%d", layout, x, y), func(t *testing.T) {
+				fb, err := NewFramebuffer(x, y, layout)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gray := image.NewGray(image.Rect(0, 0, x, y))
+				// the same drawing on both: noise, then a black square
+				// and a white one hanging off the bottom right corner
+				src := grayNoise(rng, x, y)
+				for _, dst := range []draw.Image{fb, gray} {
+					draw.Draw(dst, dst.Bounds(), src, image.Point{}, draw.Src)
+					draw.Draw(dst, image.Rect(x/4, y/4, x/2+1, y/2+1), image.Black, image.Point{}, draw.Src)
+					draw.Draw(dst, image.Rect(x/2, y/2, x+5, y+5), image.White, image.Point{}, draw.Over)
+				}
+				want, err := Convert(gray, x, y, Options{Threshold: 0x80, Layout: layout})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(fb.Bits, want) {
+					t.Errorf("expected the image.Gray drawn alike, converted\n% x\ngot\n% x", want, fb.Bits)
+				}
+			})
+		}
+	}
+}
+
+func TestFramebufferText(t *testing.T) {
+	fb, err := NewFramebuffer(64, 16, LayoutSSD1306)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := image.NewGray(image.Rect(0, 0, 64, 16))
+	draw.Draw(gray, gray.Rect, image.White, image.Point{}, draw.Src)
+	for _, dst := range []draw.Image{fb, gray} {
+		d := font.Drawer{Dst: dst, Src: image.Black, Face: basicfont.Face7x13, Dot: fixed.P(2, 12)}
+		d.DrawString("Gopher")
+	}
+	if want := Pack(64, 16, gray, LayoutSSD1306); !bytes.Equal(fb.Bits, want) {
+		t.Errorf("expected the text drawn on an image.Gray, packed\n% x\ngot\n% x", want, fb.Bits)
+	}
+}
+
+func TestFramebufferSet(t *testing.T) {
+	fb, err := NewFramebuffer(3, 8, LayoutBadgerOS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []image.Point{{-1, 0}, {0, -1}, {3, 0}, {0, 8}, {100, 100}} {
+		fb.Set(p.X, p.Y, color.Black)
+		if !bytes.Equal(fb.Bits, make([]byte, 8)) {
+			t.Fatalf("expected setting %v to do nothing, got % x", p, fb.Bits)
+		}
+		if fb.At(p.X, p.Y) != white {
+			t.Errorf("expected %v to be white", p)
+		}
+	}
+	fb.Set(1, 2, color.RGBA{0x40, 0x40, 0x40, 0xff})
+	if fb.At(1, 2) != black || fb.Bits[2] != 0x40 {
+		t.Errorf("expected a dark gray to set pixel (1, 2), got % x", fb.Bits)
+	}
+	fb.Set(1, 2, color.Gray{Y: 0x80})
+	if fb.At(1, 2) != white || fb.Bits[2] != 0 {
+		t.Errorf("expected mid gray to clear pixel (1, 2), got % x", fb.Bits)
+	}
+}
+
+func TestFramebufferClearInvert(t *testing.T) {
+	rng := rand.New(rand.NewSource(6))
+	for _, layout := range layouts {
+		for _, size := range sizes {
+			x, y := size[0], size[1]
+			if layout.Validate(x, y) != nil {
+				continue
+			}
+			src := randomGray(rng, x, y)
+			fb, err := WrapFramebuffer(Pack(x, y, src, layout), x, y, layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fb.Invert()
+			for i := range src.Pix {
+				src.Pix[i] = ^src.Pix[i]
+			}
+			if want := Pack(x, y, src, layout); !bytes.Equal(fb.Bits, want) {
+				t.Errorf("%v %dx%d: expected the negative, padding clear\n% x\ngot\n% x", layout, x, y, want, fb.Bits)
+			}
+			fb.Clear()
+			if !bytes.Equal(fb.Bits, make([]byte, layout.BufferLen(x, y))) {
+				t.Errorf("%v %dx%d: expected a cleared buffer, got % x", layout, x, y, fb.Bits)
+			}
+		}
+	}
+}
+
+func TestFramebufferCopyRegion(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	regions := []struct {
+		dp image.Point
+		r  image.Rectangle
+	}{
+		{image.Pt(0, 0), image.Rect(0, 0, 16, 16)},
+		{image.Pt(3, 5), image.Rect(1, 2, 9, 7)},
+		// overlapping the source when copying within one buffer
+		{image.Pt(2, 1), image.Rect(0, 0, 12, 12)},
+		{image.Pt(0, 0), image.Rect(2, 1, 14, 13)},
+		// clipped by either image
+		{image.Pt(10, 12), image.Rect(-4, -4, 8, 8)},
+		{image.Pt(-3, -2), image.Rect(4, 4, 30, 30)},
+		{image.Pt(20, 0), image.Rect(0, 0, 4, 4)},
+	}
+	for _, layout := range layouts {
+		if layout.Validate(16, 16) != nil {
+			continue
+		}
+		for _, region := range regions {
+			for _, within := range []bool{false, true} {
+				src, err := WrapFramebuffer(Pack(16, 16, randomGray(rng, 16, 16), layout), 16, 16, layout)
+				if err != nil {
+					t.Fatal(err)
+				}
+				dst := src
+				if !within {
+					dst, _ = WrapFramebuffer(Pack(16, 16, randomGray(rng, 16, 16), layout), 16, 16, layout)
+				}
+				// draw.Draw reads the pixels through At and Set, which
+				// handle overlaps and clipping their own way
+				want := &Framebuffer{Bits: bytes.Clone(dst.Bits), Width: 16, Height: 16, Layout: layout}
+				wantSrc := src
+				if within {
+					wantSrc = want
+				}
+				dr := image.Rectangle{region.dp, region.dp.Add(region.r.Size())}
+				draw.Draw(want, dr, wantSrc, region.r.Min, draw.Src)
+				dst.CopyRegion(region.dp, src, region.r)
+				if !bytes.Equal(dst.Bits, want.Bits) {
+					t.Errorf("%v, %v to %v within=%v: expected\n% x\ngot\n% x", layout, region.r, region.dp, within, want.Bits, dst.Bits)
+				}
+			}
+		}
+	}
+}
+
+func TestWrapFramebuffer(t *testing.T) {
+	if _, err := WrapFramebuffer(make([]byte, 8), 8, 8, LayoutBadger); err != nil {
+		t.Error(err)
+	}
+	if _, err := WrapFramebuffer(make([]byte, 7), 8, 8, LayoutBadger); !errors.Is(err, ErrBufferSize) {
+		t.Errorf("expected ErrBufferSize for a short buffer, got %v", err)
+	}
+	if _, err := WrapFramebuffer(make([]byte, 12), 8, 12, LayoutSSD1306); !errors.Is(err, ErrBufferSize) || !errors.Is(err, ErrSize) {
+		t.Errorf("expected ErrBufferSize and ErrSize for rows that aren't whole pages, got %v", err)
+	}
+	if _, err := NewFramebuffer(8, 12, LayoutSSD1306); !errors.Is(err, ErrSize) {
+		t.Errorf("expected ErrSize for rows that aren't whole pages, got %v", err)
+	}
+}
@@ -0,0 +1,52 @@
+package badgeimg
+
+import (
+	"image"
+	"math"
+)
+
+// Gamma applies a power curve to every channel of img, in place: each value
+// v, from 0 to 1, becomes v^(1/gamma), so that a gamma above 1 lightens the
+// midtones and one below 1 darkens them while black and white stay as they
+// are. A gamma of 1, or 0, leaves img untouched.
+func Gamma(img *image.RGBA, gamma float64) {
+	if gamma == 0 || gamma == 1 {
+		return
+	}
+	var table [256]uint8
+	for v := range table {
+		table[v] = uint8(math.Round(math.Pow(float64(v)/0xff, 1/gamma) * 0xff))
+	}
+	applyTable(img, &table)
+}
+
+// GammaLinear is Gamma in linear light: the curve applies to the light each
+// channel gives off, by the sRGB transfer function, rather than to its
+// gamma-encoded value
+func GammaLinear(img *image.RGBA, gamma float64) {
+	if gamma == 0 || gamma == 1 {
+		return
+	}
+	var table [256]uint8
+	for v := range table {
+		table[v] = encode(math.Pow(linear[v], 1/gamma))
+	}
+	applyTable(img, &table)
+}
+
+// applyTable maps every color channel of img through table, in place
+func applyTable(img *image.RGBA, table *[256]uint8) {
+	// pixels are alpha-premultiplied, the table maps straight values
+	for p := 0; p < len(img.Pix); p += 4 {
+		switch a := img.Pix[p+3]; a {
+		case 0:
+		case 0xff:
+			img.Pix[p], img.Pix[p+1], img.Pix[p+2] = table[img.Pix[p]], table[img.Pix[p+1]], table[img.Pix[p+2]]
+		default:
+			for c := p; c < p+3; c++ {
+				v := uint8(min(int(img.Pix[c])*0xff/int(a), 0xff))
+				img.Pix[c] = uint8(int(table[v]) * int(a) / 0xff)
+			}
+		}
+	}
+}
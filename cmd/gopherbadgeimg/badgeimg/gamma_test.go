@@ -0,0 +1,109 @@
+package badgeimg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// gradient returns a 256x1 image going from black to white, with pixel v of
+// value v
+func gradient() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 1))
+	for v := range 256 {
+		img.SetRGBA(v, 0, color.RGBA{uint8(v), uint8(v), uint8(v), 0xff})
+	}
+	return img
+}
+
+func TestGammaOne(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	rng.Read(img.Pix)
+	for _, apply := range []func(*image.RGBA, float64){Gamma, GammaLinear} {
+		got := image.NewRGBA(img.Rect)
+		copy(got.Pix, img.Pix)
+		apply(got, 1)
+		if !bytes.Equal(got.Pix, img.Pix) {
+			t.Error("expected a gamma of 1 to leave the pixels alone")
+		}
+	}
+	for _, opts := range []Options{{}, {Linear: true}, {Threshold: 0x80}} {
+		want, err := Convert(img, 32, 32, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		opts.Gamma = 1
+		if got, err := Convert(img, 32, 32, opts); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%+v: expected the same conversion as without a gamma, got %v", opts, err)
+		}
+	}
+}
+
+func TestGammaGradient(t *testing.T) {
+	tests := []struct {
+		name  string
+		apply func(*image.RGBA, float64)
+		gamma float64
+		want  func(v float64) float64
+	}{
+		{"lighter", Gamma, 2, math.Sqrt},
+		{"darker", Gamma, 0.5, func(v float64) float64 { return v * v }},
+		// the curve applies to the light, which is then encoded back
+		{"lighter in linear light", GammaLinear, 2, func(v float64) float64 { return LinearToSRGB(math.Sqrt(SRGBToLinear(v))) }},
+		{"darker in linear light", GammaLinear, 0.5, func(v float64) float64 { return LinearToSRGB(math.Pow(SRGBToLinear(v), 2)) }},
+	}
+	for _, test := range tests {
+		img := gradient()
+		test.apply(img, test.gamma)
+		for v := range 256 {
+			want := uint8(math.Round(test.want(float64(v)/0xff) * 0xff))
+			if got := img.Pix[4*v]; got != want || img.Pix[4*v+1] != got || img.Pix[4*v+2] != got {
+				t.Errorf("%s: expected %d to become %d, got % x", test.name, v, want, img.Pix[4*v:4*v+4])
+				break
+			}
+		}
+		// black and white stay, and the midtones move the same way
+		if img.Pix[0] != 0 || img.Pix[4*0xff] != 0xff {
+			t.Errorf("%s: expected black and white to stay, got %d and %d", test.name, img.Pix[0], img.Pix[4*0xff])
+		}
+		if lighter := test.gamma > 1; (img.Pix[4*0x80] > 0x80) != lighter {
+			t.Errorf("%s: expected 0x80 to get lighter=%v, got %d", test.name, lighter, img.Pix[4*0x80])
+		}
+	}
+
+	// translucent pixels are curved by their straight values
+	img := image.NewRGBA(image.Rect(0, 0, 1, 1))
+	img.Pix = []byte{0x40, 0x40, 0x40, 0x80}
+	Gamma(img, 0.5)
+	if want := uint8(math.Round(math.Pow(0x7f/255.0, 2)*0xff) * 0x80 / 0xff); img.Pix[0] != want || img.Pix[3] != 0x80 {
+		t.Errorf("expected % x, got % x", []byte{want, want, want, 0x80}, img.Pix)
+	}
+}
+
+func TestConvertGamma(t *testing.T) {
+	// a 25% gray cut at 50% is black, unless a gamma of 3 lifts it over
+	dark := color.Gray{Y: 0x40}
+	for _, test := range []struct {
+		opts Options
+		want byte
+	}{
+		{Options{Threshold: 0x80}, 0xff},
+		{Options{Threshold: 0x80, Gamma: 3}, 0},
+		// inverted first, into a light gray that a gamma of 0.25 darkens
+		// back under the threshold, where the other way round it would be
+		// nearly black inverted into white
+		{Options{Threshold: 0x80, Gamma: 0.25, Invert: true}, 0xff},
+	} {
+		got, err := Convert(uniform(8, 8, dark), 8, 8, test.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, bytes.Repeat([]byte{test.want}, 8)) {
+			t.Errorf("%+v: expected % x, got % x", test.opts, test.want, got)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package badgeimg
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ScanOrder is the order pixels are packed in
+type ScanOrder int
+
+const (
+	// ColumnMajor packs the pixels column by column, each column top to
+	// bottom, as the badge's display is scanned
+	ColumnMajor ScanOrder = iota
+	// RowMajor packs the pixels row by row, each row left to right
+	RowMajor
+	// PageMajor packs the pixels in pages of 8 rows, top to bottom, each
+	// page a byte per column, left to right, as SSD1306 and SH1106 OLED
+	// controllers take them. The bit order is that of the rows in a byte.
+	PageMajor
+)
+
+// scanOrderNames are the names of the scan orders, as manifests and
+// generated files give them
+var scanOrderNames = []string{"column-major", "row-major", "page-major"}
+
+func (s ScanOrder) String() string {
+	if s < 0 || int(s) >= len(scanOrderNames) {
+		return fmt.Sprintf("ScanOrder(%d)", int(s))
+	}
+	return scanOrderNames[s]
+}
+
+// BitOrder is the order pixels are packed in within a byte
+type BitOrder int
+
+const (
+	// MSBFirst puts the first pixel in the most significant bit
+	MSBFirst BitOrder = iota
+	// LSBFirst puts the first pixel in the least significant bit
+	LSBFirst
+)
+
+func (b BitOrder) String() string {
+	switch b {
+	case MSBFirst:
+		return "msb-first"
+	case LSBFirst:
+		return "lsb-first"
+	}
+	return fmt.Sprintf("BitOrder(%d)", int(b))
+}
+
+// Layout describes how the pixels of an image are packed into bytes. The zero
+// Layout is LayoutBadger.
+type Layout struct {
+	ScanOrder ScanOrder
+	BitOrder  BitOrder
+	// RowPadding pads every line of pixels, a column in ColumnMajor order
+	// and a row in RowMajor order, to a multiple of this many bytes, as
+	// framebuffers with a stride do. 0 packs the lines back to back, and
+	// PageMajor lines are whole bytes already.
+	RowPadding int
+	// PlaneCount is how many bit planes the buffer holds one after the
+	// other, for controllers taking one per color such as the black and the
+	// red planes of three color panels: the image is packed into the first
+	// one and the others are left clear. 0 is the same as 1.
+	PlaneCount int
+}
+
+// The layouts of LayoutNames
+var (
+	// LayoutBadger is the layout of the badge's display, and of everything
+	// gopherbadgeimg writes for it unless told otherwise
+	LayoutBadger = Layout{ScanOrder: ColumnMajor, BitOrder: MSBFirst}
+	// LayoutBadgerOS is the layout of the images of Badger OS, Pimoroni's
+	// MicroPython firmware for the badge: rows of MicroPython's
+	// framebuf.MONO_HLSB, each padded to a whole byte
+	LayoutBadgerOS = Layout{ScanOrder: RowMajor, BitOrder: MSBFirst, RowPadding: 1}
+	// LayoutSSD1306 is the layout of SSD1306 and SH1106 OLED displays, and of
+	// MicroPython's framebuf.MONO_VLSB: pages of 8 rows, the top one in the
+	// least significant bit
+	LayoutSSD1306 = Layout{ScanOrder: PageMajor, BitOrder: LSBFirst}
+	// LayoutRowMSB packs the pixels row by row without padding, the first
+	// one in the most significant bit
+	LayoutRowMSB = Layout{ScanOrder: RowMajor, BitOrder: MSBFirst}
+)
+
+// layoutPreset is a layout of LayoutNames, with the name of its variable
+type layoutPreset struct {
+	name, goName string
+	layout       Layout
+}
+
+// layoutPresets are the layouts of LayoutNames, in the same order
+var layoutPresets = []layoutPreset{
+	{"badger", "LayoutBadger", LayoutBadger},
+	{"badger-os", "LayoutBadgerOS", LayoutBadgerOS},
+	{"ssd1306", "LayoutSSD1306", LayoutSSD1306},
+	{"row-msb", "LayoutRowMSB", LayoutRowMSB},
+}
+
+// LayoutNames are the names of the layouts LookupLayout knows, the first one
+// being the default
+var LayoutNames = func() []string {
+	names := make([]string, len(layoutPresets))
+	for i, preset := range layoutPresets {
+		names[i] = preset.name
+	}
+	return names
+}()
+
+// ErrUnknownLayout is returned for a layout name that isn't one of
+// LayoutNames
+var ErrUnknownLayout = errors.New("unknown layout")
+
+// LookupLayout returns the layout called name, one of LayoutNames, or
+// LayoutBadger when name is empty
+func LookupLayout(name string) (Layout, error) {
+	if name == "" {
+		return LayoutBadger, nil
+	}
+	for _, preset := range layoutPresets {
+		if preset.name == name {
+			return preset.layout, nil
+		}
+	}
+	return Layout{}, fmt.Errorf("%w `%s`, use one of: %s", ErrUnknownLayout, name, strings.Join(LayoutNames, ", "))
+}
+
+// preset returns the entry of layoutPresets matching l, if any
+func (l Layout) preset() (layoutPreset, bool) {
+	for _, preset := range layoutPresets {
+		if preset.layout.normalized() == l.normalized() {
+			return preset, true
+		}
+	}
+	return layoutPreset{}, false
+}
+
+// normalized returns l with its fields that have two ways of saying the same
+// thing set one way, for comparisons
+func (l Layout) normalized() Layout {
+	l.PlaneCount = l.planes()
+	if l.ScanOrder == PageMajor {
+		l.RowPadding = 0
+	}
+	return l
+}
+
+// String returns the name of l when it is one of LayoutNames, and else
+// describes it, such as "row-major lsb-first, lines padded to 4 bytes"
+func (l Layout) String() string {
+	if preset, ok := l.preset(); ok {
+		return preset.name
+	}
+	s := l.ScanOrder.String() + " " + l.BitOrder.String()
+	if l.RowPadding > 0 {
+		s += fmt.Sprintf(", lines padded to %d byte(s)", l.RowPadding)
+	}
+	if l.planes() > 1 {
+		s += fmt.Sprintf(", %d planes", l.planes())
+	}
+	return s
+}
+
+// GoString returns the Go expression of l, as generated files give it: the
+// name of its variable when it is one of LayoutNames
+func (l Layout) GoString() string {
+	if preset, ok := l.preset(); ok {
+		return "badgeimg." + preset.goName
+	}
+	goNames := map[ScanOrder]string{ColumnMajor: "ColumnMajor", RowMajor: "RowMajor", PageMajor: "PageMajor"}
+	bitOrder := "MSBFirst"
+	if l.BitOrder == LSBFirst {
+		bitOrder = "LSBFirst"
+	}
+	return fmt.Sprintf("badgeimg.Layout{ScanOrder: badgeimg.%s, BitOrder: badgeimg.%s, RowPadding: %d, PlaneCount: %d}",
+		goNames[l.ScanOrder], bitOrder, l.RowPadding, l.planes())
+}
+
+// planes is PlaneCount, 0 being 1
+func (l Layout) planes() int {
+	return max(1, l.PlaneCount)
+}
+
+// Validate checks that l is a layout, and that an image of w by h pixels can
+// be packed with it: PageMajor images must be whole pages of 8 rows, and
+// unpadded lines must fill whole bytes together.
+func (l Layout) Validate(w, h int) error {
+	switch {
+	case l.ScanOrder < ColumnMajor || l.ScanOrder > PageMajor:
+		return fmt.Errorf("invalid layout: unknown scan order %d", int(l.ScanOrder))
+	case l.BitOrder != MSBFirst && l.BitOrder != LSBFirst:
+		return fmt.Errorf("invalid layout: unknown bit order %d", int(l.BitOrder))
+	case l.RowPadding < 0:
+		return fmt.Errorf("invalid layout: the row padding is %d bytes, it can't be negative", l.RowPadding)
+	case l.PlaneCount < 0:
+		return fmt.Errorf("invalid layout: the plane count is %d, it can't be negative", l.PlaneCount)
+	case w <= 0 || h <= 0:
+		return fmt.Errorf("%w: a %dx%d image has no pixels", ErrSize, w, h)
+	case l.ScanOrder == PageMajor && h%8 != 0:
+		return fmt.Errorf("%w: a %dx%d image isn't made of whole pages of 8 rows, its height must be a multiple of 8", ErrSize, w, h)
+	case l.ScanOrder != PageMajor && l.RowPadding == 0 && w*h%8 != 0:
+		return fmt.Errorf("%w: a %dx%d image doesn't fill whole bytes", ErrSize, w, h)
+	}
+	return nil
+}
+
+// BufferLen returns the length in bytes of a w by h image packed with l,
+// every plane included
+func (l Layout) BufferLen(w, h int) int {
+	return l.planeLen(w, h) * l.planes()
+}
+
+// planeLen returns the length in bytes of a single plane of a w by h image
+func (l Layout) planeLen(w, h int) int {
+	switch {
+	case l.ScanOrder == PageMajor:
+		return w * ((h + 7) / 8)
+	case l.RowPadding > 0:
+		lines, length := l.lines(w, h)
+		return lines * l.lineBytes(length)
+	}
+	return (w*h + 7) / 8
+}
+
+// lines returns how many lines of pixels a w by h image is packed in, and
+// their length, for the ColumnMajor and RowMajor scan orders
+func (l Layout) lines(w, h int) (int, int) {
+	if l.ScanOrder == RowMajor {
+		return h, w
+	}
+	return w, h
+}
+
+// lineBytes returns how many bytes a padded line of length pixels takes
+func (l Layout) lineBytes(length int) int {
+	n := (length + 7) / 8
+	return (n + l.RowPadding - 1) / l.RowPadding * l.RowPadding
+}
+
+// Mask returns the mask of bit n of a buffer packed with l, as BitIndex
+// numbers them, within its byte n/8
+func (l Layout) Mask(n int) byte {
+	if l.BitOrder == LSBFirst {
+		return 1 << uint(n%8)
+	}
+	return 0x80 >> uint(n%8)
+}
+
+// BitIndex returns the bit pixel (x, y) of a w by h image is packed in with
+// l: bit n of the buffer is in byte n/8, under the mask l.Mask(n). Pack,
+// BytesToImg, PixelAt, Framebuffer and every other reader or writer of
+// packed images address their pixels through it, so that they agree on
+// every layout and size, padded lines and partial bytes included. Planes
+// after the first start BufferLen(w, h)/PlaneCount bytes further each.
+func BitIndex(l Layout, x, y, w, h int) int {
+	if l.ScanOrder == PageMajor {
+		return (y/8*w+x)*8 + y%8
+	}
+	line, pos, length := x, y, h
+	if l.ScanOrder == RowMajor {
+		line, pos, length = y, x, w
+	}
+	if l.RowPadding > 0 {
+		return line*l.lineBytes(length)*8 + pos
+	}
+	return line*length + pos
+}
+
+// PixelAt reports whether pixel (i, j) of an x by y image packed with l in
+// bits is set, black. Unlike BytesToImg, it reads sizes that don't fill whole
+// bytes too, as long as bits holds the pixel.
+func (l Layout) PixelAt(bits []byte, x, y, i, j int) bool {
+	n, mask := l.bit(x, y, i, j)
+	return bits[n]&mask != 0
+}
+
+// bit returns the byte pixel (i, j) of an x by y image is packed in, and the
+// mask of its bit, see BitIndex
+func (l Layout) bit(x, y, i, j int) (int, byte) {
+	n := BitIndex(l, i, j, x, y)
+	return n / 8, l.Mask(n)
+}
@@ -0,0 +1,82 @@
+package badgeimg
+
+import (
+	"image"
+	"math"
+)
+
+// The dither package already diffuses the error of dithering in linear
+// light, so a 50% sRGB gray dithers to about 21% white pixels, which is how
+// much light it gives off. Thresholding and inverting work on the
+// gamma-encoded values instead, unless Options.Linear is set.
+
+// linear holds the linear light of every 8 bit sRGB value, from 0 to 1
+var linear = func() (table [256]float64) {
+	for v := range table {
+		table[v] = SRGBToLinear(float64(v) / 0xff)
+	}
+	return table
+}()
+
+// SRGBToLinear returns the linear light of v, an sRGB value from 0 to 1, by
+// the sRGB transfer function
+func SRGBToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+// LinearToSRGB returns the sRGB value of l, an amount of linear light from 0
+// to 1; it is the inverse of SRGBToLinear
+func LinearToSRGB(l float64) float64 {
+	if l <= 0.0031308 {
+		return l * 12.92
+	}
+	return 1.055*math.Pow(l, 1/2.4) - 0.055
+}
+
+// encode returns the 8 bit sRGB value of l, an amount of linear light
+func encode(l float64) uint8 {
+	return uint8(math.Round(min(max(LinearToSRGB(l), 0), 1) * 0xff))
+}
+
+// luminance returns the relative luminance of an sRGB color, from 0 to 1,
+// with the Rec. 709 weights of the sRGB primaries
+func luminance(r, g, b uint8) float64 {
+	if r == g && g == b {
+		// exactly, where the weights could round it off the threshold
+		return linear[r]
+	}
+	return 0.2126*linear[r] + 0.7152*linear[g] + 0.0722*linear[b]
+}
+
+// InvertLinear turns img into its negative in linear light, in place: each
+// channel gives off the light it held back, so that 50% gray becomes a much
+// lighter gray instead of staying about the same
+func InvertLinear(img *image.RGBA) {
+	// pixels are alpha-premultiplied
+	for p := 0; p < len(img.Pix); p += 4 {
+		a := img.Pix[p+3]
+		if a == 0 {
+			continue
+		}
+		for c := p; c < p+3; c++ {
+			v := uint8(min(int(img.Pix[c])*0xff/int(a), 0xff))
+			img.Pix[c] = uint8(int(encode(1-linear[v])) * int(a) / 0xff)
+		}
+	}
+}
+
+// ThresholdLinear is Threshold in linear light: the relative luminance of
+// each pixel is compared with the linear light of threshold
+func ThresholdLinear(img *image.RGBA, threshold int) {
+	cut := linear[min(max(threshold, 0), 0xff)]
+	for p := 0; p < len(img.Pix); p += 4 {
+		v := uint8(0)
+		if luminance(img.Pix[p], img.Pix[p+1], img.Pix[p+2]) >= cut {
+			v = 0xff
+		}
+		img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3] = v, v, v, 0xff
+	}
+}
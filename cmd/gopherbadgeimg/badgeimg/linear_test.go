@@ -0,0 +1,82 @@
+package badgeimg
+
+import (
+	"image/color"
+	"math"
+	"math/bits"
+	"testing"
+)
+
+func TestSRGBToLinear(t *testing.T) {
+	for _, test := range []struct {
+		v, want float64
+	}{
+		{0, 0},
+		{0.04045, 0.0031308},
+		{0.5, 0.2140},
+		{1, 1},
+	} {
+		if got := SRGBToLinear(test.v); math.Abs(got-test.want) > 1e-4 {
+			t.Errorf("%v: expected %v, got %v", test.v, test.want, got)
+		}
+	}
+	for v := range 256 {
+		if got := encode(linear[v]); int(got) != v {
+			t.Errorf("%d: expected it back from linear light, got %d", v, got)
+		}
+	}
+}
+
+func TestLinear(t *testing.T) {
+	// the share of white pixels of a 50% sRGB gray field, which dithering
+	// makes the light the gray gives off
+	whites := func(c color.Color, opts Options) float64 {
+		t.Helper()
+		packed, err := Convert(uniform(64, 64, c), 64, 64, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		on := 0
+		for _, b := range packed {
+			on += bits.OnesCount8(b)
+		}
+		return 1 - float64(on)/float64(len(packed)*8)
+	}
+	gray := color.Gray{Y: 0x80}
+	light := SRGBToLinear(0x80 / 255.0)
+	for _, test := range []struct {
+		name      string
+		opts      Options
+		want, tol float64
+	}{
+		{"dithered", Options{}, light, 0.01},
+		{"dithered in linear light", Options{Linear: true}, light, 0.01},
+		{"inverted", Options{Invert: true}, SRGBToLinear(0x7f / 255.0), 0.01},
+		{"inverted in linear light", Options{Invert: true, Linear: true}, 1 - light, 0.01},
+		// Bayer rounds to the 16 levels of its matrix
+		{"inverted in linear light with bayer", Options{Invert: true, Linear: true, Dither: "bayer"}, 1 - light, 1.0 / 16},
+	} {
+		if got := whites(gray, test.opts); math.Abs(got-test.want) > test.tol {
+			t.Errorf("%s: expected %.3f of the pixels white, got %.3f", test.name, test.want, got)
+		}
+	}
+
+	// grays cut at the same place either way, colors by their luminance in
+	// linear light: green is brighter than its gamma-encoded value says
+	green := color.RGBA{0, 0xff, 0, 0xff}
+	for _, test := range []struct {
+		name string
+		c    color.Color
+		opts Options
+		want float64
+	}{
+		{"gray at the threshold", gray, Options{Threshold: 0x80, Linear: true}, 1},
+		{"gray under the threshold", gray, Options{Threshold: 0x81, Linear: true}, 0},
+		{"green", green, Options{Threshold: 200}, 0},
+		{"green in linear light", green, Options{Threshold: 200, Linear: true}, 1},
+	} {
+		if got := whites(test.c, test.opts); got != test.want {
+			t.Errorf("%s: expected %v of the pixels white, got %v", test.name, test.want, got)
+		}
+	}
+}
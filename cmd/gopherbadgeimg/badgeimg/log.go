@@ -0,0 +1,78 @@
+package badgeimg
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// Level is how much a Logger writes: the messages of its level and of every
+// level below it
+type Level int
+
+const (
+	// LevelQuiet writes errors only
+	LevelQuiet Level = iota - 1
+	// LevelInfo writes warnings and what was done as well, the default
+	LevelInfo
+	// LevelDebug writes the details of each conversion too, such as the
+	// size and the dithering algorithm
+	LevelDebug
+	// LevelTrace writes how long each stage of a conversion took too
+	LevelTrace
+)
+
+// Logger writes messages up to Level, each on its own line. The zero value
+// writes warnings and info to the standard logger, which writes to stderr:
+// a Logger is meant for diagnostics, never for data. It can be used by
+// several goroutines at once, as a log.Logger can.
+type Logger struct {
+	Level Level
+	// Log writes the messages, the standard logger when nil
+	Log *log.Logger
+}
+
+// Enabled reports whether messages of level are written. A nil Logger
+// writes nothing.
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level <= l.Level
+}
+
+func (l *Logger) logf(level Level, format string, args ...any) {
+	if !l.Enabled(level) {
+		return
+	}
+	out := l.Log
+	if out == nil {
+		out = log.Default()
+	}
+	out.Output(3, fmt.Sprintf(format, args...))
+}
+
+// Errorf writes an error, which is written at every level
+func (l *Logger) Errorf(format string, args ...any) {
+	l.logf(LevelQuiet, format, args...)
+}
+
+// Warnf writes a warning, prefixed with "warning: "
+func (l *Logger) Warnf(format string, args ...any) {
+	l.logf(LevelInfo, "warning: "+format, args...)
+}
+
+// Infof writes what was done, such as how many images were converted
+func (l *Logger) Infof(format string, args ...any) {
+	l.logf(LevelInfo, format, args...)
+}
+
+// Debugf writes a detail of a conversion
+func (l *Logger) Debugf(format string, args ...any) {
+	l.logf(LevelDebug, format, args...)
+}
+
+// Timef writes how long the stage named by the format took since start, as
+// in "decoded gopher.png in 1.2ms", appending " in" and the duration
+func (l *Logger) Timef(start time.Time, format string, args ...any) {
+	if l.Enabled(LevelTrace) {
+		l.logf(LevelTrace, format+" in %v", append(args, time.Since(start).Round(time.Microsecond))...)
+	}
+}
@@ -0,0 +1,59 @@
+package badgeimg
+
+import (
+	"bytes"
+	"image/color"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger(t *testing.T) {
+	for _, test := range []struct {
+		level Level
+		want  []string
+	}{
+		{LevelQuiet, []string{"error"}},
+		{LevelInfo, []string{"error", "warning: warn", "info"}},
+		{LevelDebug, []string{"error", "warning: warn", "info", "debug"}},
+		{LevelTrace, []string{"error", "warning: warn", "info", "debug", "stage in "}},
+	} {
+		var out bytes.Buffer
+		l := &Logger{Level: test.level, Log: log.New(&out, "", 0)}
+		l.Errorf("error")
+		l.Warnf("warn")
+		l.Infof("info")
+		l.Debugf("debug")
+		l.Timef(time.Now(), "stage")
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		if len(lines) != len(test.want) {
+			t.Fatalf("level %d: expected %q, got %q", test.level, test.want, lines)
+		}
+		for i, want := range test.want {
+			if !strings.HasPrefix(lines[i], want) {
+				t.Errorf("level %d: expected %q, got %q", test.level, want, lines[i])
+			}
+		}
+	}
+
+	// a nil Logger says nothing, so that it can be left out of Options
+	var l *Logger
+	if l.Enabled(LevelQuiet) {
+		t.Error("expected a nil Logger to write nothing")
+	}
+	l.Errorf("nowhere")
+}
+
+func TestConvertLogger(t *testing.T) {
+	var out bytes.Buffer
+	opts := Options{Dither: "atkinson", Logger: &Logger{Level: LevelTrace, Log: log.New(&out, "", 0)}}
+	if _, err := Convert(uniform(16, 16, color.White), 8, 8, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"converting a 16x16 image to 8x8, dithering with atkinson", "scaled in ", "dithered in ", "packed in "} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in\n%s", want, out.String())
+		}
+	}
+}
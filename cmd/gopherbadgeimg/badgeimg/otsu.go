@@ -0,0 +1,69 @@
+package badgeimg
+
+import (
+	"image"
+	"image/color"
+)
+
+// ThresholdAuto is the Threshold of Options picking the threshold of every
+// image from its own luminance histogram, by Otsu's method (see Otsu)
+const ThresholdAuto = -1
+
+// FallbackThreshold is the threshold ThresholdAuto falls back to for images
+// of a single shade, which have nothing to separate
+const FallbackThreshold = 128
+
+// Histogram counts the pixels of img by their luminance, the 8 bit value
+// Threshold compares with the threshold. In linear light the relative
+// luminance ThresholdLinear compares is counted, encoded back to 8 bit sRGB,
+// so that the threshold Otsu finds applies either way.
+func Histogram(img *image.RGBA, linear bool) [256]int {
+	var hist [256]int
+	for p := 0; p < len(img.Pix); p += 4 {
+		c := color.RGBA{img.Pix[p], img.Pix[p+1], img.Pix[p+2], img.Pix[p+3]}
+		if linear {
+			hist[encode(luminance(c.R, c.G, c.B))]++
+		} else {
+			hist[color.GrayModel.Convert(c).(color.Gray).Y]++
+		}
+	}
+	return hist
+}
+
+// Otsu returns the threshold splitting the pixels counted in hist into the
+// two classes with the largest variance between them, by Otsu's method: the
+// pixels darker than it and the others. When several thresholds split the
+// histogram as well, such as every threshold between the two values of a two
+// tone image, the one in the middle is returned. ok is false for histograms
+// of fewer than two values, which can't be split.
+func Otsu(hist [256]int) (threshold int, ok bool) {
+	var total, sum float64
+	for v, n := range hist {
+		total += float64(n)
+		sum += float64(v * n)
+	}
+	// the variance between the classes of the pixels darker than t and the
+	// others, which have weights w0 and total-w0 and sums sum0 and sum-sum0,
+	// is proportional to (sum0*total - sum*w0)^2 / (w0*(total-w0))
+	var w0, sum0, best float64
+	first, last := -1, -1
+	for t := 1; t < len(hist); t++ {
+		w0 += float64(hist[t-1])
+		sum0 += float64((t - 1) * hist[t-1])
+		if w0 == 0 || w0 == total {
+			continue
+		}
+		d := sum0*total - sum*w0
+		variance := d * d / (w0 * (total - w0))
+		switch {
+		case variance > best:
+			best, first, last = variance, t, t
+		case variance == best:
+			last = t
+		}
+	}
+	if first < 0 {
+		return FallbackThreshold, false
+	}
+	return (first + last) / 2, true
+}
@@ -0,0 +1,116 @@
+package badgeimg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"log"
+	"strings"
+	"testing"
+)
+
+// grayRamp returns an image whose pixels have the luminances of counts: a
+// pixel of luminance v for each of counts[v]
+func grayRamp(counts map[int]int) *image.RGBA {
+	var pix []byte
+	for v, n := range counts {
+		for range n {
+			pix = append(pix, byte(v), byte(v), byte(v), 0xff)
+		}
+	}
+	return &image.RGBA{Pix: pix, Stride: len(pix), Rect: image.Rect(0, 0, len(pix)/4, 1)}
+}
+
+func TestOtsu(t *testing.T) {
+	// two triangular modes around 64 and 192, mirroring each other about
+	// 128: the classes are split in the middle of the gap between them
+	bimodal := map[int]int{}
+	for d := -16; d <= 16; d++ {
+		bimodal[64+d] = 17 - max(d, -d)
+		bimodal[192+d] = 17 - max(d, -d)
+	}
+	// twice as many dark pixels: any threshold in the gap separates the
+	// modes as well
+	unbalanced := map[int]int{}
+	for v, n := range bimodal {
+		unbalanced[v] = n
+		if v < 128 {
+			unbalanced[v] = 2 * n
+		}
+	}
+	// a flat histogram splits in half
+	flat := map[int]int{}
+	for v := range 256 {
+		flat[v] = 1
+	}
+	tests := []struct {
+		name   string
+		counts map[int]int
+		want   int
+	}{
+		{"bimodal", bimodal, 128},
+		{"unbalanced", unbalanced, 128},
+		{"two tones", map[int]int{40: 10, 200: 3}, 120},
+		{"flat", flat, 128},
+		// the modes of equal spread are weighed by their pixels, so the
+		// cut is where their means are equally far, 0x30 and 0xd0
+		{"overlapping", map[int]int{0x20: 1, 0x30: 2, 0x40: 1, 0x70: 1, 0x90: 1, 0xc0: 1, 0xd0: 2, 0xe0: 1}, 0x80},
+	}
+	for _, test := range tests {
+		got, ok := Otsu(Histogram(grayRamp(test.counts), false))
+		if !ok || got != test.want {
+			t.Errorf("%s: expected a threshold of %d, got %d (ok=%v)", test.name, test.want, got, ok)
+		}
+	}
+	for _, counts := range []map[int]int{{}, {90: 12}} {
+		if got, ok := Otsu(Histogram(grayRamp(counts), false)); ok || got != FallbackThreshold {
+			t.Errorf("%v: expected the fallback threshold, got %d (ok=%v)", counts, got, ok)
+		}
+	}
+}
+
+func TestHistogramLinear(t *testing.T) {
+	img := grayRamp(map[int]int{0x80: 1})
+	img.Pix = append(img.Pix, 0xff, 0, 0, 0xff)
+	img.Rect.Max.X++
+	hist := Histogram(img, true)
+	// grays keep their value; pure red gives off 21% of white's light
+	if hist[0x80] != 1 || hist[encode(0.2126)] != 1 {
+		t.Errorf("expected 0x80 and the luminance of red, got %v", hist)
+	}
+}
+
+func TestConvertThresholdAuto(t *testing.T) {
+	// dark gray text on a light gray background, which a threshold of 128
+	// turns all white
+	src := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range 64 {
+		v := byte(0xd0)
+		if i%8 < 4 {
+			v = 0x90
+		}
+		src.SetRGBA(i%8, i/8, color.RGBA{v, v, v, 0xff})
+	}
+	var out bytes.Buffer
+	opts := Options{Threshold: ThresholdAuto, Logger: &Logger{Level: LevelDebug, Log: log.New(&out, "", 0)}}
+	got, err := Convert(src, 8, 8, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the left half, 4 columns of 8 pixels, is black
+	if want := []byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("expected % x, got % x", want, got)
+	}
+	if !strings.Contains(out.String(), "picked a threshold of 176") {
+		t.Errorf("expected the threshold to be logged, got %q", out.String())
+	}
+
+	out.Reset()
+	got, err = Convert(uniform(8, 8, color.Gray{Y: 0x70}), 8, 8, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bytes.Repeat([]byte{0xff}, 8)) || !strings.Contains(out.String(), "single shade") {
+		t.Errorf("expected a single shade to be cut at 128 with a warning, got % x and %q", got, out.String())
+	}
+}
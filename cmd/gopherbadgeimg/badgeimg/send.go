@@ -0,0 +1,202 @@
+package badgeimg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// Send pushes a packed image to a badge over a serial port, such as its
+// USB-CDC console, for a receiver like examples/receiver to draw. The image
+// goes in a frame, little-endian:
+//
+//	offset  size  field
+//	0       4     magic "GBSN"
+//	4       2     width in pixels
+//	6       2     height in pixels
+//	8       4     length n of the data, in bytes
+//	12      n     the data, packed as Convert packs it
+//	12+n    4     CRC32 (IEEE) of all the bytes before it
+//
+// The receiver answers every frame with a single byte: ACK once it has it
+// whole, or NAK when its CRC doesn't match or it is too large, upon which
+// Send sends it again. Both ends skip anything else they read, such as what
+// the badge prints to its console, and the receiver whatever comes before
+// the magic of a frame.
+const (
+	// ACK is the answer to a frame received whole
+	ACK = 0x06
+	// NAK is the answer to a frame that was corrupted or is too large
+	NAK = 0x15
+
+	frameHeaderSize = 12
+)
+
+// frameMagic starts every frame
+var frameMagic = [4]byte{'G', 'B', 'S', 'N'}
+
+var (
+	// ErrFrame is matched by the errors of frames that can't be encoded, or
+	// that are corrupted or too large when read
+	ErrFrame = errors.New("invalid frame")
+	// ErrNAK is returned by Send when the badge rejects every try
+	ErrNAK = errors.New("the badge rejected the image")
+	// ErrNoAnswer is returned by Send when the badge doesn't answer a frame
+	// in time, as when nothing is listening on the port
+	ErrNoAnswer = errors.New("no answer from the badge")
+)
+
+// Frame is an image sent to a badge
+type Frame struct {
+	Width, Height int
+	Data          []byte
+}
+
+// AppendFrame appends f to buf as a frame
+func AppendFrame(buf []byte, f Frame) ([]byte, error) {
+	if f.Width <= 0 || f.Width > 0xffff || f.Height <= 0 || f.Height > 0xffff {
+		return nil, fmt.Errorf("%w: a %dx%d image doesn't fit in one", ErrFrame, f.Width, f.Height)
+	}
+	if uint64(len(f.Data)) > 0xffffffff {
+		return nil, fmt.Errorf("%w: %d bytes of data don't fit in one", ErrFrame, len(f.Data))
+	}
+	start := len(buf)
+	buf = append(buf, frameMagic[:]...)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(f.Width))
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(f.Height))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(f.Data)))
+	buf = append(buf, f.Data...)
+	return binary.LittleEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf[start:])), nil
+}
+
+// ReadFrame reads the next frame from r, skipping whatever comes before its
+// magic. A frame with more than maxLen bytes of data is rejected without
+// reading them, and one whose CRC doesn't match once it is read; both errors
+// match ErrFrame, after which the next frame can be read.
+func ReadFrame(r io.Reader, maxLen int) (Frame, error) {
+	var header [frameHeaderSize]byte
+	// the magic has no repeated bytes, so a partial match can only start
+	// over at the byte that broke it
+	for matched := 0; matched < len(frameMagic); {
+		if _, err := io.ReadFull(r, header[matched:matched+1]); err != nil {
+			return Frame{}, err
+		}
+		switch b := header[matched]; {
+		case b == frameMagic[matched]:
+			matched++
+		case b == frameMagic[0]:
+			header[0], matched = b, 1
+		default:
+			matched = 0
+		}
+	}
+	if _, err := io.ReadFull(r, header[len(frameMagic):]); err != nil {
+		return Frame{}, err
+	}
+	f := Frame{
+		Width:  int(binary.LittleEndian.Uint16(header[4:])),
+		Height: int(binary.LittleEndian.Uint16(header[6:])),
+	}
+	n := binary.LittleEndian.Uint32(header[8:])
+	if uint64(n) > uint64(maxLen) {
+		return Frame{}, fmt.Errorf("%w: %d bytes of data, more than %d", ErrFrame, n, maxLen)
+	}
+	rest := make([]byte, n+4)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return Frame{}, err
+	}
+	f.Data = rest[:n]
+	crc := crc32.Update(crc32.ChecksumIEEE(header[:]), crc32.IEEETable, f.Data)
+	if want := binary.LittleEndian.Uint32(rest[n:]); crc != want {
+		return Frame{}, fmt.Errorf("%w: its CRC32 is %08x, the data's %08x", ErrFrame, want, crc)
+	}
+	return f, nil
+}
+
+// Receive is the other end of Send: it reads frames from rw until one comes
+// whole, answering NAK to those that don't, and answers it ACK
+func Receive(rw io.ReadWriter, maxLen int) (Frame, error) {
+	for {
+		f, err := ReadFrame(rw, maxLen)
+		answer := byte(ACK)
+		if errors.Is(err, ErrFrame) {
+			answer = NAK
+		} else if err != nil {
+			return Frame{}, err
+		}
+		if _, err := rw.Write([]byte{answer}); err != nil {
+			return Frame{}, err
+		}
+		if answer == ACK {
+			return f, nil
+		}
+	}
+}
+
+// SendOptions are the settings of Send
+type SendOptions struct {
+	// Retries is how many times a frame the badge rejects is sent again
+	Retries int
+	// Timeout bounds sending each try and waiting for its answer, 0 for no
+	// limit. It needs a port with a SetDeadline method, as files and
+	// network connections have.
+	Timeout time.Duration
+}
+
+// Send sends f to the badge listening on rw, and waits for it to be
+// received, sending it again when it is rejected
+func Send(rw io.ReadWriter, f Frame, opts SendOptions) error {
+	frame, err := AppendFrame(nil, f)
+	if err != nil {
+		return err
+	}
+	port, deadlines := rw.(interface{ SetDeadline(time.Time) error })
+	deadlines = deadlines && opts.Timeout > 0
+	if deadlines {
+		defer port.SetDeadline(time.Time{})
+	}
+	for try := 1; ; try++ {
+		if deadlines {
+			if err := port.SetDeadline(time.Now().Add(opts.Timeout)); err != nil {
+				return err
+			}
+		}
+		answer, err := sendFrame(rw, frame)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return fmt.Errorf("%w in %s, is the receiver running on it?", ErrNoAnswer, opts.Timeout)
+		}
+		if errors.Is(err, io.EOF) {
+			return fmt.Errorf("%w, the port was closed", ErrNoAnswer)
+		}
+		if err != nil {
+			return err
+		}
+		if answer == ACK {
+			return nil
+		}
+		if try > opts.Retries {
+			return fmt.Errorf("%w %d times", ErrNAK, try)
+		}
+	}
+}
+
+// sendFrame writes frame to rw and returns the answer, skipping the bytes
+// that are neither ACK nor NAK
+func sendFrame(rw io.ReadWriter, frame []byte) (byte, error) {
+	if _, err := rw.Write(frame); err != nil {
+		return 0, err
+	}
+	var answer [1]byte
+	for {
+		if _, err := io.ReadFull(rw, answer[:]); err != nil {
+			return 0, err
+		}
+		if answer[0] == ACK || answer[0] == NAK {
+			return answer[0], nil
+		}
+	}
+}
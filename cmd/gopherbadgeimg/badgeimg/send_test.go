@@ -0,0 +1,139 @@
+package badgeimg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrame(t *testing.T) {
+	f := Frame{Width: 16, Height: 8, Data: bytes.Repeat([]byte{0xa5}, 16)}
+	frame, err := AppendFrame(nil, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "GBSN\x10\x00\x08\x00\x10\x00\x00\x00"; string(frame[:12]) != want || len(frame) != 12+16+4 {
+		t.Fatalf("expected a frame starting with %q, got %q", want, frame)
+	}
+
+	// what comes before the magic is skipped, a partial magic included
+	got, err := ReadFrame(bytes.NewReader(append([]byte("console GBS GB"), frame...)), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, f) {
+		t.Errorf("expected %v, got %v", f, got)
+	}
+
+	corrupted := bytes.Clone(frame)
+	corrupted[20] ^= 0x01
+	for _, test := range []struct {
+		data   []byte
+		maxLen int
+		want   string
+	}{
+		{corrupted, 16, "its CRC32 is"},
+		{frame, 15, "16 bytes of data, more than 15"},
+	} {
+		if _, err := ReadFrame(bytes.NewReader(test.data), test.maxLen); !errors.Is(err, ErrFrame) || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("expected ErrFrame and %q, got %v", test.want, err)
+		}
+	}
+	// the frame after a corrupted one still reads
+	r := io.MultiReader(bytes.NewReader(corrupted), bytes.NewReader(frame))
+	if _, err := ReadFrame(r, 16); !errors.Is(err, ErrFrame) {
+		t.Errorf("expected the corrupted frame to fail, got %v", err)
+	}
+	if got, err := ReadFrame(r, 16); err != nil || !reflect.DeepEqual(got, f) {
+		t.Errorf("expected the next frame, got %v and %v", got, err)
+	}
+
+	if _, err := ReadFrame(bytes.NewReader(frame[:20]), 16); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected a truncated frame to fail with io.ErrUnexpectedEOF, got %v", err)
+	}
+	if _, err := AppendFrame(nil, Frame{Width: 0x10000, Height: 1}); !errors.Is(err, ErrFrame) {
+		t.Errorf("expected ErrFrame for an image too wide, got %v", err)
+	}
+}
+
+// flaky is a host end of a pipe corrupting the first frames sent through it
+type flaky struct {
+	net.Conn
+	corrupt int
+}
+
+func (f *flaky) Write(p []byte) (int, error) {
+	if f.corrupt > 0 {
+		// Send writes frames whole, the CRC last
+		p = bytes.Clone(p)
+		p[len(p)-1] ^= 0xff
+		f.corrupt--
+	}
+	return f.Conn.Write(p)
+}
+
+// chatty is a badge end of a pipe printing to its console before answering
+type chatty struct {
+	net.Conn
+}
+
+func (c chatty) Write(p []byte) (int, error) {
+	if _, err := c.Conn.Write([]byte("received\r\n")); err != nil {
+		return 0, err
+	}
+	return c.Conn.Write(p)
+}
+
+func TestSend(t *testing.T) {
+	f := Frame{Width: 8, Height: 8, Data: []byte("\x00\x18\x3c\x7e\x7e\x3c\x18\x00")}
+	for _, test := range []struct {
+		name    string
+		corrupt int
+		retries int
+		want    error
+	}{
+		{"whole", 0, 0, nil},
+		{"corrupted once", 1, 3, nil},
+		{"corrupted every time", 3, 2, ErrNAK},
+	} {
+		host, badge := net.Pipe()
+		received := make(chan Frame, 1)
+		go func() {
+			defer badge.Close()
+			got, err := Receive(chatty{badge}, 64)
+			if err == nil {
+				received <- got
+			}
+		}()
+		err := Send(&flaky{Conn: host, corrupt: test.corrupt}, f, SendOptions{Retries: test.retries, Timeout: time.Second})
+		host.Close()
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, err)
+			continue
+		}
+		if test.want != nil {
+			continue
+		}
+		if got := <-received; !reflect.DeepEqual(got, f) {
+			t.Errorf("%s: expected the badge to receive %v, got %v", test.name, f, got)
+		}
+	}
+
+	// nothing answers
+	host, badge := net.Pipe()
+	go io.Copy(io.Discard, badge)
+	defer badge.Close()
+	start := time.Now()
+	err := Send(host, f, SendOptions{Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, ErrNoAnswer) || !strings.Contains(err.Error(), "in 50ms") {
+		t.Errorf("expected ErrNoAnswer in 50ms, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Send to give up after its timeout, it took %s", elapsed)
+	}
+}
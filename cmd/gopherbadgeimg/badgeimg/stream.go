@@ -0,0 +1,112 @@
+package badgeimg
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+)
+
+// Encoding is how ConvertReader writes a packed image
+type Encoding int
+
+const (
+	// EncodingRaw writes the packed bytes as they are, as in bin files
+	EncodingRaw Encoding = iota
+	// EncodingBase64 writes them in standard base64, without a newline, as
+	// the badge's Makefile takes profile images
+	EncodingBase64
+	// EncodingPBM writes a raw (P4) PBM file, which image viewers open
+	EncodingPBM
+)
+
+// The errors of ConvertReader wrap one of these, along with the error of the
+// step that failed, so that callers can tell a bad image from a failed write.
+// Data in a format no decoder is registered for matches ErrUnsupportedFormat
+// as well as ErrDecode.
+var (
+	ErrDecode            = errors.New("decoding the image")
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrConvert           = errors.New("converting the image")
+	ErrWrite             = errors.New("writing the image")
+)
+
+// ConvertReader decodes an image from r, converts it to opts.Width by
+// opts.Height as Convert does, and writes it to w in opts.Encoding, without
+// touching the filesystem: r can be an HTTP body or embedded bytes as well as
+// a file. PNG, JPEG and GIF images are decoded; importing the decoder of
+// another format registers it too, as for image.Decode, and so does
+// RegisterDecoder.
+func ConvertReader(r io.Reader, w io.Writer, opts Options) error {
+	src, _, err := Decode(r)
+	if errors.Is(err, image.ErrFormat) {
+		return fmt.Errorf("%w: %w: %w", ErrDecode, ErrUnsupportedFormat, err)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDecode, err)
+	}
+	packed, err := Convert(src, opts.Width, opts.Height, opts)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConvert, err)
+	}
+	if err := Encode(w, opts.Width, opts.Height, packed, opts.Layout, opts.Encoding); err != nil {
+		return fmt.Errorf("%w: %w", ErrWrite, err)
+	}
+	return nil
+}
+
+// Encode writes the x by y image bits, packed with layout, to w in encoding.
+// Base64 is encoded on the way out, rather than held in memory as a whole.
+func Encode(w io.Writer, x, y int, bits []byte, layout Layout, encoding Encoding) error {
+	switch encoding {
+	case EncodingRaw:
+		_, err := w.Write(bits)
+		return err
+	case EncodingBase64:
+		enc := base64.NewEncoder(base64.StdEncoding, w)
+		if _, err := enc.Write(bits); err != nil {
+			return err
+		}
+		// flushes the last, partial, block
+		return enc.Close()
+	case EncodingPBM:
+		return EncodePBM(w, x, y, bits, layout)
+	}
+	return fmt.Errorf("unknown encoding %d", encoding)
+}
+
+// EncodePBM writes an image packed with layout as a raw (P4) PBM file.
+//
+// The badge packs pixels column by column, while PBM stores rows, each padded
+// to a whole byte, so the bits are repacked on the way out. Set bits are
+// black in both.
+func EncodePBM(w io.Writer, x, y int, bits []byte, layout Layout) error {
+	if err := layout.Validate(x, y); err != nil {
+		return err
+	}
+	if n := layout.BufferLen(x, y); len(bits) != n {
+		return fmt.Errorf("%w: a %dx%d image is %d bytes, got %d", ErrBufferSize, x, y, n, len(bits))
+	}
+	if _, err := fmt.Fprintf(w, "P4\n%d %d\n", x, y); err != nil {
+		return err
+	}
+	stride := (x + 7) / 8
+	row := make([]byte, stride)
+	for j := 0; j < y; j++ {
+		clear(row)
+		for i := 0; i < x; i++ {
+			n, mask := layout.bit(x, y, i, j)
+			if bits[n]&mask != 0 {
+				row[i/8] |= 0x80 >> uint(i%8)
+			}
+		}
+		if _, err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
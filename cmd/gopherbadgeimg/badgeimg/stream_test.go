@@ -0,0 +1,119 @@
+package badgeimg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestConvertReader(t *testing.T) {
+	// a 12x8 gradient, which dithers to a mix of black and white
+	src := image.NewRGBA(image.Rect(0, 0, 12, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 12; x++ {
+			src.Set(x, y, color.Gray{Y: uint8(x * 20)})
+		}
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, src); err != nil {
+		t.Fatal(err)
+	}
+	want, err := Convert(src, 12, 8, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	convert := func(encoding Encoding) []byte {
+		t.Helper()
+		var out bytes.Buffer
+		opts := Options{Width: 12, Height: 8, Encoding: encoding}
+		if err := ConvertReader(bytes.NewReader(encoded.Bytes()), &out, opts); err != nil {
+			t.Fatal(err)
+		}
+		return out.Bytes()
+	}
+	if got := convert(EncodingRaw); !bytes.Equal(got, want) {
+		t.Errorf("raw: expected % x, got % x", want, got)
+	}
+	if got := convert(EncodingBase64); string(got) != base64.StdEncoding.EncodeToString(want) {
+		t.Errorf("base64: expected %s, got %s", base64.StdEncoding.EncodeToString(want), got)
+	}
+	// rows of 12 pixels take 2 bytes in a PBM file
+	pbm := convert(EncodingPBM)
+	if header := "P4\n12 8\n"; !strings.HasPrefix(string(pbm), header) || len(pbm) != len(header)+16 {
+		t.Fatalf("expected a 12x8 PBM file, got %q", pbm)
+	}
+	decoded, err := BytesToImg(12, 8, want, LayoutBadger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := pbm[len("P4\n12 8\n"):]
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 12; x++ {
+			set := rows[y*2+x/8]&(0x80>>uint(x%8)) != 0
+			if black := decoded.GrayAt(x, y).Y == 0; set != black {
+				t.Errorf("pbm: expected pixel %d,%d to be black: %v", x, y, black)
+			}
+		}
+	}
+
+	// another layout packs the same pixels, which make the same PBM file
+	var raw, ssd1306PBM bytes.Buffer
+	opts := Options{Width: 12, Height: 8, Layout: LayoutSSD1306}
+	if err := ConvertReader(bytes.NewReader(encoded.Bytes()), &raw, opts); err != nil {
+		t.Fatal(err)
+	}
+	if repacked, err := Repack(12, 8, want, LayoutBadger, LayoutSSD1306); err != nil || !bytes.Equal(raw.Bytes(), repacked) {
+		t.Errorf("ssd1306: expected % x, got % x (%v)", repacked, raw.Bytes(), err)
+	}
+	opts.Encoding = EncodingPBM
+	if err := ConvertReader(bytes.NewReader(encoded.Bytes()), &ssd1306PBM, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(ssd1306PBM.Bytes(), pbm) {
+		t.Errorf("ssd1306: expected the PBM file of the badge's layout, got %q", ssd1306PBM.Bytes())
+	}
+}
+
+func TestConvertReaderErrors(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, uniform(8, 8, color.White)); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name string
+		data []byte
+		opts Options
+		want []error
+	}{
+		{"not an image", []byte("not an image"), Options{Width: 8, Height: 8}, []error{ErrDecode, ErrUnsupportedFormat, image.ErrFormat}},
+		{"truncated", encoded.Bytes()[:40], Options{Width: 8, Height: 8}, []error{ErrDecode}},
+		{"bad size", encoded.Bytes(), Options{Width: 3, Height: 3}, []error{ErrConvert, ErrSize}},
+		{"bad dither", encoded.Bytes(), Options{Width: 8, Height: 8, Dither: "sparkle"}, []error{ErrConvert, ErrUnknownDither}},
+	} {
+		err := ConvertReader(bytes.NewReader(test.data), &bytes.Buffer{}, test.opts)
+		for _, want := range test.want {
+			if !errors.Is(err, want) {
+				t.Errorf("%s: expected %v, got %v", test.name, want, err)
+			}
+		}
+	}
+	for _, encoding := range []Encoding{EncodingRaw, EncodingBase64, EncodingPBM} {
+		err := ConvertReader(bytes.NewReader(encoded.Bytes()), failingWriter{}, Options{Width: 8, Height: 8, Encoding: encoding})
+		if !errors.Is(err, ErrWrite) || errors.Is(err, ErrDecode) || errors.Is(err, ErrConvert) {
+			t.Errorf("encoding %d: expected ErrWrite alone, got %v", encoding, err)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// -batch-file lists the inputs of a batch in a file rather than on the
+// command line, each with flags of its own for the images a single set of
+// flags doesn't suit. It is a CSV file whose first row names its columns, or
+// a JSON array of objects keyed by the same names, when it ends in .json:
+//
+//	input      the image, the only column that must be set
+//	ratio      -ratio
+//	threshold  -threshold, a luminance or auto
+//	invert     -invert, true or false
+//	output     -o, what the image is written to
+//
+// An empty or missing value keeps the flag given on the command line, and
+// paths are relative to the batch file. Rows are converted as inputs given on
+// the command line are, named after their output or else their input, so
+// that rows converting the same source with other settings only need an
+// output of their own. A value that can't be used fails the whole batch
+// before anything is converted, naming its row.
+
+// batchColumns are the columns of a -batch-file
+var batchColumns = []string{"input", "ratio", "threshold", "invert", "output"}
+
+// batchRow is a row of a -batch-file, its values by column
+type batchRow map[string]string
+
+// readBatchFile reads the -batch-file at path
+func readBatchFile(path string) ([]batchRow, error) {
+	data, err := ReadInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading -batch-file: %w", err)
+	}
+	read := readBatchCSV
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		read = readBatchJSON
+	}
+	rows, err := read(data)
+	if err != nil {
+		return nil, usagef("error: -batch-file %s: %v", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, usagef("error: -batch-file %s has no rows", path)
+	}
+	for i, row := range rows {
+		for column := range row {
+			if !slices.Contains(batchColumns, column) {
+				return nil, usagef("error: -batch-file %s row %d: unknown column `%s`, use: %s", path, i+1, column, strings.Join(batchColumns, ", "))
+			}
+		}
+		if row["input"] == "" {
+			return nil, usagef("error: -batch-file %s row %d has no input", path, i+1)
+		}
+	}
+	return rows, nil
+}
+
+// readBatchCSV reads the rows of a CSV -batch-file, below the names of its
+// columns
+func readBatchCSV(data []byte) ([]batchRow, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	columns, err := r.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("the file is empty, its first row must name its columns")
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rows []batchRow
+	for n := 1; ; n++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) > len(columns) {
+			return nil, fmt.Errorf("row %d has %d values, there are %d columns", n, len(record), len(columns))
+		}
+		row := make(batchRow, len(record))
+		for i, value := range record {
+			row[strings.TrimSpace(columns[i])] = strings.TrimSpace(value)
+		}
+		rows = append(rows, row)
+	}
+}
+
+// readBatchJSON reads the rows of a JSON -batch-file, whose values may be
+// strings, numbers or booleans
+func readBatchJSON(data []byte) ([]batchRow, error) {
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &objects); err != nil {
+		return nil, err
+	}
+	rows := make([]batchRow, len(objects))
+	for i, object := range objects {
+		rows[i] = make(batchRow, len(object))
+		for column, raw := range object {
+			var value any
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, fmt.Errorf("row %d: %s: %w", i+1, column, err)
+			}
+			switch value := value.(type) {
+			case string:
+				rows[i][column] = strings.TrimSpace(value)
+			case float64, bool:
+				rows[i][column] = string(raw)
+			case nil:
+			default:
+				return nil, fmt.Errorf("row %d: %s must be a string, a number or a boolean, not %s", i+1, column, raw)
+			}
+		}
+	}
+	return rows, nil
+}
+
+// batchInputs returns the inputs of the -batch-file, each converted with the
+// options of its row
+func (o *Options) batchInputs() ([]Input, error) {
+	rows, err := readBatchFile(o.BatchFile)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(o.BatchFile)
+	inputs := make([]Input, len(rows))
+	for i, row := range rows {
+		opts, x, y, err := o.rowOptions(row, dir)
+		if err != nil {
+			return nil, usagef("error: -batch-file %s row %d: %v", o.BatchFile, i+1, unprefixed(err))
+		}
+		in := Input{Path: batchPath(dir, row["input"]), Options: opts, X: x, Y: y}
+		// a lone row keeps the outputs named after the ratio alone
+		switch {
+		case opts.Output != "":
+			in.Name = inputName(opts.Output)
+		case len(rows) > 1:
+			in.Name = inputName(in.Path)
+		}
+		inputs[i] = in
+	}
+	return inputs, nil
+}
+
+// rowOptions returns a copy of o with the flags row sets, checked as the
+// command line is, and the size of its ratio. Paths are relative to dir.
+func (o *Options) rowOptions(row batchRow, dir string) (*Options, int, int, error) {
+	opts := *o
+	if v := row["ratio"]; v != "" {
+		opts.Ratio = v
+	}
+	if v := row["threshold"]; v != "" {
+		threshold, err := parseThreshold(v)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("invalid threshold `%s`: %w", v, err)
+		}
+		opts.Threshold = threshold
+	}
+	if v := row["invert"]; v != "" {
+		invert, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, 0, 0, fmt.Errorf("invert must be true or false, not `%s`", v)
+		}
+		opts.Invert = invert
+	}
+	if v := row["output"]; v != "" {
+		opts.Output = batchPath(dir, v)
+	}
+	if err := checkImage(&opts); err != nil {
+		return nil, 0, 0, err
+	}
+	x, y, err := ratioSizes(&opts)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	if err := checkConvert(&opts); err != nil {
+		return nil, 0, 0, err
+	}
+	return &opts, x, y, nil
+}
+
+// batchPath returns path, from a -batch-file in dir, relative to dir unless
+// it is absolute, a URL or stdin
+func batchPath(dir, path string) string {
+	if filepath.IsAbs(path) || IsURL(path) || path == stdinName {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
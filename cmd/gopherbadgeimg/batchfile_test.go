@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBatchFile(t *testing.T) {
+	src, err := filepath.Abs("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	writeCheckerboard(t, filepath.Join(dir, "board.png"), 16, 16, 2, 2)
+	// what each row should write, converted on its own with the same flags
+	want := func(name string, args ...string) []byte {
+		t.Helper()
+		out := filepath.Join(t.TempDir(), name)
+		args = append([]string{"-outmode", "bin", "-ratio", "profile", "-o", out}, args...)
+		if code, _, errOut := runCLI(t, args...); code != 0 {
+			t.Fatalf("%v: exit code %d: %s", args, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	outputs := map[string][]byte{
+		// the same source twice, with settings of their own
+		"inverted.bin": want("inverted.bin", "-invert", src),
+		"light.bin":    want("light.bin", "-threshold", "200", src),
+		// named after its input and the ratio of its row
+		"board-16x16.bin": want("board.bin", "-ratio", "16x16", filepath.Join(dir, "board.png")),
+	}
+
+	for _, test := range []struct {
+		name, content string
+	}{
+		{"jobs.csv", "input,ratio,threshold,invert,output\n" +
+			src + ",,,true,inverted.bin\n" +
+			src + ",,200,,light.bin\n" +
+			"board.png,16x16\n"},
+		{"jobs.json", `[
+			{"input": "` + src + `", "invert": true, "output": "inverted.bin"},
+			{"input": "` + src + `", "threshold": 200, "output": "light.bin"},
+			{"input": "board.png", "ratio": "16x16", "threshold": null}
+		]`},
+	} {
+		dir := dir
+		if test.name == "jobs.json" {
+			// in a directory of its own, whose board the row finds
+			dir = t.TempDir()
+			writeCheckerboard(t, filepath.Join(dir, "board.png"), 16, 16, 2, 2)
+		}
+		jobs := filepath.Join(dir, test.name)
+		if err := os.WriteFile(jobs, []byte(test.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "profile", "-batch-file", jobs); code != 0 {
+			t.Fatalf("%s: exit code %d: %s", test.name, code, errOut)
+		}
+		for name, data := range outputs {
+			got, err := os.ReadFile(filepath.Join(dir, name))
+			if err != nil {
+				t.Errorf("%s: %v", test.name, err)
+				continue
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s: expected %s to be converted as its row says", test.name, name)
+			}
+		}
+	}
+}
+
+func TestBatchFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeCheckerboard(t, filepath.Join(dir, "board.png"), 16, 16, 2, 2)
+	for _, test := range []struct {
+		name, content string
+		args          []string
+		want          string
+	}{
+		{"threshold.csv", "input,threshold\nboard.png,128\nboard.png,300\n", nil, "row 2: -threshold must be between 1 and 255"},
+		{"luminance.csv", "input,threshold\nboard.png,dark\n", nil, "row 1: invalid threshold `dark`"},
+		{"invert.json", `[{"input": "board.png", "invert": "maybe"}]`, nil, "row 1: invert must be true or false, not `maybe`"},
+		{"column.csv", "input,dither\nboard.png,atkinson\n", nil, "row 1: unknown column `dither`"},
+		{"input.csv", "input,ratio\n,16x16\n", nil, "row 1 has no input"},
+		{"ratio.csv", "input,ratio\nboard.png,16x16\nboard.png,\n", []string{"-ratio", ""}, "row 2: a ratio must be provided"},
+		{"values.csv", "input\nboard.png,16x16\n", nil, "row 1 has 2 values, there are 1 columns"},
+		{"object.json", `[{"input": ["board.png"]}]`, nil, "row 1: input must be a string, a number or a boolean"},
+		{"empty.json", `[]`, nil, "has no rows"},
+		{"args.csv", "input\nboard.png\n", []string{"board.png"}, "-batch-file lists the inputs"},
+		{"single.csv", "input\nboard.png\nboard.png\n", []string{"-outmode", "bin", "-o", "out.bin"}, "-o can't be used with 2 inputs"},
+	} {
+		jobs := filepath.Join(dir, test.name)
+		if err := os.WriteFile(jobs, []byte(test.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		args := append([]string{"-outmode", "none", "-ratio", "16x16", "-batch-file", jobs}, test.args...)
+		if code, _, errOut := runCLI(t, args...); code != exitUsage || !strings.Contains(errOut, test.want) {
+			t.Errorf("%s: expected exit code %d and %q, got %d: %s", test.name, exitUsage, test.want, code, errOut)
+		}
+	}
+
+	// the same source and ratio twice needs an output of its own
+	jobs := filepath.Join(dir, "twice.csv")
+	if err := os.WriteFile(jobs, []byte("input,invert\nboard.png,true\nboard.png,false\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "16x16", "-strict-names", "-batch-file", jobs)
+	if code == 0 || !strings.Contains(errOut, "board-16x16 is already written by "+filepath.Join(dir, "board")) {
+		t.Errorf("expected the second row to clash with the first, got %d: %s", code, errOut)
+	}
+	// or else be renamed
+	code, _, errOut = runCLI(t, "-outmode", "bin", "-ratio", "16x16", "-batch-file", jobs)
+	if _, err := os.Stat(filepath.Join(dir, "board_2-16x16.bin")); code != 0 || err != nil {
+		t.Errorf("expected the second row to be written as board_2, got %d, %v: %s", code, err, errOut)
+	}
+}
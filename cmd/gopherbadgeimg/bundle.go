@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// bundleSource declares what every -bundle file holds besides its images
+const bundleSource = `// Asset is an image converted by gopherbadgeimg
+type Asset struct {
+	// Data holds the packed pixels
+	Data []byte
+	// W and H are the size of the image, in pixels
+	W, H int
+}
+
+// LookupAsset returns the image bundled as name
+func LookupAsset(name string) (Asset, error) {
+	asset, ok := Assets[name]
+	if !ok {
+		return Asset{}, errors.New("unknown asset " + strconv.Quote(name))
+	}
+	return asset, nil
+}
+`
+
+// bundleEntry is an image of a -bundle file, or a frame of a slideshow
+type bundleEntry struct {
+	key  string
+	data []byte
+	x, y int
+}
+
+// bundleKey returns the name an input is bundled as: its file name without
+// extension, or the name it was given, with anything but ASCII letters,
+// digits and underscores turned into underscores
+func bundleKey(in Input) string {
+	return identifier(filepath.Base(cmp.Or(in.Name, inputName(in.Path))))
+}
+
+// bundleKeys returns the names an input is bundled as, one per ratio listed
+// in -ratio: its bundleKey, followed by the ratio when there are several
+func (o *Options) bundleKeys(in Input) []string {
+	ratios := strings.Split(o.Ratio, ",")
+	if len(ratios) == 1 {
+		return []string{bundleKey(in)}
+	}
+	keys := make([]string, len(ratios))
+	for i, ratio := range ratios {
+		keys[i] = bundleKey(in) + "_" + identifier(ratio)
+	}
+	return keys
+}
+
+// bundleConstName returns the name the constants of the image bundled as key
+// start with: key in camel case, bob_2 giving Bob2Width for instance
+func bundleConstName(key string) string {
+	return exportedName(key)
+}
+
+// fprintBundle writes the -bundle file of entries to w, starting with header:
+// the Asset type, the Assets map holding the entries by name, LookupAsset,
+// and constants giving the size and length of each entry (see
+// bundleConstName) and the layout of all of them
+func fprintBundle(w io.Writer, header, pkg, layout, bitOrder string, entries []bundleEntry) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%spackage %s\n\nimport (\n\t\"errors\"\n\t\"strconv\"\n)\n\n%s", header, pkg, bundleSource)
+	b.WriteString("\n// Assets holds the bundled images, by name\nvar Assets = map[string]Asset{\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "\t%q: {W: %d, H: %d, Data: []byte{", entry.key, entry.x, entry.y)
+		for i, v := range entry.data {
+			if i%16 == 0 {
+				b.WriteString("\n\t\t")
+			} else {
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(&b, "0x%02X,", v)
+		}
+		b.WriteString("\n\t}},\n")
+	}
+	b.WriteString("}\n")
+	var sizes []goConst
+	for _, entry := range entries {
+		name := bundleConstName(entry.key)
+		sizes = append(sizes,
+			goConst{name + "Width", strconv.Itoa(entry.x)},
+			goConst{name + "Height", strconv.Itoa(entry.y)},
+			goConst{name + "Len", strconv.Itoa(len(entry.data))},
+		)
+	}
+	if len(sizes) > 0 {
+		if err := fprintGoConsts(&b, "The size of each bundled image in pixels, and the length of its data in bytes", sizes); err != nil {
+			return err
+		}
+	}
+	err := fprintGoConsts(&b, "AssetLayout and AssetBitOrder are how the pixels of the bundled images are packed", []goConst{
+		{"AssetLayout", strconv.Quote(layout)},
+		{"AssetBitOrder", strconv.Quote(bitOrder)},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// writeBundle writes the -bundle file of the entries converted, sorted by
+// name so that the file doesn't depend on the order of the inputs, creating
+// its directory if needed
+func (o *Options) writeBundle(path string, entries []bundleEntry) error {
+	if dir := filepath.Dir(path); dir != "." && !o.Verify {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return classify(badgeimg.ErrWrite, err)
+		}
+	}
+	slices.SortFunc(entries, func(a, b bundleEntry) int {
+		return strings.Compare(a.key, b.key)
+	})
+	return o.writeFile(path, func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := fprintBundle(&buf, o.generatedHeader("//", "//go:generate ", filepath.Dir(path)), o.goPackage(), o.layoutName(), o.bitOrderName(), entries); err != nil {
+			return err
+		}
+		src, err := format.Source(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(src)
+		return err
+	})
+}
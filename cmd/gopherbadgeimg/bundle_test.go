@@ -0,0 +1,99 @@
+package main
+
+import (
+	"go/format"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"alice.png", "bob-2.png", "carol.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), png, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bundle := filepath.Join(dir, "assets", "assets.go")
+	code, _, errOut := runCLI(t, "-outmode", "rice", "-ratio", "profile", "-pkg", "assets", "-bundle", bundle, filepath.Join(dir, "*.png"))
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	src, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted, err := format.Source(src); err != nil || string(formatted) != string(src) {
+		t.Errorf("expected the bundle to be gofmt clean, got\n%s", src)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*-generated.go")); len(matches) != 0 {
+		t.Errorf("expected no file per input, got %v", matches)
+	}
+
+	out := runGoModule(t, map[string]string{
+		"assets/assets.go": string(src),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/badge/assets"
+)
+
+func main() {
+	for _, name := range []string{"alice", "bob_2", "carol"} {
+		asset, err := assets.LookupAsset(name)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(name, len(asset.Data), asset.W*asset.H/8)
+	}
+	_, err := assets.LookupAsset("dave")
+	fmt.Println(len(assets.Assets), err)
+	fmt.Println(assets.AliceLen == len(assets.Assets["alice"].Data), assets.Bob2Width, assets.CarolHeight, assets.AssetLayout, assets.AssetBitOrder)
+}
+`,
+	})
+	want := "alice 1920 1920\nbob_2 1920 1920\ncarol 1920 1920\n3 unknown asset \"dave\"\ntrue 120 128 badger msb-first\n"
+	if out != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, out)
+	}
+
+	// my-icon and my_icon would both be bundled as my_icon
+	for _, name := range []string{"my-icon.png", "my_icon.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), png, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code, _, errOut = runCLI(t, "-outmode", "rice", "-ratio", "profile", "-bundle", bundle, "-strict-names", filepath.Join(dir, "my*.png"))
+	if code != 5 || !strings.Contains(errOut, "would be bundled as my_icon") {
+		t.Errorf("expected exit code 5 and the clash to be reported, got %d and\n%s", code, errOut)
+	}
+	// bob-2 and bob2 are bundled as bob_2 and bob2, which would both declare
+	// Bob2Width
+	if err := os.WriteFile(filepath.Join(dir, "bob2.png"), png, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, errOut = runCLI(t, "-outmode", "rice", "-ratio", "profile", "-bundle", bundle, "-strict-names", filepath.Join(dir, "bob*.png"))
+	if code != 5 || !strings.Contains(errOut, "would declare Bob2Width in the bundle") {
+		t.Errorf("expected exit code 5 and the constant clash to be reported, got %d and\n%s", code, errOut)
+	}
+
+	for _, args := range [][]string{
+		{"-outmode", "bin"},
+		{"-var", "icons"},
+		{"-export"},
+		{"-compress", "rle"},
+		{"-o", "icons.go"},
+	} {
+		args = append([]string{"-outmode", "rice", "-bundle", bundle, "-ratio", "profile"}, append(args, "testdata/tainigo_128.png")...)
+		if code, _, errOut := runCLI(t, args...); code != 2 || !strings.Contains(errOut, "error: -") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+}
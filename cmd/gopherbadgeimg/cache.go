@@ -0,0 +1,296 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+)
+
+// -cache-dir keeps the packed data of every conversion in a file of its own,
+// named after the SHA-256 of the source bytes and of everything deciding how
+// they are converted (see cacheKey), so that converting the same image the
+// same way again skips decoding and dithering. An entry is laid out as:
+//
+//	magic  "GBIC"
+//	width  uint16, little-endian, as every number below
+//	height uint16
+//	cells  uint8, 1 for the cells of -grid or -tile, which have no delays
+//	count  uint16, the number of frames
+//	frames count times: delay int32 (in milliseconds), length uint32, data
+//	crc    uint32, the CRC32 (IEEE) of everything before it
+//
+// Entries that don't parse or match their CRC32, such as the ones a full disk
+// truncated, are misses, and are replaced.
+const cacheMagic = "GBIC"
+
+// cacheExt is the extension of cache entries, the only files -cache-clear and
+// the eviction remove
+const cacheExt = ".gbic"
+
+// Cache is the directory of -cache-dir
+type Cache struct {
+	Dir string
+	// MaxSize is how many bytes the entries may take in all, and MaxAge how
+	// long an entry is kept once it was last used; 0 is no limit. The least
+	// recently used entries are evicted first.
+	MaxSize int64
+	MaxAge  time.Duration
+}
+
+// cacheEntry is the packed data of a conversion, as convertFrames writes it
+type cacheEntry struct {
+	X, Y   int
+	Frames [][]byte
+	// Delays are the delays of the frames of an animation, nil for the
+	// cells of a sheet
+	Delays []int
+}
+
+// cacheSlot is where a conversion is cached: under key, hit being what was
+// found there, if anything. The zero value caches nothing.
+type cacheSlot struct {
+	key string
+	hit *cacheEntry
+}
+
+// cacheable reports whether the conversion of in can be cached: drawn inputs
+// are cheap to draw again, and -compare and -palette-report need the decoded
+// image
+func (o *Options) cacheable(in Input) bool {
+	return o.Cache != nil && in.Draw == nil && o.Compare == "" && o.PaletteReport == ""
+}
+
+// cacheKey returns the key of the conversion of the source data to x by y:
+// the SHA-256 of data and of every option changing the packed data, along
+// with the build, since a new version may convert differently
+func (o *Options) cacheKey(data []byte, x, y int) string {
+	h := sha256.New()
+	fmt.Fprintln(h, toolVersion())
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" || s.Key == "vcs.modified" {
+				fmt.Fprintln(h, s.Key, s.Value)
+			}
+		}
+	}
+	fmt.Fprintln(h, x, y, o.DisableDithering, o.Invert, o.Dither, o.Threshold, o.FrameIndex, o.Frames, o.DedupeFrames, o.Grid, o.Tile, o.Region, o.Marquee, o.MarqueeStep, o.MarqueeWrap, o.Raw)
+	fmt.Fprintln(h, o.DitherMatrix, o.Linear, o.Anchor, o.Gamma, o.NoUpscale, o.FrameDelay, o.Speed)
+	fmt.Fprintln(h, o.Palette.Name, o.Palette.Codes, o.Palette.Depth, o.Palette.RowMajor)
+	for _, c := range o.Palette.Colors {
+		fmt.Fprintln(h, color.RGBA64Model.Convert(c))
+	}
+	if o.Background != nil {
+		fmt.Fprintln(h, color.RGBA64Model.Convert(o.Background))
+	}
+	for _, overlay := range o.Overlays {
+		fmt.Fprintln(h, overlay.X, overlay.Y, overlay.Scale)
+		hashImage(h, overlay.Image)
+	}
+	fmt.Fprintf(h, "%d\n", len(data))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashImage writes the size and pixels of img to w
+func hashImage(w io.Writer, img image.Image) {
+	bounds := img.Bounds()
+	fmt.Fprintln(w, bounds)
+	pixel := make([]byte, 0, 8)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			pixel = binary.LittleEndian.AppendUint16(pixel[:0], uint16(r))
+			pixel = binary.LittleEndian.AppendUint16(pixel, uint16(g))
+			pixel = binary.LittleEndian.AppendUint16(pixel, uint16(b))
+			pixel = binary.LittleEndian.AppendUint16(pixel, uint16(a))
+			w.Write(pixel)
+		}
+	}
+}
+
+// path returns the path of the entry of key
+func (c *Cache) path(key string) string {
+	return filepath.Join(c.Dir, key+cacheExt)
+}
+
+// Load returns the entry of key, or nil when there is none or it is corrupt.
+// An entry that is used is touched, so that it is evicted last.
+func (c *Cache) Load(key string) *cacheEntry {
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil
+	}
+	entry, err := decodeCacheEntry(data)
+	if err != nil {
+		logger.Debugf("ignoring the cache entry %s: %v", c.path(key), err)
+		return nil
+	}
+	now := time.Now()
+	os.Chtimes(c.path(key), now, now)
+	return entry
+}
+
+// Store writes the entry of key, through a temporary file renamed into place
+// so that workers converting the same image at the same time never see half
+// of an entry
+func (c *Cache) Store(key string, entry *cacheEntry) (err error) {
+	if err := os.MkdirAll(c.Dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.Dir, "."+key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(encodeCacheEntry(entry)); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(key))
+}
+
+// encodeCacheEntry returns the bytes of the cache entry e
+func encodeCacheEntry(e *cacheEntry) []byte {
+	data := []byte(cacheMagic)
+	data = binary.LittleEndian.AppendUint16(data, uint16(e.X))
+	data = binary.LittleEndian.AppendUint16(data, uint16(e.Y))
+	cells := byte(0)
+	if e.Delays == nil {
+		cells = 1
+	}
+	data = append(data, cells)
+	data = binary.LittleEndian.AppendUint16(data, uint16(len(e.Frames)))
+	for i, frame := range e.Frames {
+		delay := 0
+		if e.Delays != nil {
+			delay = e.Delays[i]
+		}
+		data = binary.LittleEndian.AppendUint32(data, uint32(int32(delay)))
+		data = binary.LittleEndian.AppendUint32(data, uint32(len(frame)))
+		data = append(data, frame...)
+	}
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+// errCacheEntry is returned for cache entries that are corrupt or truncated
+var errCacheEntry = errors.New("corrupt cache entry")
+
+// decodeCacheEntry parses the bytes of a cache entry, checking its CRC32
+func decodeCacheEntry(data []byte) (*cacheEntry, error) {
+	if len(data) < len(cacheMagic)+11 || string(data[:len(cacheMagic)]) != cacheMagic {
+		return nil, fmt.Errorf("%w: not a cache entry", errCacheEntry)
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch, the entry is truncated or damaged", errCacheEntry)
+	}
+	e := &cacheEntry{
+		X: int(binary.LittleEndian.Uint16(body[4:])),
+		Y: int(binary.LittleEndian.Uint16(body[6:])),
+	}
+	cells := body[8] == 1
+	n := int(binary.LittleEndian.Uint16(body[9:]))
+	rest := body[11:]
+	for range n {
+		if len(rest) < 8 {
+			return nil, fmt.Errorf("%w: %d frames announced, the data ends after %d", errCacheEntry, n, len(e.Frames))
+		}
+		delay := int(int32(binary.LittleEndian.Uint32(rest)))
+		size := int(binary.LittleEndian.Uint32(rest[4:]))
+		if len(rest)-8 < size {
+			return nil, fmt.Errorf("%w: frame %d is %d bytes, only %d are left", errCacheEntry, len(e.Frames), size, len(rest)-8)
+		}
+		e.Frames = append(e.Frames, rest[8:8+size])
+		if !cells {
+			e.Delays = append(e.Delays, delay)
+		}
+		rest = rest[8+size:]
+	}
+	if len(rest) != 0 || n == 0 {
+		return nil, fmt.Errorf("%w: %d frames and %d bytes left over", errCacheEntry, n, len(rest))
+	}
+	return e, nil
+}
+
+// entries returns the entries of the cache, the least recently used first
+func (c *Cache) entries() ([]os.FileInfo, error) {
+	dirEntries, err := os.ReadDir(c.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var infos []os.FileInfo
+	for _, d := range dirEntries {
+		if !d.Type().IsRegular() || !strings.HasSuffix(d.Name(), cacheExt) {
+			continue
+		}
+		if info, err := d.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	slices.SortFunc(infos, func(a, b os.FileInfo) int {
+		return a.ModTime().Compare(b.ModTime())
+	})
+	return infos, nil
+}
+
+// Clear removes every entry of the cache, and returns how many there were
+func (c *Cache) Clear() (int, error) {
+	infos, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+	for _, info := range infos {
+		if err := os.Remove(filepath.Join(c.Dir, info.Name())); err != nil {
+			return 0, err
+		}
+	}
+	return len(infos), nil
+}
+
+// Evict removes the entries unused for longer than MaxAge, then the least
+// recently used ones until the rest take at most MaxSize bytes, and returns
+// how many it removed
+func (c *Cache) Evict() (int, error) {
+	infos, err := c.entries()
+	if err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, info := range infos {
+		total += info.Size()
+	}
+	removed := 0
+	for _, info := range infos {
+		expired := c.MaxAge > 0 && time.Since(info.ModTime()) > c.MaxAge
+		if !expired && (c.MaxSize <= 0 || total <= c.MaxSize) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.Dir, info.Name())); err != nil {
+			return removed, err
+		}
+		total -= info.Size()
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const cacheHit = "reusing the cached conversion"
+
+// cacheEntries returns the paths of the entries in dir
+func cacheEntries(t *testing.T, dir string) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+cacheExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return paths
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	cacheDir := filepath.Join(dir, "cache")
+	convert := func(args ...string) (string, []byte) {
+		t.Helper()
+		out := filepath.Join(dir, "out.bin")
+		os.Remove(out)
+		args = append([]string{"-v", "-cache-dir", cacheDir, "-outmode", "bin", "-o", out}, args...)
+		code, _, errOut := runCLI(t, append(args, "testdata/tainigo_128.png")...)
+		if code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d and\n%s", args, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return errOut, data
+	}
+
+	errOut, want := convert("-ratio", "32x32")
+	if strings.Contains(errOut, cacheHit) || len(cacheEntries(t, cacheDir)) != 1 {
+		t.Fatalf("expected the first run to miss and store an entry, got\n%s", errOut)
+	}
+	errOut, got := convert("-ratio", "32x32")
+	if !strings.Contains(errOut, cacheHit) || strings.Contains(errOut, "dithering with") {
+		t.Errorf("expected the second run to hit without dithering, got\n%s", errOut)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("expected the cached conversion to write the same bytes")
+	}
+
+	// every option changing the data misses
+	for _, args := range [][]string{
+		{"-ratio", "64x64"},
+		{"-ratio", "32x32", "-invert"},
+		{"-ratio", "32x32", "-dither", "atkinson"},
+		{"-ratio", "32x32", "-disable-dithering"},
+		{"-ratio", "32x32", "-threshold", "100"},
+		{"-ratio", "32x32", "-background", "#ffffff"},
+		{"-ratio", "32x32", "-colors", "acep"},
+		{"-ratio", "32x32", "-region", "16x16+8+8"},
+	} {
+		if errOut, _ := convert(args...); strings.Contains(errOut, cacheHit) {
+			t.Errorf("%v: expected a miss, got\n%s", args, errOut)
+		}
+	}
+	// while options that only change how the data is written hit
+	if errOut, _ := convert("-ratio", "32x32", "-header"); !strings.Contains(errOut, cacheHit) {
+		t.Errorf("-header: expected a hit, got\n%s", errOut)
+	}
+
+	// a truncated entry is a miss, and is replaced
+	entries := cacheEntries(t, cacheDir)
+	for _, path := range entries {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data[:len(data)/2], 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	errOut, got = convert("-ratio", "32x32")
+	if strings.Contains(errOut, cacheHit) || !strings.Contains(errOut, "ignoring the cache entry") {
+		t.Errorf("expected a truncated entry to be a miss, got\n%s", errOut)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("expected a truncated entry to be converted again")
+	}
+	if errOut, _ := convert("-ratio", "32x32"); !strings.Contains(errOut, cacheHit) {
+		t.Errorf("expected the truncated entry to be replaced, got\n%s", errOut)
+	}
+
+	code, _, errOut := runCLI(t, "-cache-dir", cacheDir, "-cache-clear")
+	if code != 0 || len(cacheEntries(t, cacheDir)) != 0 {
+		t.Errorf("expected -cache-clear to empty the cache, got %d, %d entries and\n%s", code, len(cacheEntries(t, cacheDir)), errOut)
+	}
+	if code, _, _ := runCLI(t, "-cache-clear"); code != exitUsage {
+		t.Errorf("expected -cache-clear without -cache-dir to be refused, got %d", code)
+	}
+}
+
+func TestCacheEvict(t *testing.T) {
+	c := &Cache{Dir: t.TempDir()}
+	entry := &cacheEntry{X: 8, Y: 8, Frames: [][]byte{make([]byte, 8)}, Delays: []int{0}}
+	now := time.Now()
+	for i, key := range []string{"old", "older", "oldest"} {
+		if err := c.Store(key, entry); err != nil {
+			t.Fatal(err)
+		}
+		used := now.Add(-time.Duration(i+1) * time.Hour)
+		if err := os.Chtimes(c.path(key), used, used); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := int64(len(encodeCacheEntry(entry)))
+
+	// the entries unused for too long go first
+	c.MaxAge = 150 * time.Minute
+	if n, err := c.Evict(); err != nil || n != 1 || c.Load("oldest") != nil {
+		t.Errorf("expected the oldest entry to be evicted, got %d and %v", n, err)
+	}
+	// then the least recently used ones, down to the size limit
+	c.MaxAge, c.MaxSize = 0, size
+	if n, err := c.Evict(); err != nil || n != 1 || c.Load("older") != nil || c.Load("old") == nil {
+		t.Errorf("expected the least recently used entry to be evicted, got %d and %v", n, err)
+	}
+}
+
+func TestCacheEntry(t *testing.T) {
+	for _, entry := range []*cacheEntry{
+		{X: 8, Y: 16, Frames: [][]byte{{1, 2}, {3, 4}}, Delays: []int{100, 200}},
+		{X: 8, Y: 8, Frames: [][]byte{{5}, {6}}},
+	} {
+		data := encodeCacheEntry(entry)
+		got, err := decodeCacheEntry(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.X != entry.X || got.Y != entry.Y || len(got.Frames) != len(entry.Frames) || !bytes.Equal(got.Frames[1], entry.Frames[1]) || (got.Delays == nil) != (entry.Delays == nil) {
+			t.Errorf("expected %+v, got %+v", entry, got)
+		}
+		for n := range len(data) {
+			if _, err := decodeCacheEntry(data[:n]); err == nil {
+				t.Errorf("expected %d of the %d bytes to be refused", n, len(data))
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// FprintCHeader writes packed images as a C header, for firmware that isn't
+// written in Go.
+//
+// A single image is a `static const uint8_t name[]`, several frames a
+// two-dimensional array along with a name_delays array in milliseconds, if
+// there are delays (sheet cells have none). The
+// NAME_WIDTH, NAME_HEIGHT and NAME_SIZE macros (plus NAME_FRAMES for
+// animations) describe the data, and with progmem the arrays are placed in
+// flash on AVR boards. The header starts with header.
+func FprintCHeader(w io.Writer, header, name string, x, y int, frames [][]byte, delays []int, progmem bool) error {
+	macro := strings.ToUpper(name)
+	attr := ""
+	if progmem {
+		attr = " PROGMEM"
+	}
+
+	var b strings.Builder
+	b.WriteString(header)
+	fmt.Fprintf(&b, "#ifndef %s_H\n#define %s_H\n\n#include <stdint.h>\n", macro, macro)
+	if progmem {
+		b.WriteString("#if defined(__AVR__)\n#include <avr/pgmspace.h>\n#endif\n#ifndef PROGMEM\n#define PROGMEM\n#endif\n")
+	}
+	fmt.Fprintf(&b, "\n#define %s_WIDTH %d\n#define %s_HEIGHT %d\n#define %s_SIZE %d\n", macro, x, macro, y, macro, len(frames[0]))
+	if len(frames) > 1 {
+		fmt.Fprintf(&b, "#define %s_FRAMES %d\n", macro, len(frames))
+	}
+
+	writeBytes := func(data []byte, indent string) {
+		for i, v := range data {
+			switch {
+			case i%16 == 0:
+				b.WriteString("\n" + indent)
+			default:
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(&b, "0x%02X,", v)
+		}
+		b.WriteString("\n")
+	}
+	if len(frames) == 1 {
+		fmt.Fprintf(&b, "\nstatic const uint8_t %s[%s_SIZE]%s = {", name, macro, attr)
+		writeBytes(frames[0], "\t")
+		b.WriteString("};\n")
+	} else {
+		fmt.Fprintf(&b, "\nstatic const uint8_t %s[%s_FRAMES][%s_SIZE]%s = {", name, macro, macro, attr)
+		for _, frame := range frames {
+			b.WriteString("\n\t{")
+			writeBytes(frame, "\t\t")
+			b.WriteString("\t},")
+		}
+		b.WriteString("\n};\n")
+	}
+	if len(frames) > 1 && delays != nil {
+		fmt.Fprintf(&b, "\n// how long each frame is shown, in milliseconds\nstatic const uint16_t %s_delays[%s_FRAMES]%s = {", name, macro, attr)
+		for i, d := range delays {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%d", d)
+		}
+		b.WriteString("};\n")
+	}
+	fmt.Fprintf(&b, "\n#endif // %s_H\n", macro)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
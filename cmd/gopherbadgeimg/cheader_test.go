@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCHeader(t *testing.T) {
+	imgBits := make([]byte, 120*128/8)
+	for i := range imgBits {
+		imgBits[i] = byte(i)
+	}
+	var buf bytes.Buffer
+	if err := FprintCHeader(&buf, "", variableName("speakers/alice-profile"), 120, 128, [][]byte{imgBits}, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	header := buf.String()
+
+	for _, pattern := range []string{
+		`(?m)^#ifndef SPEAKERS_ALICE_PROFILE_H\n#define SPEAKERS_ALICE_PROFILE_H$`,
+		`(?m)^#endif // SPEAKERS_ALICE_PROFILE_H\n$`,
+		`(?m)^#define SPEAKERS_ALICE_PROFILE_WIDTH 120$`,
+		`(?m)^#define SPEAKERS_ALICE_PROFILE_HEIGHT 128$`,
+		`(?m)^#define SPEAKERS_ALICE_PROFILE_SIZE 1920$`,
+		`(?m)^static const uint8_t speakers_alice_profile\[SPEAKERS_ALICE_PROFILE_SIZE\] PROGMEM = \{$`,
+		`(?m)^#include <avr/pgmspace.h>$`,
+	} {
+		if !regexp.MustCompile(pattern).MatchString(header) {
+			t.Errorf("expected the header to match %s", pattern)
+		}
+	}
+
+	// 16 bytes per line, every byte of the image in order
+	lines := regexp.MustCompile(`(?m)^\t(0x[0-9A-F]{2},(?: 0x[0-9A-F]{2},)*)$`).FindAllStringSubmatch(header, -1)
+	var values []string
+	for i, line := range lines {
+		bytesOnLine := strings.Split(line[1], " ")
+		if len(bytesOnLine) != 16 && i != len(lines)-1 {
+			t.Errorf("line %d: expected 16 bytes, got %d", i, len(bytesOnLine))
+		}
+		values = append(values, bytesOnLine...)
+	}
+	if len(values) != len(imgBits) {
+		t.Fatalf("expected %d bytes, got %d", len(imgBits), len(values))
+	}
+	if values[0] != "0x00," || values[255] != "0xFF," {
+		t.Errorf("expected the bytes in order, got %s and %s", values[0], values[255])
+	}
+
+	buf.Reset()
+	if err := FprintCHeader(&buf, "", "icon", 8, 8, [][]byte{{1, 2, 3, 4, 5, 6, 7, 8}}, nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "PROGMEM") {
+		t.Error("expected no PROGMEM without -progmem")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// -checksum computes the CRC32 (IEEE) of bin mode data as it is written to
+// the file, header included, and stores it:
+//
+//	append    as 4 little-endian bytes at the end of the file
+//	sidecar   as 8 hex digits in name.bin.crc
+//	manifest  in the manifest only
+//
+// Any of them also lists the CRC32 of every output in the manifest, and adds
+// the CRC32 of the data to rice mode files for firmware to check its flash.
+var checksumModes = []string{"append", "sidecar", "manifest"}
+
+var errChecksum = errors.New("checksum mismatch")
+
+// withChecksum appends the CRC32 of data with -checksum append
+func (o *Options) withChecksum(data []byte) []byte {
+	if o.Checksum != "append" {
+		return data
+	}
+	return binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+}
+
+// writeChecksums writes the sidecar .crc file of each of the bin files in
+// written with -checksum sidecar, and returns written along with them
+func (o *Options) writeChecksums(written []string) ([]string, error) {
+	if o.Checksum != "sidecar" || o.OutMode != "bin" {
+		return written, nil
+	}
+	for _, path := range written {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return written, err
+		}
+		err = o.writeFile(path+".crc", func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "%08x\n", crc32.ChecksumIEEE(data))
+			return err
+		})
+		if err != nil {
+			return written, err
+		}
+		written = append(written, path+".crc")
+	}
+	return written, nil
+}
+
+// fprintGoChecksums writes the CRC32 of the data of a rice mode file, as a
+// constant for a single image and a slice for animations
+func fprintGoChecksums(w io.Writer, name string, frames [][]byte) error {
+	if len(frames) == 1 {
+		_, err := fmt.Fprintf(w, "\n// %sCRC32 is the CRC32 (IEEE) of %s\nconst %sCRC32 = 0x%08X\n",
+			name, name, name, crc32.ChecksumIEEE(frames[0]))
+		return err
+	}
+	sums := make([]string, len(frames))
+	for i, frame := range frames {
+		sums[i] = fmt.Sprintf("0x%08X", crc32.ChecksumIEEE(frame))
+	}
+	_, err := fmt.Fprintf(w, "\n// %sCRC32 holds the CRC32 (IEEE) of each frame of %s\nvar %sCRC32 = []uint32{%s}\n",
+		name, name, name, strings.Join(sums, ", "))
+	return err
+}
+
+// VerifyChecksum checks the bin file at path against its sidecar .crc file,
+// or else against the checksum appended to it
+func VerifyChecksum(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sidecar, err := os.ReadFile(path + ".crc")
+	switch {
+	case err == nil:
+		want, err := strconv.ParseUint(strings.TrimSpace(string(sidecar)), 16, 32)
+		if err != nil {
+			return fmt.Errorf("invalid checksum in %s.crc: %w", path, err)
+		}
+		if got := crc32.ChecksumIEEE(data); got != uint32(want) {
+			return fmt.Errorf("%w: %s.crc has %08x, the file %08x", errChecksum, path, want, got)
+		}
+		return nil
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+	if h, _, err := DecodeHeader(data); !errors.Is(err, errNoHeader) {
+		// a header knows whether a checksum follows the data, and checks it
+		if err == nil && !h.CRC {
+			return fmt.Errorf("no checksum: there's no %s.crc, and the header doesn't have one", path)
+		}
+		return err
+	}
+	if len(data) < 4 || crc32.ChecksumIEEE(data[:len(data)-4]) != binary.LittleEndian.Uint32(data[len(data)-4:]) {
+		return fmt.Errorf("%w: there's no %s.crc, and the file doesn't end with its checksum", errChecksum, path)
+	}
+	return nil
+}
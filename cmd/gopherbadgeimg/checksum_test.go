@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// convertChecksum converts the profile picture in bin mode with -checksum
+// mode to dir/profile.bin
+func convertChecksum(t *testing.T, dir, mode string, header bool) string {
+	t.Helper()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Checksum, opts.Header = "bin", "profile", mode, header
+	opts.Output = filepath.Join(dir, "profile.bin")
+	if converted, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 120, 128); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the image to convert, got %d converted and %d failed", converted, len(failed))
+	}
+	return opts.Output
+}
+
+// corrupt flips a bit in the middle of the file at path
+func corrupt(t *testing.T, path string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0x10
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChecksumAppend(t *testing.T) {
+	path := convertChecksum(t, t.TempDir(), "append", false)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 120*128/8+4 {
+		t.Fatalf("expected the image followed by 4 bytes, got %d bytes", len(data))
+	}
+	if err := VerifyChecksum(path); err != nil {
+		t.Errorf("expected the checksum to match, got %v", err)
+	}
+
+	corrupt(t, path)
+	if err := VerifyChecksum(path); !errors.Is(err, errChecksum) {
+		t.Errorf("expected the corrupted file to fail, got %v", err)
+	}
+	if err := os.WriteFile(path, data[:len(data)-100], 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChecksum(path); !errors.Is(err, errChecksum) {
+		t.Errorf("expected the truncated file to fail, got %v", err)
+	}
+}
+
+func TestChecksumSidecar(t *testing.T) {
+	path := convertChecksum(t, t.TempDir(), "sidecar", false)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 120*128/8 {
+		t.Errorf("expected the bin file to be left alone, got %d bytes", len(data))
+	}
+	sidecar, err := os.ReadFile(path + ".crc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%08x\n", crc32.ChecksumIEEE(data)); string(sidecar) != want {
+		t.Errorf("expected %q in the .crc file, got %q", want, sidecar)
+	}
+	if err := VerifyChecksum(path); err != nil {
+		t.Errorf("expected the checksum to match, got %v", err)
+	}
+
+	corrupt(t, path)
+	if err := VerifyChecksum(path); !errors.Is(err, errChecksum) {
+		t.Errorf("expected the corrupted file to fail, got %v", err)
+	}
+
+	// a file with no checksum at all doesn't pass either
+	if err := os.Remove(path + ".crc"); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyChecksum(path); err == nil {
+		t.Error("expected a file without a checksum to fail")
+	}
+}
+
+func TestChecksumHeader(t *testing.T) {
+	path := convertChecksum(t, t.TempDir(), "append", true)
+	var out bytes.Buffer
+	if err := NewOptions().Inspect(&out, path); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "checksum: crc32, ok") {
+		t.Errorf("expected the checksum in\n%s", out.String())
+	}
+	if err := VerifyChecksum(path); err != nil {
+		t.Errorf("expected the checksum to match, got %v", err)
+	}
+
+	corrupt(t, path)
+	if err := NewOptions().Inspect(&out, path); !errors.Is(err, errChecksum) {
+		t.Errorf("expected inspecting the corrupted file to fail, got %v", err)
+	}
+	if err := VerifyChecksum(path); !errors.Is(err, errChecksum) {
+		t.Errorf("expected the corrupted file to fail, got %v", err)
+	}
+
+	// without a checksum the header is the only thing left to check
+	path = convertChecksum(t, t.TempDir(), "", true)
+	if err := VerifyChecksum(path); err == nil {
+		t.Error("expected a header without a checksum to fail")
+	}
+}
+
+func TestChecksumRice(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Checksum = "rice", "profile", "append"
+	opts.Output = filepath.Join(dir, "profile.go")
+	if converted, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 120, 128); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the image to convert, got %d converted and %d failed", converted, len(failed))
+	}
+	generated, err := os.ReadFile(opts.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf("const rprofileCRC32 = 0x%08X\n", crc32.ChecksumIEEE(opts.ImgToBytes(120, 128, img)))
+	if !strings.Contains(string(generated), want) {
+		t.Errorf("expected %q in\n%s", want, generated[len(generated)-200:])
+	}
+}
+
+func TestChecksumManifest(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Checksum = "bin", "profile", "manifest"
+	opts.Output = filepath.Join(dir, "profile.bin")
+	opts.Manifest = filepath.Join(dir, "manifest.json")
+	if converted, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 120, 128); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the image to convert, got %d converted and %d failed", converted, len(failed))
+	}
+	data, err := os.ReadFile(opts.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 120*128/8 {
+		t.Errorf("expected the bin file to be left alone, got %d bytes", len(data))
+	}
+	manifest, _ := readManifest(t, opts.Manifest)
+	if want := fmt.Sprintf("%08x", crc32.ChecksumIEEE(data)); manifest.Images[0].Outputs[0].CRC32 != want {
+		t.Errorf("expected crc32 %s in the manifest, got %+v", want, manifest.Images[0].Outputs[0])
+	}
+}
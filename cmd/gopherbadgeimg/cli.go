@@ -0,0 +1,1309 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// A command is one of the subcommands of gopherbadgeimg, each with its own
+// flags
+type command struct {
+	name string
+	// args describes the arguments of the command in its usage
+	args    string
+	summary string
+	// setup registers the flags of the command on fs, and returns the
+	// function that runs it with the arguments left once they're parsed
+	setup    func(fs *flag.FlagSet, opts *Options) func(args []string) error
+	examples []string
+}
+
+// commands are the subcommands of gopherbadgeimg. The first one, convert, is
+// run when the first argument isn't the name of another, so that the command
+// lines from before there were subcommands still work.
+var commands = []*command{
+	{
+		name:    "convert",
+		args:    "<input_image or - for stdin>...",
+		summary: "convert images for the badge (the default)",
+		setup:   setupConvert,
+		examples: []string{
+			"-outmode bin -ratio splash tainigo_128.png",
+			"-outmode rice -ratio 128x128 -disable-dithering -show image.jpg",
+		},
+	},
+	{
+		name:     "preview",
+		args:     "<input_image or bin file>...",
+		summary:  "draw images, or bin files, in the terminal",
+		setup:    setupPreview,
+		examples: []string{"-ratio splash tainigo_128.png", "-ratio splash -show-style braille splash.bin"},
+	},
+	{
+		name:     "decode",
+		args:     "<bin file>...",
+		summary:  "turn bin files back into PNGs",
+		setup:    setupDecode,
+		examples: []string{"-ratio splash splash.bin", "-o splash.png splash.bin"},
+	},
+	{
+		name:     "inspect",
+		args:     "<bin file>...",
+		summary:  "print the header of bin files written with -header",
+		setup:    setupInspect,
+		examples: []string{"splash.bin", "-show splash.bin"},
+	},
+	{
+		name:     "diff",
+		args:     "<a> <b>",
+		summary:  "compare two bin files, or an image and a bin file; exits with 0 when identical, 1 when different or 2 when they can't be compared",
+		setup:    setupDiff,
+		examples: []string{"old.bin new.bin", "-ratio splash -show tainigo_128.png splash.bin"},
+	},
+	{
+		name:     "font",
+		args:     "<font file>",
+		summary:  "turn a TrueType or OpenType font into a Go file of bitmaps (see Fonts in README.md)",
+		setup:    setupFont,
+		examples: []string{"-size 12 DejaVuSans.ttf", "-size 16 -chars 0123456789: -var digits -o digits.go DejaVuSansMono.ttf"},
+	},
+	{
+		name:     "serve",
+		args:     "",
+		summary:  "convert the images uploaded to an HTTP server (see Server in README.md)",
+		setup:    setupServe,
+		examples: []string{"-addr :8080"},
+	},
+}
+
+// lookupCommand returns the subcommand called name, or nil
+func lookupCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// usageError is the error of a command line that can't be run, which is
+// followed by the usage of the command
+type usageError struct {
+	error
+}
+
+// usagef returns a usageError with the formatted message
+func usagef(format string, args ...any) error {
+	return usageError{fmt.Errorf(format, args...)}
+}
+
+// exitError is returned by commands that have already said why they failed,
+// to exit with its code
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// run runs the command line args, without the program name, and returns the
+// exit code. The first argument names the subcommand, convert if it isn't
+// one.
+func run(args []string) int {
+	log.SetOutput(stderr)
+	c := commands[0]
+	if len(args) > 0 {
+		if named := lookupCommand(args[0]); named != nil {
+			c, args = named, args[1:]
+		}
+	}
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { c.usage(fs) }
+	runCommand := c.setup(fs, NewOptions())
+	var quiet, verbose, trace, version, listFormats, listPorts, asJSON, selftest, updateGolden bool
+	fs.BoolVar(&quiet, "quiet", false, "only print errors, leaving out warnings, progress and summaries")
+	fs.BoolVar(&verbose, "v", false, "print debug messages too, such as the size and dithering of every conversion and the archive entries that are skipped")
+	fs.BoolVar(&trace, "vv", false, "print the messages of -v and how long each stage of a conversion takes")
+	fs.BoolVar(&version, "version", false, "print the version and revision gopherbadgeimg was built from, and what it supports, then exit")
+	fs.BoolVar(&listFormats, "list-formats", false, "print the input formats, outmodes, layouts and dithering algorithms this build supports, one per line, then exit")
+	fs.BoolVar(&listPorts, "list-ports", false, "print the serial ports a badge may be on, for -send, one per line with the name of the device when the system gives it, then exit")
+	fs.BoolVar(&asJSON, "json", false, "print -list-formats as JSON")
+	fs.BoolVar(&selftest, "selftest", false, "convert the reference images built into gopherbadgeimg with every dithering algorithm and layout and check the data against the hashes built in with them, then exit, naming the cases that drifted")
+	fs.BoolVar(&updateGolden, "update-golden", false, "for development: convert the reference images of -selftest and rewrite selftest/golden.txt with their hashes, run from cmd/gopherbadgeimg")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return exitUsage
+	}
+	switch {
+	case version:
+		fprintVersion(stdout)
+		return 0
+	case listFormats:
+		if err := fprintFormats(stdout, asJSON); err != nil {
+			logger.Errorf("%v", err)
+			return exitOutput
+		}
+		return 0
+	case listPorts:
+		if err := printPorts(stdout); err != nil {
+			logger.Errorf("error listing serial ports: %v", err)
+			return exitFailure
+		}
+		return 0
+	case asJSON:
+		logger.Errorf("error: -json only applies to -list-formats\n\n")
+		fs.Usage()
+		return exitUsage
+	}
+	logger.Level = badgeimg.LevelInfo
+	switch {
+	case quiet && (verbose || trace):
+		logger.Errorf("error: -quiet cannot be combined with -v or -vv\n\n")
+		fs.Usage()
+		return exitUsage
+	case quiet:
+		logger.Level = badgeimg.LevelQuiet
+	case trace:
+		logger.Level = badgeimg.LevelTrace
+	case verbose:
+		logger.Level = badgeimg.LevelDebug
+	}
+	switch {
+	case (selftest || updateGolden) && fs.NArg() > 0:
+		logger.Errorf("error: -selftest and -update-golden convert images of their own, they take no inputs\n\n")
+		fs.Usage()
+		return exitUsage
+	case updateGolden:
+		runCommand = func([]string) error { return writeGolden(goldenPath) }
+	case selftest:
+		runCommand = func([]string) error { return checkGolden(goldenHashes) }
+	}
+
+	err := runCommand(fs.Args())
+	var (
+		usage usageError
+		exit  exitError
+	)
+	switch {
+	case err == nil:
+		return 0
+	case errors.As(err, &exit):
+	case errors.As(err, &usage):
+		logger.Errorf("%v\n\n", err)
+		fs.Usage()
+	default:
+		logger.Errorf("%v", err)
+	}
+	return exitCode(err)
+}
+
+// usage prints the usage of the command, with the list of commands for the
+// default one
+func (c *command) usage(fs *flag.FlagSet) {
+	w := fs.Output()
+	name := os.Args[0]
+	synopsis := []string{name, c.name, c.args}
+	if c == commands[0] {
+		synopsis[1] = "[" + c.name + "]"
+	}
+	fmt.Fprintf(w, "Usage of %s:\n", strings.TrimSpace(strings.Join(synopsis, " ")))
+	fs.PrintDefaults()
+	if c == commands[0] {
+		fmt.Fprintf(w, "\nCommands:\n")
+		for _, c := range commands {
+			fmt.Fprintf(w, "  %-8s %s\n", c.name, c.summary)
+		}
+		fmt.Fprintf(w, "\nRun %s <command> -h for the flags of a command.\n", name)
+	}
+	fmt.Fprintf(w, "\nExamples:\n")
+	for _, example := range c.examples {
+		if c == commands[0] {
+			fmt.Fprintf(w, "%s %s\n", name, example)
+		} else {
+			fmt.Fprintf(w, "%s %s %s\n", name, c.name, example)
+		}
+	}
+}
+
+// flagValues holds the values of the flags shared by several commands that
+// aren't Options, which are checked by apply once they're parsed
+type flagValues struct {
+	colors, paletteList string
+	ditherMatrix        string
+	layout              string
+	planes              string
+}
+
+// paletteFlags registers -colors and -palette
+func (f *flagValues) paletteFlags(fs *flag.FlagSet) {
+	fs.StringVar(&f.colors, "colors", "mono", "set the target panel colors to one of: mono or acep (7-color ACeP, 4 bits per pixel)")
+	fs.StringVar(
+		&f.paletteList,
+		"palette",
+		"",
+		"dither against a custom comma-separated list of 2 to 16 colors, e.g. \"#000000,#ffffff,#ff0000\" or \"black,white,rgb(255, 0, 0)\", packed at ceil(log2(n)) bits per pixel",
+	)
+}
+
+// layoutFlag registers -layout
+func (f *flagValues) layoutFlag(fs *flag.FlagSet) {
+	fs.StringVar(
+		&f.layout,
+		"layout",
+		badgeimg.LayoutNames[0],
+		"pack black and white images, and read bin files without a header, in the layout of: "+strings.Join(badgeimg.LayoutNames, ", ")+" (see README.md)",
+	)
+}
+
+// planesFlag registers -planes
+func (f *flagValues) planesFlag(fs *flag.FlagSet) {
+	fs.StringVar(
+		&f.planes,
+		"planes",
+		"",
+		"write, and read bin files without a header, the bit planes of -palette images of 3 colors or more: separate (a black and white image per plane, named after its color such as image_red), concat (one plane after the other) or interleave (a byte of each plane in turn); see README.md",
+	)
+}
+
+// imageFlags registers the flags that change how an image is read and
+// converted
+func (f *flagValues) imageFlags(fs *flag.FlagSet, opts *Options) {
+	fs.BoolVar(&opts.DisableDithering, "disable-dithering", false, "disables dithering")
+	fs.StringVar(&opts.Dither, "dither", opts.Dither, "set the dithering algorithm to one of: floyd-steinberg, atkinson or bayer")
+	fs.StringVar(&f.ditherMatrix, "dither-matrix", "", "dither with the error diffusion kernel in this JSON file instead of -dither (see Dithering in README.md)")
+	fs.Var(thresholdValue{&opts.Threshold}, "threshold", "convert black and white images without dithering, pixels darker than this luminance (1 to 255) becoming black, or auto (also otsu) to pick it for each image by Otsu's method")
+	fs.BoolVar(&opts.Invert, "invert", false, "invert the colors of the image before converting it, black becoming white")
+	fs.Float64Var(&opts.Gamma, "gamma", opts.Gamma, "apply a power curve of this gamma (0.1 to 5) to the image before dithering it, above 1 lightening the midtones and below 1 darkening them; in linear light with -linear")
+	fs.StringVar(&opts.Anchor, "anchor", "", "letterbox images into -ratio instead of stretching them, placing them at: center, left, right, top, bottom, top-left, top-right, bottom-left or bottom-right, the padding going to the other side")
+	fs.BoolVar(&opts.NoUpscale, "no-upscale", false, "refuse images smaller than -ratio instead of scaling them up, which blurs them; with -anchor, place them at 1:1 instead")
+	fs.BoolVar(&opts.Linear, "linear", false, "apply -threshold, -invert and -gamma to the light pixels give off, by the sRGB transfer function, rather than to their gamma-encoded values; dithering always works in linear light")
+	fs.StringVar(&opts.Raw, "raw", "", "read inputs as headerless framebuffers of WxH pixels in FORMAT: gray8, rgb24, rgba32, rgb565 (little-endian) or rgb565be, such as 320x240:rgb565")
+	fs.IntVar(&opts.FrameIndex, "frame", -1, "only convert frame N of an animated GIF, or image N of an icon file (default: the largest)")
+	fs.StringVar(&opts.Frames, "frames", "", "only convert the frames of animated GIFs in START:END:STEP, Python slice style: 0:60:5 takes every 5th of the first 60, negative indices count from the end, and each frame is shown for as long as those it stands for")
+	fs.IntVar(&opts.FrameDelay, "frame-delay", 0, "show every frame of animations for this many milliseconds, for firmware that can't play their own delays (at least 10, see Animations in README.md)")
+	fs.Float64Var(&opts.Speed, "speed", opts.Speed, "multiply the delays of animations by this factor: 2 shows each frame twice as long, 0.5 half as long (delays stay at least 10ms, see Animations in README.md)")
+	fs.Var(
+		&colorValue{c: &opts.Background},
+		"background",
+		"set the color transparent areas are composited onto: a CSS name such as white or rebeccapurple, #RRGGBB or rgb(r, g, b) (default black for raster images, white for SVG)",
+	)
+	fs.DurationVar(&urlTimeout, "timeout", urlTimeout, "set how long to wait when downloading an http(s) input image")
+	fs.Int64Var(&maxDownload, "max-download", maxDownload, "set the maximum size in bytes of an http(s) input image, or of an image in an archive")
+	fs.Int64Var(&maxPixels, "max-pixels", maxPixels, "set the maximum size in pixels of an input image, checked before it is decoded")
+}
+
+// thresholdValue is the flag.Value of -threshold, a luminance or auto
+type thresholdValue struct {
+	threshold *int
+}
+
+func (v thresholdValue) String() string {
+	switch {
+	case v.threshold == nil:
+		return "0"
+	case *v.threshold == badgeimg.ThresholdAuto:
+		return "auto"
+	}
+	return strconv.Itoa(*v.threshold)
+}
+
+func (v thresholdValue) Set(s string) error {
+	threshold, err := parseThreshold(s)
+	if err != nil {
+		return err
+	}
+	*v.threshold = threshold
+	return nil
+}
+
+// listValue is the flag.Value of flags that can be repeated, collecting
+// their values in order
+type listValue struct {
+	values *[]string
+}
+
+func (v listValue) String() string {
+	if v.values == nil {
+		return ""
+	}
+	return strings.Join(*v.values, " ")
+}
+
+func (v listValue) Set(s string) error {
+	*v.values = append(*v.values, s)
+	return nil
+}
+
+// parseThreshold parses a -threshold: a luminance, or auto and otsu for
+// badgeimg.ThresholdAuto
+func parseThreshold(s string) (int, error) {
+	if s == "auto" || s == "otsu" {
+		return badgeimg.ThresholdAuto, nil
+	}
+	threshold, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errors.New("use a luminance from 1 to 255, auto or otsu")
+	}
+	return threshold, nil
+}
+
+// ratioFlag registers -ratio
+func ratioFlag(fs *flag.FlagSet, opts *Options) {
+	fs.StringVar(
+		&opts.Ratio,
+		"ratio",
+		"",
+		"set the aspect ratio to predefined values including 'profile' or splash', or a custom value specified in the format of <width>x<height>, such as 296x128. A comma-separated list converts each input to each of them, with outputs named after the ratio.",
+	)
+	fs.BoolVar(&opts.Transpose, "transpose", false, "read custom -ratio values as <height>x<width>, as the help of -ratio once said")
+}
+
+// writeFlags registers the flags that change how output files are written
+func writeFlags(fs *flag.FlagSet, opts *Options) {
+	fs.BoolVar(&opts.Force, "force", false, "overwrite output files that already exist with a different content (by default they are reported and left alone)")
+	fs.BoolVar(&opts.ForceWrite, "force-write", false, "rewrite output files even when they already hold what would be written (by default they are left untouched, keeping their modification time)")
+	fs.BoolVar(&opts.Verify, "verify", false, "check that the output files already hold exactly what would be written, writing nothing: each one that doesn't fails, with how many bytes differ; given generated Go files instead of images, check them against the source named by the provenance comments they end with")
+	fs.BoolVar(&opts.Durable, "durable", false, "sync output files to disk before renaming them into place, so a power loss can't leave them empty")
+}
+
+// showFlags registers the flags that change how -show draws images
+func showFlags(fs *flag.FlagSet, opts *Options) {
+	fs.StringVar(&opts.ShowStyle, "show-style", opts.ShowStyle, "set how -show draws black and white images: ascii (one character per pixel), braille (2x4 pixels per character) or halfblock (1x2 pixels per character, about square)")
+	fs.StringVar(&opts.ShowOn, "show-on", "", "set the character -show draws pixels that are on with (default *)")
+	fs.StringVar(&opts.ShowOff, "show-off", "", "set the character -show draws pixels that are off with (default a space)")
+	fs.StringVar(&opts.ShowColor, "show-color", opts.ShowColor, "draw -show previews in color: auto (when stderr is a terminal and NO_COLOR isn't set), always or never")
+	fs.IntVar(&opts.ShowWidth, "show-width", 0, "shrink -show previews to fit in this many columns (default the width of the terminal, if stderr is one)")
+}
+
+// apply sets the palette, the dither matrix, the layout and the bit planes
+// of opts from the flags
+func (f *flagValues) apply(opts *Options) error {
+	var err error
+	if f.paletteList != "" {
+		if f.colors != "mono" {
+			return usagef("error: -palette and -colors cannot be combined")
+		}
+		opts.Palette, err = ParsePalette(f.paletteList)
+	} else if f.colors != "" {
+		opts.Palette, err = LookupPalette(f.colors)
+	}
+	if err != nil {
+		return usageError{err}
+	}
+	if f.ditherMatrix != "" {
+		if opts.DitherMatrix, err = loadDitherMatrix(f.ditherMatrix); err != nil {
+			return err
+		}
+	}
+	if opts.Layout, err = badgeimg.LookupLayout(f.layout); err != nil {
+		return usageError{err}
+	}
+	if opts.Layout != badgeimg.LayoutBadger && opts.Palette != MonoPalette {
+		return usagef("error: -layout only applies to black and white images, -colors and -palette pack pixels their own way")
+	}
+	switch {
+	case f.planes == "":
+		return nil
+	case !slices.Contains(planeArrangements, f.planes):
+		return usagef("error: invalid -planes `%s`, use one of: %s", f.planes, strings.Join(planeArrangements, ", "))
+	case opts.Palette.RowMajor:
+		return usagef("error: -planes can't split the %s palette, which packs whole pixels row by row", opts.Palette.Name)
+	case opts.Palette.Depth < 2:
+		return usagef("error: -planes only applies to -palette images of 3 colors or more, which have several bit planes")
+	}
+	planar := *opts.Palette
+	planar.Planes = f.planes
+	opts.Palette = &planar
+	return nil
+}
+
+// checkShow checks the flags registered by showFlags
+func checkShow(opts *Options) error {
+	if !slices.Contains(showStyles, opts.ShowStyle) {
+		return usagef("error: invalid show style `%s`", opts.ShowStyle)
+	}
+	for _, glyph := range []string{opts.ShowOn, opts.ShowOff} {
+		if glyph != "" && utf8.RuneCountInString(glyph) != 1 {
+			return usagef("error: -show-on and -show-off take a single character, got `%s`", glyph)
+		}
+	}
+	if !slices.Contains(showColors, opts.ShowColor) {
+		return usagef("error: invalid show color `%s`", opts.ShowColor)
+	}
+	if opts.ShowWidth < 0 {
+		return usagef("error: invalid show width %d", opts.ShowWidth)
+	}
+	return nil
+}
+
+// checkImage checks the flags registered by imageFlags
+func checkImage(opts *Options) error {
+	if err := lookupDither(opts.Dither); err != nil {
+		return usageError{err}
+	}
+	if opts.Threshold < badgeimg.ThresholdAuto || opts.Threshold > 255 {
+		return usagef("error: -threshold must be between 1 and 255, auto, or 0 for none")
+	}
+	if opts.Gamma < 0.1 || opts.Gamma > 5 {
+		return usagef("error: -gamma must be between 0.1 and 5")
+	}
+	if opts.Threshold != 0 && opts.Palette != MonoPalette {
+		return usagef("error: -threshold only applies to black and white images")
+	}
+	if maxPixels <= 0 {
+		return usagef("error: -max-pixels must be positive")
+	}
+	if opts.Raw != "" {
+		if _, _, _, err := parseRaw(opts.Raw); err != nil {
+			return usageError{err}
+		}
+	}
+	if opts.Frames != "" {
+		if opts.FrameIndex >= 0 {
+			return usagef("error: -frame and -frames can't be used together")
+		}
+		if _, err := parseFrameRange(opts.Frames); err != nil {
+			return usageError{err}
+		}
+	}
+	if opts.FrameDelay != 0 && opts.Speed != 1 {
+		return usagef("error: -frame-delay and -speed can't be used together, as -frame-delay replaces the delays -speed would scale")
+	}
+	if math.IsNaN(opts.Speed) || math.IsInf(opts.Speed, 0) {
+		return usagef("error: -speed must be a number, such as 2 or 0.5")
+	}
+	if opts.Anchor != "" && !slices.Contains(anchors, opts.Anchor) {
+		return usagef("error: invalid -anchor `%s`, use one of: %s", opts.Anchor, strings.Join(anchors, ", "))
+	}
+	return nil
+}
+
+// optionalRatio returns the size -ratio asks for, or 0x0 without one, for
+// data that may have a header giving its size
+func optionalRatio(opts *Options) (int, int, error) {
+	if opts.Ratio == "" {
+		return 0, 0, nil
+	}
+	r, err := opts.ratioSize(opts.Ratio)
+	if err != nil {
+		return 0, 0, usageError{err}
+	}
+	opts.warnSwapped(opts.Ratio, r)
+	return r.Width, r.Height, nil
+}
+
+// setupConvert sets up the convert command, which is the original command
+// line: it also keeps the flags that run the other commands, such as -decode
+func setupConvert(fs *flag.FlagSet, opts *Options) func(args []string) error {
+	var (
+		f                                            flagValues
+		watch, inspect, verifyChecksum, decode, diff bool
+		cacheClear, tune                             bool
+		cache                                        = Cache{MaxSize: 256 << 20, MaxAge: 30 * 24 * time.Hour}
+		base64Data, fromBase64, progress             string
+		cpuProfile, memProfile                       string
+		overlays                                     []string
+	)
+	f.paletteFlags(fs)
+	f.layoutFlag(fs)
+	f.planesFlag(fs)
+	f.imageFlags(fs, opts)
+	ratioFlag(fs, opts)
+	showFlags(fs, opts)
+	writeFlags(fs, opts)
+	fs.BoolVar(&opts.Show, "show", false, "paints dot-matrix-style art to the screen representing the image")
+	fs.StringVar(
+		&opts.OutMode,
+		"outmode",
+		"",
+		"set the resize mode to one of: rice, bin, pbm, cheader, python, base64, slideshow (every input in a single file, see Slideshows in README.md), or none; a comma-separated list such as bin,base64 writes each of them from the same conversion",
+	)
+	fs.StringVar(
+		&opts.Animation,
+		"animation",
+		"split",
+		"set how the frames of an animated GIF are written in bin mode: split (one name-NNN.bin per frame) or concat (a single bin prefixed by the frame count)",
+	)
+	fs.Var(dedupeValue{&opts.DedupeFrames}, "dedupe-frames", "collapse the runs of identical frames of animations into one, shown for as long as the run; =global also stores each distinct frame once in rice and slideshow outputs, along with the sequence they are shown in")
+	fs.StringVar(&opts.Grid, "grid", "", "slice the image, once scaled to -ratio, into a sprite sheet of COLSxROWS cells converted on their own: numbered files in bin mode, a slice in rice mode, row by row")
+	fs.StringVar(&opts.Tile, "tile", "", "same as -grid, with cells of WxH pixels")
+	fs.StringVar(&opts.ContactSheet, "contact-sheet", "", "draw every converted image, or the bin files given as inputs, on this PNG with its name under it, to look them all over at once")
+	fs.IntVar(&opts.ContactColumns, "contact-columns", 0, "set how many images wide the -contact-sheet is (default: as square as it gets)")
+	fs.IntVar(&opts.ContactPadding, "contact-padding", compareGap, "set how many pixels the images of the -contact-sheet are apart")
+	fs.BoolVar(&opts.Marquee, "marquee", false, "convert a banner for scrolling across -ratio: the image scaled to its height, or -text drawn, as wide as it makes it (see Marquees in README.md)")
+	fs.IntVar(&opts.MarqueeStep, "marquee-step", 0, "slice the -marquee banner into windows the width of -ratio, this many pixels apart, written as the cells of a sheet (default: the whole banner)")
+	fs.BoolVar(&opts.MarqueeWrap, "marquee-wrap", false, "loop the -marquee banner seamlessly, its end going on with its start")
+	fs.StringVar(&opts.Region, "region", "", "only convert the window WxH+X+Y of the display, -ratio, for partial updates; its offset goes to the manifest and to NameOffsetX and NameOffsetY constants in rice mode")
+	fs.Var(listValue{&overlays}, "overlay", "composite the image PATH onto the image once scaled, with its top left corner at XxY pixels and at an optional SCALE percent of its size: PATH@XxY[,SCALE%]; repeat it to stack overlays, the last one on top")
+	fs.StringVar(&opts.Text, "text", "", "draw this text as the image instead of converting inputs, with \\n between lines")
+	fs.StringVar(&opts.TextFont, "text-font", "", "draw -text with this TrueType or OpenType font (default: a built-in 7x13 bitmap font)")
+	fs.Float64Var(&opts.TextSize, "text-size", 13, "set the size of -text in points, which are pixels; the built-in font only comes in multiples of 13")
+	fs.StringVar(&opts.Align, "align", "center", "align the lines of -text: left, center or right")
+	fs.BoolVar(&opts.Fit, "fit", false, "size -text so that its longest line fills the width, ignoring -text-size")
+	fs.BoolVar(&opts.Shrink, "shrink", false, "shrink -text that is too large for -ratio, instead of failing")
+	fs.StringVar(&opts.Template, "template", "", "draw a badge from the images, text, QR codes and rectangles placed on the canvas by this JSON file as the image instead of converting inputs (see Templates in README.md)")
+	fs.StringVar(&opts.TemplateData, "data", "", "draw a -template badge for every row of this CSV file, replacing {column} in the template with the row's value in that column")
+	fs.StringVar(&opts.QR, "qr", "", "draw a QR code of this text, such as a URL, as the image instead of converting inputs, with square modules and no dithering")
+	fs.StringVar(&opts.QRLevel, "qr-level", "M", "set the error correction level of -qr, from the least to the most tolerant of damage: L, M, Q or H")
+	fs.StringVar(&opts.BatchFile, "batch-file", "", "convert the inputs listed in this CSV file instead of those given as arguments, its first row naming the columns: input, and any of ratio, threshold, invert and output, which default to the flags; a file ending in .json is an array of objects with the same keys (see Batches in README.md)")
+	fs.BoolVar(&opts.FailFast, "fail-fast", false, "stop at the first input that fails to convert, instead of converting the rest")
+	fs.BoolVar(&opts.StrictNames, "strict-names", false, "fail the inputs whose output files, Go variables or -bundle keys would take the names of an earlier input, instead of renaming them name_2, name_3... with a warning")
+	fs.IntVar(&opts.Jobs, "jobs", opts.Jobs, "set how many inputs are converted at the same time")
+	fs.BoolVar(&opts.Recursive, "recursive", false, "convert every image in the directories given as inputs, and in their subdirectories")
+	fs.BoolVar(&opts.IncludeHidden, "include-hidden", false, "include hidden files and directories with -recursive")
+	fs.StringVar(&opts.OutDir, "outdir", "", "write the outputs to this directory, mirroring the layout of the inputs")
+	fs.StringVar(&opts.Output, "o", "", "write the output of rice, bin, pbm, cheader or python mode to this file instead, or to stdout with -")
+	fs.StringVar(&opts.VarName, "var", "", "set the name of the variable in rice, cheader and python mode, and of -embed files (default: derived from the output name)")
+	fs.StringVar(&opts.Package, "pkg", "", "set the package of rice mode and -embed files (default main)")
+	fs.BoolVar(&opts.Export, "export", false, "export the variable of rice mode files, along with NameWidth and NameHeight constants and a NameImage() accessor (which -embed files get too)")
+	fs.StringVar(&opts.GoFormat, "gofmt", "", "add to rice mode files: image, a NameGray() function returning the image unpacked into an *image.Gray")
+	fs.StringVar(&opts.GoData, "go-data", goDataEncodings[0], "write the data of rice mode files as: bytes (byte literals), string (an escaped string constant, about two thirds as large) or base64 (a base64 string constant decoded at init, about a quarter as large)")
+	fs.BoolVar(&opts.ImportRuntime, "import-runtime", false, "have -gofmt image import gopherbadgeimg's badgeimg package to unpack images, instead of writing gray-generated.go")
+	fs.BoolVar(&opts.Embed, "embed", false, "write a name_embed.go file next to every bin file, embedding it with go:embed as an exported variable along with its size")
+	fs.StringVar(&opts.Bundle, "bundle", "", "write every input of rice mode to this one Go file instead, as an Assets map keyed by input name along with a LookupAsset function")
+	fs.BoolVar(&opts.Progmem, "progmem", false, "mark the arrays of cheader mode PROGMEM, to keep them in flash on AVR boards")
+	fs.BoolVar(&opts.BytesLiteral, "bytes-literal", false, "write python mode data as a b\"\\x..\" literal, which uses less memory to load than bytes([...])")
+	fs.StringVar(&opts.Compress, "compress", "", "compress bin and rice mode data with: rle, a run-length encoding (see Compression in README.md)")
+	fs.BoolVar(&opts.Header, "header", false, "prefix bin mode data with a 16 byte header holding its size, depth and layout (see Headers in README.md)")
+	fs.BoolVar(&inspect, "inspect", false, "same as the inspect command")
+	fs.StringVar(&opts.Checksum, "checksum", "", "store the CRC32 of bin mode data: append (to the file), sidecar (in name.bin.crc) or manifest; rice mode gets it as a const")
+	fs.BoolVar(&verifyChecksum, "verify-checksum", false, "check bin files against their .crc file or appended checksum instead of converting anything")
+	fs.BoolVar(&decode, "decode", false, "same as the decode command")
+	fs.BoolVar(&diff, "diff", false, "same as the diff command")
+	fs.StringVar(&base64Data, "base64", "", "with -show, preview this -outmode base64 data instead of converting an image, - to read it from stdin (bin files given as inputs are previewed the same way)")
+	fs.StringVar(&fromBase64, "from-base64", "", "write this -outmode base64 data, or the data in this file, - to read it from stdin, in the formats of -outmode instead of converting an image; its size comes from its header or else -ratio")
+	fs.StringVar(&opts.Preview, "preview", "", "write a PNG of exactly what the panel will show to this file, with any -outmode")
+	fs.StringVar(&opts.PreviewGIF, "preview-gif", "", "write a GIF of exactly what the panel will show to this file, animated with the original delays")
+	fs.IntVar(&opts.PreviewScale, "preview-scale", opts.PreviewScale, "draw every pixel of the -preview PNG and -preview-gif GIF as an NxN square")
+	fs.StringVar(&opts.Send, "send", "", "send every converted image to a badge over this serial port, such as /dev/ttyACM0, for a receiver to draw (see examples/receiver)")
+	fs.IntVar(&opts.Baud, "baud", opts.Baud, "set the baud rate of the -send port, which USB-CDC ports ignore")
+	fs.DurationVar(&opts.SendTimeout, "send-timeout", opts.SendTimeout, "give up on -send when the badge doesn't answer an image within this long")
+	fs.StringVar(&opts.Compare, "compare", "", "write a PNG comparing the result of every dithering algorithm to this file")
+	fs.StringVar(&opts.PaletteReport, "palette-report", "", "print the percent of pixels each palette entry takes, nearest to the source colors and once dithered, and write a PNG legend of them to this file")
+	fs.IntVar(&opts.PaletteReportWarn, "palette-report-warn", opts.PaletteReportWarn, "warn when a palette entry takes more than this percent of the pixels of an image, with -palette-report")
+	fs.BoolVar(&opts.Stats, "stats", false, "print how many pixels of black and white images are on, overall and by quadrant, warning about images nearly all black or all white; the counts go to the manifest too")
+	fs.BoolVar(&opts.Timings, "timings", false, "print how long each stage of every conversion took and how much it allocated: decode, scale, preprocess, dither, pack and emit; the timings go to the manifest too")
+	fs.StringVar(&cpuProfile, "cpuprofile", "", "write a pprof CPU profile of the whole run to this file")
+	fs.StringVar(&memProfile, "memprofile", "", "write a pprof memory profile of the whole run to this file")
+	fs.StringVar(&opts.Manifest, "manifest", "", "write a JSON manifest describing every converted input and its outputs to this file, - for stdout")
+	fs.StringVar(&cache.Dir, "cache-dir", "", "reuse the conversions of images converted the same way before from this directory, and store new ones in it, keyed by the SHA-256 of the image and of the flags changing the data")
+	fs.Int64Var(&cache.MaxSize, "cache-max-size", cache.MaxSize, "evict the least recently used -cache-dir entries once they take more than this many bytes, 0 for no limit")
+	fs.DurationVar(&cache.MaxAge, "cache-max-age", cache.MaxAge, "evict the -cache-dir entries unused for longer than this, 0 for no limit")
+	fs.BoolVar(&cacheClear, "cache-clear", false, "empty -cache-dir first; with no inputs, that's all that is done")
+	fs.BoolVar(&tune, "tune", false, "preview the input in the terminal and tune -threshold, -dither and -invert with single keys (+/-, d and i), writing the outputs with w, which prints the command line doing the same, and quitting with q")
+	fs.BoolVar(&watch, "watch", false, "keep running and convert the inputs again whenever they change, until interrupted")
+	fs.StringVar(&progress, "progress", progressModes[0], "report the progress of batches and -watch on stderr as one of: lines ([12/400] name ok) or bar (drawn in place, when stderr is a terminal)")
+
+	return func(args []string) error {
+		// -text, -qr and -template draw the image rather than converting
+		// inputs
+		drawn := opts.Text != "" || opts.QR != "" || opts.Template != ""
+		if (opts.Text != "" && opts.QR != "") || (opts.Template != "" && (opts.Text != "" || opts.QR != "")) {
+			return usagef("error: -text, -qr and -template cannot be combined")
+		}
+		if opts.TemplateData != "" && opts.Template == "" {
+			return usagef("error: -data can only be used with -template")
+		}
+		if drawn && (len(args) > 0 || base64Data != "" || watch || inspect || verifyChecksum || decode || diff) {
+			return usagef("error: -text, -qr and -template draw the image, they can't be used with inputs, -watch or the commands of other flags")
+		}
+		if fromBase64 != "" && (len(args) > 0 || drawn || base64Data != "" || watch || inspect || verifyChecksum || decode || diff) {
+			return usagef("error: -from-base64 takes the place of inputs, it can't be used with them, -text, -qr, -template, -watch or the commands of other flags")
+		}
+		if opts.BatchFile != "" && (len(args) > 0 || drawn || base64Data != "" || fromBase64 != "" || watch || tune || inspect || verifyChecksum || decode || diff) {
+			return usagef("error: -batch-file lists the inputs, it can't be used with inputs, -text, -qr, -template, -from-base64, -watch, -tune or the commands of other flags")
+		}
+		if len(args) == 0 && base64Data == "" && fromBase64 == "" && !drawn && opts.BatchFile == "" && !cacheClear {
+			return usagef("args: %v", args)
+		}
+		if err := f.apply(opts); err != nil {
+			return err
+		}
+		opts.Command = generateCommand(fs)
+		if !slices.Contains(progressModes, progress) {
+			return usagef("error: -progress must be one of: %s", strings.Join(progressModes, ", "))
+		}
+		if logger.Enabled(badgeimg.LevelInfo) {
+			opts.OnProgress = progressReporter(progress)
+		}
+		if cacheClear && cache.Dir == "" {
+			return usagef("error: -cache-clear needs -cache-dir")
+		}
+		if cacheClear {
+			n, err := cache.Clear()
+			if err != nil {
+				return fmt.Errorf("error clearing the cache: %w", err)
+			}
+			logger.Infof("removed %d entries from the cache in %s", n, cache.Dir)
+			if len(args) == 0 && base64Data == "" && fromBase64 == "" && !drawn && opts.BatchFile == "" {
+				return nil
+			}
+		}
+		if cache.Dir != "" {
+			opts.Cache = &cache
+			defer func() {
+				if n, err := cache.Evict(); err != nil {
+					logger.Warnf("the cache couldn't be evicted: %v", err)
+				} else if n > 0 {
+					logger.Debugf("evicted %d entries from the cache in %s", n, cache.Dir)
+				}
+			}()
+		}
+		if cpuProfile != "" || memProfile != "" {
+			stopProfiles, err := startProfiles(cpuProfile, memProfile)
+			if err != nil {
+				return err
+			}
+			defer stopProfiles()
+		}
+		if verifyChecksum {
+			return verifyFiles(args)
+		}
+		if inspect {
+			return inspectFiles(opts, args)
+		}
+		if err := checkShow(opts); err != nil {
+			return err
+		}
+		if fromBase64 != "" {
+			x, y, err := optionalRatio(opts)
+			if err != nil {
+				return err
+			}
+			if err := checkConvert(opts); err != nil {
+				return err
+			}
+			switch {
+			case opts.OutMode == "slideshow" || opts.Grid != "" || opts.Tile != "" || opts.Region != "" || opts.Marquee:
+				return usagef("error: -from-base64 data is already converted, it can't be written as a slideshow or sliced by -grid, -tile, -region or -marquee")
+			case opts.Bundle != "" || opts.Manifest != "" || opts.Compare != "" || opts.PaletteReport != "":
+				return usagef("error: -bundle, -manifest, -compare and -palette-report describe conversions, they can't be used with -from-base64")
+			}
+			return opts.FromBase64(fromBase64, x, y)
+		}
+		// existing data takes its size from its header, or else from -ratio
+		view := opts.Show && !drawn && opts.BatchFile == "" && (base64Data != "" || opts.Raw == "" && !slices.ContainsFunc(args, func(arg string) bool {
+			return !strings.HasSuffix(arg, ".bin")
+		}))
+		if opts.ContactSheet != "" && opts.Raw == "" && opts.BatchFile == "" && onlyBins(args) {
+			x, y, err := optionalRatio(opts)
+			if err != nil {
+				return err
+			}
+			if err := checkContactSheet(opts); err != nil {
+				return err
+			}
+			return contactSheetBins(opts, args, x, y)
+		}
+		if decode || view || diff {
+			x, y, err := optionalRatio(opts)
+			if err != nil {
+				return err
+			}
+			switch {
+			case diff:
+				return diffFiles(opts, args, x, y)
+			case view:
+				return viewInputs(opts, base64Data, args, x, y)
+			}
+			return decodeFiles(opts, args, x, y)
+		}
+
+		// generated Go files record what to check them against
+		if opts.Verify && slices.ContainsFunc(args, isGoFile) {
+			if drawn || base64Data != "" || opts.BatchFile != "" || slices.ContainsFunc(args, func(arg string) bool { return !isGoFile(arg) }) {
+				return usagef("error: -verify checks Go files against the source their provenance names, they can't be mixed with other inputs")
+			}
+			return opts.verifyGoFiles(args)
+		}
+
+		// the rows of -batch-file may each set the ratio instead
+		var (
+			x, y int
+			err  error
+		)
+		if opts.Ratio != "" || opts.BatchFile == "" {
+			if x, y, err = ratioSizes(opts); err != nil {
+				return err
+			}
+		}
+		if err := checkConvert(opts); err != nil {
+			return err
+		}
+		if opts.Overlays, err = loadOverlays(overlays); err != nil {
+			return err
+		}
+
+		if tune {
+			switch {
+			case len(args) != 1 || drawn || base64Data != "" || fromBase64 != "":
+				return usagef("error: -tune tunes the conversion of a single input")
+			case watch || strings.Contains(opts.Ratio, ","):
+				return usagef("error: -tune can't be used with -watch or several ratios")
+			case opts.DitherMatrix != nil:
+				return usagef("error: -tune cycles through the built-in dithering algorithms, it can't be used with -dither-matrix")
+			}
+			return opts.Tune(fs, args[0], x, y)
+		}
+		if watch && opts.Verify {
+			return usagef("error: -watch and -verify cannot be combined")
+		}
+		if opts.Timings && opts.Verify {
+			return usagef("error: -timings differ from one run to the next, they can't be verified")
+		}
+		if watch {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			if err := opts.Watch(ctx, args, x, y); err != nil {
+				return fmt.Errorf("error: %v", err)
+			}
+			return nil
+		}
+
+		if opts.Template != "" {
+			inputs, err := opts.templateInputs()
+			if err != nil {
+				return err
+			}
+			converted, failed := opts.ConvertInputs(inputs, x, y)
+			if converted+len(failed) > 1 {
+				logger.Infof("converted %d input(s), %d failed", converted, len(failed))
+			}
+			return failures(failed)
+		}
+		if drawn {
+			var (
+				in  Input
+				err error
+			)
+			if opts.QR != "" {
+				// dithering could only blur the edges of the modules
+				opts.DisableDithering = true
+				in, err = opts.qrInput()
+			} else {
+				in, err = opts.textInput()
+			}
+			if err != nil {
+				return err
+			}
+			_, failed := opts.ConvertInputs([]Input{in}, x, y)
+			return failures(failed)
+		}
+
+		if opts.BatchFile != "" {
+			inputs, err := opts.batchInputs()
+			if err != nil {
+				return err
+			}
+			if err := opts.checkInputCount(len(inputs)); err != nil {
+				return err
+			}
+			converted, failed := opts.ConvertInputs(inputs, x, y)
+			if converted+len(failed) > 1 {
+				logger.Infof("converted %d input(s), %d failed", converted, len(failed))
+			}
+			return failures(failed)
+		}
+
+		converted, failed := opts.ConvertAll(args, x, y)
+		if converted+len(failed) > 1 {
+			logger.Infof("converted %d input(s), %d failed", converted, len(failed))
+		}
+		return failures(failed)
+	}
+}
+
+// ratioSizes checks the ratios listed in -ratio, each of which is converted
+// to (see convertInput), and returns the size of the first one
+func ratioSizes(opts *Options) (int, int, error) {
+	var x, y int
+	for i, ratio := range strings.Split(opts.Ratio, ",") {
+		r, err := opts.ratioSize(ratio)
+		if err != nil {
+			return 0, 0, usageError{err}
+		}
+		opts.warnSwapped(ratio, r)
+		rx, ry := r.Width, r.Height
+		if opts.Grid != "" || opts.Tile != "" {
+			// a sheet must divide into cells, which are padded to what
+			// can be packed
+			_, _, _, _, err = opts.sheetCells(rx, ry)
+		} else {
+			// must use a y value divisble by 8 as we write the bits one byte at a time
+			// (or, for row major panels, a width that fills whole bytes)
+			err = opts.Palette.Validate(rx, ry)
+			if err == nil && opts.Region != "" {
+				err = opts.checkRegion(rx, ry)
+			}
+		}
+		if err != nil {
+			// flags asking for what can't be done at the ratio
+			return 0, 0, classify(badgeimg.ErrBadRatio, err)
+		}
+		if i == 0 {
+			x, y = rx, ry
+		}
+	}
+	return x, y, nil
+}
+
+// checkContactSheet checks the options of -contact-sheet, which draws bin
+// files without the rest of a conversion
+func checkContactSheet(opts *Options) error {
+	switch {
+	case (opts.ContactColumns != 0 || opts.ContactPadding != compareGap) && opts.ContactSheet == "":
+		return usagef("error: -contact-columns and -contact-padding can only be used with -contact-sheet")
+	case opts.ContactColumns < 0 || opts.ContactPadding < 0:
+		return usagef("error: -contact-columns and -contact-padding can't be negative")
+	case opts.ContactSheet != "" && (opts.Grid != "" || opts.Tile != "" || opts.Region != "" || opts.Marquee):
+		return usagef("error: -contact-sheet draws whole images, it can't be used with -grid, -tile, -region or -marquee")
+	}
+	return nil
+}
+
+// checkConvert checks the options of a conversion
+func checkConvert(opts *Options) error {
+	modes := opts.outModes()
+	fileModes := 0
+	for i, mode := range modes {
+		if !slices.Contains(outModes, mode) {
+			return usagef("error: invalid outmode `%s`", mode)
+		}
+		if slices.Contains(modes[:i], mode) {
+			return usagef("error: outmode `%s` is listed twice", mode)
+		}
+		if writesFiles(mode) {
+			fileModes++
+		}
+	}
+	if len(modes) > 1 && opts.hasOutMode("none") {
+		return usagef("error: outmode none can't be combined with other modes")
+	}
+	if len(modes) > 1 && opts.hasOutMode("slideshow") {
+		return usagef("error: outmode slideshow can't be combined with other modes")
+	}
+	if opts.hasOutMode("pbm") && opts.Palette != MonoPalette && opts.Palette.Planes != "separate" {
+		return usagef("error: -outmode pbm only holds black and white images")
+	}
+	if opts.DedupeFrames == "global" && slices.ContainsFunc(modes, func(mode string) bool { return mode != "rice" && mode != "slideshow" }) {
+		return usagef("error: -dedupe-frames=global needs an output holding the sequence of the frames, -outmode rice or slideshow")
+	}
+	if opts.OutMode == "slideshow" {
+		// the slides are found by their fixed size, and described by the
+		// header of the slideshow
+		switch {
+		case strings.Contains(opts.Ratio, ","):
+			return usagef("error: a slideshow holds images of a single ratio")
+		case opts.Grid != "" || opts.Tile != "":
+			return usagef("error: -grid and -tile can't be used with -outmode slideshow")
+		case opts.Header || opts.Compress != "" || opts.Checksum != "":
+			return usagef("error: -header, -compress and -checksum can't be used with -outmode slideshow")
+		}
+		if !strings.HasSuffix(opts.Output, ".go") && (opts.VarName != "" || opts.Package != "" || opts.Export) {
+			return usagef("error: -var, -pkg and -export can only be used with a slideshow written to a .go file")
+		}
+		fileModes++
+	}
+	switch {
+	case opts.Output != "" && fileModes == 0:
+		return usagef("error: -o can only be used with -outmode rice, bin, pbm, cheader or python")
+	case opts.Output != "" && fileModes > 1:
+		return usagef("error: -o can only be used with a single one of the modes writing files")
+	case opts.Output == stdinName && opts.hasOutMode("base64"):
+		return usagef("error: -o - can't be used with -outmode base64, which writes to stdout too")
+	}
+	switch {
+	case opts.Embed && !opts.hasOutMode("bin"):
+		return usagef("error: -embed can only be used with -outmode bin")
+	case opts.Embed && opts.hasOutMode("rice"):
+		return usagef("error: -embed can't be combined with -outmode rice, as both would declare the variable of the image")
+	case opts.Embed && opts.Output == stdinName:
+		return usagef("error: -embed can't be used when writing to stdout")
+	}
+	if ratios := strings.Split(opts.Ratio, ","); len(ratios) > 1 {
+		for i, ratio := range ratios {
+			if slices.Contains(ratios[:i], ratio) {
+				return usagef("error: ratio `%s` is listed twice", ratio)
+			}
+		}
+		switch {
+		case opts.Output != "":
+			return usagef("error: -o can't be used with several ratios, as they are written to files of their own")
+		case opts.Compare != "" || opts.PaletteReport != "" || opts.Preview != "" || opts.PreviewGIF != "":
+			return usagef("error: -compare, -palette-report, -preview and -preview-gif can't be used with several ratios")
+		}
+	}
+	if opts.Verify && (opts.Output == stdinName || opts.Manifest == stdinName) {
+		return usagef("error: -verify compares files, it can't check what is written to stdout")
+	}
+	if opts.Stats && opts.Palette != MonoPalette {
+		return usagef("error: -stats only counts the pixels of black and white images")
+	}
+	if opts.Region != "" && (opts.Grid != "" || opts.Tile != "" || opts.Bundle != "" || opts.OutMode == "slideshow") {
+		return usagef("error: -region can't be used with -grid, -tile, -bundle or -outmode slideshow")
+	}
+	if err := checkContactSheet(opts); err != nil {
+		return err
+	}
+	if err := checkSend(opts); err != nil {
+		return err
+	}
+	switch {
+	case (opts.MarqueeStep != 0 || opts.MarqueeWrap) && !opts.Marquee:
+		return usagef("error: -marquee-step and -marquee-wrap can only be used with -marquee")
+	case opts.MarqueeStep < 0:
+		return usagef("error: -marquee-step must be positive, or 0 for the whole banner")
+	case opts.Marquee && (opts.Grid != "" || opts.Tile != "" || opts.Region != ""):
+		return usagef("error: -marquee can't be used with -grid, -tile or -region")
+	case opts.Marquee && opts.Anchor != "":
+		return usagef("error: -marquee scales images to the height of -ratio, it can't be used with -anchor")
+	case opts.Marquee && (opts.Bundle != "" || opts.PreviewGIF != ""):
+		return usagef("error: -marquee can't be used with -bundle or -preview-gif")
+	case opts.Marquee && opts.Template != "":
+		return usagef("error: -marquee can't be used with -template, which draws the badge at the size of -ratio")
+	case opts.Marquee && opts.OutMode == "slideshow" && opts.MarqueeStep == 0:
+		return usagef("error: a slideshow holds images the size of the display, slice the -marquee banner with -marquee-step")
+	}
+	switch {
+	case opts.Grid != "" && opts.Tile != "":
+		return usagef("error: -grid and -tile cannot be combined")
+	case (opts.Grid != "" || opts.Tile != "") && (opts.Bundle != "" || opts.Compare != "" || opts.PaletteReport != "" || opts.PreviewGIF != ""):
+		return usagef("error: -grid and -tile can't be used with -bundle, -compare, -palette-report or -preview-gif")
+	}
+	switch opts.Align {
+	case "left", "center", "right":
+	default:
+		return usagef("error: invalid -align `%s`, expected left, center or right", opts.Align)
+	}
+	switch {
+	case opts.Text == "" && (opts.TextFont != "" || opts.Fit || opts.Shrink):
+		return usagef("error: -text-font, -fit and -shrink can only be used with -text")
+	case opts.Fit && opts.Shrink:
+		return usagef("error: -fit and -shrink cannot be combined, -fit already sizes the text to fit")
+	case opts.TextSize <= 0:
+		return usagef("error: -text-size must be positive")
+	}
+	if opts.Bundle != "" {
+		switch {
+		case opts.OutMode != "rice":
+			return usagef("error: -bundle can only be used with -outmode rice")
+		case opts.Output != "":
+			return usagef("error: -bundle and -o cannot be combined")
+		case opts.VarName != "" || opts.Export:
+			return usagef("error: -bundle can't be used with -var or -export, as its variables are always Assets and LookupAsset")
+		case opts.Compress != "":
+			return usagef("error: -bundle can't be used with -compress")
+		case opts.Checksum == "append" || opts.Checksum == "sidecar":
+			return usagef("error: -bundle can't be used with -checksum %s", opts.Checksum)
+		}
+	}
+	switch {
+	case opts.GoFormat != "" && opts.GoFormat != "image":
+		return usagef("error: invalid -gofmt `%s`, the only one is image", opts.GoFormat)
+	case opts.GoFormat != "" && !opts.hasOutMode("rice"):
+		return usagef("error: -gofmt can only be used with -outmode rice")
+	case opts.GoFormat != "" && opts.Bundle != "":
+		return usagef("error: -gofmt can't be used with -bundle")
+	case opts.GoFormat != "" && opts.Palette != MonoPalette:
+		return usagef("error: -gofmt image only unpacks black and white images")
+	case opts.ImportRuntime && opts.GoFormat == "":
+		return usagef("error: -import-runtime needs -gofmt image")
+	case opts.GoData != "" && !slices.Contains(goDataEncodings, opts.GoData):
+		return usagef("error: invalid -go-data `%s`, use one of: %s", opts.GoData, strings.Join(goDataEncodings, ", "))
+	case opts.goData() && !opts.hasOutMode("rice"):
+		return usagef("error: -go-data %s can only be used with -outmode rice", opts.GoData)
+	case opts.goData() && opts.Bundle != "":
+		return usagef("error: -go-data %s can't be used with -bundle", opts.GoData)
+	}
+	// Go code is written in rice mode, and next to bin files with -embed
+	writesGo := opts.hasOutMode("rice") || opts.Embed || strings.HasSuffix(opts.Output, ".go") && opts.OutMode == "slideshow"
+	if opts.Package != "" && !writesGo {
+		return usagef("error: -pkg can only be used with -outmode rice, or bin with -embed")
+	}
+	if opts.Export && !writesGo {
+		return usagef("error: -export can only be used with -outmode rice, or bin with -embed")
+	}
+	if opts.Package != "" {
+		if err := checkGoName("-pkg", opts.Package, opts.goPackage()); err != nil {
+			return usageError{err}
+		}
+	}
+	if opts.VarName != "" && (opts.hasOutMode("rice") || opts.OutMode == "slideshow") {
+		if err := checkGoName("-var", opts.VarName, opts.goVarName("")); err != nil {
+			return usageError{err}
+		}
+	}
+	if opts.VarName != "" && opts.Embed {
+		if err := checkGoName("-var", opts.VarName, opts.embedVarName("")); err != nil {
+			return usageError{err}
+		}
+	}
+	if opts.Header && !opts.hasOutMode("bin") {
+		return usagef("error: -header can only be used with -outmode bin")
+	}
+	switch {
+	case opts.Checksum != "" && !slices.Contains(checksumModes, opts.Checksum):
+		return usagef("error: invalid checksum mode `%s`", opts.Checksum)
+	case (opts.Checksum == "append" || opts.Checksum == "sidecar") && !opts.hasOutMode("bin") && !opts.hasOutMode("rice"):
+		return usagef("error: -checksum %s can only be used with -outmode bin or rice", opts.Checksum)
+	case opts.Checksum == "sidecar" && opts.Output == stdinName:
+		return usagef("error: -checksum sidecar can't be used when writing to stdout")
+	case opts.Checksum == "manifest" && opts.Manifest == "":
+		return usagef("error: -checksum manifest needs -manifest")
+	}
+	if opts.Animation != "split" && opts.Animation != "concat" {
+		return usagef("error: invalid animation mode `%s`", opts.Animation)
+	}
+	switch {
+	case opts.Compress != "" && opts.Compress != "rle":
+		return usagef("error: invalid compression `%s`", opts.Compress)
+	case opts.Compress != "" && !opts.hasOutMode("bin") && !opts.hasOutMode("rice"):
+		return usagef("error: -compress can only be used with -outmode bin or rice")
+	case opts.Compress != "" && opts.hasOutMode("bin") && opts.Animation == "concat":
+		// concatenated frames are found by their fixed size
+		return usagef("error: -compress can't be used with -animation concat")
+	}
+	if err := checkImage(opts); err != nil {
+		return err
+	}
+	if opts.PreviewScale < 1 {
+		return usagef("error: -preview-scale must be at least 1")
+	}
+	if opts.PaletteReportWarn < 1 || opts.PaletteReportWarn > 100 {
+		return usagef("error: -palette-report-warn must be between 1 and 100")
+	}
+	if opts.Jobs < 1 {
+		return usagef("error: -jobs must be at least 1")
+	}
+	if err := checkPlanes(opts); err != nil {
+		return err
+	}
+	return checkLayout(opts)
+}
+
+// setupPreview sets up the preview command: it draws bin files, and base64
+// data, like -show does, and converts the other inputs to draw them
+func setupPreview(fs *flag.FlagSet, opts *Options) func(args []string) error {
+	var (
+		f          flagValues
+		base64Data string
+	)
+	f.paletteFlags(fs)
+	f.layoutFlag(fs)
+	f.planesFlag(fs)
+	f.imageFlags(fs, opts)
+	ratioFlag(fs, opts)
+	showFlags(fs, opts)
+	fs.StringVar(&base64Data, "base64", "", "preview this -outmode base64 data, - to read it from stdin")
+	return func(args []string) error {
+		if len(args) == 0 && base64Data == "" {
+			return usagef("error: nothing to preview")
+		}
+		if err := f.apply(opts); err != nil {
+			return err
+		}
+		if err := checkShow(opts); err != nil {
+			return err
+		}
+		if err := checkImage(opts); err != nil {
+			return err
+		}
+		x, y, err := optionalRatio(opts)
+		if err != nil {
+			return err
+		}
+		opts.Show, opts.OutMode = true, "none"
+		var bins, images []string
+		for _, arg := range args {
+			if strings.HasSuffix(arg, ".bin") {
+				bins = append(bins, arg)
+			} else {
+				images = append(images, arg)
+			}
+		}
+		var failed []error
+		if base64Data != "" || len(bins) > 0 {
+			if err := viewInputs(opts, base64Data, bins, x, y); err != nil {
+				failed = append(failed, err)
+			}
+		}
+		if len(images) > 0 {
+			if x == 0 {
+				return usagef("error: a ratio must be provided to preview images.")
+			}
+			if err := opts.Palette.Validate(x, y); err != nil {
+				return err
+			}
+			_, errs := opts.ConvertAll(images, x, y)
+			failed = append(failed, errs...)
+		}
+		return failures(failed)
+	}
+}
+
+// setupDecode sets up the decode command
+func setupDecode(fs *flag.FlagSet, opts *Options) func(args []string) error {
+	var f flagValues
+	f.paletteFlags(fs)
+	f.layoutFlag(fs)
+	f.planesFlag(fs)
+	ratioFlag(fs, opts)
+	writeFlags(fs, opts)
+	fs.StringVar(&opts.Output, "o", "", "write the PNG to this file, or to stdout with -, instead of next to the bin file")
+	fs.IntVar(&opts.FrameIndex, "frame", -1, "only decode frame N of an animation or slideshow (default: every frame, to numbered PNGs)")
+	return func(args []string) error {
+		if len(args) == 0 {
+			return usagef("error: nothing to decode")
+		}
+		if err := f.apply(opts); err != nil {
+			return err
+		}
+		x, y, err := optionalRatio(opts)
+		if err != nil {
+			return err
+		}
+		return decodeFiles(opts, args, x, y)
+	}
+}
+
+// setupInspect sets up the inspect command
+func setupInspect(fs *flag.FlagSet, opts *Options) func(args []string) error {
+	var f flagValues
+	f.paletteFlags(fs)
+	showFlags(fs, opts)
+	fs.BoolVar(&opts.Show, "show", false, "draw the image of every file too")
+	return func(args []string) error {
+		if len(args) == 0 {
+			return usagef("error: nothing to inspect")
+		}
+		if err := f.apply(opts); err != nil {
+			return err
+		}
+		if err := checkShow(opts); err != nil {
+			return err
+		}
+		return inspectFiles(opts, args)
+	}
+}
+
+// setupDiff sets up the diff command
+func setupDiff(fs *flag.FlagSet, opts *Options) func(args []string) error {
+	var f flagValues
+	f.layoutFlag(fs)
+	f.imageFlags(fs, opts)
+	ratioFlag(fs, opts)
+	fs.BoolVar(&opts.Show, "show", false, "picture the differences: X where the pixels differ, * where both are on")
+	return func(args []string) error {
+		if err := f.apply(opts); err != nil {
+			return err
+		}
+		if err := checkImage(opts); err != nil {
+			return err
+		}
+		x, y, err := optionalRatio(opts)
+		if err != nil {
+			return err
+		}
+		return diffFiles(opts, args, x, y)
+	}
+}
+
+// verifyFiles checks the checksums of bin files, printing "path: OK" for the
+// good ones
+func verifyFiles(paths []string) error {
+	var failed []error
+	for _, path := range paths {
+		if err := VerifyChecksum(path); err != nil {
+			logger.Errorf("error verifying %s: %v", path, err)
+			failed = append(failed, err)
+			continue
+		}
+		fmt.Fprintf(stdout, "%s: OK\n", path)
+	}
+	return failures(failed)
+}
+
+// inspectFiles prints the headers of bin files
+func inspectFiles(opts *Options, paths []string) error {
+	var failed []error
+	for _, path := range paths {
+		if err := opts.Inspect(stdout, path); err != nil {
+			logger.Errorf("error inspecting %s: %v", path, err)
+			failed = append(failed, err)
+		}
+	}
+	return failures(failed)
+}
+
+// viewInputs draws base64 data, if any, and bin files
+func viewInputs(opts *Options, base64Data string, paths []string, x, y int) error {
+	var failed []error
+	if base64Data != "" {
+		data, err := ReadBase64(base64Data)
+		if err == nil {
+			err = opts.View(stdout, "base64", data, x, y)
+		}
+		if err != nil {
+			logger.Errorf("error previewing the base64 data: %v", err)
+			failed = append(failed, err)
+		}
+	}
+	for _, path := range paths {
+		data, err := ReadInput(path)
+		if err == nil {
+			err = opts.View(stdout, path, data, x, y)
+		}
+		if err != nil {
+			logger.Errorf("error previewing %s: %v", path, err)
+			failed = append(failed, err)
+		}
+	}
+	return failures(failed)
+}
+
+// decodeFiles turns bin files back into PNGs
+func decodeFiles(opts *Options, paths []string, x, y int) error {
+	if opts.Output != "" && len(paths) > 1 {
+		return usagef("error: -o can't be used to decode %d files", len(paths))
+	}
+	var failed []error
+	for _, path := range paths {
+		if err := opts.Decode(path, x, y); err != nil {
+			logger.Errorf("error decoding %s: %v", path, err)
+			failed = append(failed, err)
+		}
+	}
+	return failures(failed)
+}
+
+// diffFiles compares two packed images, exiting with 1 when they differ and
+// 2 when they can't be compared
+func diffFiles(opts *Options, paths []string, x, y int) error {
+	if len(paths) != 2 || opts.Palette != MonoPalette {
+		return usagef("error: diff compares two black and white images")
+	}
+	differ, err := opts.Diff(stdout, paths[0], paths[1], x, y)
+	if err != nil {
+		logger.Errorf("error: %v", err)
+		return exitError(2)
+	}
+	if differ {
+		return exitError(1)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runCLI runs the command line args through the command dispatcher,
+// returning its exit code and what it wrote to stdout and stderr
+func runCLI(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	oldStdout, oldStderr := stdout, stderr
+	stdout, stderr = &out, &syncWriter{w: &errOut}
+	defer func() {
+		stdout, stderr = oldStdout, oldStderr
+		log.SetOutput(stderr)
+	}()
+	stubTerminalWidth(t, 0)
+	code := run(args)
+	return code, out.String(), errOut.String()
+}
+
+func TestRunConvert(t *testing.T) {
+	img, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := EncodeToString(NewOptions().ImgToBytes(120, 128, img))
+
+	// without a subcommand the command line is the one from before there
+	// were subcommands
+	for _, args := range [][]string{
+		{"-outmode", "base64", "-ratio", "profile", "testdata/tainigo_128.png"},
+		{"convert", "-outmode", "base64", "-ratio", "profile", "testdata/tainigo_128.png"},
+	} {
+		code, out, _ := runCLI(t, args...)
+		if code != 0 || strings.TrimSpace(out) != want {
+			t.Errorf("%v: expected exit code 0 and the base64 data, got %d and %q", args, code, out)
+		}
+	}
+}
+
+func TestRunUsage(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+		want string
+	}{
+		{nil, 2, "Usage of"},
+		{[]string{"-h"}, 0, "Commands:"},
+		{[]string{"-bogus"}, 2, "flag provided but not defined"},
+		{[]string{"-outmode", "nope", "-ratio", "profile", "testdata/tainigo_128.png"}, 2, "invalid outmode"},
+		{[]string{"decode"}, 2, "nothing to decode"},
+		{[]string{"decode", "-h"}, 0, "decode <bin file>"},
+		{[]string{"inspect", "-outmode", "bin"}, 2, "flag provided but not defined"},
+		{[]string{"diff", "a.bin"}, 2, "compares two black and white images"},
+	}
+	for _, test := range tests {
+		code, out, errOut := runCLI(t, test.args...)
+		if code != test.code || !strings.Contains(errOut, test.want) {
+			t.Errorf("%v: expected exit code %d and %q, got %d and\n%s", test.args, test.code, test.want, code, errOut)
+		}
+		if out != "" {
+			t.Errorf("%v: expected nothing on stdout, got %q", test.args, out)
+		}
+	}
+}
+
+// convertBin converts tainigo_128.png to a profile sized bin file with a
+// header in dir
+func convertBin(t *testing.T, dir string) string {
+	t.Helper()
+	output := filepath.Join(dir, "profile.bin")
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-header", "-ratio", "profile", "-o", output, "testdata/tainigo_128.png"); code != 0 {
+		t.Fatalf("expected the image to convert, got exit code %d and\n%s", code, errOut)
+	}
+	return output
+}
+
+func TestRunPreview(t *testing.T) {
+	bin := convertBin(t, t.TempDir())
+	code, out, _ := runCLI(t, "preview", "-show-width", "60", bin)
+	if code != 0 || !strings.Contains(out, "(shown at 1/2 scale to fit 60 columns)") {
+		t.Errorf("expected a scaled preview, got exit code %d and\n%s", code, out)
+	}
+
+	// images are converted, and drawn on stderr like -show
+	code, _, errOut := runCLI(t, "preview", "-ratio", "8x8", "testdata/tainigo_128.png")
+	if code != 0 || strings.Count(errOut, "\n") != 8 {
+		t.Errorf("expected an 8 line preview, got exit code %d and\n%s", code, errOut)
+	}
+	if code, _, _ := runCLI(t, "preview", "testdata/tainigo_128.png"); code != 2 {
+		t.Errorf("expected an image without a ratio to fail, got exit code %d", code)
+	}
+}
+
+func TestRunDecode(t *testing.T) {
+	dir := t.TempDir()
+	bin := convertBin(t, dir)
+	if code, _, errOut := runCLI(t, "decode", bin); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "profile.png")); err != nil {
+		t.Error(err)
+	}
+	if code, _, _ := runCLI(t, "decode", filepath.Join(dir, "missing.bin")); code != 3 {
+		t.Errorf("expected a missing file to fail, got exit code %d", code)
+	}
+}
+
+func TestRunInspect(t *testing.T) {
+	bin := convertBin(t, t.TempDir())
+	code, out, _ := runCLI(t, "inspect", bin)
+	if code != 0 || !strings.Contains(out, "size: 120x128") {
+		t.Errorf("expected the header, got exit code %d and\n%s", code, out)
+	}
+	// the legacy flag runs the same command
+	if code, legacy, _ := runCLI(t, "-inspect", bin); code != 0 || legacy != out {
+		t.Errorf("expected -inspect to print the same, got exit code %d and\n%s", code, legacy)
+	}
+}
+
+func TestRunDiff(t *testing.T) {
+	dir := t.TempDir()
+	bin := convertBin(t, dir)
+	code, out, _ := runCLI(t, "diff", bin, "testdata/tainigo_128.png")
+	if code != 0 || !strings.Contains(out, "are identical") {
+		t.Errorf("expected identical images, got exit code %d and %q", code, out)
+	}
+	if code, _, _ := runCLI(t, "diff", "-invert", bin, "testdata/tainigo_128.png"); code != 1 {
+		t.Errorf("expected different images to exit with 1, got %d", code)
+	}
+	if code, _, _ := runCLI(t, "diff", "-ratio", "8x8", "testdata/tainigo_128.png", filepath.Join(dir, "missing.bin")); code != 2 {
+		t.Errorf("expected images that can't be compared to exit with 2, got %d", code)
+	}
+}
+
+func TestThresholdAuto(t *testing.T) {
+	code, auto, errOut := runCLI(t, "-v", "-outmode", "base64", "-ratio", "profile", "-threshold", "auto", "testdata/tainigo_128.png")
+	if code != 0 || !strings.Contains(errOut, "Otsu's method picked a threshold of") {
+		t.Fatalf("expected the threshold to be logged, got exit code %d and\n%s", code, errOut)
+	}
+	if code, otsu, _ := runCLI(t, "-outmode", "base64", "-ratio", "profile", "-threshold", "otsu", "testdata/tainigo_128.png"); code != 0 || otsu != auto {
+		t.Errorf("expected -threshold otsu to convert as auto does, got exit code %d", code)
+	}
+	if code, dithered, _ := runCLI(t, "-outmode", "base64", "-ratio", "profile", "testdata/tainigo_128.png"); code != 0 || dithered == auto {
+		t.Errorf("expected -threshold auto not to dither, got exit code %d", code)
+	}
+
+	files := generateIn(t, "gopherbadgeimg", "-outmode", "cheader", "-ratio", "16x16", "-threshold", "auto")
+	for name, content := range files {
+		if !strings.HasSuffix(name, ".h") {
+			continue
+		}
+		if !strings.Contains(content, "dither threshold auto") || !strings.Contains(content, "-threshold auto") {
+			t.Errorf("expected %s to give the threshold as auto, got\n%s", name, content)
+		}
+	}
+
+	for _, threshold := range []string{"half", "-2", "256"} {
+		code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "profile", "-threshold", threshold, "testdata/tainigo_128.png")
+		if code != exitUsage || !strings.Contains(errOut, "-threshold") {
+			t.Errorf("-threshold %s: expected exit code %d, got %d and\n%s", threshold, exitUsage, code, errOut)
+		}
+	}
+}
+
+func TestGamma(t *testing.T) {
+	convert := func(args ...string) string {
+		t.Helper()
+		args = append([]string{"-outmode", "base64", "-ratio", "profile"}, args...)
+		code, out, errOut := runCLI(t, append(args, "testdata/tainigo_128.png")...)
+		if code != 0 {
+			t.Fatalf("%v: exit code %d and\n%s", args, code, errOut)
+		}
+		return out
+	}
+	plain := convert()
+	if got := convert("-gamma", "1"); got != plain {
+		t.Error("expected -gamma 1 to convert as without it")
+	}
+	lighter, darker := convert("-gamma", "2.2"), convert("-gamma", "0.45")
+	if lighter == plain || darker == plain || lighter == darker {
+		t.Error("expected -gamma 2.2 and 0.45 to change the conversion, each its own way")
+	}
+	if got := convert("-gamma", "2.2", "-linear"); got == plain {
+		t.Error("expected -gamma 2.2 in linear light to change the conversion")
+	}
+
+	for _, gamma := range []string{"0.05", "5.5", "bright"} {
+		code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "profile", "-gamma", gamma, "testdata/tainigo_128.png")
+		if code != exitUsage || !strings.Contains(errOut, "-gamma") {
+			t.Errorf("-gamma %s: expected exit code %d, got %d and\n%s", gamma, exitUsage, code, errOut)
+		}
+	}
+}
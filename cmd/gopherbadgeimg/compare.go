@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// layout of the -compare contact sheet, in pixels
+const (
+	compareGap   = 8  // around and between cells
+	compareLabel = 16 // below each cell, for the algorithm name
+)
+
+// CompareSheet converts src at the target size once per dithering algorithm,
+// and with the -dither-matrix kernel if any, plus once without dithering,
+// and lays the results out on a grid with the
+// name of the algorithm under each one.
+//
+// Every cell is exactly what the panel would show, scaled by -preview-scale,
+// so the comparison is an honest one.
+func (o *Options) CompareSheet(x, y int, src image.Image) *image.RGBA {
+	type cell struct {
+		label string
+		opts  Options
+	}
+	var cells []cell
+	for _, algorithm := range badgeimg.DitherAlgorithms {
+		opts := *o
+		opts.Dither, opts.DitherMatrix, opts.DisableDithering, opts.Threshold = algorithm, nil, false, 0
+		cells = append(cells, cell{algorithm, opts})
+	}
+	if o.DitherMatrix != nil {
+		opts := *o
+		opts.DisableDithering, opts.Threshold = false, 0
+		cells = append(cells, cell{"matrix", opts})
+	}
+	none := *o
+	none.DisableDithering = true
+	label := "none"
+	switch {
+	case o.Threshold == badgeimg.ThresholdAuto:
+		label = "threshold auto"
+	case o.Threshold > 0:
+		label = fmt.Sprintf("threshold %d", o.Threshold)
+	}
+	cells = append(cells, cell{label, none})
+
+	cols := int(math.Ceil(math.Sqrt(float64(len(cells)))))
+	rows := (len(cells) + cols - 1) / cols
+	cellW, cellH := x*o.PreviewScale, y*o.PreviewScale
+	sheet := image.NewRGBA(image.Rect(0, 0,
+		cols*cellW+(cols+1)*compareGap,
+		rows*(cellH+compareLabel)+(rows+1)*compareGap,
+	))
+	// a mid gray sets the white and black cells apart from the sheet
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.Gray{0x80}), image.Point{}, draw.Src)
+
+	for i, c := range cells {
+		left := compareGap + (i%cols)*(cellW+compareGap)
+		top := compareGap + (i/cols)*(cellH+compareLabel+compareGap)
+		imgBits := c.opts.ImgToBytes(x, y, &src)
+		preview := RenderPreview(x, y, o.PreviewScale, o.Palette, imgBits)
+		draw.Draw(sheet, image.Rect(left, top, left+cellW, top+cellH), preview, image.Point{}, draw.Src)
+
+		d := font.Drawer{
+			Dst:  sheet,
+			Src:  image.Black,
+			Face: basicfont.Face7x13,
+		}
+		d.Dot = fixed.P(left, top+cellH+basicfont.Face7x13.Ascent+2)
+		d.DrawString(c.label)
+	}
+	return sheet
+}
+
+// writeCompare writes the -compare contact sheet of src
+func (o *Options) writeCompare(path string, x, y int, src image.Image) error {
+	return o.writeFile(path, func(w io.Writer) error {
+		return png.Encode(w, o.CompareSheet(x, y, src))
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func TestCompareSheet(t *testing.T) {
+	// a gradient, which every algorithm renders differently
+	var src image.Image = gradient(64, 32)
+	opts := NewOptions()
+	opts.PreviewScale = 2
+	sheet := opts.CompareSheet(64, 32, src)
+
+	cells := len(badgeimg.DitherAlgorithms) + 1
+	cols, rows := 2, 2
+	if cells != cols*rows {
+		t.Fatalf("expected a 2x2 grid for %d cells", cells)
+	}
+	cellW, cellH := 64*2, 32*2
+	width := cols*cellW + (cols+1)*compareGap
+	height := rows*(cellH+compareLabel) + (rows+1)*compareGap
+	if b := sheet.Bounds(); b.Dx() != width || b.Dy() != height {
+		t.Fatalf("expected a %dx%d sheet, got %v", width, height, b)
+	}
+
+	cellPixels := make([][]byte, cells)
+	for i := range cellPixels {
+		left := compareGap + (i%cols)*(cellW+compareGap)
+		top := compareGap + (i/cols)*(cellH+compareLabel+compareGap)
+		cell := sheet.SubImage(image.Rect(left, top, left+cellW, top+cellH)).(*image.RGBA)
+		for j := 0; j < cellH; j++ {
+			row := cell.Pix[j*cell.Stride : j*cell.Stride+cellW*4]
+			cellPixels[i] = append(cellPixels[i], row...)
+		}
+	}
+	for i := range cellPixels {
+		for j := i + 1; j < len(cellPixels); j++ {
+			if bytes.Equal(cellPixels[i], cellPixels[j]) {
+				t.Errorf("cells %d and %d are identical", i, j)
+			}
+		}
+	}
+}
+
+// gradient returns a horizontal black to white gradient
+func gradient(x, y int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, x, y))
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			img.SetGray(i, j, color.Gray{uint8(i * 255 / (x - 1))})
+		}
+	}
+	return img
+}
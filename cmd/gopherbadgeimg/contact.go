@@ -0,0 +1,164 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// -contact-sheet lays every converted image out on a single PNG, to look them
+// all over at once: cells as large as the largest image, scaled by
+// -preview-scale, on a grid of -contact-columns (as square as it gets by
+// default) spaced by -contact-padding pixels, with the name of each image
+// under it. Smaller images are centered in their cell. Animations and sheets
+// are shown by their first frame. Given bin files instead of images, it draws
+// them as they are, without converting anything.
+
+// contactCell is an image of the contact sheet
+type contactCell struct {
+	name string
+	x, y int
+	data []byte
+}
+
+// DrawContactSheet draws cells on a contact sheet, see -contact-sheet
+func (o *Options) DrawContactSheet(cells []contactCell) *image.RGBA {
+	maxX, maxY := 0, 0
+	for _, c := range cells {
+		maxX, maxY = max(maxX, c.x), max(maxY, c.y)
+	}
+	cols := o.ContactColumns
+	if cols <= 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(len(cells)))))
+	}
+	cols = max(1, min(cols, len(cells)))
+	rows := (len(cells) + cols - 1) / cols
+	pad := o.ContactPadding
+	cellW, cellH := maxX*o.PreviewScale, maxY*o.PreviewScale
+	sheet := image.NewRGBA(image.Rect(0, 0,
+		cols*cellW+(cols+1)*pad,
+		rows*(cellH+compareLabel)+(rows+1)*pad,
+	))
+	// the mid gray of -compare, setting white and black images apart
+	draw.Draw(sheet, sheet.Bounds(), image.NewUniform(color.Gray{0x80}), image.Point{}, draw.Src)
+
+	face := basicfont.Face7x13
+	for i, c := range cells {
+		left := pad + (i%cols)*(cellW+pad)
+		top := pad + (i/cols)*(cellH+compareLabel+pad)
+		w, h := c.x*o.PreviewScale, c.y*o.PreviewScale
+		at := image.Pt(left+(cellW-w)/2, top+(cellH-h)/2)
+		preview := RenderPreview(c.x, c.y, o.PreviewScale, o.Palette, c.data)
+		draw.Draw(sheet, image.Rectangle{at, at.Add(image.Pt(w, h))}, preview, image.Point{}, draw.Src)
+
+		label := contactLabel(c.name, cellW/face.Advance)
+		d := font.Drawer{Dst: sheet, Src: image.Black, Face: face}
+		d.Dot = fixed.P(left+(cellW-len(label)*face.Advance)/2, top+cellH+face.Ascent+2)
+		d.DrawString(label)
+	}
+	return sheet
+}
+
+// contactLabel shortens name to n characters of the built-in font, which only
+// has ASCII: longer names keep their end, which tells numbered files apart
+func contactLabel(name string, n int) string {
+	label := []rune(name)
+	for i, r := range label {
+		if r > '~' {
+			label[i] = '?'
+		}
+	}
+	if len(label) > n && n > 3 {
+		label = append([]rune(".."), label[len(label)-(n-2):]...)
+	} else if len(label) > n {
+		label = label[:max(0, n)]
+	}
+	return string(label)
+}
+
+// writeContactSheet writes the contact sheet of cells to -contact-sheet
+func (o *Options) writeContactSheet(cells []contactCell) error {
+	return o.writeFile(o.ContactSheet, func(w io.Writer) error {
+		return png.Encode(w, o.DrawContactSheet(cells))
+	})
+}
+
+// contactLabelOf returns the label of in converted to ratio: the name of its
+// file, along with the ratio when several are listed
+func (o *Options) contactLabelOf(in Input, ratio string) string {
+	name := in.Name
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(in.Path), filepath.Ext(in.Path))
+	}
+	if strings.Contains(o.Ratio, ",") {
+		name += " " + ratio
+	}
+	return name
+}
+
+// contactSheetBins draws the bin files at paths, and the bin files in the
+// directories among them, on the contact sheet. Files without a header are
+// taken to be x by y.
+func contactSheetBins(opts *Options, paths []string, x, y int) error {
+	var (
+		cells  []contactCell
+		failed []error
+	)
+	for _, path := range paths {
+		files := []string{path}
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			files, _ = filepath.Glob(filepath.Join(path, "*.bin"))
+		}
+		for _, file := range files {
+			data, err := ReadInput(file)
+			if err != nil {
+				logger.Errorf("error reading %s: %v", file, err)
+				failed = append(failed, classify(errInput, err))
+				continue
+			}
+			fx, fy, frames, err := opts.readBin(file, data, x, y, opts.Palette)
+			if err != nil {
+				logger.Errorf("error reading %s: %v", file, err)
+				failed = append(failed, decodeFailed(err))
+				continue
+			}
+			cells = append(cells, contactCell{strings.TrimSuffix(filepath.Base(file), ".bin"), fx, fy, frames[0]})
+		}
+	}
+	if len(cells) == 0 {
+		return failures(failed)
+	}
+	if err := opts.writeContactSheet(cells); err != nil {
+		logger.Errorf("error writing contact sheet: %v", err)
+		failed = append(failed, classify(badgeimg.ErrWrite, err))
+	}
+	return failures(failed)
+}
+
+// onlyBins reports whether args only name bin files, and directories holding
+// them, which -contact-sheet draws as they are
+func onlyBins(args []string) bool {
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err == nil && info.IsDir() {
+			if bins, _ := filepath.Glob(filepath.Join(arg, "*.bin")); len(bins) > 0 {
+				continue
+			}
+			return false
+		}
+		if !strings.HasSuffix(arg, ".bin") {
+			return false
+		}
+	}
+	return len(args) > 0
+}
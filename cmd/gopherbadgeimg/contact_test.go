@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContactLabel(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		n    int
+		want string
+	}{
+		{"gopher", 10, "gopher"},
+		{"gopher-012", 8, "..er-012"},
+		{"gophér", 10, "goph?r"},
+		{"gopher", 2, "go"},
+	} {
+		if got := contactLabel(test.name, test.n); got != test.want {
+			t.Errorf("%q in %d: expected %q, got %q", test.name, test.n, test.want, got)
+		}
+	}
+}
+
+// sameCell reports whether the pixels of sheet at at are those of img
+func sameCell(sheet image.Image, at image.Point, img image.Image) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if color.GrayModel.Convert(sheet.At(at.X+x, at.Y+y)) != color.GrayModel.Convert(img.At(x, y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func TestDrawContactSheet(t *testing.T) {
+	opts := NewOptions()
+	opts.PreviewScale = 2
+	opts.ContactColumns = 2
+	opts.ContactPadding = 4
+	small := make([]byte, 16*16/8)
+	for i := range small {
+		small[i] = 0xf0
+	}
+	large := make([]byte, 32*32/8)
+	for i := range large {
+		large[i] = 0x3c
+	}
+	cells := []contactCell{{"large", 32, 32, large}, {"small", 16, 16, small}, {"other", 32, 32, large}}
+	sheet := opts.DrawContactSheet(cells)
+
+	cellW, cellH := 32*2, 32*2
+	width := 2*cellW + 3*4
+	height := 2*(cellH+compareLabel) + 3*4
+	if b := sheet.Bounds(); b.Dx() != width || b.Dy() != height {
+		t.Fatalf("expected a %dx%d sheet, got %v", width, height, b)
+	}
+	for i, c := range cells {
+		left := 4 + (i%2)*(cellW+4)
+		top := 4 + (i/2)*(cellH+compareLabel+4)
+		// smaller images are centered in their cell
+		at := image.Pt(left+(cellW-c.x*2)/2, top+(cellH-c.y*2)/2)
+		if !sameCell(sheet, at, RenderPreview(c.x, c.y, 2, opts.Palette, c.data)) {
+			t.Errorf("expected %s at %v", c.name, at)
+		}
+	}
+	// the padding and the space around the small image are left gray
+	for _, p := range []image.Point{{1, 1}, {4 + cellW + 5, 5}, {width - 1, height - 1}} {
+		if got := color.GrayModel.Convert(sheet.At(p.X, p.Y)); got != (color.Gray{0x80}) {
+			t.Errorf("expected gray at %v, got %v", p, got)
+		}
+	}
+}
+
+func TestContactSheet(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "in")
+	if err := os.Mkdir(in, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a.png", "b.png", "c.png"} {
+		writeCheckerboard(t, filepath.Join(in, name), 32, 32, i+2, 2)
+	}
+
+	decodeSheet := func(path string) image.Image {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return img
+	}
+
+	sheet := filepath.Join(dir, "sheet.png")
+	outdir := filepath.Join(dir, "out")
+	args := []string{"-recursive", "-outmode", "bin", "-ratio", "32x32", "-outdir", outdir, "-contact-sheet", sheet, "-contact-columns", "2", "-contact-padding", "4"}
+	if code, _, errOut := runCLI(t, append(args, in)...); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	converted := decodeSheet(sheet)
+	if b := converted.Bounds(); b.Dx() != 2*32+3*4 || b.Dy() != 2*(32+compareLabel)+3*4 {
+		t.Fatalf("expected a %dx%d sheet, got %v", 2*32+3*4, 2*(32+compareLabel)+3*4, b)
+	}
+	opts := NewOptions()
+	checkCells := func(sheet image.Image) {
+		t.Helper()
+		for i, name := range []string{"a", "b", "c"} {
+			data, err := os.ReadFile(filepath.Join(outdir, name+"-32x32.bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			at := image.Pt(4+(i%2)*(32+4), 4+(i/2)*(32+compareLabel+4))
+			if !sameCell(sheet, at, RenderPreview(32, 32, 1, opts.Palette, data)) {
+				t.Errorf("expected %s-32x32.bin at %v", name, at)
+			}
+		}
+	}
+	checkCells(converted)
+
+	// the bin files are drawn as they are, without converting anything
+	bins := filepath.Join(dir, "bins.png")
+	if code, _, errOut := runCLI(t, "-ratio", "32x32", "-contact-sheet", bins, "-contact-columns", "2", "-contact-padding", "4", outdir); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	checkCells(decodeSheet(bins))
+
+	for _, args := range [][]string{
+		{"-contact-columns", "2"},
+		{"-contact-sheet", sheet, "-contact-padding", "-1"},
+		{"-contact-sheet", sheet, "-grid", "2x2"},
+	} {
+		args = append([]string{"-outmode", "bin", "-ratio", "32x32"}, args...)
+		if code, _, errOut := runCLI(t, append(args, in)...); code != exitUsage || !strings.Contains(errOut, "error: ") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,1216 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/token"
+	"image"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// Input is one image to convert
+type Input struct {
+	// Path is where the image is read from: a file, "-" for stdin or a URL
+	Path string
+	// Name is what the outputs are named after. It is empty for a lone input,
+	// whose outputs are named after the ratio alone, as they always were.
+	Name string
+	// Data holds the image when it has already been read, e.g. from an archive
+	Data []byte
+	// Draw draws the image at the size it is converted to, for images that
+	// aren't read from anywhere such as -text, in which case Data only
+	// describes it
+	Draw func(x, y int) (image.Image, error)
+	// Options, if set, are what the image is converted with instead of the
+	// options of the batch, such as those of a row of -batch-file, to X by Y
+	Options *Options
+	X, Y    int
+}
+
+// options returns the options in is converted with, and its size, when it is
+// part of a batch converted with o to x by y
+func (in Input) options(o *Options, x, y int) (*Options, int, int) {
+	if in.Options != nil {
+		return in.Options, in.X, in.Y
+	}
+	return o, x, y
+}
+
+func (in Input) String() string {
+	if in.Name != "" {
+		return in.Name
+	}
+	return in.Path
+}
+
+// CollectInputs expands the input argument into the images it refers to:
+// every image inside an archive or (with -recursive) a directory, or the
+// argument itself.
+func (o *Options) CollectInputs(infile string) ([]Input, error) {
+	if archive, entry, ok := splitArchivePath(infile); ok {
+		return ReadArchive(archive, entry)
+	}
+	if infile != stdinName && !IsURL(infile) {
+		if info, err := os.Stat(infile); err == nil && info.IsDir() && o.Recursive {
+			return o.WalkDir(infile)
+		}
+		if err := checkInputFile(infile); err != nil {
+			return nil, err
+		}
+	}
+	return []Input{{Path: infile}}, nil
+}
+
+// expandGlobs expands the glob patterns in args that the shell left alone,
+// which is always the case on Windows. A pattern that matches nothing, or an
+// argument that exists as written, is kept as is.
+func expandGlobs(args []string) []string {
+	var expanded []string
+	for _, arg := range args {
+		if strings.ContainsAny(arg, "*?[") && arg != stdinName && !IsURL(arg) {
+			if _, err := os.Stat(arg); err != nil {
+				if matches, _ := filepath.Glob(arg); len(matches) > 0 {
+					expanded = append(expanded, matches...)
+					continue
+				}
+			}
+		}
+		expanded = append(expanded, arg)
+	}
+	return expanded
+}
+
+// inputName derives the name a batch input's outputs are named after: its
+// path without the extension, so speakers/alice.jpg writes
+// speakers/alice-profile.bin.
+func inputName(infile string) string {
+	switch {
+	case infile == stdinName:
+		return "stdin"
+	case IsURL(infile):
+		infile = path.Base(strings.SplitN(infile, "?", 2)[0])
+	}
+	return strings.TrimSuffix(infile, filepath.Ext(infile))
+}
+
+// ConvertAll converts every input named by args, reporting each failure as it
+// happens, and returns how many were converted and the errors of the others.
+// Unless -fail-fast is set a failure doesn't stop the batch.
+func (o *Options) ConvertAll(args []string, x, y int) (converted int, failed []error) {
+	args = expandGlobs(args)
+	var inputs []Input
+	for _, arg := range args {
+		found, err := o.CollectInputs(arg)
+		if err != nil {
+			logger.Errorf("error loading %s: %v", arg, err)
+			failed = append(failed, classify(errInput, err))
+			if o.FailFast {
+				return converted, failed
+			}
+			continue
+		}
+		for _, in := range found {
+			// a lone input keeps the outputs named after the ratio alone
+			if in.Name == "" && len(args) > 1 {
+				in.Name = inputName(in.Path)
+			}
+			inputs = append(inputs, in)
+		}
+	}
+	if err := o.checkInputCount(len(inputs)); err != nil {
+		logger.Errorf("%v", err)
+		for range inputs {
+			failed = append(failed, err)
+		}
+		return converted, failed
+	}
+	c, f := o.ConvertInputs(inputs, x, y)
+	return converted + c, append(failed, f...)
+}
+
+// checkInputCount checks that the flags naming a single output can be used
+// with n inputs
+func (o *Options) checkInputCount(n int) error {
+	if n < 2 {
+		return nil
+	}
+	// outputs named on the command line can only hold a single input, but
+	// for the slideshow holding them all
+	output := o.Output
+	if o.OutMode == "slideshow" {
+		output = ""
+	}
+	for _, single := range []struct{ flag, path string }{
+		{"-o", output},
+		{"-preview", o.Preview},
+		{"-preview-gif", o.PreviewGIF},
+		{"-compare", o.Compare},
+		{"-palette-report", o.PaletteReport},
+	} {
+		if single.path != "" {
+			return usagef("error: %s can't be used with %d inputs, as they would all be written to %s", single.flag, n, single.path)
+		}
+	}
+	if o.VarName != "" && (o.hasOutMode("rice") || o.Embed) {
+		return usagef("error: -var can't be used with %d inputs in rice mode or with -embed, as their Go files would all declare the same variable", n)
+	}
+	return nil
+}
+
+// ConvertInputs converts inputs on a pool of o.Jobs workers, and writes the
+// manifest of the ones that were converted if -manifest is set, and the
+// -bundle file, slideshow or contact sheet holding them if that is. The warnings of -stats
+// are logged last, together. o.OnProgress is told about each input as it is
+// done with.
+//
+// Inputs whose outputs would be written to the same file, declare the same
+// variable or be bundled under the same name are renamed before anything is
+// converted, rather than racing to write it, or fail with -strict-names (see
+// names.go).
+func (o *Options) ConvertInputs(inputs []Input, x, y int) (converted int, failed []error) {
+	inputs, errs := o.claimNames(inputs)
+	var (
+		mu   sync.Mutex
+		stop bool
+		wg   sync.WaitGroup
+	)
+	results := make([]conversion, len(inputs))
+	next := make(chan int)
+	for w := 0; w < max(1, min(o.Jobs, len(inputs))); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				mu.Lock()
+				stopped := stop
+				mu.Unlock()
+				if stopped {
+					// -fail-fast tripped while this input was being handed over
+					continue
+				}
+				err := errs[i]
+				if err == nil {
+					opts, x, y := inputs[i].options(o, x, y)
+					results[i], err = opts.convertInput(inputs[i], x, y)
+				}
+				mu.Lock()
+				if err != nil {
+					logger.Errorf("error converting %s: %v", inputs[i], err)
+					failed = append(failed, err)
+					stop = stop || o.FailFast
+				} else {
+					converted++
+				}
+				if o.OnProgress != nil {
+					o.OnProgress(Progress{Done: converted + len(failed), Total: len(inputs), Input: inputs[i], Err: err})
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i := range inputs {
+		mu.Lock()
+		stopped := stop
+		mu.Unlock()
+		if stopped {
+			break
+		}
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	var (
+		images   []*ManifestImage
+		entries  []bundleEntry
+		warnings []string
+		cells    []contactCell
+	)
+	for _, r := range results {
+		images = append(images, r.images...)
+		entries = append(entries, r.entries...)
+		warnings = append(warnings, r.warnings...)
+		cells = append(cells, r.cells...)
+	}
+	if len(inputs) > 1 && len(warnings) > 0 {
+		logger.Warnf("%d image(s) came out nearly all black or all white:", len(warnings))
+	}
+	for _, w := range warnings {
+		logger.Warnf("%s", w)
+	}
+	if o.Bundle != "" {
+		if len(entries) == 0 {
+			logger.Debugf("skipping %s: nothing was converted", o.Bundle)
+		} else if err := o.writeBundle(o.Bundle, entries); err != nil {
+			logger.Errorf("error writing bundle: %v", err)
+			failed = append(failed, err)
+		}
+	}
+	if o.OutMode == "slideshow" {
+		if len(entries) == 0 {
+			logger.Debugf("skipping the slideshow: nothing was converted")
+		} else if err := o.writeSlideshow(entries); err != nil {
+			logger.Errorf("error writing slideshow: %v", err)
+			failed = append(failed, err)
+		}
+	}
+	if o.ContactSheet != "" {
+		if len(cells) == 0 {
+			logger.Debugf("skipping the contact sheet: nothing was converted")
+		} else if err := o.writeContactSheet(cells); err != nil {
+			logger.Errorf("error writing contact sheet: %v", err)
+			failed = append(failed, err)
+		}
+	}
+	// with -verify, a manifest leaving out the inputs that failed could only
+	// differ
+	if o.Manifest != "" && !(o.Verify && len(failed) > 0) {
+		if err := o.writeManifest(o.Manifest, images); err != nil {
+			logger.Errorf("error writing manifest: %v", err)
+			failed = append(failed, err)
+		}
+	}
+	return converted, failed
+}
+
+// writesFiles reports whether any of the modes listed in outmode writes
+// files, rather than printing the data or nothing at all
+func writesFiles(outMode string) bool {
+	for _, mode := range strings.Split(outMode, ",") {
+		switch mode {
+		case "rice", "bin", "pbm", "cheader", "python":
+			return true
+		}
+	}
+	return false
+}
+
+// outModes returns the modes listed in -outmode
+func (o *Options) outModes() []string {
+	return strings.Split(o.OutMode, ",")
+}
+
+// hasOutMode reports whether mode is one of the modes listed in -outmode
+func (o *Options) hasOutMode(mode string) bool {
+	return slices.Contains(o.outModes(), mode)
+}
+
+// withOutMode returns a copy of o writing mode alone, which is what the
+// writers of each mode expect
+func (o *Options) withOutMode(mode string) *Options {
+	single := *o
+	single.OutMode = mode
+	return &single
+}
+
+// withRatio returns a copy of o converting to one of the ratios of a -ratio
+// list. Its outputs are named after the ratio, and so is -var, which gets it
+// appended as every ratio declares a variable of its own.
+func (o *Options) withRatio(ratio string) *Options {
+	single := *o
+	single.Ratio = ratio
+	if single.VarName != "" {
+		single.VarName += "_" + ratio
+	}
+	return &single
+}
+
+// varName returns the name of the variable in a C header or Python module:
+// -var, or one derived from the output name
+func (o *Options) varName(base string) string {
+	if o.VarName != "" {
+		return variableName(o.VarName)
+	}
+	return variableName(o.outputName(base))
+}
+
+// outputName returns base, the path of an output without extension, without
+// -outdir: variables are named after it, and mustn't change with the way
+// -outdir was given
+func (o *Options) outputName(base string) string {
+	if o.OutDir == "" {
+		return base
+	}
+	if rel, err := filepath.Rel(o.OutDir, base); err == nil {
+		return rel
+	}
+	return base
+}
+
+// goVarName returns the name of the variable in a rice mode file: -var, or r
+// followed by the output name, as it always was. With -export it is exported,
+// named after -var or the file name of the output.
+func (o *Options) goVarName(base string) string {
+	switch {
+	case o.Export && o.VarName != "":
+		return exportedName(o.VarName)
+	case o.Export:
+		return exportedName(filepath.Base(base))
+	case o.VarName != "":
+		return goIdentifier(o.VarName)
+	}
+	return "r" + identifier(o.outputName(base))
+}
+
+// goPackage returns the package of rice mode files: -pkg, or main
+func (o *Options) goPackage() string {
+	if o.Package != "" {
+		return goIdentifier(o.Package)
+	}
+	return "main"
+}
+
+// outputBase returns the path outputs are named after, without extension,
+// inside -outdir when it is set
+func (o *Options) outputBase(in Input) string {
+	base := o.Ratio
+	if in.Name != "" {
+		base = in.Name + "-" + o.Ratio
+	}
+	return filepath.Join(o.OutDir, base)
+}
+
+// identifier turns an output name into something usable in an identifier in
+// every language that is generated (Go, C and Python): anything but ASCII
+// letters, digits and underscores becomes an underscore.
+func identifier(name string) string {
+	ident := []byte(name)
+	for i, c := range ident {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			ident[i] = '_'
+		}
+	}
+	return string(ident)
+}
+
+// variableName is identifier for a whole variable name, which must start with
+// a letter: names that don't get an img_ prefix. Go variables named after
+// the output don't need it, they are prefixed with r.
+func variableName(name string) string {
+	ident := identifier(name)
+	if ident == "" || !(ident[0] >= 'a' && ident[0] <= 'z' || ident[0] >= 'A' && ident[0] <= 'Z') {
+		return "img_" + ident
+	}
+	return ident
+}
+
+// goIdentifier turns a name given on the command line into a Go identifier:
+// runes that can't be in one are dropped, and an underscore is prepended to a
+// name starting with a digit. Unlike identifier, letters outside ASCII are
+// kept. The result may be empty, or a keyword, see checkGoName.
+func goIdentifier(name string) string {
+	ident := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return -1
+	}, name)
+	if first, _ := utf8.DecodeRuneInString(ident); unicode.IsDigit(first) {
+		ident = "_" + ident
+	}
+	return ident
+}
+
+// exportedName turns a name into an exported Go identifier in camel case:
+// alice-profile becomes AliceProfile. Names that would start with a digit or
+// a letter without case get an Img prefix; names without letters or digits
+// give an empty string.
+func exportedName(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, word := range words {
+		first, size := utf8.DecodeRuneInString(word)
+		b.WriteRune(unicode.ToUpper(first))
+		b.WriteString(word[size:])
+	}
+	ident := b.String()
+	if first, _ := utf8.DecodeRuneInString(ident); ident != "" && !unicode.IsUpper(first) {
+		ident = "Img" + ident
+	}
+	return ident
+}
+
+// checkGoName checks that ident, what the name given to flag turns into, is a
+// usable Go identifier
+func checkGoName(flag, name, ident string) error {
+	switch {
+	case ident == "":
+		return fmt.Errorf("error: %s `%s` has nothing usable in a Go identifier", flag, name)
+	case token.IsKeyword(ident):
+		return fmt.Errorf("error: %s `%s` is a Go keyword", flag, ident)
+	case flag == "-pkg" && ident == "_":
+		return fmt.Errorf("error: -pkg can't be _")
+	}
+	return nil
+}
+
+// conversion is what converting an input leaves for ConvertInputs to write
+// or report once every input is converted
+type conversion struct {
+	// images are the manifest entries describing the conversion at each
+	// ratio, with -manifest
+	images []*ManifestImage
+	// entries are the images to bundle, or the frames of the slideshow
+	entries []bundleEntry
+	// warnings are about images -stats found nearly all black or white
+	warnings []string
+	// cells are the images of the contact sheet
+	cells []contactCell
+}
+
+// convertInput runs a single input through the whole pipeline: decoding it
+// once, then converting every frame and writing the outputs selected by
+// -outmode for each of the ratios listed in -ratio, see convertFrames. It
+// returns what ConvertInputs needs once every input is converted.
+func (o *Options) convertInput(in Input, x, y int) (conversion, error) {
+	data := in.Data
+	if data == nil {
+		var err error
+		if data, err = ReadInput(in.Path); err != nil {
+			return conversion{}, err
+		}
+	}
+	if in.Draw == nil {
+		// archive entries hold their data already
+		if err := checkEmpty(in.Path, data); err != nil {
+			return conversion{}, err
+		}
+	}
+	ratios, err := o.ratios(x, y)
+	if err != nil {
+		return conversion{}, err
+	}
+	// the source is only decoded when a ratio isn't in the -cache-dir cache
+	slots := make([]cacheSlot, len(ratios))
+	if o.cacheable(in) {
+		for i, r := range ratios {
+			slots[i].key = o.cacheKey(data, r.x, r.y)
+			slots[i].hit = o.Cache.Load(slots[i].key)
+		}
+	}
+	// with -timings every ratio is timed on its own, the first one with the
+	// decoding
+	timers := make([]*stageTimer, len(ratios))
+	if o.Timings {
+		for i := range timers {
+			timers[i] = newStageTimer()
+		}
+	}
+	var frames []Frame
+	if in.Draw == nil && slices.ContainsFunc(slots, func(s cacheSlot) bool { return s.hit == nil }) {
+		start := time.Now()
+		m := timers[0].mark()
+		var err error
+		if frames, err = o.decodeFrames(data, o.picksFrame); err != nil {
+			return conversion{}, decodeFailed(fmt.Errorf("error loading source image: %w", err))
+		}
+		timers[0].done(stageDecode, m)
+		logger.Timef(start, "%s: decoded", in)
+		n := len(frames)
+		if frames, err = o.pickFrames(in, frames); err != nil {
+			return conversion{}, err
+		}
+		size := frames[0].Image.Bounds().Size()
+		logger.Debugf("%s: %d frame(s) of %dx%d", in, n, size.X, size.Y)
+	}
+	keys := o.bundleKeys(in)
+	var c conversion
+	for i, r := range ratios {
+		single := o
+		if len(ratios) > 1 {
+			single = o.withRatio(r.name)
+		}
+		if timers[i] != nil {
+			single = single.withTimer(timers[i])
+		}
+		if in.Draw != nil {
+			img, err := in.Draw(r.x, r.y)
+			if err != nil {
+				return conversion{}, err
+			}
+			frames = []Frame{{Image: img}}
+		}
+		image, packed, stats, err := single.convertFrames(in, data, frames, r.x, r.y, slots[i])
+		if err != nil {
+			return conversion{}, err
+		}
+		if timers[i] != nil {
+			logger.Infof("%s at %dx%d: %v", in, r.x, r.y, timers[i])
+		}
+		if image != nil {
+			c.images = append(c.images, image)
+		}
+		if stats != nil {
+			logger.Infof("%s at %dx%d: %v", in, r.x, r.y, stats)
+			if w := stats.warning(); w != "" {
+				c.warnings = append(c.warnings, fmt.Sprintf("%s at %dx%d %s", in, r.x, r.y, w))
+			}
+		}
+		if o.ContactSheet != "" && len(packed) > 0 {
+			// -contact-sheet isn't used with the flags changing the size
+			c.cells = append(c.cells, contactCell{o.contactLabelOf(in, r.name), r.x, r.y, packed[0]})
+		}
+		if o.Bundle != "" || o.OutMode == "slideshow" {
+			// a bundle holds still images only, a slideshow every frame
+			for _, frame := range packed {
+				c.entries = append(c.entries, bundleEntry{keys[i], o.layoutBytes(r.x, r.y, frame), r.x, r.y})
+			}
+		}
+	}
+	return c, nil
+}
+
+// pickFrames returns the frames of in that -frame or -frames pick, all of
+// them without either
+func (o *Options) pickFrames(in Input, frames []Frame) ([]Frame, error) {
+	if o.FrameIndex >= 0 {
+		if o.FrameIndex >= len(frames) {
+			return nil, fmt.Errorf("error: frame %d requested but the image only has %d frame(s)", o.FrameIndex, len(frames))
+		}
+		frames = frames[o.FrameIndex : o.FrameIndex+1]
+	}
+	if o.Frames != "" {
+		return o.selectFrames(in, frames)
+	}
+	return frames, nil
+}
+
+// convertFrames converts the decoded frames of in to x by y and writes them,
+// returning the manifest entry describing the conversion with -manifest, the
+// data of every frame, and with -stats how many of their pixels are on. The
+// conversion is taken from slot when it is a hit, and stored in it otherwise.
+func (o *Options) convertFrames(in Input, data []byte, frames []Frame, x, y int, slot cacheSlot) (*ManifestImage, [][]byte, *Stats, error) {
+	var (
+		packed [][]byte
+		delays []int
+		// the size of the ratio, before -region or -marquee change it
+		ratio = Ratio{x, y}
+	)
+	if slot.hit != nil {
+		logger.Debugf("%s: reusing the cached conversion to %dx%d", in, x, y)
+		packed, delays, x, y = slot.hit.Frames, slot.hit.Delays, slot.hit.X, slot.hit.Y
+	} else {
+		var err error
+		if packed, delays, x, y, err = o.packFrames(in, frames, x, y); err != nil {
+			return nil, nil, nil, err
+		}
+		if slot.key != "" {
+			entry := &cacheEntry{X: x, Y: y, Frames: packed, Delays: delays}
+			if err := o.Cache.Store(slot.key, entry); err != nil {
+				logger.Warnf("%s: the conversion couldn't be cached: %v", in, err)
+			}
+		}
+	}
+
+	var stats *Stats
+	if o.Stats {
+		var err error
+		if stats, err = frameStats(packed, x, y); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	if o.Bundle != "" || o.OutMode == "slideshow" {
+		if o.Bundle != "" && len(packed) > 1 {
+			return nil, nil, nil, fmt.Errorf("error: -bundle only holds still images, pick one of the %d frames with -frame", len(packed))
+		}
+		// written once every input is converted
+		if o.Manifest == "" {
+			return nil, packed, stats, nil
+		}
+		image, err := o.manifestImage(in, data, x, y, packed, delays, nil, stats)
+		return image, packed, stats, err
+	}
+
+	base := o.outputBase(in)
+	if dir := filepath.Dir(base); dir != "." && !o.Verify {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, nil, nil, classify(badgeimg.ErrWrite, err)
+		}
+	}
+	var (
+		written []string
+		err     error
+	)
+	if o.hasOutMode("rice") || o.Embed {
+		o = o.withProvenance(in, data, ratio, packed)
+	}
+	start := time.Now()
+	m := o.timer.mark()
+	if len(packed) > 1 {
+		written, err = o.writeFrames(base, x, y, packed, delays)
+	} else {
+		written, err = o.writeImg(base, x, y, packed[0])
+	}
+	o.timer.done(stageEmit, m)
+	logger.Timef(start, "%s: wrote the outputs at %dx%d", in, x, y)
+	if err != nil || o.Manifest == "" {
+		return nil, packed, stats, err
+	}
+	image, err := o.manifestImage(in, data, x, y, packed, delays, written, stats)
+	return image, packed, stats, err
+}
+
+// packFrames converts the decoded frames of in to x by y, returning the data
+// and delay of every frame and their size, which -region and -marquee change.
+// The cells of a sheet sliced by -grid or -tile, and the windows of a
+// -marquee banner, are returned as frames without delays.
+func (o *Options) packFrames(in Input, frames []Frame, x, y int) ([][]byte, []int, int, int, error) {
+	logger.Debugf("%s: converting to %dx%d, %s", in, x, y, o.ditherMethod())
+	if err := o.checkUpscale(in, frames[0].Image, x, y); err != nil {
+		return nil, nil, 0, 0, err
+	}
+	if o.Compare != "" {
+		// the first frame stands for the whole animation
+		if err := o.writeCompare(o.Compare, x, y, frames[0].Image); err != nil {
+			return nil, nil, 0, 0, fmt.Errorf("error writing comparison sheet: %w", err)
+		}
+	}
+	if o.PaletteReport != "" {
+		if err := o.writePaletteReport(in, x, y, frames[0].Image); err != nil {
+			return nil, nil, 0, 0, fmt.Errorf("error writing palette report: %w", err)
+		}
+	}
+	start := time.Now()
+	packed := make([][]byte, len(frames))
+	delays := make([]int, len(frames))
+	if o.Grid != "" || o.Tile != "" {
+		if len(frames) > 1 {
+			return nil, nil, 0, 0, fmt.Errorf("error: -grid and -tile slice still images, pick one of the %d frames with -frame", len(frames))
+		}
+		// the cells of a sheet are written as frames without delays
+		var err error
+		if packed, x, y, err = o.sliceSheet(frames[0].Image, x, y); err != nil {
+			return nil, nil, 0, 0, err
+		}
+		delays = nil
+	} else if o.Marquee {
+		if len(frames) > 1 {
+			return nil, nil, 0, 0, fmt.Errorf("error: -marquee scrolls still images, pick one of the %d frames with -frame", len(frames))
+		}
+		// the windows of a banner are written as frames without delays too
+		var err error
+		if packed, x, err = o.marquee(frames[0].Image, x, y); err != nil {
+			return nil, nil, 0, 0, err
+		}
+		delays = nil
+	} else if o.Region != "" {
+		// checked against the display by checkRegion
+		r, err := parseRegion(o.Region)
+		if err != nil {
+			return nil, nil, 0, 0, err
+		}
+		for i, frame := range frames {
+			packed[i] = o.regionBytes(r, x, y, frame.Image)
+			delays[i] = frame.Delay
+		}
+		x, y = r.Dx(), r.Dy()
+	} else {
+		for i, frame := range frames {
+			packed[i] = o.ImgToBytes(x, y, &frame.Image)
+			delays[i] = frame.Delay
+		}
+	}
+	logger.Timef(start, "%s: converted to %dx%d", in, x, y)
+	if o.DedupeFrames != "" && delays != nil {
+		n := len(packed)
+		if packed, delays = collapseRuns(packed, delays); len(packed) < n {
+			logger.Debugf("%s: collapsed %d identical frame(s)", in, n-len(packed))
+		}
+	}
+	delays, clamped := o.retime(delays)
+	if clamped > 0 {
+		logger.Warnf("%s: %d frame delay(s) under %dms were raised to %dms", in, clamped, minFrameDelay, minFrameDelay)
+	}
+	return packed, delays, x, y, nil
+}
+
+// writeOutput writes an output through write: to name, or to wherever -o
+// points instead, stdout included. It returns the path of the file written,
+// which is empty for stdout.
+func (o *Options) writeOutput(name string, write func(w io.Writer) error) (string, error) {
+	switch o.Output {
+	case stdinName:
+		// "-" is stdout here, as it is stdin for inputs
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			return "", err
+		}
+		_, err := stdout.Write(buf.Bytes())
+		return "", classify(badgeimg.ErrWrite, err)
+	case "":
+	default:
+		name = o.Output
+	}
+	return name, o.writeFile(name, write)
+}
+
+// outputDir returns the directory the output named name is written to, the
+// one of -o when it names a file instead
+func (o *Options) outputDir(name string) string {
+	if o.Output != "" && o.Output != stdinName {
+		name = o.Output
+	}
+	return filepath.Dir(name)
+}
+
+// framePath returns the path of frame i of an animation split into files
+func framePath(path string, i int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%03d%s", strings.TrimSuffix(path, ext), i, ext)
+}
+
+// compress applies -compress to packed image bytes
+func (o *Options) compress(imgBits []byte) []byte {
+	if o.Compress == "rle" {
+		return EncodeRLE(imgBits)
+	}
+	return imgBits
+}
+
+// compressFrames applies -compress to every frame
+func (o *Options) compressFrames(frames [][]byte) [][]byte {
+	compressed := make([][]byte, len(frames))
+	for i, frame := range frames {
+		compressed[i] = o.compress(frame)
+	}
+	return compressed
+}
+
+// binExt returns the extension of bin mode outputs
+func (o *Options) binExt() string {
+	if o.Compress == "rle" {
+		return ".rle.bin"
+	}
+	return ".bin"
+}
+
+// writeGo writes a rice mode output through write, formatted with gofmt as
+// WriteToGoFile does. Compressed data needs DecodeRLE, and -gofmt image
+// unpackGray unless -import-runtime, which go into the output too when it is
+// stdout, or else into files of their own next to it. It returns the paths of
+// the files written.
+func (o *Options) writeGo(base string, write func(w io.Writer) error) ([]string, error) {
+	path, err := o.writeOutput(base+"-generated.go", func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := write(&buf); err != nil {
+			return err
+		}
+		if o.Compress == "rle" && o.Output == stdinName {
+			buf.WriteString("\n" + rleDecoderSource)
+		}
+		if o.GoFormat == "image" && !o.ImportRuntime && o.Output == stdinName {
+			buf.WriteString("\n" + grayUnpackerSource)
+		}
+		if o.provenance != nil {
+			buf.WriteString(o.provenance.String())
+		}
+		src, err := format.Source(insertGoImports(buf.Bytes(), o.goImports()))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(src)
+		return err
+	})
+	if err != nil || path == "" {
+		return nil, err
+	}
+	written := []string{path}
+	if o.Compress == "rle" {
+		decoder, err := o.writeRLEDecoder(path)
+		written = append(written, decoder)
+		if err != nil {
+			return written, err
+		}
+	}
+	if o.GoFormat == "image" && !o.ImportRuntime {
+		unpacker, err := o.writeGrayUnpacker(path)
+		written = append(written, unpacker)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// writeImg writes a converted image in each of the formats listed in
+// -outmode, and returns the paths of the files written
+func (o *Options) writeImg(base string, x, y int, imgBits []byte) ([]string, error) {
+	var written []string
+	for _, out := range o.planeOutputs(base, x, y, [][]byte{imgBits}) {
+		for _, mode := range o.outModes() {
+			paths, err := out.opts.withOutMode(mode).writeImgAs(out.base, x, y, out.frames[0])
+			written = append(written, paths...)
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+	if o.Preview != "" {
+		if err := o.writePreview(o.Preview, x, y, imgBits); err != nil {
+			return written, fmt.Errorf("error writing preview: %w", err)
+		}
+	}
+	if o.PreviewGIF != "" {
+		if err := o.writePreviewGIF(o.PreviewGIF, x, y, [][]byte{imgBits}, []int{0}); err != nil {
+			return written, fmt.Errorf("error writing preview: %w", err)
+		}
+	}
+	if o.Send != "" {
+		if err := o.sendImg(x, y, imgBits); err != nil {
+			return written, fmt.Errorf("error sending image to %s: %w", o.Send, err)
+		}
+	}
+	if o.Show {
+		var preview bytes.Buffer
+		o.showImg(&preview, x, y, imgBits)
+		stderr.Write(preview.Bytes())
+	}
+	return written, nil
+}
+
+// writeImgAs writes a converted image, packed with -layout or -planes, in the
+// single format of -outmode, see withOutMode, and returns the paths of the files
+// written
+func (o *Options) writeImgAs(base string, x, y int, imgBits []byte) ([]string, error) {
+	var (
+		written []string
+		path    string
+		err     error
+	)
+	switch o.OutMode {
+	case "rice":
+		written, err = o.writeGo(base, func(w io.Writer) error {
+			data := o.compress(imgBits)
+			name, header := o.goVarName(base), o.generatedHeader("//", "//go:generate ", o.outputDir(base))
+			var err error
+			if o.goData() {
+				err = fprintGoData(w, header, o.goPackage(), name, [][]byte{data}, nil, false, o.GoData)
+			} else {
+				err = FprintGo(w, header, o.goPackage(), name, data)
+			}
+			if err != nil {
+				return err
+			}
+			if err := fprintGoSize(w, name, x, y); err != nil {
+				return err
+			}
+			if err := fprintGoPacking(w, name, len(data), o.layoutName(), o.bitOrderName()); err != nil {
+				return err
+			}
+			if o.Export {
+				if err := fprintGoAccessor(w, name, false); err != nil {
+					return err
+				}
+			}
+			if o.GoFormat == "image" {
+				if err := o.fprintGoGray(w, name, false); err != nil {
+					return err
+				}
+			}
+			if err := o.fprintGoOffset(w, name); err != nil {
+				return err
+			}
+			if o.Checksum == "" {
+				return nil
+			}
+			return fprintGoChecksums(w, name, [][]byte{data})
+		})
+	case "bin":
+		path, err = o.writeOutput(base+o.binExt(), func(w io.Writer) error {
+			_, err := w.Write(o.withChecksum(o.withHeader(x, y, o.compress(imgBits), false)))
+			return err
+		})
+	case "pbm":
+		path, err = o.writeOutput(base+".pbm", func(w io.Writer) error {
+			return EncodePBM(w, x, y, imgBits, o.Layout)
+		})
+	case "cheader":
+		path, err = o.writeOutput(base+".h", func(w io.Writer) error {
+			return FprintCHeader(w, o.generatedHeader("//", "", o.outputDir(base)), o.varName(base), x, y, [][]byte{imgBits}, nil, o.Progmem)
+		})
+	case "python":
+		path, err = o.writeOutput(base+".py", func(w io.Writer) error {
+			return FprintPython(w, o.generatedHeader("#", "", o.outputDir(base)), o.varName(base), x, y, [][]byte{imgBits}, nil, o.BytesLiteral)
+		})
+	case "base64":
+		fmt.Fprintln(stdout, EncodeToString(imgBits))
+	case "none":
+		// this option is useful if you want to preview the file without creating it
+	}
+	if path != "" {
+		written = append(written, path)
+	}
+	if err == nil {
+		written, err = o.writeChecksums(written)
+	}
+	if err == nil && o.Embed && o.OutMode == "bin" && path != "" {
+		var embed string
+		embed, err = o.writeEmbed(path, x, y)
+		written = append(written, embed)
+	}
+	if err != nil {
+		return written, fmt.Errorf("error writing image to file: %w", err)
+	}
+	return written, nil
+}
+
+// writeFrames is the multi-frame counterpart of writeImg, also writing the
+// cells of a sheet sliced by -grid or -tile, which have no delays
+func (o *Options) writeFrames(base string, x, y int, frames [][]byte, delays []int) ([]string, error) {
+	if o.Send != "" {
+		return nil, fmt.Errorf("error: -send sends single images, not the %d frames or cells of %s", len(frames), base)
+	}
+	var written []string
+	for _, out := range o.planeOutputs(base, x, y, frames) {
+		for _, mode := range o.outModes() {
+			paths, err := out.opts.withOutMode(mode).writeFramesAs(out.base, x, y, out.frames, delays)
+			written = append(written, paths...)
+			if err != nil {
+				return written, err
+			}
+		}
+	}
+	if o.Preview != "" {
+		for i, frame := range frames {
+			if err := o.writePreview(framePath(o.Preview, i), x, y, frame); err != nil {
+				return written, fmt.Errorf("error writing preview: %w", err)
+			}
+		}
+	}
+	if o.PreviewGIF != "" {
+		if err := o.writePreviewGIF(o.PreviewGIF, x, y, frames, delays); err != nil {
+			return written, fmt.Errorf("error writing preview: %w", err)
+		}
+	}
+	if o.Show {
+		var preview bytes.Buffer
+		for i, frame := range frames {
+			if delays == nil {
+				fmt.Fprintf(&preview, "cell %d:\n", i)
+			} else {
+				fmt.Fprintf(&preview, "frame %d (%dms):\n", i, delays[i])
+			}
+			o.showImg(&preview, x, y, frame)
+		}
+		stderr.Write(preview.Bytes())
+	}
+	return written, nil
+}
+
+// writeFramesAs is the multi-frame counterpart of writeImgAs
+func (o *Options) writeFramesAs(base string, x, y int, frames [][]byte, delays []int) ([]string, error) {
+	var (
+		written []string
+		path    string
+		err     error
+	)
+	switch o.OutMode {
+	case "rice":
+		written, err = o.writeGo(base, func(w io.Writer) error {
+			// with -dedupe-frames=global the delays go with the sequence
+			stored, frameDelays := frames, delays
+			var sequence []int
+			if o.DedupeFrames == "global" {
+				stored, sequence = uniqueFrames(frames)
+				frameDelays = nil
+			}
+			data := o.compressFrames(stored)
+			name, header := o.goVarName(base), o.generatedHeader("//", "//go:generate ", o.outputDir(base))
+			var err error
+			if o.goData() {
+				err = fprintGoData(w, header, o.goPackage(), name, data, frameDelays, true, o.GoData)
+			} else {
+				err = FprintFramesGo(w, header, o.goPackage(), name, data, frameDelays)
+			}
+			if err != nil {
+				return err
+			}
+			if sequence != nil {
+				if err := fprintGoSequence(w, name, sequence, delays); err != nil {
+					return err
+				}
+			}
+			if err := fprintGoSize(w, name, x, y); err != nil {
+				return err
+			}
+			if err := fprintGoPacking(w, name, frameLen(data), o.layoutName(), o.bitOrderName()); err != nil {
+				return err
+			}
+			if o.Export {
+				if err := fprintGoAccessor(w, name, true); err != nil {
+					return err
+				}
+			}
+			if o.GoFormat == "image" {
+				if err := o.fprintGoGray(w, name, true); err != nil {
+					return err
+				}
+			}
+			if err := o.fprintGoOffset(w, name); err != nil {
+				return err
+			}
+			if o.Checksum == "" {
+				return nil
+			}
+			return fprintGoChecksums(w, name, data)
+		})
+	case "cheader":
+		path, err = o.writeOutput(base+".h", func(w io.Writer) error {
+			return FprintCHeader(w, o.generatedHeader("//", "", o.outputDir(base)), o.varName(base), x, y, frames, delays, o.Progmem)
+		})
+	case "python":
+		path, err = o.writeOutput(base+".py", func(w io.Writer) error {
+			return FprintPython(w, o.generatedHeader("#", "", o.outputDir(base)), o.varName(base), x, y, frames, delays, o.BytesLiteral)
+		})
+	case "bin", "pbm":
+		ext, write := o.binExt(), func(w io.Writer, frame []byte) error {
+			_, err := w.Write(o.withChecksum(o.withHeader(x, y, o.compress(frame), false)))
+			return err
+		}
+		if o.OutMode == "pbm" {
+			ext, write = ".pbm", func(w io.Writer, frame []byte) error {
+				return EncodePBM(w, x, y, frame, o.Layout)
+			}
+		}
+		if o.Animation == "concat" {
+			var concat []byte
+			if o.OutMode != "pbm" {
+				// never compressed, see main
+				if concat, err = ConcatFrames(frames); err != nil {
+					return nil, err
+				}
+			}
+			path, err = o.writeOutput(base+ext, func(w io.Writer) error {
+				if o.OutMode == "pbm" {
+					// a PBM file can hold a sequence of images back to back
+					for _, frame := range frames {
+						if err := write(w, frame); err != nil {
+							return err
+						}
+					}
+					return nil
+				}
+				_, err := w.Write(o.withChecksum(o.withHeader(x, y, concat, true)))
+				return err
+			})
+			break
+		}
+		if o.Output == stdinName {
+			return nil, errors.New("error: an animation can only be written to stdout with -animation concat")
+		}
+		if o.Embed {
+			return nil, errors.New("error: an animation can only be embedded with -animation concat")
+		}
+		name := func(i int) string {
+			return fmt.Sprintf("%s-%03d%s", base, i, ext)
+		}
+		if o.Output != "" {
+			name = func(i int) string {
+				return framePath(o.Output, i)
+			}
+		}
+		for i, frame := range frames {
+			err = o.writeFile(name(i), func(w io.Writer) error {
+				return write(w, frame)
+			})
+			if err != nil {
+				break
+			}
+			written = append(written, name(i))
+		}
+	case "base64":
+		// one line per frame, printed at once so other inputs don't end up in between
+		lines := make([]string, len(frames))
+		for i, frame := range frames {
+			lines[i] = EncodeToString(frame)
+		}
+		fmt.Fprintln(stdout, strings.Join(lines, "\n"))
+	case "none":
+	}
+	if path != "" {
+		written = append(written, path)
+	}
+	if err == nil {
+		written, err = o.writeChecksums(written)
+	}
+	if err == nil && o.Embed && o.OutMode == "bin" && path != "" {
+		var embed string
+		embed, err = o.writeEmbed(path, x, y)
+		written = append(written, embed)
+	}
+	if err != nil {
+		return written, fmt.Errorf("error writing image to file: %w", err)
+	}
+	return written, nil
+}
+
+// showImg previews imgBits with the printer matching the target palette and
+// -show-style. Black and white previews wider than -show-width, or else the
+// terminal on stderr, are shrunk to fit.
+func (o *Options) showImg(w io.Writer, x, y int, imgBits []byte) {
+	on, off := o.ShowOn, o.ShowOff
+	if o.Palette != MonoPalette {
+		if on == "" && off == "" && o.useColor() {
+			// a block per pixel, each in its own color
+			PrintPaletteImg(w, x, y, o.Palette, imgBits)
+		} else {
+			fprintGlyphs(w, x, y, o.Palette, imgBits, cmp.Or(on, "*"), cmp.Or(off, " "), o.useColor())
+		}
+		return
+	}
+	width := o.ShowWidth
+	if width == 0 {
+		width = terminalWidth()
+	}
+	scale := previewScale(o.ShowStyle, x, width)
+	if scale > 1 {
+		x, y, imgBits = downscale(x, y, scale, imgBits)
+	}
+	switch o.ShowStyle {
+	case "braille":
+		FprintBraille(w, x, y, imgBits)
+	case "halfblock":
+		FprintHalfBlock(w, x, y, imgBits)
+	default:
+		fprintGlyphs(w, x, y, MonoPalette, imgBits, cmp.Or(on, "*"), cmp.Or(off, " "), o.useColor())
+	}
+	if scale > 1 {
+		fprintScale(w, scale, width)
+	}
+}
+
+// stdout carries the converted data and nothing else, so that it can be piped
+// into other tools. Everything else (the log, -show previews) goes to stderr.
+var stdout io.Writer = &syncWriter{w: os.Stdout}
+
+// stderr serializes writes to os.Stderr, so the log and the previews of
+// concurrent workers never interleave mid-line
+var stderr = &syncWriter{w: os.Stderr}
+
+// syncWriter is an io.Writer that can be shared between goroutines
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestConvertAllBatch(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"alice.png":  png,
+		"bob.png":    png,
+		"broken.png": []byte("this is not an image"),
+		"carol.png":  png,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio = "bin", "profile"
+
+	// the glob is expanded by the tool itself, as Windows shells don't
+	converted, failed := opts.ConvertAll([]string{filepath.Join(dir, "*.png")}, 120, 128)
+	if converted != 3 || len(failed) != 1 {
+		t.Fatalf("expected 3 converted and 1 failed, got %d and %d", converted, len(failed))
+	}
+	for _, name := range []string{"alice", "bob", "carol"} {
+		if _, err := os.Stat(filepath.Join(dir, name+"-profile.bin")); err != nil {
+			t.Errorf("expected output for %s: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "broken-profile.bin")); err == nil {
+		t.Error("expected no output for the broken image")
+	}
+
+	// with -fail-fast the batch stops at the broken image (globs sort by name,
+	// and a single worker converts them in that order)
+	opts.FailFast, opts.Jobs = true, 1
+	converted, failed = opts.ConvertAll([]string{filepath.Join(dir, "*.png")}, 120, 128)
+	if converted != 2 || len(failed) != 1 {
+		t.Errorf("expected 2 converted and 1 failed with -fail-fast, got %d and %d", converted, len(failed))
+	}
+}
+
+func TestConvertInputsOutputClash(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio = "bin", "profile"
+	// gopher.png and gopher.jpg would both be written to gopher-profile.bin
+	inputs := []Input{
+		{Path: "gopher.png", Name: filepath.Join(dir, "gopher"), Data: png},
+		{Path: "gopher.jpg", Name: filepath.Join(dir, "gopher"), Data: png},
+		{Path: "other.png", Name: filepath.Join(dir, "other"), Data: png},
+	}
+	converted, failed := opts.ConvertInputs(inputs, 120, 128)
+	if converted != 3 || len(failed) != 0 {
+		t.Errorf("expected the second gopher to be renamed, got %d converted and %d failed", converted, len(failed))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gopher_2-profile.bin")); err != nil {
+		t.Errorf("expected the second gopher to be written as gopher_2: %v", err)
+	}
+	opts.StrictNames, opts.Force = true, true
+	converted, failed = opts.ConvertInputs(inputs, 120, 128)
+	if converted != 2 || len(failed) != 1 {
+		t.Errorf("expected the second gopher to fail with -strict-names, got %d converted and %d failed", converted, len(failed))
+	}
+}
+
+// BenchmarkConvertInputs converts a synthetic batch of 50 images with one
+// worker, then doubling the workers up to one per CPU; the ns/op should drop
+// close to linearly.
+func BenchmarkConvertInputs(b *testing.B) {
+	var buf bytes.Buffer
+	src := image.NewRGBA(image.Rect(0, 0, 320, 240))
+	for y := 0; y < 240; y++ {
+		for x := 0; x < 320; x++ {
+			src.Set(x, y, color.RGBA{uint8(x), uint8(y), uint8(x + y), 0xFF})
+		}
+	}
+	if err := png.Encode(&buf, src); err != nil {
+		b.Fatal(err)
+	}
+	inputs := make([]Input, 50)
+	for i := range inputs {
+		inputs[i] = Input{Path: fmt.Sprintf("synthetic-%02d.png", i), Name: fmt.Sprintf("synthetic-%02d", i), Data: buf.Bytes()}
+	}
+
+	for jobs := 1; jobs <= runtime.NumCPU(); jobs *= 2 {
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			opts := NewOptions()
+			opts.Ratio, opts.Jobs = "splash", jobs
+			for n := 0; n < b.N; n++ {
+				if _, failed := opts.ConvertInputs(inputs, 246, 128); len(failed) != 0 {
+					b.Fatalf("%d inputs failed", len(failed))
+				}
+			}
+		})
+	}
+}
+
+func TestBinToStdout(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio = "bin", "splash"
+	opts.Output = filepath.Join(dir, "splash.bin")
+	if _, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 246, 128); len(failed) != 0 {
+		t.Fatal("expected the file output to be written")
+	}
+	fromFile, err := os.ReadFile(opts.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out, preview bytes.Buffer
+	oldStdout, oldStderr := stdout, stderr
+	defer func() { stdout, stderr = oldStdout, oldStderr }()
+	stdout, stderr = &out, &syncWriter{w: &preview}
+	// the preview must stay out of the data
+	opts.Output, opts.Show = "-", true
+	if _, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 246, 128); len(failed) != 0 {
+		t.Fatal("expected the output to be written to stdout")
+	}
+	if !bytes.Equal(out.Bytes(), fromFile) {
+		t.Errorf("expected stdout to hold the %d bytes of the file output, got %d bytes", len(fromFile), out.Len())
+	}
+	if preview.Len() == 0 {
+		t.Error("expected the preview on stderr")
+	}
+}
+
+func TestMultipleOutModes(t *testing.T) {
+	dir := t.TempDir()
+	code, out, errOut := runCLI(t, "-outmode", "bin,base64,rice", "-ratio", "profile", "-outdir", dir, "testdata/tainigo_128.png")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	bin, err := os.ReadFile(filepath.Join(dir, "profile.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(out))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(bin, decoded) {
+		t.Errorf("expected the bin file to hold the %d bytes printed in base64, got %d bytes", len(decoded), len(bin))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "profile-generated.go")); err != nil {
+		t.Errorf("expected the rice mode output too: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"-outmode", "bin,none"},
+		{"-outmode", "none,base64"},
+		{"-outmode", "bin,bin"},
+		{"-outmode", "bin,jpeg"},
+		{"-outmode", "bin,rice", "-o", "profile.out"},
+		{"-outmode", "bin,base64", "-o", "-"},
+		{"-outmode", "bin,rice", "-embed"},
+	} {
+		if code, _, errOut := runCLI(t, append(args, "-ratio", "profile", "testdata/tainigo_128.png")...); code != 2 || !strings.Contains(errOut, "error: ") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+}
+
+func TestMultipleRatios(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"alice.png", "bob.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), png, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inputs := filepath.Join(dir, "*.png")
+	together, apart := filepath.Join(dir, "together"), filepath.Join(dir, "apart")
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "profile,splash", "-outdir", together, inputs); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	for _, ratio := range []string{"profile", "splash"} {
+		if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", ratio, "-outdir", apart, inputs); code != 0 {
+			t.Fatalf("%s: expected exit code 0, got %d and\n%s", ratio, code, errOut)
+		}
+	}
+	// 2 inputs by 2 ratios, -outdir mirroring the directory of the inputs
+	var names []string
+	err = filepath.WalkDir(apart, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(apart, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.Base(name))
+		want, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		got, err := os.ReadFile(filepath.Join(together, name))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: expected the %d bytes of a single ratio run, got %d bytes", name, len(want), len(got))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice-profile.bin alice-splash.bin bob-profile.bin bob-splash.bin"; strings.Join(names, " ") != want {
+		t.Errorf("expected %s, got %v", want, names)
+	}
+
+	// each ratio declares a variable of its own
+	files := generateIn(t, "gopherbadgeimg", "-outmode", "rice", "-ratio", "profile,16x16", "-var", "speaker")
+	for name, want := range map[string]string{"profile-generated.go": "speaker_profile", "16x16-generated.go": "speaker_16x16"} {
+		if _, names := parseGo(t, name, files[name]); len(names) == 0 || names[0] != want {
+			t.Errorf("%s: expected variable %s, got %v", name, want, names)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-ratio", "profile,profile"},
+		{"-ratio", "profile,splash", "-o", "profile.bin"},
+		{"-ratio", "profile,splash", "-preview", "preview.png"},
+		{"-ratio", "profile,12x12"},
+	} {
+		if code, _, errOut := runCLI(t, append(append([]string{"-outmode", "bin"}, args...), "testdata/tainigo_128.png")...); code != 2 || !strings.Contains(errOut, "error") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+}
+
+func TestVariableName(t *testing.T) {
+	for in, expected := range map[string]string{
+		"splash":      "splash",
+		"my-icon":     "my_icon",
+		"128x128":     "img_128x128",
+		"gopher.2024": "gopher_2024",
+		"_private":    "img__private",
+		"café":        "caf__",
+	} {
+		if got := variableName(in); got != expected {
+			t.Errorf("%q: expected %q, got %q", in, expected, got)
+		}
+	}
+}
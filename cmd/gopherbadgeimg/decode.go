@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// errSize is returned for bin data that doesn't hold an image of the size it
+// is decoded at
+var errSize = errors.New("the data doesn't match the size of the image")
+
+// binFrames splits the data of a bin file into its x by y frames of size
+// bytes, expanding RLE compressed data
+func binFrames(data []byte, x, y, size int, rle, concat bool) ([][]byte, error) {
+	if concat {
+		// see ConcatFrames
+		if len(data) < 2 {
+			return nil, errors.New("the concatenated frames are missing their frame count")
+		}
+		n := int(binary.LittleEndian.Uint16(data))
+		if len(data) != 2+n*size {
+			return nil, fmt.Errorf("%w: %d frames of %d bytes take %d bytes, got %d", errSize, n, size, n*size, len(data)-2)
+		}
+		frames := make([][]byte, n)
+		for i := range frames {
+			frames[i] = data[2+i*size : 2+(i+1)*size]
+		}
+		return frames, nil
+	}
+	if rle {
+		n, err := rleSize(data)
+		if err != nil {
+			return nil, err
+		}
+		if n != size {
+			return nil, fmt.Errorf("%w: a %dx%d image is %d bytes, the RLE data expands to %d", errSize, x, y, size, n)
+		}
+		return [][]byte{DecodeRLE(make([]byte, size), data)}, nil
+	}
+	if len(data) != size {
+		return nil, fmt.Errorf("%w: a %dx%d image is %d bytes, got %d", errSize, x, y, size, len(data))
+	}
+	return [][]byte{data}, nil
+}
+
+// sizeCandidates returns the likely sizes of a badge image of n bytes at depth
+// bits per pixel: the ones with a height that fills whole bytes and an aspect
+// ratio from 1:4 to 4:1, widest first
+func sizeCandidates(n, depth int) []string {
+	pixels := n * 8 / depth
+	var sizes []string
+	for y := 8; y*y <= pixels*4; y += 8 {
+		if pixels%y != 0 {
+			continue
+		}
+		if x := pixels / y; x <= 4*y {
+			sizes = append(sizes, fmt.Sprintf("%dx%d", x, y))
+		}
+	}
+	return sizes
+}
+
+// readBin returns the frames of the bin data or slideshow read from name, and
+// their size: the one in its header, or else x by y. The data must be packed
+// for the palette p, and with -layout or the -planes of p when it has no
+// header; the frames returned are packed for the badge, or with the codes of
+// each pixel in one piece, either way.
+func (o *Options) readBin(name string, data []byte, x, y int, p *Palette) (int, int, [][]byte, error) {
+	if s, err := DecodeSlideshow(data); err == nil {
+		if int(s.Depth) != p.Depth || s.RowMajor != p.RowMajor {
+			return 0, 0, nil, fmt.Errorf("the slideshow holds %d bit per pixel images, which aren't packed for the %s palette", s.Depth, p.Name)
+		}
+		return int(s.Width), int(s.Height), s.Playback(), nil
+	} else if !errors.Is(err, errNoSlideshow) {
+		return 0, 0, nil, err
+	}
+	h, payload, err := DecodeHeader(data)
+	switch {
+	case err == nil:
+		if int(h.Depth) != p.Depth || h.RowMajor != p.RowMajor {
+			return 0, 0, nil, fmt.Errorf("the header describes a %d bit per pixel image, which isn't packed for the %s palette", h.Depth, p.Name)
+		}
+		x, y = int(h.Width), int(h.Height)
+		frames, err := binFrames(payload, x, y, x*y*p.Depth/8, h.RLE, h.Concat)
+		if err == nil && h.Planes != "" {
+			frames = joinFrames(x, y, p, h.Planes, frames)
+		}
+		return x, y, frames, err
+	case !errors.Is(err, errNoHeader):
+		return 0, 0, nil, err
+	}
+	if x == 0 {
+		return 0, 0, nil, errors.New("the data has no header, so its size must be given with -ratio")
+	}
+	rle := strings.HasSuffix(name, ".rle.bin")
+	layout, size := o.frameLayout(p, x, y)
+	frames, err := binFrames(data, x, y, size, rle, false)
+	if errors.Is(err, errSize) && !rle && layout.RowPadding == 0 && layout.PlaneCount <= 1 {
+		if sizes := sizeCandidates(len(data), p.Depth); len(sizes) > 0 {
+			err = fmt.Errorf("%w (for %d bytes try -ratio %s)", err, len(data), strings.Join(sizes, ", "))
+		}
+	}
+	if err == nil && (p.Planes == "concat" || p.Planes == "interleave") {
+		return x, y, joinFrames(x, y, p, p.Planes, frames), nil
+	}
+	if err != nil || layout == badgeimg.LayoutBadger {
+		return x, y, frames, err
+	}
+	for i, frame := range frames {
+		if frames[i], err = badgeimg.Repack(x, y, frame, layout, badgeimg.LayoutBadger); err != nil {
+			return 0, 0, nil, err
+		}
+	}
+	return x, y, frames, nil
+}
+
+// Decode turns the bin file at path back into a PNG, named after it or -o,
+// one per frame for animations and slideshows unless -frame picks one. Files
+// with a header are decoded at the size it gives, others at x by y. With
+// -planes separate the planes are read from the files named after path, as
+// they were written (see planePath).
+func (o *Options) Decode(path string, x, y int) error {
+	var (
+		frames [][]byte
+		err    error
+	)
+	if o.Palette.Planes == "separate" {
+		x, y, frames, err = o.readPlanes(path, x, y)
+	} else {
+		var data []byte
+		if data, err = ReadInput(path); err != nil {
+			return err
+		}
+		x, y, frames, err = o.readBin(path, data, x, y, o.Palette)
+	}
+	if err != nil {
+		return classify(badgeimg.ErrDecode, err)
+	}
+	if o.FrameIndex >= 0 {
+		if o.FrameIndex >= len(frames) {
+			return fmt.Errorf("frame %d requested but the file only has %d frame(s)", o.FrameIndex, len(frames))
+		}
+		frames = frames[o.FrameIndex : o.FrameIndex+1]
+	}
+
+	output := o.Output
+	if output == "" {
+		output = strings.TrimSuffix(inputName(path), ".rle") + ".png"
+	}
+	for i, frame := range frames {
+		// black and white images are decoded to gray, as they always were
+		var img image.Image
+		if o.Palette == MonoPalette {
+			if img, err = badgeimg.BytesToImg(x, y, frame, badgeimg.LayoutBadger); err != nil {
+				return err
+			}
+		} else {
+			img = RenderPreview(x, y, 1, o.Palette, frame)
+		}
+		name := output
+		if len(frames) > 1 {
+			name = framePath(output, i)
+		}
+		err = o.writeFile(name, func(w io.Writer) error {
+			return png.Encode(w, img)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// decodePNG reads back a PNG written by Decode
+func decodePNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+// checkDecoded checks that the PNG at path has the pixels of the packed image
+func checkDecoded(t *testing.T, path string, x, y int, want []byte) {
+	t.Helper()
+	img := decodePNG(t, path)
+	if b := img.Bounds(); b.Dx() != x || b.Dy() != y {
+		t.Fatalf("expected a %dx%d image, got %v", x, y, b)
+	}
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			r, g, b, _ := img.At(i, j).RGBA()
+			if r+g+b != 0 && r&g&b != 0xffff {
+				t.Fatalf("expected black and white pixels, got %v at (%d, %d)", img.At(i, j), i, j)
+			}
+		}
+	}
+	if got := badgeimg.Pack(x, y, img, badgeimg.LayoutBadger); !bytes.Equal(got, want) {
+		t.Error("expected the decoded image to have the pixels of the bin file")
+	}
+}
+
+func TestDecode(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio = "bin", "splash"
+	opts.Output = filepath.Join(dir, "splash.bin")
+	if converted, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 246, 128); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the image to convert, got %d converted and %d failed", converted, len(failed))
+	}
+	bin, err := os.ReadFile(opts.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewOptions().Decode(opts.Output, 246, 128); err != nil {
+		t.Fatal(err)
+	}
+	checkDecoded(t, filepath.Join(dir, "splash.png"), 246, 128, bin)
+
+	// the wrong size fails, suggesting the right one
+	err = NewOptions().Decode(opts.Output, 120, 128)
+	if !errors.Is(err, errSize) || !strings.Contains(err.Error(), "246x128") {
+		t.Errorf("expected a size mismatch suggesting 246x128, got %v", err)
+	}
+	if err := NewOptions().Decode(opts.Output, 0, 0); err == nil {
+		t.Error("expected a file without a header to need a size")
+	}
+}
+
+func TestDecodeHeader(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Header, opts.Compress = "bin", "profile", true, "rle"
+	opts.Output = filepath.Join(dir, "profile.rle.bin")
+	if converted, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 120, 128); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the image to convert, got %d converted and %d failed", converted, len(failed))
+	}
+	img, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the header gives the size, which wins over a wrong one
+	decoder := NewOptions()
+	decoder.Output = filepath.Join(dir, "decoded.png")
+	if err := decoder.Decode(opts.Output, 246, 128); err != nil {
+		t.Fatal(err)
+	}
+	checkDecoded(t, decoder.Output, 120, 128, opts.ImgToBytes(120, 128, img))
+}
+
+func TestDecodeAnimation(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Header = "bin", "8x8", true
+	opts.DisableDithering, opts.Animation = true, "concat"
+	opts.Output = filepath.Join(dir, "anim.bin")
+	if converted, failed := opts.ConvertAll([]string{"testdata/restore-background.gif"}, 8, 8); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the animation to convert, got %d converted and %d failed", converted, len(failed))
+	}
+	frames, err := opts.LoadFrames("testdata/restore-background.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewOptions().Decode(opts.Output, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	for i, frame := range frames {
+		checkDecoded(t, framePath(filepath.Join(dir, "anim.png"), i), 8, 8, opts.ImgToBytes(8, 8, &frame.Image))
+	}
+}
+
+func TestSizeCandidates(t *testing.T) {
+	got := sizeCandidates(3936, 1)
+	want := []string{"328x96", "246x128", "164x192", "123x256", "96x328"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
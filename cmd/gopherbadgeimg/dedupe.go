@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// -dedupe-frames collapses the runs of identical frames animations often
+// have once dithered, such as a still title held for a second, into a single
+// frame shown for the delays of the run together. -dedupe-frames=global
+// also stores every distinct frame once in the outputs that can say in which
+// order they are shown, rice and slideshow ones: the frames of an animation
+// going back and forth are only written one way, along with a sequence of
+// frame numbers to play.
+
+// dedupeModes are the values of -dedupe-frames, -dedupe-frames alone being
+// consecutive
+var dedupeModes = []string{"consecutive", "global"}
+
+// dedupeValue is the flag.Value of -dedupe-frames, which is set like a
+// boolean flag unless it is given a mode
+type dedupeValue struct {
+	mode *string
+}
+
+func (d dedupeValue) String() string {
+	switch {
+	case d.mode == nil || *d.mode == "":
+		return "false"
+	case *d.mode == "consecutive":
+		return "true"
+	}
+	return *d.mode
+}
+
+func (d dedupeValue) Set(s string) error {
+	switch s {
+	case "true":
+		*d.mode = "consecutive"
+	case "false":
+		*d.mode = ""
+	case "consecutive", "global":
+		*d.mode = s
+	default:
+		return fmt.Errorf("use one of: %s", strings.Join(dedupeModes, ", "))
+	}
+	return nil
+}
+
+func (d dedupeValue) IsBoolFlag() bool { return true }
+
+// collapseRuns returns frames with every run of identical frames collapsed
+// into its first one, shown for the delays of the run together
+func collapseRuns(frames [][]byte, delays []int) ([][]byte, []int) {
+	var (
+		collapsed [][]byte
+		sums      []int
+	)
+	for i, frame := range frames {
+		if n := len(collapsed); n > 0 && bytes.Equal(collapsed[n-1], frame) {
+			sums[n-1] += delays[i]
+			continue
+		}
+		collapsed = append(collapsed, frame)
+		sums = append(sums, delays[i])
+	}
+	return collapsed, sums
+}
+
+// uniqueFrames returns the distinct frames of frames, in the order they
+// first appear, and the sequence of their numbers playing frames back
+func uniqueFrames(frames [][]byte) ([][]byte, []int) {
+	var unique [][]byte
+	seen := map[string]int{}
+	sequence := make([]int, len(frames))
+	for i, frame := range frames {
+		n, ok := seen[string(frame)]
+		if !ok {
+			n = len(unique)
+			seen[string(frame)] = n
+			unique = append(unique, frame)
+		}
+		sequence[i] = n
+	}
+	return unique, sequence
+}
+
+// playback returns the frames sequence plays, from the frames stored once
+func playback(frames [][]byte, sequence []int) [][]byte {
+	played := make([][]byte, len(sequence))
+	for i, n := range sequence {
+		played[i] = frames[n]
+	}
+	return played
+}
+
+// fprintGoSequence writes the nameSequence variable of -dedupe-frames=global
+// to w, and the delays going with it if there are any
+func fprintGoSequence(w io.Writer, name string, sequence, delays []int) error {
+	buf := fmt.Appendf(nil, "\n// %sSequence is the order the frames of %s are shown in, each of them being\n// stored once\nvar %sSequence = []int{", name, name, name)
+	buf = appendInts(buf, sequence)
+	buf = append(buf, "}\n"...)
+	if delays != nil {
+		buf = fmt.Appendf(buf, "\n// %sDelays holds how long each frame of %sSequence is shown, in milliseconds\nvar %sDelays = []int{", name, name, name)
+		buf = appendInts(buf, delays)
+		buf = append(buf, "}\n"...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// appendInts appends ns to buf, separated by commas
+func appendInts(buf []byte, ns []int) []byte {
+	for i, n := range ns {
+		if i > 0 {
+			buf = append(buf, ", "...)
+		}
+		buf = strconv.AppendInt(buf, int64(n), 10)
+	}
+	return buf
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeRunsGIF writes an 8x8 animation to path whose frames have as many
+// black pixels as counts say, frame i being shown for (i+1)*10ms
+func writeRunsGIF(t *testing.T, path string, counts []int) {
+	t.Helper()
+	g := &gif.GIF{}
+	for i, count := range counts {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{color.White, color.Black})
+		for p := range count {
+			frame.SetColorIndex(p%8, p/8, 1)
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, i+1)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// blackCounts returns how many pixels of each frame are black
+func blackCounts(frames [][]byte) []int {
+	counts := make([]int, len(frames))
+	for i, frame := range frames {
+		for _, b := range frame {
+			counts[i] += bits.OnesCount8(b)
+		}
+	}
+	return counts
+}
+
+func TestDedupeFrames(t *testing.T) {
+	dir := t.TempDir()
+	anim := filepath.Join(dir, "anim.gif")
+	// runs of 2 and 3, and a frame coming back after another
+	writeRunsGIF(t, anim, []int{1, 1, 2, 2, 2, 1, 3})
+	played, delays := []int{1, 2, 1, 3}, []int{30, 120, 60, 70}
+
+	// runs collapse into their first frame, shown for the whole run
+	out := filepath.Join(dir, "anim.bin")
+	manifest := filepath.Join(dir, "manifest.json")
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "8x8", "-disable-dithering", "-dedupe-frames", "-manifest", manifest, "-o", out, anim); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	var frames [][]byte
+	for i := range played {
+		data, err := os.ReadFile(framePath(out, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, data)
+	}
+	if _, err := os.Stat(framePath(out, len(played))); err == nil {
+		t.Errorf("expected %d frames, got more", len(played))
+	}
+	if got := blackCounts(frames); !reflect.DeepEqual(got, played) {
+		t.Errorf("expected the frames %v, got %v", played, got)
+	}
+	if m, _ := readManifest(t, manifest); !reflect.DeepEqual(m.Images[0].Delays, delays) {
+		t.Errorf("expected the delays %v, got %v", delays, m.Images[0].Delays)
+	}
+
+	// stored once in a slideshow, which decode plays back whole
+	show := filepath.Join(dir, "anim.slideshow")
+	if code, _, errOut := runCLI(t, "-outmode", "slideshow", "-ratio", "8x8", "-disable-dithering", "-dedupe-frames=global", "-o", show, anim); code != 0 {
+		t.Fatalf("slideshow: expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	data, err := os.ReadFile(show)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := DecodeSlideshow(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := blackCounts(s.Frames); s.Version != slideshowSequenced || !reflect.DeepEqual(got, []int{1, 2, 3}) || !reflect.DeepEqual(s.Sequence, []int{0, 1, 0, 2}) {
+		t.Errorf("expected a version 2 slideshow of the frames [1 2 3] played as [0 1 0 2], got version %d of %v played as %v", s.Version, got, s.Sequence)
+	}
+	if again := EncodeSlideshow(*s); !bytes.Equal(again, data) {
+		t.Errorf("expected the slideshow to encode the same again, got\n%x\nrather than\n%x", again, data)
+	}
+	code, stdOut, errOut := runCLI(t, "inspect", show)
+	if want := "frames: 3\n  frame data: 8 bytes\n  sequence: 4 frames shown\n"; code != 0 || !strings.Contains(stdOut, want) {
+		t.Errorf("inspect: expected %q, got %d and\n%s%s", want, code, stdOut, errOut)
+	}
+	decoded := filepath.Join(dir, "decoded.png")
+	if code, _, errOut := runCLI(t, "decode", "-o", decoded, show); code != 0 {
+		t.Fatalf("decode: expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	for i, want := range played {
+		f, err := os.Open(framePath(decoded, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, _, err := image.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		black := 0
+		for y := range 8 {
+			for x := range 8 {
+				if r, _, _, _ := img.At(x, y).RGBA(); r == 0 {
+					black++
+				}
+			}
+		}
+		if black != want {
+			t.Errorf("decode: expected frame %d to be frame %d, got frame %d", i, want, black)
+		}
+	}
+	// a truncated sequence
+	if _, err := DecodeSlideshow(data[:len(data)-1]); err == nil {
+		t.Error("expected a truncated slideshow to fail")
+	}
+
+	// the Go file holds the frames once, and the sequence to play them in
+	src := filepath.Join(dir, "anim.go")
+	if code, _, errOut := runCLI(t, "-outmode", "rice", "-ratio", "8x8", "-disable-dithering", "-dedupe-frames=global", "-export", "-var", "anim", "-o", src, anim); code != 0 {
+		t.Fatalf("rice: expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	generated, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(generated), "//go:generate gopherbadgeimg -dedupe-frames=global ") {
+		t.Errorf("expected the go:generate line to keep -dedupe-frames=global, got\n%s", generated)
+	}
+	files := map[string]string{
+		"anim.go": string(generated),
+		"main.go": `package main
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+func main() {
+	for i, n := range AnimSequence {
+		black := 0
+		for _, b := range Anim[n] {
+			black += bits.OnesCount8(b)
+		}
+		fmt.Println(len(Anim), n, black, AnimDelays[i])
+	}
+}
+`,
+	}
+	if got, want := runGoModule(t, files), "3 0 1 30\n3 1 2 120\n3 0 1 60\n3 2 3 70\n"; got != want {
+		t.Errorf("expected the sequence to play\n%s\ngot\n%s", want, got)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-outmode", "bin", "-dedupe-frames=global"}, "-dedupe-frames=global needs an output holding the sequence"},
+		{[]string{"-outmode", "rice,cheader", "-dedupe-frames=global"}, "-dedupe-frames=global needs an output holding the sequence"},
+		{[]string{"-dedupe-frames=all"}, "use one of: consecutive, global"},
+	} {
+		args := append([]string{"-ratio", "8x8"}, test.args...)
+		if code, _, errOut := runCLI(t, append(args, anim)...); code != exitUsage || !strings.Contains(errOut, test.want) {
+			t.Errorf("%v: expected exit code 2 and %q, got %d and\n%s", test.args, test.want, code, errOut)
+		}
+	}
+}
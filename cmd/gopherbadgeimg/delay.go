@@ -0,0 +1,49 @@
+package main
+
+import "math"
+
+// -frame-delay and -speed retime animations for firmware that can't play
+// their delays as they are: -frame-delay 100 shows every frame for 100ms,
+// and -speed multiplies every delay, -speed 2 showing each frame twice as
+// long and -speed 0.5 half as long. They apply once -frames and
+// -dedupe-frames have picked and merged the frames, so that every output
+// gets the same delays: the delays of rice, cheader and python files, the
+// manifest and -preview-gif, whose own floor of gifMinDelay still applies.
+// Slideshows hold no delays.
+//
+// Delays are rounded to the millisecond, and those ending up under
+// minFrameDelay, zero and negative ones included, are raised to it with a
+// warning, as firmware waiting 0ms would skip the frame.
+
+// minFrameDelay is the shortest delay -frame-delay and -speed give a frame,
+// in milliseconds: the hundredth of a second GIF delays are counted in
+const minFrameDelay = 10
+
+// retimed reports whether -frame-delay or -speed change the delays of
+// animations
+func (o *Options) retimed() bool {
+	return o.FrameDelay != 0 || o.Speed != 1
+}
+
+// retime returns delays as -frame-delay or -speed set them, and how many
+// were raised to minFrameDelay. The delays of still images, nil, stay nil.
+func (o *Options) retime(delays []int) ([]int, int) {
+	if delays == nil || !o.retimed() {
+		return delays, 0
+	}
+	retimed := make([]int, len(delays))
+	clamped := 0
+	for i, d := range delays {
+		if o.FrameDelay != 0 {
+			d = o.FrameDelay
+		} else {
+			d = int(math.Round(float64(d) * o.Speed))
+		}
+		if d < minFrameDelay {
+			d = minFrameDelay
+			clamped++
+		}
+		retimed[i] = d
+	}
+	return retimed, clamped
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRetime(t *testing.T) {
+	dir := t.TempDir()
+	anim := filepath.Join(dir, "anim.gif")
+	// shown for 10, 20, 30 and 40ms
+	writeCountingGIF(t, anim, 4)
+
+	for _, test := range []struct {
+		args    []string
+		delays  []int
+		clamped int
+	}{
+		{nil, []int{10, 20, 30, 40}, 0},
+		{[]string{"-speed", "2"}, []int{20, 40, 60, 80}, 0},
+		{[]string{"-speed", "1.5"}, []int{15, 30, 45, 60}, 0},
+		// 2.5, 5 and 7.5ms are too short
+		{[]string{"-speed", "0.25"}, []int{10, 10, 10, 10}, 3},
+		{[]string{"-speed", "0"}, []int{10, 10, 10, 10}, 4},
+		{[]string{"-speed", "-1"}, []int{10, 10, 10, 10}, 4},
+		{[]string{"-frame-delay", "150"}, []int{150, 150, 150, 150}, 0},
+		{[]string{"-frame-delay", "-5"}, []int{10, 10, 10, 10}, 4},
+	} {
+		goFile := filepath.Join(t.TempDir(), "anim.go")
+		manifest := filepath.Join(dir, "manifest.json")
+		preview := filepath.Join(dir, "preview.gif")
+		args := append([]string{"-outmode", "rice", "-var", "anim", "-ratio", "8x8", "-o", goFile, "-manifest", manifest, "-preview-gif", preview, "-force"}, test.args...)
+		code, _, errOut := runCLI(t, append(args, anim)...)
+		if code != 0 {
+			t.Fatalf("%v: exit code %d: %s", test.args, code, errOut)
+		}
+		warning := fmt.Sprintf("%d frame delay(s) under 10ms were raised to 10ms", test.clamped)
+		if warned := strings.Contains(errOut, "were raised to 10ms"); warned != (test.clamped > 0) || warned && !strings.Contains(errOut, warning) {
+			t.Errorf("%v: expected %q, got %s", test.args, warning, errOut)
+		}
+
+		content, err := os.ReadFile(goFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Trim(strings.Join(strings.Fields(fmt.Sprint(test.delays)), ", "), "[]")
+		if !strings.Contains(string(content), "var animDelays = []int{"+want+"}") {
+			t.Errorf("%v: expected the Go file to hold the delays %v, got\n%s", test.args, test.delays, content)
+		}
+		m, _ := readManifest(t, manifest)
+		if got := m.Images[0].Delays; !reflect.DeepEqual(got, test.delays) {
+			t.Errorf("%v: expected the manifest to hold the delays %v, got %v", test.args, test.delays, got)
+		}
+
+		f, err := os.Open(preview)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := gif.DecodeAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, d := range test.delays {
+			// the preview shows nothing shorter than browsers honor, rounded
+			// to the hundredth
+			if want := (max(d, gifMinDelay) + 5) / 10; g.Delay[i] != want {
+				t.Errorf("%v: expected frame %d of the preview to be shown for %d hundredths, got %d", test.args, i, want, g.Delay[i])
+			}
+		}
+	}
+
+	code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "8x8", "-frame-delay", "100", "-speed", "2", anim)
+	if code != exitUsage || !strings.Contains(errOut, "-frame-delay and -speed can't be used together") {
+		t.Errorf("expected exit code %d combining -frame-delay and -speed, got %d: %s", exitUsage, code, errOut)
+	}
+	code, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "8x8", "-speed", "NaN", anim)
+	if code != exitUsage || !strings.Contains(errOut, "-speed must be a number") {
+		t.Errorf("expected exit code %d for -speed NaN, got %d: %s", exitUsage, code, errOut)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math/bits"
+	"strings"
+)
+
+// diffInput returns the packed frames of a -diff input and their size: a bin
+// file, sized by its header or else x by y, or an image converted at x by y
+func (o *Options) diffInput(path string, x, y int) (int, int, [][]byte, error) {
+	if strings.HasSuffix(path, ".bin") {
+		data, err := ReadInput(path)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		return o.readBin(path, data, x, y, o.Palette)
+	}
+	if x == 0 {
+		return 0, 0, nil, fmt.Errorf("a size is needed to convert %s: give it with -ratio, or compare it to a bin file with a header", path)
+	}
+	frames, err := o.LoadFrames(path)
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	packed := make([][]byte, len(frames))
+	for i, frame := range frames {
+		packed[i] = o.ImgToBytes(x, y, &frame.Image)
+	}
+	return x, y, packed, nil
+}
+
+// Diff compares two packed images, each a bin file or an image to convert,
+// and prints how many bits differ to w, along with a picture of where with
+// -show. It reports whether they differ, and fails with errSize when they
+// aren't the same size.
+func (o *Options) Diff(w io.Writer, a, b string, x, y int) (bool, error) {
+	paths := []string{a, b}
+	// bin files go first, so that an image can be converted at the size in
+	// their header
+	order := []int{0, 1}
+	if !strings.HasSuffix(a, ".bin") && strings.HasSuffix(b, ".bin") {
+		order = []int{1, 0}
+	}
+	var (
+		sizes  [2][2]int
+		frames [2][][]byte
+	)
+	for _, i := range order {
+		fx, fy, packed, err := o.diffInput(paths[i], x, y)
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", paths[i], err)
+		}
+		if x == 0 {
+			x, y = fx, fy
+		}
+		sizes[i], frames[i] = [2]int{fx, fy}, packed
+	}
+	if sizes[0] != sizes[1] || len(frames[0]) != len(frames[1]) {
+		return false, fmt.Errorf("%w: %s is %d frame(s) of %dx%d, %s %d of %dx%d", errSize,
+			a, len(frames[0]), sizes[0][0], sizes[0][1], b, len(frames[1]), sizes[1][0], sizes[1][1])
+	}
+
+	differ, total := 0, 0
+	for i := range frames[0] {
+		differ += diffBits(frames[0][i], frames[1][i])
+		total += len(frames[0][i]) * 8
+	}
+	if differ == 0 {
+		fmt.Fprintf(w, "%s and %s are identical\n", a, b)
+	} else {
+		fmt.Fprintf(w, "%s and %s differ in %d of %d bits (%.2f%%)\n", a, b, differ, total, float64(differ)*100/float64(total))
+	}
+	if o.Show {
+		for i := range frames[0] {
+			if len(frames[0]) > 1 {
+				fmt.Fprintf(w, "frame %d:\n", i)
+			}
+			FprintDiff(w, x, y, o.Palette, frames[0][i], frames[1][i])
+		}
+	}
+	return differ > 0, nil
+}
+
+// diffBits returns the number of bits that differ between a and b, which
+// are the same length
+func diffBits(a, b []byte) int {
+	n := 0
+	for i := range a {
+		n += bits.OnesCount8(a[i] ^ b[i])
+	}
+	return n
+}
+
+// FprintDiff writes a picture of the differences between two images packed
+// for p to w, laid out as FprintImg does: X where the pixels differ, * where
+// both are the same color other than white, on for black and white images,
+// and a space where both are white
+func FprintDiff(w io.Writer, x, y int, p *Palette, a, b []byte) {
+	white := p.Codes[p.Index(color.White)]
+	var out strings.Builder
+	for j := 0; j < y; j++ {
+		for i := 0; i < x; i++ {
+			switch code := p.CodeAt(x, y, i, j, a); {
+			case code != p.CodeAt(x, y, i, j, b):
+				out.WriteByte('X')
+			case code != white:
+				out.WriteByte('*')
+			default:
+				out.WriteByte(' ')
+			}
+		}
+		out.WriteByte('\n')
+	}
+	io.WriteString(w, out.String())
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBins writes each of the packed images to dir, returning their paths
+func writeBins(t *testing.T, dir string, images ...[]byte) []string {
+	t.Helper()
+	paths := make([]string, len(images))
+	for i, data := range images {
+		paths[i] = filepath.Join(dir, string(rune('a'+i))+".bin")
+		if err := os.WriteFile(paths[i], data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+func TestDiffIdentical(t *testing.T) {
+	packed := packedProfile(t)
+	paths := writeBins(t, t.TempDir(), packed, packed)
+	var out bytes.Buffer
+	differ, err := NewOptions().Diff(&out, paths[0], paths[1], 120, 128)
+	if err != nil || differ {
+		t.Fatalf("expected identical images, got %v, %v", differ, err)
+	}
+	if !strings.Contains(out.String(), "are identical") {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	// the source image converts to the same bits
+	differ, err = NewOptions().Diff(&out, "testdata/tainigo_128.png", paths[0], 120, 128)
+	if err != nil || differ {
+		t.Errorf("expected the image to match its conversion, got %v, %v", differ, err)
+	}
+}
+
+func TestDiffSingleBit(t *testing.T) {
+	a := make([]byte, 8)
+	a[0] = 0xf0 // the first 4 pixels of the first column are on
+	b := bytes.Clone(a)
+	b[0] |= 0x01 // and the 8th one too
+	paths := writeBins(t, t.TempDir(), a, b)
+
+	opts := NewOptions()
+	opts.Show = true
+	var out bytes.Buffer
+	differ, err := opts.Diff(&out, paths[0], paths[1], 8, 8)
+	if err != nil || !differ {
+		t.Fatalf("expected the images to differ, got %v, %v", differ, err)
+	}
+	lines := strings.Split(out.String(), "\n")
+	if !strings.Contains(lines[0], "differ in 1 of 64 bits (1.56%)") {
+		t.Errorf("unexpected summary %q", lines[0])
+	}
+	want := []string{"*       ", "*       ", "*       ", "*       ", "        ", "        ", "        ", "X       "}
+	for i, line := range want {
+		if lines[1+i] != line {
+			t.Errorf("expected row %d to be %q, got %q", i, line, lines[1+i])
+		}
+	}
+}
+
+func TestDiffSizeMismatch(t *testing.T) {
+	packed := packedProfile(t)
+	paths := writeBins(t, t.TempDir(), packed, packed[:len(packed)-1])
+	if _, err := NewOptions().Diff(&bytes.Buffer{}, paths[0], paths[1], 120, 128); !errors.Is(err, errSize) {
+		t.Errorf("expected a size mismatch, got %v", err)
+	}
+
+	// sizes from headers that don't agree
+	opts := NewOptions()
+	opts.Header = true
+	paths = writeBins(t, t.TempDir(), opts.withHeader(120, 128, packed, false), opts.withHeader(128, 120, packed, false))
+	if _, err := NewOptions().Diff(&bytes.Buffer{}, paths[0], paths[1], 0, 0); !errors.Is(err, errSize) {
+		t.Errorf("expected a size mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isHidden reports whether a file or directory is hidden, following the
+// dotfile convention
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".") && name != "." && name != ".."
+}
+
+// WalkDir returns the images found under dir and its subdirectories, each
+// named after its path relative to dir so that the outputs mirror the tree.
+//
+// Symlinked directories aren't followed, which could loop forever, and
+// hidden files and directories are skipped unless -include-hidden is set.
+func (o *Options) WalkDir(dir string) ([]Input, error) {
+	var inputs []Input
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && isHidden(d.Name()) && !o.IncludeHidden {
+			logger.Debugf("skipping %s: hidden", path)
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// symlinked files are fine, symlinked directories aren't followed
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				logger.Debugf("skipping %s: symlink to a directory or nothing", path)
+				return nil
+			}
+		} else if !d.Type().IsRegular() {
+			logger.Debugf("skipping %s: not a regular file", path)
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if !imageExts[ext] {
+			logger.Debugf("skipping %s: not an image", path)
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, Input{Path: path, Name: strings.TrimSuffix(rel, filepath.Ext(rel))})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error walking %s: %w", dir, err)
+	}
+	return inputs, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestRecursiveOutdir(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(t.TempDir(), "assets")
+	for name, data := range map[string][]byte{
+		"speakers/alice.png":     png,
+		"speakers/bob.png":       png,
+		"sponsors/gold/acme.png": png,
+		"misc/logo.png":          png,
+		"misc/notes.txt":         []byte("not an image"),
+		".cache/thumb.png":       png,
+		"misc/.draft.png":        png,
+	} {
+		path := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a symlink back to the root would loop forever if it were followed
+	if err := os.Symlink(src, filepath.Join(src, "misc", "loop")); err != nil {
+		t.Fatal(err)
+	}
+
+	outputs := func(dir string) []string {
+		var files []string
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				rel, _ := filepath.Rel(dir, path)
+				files = append(files, filepath.ToSlash(rel))
+			}
+			return nil
+		})
+		sort.Strings(files)
+		return files
+	}
+
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Recursive = "bin", "profile", true
+	opts.OutDir = filepath.Join(t.TempDir(), "out")
+	if converted, failed := opts.ConvertAll([]string{src}, 120, 128); converted != 4 || len(failed) != 0 {
+		t.Fatalf("expected 4 converted and none failed, got %d and %d", converted, len(failed))
+	}
+	expected := []string{
+		"misc/logo-profile.bin",
+		"speakers/alice-profile.bin",
+		"speakers/bob-profile.bin",
+		"sponsors/gold/acme-profile.bin",
+	}
+	if got := outputs(opts.OutDir); !slices.Equal(got, expected) {
+		t.Errorf("expected outputs %v, got %v", expected, got)
+	}
+
+	opts.IncludeHidden = true
+	opts.OutDir = filepath.Join(t.TempDir(), "out")
+	if converted, failed := opts.ConvertAll([]string{src}, 120, 128); converted != 6 || len(failed) != 0 {
+		t.Fatalf("expected 6 converted with -include-hidden, got %d and %d failed", converted, len(failed))
+	}
+	if got := outputs(opts.OutDir); len(got) != 6 {
+		t.Errorf("expected hidden files to be converted too, got %v", got)
+	}
+
+	// without -recursive a directory is an error
+	opts.Recursive = false
+	if _, err := opts.CollectInputs(src); err == nil {
+		t.Error("expected a directory input without -recursive to fail")
+	}
+}
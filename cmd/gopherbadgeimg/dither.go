@@ -0,0 +1,29 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"github.com/makeworld-the-better-one/dither"
+)
+
+// lookupDither checks that name is one of badgeimg.DitherAlgorithms, "" being
+// the default one
+func lookupDither(name string) error {
+	if err := badgeimg.CheckDither(name); err != nil {
+		return fmt.Errorf("error: %w", err)
+	}
+	return nil
+}
+
+// newDitherer returns a Ditherer for colors using the -dither algorithm, or
+// the -dither-matrix kernel
+func (o *Options) newDitherer(colors []color.Color) *dither.Ditherer {
+	d, err := badgeimg.Options{Dither: o.Dither, Matrix: o.DitherMatrix}.Ditherer(colors)
+	if err != nil {
+		// flags are validated up front, this is a programming error
+		panic(err)
+	}
+	return d
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/makeworld-the-better-one/dither"
+)
+
+// -dither-matrix dithers with an error diffusion kernel read from a JSON
+// file, to try kernels out without building gopherbadgeimg again. Floyd and
+// Steinberg's is
+//
+//	{
+//		"divisor": 16,
+//		"current": [1, 2],
+//		"weights": [
+//			[0, 0, 7],
+//			[3, 5, 1]
+//		]
+//	}
+//
+// The error of every pixel is spread over the pixels below and right of it,
+// each getting weight/divisor of it. current is the row and column of the
+// pixel being dithered in weights, counted from 1, and must be on the first
+// row: the pixels left of it there were dithered already, so their weight
+// is 0, and the one right of it must have a weight, which is how the dither
+// package finds the current pixel. The weights can't be negative nor add up
+// to more than the divisor, which would amplify the error. testdata holds
+// the built-in kernels in this format.
+
+// ditherMatrixFile is the JSON of a -dither-matrix file
+type ditherMatrixFile struct {
+	Divisor float32     `json:"divisor"`
+	Current [2]int      `json:"current"`
+	Weights [][]float32 `json:"weights"`
+}
+
+// loadDitherMatrix reads the -dither-matrix file at path
+func loadDitherMatrix(path string) (dither.ErrorDiffusionMatrix, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, classify(errInput, fmt.Errorf("error reading -dither-matrix: %w", err))
+	}
+	m, err := parseDitherMatrix(data)
+	if err != nil {
+		return nil, usagef("error: -dither-matrix %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// parseDitherMatrix parses and checks the JSON of a -dither-matrix file,
+// returning the weights divided by the divisor
+func parseDitherMatrix(data []byte) (dither.ErrorDiffusionMatrix, error) {
+	var f ditherMatrixFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, err
+	}
+	if f.Divisor <= 0 {
+		return nil, fmt.Errorf("the divisor must be positive, got %v", f.Divisor)
+	}
+	if len(f.Weights) == 0 || len(f.Weights[0]) == 0 {
+		return nil, fmt.Errorf("no weights")
+	}
+	row, col := f.Current[0], f.Current[1]
+	if row != 1 {
+		return nil, fmt.Errorf("the current pixel must be on row 1, the first, got row %d", row)
+	}
+	if col < 1 || col >= len(f.Weights[0]) {
+		// the pixel right of the current one is checked below
+		return nil, fmt.Errorf("the current pixel is at column %d, row 1 has %d: it must be left of the last", col, len(f.Weights[0]))
+	}
+
+	var sum float32
+	for i, weights := range f.Weights {
+		if len(weights) != len(f.Weights[0]) {
+			return nil, fmt.Errorf("row %d: %d weights, where row 1 has %d", i+1, len(weights), len(f.Weights[0]))
+		}
+		for j, w := range weights {
+			switch {
+			case w < 0:
+				return nil, fmt.Errorf("row %d, column %d: negative weight %v", i+1, j+1, w)
+			case i == 0 && j < col && w != 0:
+				return nil, fmt.Errorf("row %d, column %d: the current pixel, and those left of it, were dithered already and must weigh 0, got %v", i+1, j+1, w)
+			case i == 0 && j == col && w == 0:
+				return nil, fmt.Errorf("row %d, column %d: the pixel right of the current one must have a weight", i+1, j+1)
+			}
+			sum += w
+		}
+	}
+	if sum > f.Divisor {
+		return nil, fmt.Errorf("the weights add up to %v, more than the divisor %v", sum, f.Divisor)
+	}
+
+	m := make(dither.ErrorDiffusionMatrix, len(f.Weights))
+	for i, weights := range f.Weights {
+		m[i] = make([]float32, len(weights))
+		for j, w := range weights {
+			m[i][j] = w / f.Divisor
+		}
+	}
+	return m, nil
+}
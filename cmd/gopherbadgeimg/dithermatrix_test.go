@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/makeworld-the-better-one/dither"
+)
+
+func TestParseDitherMatrix(t *testing.T) {
+	for path, want := range map[string]dither.ErrorDiffusionMatrix{
+		"testdata/floyd-steinberg.json": dither.FloydSteinberg,
+		"testdata/atkinson.json":        dither.Atkinson,
+	} {
+		m, err := loadDitherMatrix(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(m, want) {
+			t.Errorf("%s: expected %v, got %v", path, want, m)
+		}
+	}
+
+	for _, test := range []struct {
+		json, want string
+	}{
+		{`{"divisor": 0, "current": [1, 2], "weights": [[0, 0, 7]]}`, "the divisor must be positive"},
+		{`{"divisor": 16, "current": [1, 2], "weights": []}`, "no weights"},
+		{`{"divisor": 16, "current": [2, 2], "weights": [[0, 0, 7], [3, 5, 1]]}`, "must be on row 1, the first, got row 2"},
+		{`{"divisor": 16, "current": [1, 3], "weights": [[0, 0, 7], [3, 5, 1]]}`, "the current pixel is at column 3, row 1 has 3"},
+		{`{"divisor": 16, "current": [1, 2], "weights": [[0, 0, 7], [3, 5]]}`, "row 2: 2 weights, where row 1 has 3"},
+		{`{"divisor": 16, "current": [1, 2], "weights": [[0, 0, 7], [3, -5, 1]]}`, "row 2, column 2: negative weight -5"},
+		{`{"divisor": 16, "current": [1, 2], "weights": [[1, 0, 7], [3, 5, 1]]}`, "row 1, column 1: the current pixel, and those left of it"},
+		{`{"divisor": 16, "current": [1, 2], "weights": [[0, 0, 0, 7], [3, 5, 1, 0]]}`, "row 1, column 3: the pixel right of the current one"},
+		{`{"divisor": 16, "current": [1, 2], "weights": [[0, 0, 8], [3, 5, 1]]}`, "the weights add up to 17, more than the divisor 16"},
+		{`{"divisor": 16, "center": [1, 2], "weights": [[0, 0, 7]]}`, "unknown field"},
+	} {
+		if _, err := parseDitherMatrix([]byte(test.json)); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: expected %q, got %v", test.json, test.want, err)
+		}
+	}
+}
+
+func TestDitherMatrix(t *testing.T) {
+	dir := t.TempDir()
+	convert := func(name string, args ...string) []byte {
+		t.Helper()
+		out := filepath.Join(dir, name+".bin")
+		args = append([]string{"-outmode", "bin", "-ratio", "32x32", "-o", out}, args...)
+		if code, _, errOut := runCLI(t, append(args, "testdata/tainigo_128.png")...); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d and\n%s", args, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	// the files of the built-in kernels dither exactly as they do
+	for _, test := range []struct {
+		name string
+		args []string
+	}{
+		{"floyd-steinberg", nil},
+		{"atkinson", nil},
+		{"floyd-steinberg", []string{"-colors", "acep"}},
+	} {
+		suffix := strings.Join(test.args, "")
+		builtin := convert(test.name+suffix, append([]string{"-dither", test.name}, test.args...)...)
+		custom := convert(test.name+suffix+"-matrix", append([]string{"-dither-matrix", "testdata/" + test.name + ".json"}, test.args...)...)
+		if string(builtin) != string(custom) {
+			t.Errorf("%s %v: expected testdata/%s.json to dither as the built-in kernel", test.name, test.args, test.name)
+		}
+	}
+
+	bad := filepath.Join(dir, "bad.json")
+	if err := os.WriteFile(bad, []byte(`{"divisor": 4, "current": [1, 1], "weights": [[0, 3], [2, 0]]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "32x32", "-dither-matrix", bad, "testdata/tainigo_128.png")
+	if want := "the weights add up to 5, more than the divisor 4"; code != exitUsage || !strings.Contains(errOut, want) {
+		t.Errorf("expected exit code 2 and %q, got %d and\n%s", want, code, errOut)
+	}
+	code, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "32x32", "-dither-matrix", filepath.Join(dir, "missing.json"), "testdata/tainigo_128.png")
+	if code != exitInput || !strings.Contains(errOut, "error reading -dither-matrix") {
+		t.Errorf("expected exit code 3 for a missing file, got %d and\n%s", code, errOut)
+	}
+}
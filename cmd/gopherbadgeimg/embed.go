@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FprintEmbed writes a Go file embedding the bin file named file, which sits
+// in the same directory, as the exported name variable of package pkg, along
+// with its size, its length and layout and, with accessor set, a NameImage()
+// accessor. The file starts with header.
+func FprintEmbed(w io.Writer, header, pkg, name, file string, x, y, length int, layout, bitOrder string, accessor bool) error {
+	_, err := fmt.Fprintf(w, "%spackage %s\n\nimport _ \"embed\"\n\n// %s is %s, embedded at build time\n//\n//go:embed %s\nvar %s []byte\n",
+		header, pkg, name, file, quoteWord(file), name)
+	if err != nil {
+		return err
+	}
+	if err := fprintGoSize(w, name, x, y); err != nil {
+		return err
+	}
+	if err := fprintGoPacking(w, name, length, layout, bitOrder); err != nil || !accessor {
+		return err
+	}
+	return fprintGoAccessor(w, name, false)
+}
+
+// embedVarName returns the name of the variable of a go:embed file, which is
+// always exported: named after -var, or else the bin file
+func (o *Options) embedVarName(base string) string {
+	if o.VarName != "" {
+		return exportedName(o.VarName)
+	}
+	return exportedName(filepath.Base(base))
+}
+
+// writeEmbed writes the -embed file of the bin file at path next to it,
+// profile.bin getting profile_embed.go, and returns its path
+func (o *Options) writeEmbed(path string, x, y int) (string, error) {
+	base := strings.TrimSuffix(path, filepath.Ext(path))
+	if strings.HasSuffix(path, o.binExt()) {
+		base = strings.TrimSuffix(path, o.binExt())
+	}
+	embed := base + "_embed.go"
+	// the variable holds the whole file, header and checksum included
+	info, err := os.Stat(path)
+	if err != nil {
+		return embed, err
+	}
+	return embed, o.writeFile(embed, func(w io.Writer) error {
+		var buf bytes.Buffer
+		err := FprintEmbed(&buf, o.generatedHeader("//", "//go:generate ", filepath.Dir(embed)), o.goPackage(), o.embedVarName(base), filepath.Base(path), x, y, int(info.Size()), o.layoutName(), o.bitOrderName(), o.Export)
+		if err != nil {
+			return err
+		}
+		if o.provenance != nil {
+			buf.WriteString(o.provenance.String())
+		}
+		src, err := format.Source(buf.Bytes())
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(src)
+		return err
+	})
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmbed(t *testing.T) {
+	dir := t.TempDir()
+	outdir := filepath.Join(dir, "assets")
+	code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "profile", "-embed", "-export", "-pkg", "assets", "-var", "gopher", "-outdir", outdir, "testdata/tainigo_128.png")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	files := map[string]string{
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/badge/assets"
+)
+
+func main() {
+	data, x, y := assets.GopherImage()
+	fmt.Println(len(assets.Gopher), len(data), x*y/8)
+}
+`,
+	}
+	for _, name := range []string{"profile.bin", "profile_embed.go"} {
+		data, err := os.ReadFile(filepath.Join(outdir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files["assets/"+name] = string(data)
+	}
+	if !strings.Contains(files["assets/profile_embed.go"], "//go:embed profile.bin\n") {
+		t.Errorf("expected the bin file to be embedded from the same directory, got\n%s", files["assets/profile_embed.go"])
+	}
+	if out := runGoModule(t, files); out != "1920 1920 1920\n" {
+		t.Errorf("expected the embedded data to be 1920 bytes, got %q", out)
+	}
+
+	for _, args := range [][]string{
+		{"-outmode", "rice", "-embed"},
+		{"-outmode", "bin", "-embed", "-o", "-"},
+		{"-outmode", "bin", "-pkg", "assets"},
+		{"-outmode", "bin", "-embed", "-var", "---"},
+	} {
+		args = append(args, "-ratio", "profile", "testdata/tainigo_128.png")
+		if code, _, errOut := runCLI(t, args...); code != 2 || !strings.Contains(errOut, "error: -") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"image"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// The exit codes of gopherbadgeimg, listed in the README so that scripts can
+// tell what went wrong. -verify and diff keep their own: 1 for outputs that
+// are out of date or images that differ, and 2 for images diff can't compare.
+const (
+	exitFailure = 1 // anything not covered below
+	exitUsage   = 2 // bad flags or arguments, such as an invalid -ratio
+	exitInput   = 3 // an input that can't be read or found
+	exitDecode  = 4 // an input that was read but isn't an image that can be decoded
+	exitOutput  = 5 // an output that can't be written
+)
+
+// errInput is matched by the errors of reading inputs, from files, stdin,
+// URLs and archives
+var errInput = errors.New("reading the input")
+
+// classError is an error that also matches class with errors.Is, without
+// anything added to its message
+type classError struct {
+	error
+	class error
+}
+
+func (e classError) Unwrap() []error {
+	return []error{e.error, e.class}
+}
+
+// classify tags err with class, one of the errors exitCode maps to a code.
+// A nil err stays nil.
+func classify(class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return classError{err, class}
+}
+
+// decodeFailed classifies an error decoding an image: data that is in no
+// format gopherbadgeimg reads is told apart from a broken image
+func decodeFailed(err error) error {
+	if errors.Is(err, image.ErrFormat) {
+		return classify(badgeimg.ErrUnsupportedFormat, err)
+	}
+	return classify(badgeimg.ErrDecode, err)
+}
+
+// exitCode returns the exit code of a command that failed with err
+func exitCode(err error) int {
+	var (
+		usage usageError
+		exit  exitError
+	)
+	switch {
+	case errors.As(err, &exit):
+		return int(exit)
+	case errors.As(err, &usage), errors.Is(err, badgeimg.ErrBadRatio):
+		return exitUsage
+	case errors.Is(err, errInput):
+		return exitInput
+	case errors.Is(err, badgeimg.ErrDecode), errors.Is(err, badgeimg.ErrUnsupportedFormat):
+		return exitDecode
+	case errors.Is(err, badgeimg.ErrWrite):
+		return exitOutput
+	}
+	return exitFailure
+}
+
+// failures turns the errors of the inputs that failed, which have been
+// logged, into the error of a command. Inputs failing for different reasons
+// exit with the highest of their codes.
+func failures(failed []error) error {
+	if len(failed) == 0 {
+		return nil
+	}
+	code := 0
+	for _, err := range failed {
+		code = max(code, exitCode(err))
+	}
+	return exitError(code)
+}
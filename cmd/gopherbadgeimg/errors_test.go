@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func TestExitCodes(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.png")
+	writeCheckerboard(t, good, 16, 16, 2, 2)
+	png, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"text.png":      []byte("this is not an image"),
+		"truncated.png": png[:len(png)/2],
+		// a file where -o wants a directory
+		"file": nil,
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bin := filepath.Join(dir, "good.bin")
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "16x16", "-o", bin, good); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+
+	for _, tc := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"unknown flag", []string{"-bogus", good}, exitUsage},
+		{"invalid ratio", []string{"-outmode", "bin", "-ratio", "16by16", good}, exitUsage},
+		{"negative width", []string{"-outmode", "bin", "-ratio", "-8x8", good}, exitUsage},
+		{"negative height", []string{"-outmode", "bin", "-ratio", "8x-8", good}, exitUsage},
+		{"zero ratio", []string{"-outmode", "bin", "-ratio", "0x0", good}, exitUsage},
+		{"ratio the panel can't take", []string{"-outmode", "bin", "-ratio", "12x12", good}, exitUsage},
+		{"missing input", []string{"-outmode", "bin", "-ratio", "16x16", filepath.Join(dir, "missing.png")}, exitInput},
+		{"missing bin file", []string{"decode", "-ratio", "16x16", filepath.Join(dir, "missing.bin")}, exitInput},
+		{"unsupported format", []string{"-outmode", "bin", "-ratio", "16x16", filepath.Join(dir, "text.png")}, exitDecode},
+		{"truncated image", []string{"-outmode", "bin", "-ratio", "16x16", filepath.Join(dir, "truncated.png")}, exitDecode},
+		{"bin file of the wrong size", []string{"decode", "-ratio", "8x8", bin}, exitDecode},
+		{"unwritable output", []string{"-outmode", "bin", "-ratio", "16x16", "-o", filepath.Join(dir, "file", "out.bin"), good}, exitOutput},
+		// a batch exits with the highest code of the inputs that failed
+		{"mixed batch", []string{"-outmode", "bin", "-ratio", "16x16", "-outdir", filepath.Join(dir, "out"), good, filepath.Join(dir, "missing.png"), filepath.Join(dir, "text.png")}, exitDecode},
+		// -verify and diff keep their own codes
+		{"-verify of an output out of date", []string{"-verify", "-outmode", "bin", "-ratio", "16x16", "-invert", "-o", bin, good}, exitFailure},
+		{"diff of different images", []string{"diff", "-invert", "-ratio", "16x16", bin, good}, 1},
+		{"diff of a missing file", []string{"diff", "-ratio", "16x16", bin, filepath.Join(dir, "missing.bin")}, 2},
+	} {
+		if code, _, errOut := runCLI(t, tc.args...); code != tc.code {
+			t.Errorf("%s: expected exit code %d, got %d and\n%s", tc.name, tc.code, code, errOut)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		code int
+	}{
+		{errors.New("something else"), exitFailure},
+		{usagef("error: bad flags"), exitUsage},
+		{fmt.Errorf("error: %w", classify(badgeimg.ErrBadRatio, errors.New("12x12"))), exitUsage},
+		{classify(errInput, os.ErrNotExist), exitInput},
+		{decodeFailed(fmt.Errorf("wrapped: %w", os.ErrInvalid)), exitDecode},
+		{classify(badgeimg.ErrWrite, os.ErrPermission), exitOutput},
+		{exitError(7), 7},
+	} {
+		if code := exitCode(tc.err); code != tc.code {
+			t.Errorf("%v: expected exit code %d, got %d", tc.err, tc.code, code)
+		}
+	}
+	// classifying leaves the message and the wrapped error alone
+	err := classify(errInput, os.ErrNotExist)
+	if err.Error() != os.ErrNotExist.Error() || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected %v, got %v", os.ErrNotExist, err)
+	}
+	if classify(errInput, nil) != nil {
+		t.Error("expected a nil error to stay nil")
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/format"
+	"image"
+	"image/color"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// The font command turns a TrueType or OpenType font into a Go file of
+// bitmaps, for drawing text on the badge at runtime. Glyphs are rasterized at
+// one bit per pixel, cut at half coverage rather than dithered, and packed
+// column by column like images, all of them as high as the font. Runes the
+// font has no glyph for are drawn as a box, as are runes missing from the
+// file at runtime.
+
+// asciiChars are the printable ASCII characters, the default -chars
+const asciiChars = " !\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~"
+
+// BitmapFont is a font rasterized for the badge
+type BitmapFont struct {
+	// Height is the height of every glyph, a multiple of 8, and Baseline the
+	// row of their baseline
+	Height, Baseline int
+	// Runes are the runes of the font, sorted, drawn by the glyph of the same
+	// index
+	Runes []rune
+	// Advances are how far each glyph moves the pen, in pixels, and Glyphs
+	// their packed bitmaps, Height pixels high and as wide as they need to
+	// be. They hold one more glyph than Runes: the box drawn for the others.
+	Advances []int
+	Glyphs   [][]byte
+}
+
+// LoadFace loads the TrueType or OpenType font at path (or stdin, for "-"),
+// size points high at 72 DPI, which makes a point a pixel
+func LoadFace(path string, size float64) (font.Face, error) {
+	f, err := loadFont(path)
+	if err != nil {
+		return nil, err
+	}
+	return newFace(f, size)
+}
+
+// loadFont loads the TrueType or OpenType font at path (or stdin, for "-")
+func loadFont(path string) (*opentype.Font, error) {
+	data, err := ReadInput(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := opentype.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("error loading font: %w", err)
+	}
+	return f, nil
+}
+
+// newFace returns the face of f size points high at 72 DPI
+func newFace(f *opentype.Font, size float64) (font.Face, error) {
+	// hinting snaps outlines to the pixel grid, which keeps 1-bit stems even
+	return opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+}
+
+// RasterizeFont rasterizes the glyphs of chars, and returns the runes of chars
+// face has no glyph for, which are left to the box
+func RasterizeFont(face font.Face, chars string) (*BitmapFont, []rune) {
+	metrics := face.Metrics()
+	baseline := metrics.Ascent.Ceil()
+	_, height := MonoPalette.Pad(8, baseline+metrics.Descent.Ceil())
+	f := &BitmapFont{Height: height, Baseline: baseline}
+
+	runes := []rune(chars)
+	slices.Sort(runes)
+	var missing []rune
+	for _, r := range slices.Compact(runes) {
+		glyph, advance, ok := rasterizeGlyph(face, r, height, baseline)
+		if !ok {
+			missing = append(missing, r)
+			continue
+		}
+		f.Runes = append(f.Runes, r)
+		f.Glyphs = append(f.Glyphs, glyph)
+		f.Advances = append(f.Advances, advance)
+	}
+
+	// the box is as wide as a digit, and stands as high as capitals
+	width, _ := face.GlyphAdvance('0')
+	w := max(4, width.Round())
+	top := baseline - metrics.CapHeight.Ceil()
+	if metrics.CapHeight <= 0 {
+		top = baseline - baseline*7/10
+	}
+	box := image.NewGray(image.Rect(0, 0, w, height))
+	for x := range w {
+		for y := range height {
+			inside := x >= 1 && x <= w-2 && y >= top && y <= baseline-1
+			edge := x == 1 || x == w-2 || y == top || y == baseline-1
+			if inside && edge {
+				box.SetGray(x, y, color.Gray{})
+			} else {
+				box.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	f.Glyphs = append(f.Glyphs, badgeimg.Pack(w, height, box, badgeimg.LayoutBadger))
+	f.Advances = append(f.Advances, w)
+	return f, missing
+}
+
+// rasterizeGlyph draws the glyph of r with its baseline on row baseline, in a
+// bitmap height pixels high and as wide as its advance, or its ink when that
+// goes further. Pixels at least half covered are black.
+func rasterizeGlyph(face font.Face, r rune, height, baseline int) ([]byte, int, bool) {
+	dr, mask, maskp, advance, ok := face.Glyph(fixed.P(0, baseline), r)
+	if !ok {
+		return nil, 0, false
+	}
+	w := max(advance.Round(), dr.Max.X)
+	img := image.NewGray(image.Rect(0, 0, w, height))
+	for x := range w {
+		for y := range height {
+			img.SetGray(x, y, color.Gray{Y: 0xff})
+		}
+	}
+	if mask != nil {
+		for y := max(dr.Min.Y, 0); y < min(dr.Max.Y, height); y++ {
+			for x := max(dr.Min.X, 0); x < dr.Max.X; x++ {
+				_, _, _, a := mask.At(maskp.X+x-dr.Min.X, maskp.Y+y-dr.Min.Y).RGBA()
+				if a >= 0x8000 {
+					img.SetGray(x, y, color.Gray{})
+				}
+			}
+		}
+	}
+	return badgeimg.Pack(w, height, img, badgeimg.LayoutBadger), advance.Round(), true
+}
+
+// FprintFont writes f as a Go file of package pkg to w, starting with header:
+// its glyphs in a nameGlyphs byte slice, found through nameOffsets and
+// nameRunes, and a nameGlyph function looking a rune up
+func FprintFont(w io.Writer, header, pkg, name string, f *BitmapFont) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%spackage %s\n\n", header, pkg)
+	fmt.Fprintf(&b, "// the height of every glyph, and the row of their baseline, in pixels\nconst (\n\t%sHeight = %d\n\t%sBaseline = %d\n)\n\n", name, f.Height, name, f.Baseline)
+
+	fmt.Fprintf(&b, "// %sRunes holds the runes of the font, sorted: glyph i draws rune i,\n", name)
+	fmt.Fprintf(&b, "// and the last glyph is the box drawn for any other rune\nvar %sRunes = []rune{", name)
+	for i, r := range f.Runes {
+		if i%8 == 0 {
+			b.WriteString("\n\t")
+		} else {
+			b.WriteString(" ")
+		}
+		b.WriteString(strconv.QuoteRune(r) + ",")
+	}
+	b.WriteString("\n}\n\n")
+
+	fmt.Fprintf(&b, "// %sAdvances holds how far each glyph moves the pen, in pixels\nvar %sAdvances = []uint8{", name, name)
+	for i, a := range f.Advances {
+		if a > 0xff {
+			return fmt.Errorf("error: glyph %s moves the pen %d pixels, more than the %d a font file can hold: use a smaller -size", glyphName(f, i), a, 0xff)
+		}
+		if i%16 == 0 {
+			b.WriteString("\n\t")
+		} else {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%d,", a)
+	}
+	b.WriteString("\n}\n\n")
+
+	fmt.Fprintf(&b, "// %sOffsets holds where each glyph starts, and where the last one ends\n", name)
+	fmt.Fprintf(&b, "var %sOffsets = []uint16{", name)
+	offset := 0
+	for i := 0; i <= len(f.Glyphs); i++ {
+		if i%16 == 0 {
+			b.WriteString("\n\t")
+		} else {
+			b.WriteString(" ")
+		}
+		fmt.Fprintf(&b, "%d,", offset)
+		if i < len(f.Glyphs) {
+			offset += len(f.Glyphs[i])
+		}
+	}
+	b.WriteString("\n}\n\n")
+	if offset > 0xffff {
+		return fmt.Errorf("error: the glyphs take %d bytes, more than the %d a font file can hold: use a smaller -size or fewer -chars", offset, 0xffff)
+	}
+
+	fmt.Fprintf(&b, "// %sGlyphs holds the glyphs, packed column by column like images\n", name)
+	fmt.Fprintf(&b, "var %sGlyphs = []byte{", name)
+	for i, glyph := range f.Glyphs {
+		fmt.Fprintf(&b, "\n\t// %s", glyphName(f, i))
+		for j, v := range glyph {
+			if j%16 == 0 {
+				b.WriteString("\n\t")
+			} else {
+				b.WriteString(" ")
+			}
+			fmt.Fprintf(&b, "0x%02X,", v)
+		}
+	}
+	b.WriteString("\n}\n\n")
+
+	fmt.Fprintf(&b, `// %[1]sGlyph returns the packed bitmap of r, its width and how far it
+// moves the pen, both in pixels. Runes the font doesn't have get a box.
+func %[1]sGlyph(r rune) ([]byte, int, int) {
+	i, j := 0, len(%[1]sRunes)
+	for i < j {
+		h := int(uint(i+j) >> 1)
+		if %[1]sRunes[h] < r {
+			i = h + 1
+		} else {
+			j = h
+		}
+	}
+	if i < len(%[1]sRunes) && %[1]sRunes[i] != r {
+		i = len(%[1]sRunes)
+	}
+	data := %[1]sGlyphs[%[1]sOffsets[i]:%[1]sOffsets[i+1]]
+	return data, len(data) * 8 / %[1]sHeight, int(%[1]sAdvances[i])
+}
+`, name)
+
+	src, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// glyphName names glyph i of f in the comments of FprintFont
+func glyphName(f *BitmapFont, i int) string {
+	if i == len(f.Runes) {
+		return "the box"
+	}
+	return strconv.QuoteRune(f.Runes[i])
+}
+
+// setupFont sets up the font command
+func setupFont(fs *flag.FlagSet, opts *Options) func(args []string) error {
+	var (
+		size  float64
+		chars string
+	)
+	writeFlags(fs, opts)
+	fs.Float64Var(&size, "size", 12, "set the size of the font in points, which are pixels")
+	fs.StringVar(&chars, "chars", asciiChars, "set the characters to rasterize (default: printable ASCII)")
+	fs.StringVar(&opts.Output, "o", "", "write the Go file to this file, or to stdout with - (default: named after the font and size, next to it)")
+	fs.StringVar(&opts.VarName, "var", "", "set the prefix of the names declared (default: derived from the output name)")
+	fs.StringVar(&opts.Package, "pkg", "", "set the package of the Go file (default main)")
+	fs.BoolVar(&opts.Export, "export", false, "export the names declared")
+	return func(args []string) error {
+		if len(args) != 1 {
+			return usagef("error: font takes a single font file")
+		}
+		if size <= 0 {
+			return usagef("error: -size must be positive")
+		}
+		if chars == "" {
+			return usagef("error: -chars can't be empty")
+		}
+		if opts.Package != "" {
+			if err := checkGoName("-pkg", opts.Package, opts.goPackage()); err != nil {
+				return usageError{err}
+			}
+		}
+		if opts.VarName != "" {
+			if err := checkGoName("-var", opts.VarName, opts.goVarName("")); err != nil {
+				return usageError{err}
+			}
+		}
+		opts.Command = generateCommand(fs)
+
+		face, err := LoadFace(args[0], size)
+		if err != nil {
+			return err
+		}
+		defer face.Close()
+		f, missing := RasterizeFont(face, chars)
+		for _, r := range missing {
+			logger.Warnf("%s has no glyph for %s, which is drawn as a box", args[0], strconv.QuoteRune(r))
+		}
+		base := fmt.Sprintf("%s-%s", inputName(args[0]), strconv.FormatFloat(size, 'f', -1, 64))
+		_, err = opts.writeOutput(base+"-generated.go", func(w io.Writer) error {
+			return FprintFont(w, opts.generatedHeader("//", "//go:generate ", opts.outputDir(base)), opts.goPackage(), opts.goVarName(base), f)
+		})
+		if err != nil {
+			return fmt.Errorf("error writing font: %w", err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gomono"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// goFace returns a face of the Go font ttf, size points high
+func goFace(t *testing.T, ttf []byte, size float64) font.Face {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "font.ttf")
+	if err := os.WriteFile(path, ttf, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	face, err := LoadFace(path, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return face
+}
+
+// glyphArt draws a packed glyph of height pixels, a line per row with # for
+// black pixels
+func glyphArt(t *testing.T, glyph []byte, height int) string {
+	t.Helper()
+	width := len(glyph) * 8 / height
+	img, err := badgeimg.BytesToImg(width, height, glyph, badgeimg.LayoutBadger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	for y := range height {
+		for x := range width {
+			if img.GrayAt(x, y).Y == 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestRasterizeFont(t *testing.T) {
+	f, missing := RasterizeFont(goFace(t, goregular.TTF, 12), "A")
+	if len(missing) != 0 || len(f.Runes) != 1 || f.Height != 16 || f.Baseline != 12 {
+		t.Fatalf("expected A alone, 16 pixels high with its baseline on row 12, got %q (missing %q), %d and %d", f.Runes, missing, f.Height, f.Baseline)
+	}
+	want := `........
+........
+........
+....#...
+...##...
+...##...
+..#.##..
+..#..#..
+.##..##.
+.######.
+.#....#.
+#.....##
+........
+........
+........
+........
+`
+	if got := glyphArt(t, f.Glyphs[0], f.Height); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestRasterizeFontWidths(t *testing.T) {
+	mono, _ := RasterizeFont(goFace(t, gomono.TTF, 16), "ilmW")
+	for i, advance := range mono.Advances[:len(mono.Runes)] {
+		if advance != mono.Advances[0] || len(mono.Glyphs[i]) != len(mono.Glyphs[0]) {
+			t.Errorf("expected every glyph of a monospace font to be as wide, got %v", mono.Advances)
+			break
+		}
+	}
+	sans, _ := RasterizeFont(goFace(t, goregular.TTF, 16), "im")
+	if sans.Advances[0] >= sans.Advances[1] {
+		t.Errorf("expected i to be narrower than m, got %v", sans.Advances)
+	}
+}
+
+func TestFontCommand(t *testing.T) {
+	dir := t.TempDir()
+	ttf := filepath.Join(dir, "Go-Regular.ttf")
+	if err := os.WriteFile(ttf, goregular.TTF, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "sans.go")
+	code, _, errOut := runCLI(t, "font", "-size", "12", "-chars", "AB\U0001F600", "-export", "-var", "sans", "-pkg", "fonts", "-o", out, ttf)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	if !strings.Contains(errOut, "no glyph for '\U0001F600'") {
+		t.Errorf("expected the missing glyph to be reported, got\n%s", errOut)
+	}
+	src, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), "//go:generate gopherbadgeimg font -chars") {
+		t.Errorf("expected the font command in the header, got\n%s", src)
+	}
+	got := runGoModule(t, map[string]string{
+		"fonts/sans.go": string(src),
+		"main.go": `package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"example.com/badge/fonts"
+)
+
+func main() {
+	a, w, advance := fonts.SansGlyph('A')
+	box, _, _ := fonts.SansGlyph('\U0001F600')
+	other, _, _ := fonts.SansGlyph('z')
+	fmt.Println(len(a), w, advance, bytes.Equal(box, other), bytes.Equal(a, box))
+}
+`,
+	})
+	// 8 columns of 16 pixels, and both runes missing get the box
+	if want := "16 8 8 true false\n"; got != want {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
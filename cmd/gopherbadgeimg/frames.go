@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Frame is a single, fully composited frame of an (possibly animated) image
+type Frame struct {
+	Image image.Image
+	// Delay is how long the frame is shown, in milliseconds
+	Delay int
+}
+
+// LoadFrames loads infile and returns every frame it contains.
+//
+// Animated GIFs are composited onto a canvas the size of the whole animation,
+// honoring each frame's disposal method, so every returned frame is exactly
+// what a viewer would show at that point. Every other image is a single frame,
+// except for icon files when -frame is set: those return every size they
+// contain so that one can be picked, rather than the largest.
+func (o *Options) LoadFrames(infile string) ([]Frame, error) {
+	data, err := ReadInput(infile)
+	if err == nil {
+		err = checkEmpty(infile, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o.DecodeFrames(data)
+}
+
+// DecodeFrames is LoadFrames for an image that has already been read
+func (o *Options) DecodeFrames(data []byte) ([]Frame, error) {
+	return o.decodeFrames(data, nil)
+}
+
+// decodeFrames is DecodeFrames only compositing the frames of animations that
+// picks, when it isn't nil, reports it keeps: the others are left without
+// an image, their delay alone being kept.
+func (o *Options) decodeFrames(data []byte, picks func(n, i int) bool) ([]Frame, error) {
+	if o.Raw != "" {
+		src, err := o.decodeRaw(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Frame{{Image: src}}, nil
+	}
+	if o.FrameIndex >= 0 && bytes.HasPrefix(data, []byte(icoMagic)) {
+		images, err := decodeICOEntries(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		frames := make([]Frame, len(images))
+		for i, img := range images {
+			frames[i].Image = img
+		}
+		return frames, nil
+	}
+	if !bytes.HasPrefix(data, []byte("GIF8")) {
+		src, err := decodeImg(data)
+		if err != nil {
+			return nil, err
+		}
+		return []Frame{{Image: src}}, nil
+	}
+	// every frame is composited onto a canvas of the size in the header
+	if err := checkDecodeSize(data); err != nil {
+		return nil, err
+	}
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, explainDecode(data, "gif", err)
+	}
+	return compositeGIF(g, picks), nil
+}
+
+// compositeGIF replays the frames of an animated GIF onto a canvas.
+//
+// GIF frames often only cover the part of the canvas that changed, and each
+// one says what should happen to its area before the next frame is drawn:
+// leave it (DisposalNone), clear it to the background (DisposalBackground), or
+// put back what was there before (DisposalPrevious). The canvas starts out as
+// the background, and the transparent pixels of a frame leave what is under
+// them as it was.
+//
+// Every frame is drawn onto the canvas, as the ones after it depend on it,
+// but only those picks keeps, or all of them when it is nil, are kept as
+// images of their own: an animation at the largest size allowed would
+// otherwise take gigabytes for the single frame -frame converts.
+func compositeGIF(g *gif.GIF, picks func(n, i int) bool) []Frame {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+
+	background := gifBackground(g)
+	draw.Draw(canvas, bounds, image.NewUniform(background), image.Point{}, draw.Src)
+
+	frames := make([]Frame, 0, len(g.Image))
+	for i, img := range g.Image {
+		var previous *image.RGBA
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			draw.Draw(previous, bounds, canvas, image.Point{}, draw.Src)
+		}
+
+		draw.Draw(canvas, img.Bounds(), img, img.Bounds().Min, draw.Over)
+
+		frame := Frame{Delay: g.Delay[i] * 10}
+		if picks == nil || picks(len(g.Image), i) {
+			// snapshot the canvas as it is displayed
+			composed := image.NewRGBA(bounds)
+			draw.Draw(composed, bounds, canvas, image.Point{}, draw.Src)
+			frame.Image = composed
+		}
+		frames = append(frames, frame)
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+// gifBackground returns the background color of the logical screen of g, the
+// entry of its global color table at its background index. Encoders point that
+// index at the transparent color of animations with a transparent background,
+// so it is transparent when the first frame makes it transparent, and when
+// there is no global color table.
+func gifBackground(g *gif.GIF) color.Color {
+	p, ok := g.Config.ColorModel.(color.Palette)
+	if !ok || int(g.BackgroundIndex) >= len(p) {
+		return color.Transparent
+	}
+	if len(g.Image) > 0 && int(g.BackgroundIndex) < len(g.Image[0].Palette) {
+		if _, _, _, a := g.Image[0].Palette[g.BackgroundIndex].RGBA(); a == 0 {
+			return color.Transparent
+		}
+	}
+	return p[g.BackgroundIndex]
+}
+
+// frameRange is a -frames START:END:STEP selection of the frames of an
+// animation, as Python slices them: START and END may be left out for the
+// first and the end, and count from the end when negative.
+type frameRange struct {
+	start, end *int
+	step       int
+}
+
+// parseFrameRange parses the value of -frames
+func parseFrameRange(s string) (frameRange, error) {
+	r := frameRange{step: 1}
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return r, fmt.Errorf("error: invalid -frames `%s`, expected START:END:STEP such as 0:60:5, any of them optional", s)
+	}
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return r, fmt.Errorf("error: invalid -frames `%s`, `%s` isn't a frame number", s, part)
+		}
+		switch i {
+		case 0:
+			r.start = &n
+		case 1:
+			r.end = &n
+		default:
+			if n <= 0 {
+				return r, fmt.Errorf("error: invalid -frames `%s`, the step must be positive", s)
+			}
+			r.step = n
+		}
+	}
+	return r, nil
+}
+
+// bounds returns the indices r starts and ends at among n frames, and
+// whether they had to be clamped to them
+func (r frameRange) bounds(n int) (start, end int, clamped bool) {
+	index := func(i *int, unset int) int {
+		if i == nil {
+			return unset
+		}
+		v := *i
+		if v < 0 {
+			v += n
+		}
+		if v < 0 || v > n {
+			clamped = true
+		}
+		return min(max(v, 0), n)
+	}
+	return index(r.start, 0), index(r.end, n), clamped
+}
+
+// picksFrame reports whether -frame or -frames pick frame i of the n frames
+// of an animation
+func (o *Options) picksFrame(n, i int) bool {
+	if o.FrameIndex >= 0 {
+		return i == o.FrameIndex
+	}
+	if o.Frames == "" {
+		return true
+	}
+	r, err := parseFrameRange(o.Frames)
+	if err != nil {
+		// selectFrames reports it
+		return true
+	}
+	start, end, _ := r.bounds(n)
+	return i >= start && i < end && (i-start)%r.step == 0
+}
+
+// selectFrames returns the frames of in that -frames selects, each shown for
+// as long as the frames it stands for were. Indices past the frames are
+// clamped to them with a warning.
+func (o *Options) selectFrames(in Input, frames []Frame) ([]Frame, error) {
+	r, err := parseFrameRange(o.Frames)
+	if err != nil {
+		return nil, err
+	}
+	start, end, clamped := r.bounds(len(frames))
+	if clamped {
+		logger.Warnf("%s: -frames %s goes past its %d frame(s), taking %d:%d", in, o.Frames, len(frames), start, end)
+	}
+	if start >= end {
+		return nil, fmt.Errorf("error: -frames %s selects none of the %d frame(s) of %s", o.Frames, len(frames), in)
+	}
+	selected := make([]Frame, 0, (end-start+r.step-1)/r.step)
+	for i := start; i < end; i += r.step {
+		frame := Frame{Image: frames[i].Image}
+		for _, skipped := range frames[i:min(i+r.step, end)] {
+			frame.Delay += skipped.Delay
+		}
+		selected = append(selected, frame)
+	}
+	return selected, nil
+}
+
+// ConcatFrames joins packed frames into a single buffer.
+//
+// The buffer starts with the frame count as a little-endian uint16, followed by
+// the frames back to back. All frames have the same size, so the firmware can
+// find frame n at 2 + n*len(frame). More frames than the count can hold are an
+// error.
+func ConcatFrames(frames [][]byte) ([]byte, error) {
+	if len(frames) > math.MaxUint16 {
+		return nil, fmt.Errorf("error: %d frames are more than the %d a concatenated animation can hold, pick fewer with -frames", len(frames), math.MaxUint16)
+	}
+	buf := make([]byte, 2, 2+len(frames)*len(frames[0]))
+	binary.LittleEndian.PutUint16(buf, uint16(len(frames)))
+	for _, f := range frames {
+		buf = append(buf, f...)
+	}
+	return buf, nil
+}
+
+// WriteFramesToGoFile is the multi-frame version of WriteToGoFile.
+//
+// It creates a [][]byte with one entry per frame, and a slice with the delay
+// of each frame in milliseconds.
+func WriteFramesToGoFile(filename, variablename string, frames [][]byte, delays []int) error {
+	o := &Options{Force: true}
+	return writeGoFile(o, filename, func(w io.Writer) error {
+		if err := FprintFramesGo(w, o.generatedHeader("//", "", filepath.Dir(filename)), "main", "r"+variablename, frames, delays); err != nil {
+			return err
+		}
+		return fprintGoPacking(w, "r"+variablename, frameLen(frames), o.layoutName(), o.bitOrderName())
+	})
+}
+
+// FprintFramesGo writes the go file created by WriteFramesToGoFile to w,
+// starting with header: name and nameDelays variables in package pkg. Without
+// delays, as for the cells of a sheet, only name is declared. Like FprintGo,
+// it is written with a single Write.
+func FprintFramesGo(w io.Writer, header, pkg, name string, frames [][]byte, delays []int) error {
+	buf := fmt.Appendf(nil, "%spackage %s\n\nvar %s = [][]byte{", header, pkg, name)
+	for _, frame := range frames {
+		buf = append(buf, "\n\t{"...)
+		buf = appendGoBytes(buf, frame, "\n\t\t")
+		buf = append(buf, "\n\t},"...)
+	}
+	if delays == nil {
+		buf = append(buf, "\n}\n"...)
+	} else {
+		buf = fmt.Appendf(buf, "\n}\n\n// %sDelays holds how long each frame is shown, in milliseconds\nvar %sDelays = []int{", name, name)
+		for i, d := range delays {
+			if i > 0 {
+				buf = append(buf, ", "...)
+			}
+			buf = strconv.AppendInt(buf, int64(d), 10)
+		}
+		buf = append(buf, "}\n"...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// bitAt reports whether pixel (i, j) is set in a column major 1-bit buffer
+func bitAt(y, i, j int, imgBits []byte) bool {
+	offset := i*y + j
+	return imgBits[offset/8]&(1<<uint(7-offset%8)) != 0
+}
+
+func TestLoadFramesRestoreBackground(t *testing.T) {
+	opts := NewOptions()
+	opts.DisableDithering = true
+
+	frames, err := opts.LoadFrames("testdata/restore-background.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 frames, got %d", len(frames))
+	}
+	for i, delay := range []int{100, 200, 300} {
+		if frames[i].Delay != delay {
+			t.Errorf("frame %d: expected a %dms delay, got %dms", i, delay, frames[i].Delay)
+		}
+	}
+
+	packed := make([][]byte, len(frames))
+	for i, frame := range frames {
+		packed[i] = opts.ImgToBytes(8, 8, &frame.Image)
+	}
+	// frame 0 is a white canvas, frame 1 paints the top left quarter black
+	// and frame 2 the bottom right one, after frame 1 was cleared back to the
+	// white background
+	expected := []struct{ topLeft, bottomRight bool }{
+		{false, false},
+		{true, false},
+		{false, true},
+	}
+	for n, e := range expected {
+		if got := bitAt(8, 1, 1, packed[n]); got != e.topLeft {
+			t.Errorf("frame %d: expected top left to be %v, got %v", n, e.topLeft, got)
+		}
+		if got := bitAt(8, 6, 6, packed[n]); got != e.bottomRight {
+			t.Errorf("frame %d: expected bottom right to be %v, got %v", n, e.bottomRight, got)
+		}
+	}
+}
+
+func TestConcatFrames(t *testing.T) {
+	frames := [][]byte{{1, 2}, {3, 4}, {5, 6}}
+	buf, err := ConcatFrames(frames)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := binary.LittleEndian.Uint16(buf); count != 3 {
+		t.Errorf("expected a frame count of 3, got %d", count)
+	}
+	if !bytes.Equal(buf[2:], []byte{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("unexpected frame data % X", buf[2:])
+	}
+
+	// the count is a uint16
+	frames = make([][]byte, math.MaxUint16+1)
+	for i := range frames {
+		frames[i] = []byte{byte(i)}
+	}
+	if _, err := ConcatFrames(frames); err == nil || !strings.Contains(err.Error(), "65536 frames are more than the 65535") {
+		t.Errorf("expected %d frames to be rejected, got %v", len(frames), err)
+	}
+	buf, err = ConcatFrames(frames[:math.MaxUint16])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := binary.LittleEndian.Uint16(buf); count != math.MaxUint16 || len(buf) != 2+math.MaxUint16 {
+		t.Errorf("expected %d frames, got a count of %d and %d bytes", math.MaxUint16, count, len(buf))
+	}
+}
+
+// writeCountingGIF writes an 8x8 animation of n frames to path, frame i having
+// its first i pixels black and being shown for (i+1)*10ms
+func writeCountingGIF(t *testing.T, path string, n int) {
+	t.Helper()
+	g := &gif.GIF{}
+	for i := range n {
+		frame := image.NewPaletted(image.Rect(0, 0, 8, 8), color.Palette{color.White, color.Black})
+		for p := range i {
+			frame.SetColorIndex(p%8, p/8, 1)
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, i+1)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSelectFrames(t *testing.T) {
+	dir := t.TempDir()
+	anim := filepath.Join(dir, "anim.gif")
+	writeCountingGIF(t, anim, 12)
+
+	for _, test := range []struct {
+		frames string
+		// want are the frames kept, counted by their black pixels
+		want   []int
+		delays []int
+		warned bool
+	}{
+		{"0:10:3", []int{0, 3, 6, 9}, []int{60, 150, 240, 100}, false},
+		{"2:-2:4", []int{2, 6}, []int{180, 340}, false},
+		{"-3:", []int{9, 10, 11}, []int{100, 110, 120}, false},
+		{"::5", []int{0, 5, 10}, []int{150, 400, 230}, false},
+		{"-20:50:6", []int{0, 6}, []int{210, 570}, true},
+	} {
+		out := filepath.Join(t.TempDir(), "anim.bin")
+		manifest := filepath.Join(dir, "manifest.json")
+		code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "8x8", "-disable-dithering", "-frames", test.frames, "-o", out, "-manifest", manifest, "-force", anim)
+		if code != 0 {
+			t.Fatalf("%s: expected exit code 0, got %d and\n%s", test.frames, code, errOut)
+		}
+		if warned := strings.Contains(errOut, "goes past its 12 frame(s)"); warned != test.warned {
+			t.Errorf("%s: expected a warning %v, got\n%s", test.frames, test.warned, errOut)
+		}
+		m, _ := readManifest(t, manifest)
+		if img := m.Images[0]; img.Frames != len(test.want) || !reflect.DeepEqual(img.Delays, test.delays) {
+			t.Errorf("%s: expected %d frames with delays %v, got %d with %v", test.frames, len(test.want), test.delays, img.Frames, img.Delays)
+		}
+		for i, want := range test.want {
+			data, err := os.ReadFile(framePath(out, i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			black := 0
+			for _, b := range data {
+				black += bits.OnesCount8(b)
+			}
+			if black != want {
+				t.Errorf("%s: expected frame %d to be frame %d, got frame %d", test.frames, i, want, black)
+			}
+		}
+	}
+
+	// frames are picked once composited: frame 1 of this one is cleared to
+	// the background before frame 2 is drawn
+	out := filepath.Join(dir, "restore.bin")
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "8x8", "-disable-dithering", "-background", "#ffffff", "-frames", "1::1", "-o", out, "testdata/restore-background.gif"); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	for i, want := range []struct{ topLeft, bottomRight bool }{{true, false}, {false, true}} {
+		data, err := os.ReadFile(framePath(out, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := (struct{ topLeft, bottomRight bool }{bitAt(8, 1, 1, data), bitAt(8, 6, 6, data)}); got != want {
+			t.Errorf("restore-background frame %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+		code int
+	}{
+		{[]string{"-frames", "5"}, "invalid -frames `5`", exitUsage},
+		{[]string{"-frames", "0:x"}, "`x` isn't a frame number", exitUsage},
+		{[]string{"-frames", "::0"}, "the step must be positive", exitUsage},
+		{[]string{"-frames", "0:5", "-frame", "1"}, "-frame and -frames can't be used together", exitUsage},
+		{[]string{"-frames", "8:4"}, "-frames 8:4 selects none of the 12 frame(s)", exitFailure},
+	} {
+		args := append([]string{"-outmode", "none", "-ratio", "8x8"}, test.args...)
+		if code, _, errOut := runCLI(t, append(args, anim)...); code != test.code || !strings.Contains(errOut, test.want) {
+			t.Errorf("%v: expected exit code %d and %q, got %d and\n%s", test.args, test.code, test.want, code, errOut)
+		}
+	}
+}
+
+func TestCompositeGIF(t *testing.T) {
+	// disposal.gif has a gray background in its logical screen descriptor and
+	// four frames, each covering a quarter of the canvas: the top left one
+	// kept (DisposalNone), the top right one with a transparent column and
+	// cleared to the background (DisposalBackground), the bottom left one
+	// restored to what was under it (DisposalPrevious) and the bottom right
+	// one
+	frames, err := NewOptions().LoadFrames("testdata/disposal.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 4 {
+		t.Fatalf("expected 4 frames, got %d", len(frames))
+	}
+	for i, frame := range frames {
+		f, err := os.Open(fmt.Sprintf("testdata/disposal-%d.png", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := png.Decode(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := range 8 {
+			for x := range 8 {
+				got, expected := color.RGBAModel.Convert(frame.Image.At(x, y)), color.RGBAModel.Convert(want.At(x, y))
+				if got != expected {
+					t.Errorf("frame %d: expected %v at %d,%d, got %v", i, expected, x, y, got)
+				}
+			}
+		}
+	}
+
+	// a background index that the first frame makes transparent leaves the
+	// canvas transparent, for -background to show through
+	palette := color.Palette{color.Black, color.Transparent}
+	g := &gif.GIF{
+		Image:           []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 2, 2), palette)},
+		Delay:           []int{0},
+		Config:          image.Config{ColorModel: palette, Width: 4, Height: 4},
+		BackgroundIndex: 1,
+	}
+	if _, _, _, a := compositeGIF(g, nil)[0].Image.At(3, 3).RGBA(); a != 0 {
+		t.Errorf("expected the canvas to stay transparent, got alpha %d", a)
+	}
+}
+
+func TestDecodePickedFrames(t *testing.T) {
+	data, err := os.ReadFile("testdata/disposal.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all, err := NewOptions().DecodeFrames(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name   string
+		frame  int
+		frames string
+		picked []int
+	}{
+		{"-frames 1::2", -1, "1::2", []int{1, 3}},
+		// frame 3 is drawn after frame 2 is disposed of, as if it was kept
+		{"-frame 3", 3, "", []int{3}},
+		{"-frames -2:", -1, "-2:", []int{2, 3}},
+	} {
+		opts := NewOptions()
+		opts.FrameIndex, opts.Frames = test.frame, test.frames
+		frames, err := opts.decodeFrames(data, opts.picksFrame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, frame := range frames {
+			if frame.Delay != all[i].Delay {
+				t.Errorf("%s: expected frame %d to keep its delay %d, got %d", test.name, i, all[i].Delay, frame.Delay)
+			}
+			switch picked := slices.Contains(test.picked, i); {
+			case !picked && frame.Image != nil:
+				t.Errorf("%s: expected frame %d to be left out", test.name, i)
+			case picked && (frame.Image == nil || !reflect.DeepEqual(frame.Image, all[i].Image)):
+				t.Errorf("%s: expected frame %d to be composited as it is with every frame kept", test.name, i)
+			}
+		}
+	}
+}
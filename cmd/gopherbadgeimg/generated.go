@@ -0,0 +1,191 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// unstableFlags are the flags left out of the command generated files say to
+// regenerate them with: they don't change what is written, -watch would
+// never return, and -verify wouldn't regenerate anything
+var unstableFlags = []string{"v", "watch", "show", "show-style", "show-on", "show-off", "show-color", "show-width", "jobs", "fail-fast", "force", "force-write", "verify", "durable", "progress", "quiet", "vv", "cache-dir", "cache-max-size", "cache-max-age", "cache-clear", "tune", "send", "baud", "send-timeout", "timings", "cpuprofile", "memprofile"}
+
+// pathFlags are the flags naming files or directories. Like the inputs, the
+// command generated files say to regenerate them with gives them relative to
+// the directory of the file, which go generate runs the command in.
+var pathFlags = []string{"o", "outdir", "bundle", "manifest", "batch-file", "template", "data", "dither-matrix", "text-font", "overlay", "from-base64", "preview", "preview-gif", "compare", "palette-report"}
+
+// commandLine is the command line generated files are regenerated with, see
+// generateCommand
+type commandLine []commandWord
+
+// commandWord is a word of a command. The words naming a file hold its
+// absolute path, along with what follows it in the word: the position of
+// -overlay or the entry of an archive.
+type commandWord struct {
+	text   string
+	path   bool
+	suffix string
+}
+
+// generateCommand returns the command line generated files are regenerated
+// with: the bare command name, followed by the subcommand fs belongs to but
+// for convert, the flags set on fs (in a fixed order, rather than the order
+// they were given in) and the arguments
+func generateCommand(fs *flag.FlagSet) commandLine {
+	c := commandLine{{text: "gopherbadgeimg"}}
+	if fs.Name() != "convert" {
+		c = append(c, commandWord{text: fs.Name()})
+	}
+	fs.Visit(func(f *flag.Flag) {
+		if slices.Contains(unstableFlags, f.Name) {
+			return
+		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			if f.Value.String() == "true" {
+				c = append(c, commandWord{text: "-" + f.Name})
+			} else {
+				c = append(c, commandWord{text: "-" + f.Name + "=" + f.Value.String()})
+			}
+			return
+		}
+		values := []string{f.Value.String()}
+		if list, ok := f.Value.(listValue); ok {
+			// repeated flags are repeated again
+			values = *list.values
+		}
+		for _, v := range values {
+			value := commandWord{text: v}
+			switch {
+			case f.Name == "overlay":
+				// PATH@XxY[,SCALE%]
+				if i := strings.LastIndex(v, "@"); i >= 0 {
+					value = pathWord(v[:i], v[i:])
+				}
+			case f.Name == "from-base64":
+				// the data itself, unless it names a file
+				if info, err := os.Stat(v); err == nil && !info.IsDir() {
+					value = pathWord(v, "")
+				}
+			case slices.Contains(pathFlags, f.Name):
+				value = pathWord(v, "")
+			}
+			c = append(c, commandWord{text: "-" + f.Name}, value)
+		}
+	})
+	for _, arg := range fs.Args() {
+		if archive, entry, ok := splitArchivePath(arg); ok && entry != "" {
+			c = append(c, pathWord(archive, ":"+entry))
+		} else {
+			c = append(c, pathWord(arg, ""))
+		}
+	}
+	return c
+}
+
+// pathWord returns the word of a command naming the file path, followed by
+// suffix. Stdout and stdin, URLs and paths that have no absolute form are
+// left as they are.
+func pathWord(path, suffix string) commandWord {
+	if path == "" || path == stdinName || IsURL(path) {
+		return commandWord{text: path + suffix}
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return commandWord{text: path + suffix}
+	}
+	return commandWord{text: abs, path: true, suffix: suffix}
+}
+
+// in returns the command line as run from dir: the paths relative to it,
+// with forward slashes so that it reads the same on every system, or their
+// base name when they can't be made relative to it, and the words quoted as
+// go:generate expects when they need to be
+func (c commandLine) in(dir string) string {
+	absDir, dirErr := filepath.Abs(dir)
+	words := make([]string, len(c))
+	for i, w := range c {
+		text := w.text
+		if w.path {
+			rel, err := filepath.Rel(absDir, w.text)
+			if dirErr != nil || err != nil {
+				rel = filepath.Base(w.text)
+			}
+			text = filepath.ToSlash(rel) + w.suffix
+		}
+		words[i] = quoteWord(text)
+	}
+	return strings.Join(words, " ")
+}
+
+// quoteWord quotes s if go:generate would otherwise not read it back as a
+// single word
+func quoteWord(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"'\\") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+// ditherSetting describes how black and white pixels are picked: the
+// dithering algorithm, none, or the -threshold
+func (o *Options) ditherSetting() string {
+	switch {
+	case o.Threshold == badgeimg.ThresholdAuto && o.Palette == MonoPalette:
+		return "threshold auto"
+	case o.Threshold > 0 && o.Palette == MonoPalette:
+		return fmt.Sprintf("threshold %d", o.Threshold)
+	case o.DisableDithering:
+		return "none"
+	}
+	return o.Dither
+}
+
+// layoutName is the order pixels are packed in, named by
+// badgeimg.Layout.String: -layout for black and white images, the layout
+// palettes pack their codes in, or planes-concat or planes-interleave for
+// their bit planes arranged by -planes
+func (o *Options) layoutName() string {
+	switch {
+	case o.Palette != nil && o.Palette.Planes != "":
+		return "planes-" + o.Palette.Planes
+	case o.Palette != nil && o.Palette != MonoPalette:
+		return o.Palette.layout().String()
+	}
+	return o.Layout.String()
+}
+
+// bitOrderName is the order of the pixels in each byte of packed data
+func (o *Options) bitOrderName() string {
+	if o.Palette != nil && o.Palette != MonoPalette {
+		return badgeimg.MSBFirst.String()
+	}
+	return o.Layout.BitOrder.String()
+}
+
+// generatedHeader returns the comment generated files start with, comment
+// being the line comment of their language: the "Code generated" line, the
+// settings the data depends on, and the command that regenerates the file,
+// prefixed with directive (//go:generate for Go files) and run from dir, the
+// directory of the file. None of it depends on where or when the file was
+// generated, so regenerating an unchanged image gives the same bytes on every
+// machine.
+func (o *Options) generatedHeader(comment, directive, dir string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s Code generated by %s DO NOT EDIT.\n", comment, toolVersion())
+	if o.Ratio != "" {
+		fmt.Fprintf(&b, "%s ratio %s, dither %s, layout %s\n", comment, o.Ratio, o.ditherSetting(), o.layoutName())
+	}
+	if o.Command != nil {
+		fmt.Fprintf(&b, "%s\n%s Regenerate with:\n%s\n%s\t%s%s\n", comment, comment, comment, comment, directive, o.Command.in(dir))
+	}
+	b.WriteString("\n")
+	return b.String()
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// generateIn converts a copy of tainigo_128.png in a new directory, from that
+// directory and with arg0 as os.Args[0], and returns the files written
+func generateIn(t *testing.T, arg0 string, args ...string) map[string]string {
+	t.Helper()
+	src, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "gopher.png"), src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldArg0 := os.Args[0]
+	os.Args[0] = arg0
+	defer func() {
+		os.Args[0] = oldArg0
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	}()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := runCLI(t, append(args, "gopher.png")...); code != 0 {
+		t.Fatalf("%v: expected exit code 0, got %d and\n%s", args, code, errOut)
+	}
+
+	files := map[string]string{}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		content, err := os.ReadFile(entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = string(content)
+	}
+	return files
+}
+
+func TestGeneratedHeaderIsDeterministic(t *testing.T) {
+	for _, args := range [][]string{
+		{"-outmode", "rice", "-ratio", "profile", "-v"},
+		{"-outmode", "rice", "-ratio", "splash", "-compress", "rle", "-dither", "atkinson"},
+		{"-outmode", "cheader", "-ratio", "16x16", "-threshold", "100"},
+		{"-outmode", "python", "-ratio", "profile", "-invert"},
+	} {
+		first := generateIn(t, "/tmp/go-build1234/b001/exe/gopherbadgeimg", args...)
+		second := generateIn(t, "gopherbadgeimg", args...)
+		if len(first) != len(second) {
+			t.Fatalf("%v: expected the same files, got %d and %d", args, len(first), len(second))
+		}
+		for name, content := range first {
+			if second[name] != content {
+				t.Errorf("%v: %s differs between runs:\n%s\n\n%s", args, name, content, second[name])
+			}
+			if strings.Contains(content, "go-build") || strings.Contains(content, os.TempDir()) {
+				t.Errorf("%v: %s holds a path:\n%s", args, name, content)
+			}
+		}
+	}
+
+	files := generateIn(t, "gopherbadgeimg", "-v", "-outmode", "rice", "-ratio", "profile", "-dither", "bayer")
+	header, _, _ := strings.Cut(files["profile-generated.go"], "package main")
+	for _, want := range []string{
+		"// Code generated by gopherbadgeimg",
+		"// ratio profile, dither bayer, layout badger\n",
+		"//\t//go:generate gopherbadgeimg -dither bayer -outmode rice -ratio profile gopher.png\n",
+	} {
+		if !strings.Contains(header, want) {
+			t.Errorf("expected the header to contain %q, got\n%s", want, header)
+		}
+	}
+
+	// the command names the files relative to the generated file, however
+	// they were given and wherever it was run from
+	src, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	for _, dir := range []string{"img", "out", "sub"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, "img", "gopher.png"), src, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.Chdir(wd); err != nil {
+			t.Fatal(err)
+		}
+	}()
+
+	want := "//\t//go:generate gopherbadgeimg -outdir . -outmode rice -overlay ../img/gopher.png@4x4,50% -ratio profile ../img/gopher.png\n"
+	var first string
+	for _, run := range []struct {
+		dir      string
+		img, out string
+	}{
+		{root, "img/gopher.png", "out"},
+		{filepath.Join(root, "sub"), "../img/gopher.png", "../out"},
+		{filepath.Join(root, "sub"), filepath.Join(root, "img", "gopher.png"), filepath.Join(root, "out")},
+	} {
+		if err := os.Chdir(run.dir); err != nil {
+			t.Fatal(err)
+		}
+		code, _, errOut := runCLI(t, "-outmode", "rice", "-ratio", "profile", "-force", "-outdir", run.out, "-overlay", run.img+"@4x4,50%", run.img)
+		if code != 0 {
+			t.Fatalf("%s: expected exit code 0, got %d and\n%s", run.img, code, errOut)
+		}
+		content, err := os.ReadFile(filepath.Join(root, "out", "profile-generated.go"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(content), want) {
+			t.Errorf("%s: expected the header to contain %q, got\n%s", run.img, want, content)
+		}
+		if strings.Contains(string(content), root) {
+			t.Errorf("%s: expected no absolute path, got\n%s", run.img, content)
+		}
+		if first == "" {
+			first = string(content)
+		} else if string(content) != first {
+			t.Errorf("%s: expected the same file as from %s, got\n%s\n\n%s", run.img, root, content, first)
+		}
+	}
+}
+
+func TestGenerateCommand(t *testing.T) {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.String("ratio", "", "")
+	fs.String("var", "", "")
+	fs.Bool("invert", false, "")
+	fs.Bool("header", true, "")
+	fs.Bool("v", false, "")
+	if err := fs.Parse([]string{"-v", "-var", "my image", "-ratio", "profile", "-invert", "-header=false", "a b.png", "c.png"}); err != nil {
+		t.Fatal(err)
+	}
+	want := `gopherbadgeimg -header=false -invert -ratio profile -var "my image" "a b.png" c.png`
+	if got := generateCommand(fs).in("."); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	// repeated flags are repeated, and paths are relative to the directory
+	// the command runs in
+	var overlays []string
+	fs = flag.NewFlagSet("convert", flag.ContinueOnError)
+	fs.Var(listValue{&overlays}, "overlay", "")
+	fs.String("outdir", "", "")
+	if err := fs.Parse([]string{"-overlay", "a.png@0x0", "-overlay", "b.png@8x8,50%", "-outdir", "out", "-", "c.png", "pack.zip:icons/d.png", "https://example.com/e.png"}); err != nil {
+		t.Fatal(err)
+	}
+	want = "gopherbadgeimg -outdir . -overlay ../a.png@0x0 -overlay ../b.png@8x8,50% - ../c.png ../pack.zip:icons/d.png https://example.com/e.png"
+	if got := generateCommand(fs).in("out"); got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+}
+
+func TestGoIdentifier(t *testing.T) {
+	for in, want := range map[string]string{
+		"splash":     "splash",
+		"my-icon":    "myicon",
+		"128x128":    "_128x128",
+		"café":       "café",
+		"ゴーファー":      "ゴーファー",
+		"gopher.png": "gopherpng",
+	} {
+		if got := goIdentifier(in); got != want {
+			t.Errorf("%q: expected %q, got %q", in, want, got)
+		}
+	}
+	for _, test := range []struct{ flag, name string }{
+		{"-var", "type"},
+		{"-var", "ty-pe"},
+		{"-var", "!!!"},
+		{"-pkg", "func"},
+		{"-pkg", "_"},
+	} {
+		if err := checkGoName(test.flag, test.name, goIdentifier(test.name)); err == nil {
+			t.Errorf("%s %q: expected an error", test.flag, test.name)
+		}
+	}
+}
+
+// parseGo parses the source of a Go file, returning its package name and the
+// names of the variables and constants it declares
+func parseGo(t *testing.T, name, src string) (string, []string) {
+	t.Helper()
+	file, err := parser.ParseFile(token.NewFileSet(), name, src, 0)
+	if err != nil {
+		t.Fatalf("expected %s to parse: %v\n%s", name, err, src)
+	}
+	var names []string
+	for _, decl := range file.Decls {
+		if gen, ok := decl.(*ast.GenDecl); ok {
+			for _, spec := range gen.Specs {
+				names = append(names, spec.(*ast.ValueSpec).Names[0].Name)
+			}
+		}
+	}
+	return file.Name.Name, names
+}
+
+// goDecls returns the names rice mode declares for the variable name: the
+// variable and the constants describing it
+func goDecls(name string) []string {
+	return []string{name, name + "Width", name + "Height", name + "Len", name + "Layout", name + "BitOrder"}
+}
+
+func TestGoNames(t *testing.T) {
+	tests := []struct {
+		args  []string
+		pkg   string
+		names []string
+	}{
+		// the names from before -var and -pkg
+		{[]string{}, "main", goDecls("rprofile")},
+		{[]string{"-var", "splash", "-pkg", "assets"}, "assets", goDecls("splash")},
+		{[]string{"-var", "café-1", "-checksum", "append"}, "main", append(goDecls("café1"), "café1CRC32")},
+		{[]string{"-var", "2024 splash", "-pkg", "3d"}, "_3d", goDecls("_2024splash")},
+		{[]string{"-pkg", "badge", "-compress", "rle"}, "badge", goDecls("rprofile")},
+	}
+	for _, test := range tests {
+		args := append([]string{"-outmode", "rice", "-ratio", "profile"}, test.args...)
+		files := generateIn(t, "gopherbadgeimg", args...)
+		pkg, names := parseGo(t, "profile-generated.go", files["profile-generated.go"])
+		if pkg != test.pkg || strings.Join(names, ",") != strings.Join(test.names, ",") {
+			t.Errorf("%v: expected package %s declaring %v, got package %s declaring %v", test.args, test.pkg, test.names, pkg, names)
+		}
+		if decoder, ok := files["rle-generated.go"]; ok {
+			if pkg, _ := parseGo(t, "rle-generated.go", decoder); pkg != test.pkg {
+				t.Errorf("%v: expected the decoder in package %s, got %s", test.args, test.pkg, pkg)
+			}
+		}
+	}
+
+	// inputs with names outside ASCII get variables of their own
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"ゴーファー.png", "gopher.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), png, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if code, _, errOut := runCLI(t, "-outmode", "rice", "-ratio", "profile", filepath.Join(dir, "*.png")); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	declared := map[string]bool{}
+	for _, name := range []string{"ゴーファー-profile-generated.go", "gopher-profile-generated.go"} {
+		src, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, names := parseGo(t, name, string(src))
+		if declared[names[0]] {
+			t.Errorf("expected a variable of its own in %s, got %s again", name, names[0])
+		}
+		declared[names[0]] = true
+	}
+
+	for _, args := range [][]string{
+		{"-var", "type"},
+		{"-pkg", "func"},
+		{"-pkg", "assets", "-outmode", "bin"},
+	} {
+		args = append([]string{"-outmode", "rice", "-ratio", "profile"}, args...)
+		if code, _, errOut := runCLI(t, append(args, "testdata/tainigo_128.png")...); code != 2 || !strings.Contains(errOut, "error: -") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+}
+
+// runGoModule writes files into a new module named example.com/badge and
+// runs its main package, returning what it printed. It is skipped in short
+// mode, and without a go command.
+func runGoModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping building a module in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	dir := t.TempDir()
+	if _, ok := files["go.mod"]; !ok {
+		files["go.mod"] = "module example.com/badge\n\ngo 1.22\n"
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmd := exec.Command(gobin, "run", ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GOFLAGS=-mod=mod", "GOPROXY=off", "GOTOOLCHAIN=local")
+	out, err := cmd.Output()
+	if err != nil {
+		var stderr []byte
+		if exit, ok := err.(*exec.ExitError); ok {
+			stderr = exit.Stderr
+		}
+		t.Fatalf("%v\n%s", err, stderr)
+	}
+	return string(out)
+}
+
+func TestRiceIsGofmtClean(t *testing.T) {
+	gofmt, err := exec.LookPath("gofmt")
+	if err != nil {
+		t.Skip("gofmt not found")
+	}
+	dir := t.TempDir()
+	for i, args := range [][]string{
+		{"-outmode", "rice", "-ratio", "16x8"},
+		{"-outmode", "rice", "-ratio", "profile", "-compress", "rle"},
+		{"-outmode", "rice", "-ratio", "profile", "-checksum", "sidecar"},
+		{"-outmode", "rice", "-ratio", "32x32", "-gofmt", "image"},
+		{"-outmode", "rice", "-ratio", "profile", "-colors", "acep"},
+	} {
+		for name, content := range generateIn(t, "gopherbadgeimg", args...) {
+			if !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d-%s", i, name)), []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	out, err := exec.Command(gofmt, "-l", dir).CombinedOutput()
+	if err != nil || len(out) > 0 {
+		t.Errorf("expected rice mode files to be gofmt clean, gofmt -l lists:\n%s%v", out, err)
+	}
+}
+
+func TestExport(t *testing.T) {
+	files := generateIn(t, "gopherbadgeimg", "-outmode", "rice", "-ratio", "profile", "-pkg", "assets", "-export")
+	src := files["profile-generated.go"]
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(formatted) != src {
+		t.Errorf("expected the file to be gofmt clean, got\n%s", src)
+	}
+	out := runGoModule(t, map[string]string{
+		"assets/profile-generated.go": src,
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/badge/assets"
+)
+
+func main() {
+	data, x, y := assets.ProfileImage()
+	fmt.Println(len(data), x, y, assets.ProfileLen == len(data), assets.ProfileLayout, assets.ProfileBitOrder)
+}
+`,
+	})
+	if want := "1920 120 128 true badger msb-first\n"; out != want {
+		t.Errorf("expected %q, got %q", want, out)
+	}
+
+	// without -export the constants are named after the variable too, and
+	// animations give the length of each frame
+	for _, test := range []struct {
+		args []string
+		file string
+		main string
+		want string
+	}{
+		{[]string{"-var", "logo"}, "profile-generated.go", "fmt.Println(logoWidth, logoHeight, logoLen == len(logo), logoLayout, logoBitOrder)", "120 128 true badger msb-first\n"},
+		{[]string{"-colors", "acep"}, "profile-generated.go", "fmt.Println(rprofileWidth, rprofileHeight, rprofileLen == len(rprofile), rprofileLayout)", "120 128 true row-msb\n"},
+		{[]string{"-grid", "2x1"}, "profile-generated.go", "fmt.Println(rprofileWidth, rprofileHeight, rprofileLen == len(rprofile[1]), len(rprofile))", "60 128 true 2\n"},
+	} {
+		files := generateIn(t, "gopherbadgeimg", append([]string{"-outmode", "rice", "-ratio", "profile"}, test.args...)...)
+		out := runGoModule(t, map[string]string{
+			test.file: files[test.file],
+			"main.go": "package main\n\nimport \"fmt\"\n\nfunc main() {\n\t" + test.main + "\n}\n",
+		})
+		if out != test.want {
+			t.Errorf("%v: expected %q, got %q", test.args, test.want, out)
+		}
+	}
+
+	for in, want := range map[string]string{
+		"profile":       "Profile",
+		"alice-profile": "AliceProfile",
+		"16x16":         "Img16x16",
+		"ゴーファー":         "Imgゴーファー",
+		"école":         "École",
+		"---":           "",
+	} {
+		if got := exportedName(in); got != want {
+			t.Errorf("%q: expected %q, got %q", in, want, got)
+		}
+	}
+}
+
+func TestLayoutName(t *testing.T) {
+	tricolor, err := ParsePalette("black,white,red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	planar := *tricolor
+	planar.Planes = "interleave"
+	for _, test := range []struct {
+		palette *Palette
+		layout  badgeimg.Layout
+		want    string
+	}{
+		{MonoPalette, badgeimg.LayoutBadger, "badger"},
+		{MonoPalette, badgeimg.LayoutSSD1306, "ssd1306"},
+		{tricolor, badgeimg.LayoutBadger, "badger"},
+		{ACePPalette, badgeimg.LayoutBadger, "row-msb"},
+		{&planar, badgeimg.LayoutBadger, "planes-interleave"},
+	} {
+		opts := NewOptions()
+		opts.Palette, opts.Layout = test.palette, test.layout
+		if got := opts.layoutName(); got != test.want || !slices.Contains(layouts, got) {
+			t.Errorf("%s/%v: expected %s, one of the layouts -list-formats lists, got %s", test.palette.Name, test.layout, test.want, got)
+		}
+	}
+	// headers and slideshows name the layouts they record the same way
+	if got := packingLayout(false).String(); got != "badger" {
+		t.Errorf("expected the badge's layout to be badger, got %s", got)
+	}
+}
@@ -3,6 +3,17 @@ module github.com/conejoninja/badger2040/cmd/gopherbadgeimg
 go 1.22.5
 
 require (
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/makeworld-the-better-one/dither v1.0.0
+	github.com/srwiley/oksvg v0.0.0-20221011165216-be6e8873101c
+	github.com/srwiley/rasterx v0.0.0-20210519020934-456a8d69b780
 	golang.org/x/image v0.18.0
+	golang.org/x/sys v0.21.0
+	golang.org/x/term v0.21.0
+	rsc.io/qr v0.2.0
+)
+
+require (
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
 )
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// -go-data string and -go-data base64 write the data of rice mode files as a
+// NameData string constant instead of byte literals, which take 6 characters
+// a byte and make large packages slow to load in editors. The variable is
+// still a []byte (a [][]byte for animations and sheets), built from the
+// constant when the package is initialized, so nothing changes for code using
+// it:
+//
+//	const splashData = "" +
+//		"\x00\x00\xff\xff..." +
+//		...
+//
+//	var splash = []byte(splashData)
+//
+// string escapes the bytes that aren't printable ASCII, taking 4 characters
+// for those and 1 for the others; base64 takes 4 for every 3 bytes, and
+// decodes the constant with encoding/base64 at init.
+
+// goData reports whether -go-data asks for a string constant
+func (o *Options) goData() bool {
+	return o.GoData != "" && o.GoData != goDataEncodings[0]
+}
+
+// goDataEncodings are the ways -go-data writes the data of rice mode files,
+// the first one being the default
+var goDataEncodings = []string{"bytes", "string", "base64"}
+
+const (
+	// goStringLine is how many bytes of data each line of a string
+	// constant holds
+	goStringLine = 32
+	// goBase64Line is how many base64 characters each line of a base64
+	// constant holds, as in MIME
+	goBase64Line = 76
+)
+
+// fprintGoData writes a Go file like FprintGo, or FprintFramesGo when
+// animated, declaring name from a string constant encoded as -go-data string
+// or base64 says. Like them, it is written with a single Write.
+func fprintGoData(w io.Writer, header, pkg, name string, frames [][]byte, delays []int, animated bool, encoding string) error {
+	var data []byte
+	for _, frame := range frames {
+		data = append(data, frame...)
+	}
+	buf := fmt.Appendf(nil, "%spackage %s\n\n// %sData is %s as a %s constant, which is smaller in the source than\n// byte literals\nconst %sData = \"\" +",
+		header, pkg, name, name, encoding, name)
+	if encoding == "base64" {
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for i := 0; i < len(encoded); i += goBase64Line {
+			if i > 0 {
+				buf = append(buf, " +"...)
+			}
+			buf = append(buf, "\n\t\""...)
+			buf = append(buf, encoded[i:min(i+goBase64Line, len(encoded))]...)
+			buf = append(buf, '"')
+		}
+	} else {
+		for i := 0; i < len(data); i += goStringLine {
+			if i > 0 {
+				buf = append(buf, " +"...)
+			}
+			buf = append(buf, "\n\t"...)
+			buf = appendGoString(buf, data[i:min(i+goStringLine, len(data))])
+		}
+	}
+	buf = append(buf, "\n\n"...)
+
+	// the bytes of the constant, as an expression or the statements of a
+	// function setting data
+	decode := fmt.Sprintf("data, err := base64.StdEncoding.DecodeString(%sData)\n\tif err != nil {\n\t\tpanic(err)\n\t}\n", name)
+	switch {
+	case !animated && encoding == "base64":
+		buf = fmt.Appendf(buf, "var %s = func() []byte {\n\t%s\treturn data\n}()\n", name, decode)
+	case !animated:
+		buf = fmt.Appendf(buf, "var %s = []byte(%sData)\n", name, name)
+	default:
+		if encoding != "base64" {
+			decode = fmt.Sprintf("data := []byte(%sData)\n", name)
+		}
+		// the frames are slices of the data, capped so that appending to
+		// one doesn't overwrite the next
+		buf = fmt.Appendf(buf, "var %s = func() [][]byte {\n\t%s\tframes := make([][]byte, 0, %d)\n\tfor _, n := range []int{", name, decode, len(frames))
+		for i, frame := range frames {
+			if i > 0 {
+				buf = append(buf, ", "...)
+			}
+			buf = strconv.AppendInt(buf, int64(len(frame)), 10)
+		}
+		buf = append(buf, "} {\n\t\tframes = append(frames, data[:n:n])\n\t\tdata = data[n:]\n\t}\n\treturn frames\n}()\n"...)
+	}
+	if delays != nil {
+		buf = fmt.Appendf(buf, "\n// %sDelays holds how long each frame is shown, in milliseconds\nvar %sDelays = []int{", name, name)
+		for i, d := range delays {
+			if i > 0 {
+				buf = append(buf, ", "...)
+			}
+			buf = strconv.AppendInt(buf, int64(d), 10)
+		}
+		buf = append(buf, "}\n"...)
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+// appendGoString appends data to buf as an interpreted string literal:
+// printable ASCII as is, but for the quote and the backslash, and any other
+// byte, NUL included, as a \x escape
+func appendGoString(buf, data []byte) []byte {
+	const digits = "0123456789abcdef"
+	buf = append(buf, '"')
+	for _, b := range data {
+		switch {
+		case b == '"' || b == '\\':
+			buf = append(buf, '\\', b)
+		case b >= 0x20 && b < 0x7f:
+			buf = append(buf, b)
+		default:
+			buf = append(buf, '\\', 'x', digits[b>>4], digits[b&0xf])
+		}
+	}
+	return append(buf, '"')
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"go/format"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAppendGoString(t *testing.T) {
+	var data []byte
+	for b := range 256 {
+		data = append(data, byte(b))
+	}
+	literal := appendGoString(nil, data)
+	got, err := strconv.Unquote(string(literal))
+	if err != nil {
+		t.Fatalf("%s: %v", literal, err)
+	}
+	if got != string(data) {
+		t.Errorf("expected every byte back, got %q", got)
+	}
+	if want := `"\x00\x1f !\"#\\]~\x7f\xff"`; string(appendGoString(nil, []byte("\x00\x1f !\"#\\]~\x7f\xff"))) != want {
+		t.Errorf("expected %s, got %s", want, appendGoString(nil, []byte("\x00\x1f !\"#\\]~\x7f\xff")))
+	}
+}
+
+func TestGoData(t *testing.T) {
+	// every byte, NUL and backquotes included, compiles back to itself
+	var data []byte
+	for b := range 256 * 3 {
+		data = append(data, byte(b*7))
+	}
+	files := map[string]string{
+		"main.go": "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Printf(\"%x\\n%x\\n%x\\n\", escaped, encoded[0], encoded[1])\n}\n",
+	}
+	for name, encoding := range map[string]string{"escaped": "string", "encoded": "base64"} {
+		var buf bytes.Buffer
+		frames := [][]byte{data}
+		if encoding == "base64" {
+			frames = [][]byte{data[:100], data[100:]}
+		}
+		if err := fprintGoData(&buf, "", "main", name, frames, nil, encoding == "base64", encoding); err != nil {
+			t.Fatal(err)
+		}
+		src := buf.String()
+		if encoding == "base64" {
+			src = string(insertGoImports(buf.Bytes(), []string{"encoding/base64"}))
+		}
+		if formatted, err := format.Source([]byte(src)); err != nil || string(formatted) != src {
+			t.Errorf("%s: expected the file to be gofmt clean, got %v and\n%s", encoding, err, src)
+		}
+		files[name+".go"] = src
+	}
+	want := hex.EncodeToString(data) + "\n" + hex.EncodeToString(data[:100]) + "\n" + hex.EncodeToString(data[100:]) + "\n"
+	if got := runGoModule(t, files); got != want {
+		t.Errorf("expected the bytes of the data, got\n%s", got)
+	}
+
+	// the variable holds what the bin files do, in much less source
+	bin := generateIn(t, "gopherbadgeimg", "-outmode", "rice,bin", "-ratio", "splash")
+	sheet := generateIn(t, "gopherbadgeimg", "-outmode", "rice,bin", "-ratio", "splash", "-grid", "2x1")
+	image := hex.EncodeToString([]byte(bin["splash.bin"]))
+	cells := hex.EncodeToString([]byte(sheet["splash-000.bin"])) + "\n" + hex.EncodeToString([]byte(sheet["splash-001.bin"]))
+	for _, test := range []struct {
+		encoding string
+		args     []string
+		main     string
+		want     string
+		size     float64
+	}{
+		{"string", nil, `fmt.Printf("%x\n", rsplash)`, image, 0.75},
+		{"base64", nil, `fmt.Printf("%x\n", rsplash)`, image, 0.3},
+		{"string", []string{"-grid", "2x1", "-compress", "rle"}, `size := rsplashWidth * rsplashHeight / 8
+	fmt.Printf("%x\n%x\n", DecodeRLE(make([]byte, size), rsplash[0]), DecodeRLE(make([]byte, size), rsplash[1]))`, cells, 0},
+		{"base64", []string{"-grid", "2x1", "-export"}, `fmt.Printf("%x\n%x\n", Splash[0], Splash[1])`, cells, 0.3},
+	} {
+		args := append([]string{"-outmode", "rice", "-ratio", "splash", "-go-data", test.encoding}, test.args...)
+		files := generateIn(t, "gopherbadgeimg", args...)
+		delete(files, "gopher.png")
+		files["main.go"] = "package main\n\nimport \"fmt\"\n\nfunc main() {\n\t" + test.main + "\n}\n"
+		if got := runGoModule(t, files); got != test.want+"\n" {
+			t.Errorf("%v: expected the bytes of the bin files, got\n%s", args, got)
+		}
+		if test.size == 0 {
+			continue
+		}
+		src, literals := files["splash-generated.go"], bin["splash-generated.go"]
+		if test.encoding == "base64" && len(test.args) > 0 {
+			literals = sheet["splash-generated.go"]
+		}
+		if ratio := float64(len(src)) / float64(len(literals)); ratio > test.size {
+			t.Errorf("%v: expected the file to be at most %.0f%% the size of byte literals, got %d bytes to %d", args, test.size*100, len(src), len(literals))
+		}
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-go-data", "hex"}, "invalid -go-data `hex`"},
+		{[]string{"-go-data", "string", "-outmode", "bin"}, "can only be used with -outmode rice"},
+		{[]string{"-go-data", "base64", "-bundle", "assets.go"}, "can't be used with -bundle"},
+	} {
+		args := append([]string{"-outmode", "rice", "-ratio", "32x32"}, test.args...)
+		if code, _, errOut := runCLI(t, append(args, "testdata/tainigo_128.png")...); code != exitUsage || !strings.Contains(errOut, test.want) {
+			t.Errorf("%v: expected exit code 2 and %q, got %d and\n%s", test.args, test.want, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// runtimeImport is the package -import-runtime has generated files unpack
+// their images with, instead of an unpackGray of their own
+const runtimeImport = "github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+
+// grayUnpackerSource is badgeimg.BytesToImg as written into generated Go
+// files by -gofmt image, for the badge's layout only since the other palettes
+// aren't black and white
+const grayUnpackerSource = `// unpackGray unpacks an x by y image packed by gopherbadgeimg, column by
+// column, into a gray image: set bits are black and clear bits white.
+func unpackGray(x, y int, bits []byte) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, x, y))
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			offset := i*y + j
+			if bits[offset/8]&(1<<uint(7-offset%8)) == 0 {
+				img.Pix[j*img.Stride+i] = 0xff
+			}
+		}
+	}
+	return img
+}
+`
+
+// goImports returns the packages rice mode files import: none, unless
+// -gofmt image has them unpack their images or -go-data base64 decode their
+// data
+func (o *Options) goImports() []string {
+	var imports []string
+	if o.GoData == "base64" {
+		imports = append(imports, "encoding/base64")
+	}
+	if o.GoFormat != "image" {
+		return imports
+	}
+	imports = append(imports, "image", "sync")
+	if o.ImportRuntime {
+		imports = append(imports, "", runtimeImport)
+	}
+	return imports
+}
+
+// insertGoImports inserts the import declaration of imports after the package
+// clause of src, an empty import separating the standard library from the
+// other packages as goimports would
+func insertGoImports(src []byte, imports []string) []byte {
+	if len(imports) == 0 {
+		return src
+	}
+	var decl strings.Builder
+	decl.WriteString("import (\n")
+	for _, path := range imports {
+		if path == "" {
+			decl.WriteString("\n")
+			continue
+		}
+		fmt.Fprintf(&decl, "\t%q\n", path)
+	}
+	decl.WriteString(")\n\n")
+	// the package clause is the first line that isn't a comment, and is
+	// followed by an empty line
+	at := 0
+	if !bytes.HasPrefix(src, []byte("package ")) {
+		at = bytes.Index(src, []byte("\npackage ")) + 1
+	}
+	at += bytes.Index(src[at:], []byte("\n\n")) + 2
+	return append(src[:at:at], append([]byte(decl.String()), src[at:]...)...)
+}
+
+// fprintGoGray writes the NameGray constructor of -gofmt image, returning the
+// variable name unpacked into an *image.Gray, or frame i of it for
+// animations and sheets. The variable is unpacked the first time only.
+func (o *Options) fprintGoGray(w io.Writer, name string, animated bool) error {
+	fn := name + "Gray"
+	// unpack is the statement setting img from the packed data
+	unpack := func(indent, data string) string {
+		if o.Compress == "rle" {
+			size := fmt.Sprintf("%sWidth*%sHeight/8", name, name)
+			if o.Layout != badgeimg.LayoutBadger {
+				size = fmt.Sprintf("%#v.BufferLen(%sWidth, %sHeight)", o.Layout, name, name)
+			}
+			data = fmt.Sprintf("DecodeRLE(make([]byte, %s), %s)", size, data)
+		}
+		if o.ImportRuntime {
+			return fmt.Sprintf("img, err := badgeimg.BytesToImg(%sWidth, %sHeight, %s, %#v)\n%sif err != nil {\n%s\tpanic(err)\n%s}\n",
+				name, name, data, o.Layout, indent, indent, indent)
+		}
+		return fmt.Sprintf("img := unpackGray(%sWidth, %sHeight, %s)\n", name, name, data)
+	}
+	var b strings.Builder
+	if animated {
+		fmt.Fprintf(&b, "\n// %s returns frame i of %s unpacked into a gray image, black where\n// its pixels are set. The frames are unpacked on the first call only.\n", fn, name)
+		fmt.Fprintf(&b, "func %s(i int) *image.Gray {\n\t%sOnce.Do(func() {\n\t\t%sImgs = make([]*image.Gray, len(%s))\n", fn, fn, fn, name)
+		fmt.Fprintf(&b, "\t\tfor i, frame := range %s {\n\t\t\t%s\t\t\t%sImgs[i] = img\n\t\t}\n\t})\n\treturn %sImgs[i]\n}\n", name, unpack("\t\t\t", "frame"), fn, fn)
+		fmt.Fprintf(&b, "\nvar (\n\t%sOnce sync.Once\n\t%sImgs []*image.Gray\n)\n", fn, fn)
+	} else {
+		fmt.Fprintf(&b, "\n// %s returns %s unpacked into a gray image, black where its pixels\n// are set. It is unpacked on the first call only.\n", fn, name)
+		fmt.Fprintf(&b, "func %s() *image.Gray {\n\t%sOnce.Do(func() {\n\t\t%s\t\t%sImg = img\n\t})\n\treturn %sImg\n}\n", fn, fn, unpack("\t\t", name), fn, fn)
+		fmt.Fprintf(&b, "\nvar (\n\t%sOnce sync.Once\n\t%sImg  *image.Gray\n)\n", fn, fn)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// grayUnpackerMu keeps concurrent workers from writing the same unpacker file
+var grayUnpackerMu sync.Mutex
+
+// writeGrayUnpacker writes unpackGray to gray-generated.go next to output,
+// and returns its path. Like DecodeRLE, every generated file of a package
+// would otherwise declare it.
+func (o *Options) writeGrayUnpacker(output string) (string, error) {
+	grayUnpackerMu.Lock()
+	defer grayUnpackerMu.Unlock()
+	path := filepath.Join(filepath.Dir(output), "gray-generated.go")
+	return path, o.writeFile(path, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%spackage %s\n\nimport \"image\"\n\n%s", o.generatedHeader("//", "//go:generate ", filepath.Dir(path)), o.goPackage(), grayUnpackerSource)
+		return err
+	})
+}
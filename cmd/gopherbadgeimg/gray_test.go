@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// grayMain is the main package of TestGoGray, printing the images returned by
+// the constructor calls filling in %s as grayPixels does
+const grayMain = `package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+)
+
+func main() {
+	var b strings.Builder
+	for _, img := range []*image.Gray{%s} {
+		r := img.Bounds()
+		fmt.Fprintln(&b, r.Dx(), r.Dy())
+		for y := r.Min.Y; y < r.Max.Y; y++ {
+			for x := r.Min.X; x < r.Max.X; x++ {
+				if img.GrayAt(x, y).Y == 0 {
+					b.WriteByte('#')
+				} else {
+					b.WriteByte('.')
+				}
+			}
+			b.WriteByte('\n')
+		}
+	}
+	fmt.Print(b.String())
+}
+`
+
+// grayPixels prints the size of img, then its pixels one to a character: #
+// for black and . for white
+func grayPixels(img *image.Gray) string {
+	var b strings.Builder
+	r := img.Bounds()
+	fmt.Fprintln(&b, r.Dx(), r.Dy())
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if img.GrayAt(x, y).Y == 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// unpackedBins unpacks the bin files of a conversion to x by y, printing them
+// as grayPixels does
+func unpackedBins(t *testing.T, files map[string]string, x, y int, names ...string) string {
+	t.Helper()
+	var b strings.Builder
+	for _, name := range names {
+		img, err := badgeimg.BytesToImg(x, y, []byte(files[name]), badgeimg.LayoutBadger)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		b.WriteString(grayPixels(img))
+	}
+	return b.String()
+}
+
+func TestGoGray(t *testing.T) {
+	image := unpackedBins(t, generateIn(t, "gopherbadgeimg", "-outmode", "bin", "-ratio", "32x32"), 32, 32, "32x32.bin")
+	cells := unpackedBins(t, generateIn(t, "gopherbadgeimg", "-outmode", "bin", "-ratio", "32x32", "-grid", "2x1"), 16, 32, "32x32-000.bin", "32x32-001.bin")
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		args  []string
+		calls string
+		want  string
+	}{
+		{nil, "r32x32Gray()", image},
+		{[]string{"-compress", "rle"}, "r32x32Gray(), r32x32Gray()", image + image},
+		{[]string{"-var", "logo", "-export"}, "LogoGray()", image},
+		{[]string{"-grid", "2x1"}, "r32x32Gray(1), r32x32Gray(0)", cells[len(cells)/2:] + cells[:len(cells)/2]},
+		{[]string{"-import-runtime", "-compress", "rle", "-grid", "2x1"}, "r32x32Gray(0), r32x32Gray(1)", cells},
+	} {
+		files := generateIn(t, "gopherbadgeimg", append([]string{"-outmode", "rice", "-ratio", "32x32", "-gofmt", "image"}, test.args...)...)
+		_, unpacker := files["gray-generated.go"]
+		if runtime := strings.Contains(strings.Join(test.args, " "), "-import-runtime"); unpacker == runtime {
+			t.Errorf("%v: expected gray-generated.go to be written only without -import-runtime", test.args)
+		}
+		delete(files, "gopher.png")
+		files["main.go"] = fmt.Sprintf(grayMain, test.calls)
+		if strings.Contains(files["32x32-generated.go"], runtimeImport) {
+			files["go.mod"] = fmt.Sprintf("module example.com/badge\n\ngo 1.22\n\nrequire github.com/conejoninja/badger2040/cmd/gopherbadgeimg v0.0.0\n\nreplace github.com/conejoninja/badger2040/cmd/gopherbadgeimg => %s\n", wd)
+		}
+		if got := runGoModule(t, files); got != test.want {
+			t.Errorf("%v: expected the pixels of the conversion\n%s\ngot\n%s", test.args, test.want, got)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-gofmt", "png"},
+		{"-gofmt", "image", "-outmode", "bin"},
+		{"-gofmt", "image", "-colors", "acep"},
+		{"-import-runtime"},
+	} {
+		args = append([]string{"-outmode", "rice", "-ratio", "32x32"}, args...)
+		if code, _, errOut := runCLI(t, append(args, "testdata/tainigo_128.png")...); code != exitUsage || !strings.Contains(errOut, "error: ") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+}
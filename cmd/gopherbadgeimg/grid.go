@@ -0,0 +1,86 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strconv"
+	"strings"
+)
+
+// A sprite sheet is sliced by -grid or -tile once it has been scaled to
+// -ratio, and each cell is then converted on its own, as if it were a frame of
+// an animation: bin mode writes them to numbered files, rice mode to a slice,
+// both row by row. Cells that can't be packed as they are, such as 12 pixels
+// high ones on the badge, are padded at the bottom (or right, for row-major
+// panels) with blank pixels.
+
+// parseCells parses the COLSxROWS of -grid, or the WxH of -tile, given to
+// flag
+func parseCells(flag, s string) (int, int, error) {
+	a, b, _ := strings.Cut(strings.ToLower(s), "x")
+	n, err := strconv.Atoi(a)
+	if err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("error: invalid %s `%s`, expected two numbers such as 8x8", flag, s)
+	}
+	m, err := strconv.Atoi(b)
+	if err != nil || m <= 0 {
+		return 0, 0, fmt.Errorf("error: invalid %s `%s`, expected two numbers such as 8x8", flag, s)
+	}
+	return n, m, nil
+}
+
+// sheetCells returns how -grid or -tile slice a sheet of x by y pixels: the
+// number of columns and rows, and the size of a cell. A sheet that doesn't
+// divide evenly is an error, rather than leaving partial cells.
+func (o *Options) sheetCells(x, y int) (cols, rows, w, h int, err error) {
+	if o.Tile != "" {
+		if w, h, err = parseCells("-tile", o.Tile); err != nil {
+			return 0, 0, 0, 0, err
+		}
+		if x%w != 0 || y%h != 0 {
+			return 0, 0, 0, 0, fmt.Errorf("error: a %dx%d sheet doesn't divide into %dx%d tiles, the last ones would only be %dx%d: use a -ratio that is a multiple of the tile size, such as %dx%d",
+				x, y, w, h, cmp.Or(x%w, w), cmp.Or(y%h, h), max(1, x/w)*w, max(1, y/h)*h)
+		}
+		return x / w, y / h, w, h, nil
+	}
+	if cols, rows, err = parseCells("-grid", o.Grid); err != nil {
+		return 0, 0, 0, 0, err
+	}
+	if x%cols != 0 || y%rows != 0 {
+		return 0, 0, 0, 0, fmt.Errorf("error: a %dx%d sheet doesn't divide into %d columns and %d rows: use a -ratio that is a multiple of the grid, such as %dx%d",
+			x, y, cols, rows, max(1, x/cols)*cols, max(1, y/rows)*rows)
+	}
+	return cols, rows, x / cols, y / rows, nil
+}
+
+// sliceSheet scales src to x by y and converts it cell by cell, as set by
+// -grid or -tile. It returns the data of each cell, row by row, and the size
+// they were packed at once padded.
+func (o *Options) sliceSheet(src image.Image, x, y int) ([][]byte, int, int, error) {
+	cols, rows, w, h, err := o.sheetCells(x, y)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	sheet := o.scale(src, x, y)
+
+	// padding must come out blank, which it is before -invert if it is black
+	var blank color.Color = color.White
+	if o.Invert {
+		blank = color.Black
+	}
+	pw, ph := o.Palette.Pad(w, h)
+	cells := make([][]byte, 0, cols*rows)
+	for row := range rows {
+		for col := range cols {
+			cell := image.NewRGBA(image.Rect(0, 0, pw, ph))
+			draw.Draw(cell, cell.Rect, image.NewUniform(blank), image.Point{}, draw.Src)
+			draw.Draw(cell, image.Rect(0, 0, w, h), sheet, image.Pt(col*w, row*h), draw.Src)
+			var img image.Image = cell
+			cells = append(cells, o.ImgToBytes(pw, ph, &img))
+		}
+	}
+	return cells, pw, ph, nil
+}
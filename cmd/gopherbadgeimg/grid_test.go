@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCheckerboard writes a PNG of size x by y to path, made of cols by rows
+// cells which are black when their column and row add up to an even number,
+// and white otherwise
+func writeCheckerboard(t *testing.T, path string, x, y, cols, rows int) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, x, y))
+	for py := range y {
+		for px := range x {
+			if (px*cols/x+py*rows/y)%2 != 0 {
+				img.SetGray(px, py, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGrid(t *testing.T) {
+	dir := t.TempDir()
+	sheet := filepath.Join(dir, "sheet.png")
+	// 4 columns by 2 rows, so that cells in column-major order would differ
+	writeCheckerboard(t, sheet, 32, 32, 4, 2)
+
+	for _, slice := range [][]string{{"-grid", "4x2"}, {"-tile", "8x16"}} {
+		out := filepath.Join(dir, slice[0][1:]+".bin")
+		args := append([]string{"-outmode", "bin", "-ratio", "32x32", "-o", out}, slice...)
+		if code, _, errOut := runCLI(t, append(args, sheet)...); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d and\n%s", slice, code, errOut)
+		}
+		for i := range 8 {
+			cell, err := os.ReadFile(framePath(out, i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 8 columns of 16 pixels, all set in black cells
+			want := bytes.Repeat([]byte{0x00}, 16)
+			if (i%4+i/4)%2 == 0 {
+				want = bytes.Repeat([]byte{0xff}, 16)
+			}
+			if !bytes.Equal(cell, want) {
+				t.Errorf("%v: expected cell %d to be % x, got % x", slice, i, want, cell)
+			}
+		}
+		if _, err := os.Stat(framePath(out, 8)); err == nil {
+			t.Errorf("%v: expected 8 cells only", slice)
+		}
+	}
+
+	// 12 pixels high cells are padded to 16 with blank pixels
+	writeCheckerboard(t, sheet, 24, 24, 1, 1)
+	out := filepath.Join(dir, "padded.bin")
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "24x24", "-grid", "2x2", "-o", out, sheet); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	for i := range 4 {
+		cell, err := os.ReadFile(framePath(out, i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := bytes.Repeat([]byte{0xff, 0xf0}, 12); !bytes.Equal(cell, want) {
+			t.Errorf("expected padded cell %d to be % x, got % x", i, want, cell)
+		}
+	}
+
+	for _, args := range [][]string{
+		{"-ratio", "32x32", "-tile", "12x12"},
+		{"-ratio", "32x32", "-grid", "3x3"},
+		{"-ratio", "32x32", "-grid", "4"},
+		{"-ratio", "32x32", "-grid", "4x4", "-tile", "8x8"},
+	} {
+		code, _, errOut := runCLI(t, append(append([]string{"-outmode", "bin"}, args...), sheet)...)
+		if code != 2 || !strings.Contains(errOut, "error: ") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+	if _, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "32x32", "-tile", "12x12", sheet); !strings.Contains(errOut, "such as 24x24") {
+		t.Errorf("expected a ratio the tiles fit to be suggested, got\n%s", errOut)
+	}
+}
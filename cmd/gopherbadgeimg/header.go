@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// The header written by -header in front of bin mode data, so that a bin file
+// tells what it holds. It is 16 bytes, little-endian:
+//
+//	offset  size  field
+//	0       4     magic "GBIM"
+//	4       1     version, 1
+//	5       1     depth: bits per pixel
+//	6       1     layout: 0 badger (column-major), 1 row-msb (row-major)
+//	7       1     flags: 0x01 RLE compressed (see rle.go),
+//	              0x02 frames concatenated by -animation concat,
+//	              0x04 CRC32 appended (see checksum.go),
+//	              0x08 bit planes concatenated by -planes concat,
+//	              0x10 bit planes interleaved by -planes interleave
+//	8       2     width in pixels
+//	10      2     height in pixels
+//	12      4     length of the data that follows the header, in bytes,
+//	              not counting the CRC32
+const (
+	headerSize    = 16
+	headerVersion = 1
+
+	headerLayoutColumnMajor = 0
+	headerLayoutRowMajor    = 1
+
+	headerFlagRLE    = 0x01
+	headerFlagConcat = 0x02
+	headerFlagCRC    = 0x04
+
+	headerFlagPlanesConcat     = 0x08
+	headerFlagPlanesInterleave = 0x10
+)
+
+// headerMagic starts every header
+var headerMagic = [4]byte{'G', 'B', 'I', 'M'}
+
+var (
+	errNoHeader     = errors.New("no gopherbadgeimg header (it was written without -header, or isn't a bin file)")
+	errHeaderLength = errors.New("the length in the header doesn't match the size of the file")
+)
+
+// Header describes the data of a bin file written with -header
+type Header struct {
+	Version  uint8
+	Depth    uint8
+	RowMajor bool
+	// RLE is set when the data is compressed with -compress rle
+	RLE bool
+	// Concat is set when the data holds several frames joined by
+	// ConcatFrames
+	Concat bool
+	// CRC is set when the CRC32 of the header and data follows the data
+	CRC bool
+	// Planes is concat or interleave when every frame holds the bit planes
+	// of the image arranged so by -planes (see planes.go)
+	Planes string
+	Width  uint16
+	Height uint16
+	// Length is the size of the data following the header
+	Length uint32
+}
+
+// EncodeHeader returns h as the 16 bytes written in front of the data
+func EncodeHeader(h Header) []byte {
+	buf := make([]byte, headerSize)
+	copy(buf, headerMagic[:])
+	buf[4] = h.Version
+	buf[5] = h.Depth
+	if h.RowMajor {
+		buf[6] = headerLayoutRowMajor
+	}
+	if h.RLE {
+		buf[7] |= headerFlagRLE
+	}
+	if h.Concat {
+		buf[7] |= headerFlagConcat
+	}
+	if h.CRC {
+		buf[7] |= headerFlagCRC
+	}
+	switch h.Planes {
+	case "concat":
+		buf[7] |= headerFlagPlanesConcat
+	case "interleave":
+		buf[7] |= headerFlagPlanesInterleave
+	}
+	binary.LittleEndian.PutUint16(buf[8:], h.Width)
+	binary.LittleEndian.PutUint16(buf[10:], h.Height)
+	binary.LittleEndian.PutUint32(buf[12:], h.Length)
+	return buf
+}
+
+// DecodeHeader reads the header at the start of a bin file, and returns it
+// along with the data that follows, after checking its CRC32 if it has one
+func DecodeHeader(data []byte) (Header, []byte, error) {
+	if len(data) < headerSize || [4]byte(data[:4]) != headerMagic {
+		return Header{}, nil, errNoHeader
+	}
+	h := Header{
+		Version:  data[4],
+		Depth:    data[5],
+		RowMajor: data[6] == headerLayoutRowMajor,
+		RLE:      data[7]&headerFlagRLE != 0,
+		Concat:   data[7]&headerFlagConcat != 0,
+		CRC:      data[7]&headerFlagCRC != 0,
+		Width:    binary.LittleEndian.Uint16(data[8:]),
+		Height:   binary.LittleEndian.Uint16(data[10:]),
+		Length:   binary.LittleEndian.Uint32(data[12:]),
+	}
+	if h.Version != headerVersion {
+		return h, nil, fmt.Errorf("unsupported header version %d", h.Version)
+	}
+	if data[6] > headerLayoutRowMajor {
+		return h, nil, fmt.Errorf("unknown layout %d in the header", data[6])
+	}
+	switch data[7] & (headerFlagPlanesConcat | headerFlagPlanesInterleave) {
+	case headerFlagPlanesConcat:
+		h.Planes = "concat"
+	case headerFlagPlanesInterleave:
+		h.Planes = "interleave"
+	case headerFlagPlanesConcat | headerFlagPlanesInterleave:
+		return h, nil, errors.New("the header says the bit planes are both concatenated and interleaved")
+	}
+	size := int64(h.Length)
+	if h.CRC {
+		size += 4
+	}
+	if size != int64(len(data)-headerSize) {
+		return h, nil, fmt.Errorf("%w: %d bytes of data, but %d in the file", errHeaderLength, size, len(data)-headerSize)
+	}
+	if h.CRC {
+		end := len(data) - 4
+		if crc32.ChecksumIEEE(data[:end]) != binary.LittleEndian.Uint32(data[end:]) {
+			return h, nil, errChecksum
+		}
+		return h, data[headerSize:end], nil
+	}
+	return h, data[headerSize:], nil
+}
+
+// withHeader prefixes bin mode data of an x by y image with its header when
+// -header is set
+func (o *Options) withHeader(x, y int, data []byte, concat bool) []byte {
+	if !o.Header {
+		return data
+	}
+	h := Header{
+		Version:  headerVersion,
+		Depth:    uint8(o.Palette.Depth),
+		RowMajor: o.Palette.RowMajor,
+		RLE:      o.Compress == "rle",
+		Concat:   concat,
+		CRC:      o.Checksum == "append",
+		Planes:   o.headerPlanes(),
+		Width:    uint16(x),
+		Height:   uint16(y),
+		Length:   uint32(len(data)),
+	}
+	return append(EncodeHeader(h), data...)
+}
+
+// headerPlanes returns the Planes of the header of bin files: the arrangement
+// of -planes, unless the planes are separate black and white images
+func (o *Options) headerPlanes() string {
+	if o.Palette.Planes == "separate" {
+		return ""
+	}
+	return o.Palette.Planes
+}
+
+// Inspect prints the header of the bin file or slideshow at path to w,
+// followed by the image itself when -show is set
+func (o *Options) Inspect(w io.Writer, path string) error {
+	data, err := ReadInput(path)
+	if err != nil {
+		return err
+	}
+	if s, err := DecodeSlideshow(data); err == nil {
+		return o.inspectSlideshow(w, path, s)
+	} else if !errors.Is(err, errNoSlideshow) {
+		return err
+	}
+	h, data, err := DecodeHeader(data)
+	if err != nil {
+		return err
+	}
+	layout, compression, checksum := packingLayout(h.RowMajor).String(), "none", "none"
+	if h.RLE {
+		compression = "rle"
+	}
+	if h.CRC {
+		checksum = "crc32, ok"
+	}
+	planes := "packed"
+	switch h.Planes {
+	case "concat":
+		planes = "concatenated"
+	case "interleave":
+		planes = "interleaved"
+	}
+	frames := 1
+	if h.Concat && len(data) >= 2 {
+		frames = int(binary.LittleEndian.Uint16(data))
+	}
+	fmt.Fprintf(w, "%s:\n  version: %d\n  size: %dx%d\n  depth: %d bit(s) per pixel\n  layout: %s\n  planes: %s\n  compression: %s\n  frames: %d\n  data: %d bytes\n  checksum: %s\n",
+		path, h.Version, h.Width, h.Height, h.Depth, layout, planes, compression, frames, h.Length, checksum)
+	if !o.Show {
+		return nil
+	}
+
+	if int(h.Depth) != o.Palette.Depth || h.RowMajor != o.Palette.RowMajor {
+		return fmt.Errorf("can't show a %d bit %s image with the %s palette, pick a matching one with -colors or -palette", h.Depth, layout, o.Palette.Name)
+	}
+	x, y := int(h.Width), int(h.Height)
+	packed, err := binFrames(data, x, y, x*y*int(h.Depth)/8, h.RLE, h.Concat)
+	if err != nil {
+		return err
+	}
+	if h.Planes != "" {
+		packed = joinFrames(x, y, o.Palette, h.Planes, packed)
+	}
+	for i, frame := range packed {
+		if len(packed) > 1 {
+			fmt.Fprintf(w, "frame %d:\n", i)
+		}
+		o.showImg(w, x, y, frame)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHeaderWrite(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Header = "bin", "profile", true
+	opts.Output = filepath.Join(dir, "profile.bin")
+	if converted, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 120, 128); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the image to convert, got %d converted and %d failed", converted, len(failed))
+	}
+	data, err := os.ReadFile(opts.Output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		'G', 'B', 'I', 'M', 1, 1, 0, 0,
+		120, 0, 128, 0,
+		0x80, 0x07, 0, 0, // 120*128/8 = 1920 = 0x0780
+	}
+	if !bytes.Equal(data[:headerSize], want) {
+		t.Errorf("expected header % x, got % x", want, data[:headerSize])
+	}
+
+	h, payload, err := DecodeHeader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Width != 120 || h.Height != 128 || h.Depth != 1 || h.RowMajor || h.RLE || h.Concat {
+		t.Errorf("unexpected header %+v", h)
+	}
+	// the header is all that's added: the rest is the usual output
+	img, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, opts.ImgToBytes(120, 128, img)) {
+		t.Error("expected the packed image after the header")
+	}
+}
+
+func TestHeaderInspect(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Header = "bin", "8x8", true
+	opts.DisableDithering, opts.Animation = true, "concat"
+	opts.Output = filepath.Join(dir, "anim.bin")
+	if converted, failed := opts.ConvertAll([]string{"testdata/restore-background.gif"}, 8, 8); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the animation to convert, got %d converted and %d failed", converted, len(failed))
+	}
+	frames, err := opts.LoadFrames("testdata/restore-background.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := opts.Inspect(&out, opts.Output); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"size: 8x8",
+		"depth: 1 bit(s) per pixel",
+		"layout: badger",
+		"compression: none",
+		fmt.Sprintf("frames: %d", len(frames)),
+	} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in\n%s", line, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "frame 0:") {
+		t.Error("expected no preview without -show")
+	}
+
+	// -show draws every frame from the header alone
+	opts.Show = true
+	out.Reset()
+	if err := opts.Inspect(&out, opts.Output); err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	for i, frame := range frames {
+		fmt.Fprintf(&want, "frame %d:\n", i)
+		opts.showImg(&want, 8, 8, opts.ImgToBytes(8, 8, &frame.Image))
+	}
+	if !strings.HasSuffix(out.String(), want.String()) {
+		t.Errorf("expected every frame to be drawn as\n%s\ngot\n%s", want.String(), out.String())
+	}
+}
+
+func TestHeaderInspectRLE(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Header, opts.Compress = "bin", "profile", true, "rle"
+	opts.Show = true
+	opts.Output = filepath.Join(dir, "profile.rle.bin")
+	if converted, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 120, 128); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the image to convert, got %d converted and %d failed", converted, len(failed))
+	}
+	var out bytes.Buffer
+	if err := opts.Inspect(&out, opts.Output); err != nil {
+		t.Fatal(err)
+	}
+	img, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var want bytes.Buffer
+	opts.showImg(&want, 120, 128, opts.ImgToBytes(120, 128, img))
+	if !strings.Contains(out.String(), "compression: rle") || !strings.HasSuffix(out.String(), want.String()) {
+		t.Errorf("expected the decompressed image to be drawn, got\n%s", out.String())
+	}
+}
+
+func TestDecodeHeaderErrors(t *testing.T) {
+	valid := append(EncodeHeader(Header{Version: headerVersion, Depth: 1, Width: 8, Height: 8, Length: 8}), make([]byte, 8)...)
+	if _, _, err := DecodeHeader(valid); err != nil {
+		t.Fatalf("expected a valid header, got %v", err)
+	}
+
+	corrupt := bytes.Clone(valid)
+	corrupt[1] = 'X'
+	for name, data := range map[string][]byte{
+		"headerless":    make([]byte, 8),
+		"empty":         nil,
+		"corrupt magic": corrupt,
+		"header only":   valid[:headerSize-1],
+	} {
+		if _, _, err := DecodeHeader(data); !errors.Is(err, errNoHeader) {
+			t.Errorf("%s: expected a missing header, got %v", name, err)
+		}
+	}
+
+	for name, data := range map[string][]byte{
+		"truncated": valid[:len(valid)-1],
+		"too long":  append(bytes.Clone(valid), 0),
+	} {
+		if _, _, err := DecodeHeader(data); !errors.Is(err, errHeaderLength) {
+			t.Errorf("%s: expected a length mismatch, got %v", name, err)
+		}
+	}
+
+	version := bytes.Clone(valid)
+	version[4] = 2
+	if _, _, err := DecodeHeader(version); err == nil {
+		t.Error("expected an unknown version to be rejected")
+	}
+
+	// inspecting a file without a header fails rather than guessing
+	path := filepath.Join(t.TempDir(), "raw.bin")
+	if err := os.WriteFile(path, make([]byte, 1920), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewOptions().Inspect(&bytes.Buffer{}, path); !errors.Is(err, errNoHeader) {
+		t.Errorf("expected inspecting a headerless file to fail, got %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// icoMagic starts every .ico file: a reserved zero word followed by type 1 (icon)
+const icoMagic = "\x00\x00\x01\x00"
+
+func init() {
+	image.RegisterFormat("ico", icoMagic, decodeICO, decodeICOConfig)
+}
+
+// icoEntry is an ICONDIRENTRY, describing one of the images in an icon file
+type icoEntry struct {
+	Width, Height uint8 // 0 means 256
+	ColorCount    uint8
+	Reserved      uint8
+	Planes        uint16
+	BitCount      uint16
+	Size          uint32
+	Offset        uint32
+}
+
+func (e icoEntry) pixels() int {
+	w, h := int(e.Width), int(e.Height)
+	if w == 0 {
+		w = 256
+	}
+	if h == 0 {
+		h = 256
+	}
+	return w * h
+}
+
+// decodeICO returns the largest image of an icon file
+func decodeICO(r io.Reader) (image.Image, error) {
+	images, err := decodeICOEntries(r)
+	if err != nil {
+		return nil, err
+	}
+	largest := images[0]
+	for _, img := range images[1:] {
+		b, lb := img.Bounds(), largest.Bounds()
+		if b.Dx()*b.Dy() > lb.Dx()*lb.Dy() {
+			largest = img
+		}
+	}
+	return largest, nil
+}
+
+func decodeICOConfig(r io.Reader) (image.Config, error) {
+	img, err := decodeICO(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: img.ColorModel(), Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}, nil
+}
+
+// decodeICOEntries decodes every image of an icon file, in directory order.
+//
+// Modern icons store large entries as embedded PNG files, while the classic
+// entries are headerless BMPs followed by a 1-bit AND mask marking the
+// transparent pixels.
+func decodeICOEntries(r io.Reader) ([]image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 6 || string(data[:4]) != icoMagic {
+		return nil, errors.New("ico: not an icon file")
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:6]))
+	if count == 0 {
+		return nil, errors.New("ico: icon file has no images")
+	}
+	entries := make([]icoEntry, count)
+	if err := binary.Read(bytes.NewReader(data[6:]), binary.LittleEndian, entries); err != nil {
+		return nil, fmt.Errorf("ico: truncated directory: %w", err)
+	}
+	images := make([]image.Image, 0, count)
+	for i, e := range entries {
+		end := uint64(e.Offset) + uint64(e.Size)
+		if end > uint64(len(data)) {
+			return nil, fmt.Errorf("ico: image %d extends past the end of the file", i)
+		}
+		entry := data[e.Offset:end]
+		var img image.Image
+		if bytes.HasPrefix(entry, []byte("\x89PNG\r\n\x1a\n")) {
+			var cfg image.Config
+			if cfg, err = png.DecodeConfig(bytes.NewReader(entry)); err == nil {
+				err = checkPixels(cfg.Width, cfg.Height)
+			}
+			if err == nil {
+				img, err = png.Decode(bytes.NewReader(entry))
+			}
+		} else {
+			img, err = decodeICOBitmap(entry)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ico: image %d (%d pixels): %w", i, e.pixels(), err)
+		}
+		images = append(images, img)
+	}
+	return images, nil
+}
+
+// decodeICOBitmap decodes a BITMAPINFOHEADER-prefixed DIB as stored in icons.
+//
+// The header's height covers both the color (XOR) bitmap and the AND mask, so
+// it is twice the height of the image. Rows are stored bottom-up and padded to
+// 4 bytes.
+func decodeICOBitmap(data []byte) (image.Image, error) {
+	if len(data) < 40 {
+		return nil, errors.New("truncated bitmap header")
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data[0:4]))
+	w := int(int32(binary.LittleEndian.Uint32(data[4:8])))
+	h := int(int32(binary.LittleEndian.Uint32(data[8:12]))) / 2
+	bpp := int(binary.LittleEndian.Uint16(data[14:16]))
+	compression := binary.LittleEndian.Uint32(data[16:20])
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:36]))
+	if w <= 0 || h <= 0 || headerSize < 40 {
+		return nil, fmt.Errorf("invalid bitmap size %dx%d", w, h)
+	}
+	if err := checkPixels(w, h); err != nil {
+		return nil, err
+	}
+	if compression != 0 {
+		return nil, fmt.Errorf("unsupported bitmap compression %d", compression)
+	}
+
+	pos := headerSize
+	var palette []color.RGBA
+	if bpp <= 8 {
+		if colorsUsed == 0 {
+			colorsUsed = 1 << uint(bpp)
+		}
+		if len(data) < pos+colorsUsed*4 {
+			return nil, errors.New("truncated color table")
+		}
+		for i := 0; i < colorsUsed; i++ {
+			c := data[pos+i*4:]
+			palette = append(palette, color.RGBA{c[2], c[1], c[0], 0xFF})
+		}
+		pos += colorsUsed * 4
+	}
+
+	switch bpp {
+	case 1, 4, 8, 24, 32:
+	default:
+		return nil, fmt.Errorf("unsupported bitmap depth %d", bpp)
+	}
+	stride := (w*bpp + 31) / 32 * 4
+	maskStride := (w + 31) / 32 * 4
+	if len(data) < pos+stride*h {
+		return nil, errors.New("truncated bitmap")
+	}
+	xor := data[pos : pos+stride*h]
+	// some encoders leave out the AND mask of 32-bit images, which carry
+	// their own alpha channel anyway
+	var mask []byte
+	if len(data) >= pos+stride*h+maskStride*h {
+		mask = data[pos+stride*h : pos+stride*h+maskStride*h]
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	hasAlpha := false
+	for y := 0; y < h; y++ {
+		row := xor[(h-1-y)*stride:]
+		for x := 0; x < w; x++ {
+			var c color.RGBA
+			switch bpp {
+			case 1, 4, 8:
+				bit := x * bpp
+				idx := int(row[bit/8]>>uint(8-bpp-bit%8)) & (1<<uint(bpp) - 1)
+				if idx >= len(palette) {
+					return nil, fmt.Errorf("color index %d out of range", idx)
+				}
+				c = palette[idx]
+			case 24:
+				c = color.RGBA{row[x*3+2], row[x*3+1], row[x*3], 0xFF}
+			case 32:
+				c = color.RGBA{row[x*4+2], row[x*4+1], row[x*4], row[x*4+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			}
+			img.SetNRGBA(x, y, color.NRGBA(c))
+		}
+	}
+
+	if bpp == 32 && hasAlpha {
+		return img, nil
+	}
+	if bpp == 32 {
+		// 32-bit images without any alpha rely on the mask alone
+		for i := 3; i < len(img.Pix); i += 4 {
+			img.Pix[i] = 0xFF
+		}
+	}
+	// the AND mask has a set bit for every transparent pixel
+	if mask != nil {
+		for y := 0; y < h; y++ {
+			row := mask[(h-1-y)*maskStride:]
+			for x := 0; x < w; x++ {
+				if row[x/8]&(0x80>>uint(x%8)) != 0 {
+					img.SetNRGBA(x, y, color.NRGBA{})
+				}
+			}
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"image/color"
+	"os"
+	"testing"
+)
+
+func TestICOPicksLargest(t *testing.T) {
+	src, err := LoadImg("testdata/multi-size.ico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := (*src).Bounds(); b.Dx() != 256 || b.Dy() != 256 {
+		t.Errorf("expected the 256px image to be chosen, got %v", b)
+	}
+}
+
+func TestICOEntries(t *testing.T) {
+	f, err := os.Open("testdata/multi-size.ico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	images, err := decodeICOEntries(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 3 {
+		t.Fatalf("expected 3 images, got %d", len(images))
+	}
+	for i, size := range []int{16, 32, 256} {
+		if b := images[i].Bounds(); b.Dx() != size || b.Dy() != size {
+			t.Errorf("image %d: expected %dpx, got %v", i, size, b)
+		}
+	}
+
+	// 16px 4-bit bitmap, the AND mask makes its left half transparent
+	if _, _, _, a := images[0].At(0, 0).RGBA(); a != 0 {
+		t.Errorf("expected the masked pixel to be transparent, got alpha %d", a)
+	}
+	if c := color.NRGBAModel.Convert(images[0].At(12, 0)); c != (color.NRGBA{0, 0, 0, 0xFF}) {
+		t.Errorf("expected an opaque black pixel, got %v", c)
+	}
+	// 32px 32-bit bitmap with its own alpha channel: red on top, transparent below
+	if c := color.NRGBAModel.Convert(images[1].At(0, 0)); c != (color.NRGBA{0xFF, 0, 0, 0xFF}) {
+		t.Errorf("expected an opaque red pixel, got %v", c)
+	}
+	if _, _, _, a := images[1].At(0, 31).RGBA(); a != 0 {
+		t.Errorf("expected a transparent pixel, got alpha %d", a)
+	}
+}
+
+func TestICOFrameAndBackground(t *testing.T) {
+	opts := NewOptions()
+	opts.FrameIndex, opts.Background, opts.DisableDithering = 0, color.White, true
+
+	frames, err := opts.LoadFrames("testdata/multi-size.ico")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("expected every size to be returned with -frame, got %d", len(frames))
+	}
+	imgBits := opts.ImgToBytes(16, 16, &frames[0].Image)
+	// the transparent half shows the white background, the other half is black
+	if bitAt(16, 2, 2, imgBits) {
+		t.Error("expected the transparent pixel to be composited onto white")
+	}
+	if !bitAt(16, 12, 2, imgBits) {
+		t.Error("expected the opaque pixel to stay black")
+	}
+}
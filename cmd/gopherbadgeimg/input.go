@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// stdinName is the input filename that makes the tool read the image from stdin,
+// so that it can sit in the middle of a pipeline
+const stdinName = "-"
+
+// limits applied when fetching images over HTTP(S), set with -timeout and
+// -max-download, which also limits the entries read from archives
+var (
+	urlTimeout        = 30 * time.Second
+	maxDownload int64 = 20 << 20
+)
+
+// maxPixels is the largest image decoded, in pixels, set with -max-pixels:
+// decoding allocates the whole image, and a few bytes of PNG can claim to be
+// 30000x30000
+var maxPixels int64 = 64 << 20
+
+// maxRedirects is how many redirects are followed before giving up on a URL
+const maxRedirects = 5
+
+// ReadInput returns the raw contents of infile, which is either a path, "-"
+// for stdin, or an http:// or https:// URL. Its errors match errInput.
+//
+// Stdin is read as bytes and never as text, so images survive the trip
+// unchanged on every platform. Named pipes are read to their end as stdin
+// is, and paths that are neither, see checkInputFile, are refused before
+// anything is read.
+func ReadInput(infile string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	switch {
+	case infile == stdinName:
+		data, err = io.ReadAll(os.Stdin)
+	case IsURL(infile):
+		data, err = fetchURL(infile)
+	default:
+		if err = checkInputFile(infile); err == nil {
+			data, err = os.ReadFile(infile)
+		}
+	}
+	return data, classify(errInput, err)
+}
+
+// checkInputFile checks that the file at path can be read as an input: a
+// regular file, or a named pipe. Directories, sockets and devices, which
+// would fail to read, block or never end, are refused saying what to do
+// instead. A path that can't be found is left for reading it to report.
+func checkInputFile(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	switch mode := info.Mode(); {
+	case mode.IsRegular(), mode&fs.ModeNamedPipe != 0:
+		return nil
+	case mode.IsDir():
+		return fmt.Errorf("%s is a directory, use -recursive to convert the images in it, or list them with -batch-file", path)
+	case mode&fs.ModeSocket != 0:
+		return fmt.Errorf("%s is a socket, which can't be read as a file: pipe the image in and give - to read it from stdin", path)
+	case mode&fs.ModeDevice != 0:
+		return fmt.Errorf("%s is a device, not a file: pipe the image in and give - to read it from stdin", path)
+	}
+	return fmt.Errorf("%s is not a regular file", path)
+}
+
+// checkEmpty fails for the data of an input that holds nothing at all, which
+// would otherwise be reported as in no known format. Its error matches
+// errInput.
+func checkEmpty(infile string, data []byte) error {
+	if len(data) > 0 {
+		return nil
+	}
+	switch {
+	case infile == stdinName:
+		return classify(errInput, errors.New("stdin is empty (0 bytes): nothing was piped in"))
+	case IsURL(infile):
+		return classify(errInput, fmt.Errorf("%s sent an empty response (0 bytes)", infile))
+	}
+	return classify(errInput, fmt.Errorf("%s is empty (0 bytes)", infile))
+}
+
+// IsURL reports whether infile should be downloaded rather than opened
+func IsURL(infile string) bool {
+	lower := strings.ToLower(infile)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// fetchURL downloads an image, refusing responses that aren't a 200, are
+// bigger than maxDownload, or are obviously a web page rather than an image.
+func fetchURL(url string) ([]byte, error) {
+	client := &http.Client{
+		Timeout: urlTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status %d (%s)", url, resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	if resp.ContentLength > maxDownload {
+		return nil, fmt.Errorf("fetching %s: %d bytes is over the %d byte limit", url, resp.ContentLength, maxDownload)
+	}
+	// the server may not announce the length, so read one byte past the limit
+	// to find out whether the body is too big
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownload+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetching %s: %w", url, err)
+	}
+	if int64(len(data)) > maxDownload {
+		return nil, fmt.Errorf("fetching %s: response is over the %d byte limit", url, maxDownload)
+	}
+	// don't trust the server's Content-Type, look at what was sent
+	if contentType := http.DetectContentType(data); strings.HasPrefix(contentType, "text/html") {
+		return nil, fmt.Errorf("fetching %s: got a web page (%s) rather than an image", url, contentType)
+	}
+	return data, nil
+}
+
+// decodeImg decodes an image in any of the registered formats, including
+// those of badgeimg.RegisterDecoder, explaining why it can't be when it
+// can't (see explainDecode)
+func decodeImg(data []byte) (image.Image, error) {
+	if err := checkDecodeSize(data); err != nil {
+		return nil, err
+	}
+	src, format, err := badgeimg.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, explainDecode(data, format, err)
+	}
+	if slices.Contains(badgeimg.Decoders(), format) {
+		// custom decoders have no DecodeConfig to check the size with first
+		if err := checkPixels(src.Bounds().Dx(), src.Bounds().Dy()); err != nil {
+			return nil, err
+		}
+	}
+	return src, nil
+}
+
+// checkDecodeSize refuses images of more than maxPixels from the size in
+// their header, before they are decoded. Icon files check each of their
+// images as they are decoded instead, and SVG documents are drawn at the
+// size they are converted to, whatever size they say they are.
+func checkDecodeSize(data []byte) error {
+	if bytes.HasPrefix(data, []byte(icoMagic)) {
+		return nil
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || format == "svg" {
+		// errors are left for decoding to report
+		return nil
+	}
+	return checkPixels(cfg.Width, cfg.Height)
+}
+
+// checkPixels refuses a w by h image of more than maxPixels
+func checkPixels(w, h int) error {
+	if pixels := int64(w) * int64(h); pixels > maxPixels {
+		return fmt.Errorf("a %dx%d image is %d pixels, over the limit of %d set by -max-pixels", w, h, pixels, maxPixels)
+	}
+	return nil
+}
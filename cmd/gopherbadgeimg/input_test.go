@@ -0,0 +1,296 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func TestStdinInput(t *testing.T) {
+	f, err := os.Open("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	os.Stdin = f
+
+	opts := NewOptions()
+	piped, err := opts.LoadFrames(stdinName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := opts.LoadFrames("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(piped) != 1 || len(fromFile) != 1 {
+		t.Fatalf("expected a single frame, got %d and %d", len(piped), len(fromFile))
+	}
+	pipedOut := EncodeToString(opts.ImgToBytes(246, 128, &piped[0].Image))
+	fileOut := EncodeToString(opts.ImgToBytes(246, 128, &fromFile[0].Image))
+	if pipedOut != fileOut {
+		t.Error("expected stdin and file input to produce the same output")
+	}
+}
+
+func TestURLInput(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/avatar.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(png)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/avatar.png", http.StatusFound)
+	})
+	mux.HandleFunc("/huge.png", func(w http.ResponseWriter, r *http.Request) {
+		// no Content-Length, the limit must be enforced while reading
+		w.(http.Flusher).Flush()
+		w.Write(make([]byte, 2048))
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<!DOCTYPE html><html><body>not an image</body></html>"))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	oldMax := maxDownload
+	defer func() { maxDownload = oldMax }()
+	maxDownload = 1 << 20
+
+	for _, path := range []string{"/avatar.png", "/redirect"} {
+		frames, err := NewOptions().LoadFrames(server.URL + path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if b := frames[0].Image.Bounds(); b.Dx() != 246 || b.Dy() != 128 {
+			t.Errorf("%s: unexpected image bounds %v", path, b)
+		}
+	}
+
+	_, err = ReadInput(server.URL + "/missing.png")
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected the status code in the error, got %v", err)
+	}
+
+	maxDownload = 1024
+	_, err = ReadInput(server.URL + "/huge.png")
+	if err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Errorf("expected an oversized body to be rejected, got %v", err)
+	}
+
+	_, err = ReadInput(server.URL + "/page")
+	if err == nil || !strings.Contains(err.Error(), "web page") {
+		t.Errorf("expected a web page to be rejected, got %v", err)
+	}
+}
+
+// hugePNG returns the start of a PNG claiming to be w by h: its header, and no
+// pixels
+func hugePNG(w, h int) []byte {
+	ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), uint32(w))
+	ihdr = binary.BigEndian.AppendUint32(ihdr, uint32(h))
+	// 8 bits per channel, RGBA, not interlaced
+	ihdr = append(ihdr, 8, 6, 0, 0, 0)
+	data := append([]byte("\x89PNG\r\n\x1a\n"), 0, 0, 0, 13)
+	data = append(data, ihdr...)
+	return binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestMaxPixels(t *testing.T) {
+	huge := hugePNG(30000, 30000)
+	const want = "a 30000x30000 image is 900000000 pixels, over the limit of 67108864 set by -max-pixels"
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := NewOptions().DecodeFrames(huge)
+	runtime.ReadMemStats(&after)
+	if err == nil || err.Error() != want {
+		t.Errorf("expected %q, got %v", want, err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("expected the image to be refused before it is decoded, %d bytes were allocated", allocated)
+	}
+
+	path := filepath.Join(t.TempDir(), "huge.png")
+	if err := os.WriteFile(path, huge, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	os.Stdin = f
+	if _, err := NewOptions().LoadFrames(stdinName); err == nil || err.Error() != want {
+		t.Errorf("stdin: expected %q, got %v", want, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(huge)
+	}))
+	defer server.Close()
+	if _, err := LoadImg(server.URL + "/huge.png"); err == nil || err.Error() != want {
+		t.Errorf("URL: expected %q, got %v", want, err)
+	}
+
+	oldMax := maxPixels
+	defer func() { maxPixels = oldMax }()
+	code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "splash", "-max-pixels", "10000", "testdata/tainigo_128.png")
+	if code != 4 || !strings.Contains(errOut, "a 246x128 image is 31488 pixels, over the limit of 10000 set by -max-pixels") {
+		t.Errorf("expected exit code 4 and an error, got %d and\n%s", code, errOut)
+	}
+}
+
+// toyMagic starts the images of the toy format of TestRegisterDecoder, the
+// fourth byte being its version: then come the width and height, one byte
+// each, and a byte of gray per pixel, row by row
+const toyMagic = "TOY?"
+
+var registerToy sync.Once
+
+// decodeToy decodes an image of the toy format
+func decodeToy(r io.Reader) (image.Image, error) {
+	head := make([]byte, 6)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	img := image.NewGray(image.Rect(0, 0, int(head[4]), int(head[5])))
+	if _, err := io.ReadFull(r, img.Pix); err != nil {
+		return nil, errors.New("toy: the pixels are truncated")
+	}
+	return img, nil
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	registerToy.Do(func() {
+		badgeimg.RegisterDecoder("toy", []byte(toyMagic), decodeToy)
+	})
+	dir := t.TempDir()
+	sheet := filepath.Join(dir, "sheet.png")
+	writeCheckerboard(t, sheet, 32, 32, 4, 2)
+	src, err := LoadImg(sheet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gray := image.NewGray(image.Rect(0, 0, 32, 32))
+	for y := range 32 {
+		for x := range 32 {
+			gray.Set(x, y, (*src).At(x, y))
+		}
+	}
+	toy := filepath.Join(dir, "sheet.toy")
+	if err := os.WriteFile(toy, append([]byte("TOY2\x20\x20"), gray.Pix...), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, in := range []string{sheet, toy} {
+		if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "32x32", "-threshold", "128", "-o", in+".bin", in); code != 0 {
+			t.Fatalf("%s: expected exit code 0, got %d and\n%s", in, code, errOut)
+		}
+	}
+	want, err := os.ReadFile(sheet + ".bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(toy + ".bin"); err != nil || !bytes.Equal(got, want) {
+		t.Errorf("expected the toy image to convert as the PNG does, got %v", err)
+	}
+
+	if code, out, _ := runCLI(t, "-list-formats"); code != 0 || !slices.Contains(strings.Split(out, "\n"), "input toy") {
+		t.Errorf("expected -list-formats to list the toy decoder, got %d and\n%s", code, out)
+	}
+	if err := os.WriteFile(toy, []byte("TOY2\x20\x20\x00"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "32x32", toy); code != exitDecode || !strings.Contains(errOut, "toy: the pixels are truncated") {
+		t.Errorf("expected exit code %d and the error of the decoder, got %d and\n%s", exitDecode, code, errOut)
+	}
+}
+
+func TestEmptyAndDirectoryInputs(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{"empty.png": nil, "empty.tar": nil} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "icons"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(filepath.Join(dir, "pack.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for name, data := range map[string][]byte{"gopher.png": png, "blank.png": nil} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		input, want string
+	}{
+		{filepath.Join(dir, "icons"), filepath.Join(dir, "icons") + " is a directory, use -recursive to convert the images in it, or list them with -batch-file"},
+		{filepath.Join(dir, "empty.png"), filepath.Join(dir, "empty.png") + " is empty (0 bytes)"},
+		{filepath.Join(dir, "empty.tar"), filepath.Join(dir, "empty.tar") + " is empty (0 bytes)"},
+		{filepath.Join(dir, "pack.zip"), filepath.Join(dir, "pack.zip") + ":blank.png is empty (0 bytes)"},
+		{server.URL + "/blank.png", server.URL + "/blank.png sent an empty response (0 bytes)"},
+	} {
+		code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "profile", test.input)
+		if code != exitInput || !strings.Contains(errOut, test.want) {
+			t.Errorf("%s: expected exit code %d and %q, got %d: %s", test.input, exitInput, test.want, code, errOut)
+		}
+	}
+	// the other entries of an archive are still converted
+	if code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "profile", filepath.Join(dir, "pack.zip")); !strings.Contains(errOut, "] gopher ok") {
+		t.Errorf("expected gopher.png to be converted, got %d: %s", code, errOut)
+	}
+
+	empty, err := os.Open(filepath.Join(dir, "empty.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer empty.Close()
+	oldStdin := os.Stdin
+	defer func() { os.Stdin = oldStdin }()
+	os.Stdin = empty
+	if code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "profile", "-"); code != exitInput || !strings.Contains(errOut, "stdin is empty (0 bytes): nothing was piped in") {
+		t.Errorf("expected exit code %d for an empty stdin, got %d: %s", exitInput, code, errOut)
+	}
+}
@@ -0,0 +1,61 @@
+//go:build unix
+
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestSpecialFileInputs(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+
+	// named pipes are read to their end, as stdin is
+	fifo := filepath.Join(dir, "fifo.png")
+	if err := syscall.Mkfifo(fifo, 0o600); err != nil {
+		t.Skipf("can't make a named pipe: %v", err)
+	}
+	go func() {
+		if f, err := os.OpenFile(fifo, os.O_WRONLY, 0); err == nil {
+			f.Write(png)
+			f.Close()
+		}
+	}()
+	out := filepath.Join(dir, "fifo.bin")
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "profile", "-o", out, fifo); code != 0 {
+		t.Fatalf("expected the named pipe to be converted, got %d: %s", code, errOut)
+	}
+	img, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(out); err != nil || string(data) != string(NewOptions().ImgToBytes(120, 128, img)) {
+		t.Errorf("expected the named pipe to convert as the file does, got %v", err)
+	}
+
+	socket := filepath.Join(dir, "socket.png")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("can't make a socket: %v", err)
+	}
+	defer l.Close()
+	for _, test := range []struct {
+		input, want string
+	}{
+		{socket, socket + " is a socket, which can't be read as a file: pipe the image in and give - to read it from stdin"},
+		{os.DevNull, os.DevNull + " is a device, not a file"},
+	} {
+		code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "profile", test.input)
+		if code != exitInput || !strings.Contains(errOut, test.want) {
+			t.Errorf("%s: expected exit code %d and %q, got %d: %s", test.input, exitInput, test.want, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// -layout packs black and white images for other displays and firmwares
+// than the badge's (see badgeimg.LayoutNames). Conversions still pack them
+// for the badge, which is what -show, the previews, -stats, the cache and
+// every other step reading the data back expect, and the data is repacked
+// into -layout as it is written, and out of it as headerless bin files and
+// base64 data are read. Headers and slideshows only describe the badge's
+// layout, and the serial protocol of -send only takes it.
+
+// layoutBytes returns imgBits, an x by y image packed for the badge, packed
+// with -layout
+func (o *Options) layoutBytes(x, y int, imgBits []byte) []byte {
+	if o.Palette != MonoPalette {
+		return imgBits
+	}
+	packed, err := badgeimg.Repack(x, y, imgBits, badgeimg.LayoutBadger, o.Layout)
+	if err != nil {
+		// sizes are validated up front, this is a programming error
+		panic(err)
+	}
+	return packed
+}
+
+// layoutFrames is layoutBytes for every frame of frames
+func (o *Options) layoutFrames(x, y int, frames [][]byte) [][]byte {
+	if o.Palette != MonoPalette || o.Layout == badgeimg.LayoutBadger {
+		return frames
+	}
+	packed := make([][]byte, len(frames))
+	for i, frame := range frames {
+		packed[i] = o.layoutBytes(x, y, frame)
+	}
+	return packed
+}
+
+// frameLayout returns the layout of a frame read from data without a header,
+// and its length in bytes, for an x by y image packed for p with -layout
+func (o *Options) frameLayout(p *Palette, x, y int) (badgeimg.Layout, int) {
+	if p != MonoPalette {
+		return badgeimg.LayoutBadger, x * y * p.Depth / 8
+	}
+	return o.Layout, o.Layout.BufferLen(x, y)
+}
+
+// checkLayout checks that the conversion flags set along with -layout, when
+// it isn't the badge's, can be used with it (the palette is checked by apply)
+func checkLayout(opts *Options) error {
+	if opts.Layout == badgeimg.LayoutBadger {
+		return nil
+	}
+	switch {
+	case opts.Header:
+		return usagef("error: -header only describes the badger layout, not -layout %s", opts.Layout)
+	case opts.hasOutMode("slideshow"):
+		return usagef("error: -outmode slideshow only holds the badger layout, not -layout %s", opts.Layout)
+	case opts.Send != "":
+		return usagef("error: -send sends images in the badger layout the receiver draws, not -layout %s", opts.Layout)
+	case opts.Region != "":
+		return usagef("error: -region windows are cut on the bytes of the badger layout, not -layout %s", opts.Layout)
+	case opts.GoFormat == "image" && !opts.ImportRuntime:
+		return usagef("error: -gofmt image only unpacks the badger layout on its own, add -import-runtime to unpack -layout %s", opts.Layout)
+	}
+	return nil
+}
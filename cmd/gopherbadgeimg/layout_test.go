@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func TestLayoutFlag(t *testing.T) {
+	dir := t.TempDir()
+	convert := func(name string, args ...string) []byte {
+		t.Helper()
+		out := filepath.Join(dir, name)
+		args = append([]string{"-outmode", "bin", "-ratio", "16x16", "-disable-dithering", "-o", out}, args...)
+		if code, _, errOut := runCLI(t, append(args, "testdata/disposal-0.png")...); code != 0 {
+			t.Fatalf("%s: exit code %d: %s", name, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	decode := func(name string, args ...string) []byte {
+		t.Helper()
+		out := filepath.Join(dir, name+".png")
+		args = append([]string{"decode", "-ratio", "16x16", "-o", out}, args...)
+		if code, _, errOut := runCLI(t, append(args, filepath.Join(dir, name))...); code != 0 {
+			t.Fatalf("decode %s: exit code %d: %s", name, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	badger := convert("badger.bin")
+	png := decode("badger.bin")
+	for _, name := range badgeimg.LayoutNames {
+		layout, err := badgeimg.LookupLayout(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := badgeimg.Repack(16, 16, badger, badgeimg.LayoutBadger, layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := convert(name+".bin", "-layout", name); !bytes.Equal(got, want) {
+			t.Errorf("-layout %s: expected the badge's data repacked\n% x\ngot\n% x", name, want, got)
+		}
+		if got := decode(name+".bin", "-layout", name); !bytes.Equal(got, png) {
+			t.Errorf("-layout %s: expected the data to decode to the image the badge's does", name)
+		}
+	}
+
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-layout", "ssd1307"}, "unknown layout `ssd1307`"},
+		{[]string{"-layout", "ssd1306", "-colors", "acep"}, "only applies to black and white images"},
+		{[]string{"-layout", "ssd1306", "-header", "-outmode", "bin"}, "-header only describes the badger layout"},
+		{[]string{"-layout", "ssd1306", "-outmode", "slideshow"}, "-outmode slideshow only holds the badger layout"},
+		{[]string{"-layout", "row-msb", "-region", "8x8+0+0", "-outmode", "bin"}, "-region windows"},
+		{[]string{"-layout", "badger-os", "-outmode", "rice", "-gofmt", "image"}, "add -import-runtime"},
+	} {
+		args := append([]string{"-ratio", "16x16"}, tc.args...)
+		code, _, errOut := runCLI(t, append(args, "testdata/disposal-0.png")...)
+		if code != exitUsage || !strings.Contains(errOut, tc.want) {
+			t.Errorf("%v: expected exit code %d and %q, got %d: %s", tc.args, exitUsage, tc.want, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"image/color"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLogLevels(t *testing.T) {
+	dir := t.TempDir()
+	white := filepath.Join(dir, "white.png")
+	writeSquare(t, white, color.White, false)
+	missing := filepath.Join(dir, "missing.png")
+
+	// a batch with a warning (-stats), an error, progress and a summary
+	args := []string{"-outmode", "base64", "-ratio", "32x32", "-stats", white, missing}
+	messages := map[string]string{
+		"error":    "error converting " + filepath.Join(dir, "missing"),
+		"warning":  "warning: ",
+		"progress": "[1/2]",
+		"summary":  "converted 1 input(s), 1 failed",
+		"debug":    "converting to 32x32, dithering with floyd-steinberg",
+		"timing":   "converted to 32x32 in ",
+	}
+	var data string
+	for _, test := range []struct {
+		flags []string
+		want  []string
+	}{
+		{[]string{"-quiet"}, []string{"error"}},
+		{nil, []string{"error", "warning", "progress", "summary"}},
+		{[]string{"-v"}, []string{"error", "warning", "progress", "summary", "debug"}},
+		{[]string{"-vv"}, []string{"error", "warning", "progress", "summary", "debug", "timing"}},
+	} {
+		code, out, errOut := runCLI(t, append(test.flags, args...)...)
+		if code != exitInput {
+			t.Errorf("%v: expected exit code %d, got %d", test.flags, exitInput, code)
+		}
+		for name, message := range messages {
+			want := slices.Contains(test.want, name)
+			if strings.Contains(errOut, message) != want {
+				t.Errorf("%v: expected the %s message (%q) on stderr: %v, got\n%s", test.flags, name, message, want, errOut)
+			}
+		}
+		// the data on stdout doesn't depend on the level
+		if data == "" {
+			data = out
+		} else if out != data {
+			t.Errorf("%v: expected the same base64 data, got %q instead of %q", test.flags, out, data)
+		}
+	}
+	if data == "" {
+		t.Error("expected base64 data on stdout")
+	}
+
+	if code, _, errOut := runCLI(t, "-quiet", "-v", "-outmode", "none", "-ratio", "32x32", white); code != exitUsage || !strings.Contains(errOut, "cannot be combined") {
+		t.Errorf("expected -quiet -v to be refused, got %d and\n%s", code, errOut)
+	}
+}
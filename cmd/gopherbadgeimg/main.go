@@ -1,126 +1,32 @@
 package main
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
-	"flag"
 	"fmt"
+	"go/format"
 	"image"
 	"image/color"
 	_ "image/jpeg"
 	_ "image/png"
-	"log"
+	"io"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 
-	"github.com/makeworld-the-better-one/dither"
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
 	_ "golang.org/x/image/bmp"
-	"golang.org/x/image/draw"
 	_ "golang.org/x/image/webp"
 )
 
-// flags for determining what to do
-var (
-	disableDithering bool
-	outMode          string
-	show             bool
-	ratio            string
-)
+// logger writes the messages of gopherbadgeimg to stderr, at the level set
+// by -quiet, -v and -vv
+var logger = &badgeimg.Logger{}
 
 func main() {
-	flag.BoolVar(&disableDithering, "disable-dithering", false, "disables dithering")
-	flag.BoolVar(&show, "show", false, "paints dot-matrix-style art to the screen representing the image")
-	flag.StringVar(
-		&outMode,
-		"outmode",
-		"",
-		"set the resize mode to one of: rice, bin, base64, or none",
-	)
-	flag.StringVar(
-		&ratio,
-		"ratio",
-		"",
-		"set the aspect ratio to predefined values including 'profile' or splash', or a custom value specified in the format of <height>x<width>.",
-	)
-	flag.Parse()
-	if flag.NArg() != 1 {
-		log.Printf("args: %v\n\n", flag.Args())
-		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s <input_image>:\n", os.Args[0])
-		flag.PrintDefaults()
-		fmt.Fprintf(
-			flag.CommandLine.Output(),
-			"\nExamples:\n%s -outmode bin -ratio splash tainigo_128.png\n%s -outmode rice -ratio 128x128 -disable-dithering -show image.jpg\n",
-			os.Args[0],
-			os.Args[0],
-		)
-		os.Exit(1)
-		return
-	}
-	infile := flag.Args()[0]
-	if _, err := os.Stat(infile); err != nil {
-		log.Fatalf("could not stat %v: %v", infile, err)
-	}
-	sourceImage, err := LoadImg(infile)
-	if err != nil {
-		log.Fatalf("error loading source image: %v", err)
-	}
-	var imgBits []byte
-
-	var x, y int
-	switch ratio {
-	case "profile":
-		// profile image is 128x128
-		x, y = 120, 128
-	case "splash":
-		// splash image is 246x128
-		x, y = 246, 128
-	case "":
-		log.Println("error: a ratio must be provided.\n")
-		Usage()
-		return
-	default:
-		x, y, err = ParseRatio(ratio)
-		if err != nil {
-			log.Println(err.Error())
-			Usage()
-			// The Usage function calls os.Exit(1) but LSPs and static analyzers often don't
-			// pick up on that, so it's good practice to return from the caller anyway
-			// For the sake of consistency, we return after toplevel os.Exit calls as well
-			return
-		}
-		// must use a y value divisble by 8 as we write the bits one byte at a time
-		if y%8 != 0 {
-			log.Println("error: height/y value must be divisible by 8")
-			os.Exit(1)
-			return
-		}
-
-	}
-	imgBits = ImgToBytes(x, y, sourceImage)
-	switch outMode {
-	case "rice":
-		err = WriteToGoFile(fmt.Sprintf("%s-generated.go", ratio), ratio, imgBits)
-		if err != nil {
-			log.Fatalf("error writing image to file: %v", err)
-		}
-	case "bin":
-		err = WriteToBinFile(fmt.Sprintf("%s.bin", ratio), imgBits)
-		if err != nil {
-			log.Fatalf("error writing image to file: %v", err)
-		}
-	case "base64":
-		fmt.Println(EncodeToString(imgBits))
-	case "none":
-		// this option is useful if you want to preview the file without creating it
-	default:
-		log.Printf("error: invalid outmode `%s`\n\n", outMode)
-		Usage()
-		return
-	}
-	if show {
-		PrintImg(x, y, imgBits)
-	}
+	os.Exit(run(os.Args[1:]))
 }
 
 // EncodeToString is a friendly-named function for hooking into base64
@@ -135,55 +41,162 @@ func EncodeToString(imageBits []byte) string {
 // compile time (be nice to your editor's memory!).
 // see an example of this in the main_test.go file.
 func WriteToBinFile(filename string, imageBits []byte) error {
-	outf, err := os.Create(filename)
-	if err != nil {
+	return (&Options{Force: true}).writeFile(filename, func(w io.Writer) error {
+		_, err := w.Write(imageBits)
 		return err
-	}
-	defer outf.Close()
-	_, err = outf.Write(imageBits)
-	return err
+	})
 }
 
-// Create a go file with the bytes hardcoded into a variable at build
+// Create a go file with the bytes hardcoded into a variable at build, along
+// with constants giving its length and how it is packed
 func WriteToGoFile(filename, variablename string, imageBits []byte) error {
-	outf, err := os.Create(filename)
-	if err != nil {
-		return err
-	}
-	defer outf.Close()
-	_, err = outf.Write(
-		[]byte(
-			"// Code generated by " + os.Args[0] + " DO NOT EDIT.\n\npackage main\n\nvar r" + variablename + " = []byte{",
-		),
-	)
-	if err != nil {
-		return err
-	}
+	return WriteToGoFileWithProvenance(filename, variablename, imageBits, nil)
+}
 
-	for i, b := range imageBits {
-		if i%32 == 0 {
-			_, err = outf.Write([]byte("\n\t"))
-			if err != nil {
-				return err
-			}
+// WriteToGoFileWithProvenance is WriteToGoFile for images whose conversion
+// is known, ending the file with the provenance block p (see provenance.go)
+// unless it is nil
+func WriteToGoFileWithProvenance(filename, variablename string, imageBits []byte, p *Provenance) error {
+	o := &Options{Force: true, provenance: p}
+	return writeGoFile(o, filename, func(w io.Writer) error {
+		if err := FprintGo(w, o.generatedHeader("//", "", filepath.Dir(filename)), "main", "r"+variablename, imageBits); err != nil {
+			return err
 		}
-		bStr := fmt.Sprintf("0x%02X, ", b)
-		_, err = outf.Write([]byte(bStr))
+		return fprintGoPacking(w, "r"+variablename, len(imageBits), o.layoutName(), o.bitOrderName())
+	})
+}
+
+// writeGoFile writes the Go file print renders to filename, formatted with
+// gofmt and ending with the provenance block of o if it has one: the whole
+// file is rendered in memory, then written at once
+func writeGoFile(o *Options, filename string, print func(w io.Writer) error) error {
+	return o.writeFile(filename, func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := print(&buf); err != nil {
+			return err
+		}
+		if o.provenance != nil {
+			buf.WriteString(o.provenance.String())
+		}
+		src, err := format.Source(buf.Bytes())
 		if err != nil {
 			return err
 		}
+		_, err = w.Write(src)
+		return err
+	})
+}
+
+// FprintGo writes the go file created by WriteToGoFile to w, starting with
+// header (see generatedHeader): a name variable in package pkg. It is
+// rendered in memory and written with a single Write, as w may be a file.
+func FprintGo(w io.Writer, header, pkg, name string, imageBits []byte) error {
+	buf := make([]byte, 0, len(header)+len(pkg)+len(name)+len(imageBits)*goByteSize+64)
+	buf = append(buf, header+"package "+pkg+"\n\nvar "+name+" = []byte{"...)
+	buf = appendGoBytes(buf, imageBits, "\n\t")
+	buf = append(buf, "\n}\n"...)
+	_, err := w.Write(buf)
+	return err
+}
+
+// goByteSize is the length of a byte literal written by appendGoBytes
+const goByteSize = len("0x00, ")
+
+// appendGoBytes appends data to buf as the byte literals of a []byte, 32 to a
+// line, each line starting with newline
+func appendGoBytes(buf, data []byte, newline string) []byte {
+	const digits = "0123456789ABCDEF"
+	for i, b := range data {
+		if i%32 == 0 {
+			buf = append(buf, newline...)
+		}
+		buf = append(buf, '0', 'x', digits[b>>4], digits[b&0xf], ',', ' ')
+	}
+	return buf
+}
+
+// goConst is a constant of a generated Go file, value being its literal
+type goConst struct {
+	name, value string
+}
+
+// fprintGoConsts writes a block of constants documented by comment, aligned
+// as gofmt would, since not every generated file goes through it
+func fprintGoConsts(w io.Writer, comment string, consts []goConst) error {
+	width := 0
+	for _, c := range consts {
+		width = max(width, len(c.name))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n// %s\nconst (\n", comment)
+	for _, c := range consts {
+		fmt.Fprintf(&b, "\t%-*s = %s\n", width, c.name, c.value)
+	}
+	b.WriteString(")\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// fprintGoSize writes the NameWidth and NameHeight constants of a variable
+func fprintGoSize(w io.Writer, name string, x, y int) error {
+	return fprintGoConsts(w, fmt.Sprintf("%sWidth and %sHeight are the size of %s, in pixels", name, name, name), []goConst{
+		{name + "Width", strconv.Itoa(x)},
+		{name + "Height", strconv.Itoa(y)},
+	})
+}
+
+// fprintGoPacking writes the NameLen, NameLayout and NameBitOrder constants
+// of a variable: the length of its data, of each frame for animations, which
+// is left out when it is negative (compressed frames vary), and how its
+// pixels are packed
+func fprintGoPacking(w io.Writer, name string, length int, layout, bitOrder string) error {
+	comment := fmt.Sprintf("%sLayout and %sBitOrder are how the pixels of %s are packed", name, name, name)
+	var consts []goConst
+	if length >= 0 {
+		comment = fmt.Sprintf("%sLen is the length of %s in bytes, and ", name, name) + comment
+		consts = append(consts, goConst{name + "Len", strconv.Itoa(length)})
+	}
+	consts = append(consts, goConst{name + "Layout", strconv.Quote(layout)}, goConst{name + "BitOrder", strconv.Quote(bitOrder)})
+	return fprintGoConsts(w, comment, consts)
+}
+
+// frameLen returns the length of every frame, or -1 when they differ
+func frameLen(frames [][]byte) int {
+	if len(frames) == 0 {
+		return 0
+	}
+	for _, frame := range frames[1:] {
+		if len(frame) != len(frames[0]) {
+			return -1
+		}
+	}
+	return len(frames[0])
+}
+
+// fprintGoAccessor writes an accessor returning an exported variable along
+// with the constants of fprintGoSize: NameImage() for an image, NameFrame(i)
+// for frame i of an animation
+func fprintGoAccessor(w io.Writer, name string, animated bool) error {
+	if animated {
+		_, err := fmt.Fprintf(w, "\n// %sFrame returns frame i of %s, and its width and height\nfunc %sFrame(i int) ([]byte, int, int) {\n\treturn %s[i], %sWidth, %sHeight\n}\n",
+			name, name, name, name, name, name)
+		return err
 	}
-	_, err = outf.Write([]byte("\n}\n"))
+	_, err := fmt.Fprintf(w, "\n// %sImage returns %s, and its width and height\nfunc %sImage() ([]byte, int, int) {\n\treturn %s, %sWidth, %sHeight\n}\n",
+		name, name, name, name, name, name)
 	return err
 }
 
-// LoadImg loads and decodes filename into image.Image pointer
+// LoadImg loads and decodes filename (or stdin, for "-") into image.Image pointer
 func LoadImg(infile string) (*image.Image, error) {
-	f, err := os.Open(infile)
+	data, err := ReadInput(infile)
+	if err == nil {
+		err = checkEmpty(infile, data)
+	}
 	if err != nil {
 		return nil, err
 	}
-	src, _, err := image.Decode(f)
+	src, err := decodeImg(data)
 	if err != nil {
 		return nil, err
 	}
@@ -191,108 +204,218 @@ func LoadImg(infile string) (*image.Image, error) {
 }
 
 // ImgToBytes resizes an image to the requested size and converts it to a bitmap byte slice
-func ImgToBytes(x, y int, inputImg *image.Image) []byte {
+func (o *Options) ImgToBytes(x, y int, inputImg *image.Image) []byte {
 	// work on values not pointers
-	src := *inputImg
-	// create a new, rectangular image that's the size we want
-	dst := image.NewRGBA(image.Rect(0, 0, x, y))
-	// use NearestNeighbor algo to fit our original image into the smaller (or bigger!?) image
-	draw.NearestNeighbor.Scale(dst, dst.Rect, src, src.Bounds(), draw.Over, nil)
-
-	// Our e-ink display uses one bit for each pixel, on or off.
-	// Therefore, we need one bit for each pixel.
-	// Since we have a byte slice, and 8 bytes per bit, divide by 8
-	imageBits := make([]byte, x*y/8)
-
-	// Again, on or off, white or black are our only color options
-	palette := []color.Color{
-		color.Black,
-		color.White,
+	dst := o.scale(*inputImg, x, y)
+	m := o.timer.mark()
+	o.preprocess(dst)
+	m = o.timer.done(stagePreprocess, m)
+
+	if o.Palette != MonoPalette {
+		// color panels store a code per pixel rather than a single on/off bit
+		if !o.DisableDithering {
+			o.newDitherer(o.Palette.Colors).Dither(dst)
+		}
+		m = o.timer.done(stageDither, m)
+		defer o.timer.done(stagePack, m)
+		return o.Palette.PackPalette(x, y, dst)
 	}
 
-	if disableDithering {
+	// our e-ink display uses one bit for each pixel, on or off
+	dst, err := badgeimg.Monochrome(dst, o.monochrome())
+	if err != nil {
+		// flags are validated up front, this is a programming error
+		panic(err)
+	}
+	m = o.timer.done(stageDither, m)
+	defer o.timer.done(stagePack, m)
+
+	// the screen updates LTR, top to bottom, so the pixels are packed column
+	// by column (see badgeimg.LayoutBadger); BytesToImg reverses this. Every
+	// step after this one reads them so, until layoutBytes repacks them for
+	// -layout.
+	return badgeimg.Pack(x, y, dst, badgeimg.LayoutBadger)
+}
+
+// preprocess applies -invert and -gamma to a scaled image, in place
+func (o *Options) preprocess(dst *image.RGBA) {
+	if o.Invert {
+		if o.Linear {
+			badgeimg.InvertLinear(dst)
+		} else {
+			badgeimg.Invert(dst)
+		}
+	}
+	if o.Linear {
+		badgeimg.GammaLinear(dst, o.Gamma)
+	} else {
+		badgeimg.Gamma(dst, o.Gamma)
+	}
+}
+
+// monochrome returns the options reducing images to black and white
+func (o *Options) monochrome() badgeimg.Options {
+	mono := badgeimg.Options{Dither: o.Dither, Matrix: o.DitherMatrix, Threshold: o.Threshold, Linear: o.Linear, Logger: logger}
+	if o.DisableDithering {
 		// don't dither image if flag is set, useful for some images which are already black and white
+		mono.Dither = "none"
+	}
+	return mono
+}
+
+// ditherMethod describes how images are reduced to the colors of the panel,
+// for -v
+func (o *Options) ditherMethod() string {
+	method := o.monochrome().Method()
+	if o.Palette != MonoPalette {
+		method = fmt.Sprintf("%s, to %d colors", method, len(o.Palette.Colors))
+	}
+	return method
+}
+
+// scale scales src to x by y, and draws the -overlay images onto it
+func (o *Options) scale(src image.Image, x, y int) *image.RGBA {
+	m := o.timer.mark()
+	var dst *image.RGBA
+	if o.Anchor != "" {
+		dst = o.letterbox(src, x, y)
+	} else if vector, ok := src.(rasterizer); ok {
+		// vector images (SVG) are drawn straight at the size we want,
+		// on a white page unless told otherwise
+		page := o.Background
+		if page == nil {
+			page = color.White
+		}
+		dst = vector.Rasterize(x, y, page)
 	} else {
-		// using our palette, create a dithering struct
-		// and dither our image to get some false shading.
-		// read more here: https://en.wikipedia.org/wiki/Floyd%E2%80%93Steinberg_dithering
-		d := dither.NewDitherer(palette)
-		d.Matrix = dither.FloydSteinberg
-		dithered := d.Dither(dst)
-		// this nil check is necessary since the library will often write
-		// the dithered image to dst, but not always. Read their docs for more info
-		if dithered != nil {
-			var ok bool
-			dst, ok = dithered.(*image.RGBA)
-			// docs claim image is guaranteed to be of this type when not nil, but it's good to check anyway
-			if !ok {
-				log.Fatalf("error: typeof dithered should have been `*image.RGBA` but was `%T`", dithered)
-			}
+		dst = badgeimg.Scale(src, x, y, o.Background)
+	}
+	m = o.timer.done(stageScale, m)
+	o.composite(dst)
+	o.timer.done(stagePreprocess, m)
+	return dst
+}
+
+// Ratio is the size of the images a -ratio asks for, in pixels
+type Ratio struct {
+	Width, Height int
+}
+
+func (r Ratio) String() string {
+	return fmt.Sprintf("%dx%d", r.Width, r.Height)
+}
+
+// presetRatios are the ratios -ratio takes by name
+var presetRatios = []struct {
+	name string
+	size Ratio
+}{
+	// profile image is 128x128
+	{"profile", Ratio{120, 128}},
+	// splash image is 246x128
+	{"splash", Ratio{246, 128}},
+}
+
+// ratioSize returns the size of the image -ratio asks for, one of the
+// predefined ratios or a custom one, WxH, or HxW with -transpose
+func (o *Options) ratioSize(ratio string) (Ratio, error) {
+	for _, preset := range presetRatios {
+		if ratio == preset.name {
+			return preset.size, nil
+		}
+	}
+	if ratio == "" {
+		return Ratio{}, classify(badgeimg.ErrBadRatio, errors.New("error: a ratio must be provided."))
+	}
+	r, err := ParseRatio(ratio)
+	if err != nil {
+		return Ratio{}, err
+	}
+	if o.Transpose {
+		r.Width, r.Height = r.Height, r.Width
+	}
+	return r, nil
+}
+
+// warnSwapped warns when ratio, a custom ratio of size r, is a preset ratio
+// turned on its side, which is what giving the height first makes
+func (o *Options) warnSwapped(ratio string, r Ratio) {
+	for _, preset := range presetRatios {
+		if ratio == preset.name || r != (Ratio{preset.size.Height, preset.size.Width}) {
+			continue
+		}
+		hint := fmt.Sprintf("or -transpose if %s is height first", ratio)
+		if o.Transpose {
+			hint = "or leave -transpose out"
 		}
+		logger.Warnf("-ratio %s makes %v images, the %s ratio (%v) turned on its side: ratios are WxH, width first; use -ratio %s, %s", ratio, r, preset.name, preset.size, preset.name, hint)
 	}
+}
 
-	// loop over the x axis first, then y as screen updates LTR, top to bottom
-	// (vertical axis must be inner loop) for the badge layout
-	for i := 0; i < x; i++ {
-		for j := 0; j < y; j++ {
-			// grab dithered image point, determine if bit should be 1 or a 0
-			r, g, b, _ := dst.At(i, j).RGBA()
-			if r+g+b == 0 {
-				// use bit shifting + integer division & modulo arithmetic to change
-				// the individual bits we want to set
-				imageBits[(i*y+j)/8] = imageBits[(i*y+j)/8] | (1 << uint(7-(i*y+j)%8))
-			}
+// listedRatio is one of the ratios listed in -ratio, with its size
+type listedRatio struct {
+	name string
+	x, y int
+}
+
+// ratios returns the ratios listed in -ratio with their size. A single one is
+// x by y, the size the conversion was given; each of a comma-separated list is
+// sized by ratioSize.
+func (o *Options) ratios(x, y int) ([]listedRatio, error) {
+	names := strings.Split(o.Ratio, ",")
+	if len(names) == 1 {
+		return []listedRatio{{o.Ratio, x, y}}, nil
+	}
+	ratios := make([]listedRatio, len(names))
+	for i, name := range names {
+		r, err := o.ratioSize(name)
+		if err != nil {
+			return nil, err
 		}
+		ratios[i] = listedRatio{name, r.Width, r.Height}
 	}
-	return imageBits
+	return ratios, nil
 }
 
-func ParseRatio(rstr string) (int, int, error) {
+// ParseRatio parses a custom ratio, WxH: the width of the image in pixels,
+// then its height, such as 296x128
+func ParseRatio(rstr string) (Ratio, error) {
 	rstr = strings.ToLower(rstr)
 	pixels := strings.Split(rstr, "x")
 	if len(pixels) != 2 {
-		return 0, 0, errors.New("invalid ratio string provided")
+		return Ratio{}, fmt.Errorf("%w string provided", badgeimg.ErrBadRatio)
 	}
 	x, err := strconv.Atoi(pixels[0])
 	if err != nil {
-		return 0, 0, errors.Join(errors.New("error: could not parse x coordinate count"), err)
+		return Ratio{}, classify(badgeimg.ErrBadRatio, errors.Join(errors.New("error: could not parse the width"), err))
 	}
-	y, err := strconv.Atoi(pixels[0])
+	y, err := strconv.Atoi(pixels[1])
 	if err != nil {
-		return 0, 0, errors.Join(errors.New("error: could not parse y coordinate count"), err)
+		return Ratio{}, classify(badgeimg.ErrBadRatio, errors.Join(errors.New("error: could not parse the height"), err))
+	}
+	if x <= 0 || y <= 0 {
+		return Ratio{}, fmt.Errorf("%w %s: the width and height must be positive", badgeimg.ErrBadRatio, rstr)
 	}
-	return x, y, nil
+	return Ratio{x, y}, nil
 }
 
-// Usage prints a proper example of usage for when the user misuses the program.
+// PrintImg prints an `*` for each marked bit of an image packed with layout
 //
-// Usage also calls exit(1) to terminate the program with an error code.
-func Usage() {
-	fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s <input_image>:\n", os.Args[0])
-	flag.PrintDefaults()
-	fmt.Fprintf(
-		flag.CommandLine.Output(),
-		"\nExamples:\n%s input.png -outmode bin -ratio profile\n%s input.jpg -outmode rice -ratio 128x128 -disable-dithering -show\n",
-		os.Args[0],
-		os.Args[0],
-	)
-	os.Exit(1)
+// It writes to stderr so that it doesn't conflict with the base64 output
+func PrintImg(x, y int, imgBits []byte, layout badgeimg.Layout) {
+	FprintImg(os.Stderr, x, y, imgBits, layout)
 }
 
-// PrintImg prints an `*` for each marked bit
-//
-// It writes to stderr so that it doesn't conflict with the base64 output
-func PrintImg(x, y int, imgBits []byte) {
+// FprintImg is PrintImg writing to w
+func FprintImg(w io.Writer, x, y int, imgBits []byte, layout badgeimg.Layout) {
 	for i := 0; i < y; i++ {
 		for j := 0; j < x; j++ {
-			offset := j*y + i
-			bit := imgBits[offset/8] & (1 << uint(7-offset%8))
-			if bit != 0 {
-				fmt.Fprint(os.Stderr, "*")
+			if layout.PixelAt(imgBits, x, y, j, i) {
+				fmt.Fprint(w, "*")
 			} else {
-				fmt.Fprint(os.Stderr, " ")
+				fmt.Fprint(w, " ")
 			}
 		}
-		fmt.Fprint(os.Stderr, "\n")
+		fmt.Fprint(w, "\n")
 	}
 }
@@ -1,20 +1,27 @@
 package main
 
 import (
+	"bytes"
 	_ "embed"
+	"fmt"
+	"go/format"
 	"image"
 	"image/color"
 	"image/png"
+	"io"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
 // This code allows you to re-convert a bitmap variable file back
 
-// must build and run the program first, and generate a splash.bin file using
-// ./gopherbadgeimg splash <image file here>
+// testdata/splash.bin is generated from testdata/tainigo_128.png using
+// ./gopherbadgeimg -outmode bin -ratio splash -o testdata/splash.bin testdata/tainigo_128.png
 
-//go:embed splash.bin
+//go:embed testdata/splash.bin
 var tainigo []byte
 
 func TestMain(t *testing.T) {
@@ -38,3 +45,202 @@ func decodeToPng() {
 	}
 	png.Encode(outPng, dst)
 }
+
+// fprintGoPerByte is how FprintGo wrote files before it was buffered: one
+// Write per byte literal, and one per line break
+func fprintGoPerByte(w io.Writer, header, pkg, name string, imageBits []byte) error {
+	if _, err := w.Write([]byte(header + "package " + pkg + "\n\nvar " + name + " = []byte{")); err != nil {
+		return err
+	}
+	for i, b := range imageBits {
+		if i%32 == 0 {
+			if _, err := w.Write([]byte("\n\t")); err != nil {
+				return err
+			}
+		}
+		if _, err := w.Write([]byte(fmt.Sprintf("0x%02X, ", b))); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte("\n}\n"))
+	return err
+}
+
+func TestFprintGo(t *testing.T) {
+	data := make([]byte, 70)
+	for i := range data {
+		data[i] = byte(i * 37)
+	}
+	var buf bytes.Buffer
+	if err := FprintGo(&buf, "// header\n\n", "assets", "rlogo", data); err != nil {
+		t.Fatal(err)
+	}
+	golden, err := os.ReadFile("testdata/fprintgo.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != string(golden) {
+		t.Errorf("expected\n%s\ngot\n%s", golden, buf.Bytes())
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for _, n := range []int{0, 1, 31, 32, 33, 3936} {
+		data := make([]byte, n)
+		rng.Read(data)
+		var got, want bytes.Buffer
+		if err := FprintGo(&got, "", "main", "rimg", data); err != nil {
+			t.Fatal(err)
+		}
+		if err := fprintGoPerByte(&want, "", "main", "rimg", data); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want.String() {
+			t.Errorf("%d bytes: expected the output of the unbuffered version\n%s\ngot\n%s", n, want.Bytes(), got.Bytes())
+		}
+	}
+
+	// WriteToGoFile writes the same along with the length and layout,
+	// formatted with gofmt
+	path := filepath.Join(t.TempDir(), "logo.go")
+	if err := WriteToGoFile(path, "logo", data); err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := FprintGo(&buf, (&Options{}).generatedHeader("//", "", "."), "main", "rlogo", data); err != nil {
+		t.Fatal(err)
+	}
+	if err := fprintGoPacking(&buf, "rlogo", len(data), "badger", "msb-first"); err != nil {
+		t.Fatal(err)
+	}
+	want, err := format.Source(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, want) {
+		t.Errorf("expected the gofmt-ed output of FprintGo\n%s\ngot\n%s", want, written)
+	}
+}
+
+// BenchmarkFprintGo writes the Go file of a splash image to a file, with a
+// Write per byte literal as FprintGo used to, and in a single one
+func BenchmarkFprintGo(b *testing.B) {
+	data := make([]byte, 246*128/8)
+	rand.New(rand.NewSource(1)).Read(data)
+	for _, bench := range []struct {
+		name  string
+		print func(w io.Writer, header, pkg, name string, imageBits []byte) error
+	}{
+		{"per-byte", fprintGoPerByte},
+		{"buffered", FprintGo},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			f, err := os.Create(filepath.Join(b.TempDir(), "splash.go"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			for n := 0; n < b.N; n++ {
+				if _, err := f.Seek(0, io.SeekStart); err != nil {
+					b.Fatal(err)
+				}
+				if err := bench.print(f, "", "main", "rsplash", data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseRatioNonSquare(t *testing.T) {
+	r, err := ParseRatio("16x8")
+	if err != nil || r != (Ratio{16, 8}) {
+		t.Fatalf("expected 16x8, got %v, %v", r, err)
+	}
+	var img image.Image = image.NewRGBA(image.Rect(0, 0, 32, 16))
+	if got := len(NewOptions().ImgToBytes(r.Width, r.Height, &img)); got != 16*8/8 {
+		t.Errorf("expected 16x8 to pack to %d bytes, got %d", 16*8/8, got)
+	}
+}
+
+func TestParseRatio(t *testing.T) {
+	for _, test := range []struct {
+		ratio string
+		want  Ratio
+	}{
+		{"296x128", Ratio{296, 128}},
+		{"16X8", Ratio{16, 8}},
+		{"128x246", Ratio{128, 246}},
+	} {
+		if got, err := ParseRatio(test.ratio); err != nil || got != test.want {
+			t.Errorf("%s: expected %v, got %v, %v", test.ratio, test.want, got, err)
+		}
+	}
+	for _, ratio := range []string{"296", "296x", "x128", "296x128x1", "-8x8", "8x-8", "0x0", "16x0"} {
+		if _, err := ParseRatio(ratio); err == nil {
+			t.Errorf("%s: expected an error", ratio)
+		}
+	}
+}
+
+func TestTranspose(t *testing.T) {
+	dir := t.TempDir()
+	// a 2x2 checkerboard, black at the top left, which reads differently
+	// once transposed
+	src := filepath.Join(dir, "board.png")
+	writeCheckerboard(t, src, 32, 32, 2, 2)
+	convert := func(name string, args ...string) (string, []byte) {
+		t.Helper()
+		out := filepath.Join(dir, name)
+		args = append([]string{"-outmode", "bin", "-disable-dithering", "-o", out}, args...)
+		code, _, errOut := runCLI(t, append(args, src)...)
+		if code != 0 {
+			t.Fatalf("%v: exit code %d: %s", args, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return errOut, data
+	}
+
+	_, wide := convert("wide.bin", "-ratio", "32x16")
+	_, tall := convert("tall.bin", "-ratio", "16x32")
+	if bytes.Equal(wide, tall) {
+		t.Fatal("expected 32x16 and 16x32 to pack differently")
+	}
+	// the width comes first, so that 32x16 is 32 columns of 16 pixels
+	if !bitAt(16, 0, 7, wide) || bitAt(16, 0, 8, wide) || bitAt(16, 16, 7, wide) || !bitAt(16, 31, 8, wide) {
+		t.Errorf("expected 32x16 to be packed as 32 columns of 16 pixels, got % x", wide)
+	}
+	if _, got := convert("transposed.bin", "-ratio", "16x32", "-transpose"); !bytes.Equal(got, wide) {
+		t.Errorf("expected -transpose to read 16x32 as 32x16\n% x\ngot\n% x", wide, got)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-ratio", "128x246"}, "-ratio 128x246 makes 128x246 images, the splash ratio (246x128) turned on its side: ratios are WxH, width first; use -ratio splash, or -transpose if 128x246 is height first"},
+		{[]string{"-ratio", "profile,128x120"}, "the profile ratio (120x128) turned on its side"},
+		{[]string{"-ratio", "246x128", "-transpose"}, "use -ratio splash, or leave -transpose out"},
+		{[]string{"-ratio", "246x128"}, ""},
+		{[]string{"-ratio", "128x246", "-transpose"}, ""},
+	} {
+		args := append([]string{"-outmode", "none"}, test.args...)
+		code, _, errOut := runCLI(t, append(args, src)...)
+		// 128x246 isn't made of whole columns of bytes either, which is
+		// only an error after the warning
+		switch {
+		case test.want == "" && code != 0:
+			t.Errorf("%v: exit code %d: %s", test.args, code, errOut)
+		case test.want == "" && strings.Contains(errOut, "turned on its side"):
+			t.Errorf("%v: expected no warning, got %s", test.args, errOut)
+		case !strings.Contains(errOut, test.want):
+			t.Errorf("%v: expected %q, got %s", test.args, test.want, errOut)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// ManifestVersion is the version of the manifest schema. It changes when a
+// field is renamed, removed or changes meaning, not when one is added.
+const ManifestVersion = 1
+
+// Manifest is the JSON document written by -manifest. Fields are always
+// written in the order they are declared in, indented with two spaces, so
+// that manifests of the same conversion are byte for byte identical.
+type Manifest struct {
+	// Version is ManifestVersion
+	Version int `json:"version"`
+	// Tool is the version of gopherbadgeimg that wrote the manifest
+	Tool string `json:"tool"`
+	// Images holds one entry per converted input, in the order they were
+	// given in. Inputs that failed are left out.
+	Images []*ManifestImage `json:"images"`
+}
+
+// ManifestImage describes the conversion of a single input
+type ManifestImage struct {
+	// Source is the input as named on the command line, "archive:entry" for
+	// images read from an archive and "-" for stdin
+	Source string `json:"source"`
+	// SourceSHA256 is the hex SHA-256 of the input file
+	SourceSHA256 string `json:"source_sha256"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	Frames       int    `json:"frames"`
+	// Delays are how long each frame is shown in milliseconds, animations
+	// only
+	Delays []int `json:"delays,omitempty"`
+	// Bytes is the size of one packed frame, before compression
+	Bytes int `json:"bytes"`
+	// Layout is the order pixels are packed in, one of badgeimg.LayoutNames:
+	// the -layout black and white images were packed with, or the layout of
+	// palette codes, or planes- followed by the -planes the bit planes were
+	// arranged by
+	Layout string `json:"layout"`
+	// BitOrder is msb-first, the first pixel being in the highest bits of a
+	// byte, unless -layout says lsb-first
+	BitOrder     string `json:"bit_order"`
+	BitsPerPixel int    `json:"bits_per_pixel"`
+	Palette      string `json:"palette"`
+	// Dither is the dithering algorithm, matrix with -dither-matrix, none,
+	// threshold with -threshold, or otsu with -threshold auto, whose threshold
+	// differs from one image to the next
+	Dither string `json:"dither"`
+	// Threshold is the -threshold black and white images were cut at
+	Threshold int `json:"threshold,omitempty"`
+	// Background is the color transparent pixels were composited onto, as
+	// #rrggbb, if one was set
+	Background string `json:"background,omitempty"`
+	// Invert is set when the colors were inverted with -invert
+	Invert bool `json:"invert,omitempty"`
+	// Linear is set when -threshold, -invert and -gamma worked in linear
+	// light
+	Linear bool `json:"linear,omitempty"`
+	// Gamma is the -gamma applied to the images, if it isn't 1
+	Gamma float64 `json:"gamma,omitempty"`
+	// Anchor is where -anchor placed letterboxed images, if they were
+	Anchor  string `json:"anchor,omitempty"`
+	OutMode string `json:"outmode"`
+	// Compress is none or rle
+	Compress string `json:"compress"`
+	// DataSHA256 is the hex SHA-256 of the packed frames, one after the other
+	// and before compression, whatever the output format. The bit planes of
+	// -planes separate are hashed as -planes concat packs them.
+	DataSHA256 string `json:"data_sha256"`
+	// Region is where the image goes on the display, with -region
+	Region *ManifestRegion `json:"region,omitempty"`
+	// Stats counts the pixels on, with -stats
+	Stats *Stats `json:"stats,omitempty"`
+	// Timings are what each stage of the conversion took, with -timings.
+	// They differ from one run to the next.
+	Timings []StageTiming `json:"timings,omitempty"`
+	// Outputs are the files written. Outputs written to stdout aren't listed.
+	Outputs []ManifestOutput `json:"outputs"`
+}
+
+// ManifestRegion is the offset of a window of the display converted with
+// -region, in pixels
+type ManifestRegion struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// ManifestOutput is a file written by a conversion
+type ManifestOutput struct {
+	// Path is the path of the file with forward slashes
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+	// CRC32 is the hex CRC32 (IEEE) of the file, with -checksum
+	CRC32 string `json:"crc32,omitempty"`
+	Bytes int64  `json:"bytes"`
+}
+
+// manifestImage describes the conversion of in, whose packed frames were
+// written to the files in written, and counted in stats with -stats
+func (o *Options) manifestImage(in Input, data []byte, x, y int, frames [][]byte, delays []int, written []string, stats *Stats) (*ManifestImage, error) {
+	frames = o.writtenFrames(x, y, frames)
+	img := &ManifestImage{
+		Source:       in.Path,
+		SourceSHA256: sha256Hex(data),
+		Width:        x,
+		Height:       y,
+		Frames:       len(frames),
+		Bytes:        len(frames[0]),
+		Layout:       o.layoutName(),
+		BitOrder:     o.bitOrderName(),
+		BitsPerPixel: o.Palette.Depth,
+		Palette:      o.Palette.Name,
+		Dither:       o.Dither,
+		Invert:       o.Invert,
+		Linear:       o.Linear,
+		Anchor:       o.Anchor,
+		OutMode:      o.OutMode,
+		Compress:     "none",
+		DataSHA256:   sha256Hex(bytes.Join(frames, nil)),
+		Stats:        stats,
+		Timings:      o.timer.timings(),
+		Outputs:      []ManifestOutput{},
+	}
+	if len(frames) > 1 {
+		img.Delays = delays
+	}
+	if o.DitherMatrix != nil {
+		img.Dither = "matrix"
+	}
+	if o.DisableDithering {
+		img.Dither = "none"
+	}
+	switch {
+	case o.Threshold == badgeimg.ThresholdAuto && o.Palette == MonoPalette:
+		img.Dither = "otsu"
+	case o.Threshold > 0 && o.Palette == MonoPalette:
+		img.Dither, img.Threshold = "threshold", o.Threshold
+	}
+	if o.Gamma != 1 {
+		img.Gamma = o.Gamma
+	}
+	if o.Background != nil {
+		c := color.NRGBAModel.Convert(o.Background).(color.NRGBA)
+		img.Background = fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	if o.Compress != "" {
+		img.Compress = o.Compress
+	}
+	if o.Region != "" {
+		r, err := parseRegion(o.Region)
+		if err != nil {
+			return nil, err
+		}
+		img.Region = &ManifestRegion{X: r.Min.X, Y: r.Min.Y}
+	}
+	for _, path := range written {
+		// read back, so the hash is of what ended up on disk
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		out := ManifestOutput{
+			Path:   filepath.ToSlash(path),
+			SHA256: sha256Hex(content),
+			Bytes:  int64(len(content)),
+		}
+		if o.Checksum != "" {
+			out.CRC32 = fmt.Sprintf("%08x", crc32.ChecksumIEEE(content))
+		}
+		img.Outputs = append(img.Outputs, out)
+	}
+	return img, nil
+}
+
+// writeManifest writes the manifest of images to path, "-" being stdout.
+// Nil entries, the inputs that failed, are left out.
+func (o *Options) writeManifest(path string, images []*ManifestImage) error {
+	manifest := Manifest{
+		Version: ManifestVersion,
+		Tool:    toolVersion(),
+		Images:  []*ManifestImage{},
+	}
+	for _, img := range images {
+		if img != nil {
+			manifest.Images = append(manifest.Images, img)
+		}
+	}
+	out, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	out = append(out, '\n')
+	if path == stdinName {
+		_, err = stdout.Write(out)
+		return classify(badgeimg.ErrWrite, err)
+	}
+	return o.writeFile(path, func(w io.Writer) error {
+		_, err := w.Write(out)
+		return err
+	})
+}
+
+// writtenFrames returns frames, x by y images packed for the badge, as they
+// are written: repacked with -layout, or their planes arranged by -planes
+func (o *Options) writtenFrames(x, y int, frames [][]byte) [][]byte {
+	if o.Palette.Planes != "" {
+		return o.arrangedFrames(x, y, frames)
+	}
+	return o.layoutFrames(x, y, frames)
+}
+
+// sha256Hex returns the hex SHA-256 of data
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
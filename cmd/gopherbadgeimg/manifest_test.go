@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readManifest unmarshals the manifest at path, rejecting unknown fields so
+// the test notices fields it doesn't check
+func readManifest(t *testing.T, path string) (Manifest, []byte) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&manifest); err != nil {
+		t.Fatalf("invalid manifest: %v\n%s", err, data)
+	}
+	if manifest.Version != ManifestVersion || manifest.Tool != toolVersion() {
+		t.Errorf("expected version %d by %q, got %d by %q", ManifestVersion, toolVersion(), manifest.Version, manifest.Tool)
+	}
+	return manifest, data
+}
+
+// checkOutputs verifies the outputs listed for img against the files on disk
+func checkOutputs(t *testing.T, img *ManifestImage) {
+	t.Helper()
+	for _, out := range img.Outputs {
+		data, err := os.ReadFile(filepath.FromSlash(out.Path))
+		if err != nil {
+			t.Errorf("%s: %v", img.Source, err)
+			continue
+		}
+		if out.Bytes != int64(len(data)) || out.SHA256 != sha256Hex(data) {
+			t.Errorf("%s: expected %s to be %d bytes with hash %s, got %d bytes with hash %s",
+				img.Source, out.Path, out.Bytes, out.SHA256, len(data), sha256Hex(data))
+		}
+	}
+}
+
+func TestManifestBatch(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for name, data := range map[string][]byte{
+		"alice.png":  png,
+		"bob.png":    png,
+		"broken.png": []byte("this is not an image"),
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.Compress = "bin", "profile", "rle"
+	opts.Manifest = filepath.Join(dir, "manifest.json")
+	converted, failed := opts.ConvertAll([]string{filepath.Join(dir, "*.png")}, 120, 128)
+	if converted != 2 || len(failed) != 1 {
+		t.Fatalf("expected 2 converted and 1 failed, got %d and %d", converted, len(failed))
+	}
+
+	manifest, first := readManifest(t, opts.Manifest)
+	if len(manifest.Images) != 2 {
+		t.Fatalf("expected the broken image to be left out, got %d entries", len(manifest.Images))
+	}
+	for i, name := range []string{"alice", "bob"} {
+		img := manifest.Images[i]
+		if want := filepath.Join(dir, name+".png"); img.Source != want {
+			t.Errorf("expected entry %d to be %s, got %s", i, want, img.Source)
+		}
+		if img.SourceSHA256 != sha256Hex(png) {
+			t.Errorf("%s: wrong source hash %s", name, img.SourceSHA256)
+		}
+		if img.Width != 120 || img.Height != 128 || img.Frames != 1 || img.Delays != nil || img.Bytes != 120*128/8 {
+			t.Errorf("%s: expected a single 120x128 frame of %d bytes, got %+v", name, 120*128/8, img)
+		}
+		if img.Layout != "badger" || img.BitOrder != "msb-first" || img.BitsPerPixel != 1 || img.Palette != "mono" {
+			t.Errorf("%s: wrong packing %s/%s/%d/%s", name, img.Layout, img.BitOrder, img.BitsPerPixel, img.Palette)
+		}
+		if img.Dither != "floyd-steinberg" || img.Background != "" || img.OutMode != "bin" || img.Compress != "rle" {
+			t.Errorf("%s: wrong settings %s/%q/%s/%s", name, img.Dither, img.Background, img.OutMode, img.Compress)
+		}
+		want := filepath.ToSlash(filepath.Join(dir, name+"-profile.rle.bin"))
+		if len(img.Outputs) != 1 || img.Outputs[0].Path != want {
+			t.Fatalf("%s: expected %s as the only output, got %+v", name, want, img.Outputs)
+		}
+		checkOutputs(t, img)
+
+		// the data hash is of the packed image, before compression
+		compressed, err := os.ReadFile(filepath.FromSlash(img.Outputs[0].Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum := sha256Hex(DecodeRLE(make([]byte, img.Bytes), compressed)); img.DataSHA256 != sum {
+			t.Errorf("%s: expected data hash %s, got %s", name, sum, img.DataSHA256)
+		}
+	}
+
+	// converting again gives the very same manifest, so it diffs cleanly
+	opts.Jobs = 1
+	opts.ConvertAll([]string{filepath.Join(dir, "*.png")}, 120, 128)
+	if _, again := readManifest(t, opts.Manifest); !bytes.Equal(first, again) {
+		t.Errorf("expected the manifest to be the same every time, got\n%s\nthen\n%s", first, again)
+	}
+}
+
+func TestManifestAnimation(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio = "rice", "8x8"
+	opts.DisableDithering, opts.Compress = true, "rle"
+	opts.Background = MonoPalette.Colors[1]
+	opts.Output = filepath.Join(dir, "anim.go")
+	opts.Manifest = filepath.Join(dir, "manifest.json")
+	if converted, failed := opts.ConvertAll([]string{"testdata/restore-background.gif"}, 8, 8); converted != 1 || len(failed) != 0 {
+		t.Fatalf("expected the animation to convert, got %d converted and %d failed", converted, len(failed))
+	}
+
+	manifest, _ := readManifest(t, opts.Manifest)
+	if len(manifest.Images) != 1 {
+		t.Fatalf("expected one entry, got %d", len(manifest.Images))
+	}
+	img := manifest.Images[0]
+	frames, err := opts.LoadFrames("testdata/restore-background.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Frames != len(frames) || len(img.Delays) != len(frames) || img.Bytes != 8 {
+		t.Errorf("expected %d frames of 8 bytes with their delays, got %+v", len(frames), img)
+	}
+	packed := make([]byte, 0, len(frames)*8)
+	for i, frame := range frames {
+		if img.Delays[i] != frame.Delay {
+			t.Errorf("expected delay %d of frame %d, got %d", frame.Delay, i, img.Delays[i])
+		}
+		packed = append(packed, opts.ImgToBytes(8, 8, &frame.Image)...)
+	}
+	if img.DataSHA256 != sha256Hex(packed) {
+		t.Errorf("expected data hash %s, got %s", sha256Hex(packed), img.DataSHA256)
+	}
+	if img.Dither != "none" || img.Background != "#ffffff" || img.OutMode != "rice" || img.Compress != "rle" {
+		t.Errorf("wrong settings %s/%q/%s/%s", img.Dither, img.Background, img.OutMode, img.Compress)
+	}
+	// the Go file and the decoder it needs
+	want := []string{filepath.ToSlash(opts.Output), filepath.ToSlash(filepath.Join(dir, "rle-generated.go"))}
+	if len(img.Outputs) != len(want) {
+		t.Fatalf("expected outputs %v, got %+v", want, img.Outputs)
+	}
+	for i := range want {
+		if img.Outputs[i].Path != want[i] {
+			t.Errorf("expected output %d to be %s, got %s", i, want[i], img.Outputs[i].Path)
+		}
+	}
+	checkOutputs(t, img)
+}
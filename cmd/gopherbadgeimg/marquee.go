@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// -marquee converts a banner wider than the display, for firmware that scrolls
+// it across: an image is scaled to the height of -ratio keeping its aspect
+// ratio, as wide as that makes it, and -text is drawn as wide as it needs.
+// The banner is written whole, unless -marquee-step slices it into windows
+// the width of the display, that many pixels apart, written as the frames of
+// a sheet. It is dithered as a whole first, so that overlapping windows have
+// the same pixels where they overlap.
+//
+// -marquee-wrap loops the banner seamlessly: the windows run past its end into
+// its start again, and the whole banner gets its first window appended, so
+// that scrolling it to its width shows the start exactly as it began.
+
+// marqueeOffsets returns the columns of a w pixels wide banner at which the
+// windows of an x pixels wide display start, step pixels apart. Without
+// wrap, the last window is the last that fits in the banner whole; with
+// wrap, windows start anywhere on the banner, the ones running past its end
+// going on with its start, and the first window isn't repeated at the end.
+func marqueeOffsets(w, x, step int, wrap bool) []int {
+	end := w - x + 1
+	if wrap {
+		end = w
+	}
+	var offsets []int
+	for off := 0; off < end; off += step {
+		offsets = append(offsets, off)
+	}
+	return offsets
+}
+
+// bannerWidth returns the width of the banner src is scaled to, y pixels high,
+// padded for the palette
+func (o *Options) bannerWidth(src image.Image, y int) int {
+	b := src.Bounds()
+	w := max(1, int(math.Round(float64(b.Dx())*float64(y)/float64(b.Dy()))))
+	w, _ = o.Palette.Pad(w, y)
+	return w
+}
+
+// marquee converts src into the banner of -marquee for an x by y display. It
+// returns the banner, or its windows with -marquee-step, and their width.
+func (o *Options) marquee(src image.Image, x, y int) ([][]byte, int, error) {
+	w := o.bannerWidth(src, y)
+	banner := o.ImgToBytes(w, y, &src)
+	if o.MarqueeStep == 0 {
+		if o.MarqueeWrap {
+			return [][]byte{o.bannerWindow(banner, w, y, 0, w+x)}, w + x, nil
+		}
+		return [][]byte{banner}, w, nil
+	}
+	if w < x && !o.MarqueeWrap {
+		return nil, 0, fmt.Errorf("error: the banner is %dx%d, narrower than the %dx%d display, so it has nothing to scroll: use -marquee-wrap to loop it", w, y, x, y)
+	}
+	offsets := marqueeOffsets(w, x, o.MarqueeStep, o.MarqueeWrap)
+	logger.Debugf("marquee: a %dx%d banner, %d windows %d pixels apart", w, y, len(offsets), o.MarqueeStep)
+	windows := make([][]byte, len(offsets))
+	for i, off := range offsets {
+		windows[i] = o.bannerWindow(banner, w, y, off, x)
+	}
+	return windows, x, nil
+}
+
+// bannerWindow returns the x columns of banner, a w by y image, starting at
+// column off, going on with its start past its end
+func (o *Options) bannerWindow(banner []byte, w, y, off, x int) []byte {
+	p := o.Palette
+	window := make([]byte, x*y*p.Depth/8)
+	for i := range x {
+		for j := range y {
+			p.setCode(x, y, i, j, p.CodeAt(w, y, (off+i)%w, j, banner), window)
+		}
+	}
+	return window
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMarqueeOffsets(t *testing.T) {
+	for _, test := range []struct {
+		w, x, step int
+		wrap       bool
+		want       []int
+	}{
+		{128, 32, 8, false, []int{0, 8, 16, 24, 32, 40, 48, 56, 64, 72, 80, 88, 96}},
+		// the last window is the last that fits whole
+		{100, 32, 30, false, []int{0, 30, 60}},
+		{32, 32, 8, false, []int{0}},
+		// wrapping, windows start anywhere on the banner
+		{128, 32, 32, true, []int{0, 32, 64, 96}},
+		{100, 32, 30, true, []int{0, 30, 60, 90}},
+		{16, 32, 8, true, []int{0, 8}},
+	} {
+		if got := marqueeOffsets(test.w, test.x, test.step, test.wrap); !slices.Equal(got, test.want) {
+			t.Errorf("%d wide for %d, %d apart, wrap %v: expected %v, got %v", test.w, test.x, test.step, test.wrap, test.want, got)
+		}
+	}
+}
+
+// column returns column i of an x by y image packed for the badge
+func column(data []byte, y, i int) []byte {
+	return data[i*y/8 : (i+1)*y/8]
+}
+
+func TestMarquee(t *testing.T) {
+	dir := t.TempDir()
+	// scaled to 32 pixels high, the banner is 128 pixels wide
+	sheet := filepath.Join(dir, "banner.png")
+	writeCheckerboard(t, sheet, 64, 16, 8, 3)
+
+	out := filepath.Join(dir, "banner.bin")
+	if code, _, errOut := runCLI(t, "-marquee", "-outmode", "bin", "-ratio", "32x32", "-threshold", "128", "-o", out, sheet); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	banner, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(banner) != 128*32/8 {
+		t.Fatalf("expected a 128x32 banner, got %d bytes", len(banner))
+	}
+
+	// adjacent windows overlap by all but step columns, and every window is
+	// the banner's own columns
+	outdir := filepath.Join(dir, "windows")
+	for _, wrap := range []bool{false, true} {
+		args := []string{"-marquee", "-marquee-step", "24", "-outmode", "bin", "-ratio", "32x32", "-threshold", "128", "-outdir", outdir}
+		want := 5
+		if wrap {
+			args, want = append(args, "-marquee-wrap"), 6
+		}
+		os.RemoveAll(outdir)
+		if code, _, errOut := runCLI(t, append(args, sheet)...); code != 0 {
+			t.Fatalf("wrap %v: expected exit code 0, got %d and\n%s", wrap, code, errOut)
+		}
+		paths, err := filepath.Glob(filepath.Join(outdir, "32x32-*.bin"))
+		if err != nil || len(paths) != want {
+			t.Fatalf("wrap %v: expected %d windows, got %v", wrap, want, paths)
+		}
+		var windows [][]byte
+		for _, path := range paths {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			windows = append(windows, data)
+		}
+		for i, window := range windows {
+			for c := range 32 {
+				if got, want := column(window, 32, c), column(banner, 32, (i*24+c)%128); string(got) != string(want) {
+					t.Fatalf("wrap %v: column %d of window %d isn't column %d of the banner", wrap, c, i, (i*24+c)%128)
+				}
+			}
+			if i > 0 && string(window[:8*32/8]) != string(windows[i-1][24*32/8:]) {
+				t.Errorf("wrap %v: expected window %d to start where window %d ends", wrap, i, i-1)
+			}
+		}
+	}
+
+	// wrapped, the whole banner gets its first window appended
+	loop := filepath.Join(dir, "loop.bin")
+	if code, _, errOut := runCLI(t, "-marquee", "-marquee-wrap", "-outmode", "bin", "-ratio", "32x32", "-threshold", "128", "-o", loop, sheet); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	looped, err := os.ReadFile(loop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(looped) != string(banner)+string(banner[:32*32/8]) {
+		t.Errorf("expected the banner followed by its first window, got %d bytes", len(looped))
+	}
+
+	// a slideshow of the windows
+	slides := filepath.Join(dir, "slides.bin")
+	if code, _, errOut := runCLI(t, "-marquee", "-marquee-step", "32", "-outmode", "slideshow", "-ratio", "32x32", "-o", slides, sheet); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	data, err := os.ReadFile(slides)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := binary.LittleEndian.Uint16(data[8:]); n != 4 {
+		t.Errorf("expected 4 slides, got %d", n)
+	}
+
+	// text is drawn as wide as it needs
+	textOut := filepath.Join(dir, "text.bin")
+	if code, _, errOut := runCLI(t, "-marquee", "-text", "HELLO MY NAME IS", "-outmode", "bin", "-ratio", "32x32", "-o", textOut); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	// 16 characters of 7 pixels, and a margin of 8 pixels on either side
+	if info, err := os.Stat(textOut); err != nil || info.Size() < 16*7*32/8 {
+		t.Errorf("expected a banner wider than the text, got %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"-marquee-step", "8"},
+		{"-marquee", "-marquee-step", "-8"},
+		{"-marquee", "-grid", "2x2"},
+		{"-marquee", "-outmode", "slideshow"},
+	} {
+		args = append([]string{"-outmode", "bin", "-ratio", "32x32"}, args...)
+		if code, _, errOut := runCLI(t, append(args, sheet)...); code != exitUsage || !strings.Contains(errOut, "error: ") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+	narrow := filepath.Join(dir, "narrow.png")
+	writeCheckerboard(t, narrow, 8, 16, 2, 2)
+	code, _, errOut := runCLI(t, "-marquee", "-marquee-step", "8", "-outmode", "none", "-ratio", "32x32", narrow)
+	if want := "the banner is 16x32, narrower than the 32x32 display"; code == 0 || !strings.Contains(errOut, want) {
+		t.Errorf("expected %q, got %d and\n%s", want, code, errOut)
+	}
+}
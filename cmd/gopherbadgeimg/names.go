@@ -0,0 +1,137 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// The inputs of a batch can end up with the same names once they are turned
+// into paths and identifiers: logo.png and logo.jpg are both written as
+// logo-splash, and café.png and cafè.png both declare rcaf___splash, which
+// only fails when the package is compiled. Before anything is converted,
+// every input claims the names its outputs take, in order:
+//
+//	the output files it writes, without extension
+//	the variables of rice mode and -embed files, in the directory they are
+//	written to, which is their package
+//	its keys in a -bundle, and the constants named after them
+//
+// An input claiming a name an earlier one took is renamed with a numeric
+// suffix, logo_2 then logo_3, until its names are free, with a warning, so
+// that it is written as logo_2-splash declaring rlogo_2_splash. With
+// -strict-names it fails instead, as do rows of -batch-file naming their
+// output, which isn't renamed behind their back.
+
+// nameClaim is a name an input takes: key, unique across the whole batch,
+// and the error of taking it again, given the input that took it first
+type nameClaim struct {
+	key   string
+	clash func(owner Input) string
+}
+
+// nameClaims returns the names in takes when converted with opts
+func (o *Options) nameClaims(in Input, opts *Options) []nameClaim {
+	var claims []nameClaim
+	if o.Bundle != "" {
+		// bundled inputs write nothing of their own
+		for _, key := range opts.bundleKeys(in) {
+			claims = append(claims,
+				nameClaim{"bundle\x00" + key, func(owner Input) string {
+					return fmt.Sprintf("%s would be bundled as %s, like %s", in, key, owner)
+				}},
+				nameClaim{"bundle const\x00" + bundleConstName(key), func(owner Input) string {
+					return fmt.Sprintf("%s would declare %sWidth in the bundle, like %s", in, bundleConstName(key), owner)
+				}},
+			)
+		}
+		return claims
+	}
+	if !writesFiles(opts.OutMode) {
+		return nil
+	}
+	ratios := strings.Split(opts.Ratio, ",")
+	for _, ratio := range ratios {
+		single := opts
+		if len(ratios) > 1 {
+			single = opts.withRatio(ratio)
+		}
+		base := filepath.Clean(single.outputBase(in))
+		// rows of -batch-file may name their output
+		output := filepath.Clean(cmp.Or(single.Output, base))
+		claims = append(claims, nameClaim{"output\x00" + output, func(owner Input) string {
+			return fmt.Sprintf("output %s is already written by %s", output, owner)
+		}})
+		var variable string
+		switch {
+		case single.hasOutMode("rice"):
+			variable = single.goVarName(base)
+		case single.Embed:
+			variable = single.embedVarName(base)
+		default:
+			continue
+		}
+		dir := filepath.Dir(output)
+		claims = append(claims, nameClaim{"go\x00" + dir + "\x00" + variable, func(owner Input) string {
+			return fmt.Sprintf("%s would declare %s in %s, like %s", in, variable, dir, owner)
+		}})
+	}
+	return claims
+}
+
+// claimNames returns inputs, those claiming a name an earlier one took
+// renamed as described above, along with an error for each input that can't
+// be converted under a name of its own
+func (o *Options) claimNames(inputs []Input) ([]Input, []error) {
+	inputs = append([]Input(nil), inputs...)
+	errs := make([]error, len(inputs))
+	owners := make(map[string]int, len(inputs))
+	for i, in := range inputs {
+		opts := cmp.Or(in.Options, o)
+		claims := o.nameClaims(in, opts)
+		clash := firstClash(claims, owners, inputs)
+		if clash == "" {
+			claim(claims, owners, i)
+			continue
+		}
+		// a lone input, or an output named on purpose, has nothing to rename
+		if o.StrictNames || in.Name == "" || opts.Output != "" {
+			errs[i] = classify(badgeimg.ErrWrite, errors.New(clash))
+			continue
+		}
+		renamed := in
+		for n := 2; ; n++ {
+			renamed.Name = fmt.Sprintf("%s_%d", in.Name, n)
+			claims = o.nameClaims(renamed, opts)
+			if firstClash(claims, owners, inputs) == "" {
+				break
+			}
+		}
+		logger.Warnf("%s is renamed %s: %s (-strict-names fails instead)", in, filepath.Base(renamed.Name), clash)
+		inputs[i] = renamed
+		claim(claims, owners, i)
+	}
+	return inputs, errs
+}
+
+// firstClash describes the first of claims already owned by one of inputs,
+// or returns "" when none is
+func firstClash(claims []nameClaim, owners map[string]int, inputs []Input) string {
+	for _, c := range claims {
+		if owner, ok := owners[c.key]; ok {
+			return c.clash(inputs[owner])
+		}
+	}
+	return ""
+}
+
+// claim records that input i owns claims
+func claim(claims []nameClaim, owners map[string]int, i int) {
+	for _, c := range claims {
+		owners[c.key] = i
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestClaimNames(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"logo.png", "logo.jpg", "café.png", "cafè.png"} {
+		writeCheckerboard(t, filepath.Join(dir, name), 16, 16, 2, 2)
+	}
+
+	// logo.png and logo.jpg are both written as logo-16x16
+	code, _, errOut := runCLI(t, "-outmode", "rice", "-ratio", "16x16", filepath.Join(dir, "logo.png"), filepath.Join(dir, "logo.jpg"))
+	if code != 0 || !strings.Contains(errOut, filepath.Join(dir, "logo")+" is renamed logo_2: output "+filepath.Join(dir, "logo-16x16")+" is already written by") {
+		t.Fatalf("expected the second logo to be renamed, got %d: %s", code, errOut)
+	}
+	for _, name := range []string{"logo-16x16-generated.go", "logo_2-16x16-generated.go"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to be written: %v", name, err)
+		}
+	}
+
+	// café.png and cafè.png are written to files of their own, declaring the
+	// same variable
+	varDecl := regexp.MustCompile(`var (\w+) = `)
+	code, _, errOut = runCLI(t, "-outmode", "rice", "-ratio", "16x16", filepath.Join(dir, "café.png"), filepath.Join(dir, "cafè.png"))
+	if code != 0 || !strings.Contains(errOut, "is renamed cafè_2") || !strings.Contains(errOut, "would declare r") {
+		t.Fatalf("expected cafè to be renamed, got %d: %s", code, errOut)
+	}
+	var vars []string
+	for _, name := range []string{"café-16x16-generated.go", "cafè_2-16x16-generated.go"} {
+		content, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := varDecl.FindSubmatch(content)
+		if m == nil {
+			t.Fatalf("expected %s to declare a variable, got\n%s", name, content)
+		}
+		vars = append(vars, string(m[1]))
+	}
+	if vars[0] == vars[1] {
+		t.Errorf("expected café and cafè to declare different variables, both declare %s", vars[0])
+	}
+
+	// -strict-names fails instead, converting the rest
+	code, _, errOut = runCLI(t, "-outmode", "rice", "-ratio", "16x16", "-strict-names", "-force", filepath.Join(dir, "café.png"), filepath.Join(dir, "cafè.png"))
+	if code != exitOutput || !strings.Contains(errOut, "would declare r") || strings.Contains(errOut, "is renamed") {
+		t.Errorf("expected exit code %d with -strict-names, got %d: %s", exitOutput, code, errOut)
+	}
+
+	// bundle keys are renamed the same way
+	bundle := filepath.Join(dir, "assets", "assets.go")
+	code, _, errOut = runCLI(t, "-outmode", "rice", "-ratio", "16x16", "-bundle", bundle, filepath.Join(dir, "logo.png"), filepath.Join(dir, "logo.jpg"))
+	if code != 0 || !strings.Contains(errOut, "is renamed logo_2: ") {
+		t.Fatalf("expected the second logo to be bundled as logo_2, got %d: %s", code, errOut)
+	}
+	content, err := os.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), `"logo_2"`) {
+		t.Errorf("expected the bundle to hold logo_2, got\n%s", content)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"image/color"
+	"runtime"
+	"time"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"github.com/makeworld-the-better-one/dither"
+)
+
+// Options holds everything that decides how images are converted and where
+// the results go. The conversion path only ever reads it, so a single Options
+// can be shared by any number of workers.
+type Options struct {
+	// Ratio is the -ratio argument, which the outputs are named after
+	Ratio string
+	// OutMode is one of rice, bin, base64 or none
+	OutMode string
+	// Show previews every converted image on stderr
+	Show bool
+	// ShowStyle is how -show draws black and white images: ascii, braille
+	// or halfblock
+	ShowStyle string
+	// ShowOn and ShowOff are the characters -show draws pixels that are on
+	// and off with in the ascii style, "" for * and a space
+	ShowOn, ShowOff string
+	// ShowColor is one of auto, always or never
+	ShowColor string
+	// ShowWidth is the number of columns -show previews are shrunk to fit
+	// in, 0 for the width of the terminal on stderr, if any
+	ShowWidth        int
+	DisableDithering bool
+	// Invert inverts the colors of the image before it is dithered
+	Invert bool
+	// Gamma is the power curve applied to the image before it is dithered,
+	// 1 for none (see badgeimg.Gamma)
+	Gamma float64
+	// Transpose reads custom ratios as HxW rather than WxH
+	Transpose bool
+	// Anchor, if set, letterboxes images into the ratio instead of
+	// stretching them, placing them at this one of anchors (see anchor.go)
+	Anchor string
+	// NoUpscale refuses images smaller than the ratio, which are scaled up
+	// with a warning otherwise, and places letterboxed ones at 1:1
+	NoUpscale bool
+	// Linear makes -threshold and -invert work in linear light (see
+	// badgeimg/linear.go)
+	Linear bool
+	// Dither is the name of the dithering algorithm
+	Dither string
+	// DitherMatrix, if set, is the error diffusion matrix of -dither-matrix
+	// dithering with instead of Dither (see dithermatrix.go)
+	DitherMatrix dither.ErrorDiffusionMatrix
+	// Threshold converts black and white images without dithering, pixels
+	// darker than it (1 to 255) becoming black; badgeimg.ThresholdAuto picks
+	// it for each image, and 0 leaves it off
+	Threshold int
+	// Palette is the palette of the target panel
+	Palette *Palette
+	// Layout is how black and white images are packed in the files written
+	// and the headerless bin files read. Conversions pack them for the badge,
+	// badgeimg.LayoutBadger, and the data is repacked as it is written (see
+	// layoutBytes).
+	Layout badgeimg.Layout
+	// Background is the color transparent pixels are composited onto, nil
+	// for the legacy behavior (black for raster images, white for SVG)
+	Background color.Color
+	// Raw is the WxH:FORMAT of inputs that are raw framebuffers, read as
+	// they are instead of decoded (see raw.go)
+	Raw string
+	// FrameIndex picks a single frame of an animation or size of an icon
+	// file, -1 converts every frame (and the largest icon)
+	FrameIndex int
+	// DedupeFrames is consecutive to collapse the runs of identical frames
+	// of animations, global to also store each distinct frame of rice and
+	// slideshow outputs once, "" for neither (see dedupe.go)
+	DedupeFrames string
+	// Frames is the START:END:STEP slice of the frames of animations to
+	// convert, with -frames (see frameRange)
+	Frames string
+	// FrameDelay shows every frame of animations for this many
+	// milliseconds, 0 keeping their delays, and Speed multiplies their
+	// delays, 1 for none (see delay.go)
+	FrameDelay int
+	Speed      float64
+	// Animation is how frames are written in bin mode: split or concat
+	Animation string
+	// Grid slices the image into COLSxROWS cells, and Tile into cells of WxH
+	// pixels, each converted on its own like the frames of an animation (see
+	// grid.go). At most one of them is set.
+	Grid, Tile string
+	// Region is the WxH+X+Y window of the display converted alone, for
+	// partial updates (see region.go)
+	Region string
+	// Text is drawn as the image instead of converting inputs, its lines
+	// separated by newlines (see text.go)
+	Text string
+	// TextFont is the TrueType or OpenType font Text is drawn with, the
+	// built-in 7x13 bitmap font when empty, and TextSize its size in points
+	TextFont string
+	TextSize float64
+	// Align is how the lines of Text are aligned: left, center or right
+	Align string
+	// Fit sizes Text so that its longest line fills the width, and Shrink
+	// only shrinks text too large to fit, which is otherwise an error
+	Fit, Shrink bool
+	// Overlays are composited onto the image once scaled, in order (see
+	// overlay.go)
+	Overlays []Overlay
+	// Template is a JSON file of elements drawn as the image instead of
+	// converting inputs, once per row of the CSV file TemplateData if set
+	// (see template.go)
+	Template, TemplateData string
+	// QR is drawn as a QR code instead of converting inputs, with error
+	// correction level QRLevel: L, M, Q or H (see qr.go)
+	QR, QRLevel string
+	// Stats counts the pixels on in black and white conversions, warning
+	// about images nearly all black or white (see stats.go)
+	Stats bool
+	// Timings reports what each stage of every conversion took (see
+	// timings.go)
+	Timings bool
+	// timer times the stages of a conversion with -timings, nil otherwise
+	timer *stageTimer
+	// provenance is what the Go files of a conversion record of it, nil
+	// when there is nothing to record (see provenance.go)
+	provenance *Provenance
+	// OnProgress, if set, is called by ConvertInputs each time an input is
+	// converted or fails, one call at a time (see progress.go)
+	OnProgress func(Progress)
+	// BatchFile is a CSV or JSON file listing the inputs to convert instead
+	// of the command line, with flags of their own (see batchfile.go)
+	BatchFile string
+	// FailFast stops a batch at the first input that fails
+	FailFast bool
+	// StrictNames fails the inputs of a batch whose outputs would take the
+	// names of an earlier one, rather than renaming them (see names.go)
+	StrictNames bool
+	// Jobs is how many inputs are converted at the same time
+	Jobs int
+	// Recursive allows directories as inputs, converting the images in them
+	Recursive bool
+	// IncludeHidden includes hidden files and directories when walking a
+	// directory
+	IncludeHidden bool
+	// OutDir is the directory outputs are written to, mirroring the layout of
+	// the inputs
+	OutDir string
+	// Output replaces the name of the output file of a single input, "-"
+	// writes it to stdout
+	Output string
+	// Command is the command line generated files say to regenerate them
+	// with, see generateCommand
+	Command commandLine
+	// VarName is the name of the variable in rice, cheader and python mode
+	// and of -embed files, derived from the output name when empty
+	VarName string
+	// Package is the package of rice mode and -embed files, main when empty
+	Package string
+	// Export exports the variable of rice mode files, with constants and an
+	// accessor giving its size
+	Export bool
+	// ContactSheet is the PNG every converted image is drawn on, if any,
+	// ContactColumns wide (0 for as square as it gets) with ContactPadding
+	// pixels around the images (see contact.go)
+	ContactSheet   string
+	ContactColumns int
+	ContactPadding int
+	// Marquee converts a banner as high as the display and as wide as the
+	// image, or text, makes it, sliced into windows the width of the display
+	// MarqueeStep pixels apart unless it is 0, and looped with MarqueeWrap
+	// (see marquee.go)
+	Marquee     bool
+	MarqueeStep int
+	MarqueeWrap bool
+	// GoFormat is what rice mode files give besides the packed data: "" for
+	// nothing, or image for a NameGray() constructor unpacking it
+	GoFormat string
+	// GoData is how rice mode files write the data: "" or bytes for byte
+	// literals, string or base64 for a string constant (see godata.go)
+	GoData string
+	// ImportRuntime has the constructors of -gofmt image unpack the data
+	// with the badgeimg package, rather than a copy of its code
+	ImportRuntime bool
+	// Embed writes a Go file embedding each bin file next to it
+	Embed bool
+	// Bundle is the rice mode Go file every input is written to instead of
+	// one file each, if any
+	Bundle string
+	// Progmem places C header arrays in flash on AVR boards
+	Progmem bool
+	// BytesLiteral writes python mode data as b"\x.." literals
+	BytesLiteral bool
+	// Compress is how bin and rice mode data is compressed: "" for not at
+	// all, or rle
+	Compress string
+	// Header prefixes bin mode data with a Header describing it
+	Header bool
+	// Checksum is where the CRC32 of bin mode data goes: "" for nowhere,
+	// append, sidecar or manifest
+	Checksum string
+	// Force overwrites output files holding something else than what is
+	// written, which are otherwise left alone and reported
+	Force bool
+	// ForceWrite rewrites output files that already hold what would be
+	// written, rather than leaving them untouched
+	ForceWrite bool
+	// Verify compares output files with what would be written instead of
+	// writing them, failing when they differ (see verify.go)
+	Verify bool
+	// Durable syncs output files to disk before renaming them into place
+	Durable bool
+	// Preview is where a PNG of the converted image is written, if anywhere
+	Preview string
+	// PreviewGIF is where a GIF of the converted frames is written, if
+	// anywhere
+	PreviewGIF string
+	// PreviewScale is how many times bigger than the panel the previews are
+	PreviewScale int
+	// Compare is where a PNG comparing every dithering algorithm is
+	// written, if anywhere
+	Compare string
+	// PaletteReport is where the legend of how the colors of an image map
+	// to the palette is written, if anywhere, the shares being logged with
+	// a warning for entries over PaletteReportWarn percent (see
+	// palettereport.go)
+	PaletteReport     string
+	PaletteReportWarn int
+	// Cache is the -cache-dir cache conversions are reused from, nil for
+	// none (see cache.go)
+	Cache *Cache
+	// Manifest is where the JSON manifest describing every conversion is
+	// written, if anywhere
+	Manifest string
+	// Send is the serial port converted images are sent to a badge on, if
+	// any, at Baud, waiting up to SendTimeout for each (see serial.go)
+	Send        string
+	Baud        int
+	SendTimeout time.Duration
+}
+
+// NewOptions returns the options matching the default value of every flag
+func NewOptions() *Options {
+	return &Options{
+		OutMode:      "none",
+		Palette:      MonoPalette,
+		Dither:       badgeimg.DitherAlgorithms[0],
+		ShowStyle:    showStyles[0],
+		ShowColor:    showColors[0],
+		FrameIndex:   -1,
+		Animation:    "split",
+		Jobs:         runtime.NumCPU(),
+		PreviewScale: 1,
+		Gamma:        1,
+		Speed:        1,
+		Baud:         115200,
+		SendTimeout:  5 * time.Second,
+		// a background alone rarely takes more
+		PaletteReportWarn: 90,
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+// -overlay composites images onto the image being converted, such as a logo
+// in the corner of a photo, once it has been scaled to -ratio and before it is
+// dithered: each overlay goes where its flag says, in pixels of the scaled
+// image, over the overlays of earlier flags, blending in through its alpha.
+// Overlays going past the edges are cut off there.
+
+// Overlay is an image composited onto the image being converted
+type Overlay struct {
+	Image image.Image
+	// X and Y are where its top left corner goes, and Scale its size in
+	// percent of its own
+	X, Y, Scale int
+}
+
+// parseOverlay parses the PATH@XxY[,SCALE%] of -overlay
+func parseOverlay(spec string) (string, Overlay, error) {
+	invalid := fmt.Errorf("error: invalid -overlay `%s`, expected PATH@XxY with an optional scale such as logo.png@8x8,50%%", spec)
+	at := strings.LastIndex(spec, "@")
+	if at <= 0 {
+		return "", Overlay{}, invalid
+	}
+	pos, scale, scaled := strings.Cut(spec[at+1:], ",")
+	xs, ys, _ := strings.Cut(strings.ToLower(pos), "x")
+	o := Overlay{Scale: 100}
+	var err error
+	if o.X, err = strconv.Atoi(xs); err != nil {
+		return "", Overlay{}, invalid
+	}
+	if o.Y, err = strconv.Atoi(ys); err != nil {
+		return "", Overlay{}, invalid
+	}
+	if scaled {
+		if o.Scale, err = strconv.Atoi(strings.TrimSuffix(scale, "%")); err != nil || o.Scale <= 0 {
+			return "", Overlay{}, invalid
+		}
+	}
+	return spec[:at], o, nil
+}
+
+// loadOverlays loads the images of -overlay, in the order of the flags, the
+// first frame of animations only
+func loadOverlays(specs []string) ([]Overlay, error) {
+	overlays := make([]Overlay, len(specs))
+	for i, spec := range specs {
+		path, o, err := parseOverlay(spec)
+		if err != nil {
+			return nil, usageError{err}
+		}
+		img, err := LoadImg(path)
+		if err != nil {
+			return nil, fmt.Errorf("error loading overlay %s: %w", path, err)
+		}
+		o.Image = *img
+		overlays[i] = o
+	}
+	return overlays, nil
+}
+
+// composite draws the overlays onto dst, cut off at its edges
+func (o *Options) composite(dst *image.RGBA) {
+	for _, overlay := range o.Overlays {
+		bounds := overlay.Image.Bounds()
+		w, h := bounds.Dx()*overlay.Scale/100, bounds.Dy()*overlay.Scale/100
+		if w == 0 || h == 0 {
+			continue
+		}
+		r := image.Rect(overlay.X, overlay.Y, overlay.X+w, overlay.Y+h)
+		if vector, ok := overlay.Image.(rasterizer); ok {
+			// vector images are drawn straight at their size, like inputs
+			draw.Draw(dst, r, vector.Rasterize(w, h, color.Transparent), image.Point{}, draw.Over)
+		} else if overlay.Scale == 100 {
+			draw.Draw(dst, r, overlay.Image, bounds.Min, draw.Over)
+		} else {
+			draw.NearestNeighbor.Scale(dst, r, overlay.Image, bounds, draw.Over, nil)
+		}
+	}
+}
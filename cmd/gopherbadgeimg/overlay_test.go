@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// writeSquare writes a PNG of an 8x8 square of c to path, whose left half is
+// transparent when half is set
+func writeSquare(t *testing.T, path string, c color.Color, half bool) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for y := range 8 {
+		for x := range 8 {
+			if !half || x >= 4 {
+				img.Set(x, y, c)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	dir := t.TempDir()
+	black := filepath.Join(dir, "black.png")
+	writeSquare(t, black, color.Black, false)
+	// scaled up to 32x32, the white square is the base
+	white := filepath.Join(dir, "white.png")
+	writeSquare(t, white, color.White, false)
+	half := filepath.Join(dir, "half.png")
+	writeSquare(t, half, color.Black, true)
+
+	out := filepath.Join(dir, "out.bin")
+	code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "32x32", "-disable-dithering", "-o", out,
+		"-overlay", black+"@4x8",
+		// over the black square, and scaled down to 4x4
+		"-overlay", white+"@6x10,50%",
+		// only its opaque right half shows
+		"-overlay", half+"@16x0",
+		// cut off at the top right corner
+		"-overlay", black+"@28x-4",
+		white)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := badgeimg.BytesToImg(32, 32, data, badgeimg.LayoutBadger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := func(x, y int, r image.Rectangle) bool {
+		return image.Pt(x, y).In(r)
+	}
+	for y := range 32 {
+		for x := range 32 {
+			want := in(x, y, image.Rect(4, 8, 12, 16)) && !in(x, y, image.Rect(6, 10, 10, 14)) ||
+				in(x, y, image.Rect(20, 0, 24, 8)) ||
+				in(x, y, image.Rect(28, 0, 32, 4))
+			if got := img.GrayAt(x, y).Y == 0; got != want {
+				t.Errorf("expected pixel %d,%d to be black: %v", x, y, want)
+			}
+		}
+	}
+
+	for _, spec := range []string{"black.png", "black.png@4", "black.png@4x4,0%", "@4x4"} {
+		code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "32x32", "-overlay", spec, white)
+		if code != 2 || !strings.Contains(errOut, "error: invalid -overlay") {
+			t.Errorf("%s: expected exit code 2 and an error, got %d and\n%s", spec, code, errOut)
+		}
+	}
+}
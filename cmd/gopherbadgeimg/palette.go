@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// Palette describes the colors a target panel can show and how each of them
+// is encoded in the packed output.
+//
+// The default monochrome palette is handled by the original 1-bit code path in
+// ImgToBytes; every other palette goes through PackPalette.
+type Palette struct {
+	Name   string
+	Colors []color.Color
+	// Codes holds the value written to the output buffer for each entry of Colors
+	Codes []byte
+	// Depth is the number of bits each pixel occupies in the output buffer
+	Depth int
+	// RowMajor panels are scanned left to right, top to bottom.
+	// The badge itself is column major (see ImgToBytes).
+	RowMajor bool
+	// Planes, if set, writes the codes as bit planes arranged by -planes:
+	// separate, concat or interleave (see planes.go)
+	Planes string
+}
+
+// MonoPalette is the black and white palette of the badge's e-ink display.
+var MonoPalette = &Palette{
+	Name:   "mono",
+	Colors: []color.Color{color.Black, color.White},
+	Codes:  []byte{1, 0},
+	Depth:  1,
+}
+
+// ACePPalette is the seven color palette of ACeP ("Advanced Color ePaper")
+// panels such as the 5.65" 7-color displays driven by the UC8159 controller.
+//
+// The codes are the 3-bit color indexes from the controller datasheet; each
+// pixel is stored in a nibble, two pixels per byte with the leftmost pixel in
+// the high nibble, rows top to bottom.
+var ACePPalette = &Palette{
+	Name: "acep",
+	Colors: []color.Color{
+		color.RGBA{0x00, 0x00, 0x00, 0xFF}, // black
+		color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}, // white
+		color.RGBA{0x00, 0xFF, 0x00, 0xFF}, // green
+		color.RGBA{0x00, 0x00, 0xFF, 0xFF}, // blue
+		color.RGBA{0xFF, 0x00, 0x00, 0xFF}, // red
+		color.RGBA{0xFF, 0xFF, 0x00, 0xFF}, // yellow
+		color.RGBA{0xFF, 0x8C, 0x00, 0xFF}, // orange
+	},
+	Codes:    []byte{0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6},
+	Depth:    4,
+	RowMajor: true,
+}
+
+// palettes maps the values accepted by the -colors flag to their palette
+var palettes = map[string]*Palette{
+	"mono": MonoPalette,
+	"acep": ACePPalette,
+}
+
+// LookupPalette returns the predefined palette with the given name
+func LookupPalette(name string) (*Palette, error) {
+	p, ok := palettes[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown color mode `%s`", name)
+	}
+	return p, nil
+}
+
+// Validate checks that an image of x by y pixels can be packed with this palette.
+func (p *Palette) Validate(x, y int) error {
+	if p.RowMajor {
+		// rows are packed one byte at a time, so a row must fill whole bytes
+		if x*p.Depth%8 != 0 {
+			return fmt.Errorf("error: width/x value must be a multiple of %d for %s output", 8/p.Depth, p.Name)
+		}
+		return nil
+	}
+	// bit planes are packed as black and white images are
+	if y*p.Depth%8 != 0 || p.Planes != "" && y%8 != 0 {
+		return errors.New("error: height/y value must be divisible by 8")
+	}
+	return nil
+}
+
+// Pad returns the smallest size of at least x by y pixels that Validate
+// accepts, growing the height (or the width, for row-major panels)
+func (p *Palette) Pad(x, y int) (int, int) {
+	for p.Validate(x, y) != nil {
+		if p.RowMajor {
+			x++
+		} else {
+			y++
+		}
+	}
+	return x, y
+}
+
+// Index returns the index of the palette entry closest to c.
+//
+// Closeness is the euclidean distance in sRGB space, which is exact for
+// pixels that have already been dithered against this palette.
+func (p *Palette) Index(c color.Color) int {
+	r, g, b, _ := c.RGBA()
+	best, bestDist := 0, uint64(1<<63)
+	for i, pc := range p.Colors {
+		pr, pg, pb, _ := pc.RGBA()
+		dr := int64(r>>8) - int64(pr>>8)
+		dg := int64(g>>8) - int64(pg>>8)
+		db := int64(b>>8) - int64(pb>>8)
+		dist := uint64(dr*dr + dg*dg + db*db)
+		if dist < bestDist {
+			best, bestDist = i, dist
+		}
+	}
+	return best
+}
+
+// layout returns the order the palette packs pixels in, a pixel being Depth
+// bits in a row, most significant first
+func (p *Palette) layout() badgeimg.Layout {
+	return packingLayout(p.RowMajor)
+}
+
+// packingLayout returns the layout palettes pack their codes in, and headers
+// and slideshows describe: row by row for rowMajor, else the badge's
+func packingLayout(rowMajor bool) badgeimg.Layout {
+	if rowMajor {
+		return badgeimg.LayoutRowMSB
+	}
+	return badgeimg.LayoutBadger
+}
+
+// bitOffset returns the position of the first bit of pixel (i, j) in the packed buffer
+func (p *Palette) bitOffset(x, y, i, j int) int {
+	return badgeimg.BitIndex(p.layout(), i, j, x, y) * p.Depth
+}
+
+// PackPalette maps every pixel of img to its palette code and packs the codes
+// into a byte slice, most significant bit first.
+func (p *Palette) PackPalette(x, y int, img image.Image) []byte {
+	imageBits := make([]byte, x*y*p.Depth/8)
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			p.setCode(x, y, i, j, p.Codes[p.Index(img.At(i, j))], imageBits)
+		}
+	}
+	return imageBits
+}
+
+// setCode writes the code of pixel (i, j) into a cleared packed buffer
+func (p *Palette) setCode(x, y, i, j int, code byte, imgBits []byte) {
+	offset := p.bitOffset(x, y, i, j)
+	// write the code one bit at a time so any depth works,
+	// not only the ones that divide a byte evenly
+	for k := 0; k < p.Depth; k++ {
+		if code&(1<<uint(p.Depth-1-k)) != 0 {
+			bit := offset + k
+			imgBits[bit/8] |= p.layout().Mask(bit)
+		}
+	}
+}
+
+// CodeAt reads back the code of pixel (i, j) from a packed buffer
+func (p *Palette) CodeAt(x, y, i, j int, imgBits []byte) byte {
+	offset := p.bitOffset(x, y, i, j)
+	var code byte
+	for k := 0; k < p.Depth; k++ {
+		bit := offset + k
+		code <<= 1
+		if imgBits[bit/8]&p.layout().Mask(bit) != 0 {
+			code |= 1
+		}
+	}
+	return code
+}
+
+// ansiColors are the eight basic ANSI terminal colors, indexed by their SGR offset
+var ansiColors = []color.RGBA{
+	{0x00, 0x00, 0x00, 0xFF}, // black
+	{0xCD, 0x00, 0x00, 0xFF}, // red
+	{0x00, 0xCD, 0x00, 0xFF}, // green
+	{0xCD, 0xCD, 0x00, 0xFF}, // yellow
+	{0x00, 0x00, 0xEE, 0xFF}, // blue
+	{0xCD, 0x00, 0xCD, 0xFF}, // magenta
+	{0x00, 0xCD, 0xCD, 0xFF}, // cyan
+	{0xE5, 0xE5, 0xE5, 0xFF}, // white
+}
+
+// nearestANSI returns the SGR foreground code of the basic ANSI color closest to c
+func nearestANSI(c color.Color) int {
+	ansi := make([]color.Color, len(ansiColors))
+	for i := range ansiColors {
+		ansi[i] = ansiColors[i]
+	}
+	return 30 + (&Palette{Colors: ansi}).Index(c)
+}
+
+// PrintPaletteImg is the color counterpart of PrintImg: it paints a block for
+// each pixel using the ANSI color nearest to its palette entry.
+func PrintPaletteImg(w io.Writer, x, y int, p *Palette, imgBits []byte) {
+	// reverse lookup from code to palette entry
+	sgr := map[byte]int{}
+	for i, code := range p.Codes {
+		sgr[code] = nearestANSI(p.Colors[i])
+	}
+	for j := 0; j < y; j++ {
+		for i := 0; i < x; i++ {
+			fmt.Fprintf(w, "\x1b[%dm█", sgr[p.CodeAt(x, y, i, j, imgBits)])
+		}
+		fmt.Fprint(w, "\x1b[0m\n")
+	}
+}
+
+// ParsePalette parses a comma separated list of colors such as
+// "#000000,#ffffff,#ff0000" or "black,white,rgb(255, 0, 0)", as
+// badgeimg.ParseColor parses them, into a palette packed at ceil(log2(n))
+// bits per pixel in the badge's column major order.
+//
+// Each color is coded with its position in the list, except for two color
+// palettes where the darker color is coded 1 to match the badge's convention of
+// a set bit meaning ink. A black and white palette is the badge's own palette
+// and returns MonoPalette, so its output is byte-for-byte what it always was.
+func ParsePalette(s string) (*Palette, error) {
+	fields := splitColors(s)
+	if len(fields) < 2 || len(fields) > 16 {
+		return nil, fmt.Errorf("a palette needs between 2 and 16 colors, got %d", len(fields))
+	}
+	p := &Palette{Name: "custom"}
+	for _, field := range fields {
+		c, err := parseOpaqueColor(field)
+		if err != nil {
+			return nil, err
+		}
+		p.Colors = append(p.Colors, color.RGBAModel.Convert(c))
+		p.Codes = append(p.Codes, byte(len(p.Codes)))
+	}
+	for 1<<uint(p.Depth) < len(p.Colors) {
+		p.Depth++
+	}
+	if len(p.Colors) == 2 {
+		if isBlackAndWhite(p.Colors[0], p.Colors[1]) {
+			return MonoPalette, nil
+		}
+		if luminance(p.Colors[0]) < luminance(p.Colors[1]) {
+			p.Codes = []byte{1, 0}
+		}
+	}
+	return p, nil
+}
+
+// splitColors splits a comma separated list of colors, leaving the commas
+// of rgb() and rgba() alone
+func splitColors(s string) []string {
+	var (
+		fields []string
+		depth  int
+		start  int
+	)
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth = max(0, depth-1)
+		case ',':
+			if depth == 0 {
+				fields = append(fields, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(fields, s[start:])
+}
+
+// parseOpaqueColor parses a color as badgeimg.ParseColor does, refusing
+// translucent ones: the colors of a panel and the background images are put
+// onto are solid
+func parseOpaqueColor(s string) (color.Color, error) {
+	c, err := badgeimg.ParseColor(s)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, a := c.RGBA(); a != 0xffff {
+		return nil, fmt.Errorf("%w `%s`: it is translucent, only solid colors can be used here", badgeimg.ErrColor, strings.TrimSpace(s))
+	}
+	return c, nil
+}
+
+// colorValue is the flag.Value of the flags taking a color, which it parses
+// with parseOpaqueColor. It keeps the color as it was given, for the command
+// line generated files are regenerated with.
+type colorValue struct {
+	c    *color.Color
+	text string
+}
+
+func (v *colorValue) String() string {
+	return v.text
+}
+
+func (v *colorValue) Set(s string) error {
+	c, err := parseOpaqueColor(s)
+	if err != nil {
+		return err
+	}
+	*v.c, v.text = c, s
+	return nil
+}
+
+// luminance returns the relative luminance of c on a 0-65535 scale
+func luminance(c color.Color) uint32 {
+	return uint32(color.Gray16Model.Convert(c).(color.Gray16).Y)
+}
+
+func isBlackAndWhite(a, b color.Color) bool {
+	black, white := color.RGBA{0, 0, 0, 0xFF}, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	ca := color.RGBAModel.Convert(a).(color.RGBA)
+	cb := color.RGBAModel.Convert(b).(color.RGBA)
+	return (ca == black && cb == white) || (ca == white && cb == black)
+}
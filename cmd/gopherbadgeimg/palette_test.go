@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestACePCodes(t *testing.T) {
+	// color indexes from the UC8159 datasheet
+	expected := []byte{0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6}
+	for i, c := range ACePPalette.Colors {
+		code := ACePPalette.Codes[ACePPalette.Index(c)]
+		if code != expected[i] {
+			t.Errorf("palette entry %d: expected code %d, got %d", i, expected[i], code)
+		}
+	}
+}
+
+func TestACePPacking(t *testing.T) {
+	opts := NewOptions()
+	opts.Palette, opts.DisableDithering = ACePPalette, true
+
+	// the palette colors in order, then colors near each of them, packed as
+	// the UC8159 datasheet gives their codes, two pixels per byte
+	rows := [][]color.RGBA{
+		{{0x00, 0x00, 0x00, 0xFF}, {0xFF, 0xFF, 0xFF, 0xFF}, {0x00, 0xFF, 0x00, 0xFF}, {0x00, 0x00, 0xFF, 0xFF},
+			{0xFF, 0x00, 0x00, 0xFF}, {0xFF, 0xFF, 0x00, 0xFF}, {0xFF, 0x8C, 0x00, 0xFF}, {0xFF, 0xFF, 0xFF, 0xFF}},
+		{{0x10, 0x10, 0x10, 0xFF}, {0xF0, 0xF0, 0xE0, 0xFF}, {0x20, 0xE0, 0x30, 0xFF}, {0x10, 0x20, 0xD0, 0xFF},
+			{0xE0, 0x10, 0x10, 0xFF}, {0xF0, 0xF0, 0x20, 0xFF}, {0xF0, 0x90, 0x10, 0xFF}, {0x00, 0x00, 0x00, 0xFF}},
+	}
+	expected := []byte{0x01, 0x23, 0x45, 0x61, 0x01, 0x23, 0x45, 0x60}
+	rgba := image.NewRGBA(image.Rect(0, 0, 8, 2))
+	for y, row := range rows {
+		for x, c := range row {
+			rgba.SetRGBA(x, y, c)
+		}
+	}
+	var src image.Image = rgba
+	imgBits := opts.ImgToBytes(8, 2, &src)
+	if !bytes.Equal(imgBits, expected) {
+		t.Errorf("expected % X, got % X", expected, imgBits)
+	}
+}
+
+// TestACePVendorBlocks converts the seven color blocks Waveshare's sample
+// code for its 5.65" ACeP panel draws, EPD_5IN65F_Show7Block in
+// lib/e-Paper/EPD_5in65f.c of github.com/waveshareteam/e-Paper, whose data
+// testdata/acep-7block.bin.gz holds: 224 rows of 150 pixels wide black,
+// blue, green and orange blocks, then red, yellow, white and white ones, each
+// byte two pixels of the codes defined in EPD_5in65f.h. acep-7block.png
+// draws the same blocks in the colors of ACePPalette.
+func TestACePVendorBlocks(t *testing.T) {
+	opts := NewOptions()
+	opts.Palette, opts.DisableDithering = ACePPalette, true
+
+	src, err := LoadImg("testdata/acep-7block.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := os.ReadFile("testdata/acep-7block.bin.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgBits := opts.ImgToBytes(600, 448, src)
+	if len(imgBits) != len(expected) {
+		t.Fatalf("expected %d bytes, got %d", len(expected), len(imgBits))
+	}
+	for i := range expected {
+		if imgBits[i] != expected[i] {
+			t.Fatalf("byte %d (row %d): expected %02X, got %02X", i, i/300, expected[i], imgBits[i])
+		}
+	}
+}
+
+func TestACePValidate(t *testing.T) {
+	if err := ACePPalette.Validate(7, 2); err == nil {
+		t.Error("expected an odd width to be rejected")
+	}
+	if err := ACePPalette.Validate(600, 448); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParsePalette(t *testing.T) {
+	for _, bad := range []string{"#000000", "#000000,#zzzzzz", "#00,#fff", "black,rgba(0, 0, 0, 0.5)", strings.Repeat("#000000,", 16) + "#ffffff"} {
+		if _, err := ParsePalette(bad); err == nil {
+			t.Errorf("expected palette %q to be rejected", bad)
+		}
+	}
+	for _, bw := range []string{"#000000,#ffffff", "#fff,#000", "black, white", "rgb(0, 0, 0),rgb(100%, 100%, 100%)"} {
+		p, err := ParsePalette(bw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p != MonoPalette {
+			t.Errorf("expected %q to be the badge's mono palette", bw)
+		}
+	}
+	p, err := ParsePalette("#000000,#ffffff,rgb(255, 0, 0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Depth != 2 {
+		t.Errorf("expected 3 colors to need 2 bits per pixel, got %d", p.Depth)
+	}
+	if want := (color.RGBA{0xff, 0, 0, 0xff}); p.Colors[2] != want {
+		t.Errorf("expected rgb(255, 0, 0) to be %v, got %v", want, p.Colors[2])
+	}
+}
+
+func TestBackgroundColor(t *testing.T) {
+	dir := t.TempDir()
+	var outputs [][]byte
+	for i, background := range []string{"#ffffff", "white", "rgb(255, 255, 255)"} {
+		out := filepath.Join(dir, fmt.Sprintf("%d.bin", i))
+		if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "16x16", "-disable-dithering", "-frame", "0", "-background", background, "-o", out, "testdata/multi-size.ico"); code != 0 {
+			t.Fatalf("-background %s: exit code %d: %s", background, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, data)
+	}
+	for i := 1; i < len(outputs); i++ {
+		if !bytes.Equal(outputs[0], outputs[i]) {
+			t.Errorf("expected every spelling of white to convert alike, output %d differs", i)
+		}
+	}
+	for background, want := range map[string]string{
+		"rgb(255, 255)":    "takes 3 components",
+		"#fffffff":         "7 hex digits",
+		"whitish":          "unknown color name",
+		"rgba(0, 0, 0, 0)": "translucent",
+	} {
+		code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "16x16", "-background", background, "testdata/multi-size.ico")
+		if code != exitUsage || !strings.Contains(errOut, want) {
+			t.Errorf("-background %s: expected exit code %d and %q, got %d: %s", background, exitUsage, want, code, errOut)
+		}
+	}
+}
+
+func TestFourColorPalette(t *testing.T) {
+	opts := NewOptions()
+	var err error
+	opts.Palette, err = ParsePalette("#000000,#555555,#aaaaaa,#ffffff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.DisableDithering = true
+
+	// two columns of four pixels, one per palette entry
+	levels := []uint8{0x00, 0x55, 0xAA, 0xFF}
+	src := image.NewGray(image.Rect(0, 0, 2, 4))
+	for j, level := range levels {
+		src.SetGray(0, j, color.Gray{level})
+		src.SetGray(1, 3-j, color.Gray{level})
+	}
+	var img image.Image = src
+	imgBits := opts.ImgToBytes(2, 4, &img)
+	// column major, 2 bits per pixel: 00 01 10 11, then 11 10 01 00
+	expected := []byte{0x1B, 0xE4}
+	if !bytes.Equal(imgBits, expected) {
+		t.Errorf("expected % X, got % X", expected, imgBits)
+	}
+}
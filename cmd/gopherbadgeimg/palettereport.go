@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// -palette-report tells how the colors of an image map to the palette of
+// the panel: for every entry, the share of the source pixels nearest to it,
+// before dithering, and the share of the pixels it codes once dithered. The
+// shares are logged, with a warning for an entry taking more than
+// -palette-report-warn percent of the pixels, which usually means the
+// palette or -background doesn't suit the image, and drawn in a legend PNG.
+// The first frame of an animation stands for all of it, as with -compare.
+
+// layout of the -palette-report legend, in pixels
+const (
+	legendGap    = 8   // around the bars and rows
+	legendLabel  = 72  // left of the bars, for their name
+	legendBar    = 256 // width of the bars
+	legendSwatch = 16  // height of the bars and rows
+)
+
+// PaletteShare is what an entry of the palette takes of a converted image
+type PaletteShare struct {
+	// Color is the palette entry
+	Color color.Color
+	// Source is the mean color of the source pixels nearest to it, nil when
+	// none are
+	Source color.Color
+	// Nearest is the percent of the source pixels nearest to it, before
+	// dithering, and Dithered the percent of the pixels coded with it after
+	Nearest, Dithered float64
+}
+
+// PaletteShares returns the share of every palette entry in src converted to
+// x by y
+func (o *Options) PaletteShares(x, y int, src image.Image) []PaletteShare {
+	n := len(o.Palette.Colors)
+	nearest, sums := make([]int, n), make([][3]int, n)
+	dst := o.scale(src, x, y)
+	o.preprocess(dst)
+	for j := range y {
+		for i := range x {
+			c := dst.RGBAAt(i, j)
+			k := o.Palette.Index(c)
+			nearest[k]++
+			sums[k][0] += int(c.R)
+			sums[k][1] += int(c.G)
+			sums[k][2] += int(c.B)
+		}
+	}
+	// reverse lookup from code to palette entry
+	index := map[byte]int{}
+	for i, code := range o.Palette.Codes {
+		index[code] = i
+	}
+	dithered := make([]int, n)
+	imgBits := o.ImgToBytes(x, y, &src)
+	for j := range y {
+		for i := range x {
+			dithered[index[o.Palette.CodeAt(x, y, i, j, imgBits)]]++
+		}
+	}
+	shares := make([]PaletteShare, n)
+	for k := range shares {
+		shares[k] = PaletteShare{
+			Color:    o.Palette.Colors[k],
+			Nearest:  percent(nearest[k], x*y),
+			Dithered: percent(dithered[k], x*y),
+		}
+		if m := nearest[k]; m > 0 {
+			shares[k].Source = color.RGBA{uint8(sums[k][0] / m), uint8(sums[k][1] / m), uint8(sums[k][2] / m), 0xff}
+		}
+	}
+	return shares
+}
+
+// hexColor returns c as #rrggbb
+func hexColor(c color.Color) string {
+	rgba := color.RGBAModel.Convert(c).(color.RGBA)
+	return fmt.Sprintf("#%02x%02x%02x", rgba.R, rgba.G, rgba.B)
+}
+
+// String describes s on a single line
+func (s PaletteShare) String() string {
+	return fmt.Sprintf("%s: %.1f%% of the source nearest to it, %.1f%% once dithered", hexColor(s.Color), s.Nearest, s.Dithered)
+}
+
+// paletteWarning returns what is wrong with shares when an entry takes more
+// than limit percent of the pixels, before or after dithering, if it does
+func paletteWarning(shares []PaletteShare, limit int) string {
+	for _, s := range shares {
+		if share := max(s.Nearest, s.Dithered); share > float64(limit) {
+			return fmt.Sprintf("has %.1f%% of its pixels on %s alone (over %d%%): the palette, -background or -invert may not suit it", share, hexColor(s.Color), limit)
+		}
+	}
+	return ""
+}
+
+// PaletteLegend draws shares: a bar of the source pixels, each part in the
+// mean color of those nearest to an entry, over a bar of the dithered
+// pixels, each part in the color of an entry, then a row per entry with the
+// two colors and the two shares
+func PaletteLegend(shares []PaletteShare) *image.RGBA {
+	legend := image.NewRGBA(image.Rect(0, 0,
+		legendLabel+legendBar+2*legendGap,
+		(len(shares)+2)*(legendSwatch+legendGap)+legendGap,
+	))
+	// a mid gray sets the white and black swatches apart, as on -compare
+	draw.Draw(legend, legend.Bounds(), image.NewUniform(color.Gray{0x80}), image.Point{}, draw.Src)
+	d := font.Drawer{Dst: legend, Src: image.Black, Face: basicfont.Face7x13}
+	label := func(left, top int, s string) {
+		d.Dot = fixed.P(left, top+basicfont.Face7x13.Ascent+1)
+		d.DrawString(s)
+	}
+	bar := func(top int, name string, share func(PaletteShare) float64, fill func(PaletteShare) color.Color) {
+		label(legendGap, top, name)
+		var done float64
+		for _, s := range shares {
+			left := legendGap + legendLabel + int(done*legendBar/100+0.5)
+			done += share(s)
+			right := legendGap + legendLabel + int(min(done, 100)*legendBar/100+0.5)
+			if c := fill(s); c != nil && right > left {
+				draw.Draw(legend, image.Rect(left, top, right, top+legendSwatch), image.NewUniform(c), image.Point{}, draw.Src)
+			}
+		}
+	}
+	bar(legendGap, "source", func(s PaletteShare) float64 { return s.Nearest }, func(s PaletteShare) color.Color { return s.Source })
+	bar(2*legendGap+legendSwatch, "dithered", func(s PaletteShare) float64 { return s.Dithered }, func(s PaletteShare) color.Color { return s.Color })
+	for k, s := range shares {
+		top := legendGap + (k+2)*(legendSwatch+legendGap)
+		draw.Draw(legend, image.Rect(legendGap, top, legendGap+legendSwatch, top+legendSwatch), image.NewUniform(s.Color), image.Point{}, draw.Src)
+		if s.Source != nil {
+			left := legendGap + legendSwatch
+			draw.Draw(legend, image.Rect(left, top, left+legendSwatch, top+legendSwatch), image.NewUniform(s.Source), image.Point{}, draw.Src)
+		}
+		label(legendGap+legendLabel, top, fmt.Sprintf("%s %5.1f%% -> %5.1f%%", hexColor(s.Color), s.Nearest, s.Dithered))
+	}
+	return legend
+}
+
+// writePaletteReport logs the -palette-report of src, converted in as x by
+// y, and writes its legend
+func (o *Options) writePaletteReport(in Input, x, y int, src image.Image) error {
+	shares := o.PaletteShares(x, y, src)
+	for _, s := range shares {
+		logger.Infof("%s at %dx%d: %v", in, x, y, s)
+	}
+	if w := paletteWarning(shares, o.PaletteReportWarn); w != "" {
+		logger.Warnf("%s at %dx%d %s", in, x, y, w)
+	}
+	return o.writeFile(o.PaletteReport, func(w io.Writer) error {
+		return png.Encode(w, PaletteLegend(shares))
+	})
+}
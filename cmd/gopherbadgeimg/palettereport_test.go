@@ -0,0 +1,143 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// regions returns a 16x16 image split in vertical bands of colors, each
+// width pixels wide
+func regions(colors []color.Color, widths []int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	left := 0
+	for i, c := range colors {
+		draw.Draw(img, image.Rect(left, 0, left+widths[i], 16), image.NewUniform(c), image.Point{}, draw.Src)
+		left += widths[i]
+	}
+	return img
+}
+
+func TestPaletteShares(t *testing.T) {
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	p, err := ParsePalette("white,black,red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		name     string
+		src      image.Image
+		dither   bool
+		nearest  []float64
+		dithered []float64
+		sources  []color.Color
+	}{
+		{
+			name:     "exact colors",
+			src:      regions([]color.Color{red, color.Black, color.White}, []int{8, 4, 4}),
+			nearest:  []float64{25, 25, 50},
+			dithered: []float64{25, 25, 50},
+			sources:  []color.Color{color.White, color.Black, red},
+		},
+		{
+			// dark red and pink are nearest to red and white, and dithering
+			// mixes in black and red
+			name:     "near colors",
+			src:      regions([]color.Color{color.RGBA{0xc0, 0, 0, 0xff}, color.RGBA{0xff, 0xc0, 0xc0, 0xff}}, []int{12, 4}),
+			dither:   true,
+			nearest:  []float64{25, 0, 75},
+			sources:  []color.Color{color.RGBA{0xff, 0xc0, 0xc0, 0xff}, nil, color.RGBA{0xc0, 0, 0, 0xff}},
+			dithered: nil,
+		},
+	} {
+		opts := NewOptions()
+		opts.Palette, opts.DisableDithering = p, !tc.dither
+		shares := opts.PaletteShares(16, 16, tc.src)
+		var total float64
+		for k, s := range shares {
+			if s.Color != p.Colors[k] {
+				t.Errorf("%s: expected entry %d to be %v, got %v", tc.name, k, p.Colors[k], s.Color)
+			}
+			if s.Nearest != tc.nearest[k] {
+				t.Errorf("%s: expected %.1f%% nearest to %s, got %.1f%%", tc.name, tc.nearest[k], hexColor(s.Color), s.Nearest)
+			}
+			if tc.dithered != nil && s.Dithered != tc.dithered[k] {
+				t.Errorf("%s: expected %.1f%% dithered to %s, got %.1f%%", tc.name, tc.dithered[k], hexColor(s.Color), s.Dithered)
+			}
+			if (s.Source == nil) != (tc.sources[k] == nil) || s.Source != nil && hexColor(s.Source) != hexColor(tc.sources[k]) {
+				t.Errorf("%s: expected the source color of %s to be %v, got %v", tc.name, hexColor(s.Color), tc.sources[k], s.Source)
+			}
+			total += s.Dithered
+		}
+		if total != 100 {
+			t.Errorf("%s: expected the dithered shares to add up to 100%%, got %.1f%%", tc.name, total)
+		}
+		if tc.dither && shares[1].Dithered == 0 {
+			t.Errorf("%s: expected dithering to mix in black", tc.name)
+		}
+	}
+}
+
+func TestPaletteReportFlag(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "regions.png")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orange := color.RGBA{0xff, 0x8c, 0, 0xff}
+	if err := png.Encode(f, regions([]color.Color{orange, color.White}, []int{15, 1})); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	legend := filepath.Join(dir, "legend.png")
+	code, _, errOut := runCLI(t, "-outmode", "none", "-palette", "white,black,red", "-ratio", "16x16", "-disable-dithering", "-palette-report", legend, src)
+	if code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	for _, want := range []string{
+		"#ffffff: 6.3% of the source nearest to it, 6.3% once dithered",
+		"#000000: 0.0% of the source nearest to it, 0.0% once dithered",
+		"#ff0000: 93.8% of the source nearest to it, 93.8% once dithered",
+		"has 93.8% of its pixels on #ff0000 alone (over 90%)",
+	} {
+		if !strings.Contains(errOut, want) {
+			t.Errorf("expected %q in\n%s", want, errOut)
+		}
+	}
+	img := decodePNG(t, legend)
+	if b := img.Bounds(); b.Dx() != legendLabel+legendBar+2*legendGap || b.Dy() != 5*(legendSwatch+legendGap)+legendGap {
+		t.Errorf("expected a row per entry under the two bars, got a %v legend", b)
+	}
+	// the source bar starts with the white share, in white, then orange
+	top := legendGap + legendSwatch/2
+	for _, tc := range []struct {
+		x    int
+		want color.Color
+	}{
+		{legendGap + legendLabel + 2, color.White},
+		{legendGap + legendLabel + legendBar/2, orange},
+		{legendGap + legendLabel + legendBar - 2, orange},
+	} {
+		if got := hexColor(img.At(tc.x, top)); got != hexColor(tc.want) {
+			t.Errorf("expected %s at %d in the source bar, got %s", hexColor(tc.want), tc.x, got)
+		}
+	}
+
+	// 93.8% is under a limit of 95%
+	legend = filepath.Join(dir, "dithered.png")
+	code, _, errOut = runCLI(t, "-outmode", "none", "-palette", "white,black,red", "-ratio", "16x16", "-palette-report", legend, "-palette-report-warn", "95", src)
+	if code != 0 || strings.Contains(errOut, "alone") {
+		t.Errorf("expected no warning under -palette-report-warn 95, got %d: %s", code, errOut)
+	}
+	code, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "16x16", "-palette-report", legend, "-palette-report-warn", "0", src)
+	if code != exitUsage || !strings.Contains(errOut, "between 1 and 100") {
+		t.Errorf("expected exit code %d for -palette-report-warn 0, got %d: %s", exitUsage, code, errOut)
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// -planes writes images packed at several bits per pixel, such as those of a
+// tri-color or grayscale -palette, as bit planes, the way controllers taking
+// a 1 bit image per color want them. Plane k holds bit k of the code of every
+// pixel, plane 0 the lowest, packed as a black and white image is for the
+// badge: column-major, eight pixels per byte. The planes of each image are
+// written:
+//
+//	separate    as images of their own, named after the color their bit
+//	            codes (image_black, image_red), or plane<k>
+//	concat      one after the other in a single buffer, plane 0 first
+//	interleave  a byte of each plane in turn in a single buffer: byte 0 of
+//	            plane 0, byte 0 of plane 1, ..., byte 1 of plane 0, ...
+//
+// Conversions still pack the code of each pixel in one piece, which is what
+// -show, the previews and every other step reading the data back expect, and
+// the planes are split as the data is written, and joined back as bin files
+// and base64 data are read. Headers record concatenated and interleaved
+// planes; separate planes are black and white images with headers of their
+// own.
+
+// planeArrangements are the values of -planes
+var planeArrangements = []string{"separate", "concat", "interleave"}
+
+// planeLen returns the length of a bit plane of an x by y image in bytes
+func planeLen(x, y int) int {
+	return x * y / 8
+}
+
+// SplitPlanes returns the bit planes of imgBits, an x by y image packed for p,
+// lowest bit first
+func SplitPlanes(x, y int, p *Palette, imgBits []byte) [][]byte {
+	planes := make([][]byte, p.Depth)
+	for k := range planes {
+		planes[k] = make([]byte, planeLen(x, y))
+	}
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			code, bit := p.CodeAt(x, y, i, j, imgBits), badgeimg.BitIndex(badgeimg.LayoutBadger, i, j, x, y)
+			for k, plane := range planes {
+				if code&(1<<uint(k)) != 0 {
+					plane[bit/8] |= badgeimg.LayoutBadger.Mask(bit)
+				}
+			}
+		}
+	}
+	return planes
+}
+
+// JoinPlanes packs the bit planes returned by SplitPlanes back into an x by y
+// image packed for p
+func JoinPlanes(x, y int, p *Palette, planes [][]byte) []byte {
+	imgBits := make([]byte, x*y*p.Depth/8)
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			var code byte
+			bit := badgeimg.BitIndex(badgeimg.LayoutBadger, i, j, x, y)
+			for k, plane := range planes {
+				if plane[bit/8]&badgeimg.LayoutBadger.Mask(bit) != 0 {
+					code |= 1 << uint(k)
+				}
+			}
+			p.setCode(x, y, i, j, code, imgBits)
+		}
+	}
+	return imgBits
+}
+
+// arrangePlanes puts planes in a single buffer, concatenated or interleaved
+func arrangePlanes(arrangement string, planes [][]byte) []byte {
+	if arrangement == "concat" {
+		return bytes.Join(planes, nil)
+	}
+	data := make([]byte, 0, len(planes)*len(planes[0]))
+	for i := range planes[0] {
+		for _, plane := range planes {
+			data = append(data, plane[i])
+		}
+	}
+	return data
+}
+
+// unarrangePlanes returns the depth planes arrangePlanes put in data
+func unarrangePlanes(arrangement string, depth int, data []byte) [][]byte {
+	n := len(data) / depth
+	planes := make([][]byte, depth)
+	for k := range planes {
+		if arrangement == "concat" {
+			planes[k] = data[k*n : (k+1)*n]
+			continue
+		}
+		planes[k] = make([]byte, n)
+		for i := range planes[k] {
+			planes[k][i] = data[i*depth+k]
+		}
+	}
+	return planes
+}
+
+// planeNames returns the names of the planes of p: the name of the color
+// coded by the bit of each, such as black or red, or else plane0, plane1...
+func planeNames(p *Palette) []string {
+	names := make([]string, p.Depth)
+	for k := range names {
+		names[k] = fmt.Sprintf("plane%d", k)
+		for i, code := range p.Codes {
+			if code != 1<<uint(k) {
+				continue
+			}
+			if name, ok := badgeimg.ColorName(p.Colors[i]); ok {
+				names[k] = name
+			}
+		}
+	}
+	return names
+}
+
+// planePath returns the path of the plane named name of the image at path,
+// image.bin becoming image_red.bin
+func planePath(path, name string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + name + ext
+}
+
+// planeOutput is what is written for a converted image: with -planes
+// separate, one of its planes, as a black and white image of its own
+type planeOutput struct {
+	opts   *Options
+	base   string
+	frames [][]byte
+}
+
+// planeOutputs returns what to write for frames, x by y images packed for the
+// palette, named after base: the frames packed with -layout, their planes
+// concatenated or interleaved, or a black and white image per plane
+func (o *Options) planeOutputs(base string, x, y int, frames [][]byte) []planeOutput {
+	switch o.Palette.Planes {
+	case "":
+		return []planeOutput{{o, base, o.layoutFrames(x, y, frames)}}
+	case "separate":
+	default:
+		return []planeOutput{{o, base, o.arrangedFrames(x, y, frames)}}
+	}
+	names := planeNames(o.Palette)
+	outputs := make([]planeOutput, len(names))
+	for k, name := range names {
+		plane := *o
+		plane.Palette = MonoPalette
+		if plane.Output != "" {
+			plane.Output = planePath(plane.Output, name)
+		}
+		if plane.VarName != "" {
+			plane.VarName += "_" + name
+		}
+		outputs[k] = planeOutput{&plane, base + "_" + name, make([][]byte, len(frames))}
+	}
+	for i, frame := range frames {
+		for k, plane := range SplitPlanes(x, y, o.Palette, frame) {
+			outputs[k].frames[i] = plane
+		}
+	}
+	return outputs
+}
+
+// arrangedFrames returns frames, x by y images packed for the palette, with
+// their planes concatenated or interleaved by -planes. The planes of separate
+// ones are concatenated, as the manifest hashes them.
+func (o *Options) arrangedFrames(x, y int, frames [][]byte) [][]byte {
+	arrangement := o.Palette.Planes
+	if arrangement == "separate" {
+		arrangement = "concat"
+	}
+	arranged := make([][]byte, len(frames))
+	for i, frame := range frames {
+		arranged[i] = arrangePlanes(arrangement, SplitPlanes(x, y, o.Palette, frame))
+	}
+	return arranged
+}
+
+// joinFrames packs frames whose planes are arranged as arrangement back into
+// x by y images packed for p
+func joinFrames(x, y int, p *Palette, arrangement string, frames [][]byte) [][]byte {
+	joined := make([][]byte, len(frames))
+	for i, frame := range frames {
+		joined[i] = JoinPlanes(x, y, p, unarrangePlanes(arrangement, p.Depth, frame))
+	}
+	return joined
+}
+
+// readPlanes returns the frames of the image at path whose planes were
+// written separately, joined, and their size: the one in their headers, or
+// else x by y
+func (o *Options) readPlanes(path string, x, y int) (int, int, [][]byte, error) {
+	var planes [][][]byte
+	for _, name := range planeNames(o.Palette) {
+		data, err := ReadInput(planePath(path, name))
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		px, py, frames, err := o.readBin(planePath(path, name), data, x, y, MonoPalette)
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("plane %s: %w", name, err)
+		}
+		if len(planes) > 0 && (px != x || py != y || len(frames) != len(planes[0])) {
+			return 0, 0, nil, fmt.Errorf("plane %s: %w: it holds %d %dx%d frame(s), the first plane %d %dx%d", name, errSize, len(frames), px, py, len(planes[0]), x, y)
+		}
+		x, y, planes = px, py, append(planes, frames)
+	}
+	frames := make([][]byte, len(planes[0]))
+	for i := range frames {
+		frame := make([][]byte, len(planes))
+		for k := range planes {
+			frame[k] = planes[k][i]
+		}
+		frames[i] = JoinPlanes(x, y, o.Palette, frame)
+	}
+	return x, y, frames, nil
+}
+
+// checkPlanes checks that the conversion flags set along with -planes can be
+// used with it (the palette is checked by apply)
+func checkPlanes(opts *Options) error {
+	switch opts.Palette.Planes {
+	case "":
+		return nil
+	case "separate":
+		if opts.Output == stdinName {
+			return usagef("error: -planes separate writes a file per plane, it can't write to stdout")
+		}
+	}
+	switch {
+	case opts.hasOutMode("slideshow"):
+		return usagef("error: -outmode slideshow doesn't hold bit planes, -planes can't be used with it")
+	case opts.Bundle != "":
+		return usagef("error: -bundle doesn't hold bit planes, -planes can't be used with it")
+	case opts.Region != "":
+		return usagef("error: -region windows are cut on packed codes, not on the bit planes of -planes")
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeBWR writes a 16x16 black, white and red PNG to dir, and returns its
+// path along with its codes packed for the white,black,red palette
+func writeBWR(t *testing.T, dir string) (string, []byte) {
+	t.Helper()
+	colors := []color.Color{color.White, color.Black, color.RGBA{0xff, 0, 0, 0xff}}
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			img.Set(i, j, colors[(i*i+j)%3])
+		}
+	}
+	path := filepath.Join(dir, "bwr.png")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ParsePalette("white,black,red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, p.PackPalette(16, 16, img)
+}
+
+func TestPlanes(t *testing.T) {
+	dir := t.TempDir()
+	fixture, packed := writeBWR(t, dir)
+	p, _ := ParsePalette("white,black,red")
+	planes := SplitPlanes(16, 16, p, packed)
+	if got := JoinPlanes(16, 16, p, planes); !bytes.Equal(got, packed) {
+		t.Fatalf("expected the planes to join back into\n% x\ngot\n% x", packed, got)
+	}
+	// the black plane has the pixels coded 1, the red one those coded 2
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			code := (i*i + j) % 3
+			if bitAt(16, i, j, planes[0]) != (code == 1) || bitAt(16, i, j, planes[1]) != (code == 2) {
+				t.Fatalf("pixel (%d, %d): expected code %d in the planes", i, j, code)
+			}
+		}
+	}
+
+	decode := func(name string, args ...string) []byte {
+		t.Helper()
+		out := filepath.Join(dir, name+".png")
+		args = append([]string{"decode", "-palette", "white,black,red", "-ratio", "16x16", "-o", out}, args...)
+		if code, _, errOut := runCLI(t, append(args, filepath.Join(dir, name+".bin"))...); code != 0 {
+			t.Fatalf("decode %s: exit code %d: %s", name, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	convert := func(name string, args ...string) {
+		t.Helper()
+		args = append([]string{"-outmode", "bin", "-palette", "white,black,red", "-ratio", "16x16", "-disable-dithering", "-o", filepath.Join(dir, name+".bin")}, args...)
+		if code, _, errOut := runCLI(t, append(args, fixture)...); code != 0 {
+			t.Fatalf("%s: exit code %d: %s", name, code, errOut)
+		}
+	}
+	read := func(name string) []byte {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	convert("packed")
+	if got := read("packed.bin"); !bytes.Equal(got, packed) {
+		t.Fatalf("expected the fixture packed\n% x\ngot\n% x", packed, got)
+	}
+	want := decode("packed")
+
+	interleaved := make([]byte, 0, len(packed))
+	for i := range planes[0] {
+		interleaved = append(interleaved, planes[0][i], planes[1][i])
+	}
+	for _, tc := range []struct {
+		planes string
+		files  map[string][]byte
+	}{
+		{"separate", map[string][]byte{"separate_black.bin": planes[0], "separate_red.bin": planes[1]}},
+		{"concat", map[string][]byte{"concat.bin": slices.Concat(planes[0], planes[1])}},
+		{"interleave", map[string][]byte{"interleave.bin": interleaved}},
+	} {
+		for _, header := range []bool{false, true} {
+			name, args := tc.planes, []string{"-planes", tc.planes}
+			if header {
+				name, args = name+"-header", append(args, "-header")
+			}
+			convert(name, args...)
+			for file, data := range tc.files {
+				got := read(strings.Replace(file, tc.planes, name, 1))
+				if header {
+					h, payload, err := DecodeHeader(got)
+					if err != nil {
+						t.Fatal(err)
+					}
+					// separate planes are black and white images
+					wantDepth, wantPlanes := uint8(2), tc.planes
+					if tc.planes == "separate" {
+						wantDepth, wantPlanes = 1, ""
+					}
+					if h.Depth != wantDepth || h.Planes != wantPlanes {
+						t.Errorf("-planes %s: expected a %d bit header with planes %q, got %+v", tc.planes, wantDepth, wantPlanes, h)
+					}
+					got = payload
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("-planes %s: expected %s to hold\n% x\ngot\n% x", tc.planes, file, data, got)
+				}
+			}
+			// headers say how the planes are arranged, -planes does otherwise
+			decodeArgs := []string{"-planes", tc.planes}
+			if header && tc.planes != "separate" {
+				decodeArgs = nil
+			}
+			if got := decode(name, decodeArgs...); !bytes.Equal(got, want) {
+				t.Errorf("-planes %s, header %v: expected the planes to decode to the packed image's PNG", tc.planes, header)
+			}
+		}
+	}
+
+	code, out, errOut := runCLI(t, "inspect", "-show", "-palette", "white,black,red", filepath.Join(dir, "interleave-header.bin"))
+	if code != 0 || !strings.Contains(out, "planes: interleaved") {
+		t.Errorf("expected inspect to tell interleaved planes, got %d: %s%s", code, out, errOut)
+	}
+}
+
+func TestPlanesRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(8))
+	for _, n := range []int{3, 4, 5, 16} {
+		colors := []string{"black", "white"}
+		for i := 2; i < n; i++ {
+			colors = append(colors, fmt.Sprintf("#%02x%02x%02x", rng.Intn(256), i, rng.Intn(256)))
+		}
+		p, err := ParsePalette(strings.Join(colors, ","))
+		if err != nil {
+			t.Fatal(err)
+		}
+		packed := make([]byte, 24*16*p.Depth/8)
+		for i := 0; i < 24; i++ {
+			for j := 0; j < 16; j++ {
+				p.setCode(24, 16, i, j, byte(rng.Intn(n)), packed)
+			}
+		}
+		for _, arrangement := range []string{"concat", "interleave"} {
+			data := arrangePlanes(arrangement, SplitPlanes(24, 16, p, packed))
+			if len(data) != len(packed) {
+				t.Errorf("%d colors, %s: expected %d bytes, got %d", n, arrangement, len(packed), len(data))
+			}
+			if got := joinFrames(24, 16, p, arrangement, [][]byte{data})[0]; !bytes.Equal(got, packed) {
+				t.Errorf("%d colors, %s: expected the planes to join back into\n% x\ngot\n% x", n, arrangement, packed, got)
+			}
+		}
+	}
+}
+
+func TestPlaneNames(t *testing.T) {
+	for _, tc := range []struct {
+		palette string
+		want    []string
+	}{
+		{"white,black,red", []string{"black", "red"}},
+		{"#fff,#000,#ff0,#f00", []string{"black", "yellow"}},
+		{"white,black,#123456", []string{"black", "plane1"}},
+		// aqua and cyan are the same color
+		{"white,#abcdef,cyan,gray,black", []string{"plane0", "aqua", "black"}},
+	} {
+		p, err := ParsePalette(tc.palette)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := planeNames(p); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: expected planes %v, got %v", tc.palette, tc.want, got)
+		}
+	}
+}
+
+func TestPlanesFlag(t *testing.T) {
+	fixture, _ := writeBWR(t, t.TempDir())
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-planes", "split"}, "invalid -planes `split`"},
+		{[]string{"-planes", "concat"}, "only applies to -palette images of 3 colors or more"},
+		{[]string{"-planes", "concat", "-colors", "acep"}, "can't split the acep palette"},
+		{[]string{"-planes", "separate", "-palette", "white,black,red", "-outmode", "bin", "-o", "-"}, "can't write to stdout"},
+		{[]string{"-planes", "concat", "-palette", "white,black,red", "-outmode", "slideshow"}, "doesn't hold bit planes"},
+		{[]string{"-planes", "concat", "-palette", "white,black,red", "-outmode", "pbm"}, "only holds black and white images"},
+		{[]string{"-planes", "concat", "-palette", "white,black,red", "-outmode", "bin", "-ratio", "12x12"}, "divisible by 8"},
+	} {
+		args := append([]string{"-ratio", "16x16"}, tc.args...)
+		code, _, errOut := runCLI(t, append(args, fixture)...)
+		if code != exitUsage || !strings.Contains(errOut, tc.want) {
+			t.Errorf("%v: expected exit code %d and %q, got %d: %s", tc.args, exitUsage, tc.want, code, errOut)
+		}
+	}
+}
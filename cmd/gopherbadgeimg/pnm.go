@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func init() {
+	// P1-P3 are the ASCII ("plain") variants of P4-P6
+	for _, magic := range []string{"P1", "P2", "P3", "P4", "P5", "P6"} {
+		image.RegisterFormat("pnm", magic, decodePNM, decodePNMConfig)
+	}
+}
+
+// pnmHeader is the header of a Netpbm file
+type pnmHeader struct {
+	kind          byte // '1' to '6'
+	width, height int
+	maxval        int
+}
+
+// readPNMHeader reads the magic number, dimensions and (except for bitmaps)
+// the maximum sample value. Comments run from '#' to the end of the line and
+// may appear anywhere in the header.
+func readPNMHeader(r *bufio.Reader) (pnmHeader, error) {
+	var h pnmHeader
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return h, err
+	}
+	if magic[0] != 'P' || magic[1] < '1' || magic[1] > '6' {
+		return h, errors.New("pnm: invalid magic number")
+	}
+	h.kind = magic[1]
+	fields := []*int{&h.width, &h.height}
+	if h.kind != '1' && h.kind != '4' {
+		fields = append(fields, &h.maxval)
+	} else {
+		h.maxval = 1
+	}
+	for _, field := range fields {
+		v, err := readPNMInt(r)
+		if err != nil {
+			return h, fmt.Errorf("pnm: invalid header: %w", err)
+		}
+		*field = v
+	}
+	if h.width <= 0 || h.height <= 0 {
+		return h, fmt.Errorf("pnm: invalid dimensions %dx%d", h.width, h.height)
+	}
+	if h.maxval <= 0 || h.maxval > 65535 {
+		return h, fmt.Errorf("pnm: invalid maxval %d", h.maxval)
+	}
+	if h.kind >= '4' {
+		// a single whitespace character separates the header from the raster
+		if _, err := r.ReadByte(); err != nil {
+			return h, err
+		}
+	}
+	return h, nil
+}
+
+// skipPNMSpace skips whitespace and comments
+func skipPNMSpace(r *bufio.Reader) error {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return err
+		}
+		switch {
+		case b == '#':
+			if _, err := r.ReadString('\n'); err != nil {
+				return err
+			}
+		case b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f':
+		default:
+			return r.UnreadByte()
+		}
+	}
+}
+
+// readPNMInt reads a decimal number, skipping leading whitespace and comments
+func readPNMInt(r *bufio.Reader) (int, error) {
+	if err := skipPNMSpace(r); err != nil {
+		return 0, err
+	}
+	v, digits := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF && digits > 0 {
+			return v, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if b < '0' || b > '9' {
+			if digits == 0 {
+				return 0, fmt.Errorf("unexpected character %q", b)
+			}
+			return v, r.UnreadByte()
+		}
+		v = v*10 + int(b-'0')
+		digits++
+		if v > 1<<24 {
+			return 0, errors.New("number too large")
+		}
+	}
+}
+
+func decodePNMConfig(r io.Reader) (image.Config, error) {
+	h, err := readPNMHeader(bufio.NewReader(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	var model color.Model
+	switch {
+	case h.kind == '1' || h.kind == '4':
+		model = color.GrayModel
+	case (h.kind == '2' || h.kind == '5') && h.maxval < 256:
+		model = color.GrayModel
+	case h.kind == '2' || h.kind == '5':
+		model = color.Gray16Model
+	case h.maxval < 256:
+		model = color.RGBAModel
+	default:
+		model = color.RGBA64Model
+	}
+	return image.Config{ColorModel: model, Width: h.width, Height: h.height}, nil
+}
+
+// decodePNM decodes all six Netpbm formats.
+//
+// Bitmaps (P1, P4) become pure black and white gray images, where a set bit
+// is black. Samples of graymaps and pixmaps are scaled from 0-maxval to the
+// full range of an 8-bit image, or a 16-bit one when maxval doesn't fit a byte.
+func decodePNM(r io.Reader) (image.Image, error) {
+	br := bufio.NewReader(r)
+	h, err := readPNMHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	rect := image.Rect(0, 0, h.width, h.height)
+
+	if h.kind == '1' || h.kind == '4' {
+		img := image.NewGray(rect)
+		for y := 0; y < h.height; y++ {
+			var row []byte
+			if h.kind == '4' {
+				// rows are packed MSB first and padded to a whole byte
+				row = make([]byte, (h.width+7)/8)
+				if _, err := io.ReadFull(br, row); err != nil {
+					return nil, fmt.Errorf("pnm: truncated raster: %w", err)
+				}
+			}
+			for x := 0; x < h.width; x++ {
+				var set bool
+				if h.kind == '4' {
+					set = row[x/8]&(0x80>>uint(x%8)) != 0
+				} else {
+					// plain bitmaps may omit the whitespace between bits
+					if err := skipPNMSpace(br); err != nil {
+						return nil, fmt.Errorf("pnm: truncated raster: %w", err)
+					}
+					b, _ := br.ReadByte()
+					if b != '0' && b != '1' {
+						return nil, fmt.Errorf("pnm: invalid bit %q", b)
+					}
+					set = b == '1'
+				}
+				if !set {
+					img.Pix[y*img.Stride+x] = 0xFF
+				}
+			}
+		}
+		return img, nil
+	}
+
+	channels := 1
+	if h.kind == '3' || h.kind == '6' {
+		channels = 3
+	}
+	wide := h.maxval > 255
+	sample := func() (uint32, error) {
+		switch {
+		case h.kind <= '3':
+			v, err := readPNMInt(br)
+			return uint32(v), err
+		case wide:
+			hi, err := br.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			lo, err := br.ReadByte()
+			return uint32(hi)<<8 | uint32(lo), err
+		default:
+			b, err := br.ReadByte()
+			return uint32(b), err
+		}
+	}
+	scale := func(v uint32, max uint32) uint32 {
+		if v > uint32(h.maxval) {
+			v = uint32(h.maxval)
+		}
+		return (v*max + uint32(h.maxval)/2) / uint32(h.maxval)
+	}
+
+	var img image.Image
+	var set func(x, y int, s []uint32)
+	switch {
+	case channels == 1 && !wide:
+		gray := image.NewGray(rect)
+		img, set = gray, func(x, y int, s []uint32) { gray.SetGray(x, y, color.Gray{uint8(scale(s[0], 0xFF))}) }
+	case channels == 1:
+		gray := image.NewGray16(rect)
+		img, set = gray, func(x, y int, s []uint32) { gray.SetGray16(x, y, color.Gray16{uint16(scale(s[0], 0xFFFF))}) }
+	case !wide:
+		rgba := image.NewRGBA(rect)
+		img, set = rgba, func(x, y int, s []uint32) {
+			rgba.SetRGBA(x, y, color.RGBA{uint8(scale(s[0], 0xFF)), uint8(scale(s[1], 0xFF)), uint8(scale(s[2], 0xFF)), 0xFF})
+		}
+	default:
+		rgba := image.NewRGBA64(rect)
+		img, set = rgba, func(x, y int, s []uint32) {
+			rgba.SetRGBA64(x, y, color.RGBA64{uint16(scale(s[0], 0xFFFF)), uint16(scale(s[1], 0xFFFF)), uint16(scale(s[2], 0xFFFF)), 0xFFFF})
+		}
+	}
+	samples := make([]uint32, channels)
+	for y := 0; y < h.height; y++ {
+		for x := 0; x < h.width; x++ {
+			for c := range samples {
+				if samples[c], err = sample(); err != nil {
+					return nil, fmt.Errorf("pnm: truncated raster: %w", err)
+				}
+			}
+			set(x, y, samples)
+		}
+	}
+	return img, nil
+}
+
+// EncodePBM writes an image packed with layout as a raw (P4) PBM file, see
+// badgeimg.EncodePBM
+func EncodePBM(w io.Writer, x, y int, imgBits []byte, layout badgeimg.Layout) error {
+	return badgeimg.EncodePBM(w, x, y, imgBits, layout)
+}
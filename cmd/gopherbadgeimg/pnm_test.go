@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/color"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func TestPNMFormats(t *testing.T) {
+	black, white := color.RGBA{0, 0, 0, 0xFF}, color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	gray := func(v uint8) color.RGBA { return color.RGBA{v, v, v, 0xFF} }
+	bitmap := [][]color.RGBA{{black, white, black}, {white, black, white}}
+	// 0, 5 and 15 out of 15, and 0, 200 and 1000 out of 1000
+	graymap := [][]color.RGBA{{gray(0), gray(85), gray(255)}, {gray(255), gray(85), gray(0)}}
+	graymap16 := [][]color.RGBA{{gray(0), gray(51), gray(255)}, {gray(255), gray(51), gray(0)}}
+	pixmap := [][]color.RGBA{
+		{{0xFF, 0, 0, 0xFF}, {0, 0xFF, 0, 0xFF}, {0, 0, 0xFF, 0xFF}},
+		{black, white, gray(128)},
+	}
+	for _, tc := range []struct {
+		file     string
+		expected [][]color.RGBA
+	}{
+		{"testdata/p1.pbm", bitmap},
+		{"testdata/p4.pbm", bitmap},
+		{"testdata/p2.pgm", graymap},
+		{"testdata/p5.pgm", graymap16},
+		{"testdata/p3.ppm", pixmap},
+		{"testdata/p6.ppm", pixmap},
+		{"testdata/comments.pgm", graymap},
+	} {
+		src, err := LoadImg(tc.file)
+		if err != nil {
+			t.Errorf("%s: %v", tc.file, err)
+			continue
+		}
+		img := *src
+		if b := img.Bounds(); b.Dx() != 3 || b.Dy() != 2 {
+			t.Errorf("%s: expected 3x2, got %v", tc.file, b)
+			continue
+		}
+		for y, row := range tc.expected {
+			for x, want := range row {
+				r, g, b, a := img.At(x, y).RGBA()
+				got := color.RGBA{uint8(r >> 8), uint8(g >> 8), uint8(b >> 8), uint8(a >> 8)}
+				if got != want {
+					t.Errorf("%s: pixel (%d, %d): expected %v, got %v", tc.file, x, y, want, got)
+				}
+			}
+		}
+	}
+}
+
+func TestPNMBitmapIsLossless(t *testing.T) {
+	opts := NewOptions()
+
+	src, err := LoadImg("testdata/p4.pbm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// black and white art must come out the same, dithered or not. Scaling
+	// the 3x2 bitmap to 3x8 repeats each row four times
+	expected := [][]bool{{true, false, true}, {false, true, false}}
+	for _, disabled := range []bool{true, false} {
+		opts.DisableDithering = disabled
+		imgBits := opts.ImgToBytes(3, 8, src)
+		for j := 0; j < 8; j++ {
+			for i := 0; i < 3; i++ {
+				if got := bitAt(8, i, j, imgBits); got != expected[j/4][i] {
+					t.Errorf("dithering disabled %v: pixel (%d, %d): expected %v, got %v", disabled, i, j, expected[j/4][i], got)
+				}
+			}
+		}
+	}
+}
+
+func TestEncodePBMRoundTrip(t *testing.T) {
+	// widths that do and don't fill whole bytes
+	for _, x := range []int{3, 13, 16, 246} {
+		y := 16
+		imgBits := make([]byte, x*y/8)
+		for i := range imgBits {
+			// an arbitrary but uneven pattern
+			imgBits[i] = byte(i*37 + 11)
+		}
+		var buf bytes.Buffer
+		if err := EncodePBM(&buf, x, y, imgBits, badgeimg.LayoutBadger); err != nil {
+			t.Fatal(err)
+		}
+		header := fmt.Sprintf("P4\n%d %d\n", x, y)
+		if expected := len(header) + (x+7)/8*y; buf.Len() != expected {
+			t.Errorf("%dx%d: expected %d bytes, got %d", x, y, expected, buf.Len())
+		}
+		img, err := decodePNM(&buf)
+		if err != nil {
+			t.Fatalf("%dx%d: %v", x, y, err)
+		}
+		for j := 0; j < y; j++ {
+			for i := 0; i < x; i++ {
+				r, _, _, _ := img.At(i, j).RGBA()
+				if black := r == 0; black != bitAt(y, i, j, imgBits) {
+					t.Fatalf("%dx%d: pixel (%d, %d): expected black to be %v", x, y, i, j, bitAt(y, i, j, imgBits))
+				}
+			}
+		}
+	}
+}
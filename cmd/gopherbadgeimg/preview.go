@@ -0,0 +1,66 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+)
+
+// gifMinDelay is the shortest frame delay browsers honor, in milliseconds.
+// Shorter ones are shown for 100ms instead, so the preview would lie.
+const gifMinDelay = 20
+
+// RenderPreview draws packed image bytes the way the panel will show them,
+// each pixel as a scale by scale square. It reads back the very bytes that
+// are written out, so what you see is exactly what the badge gets.
+func RenderPreview(x, y, scale int, p *Palette, imgBits []byte) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, x*scale, y*scale), color.Palette(p.Colors))
+	// reverse lookup from code to palette entry
+	index := map[byte]uint8{}
+	for i, code := range p.Codes {
+		index[code] = uint8(i)
+	}
+	for j := 0; j < y; j++ {
+		for i := 0; i < x; i++ {
+			entry := index[p.CodeAt(x, y, i, j, imgBits)]
+			for dy := 0; dy < scale; dy++ {
+				row := img.Pix[(j*scale+dy)*img.Stride:]
+				for dx := 0; dx < scale; dx++ {
+					row[i*scale+dx] = entry
+				}
+			}
+		}
+	}
+	return img
+}
+
+// writePreview writes the -preview PNG of a converted image
+func (o *Options) writePreview(path string, x, y int, imgBits []byte) error {
+	return o.writeFile(path, func(w io.Writer) error {
+		return png.Encode(w, RenderPreview(x, y, o.PreviewScale, o.Palette, imgBits))
+	})
+}
+
+// writePreviewGIF writes the -preview-gif animation of converted frames, each
+// shown for its original delay
+func (o *Options) writePreviewGIF(path string, x, y int, frames [][]byte, delays []int) error {
+	anim := &gif.GIF{}
+	clamped := false
+	for i, frame := range frames {
+		delay := delays[i]
+		if len(frames) > 1 && delay < gifMinDelay {
+			delay, clamped = gifMinDelay, true
+		}
+		anim.Image = append(anim.Image, RenderPreview(x, y, o.PreviewScale, o.Palette, frame))
+		// GIF delays are in hundredths of a second
+		anim.Delay = append(anim.Delay, (delay+5)/10)
+	}
+	if clamped {
+		logger.Warnf("frame delays under %dms were raised to %dms in %s, as browsers don't honor shorter ones", gifMinDelay, gifMinDelay, path)
+	}
+	return o.writeFile(path, func(w io.Writer) error {
+		return gif.EncodeAll(w, anim)
+	})
+}
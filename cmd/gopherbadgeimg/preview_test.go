@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func TestPreviewPNG(t *testing.T) {
+	src, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio = "none", "splash"
+	opts.Preview = filepath.Join(t.TempDir(), "preview.png")
+	opts.PreviewScale = 3
+	if _, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 246, 128); len(failed) != 0 {
+		t.Fatal("expected the preview to be written")
+	}
+	imgBits := opts.ImgToBytes(246, 128, src)
+
+	f, err := os.Open(opts.Preview)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	preview, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := preview.Bounds(); b.Dx() != 246*3 || b.Dy() != 128*3 {
+		t.Fatalf("expected a %dx%d preview, got %v", 246*3, 128*3, b)
+	}
+	for py := 0; py < 128*3; py++ {
+		for px := 0; px < 246*3; px++ {
+			r, g, b, _ := preview.At(px, py).RGBA()
+			if r != g || g != b || (r != 0 && r != 0xFFFF) {
+				t.Fatalf("pixel (%d, %d) is neither black nor white", px, py)
+			}
+			if black := r == 0; black != bitAt(128, px/3, py/3, imgBits) {
+				t.Fatalf("pixel (%d, %d) doesn't match the packed bit", px, py)
+			}
+		}
+	}
+}
+
+// TestPreviewAgrees checks that the data written, the previews and the
+// pictures of -show and diff agree on every pixel, for every layout and
+// palette at odd and even sizes: a random image of the colors of the palette
+// is packed, then drawn or unpacked by each of them, and any of them
+// disagreeing with it on a single pixel fails.
+func TestPreviewAgrees(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	tricolor, err := ParsePalette("black,white,red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*Palette{MonoPalette, ACePPalette, tricolor} {
+		for _, name := range badgeimg.LayoutNames {
+			layout, err := badgeimg.LookupLayout(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p != MonoPalette && layout != badgeimg.LayoutBadger {
+				continue
+			}
+			for _, x := range []int{1, 2, 3, 7, 8, 13, 16} {
+				for _, y := range []int{3, 4, 7, 8, 13, 16, 24} {
+					if p.Validate(x, y) != nil || layout.Validate(x, y) != nil {
+						continue
+					}
+					src := image.NewRGBA(image.Rect(0, 0, x, y))
+					for i := 0; i < x; i++ {
+						for j := 0; j < y; j++ {
+							src.Set(i, j, p.Colors[rng.Intn(len(p.Colors))])
+						}
+					}
+					opts := NewOptions()
+					opts.Palette, opts.Layout, opts.DisableDithering = p, layout, true
+					t.Run(fmt.Sprintf("%s/%s/%dx%d", p.Name, name, x, y), func(t *testing.T) {
+						testPreviewAgrees(t, opts, x, y, src)
+					})
+				}
+			}
+		}
+	}
+}
+
+func testPreviewAgrees(t *testing.T, opts *Options, x, y int, src *image.RGBA) {
+	var img image.Image = src
+	p := opts.Palette
+	packed := opts.ImgToBytes(x, y, &img)
+	white := p.Codes[p.Index(color.White)]
+	var diff strings.Builder
+	FprintDiff(&diff, x, y, p, packed, packed)
+	diffRows := strings.Split(diff.String(), "\n")
+	preview := RenderPreview(x, y, 1, p, packed)
+	planes := SplitPlanes(x, y, p, packed)
+	if joined := JoinPlanes(x, y, p, planes); !bytes.Equal(joined, packed) {
+		t.Errorf("the planes join back to % x, not % x", joined, packed)
+	}
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			want := p.Codes[p.Index(src.At(i, j))]
+			if got := p.CodeAt(x, y, i, j, packed); got != want {
+				t.Fatalf("pixel (%d, %d) is packed as %d, not %d", i, j, got, want)
+			}
+			if got := p.Codes[p.Index(preview.At(i, j))]; got != want {
+				t.Fatalf("the preview draws pixel (%d, %d) as %d, not %d", i, j, got, want)
+			}
+			if got := diffRows[j][i] == '*'; got != (want != white) {
+				t.Fatalf("the diff of the image with itself draws pixel (%d, %d) as %q", i, j, diffRows[j][i])
+			}
+			for k, plane := range planes {
+				if got := badgeimg.LayoutBadger.PixelAt(plane, x, y, i, j); got != (want&(1<<uint(k)) != 0) {
+					t.Fatalf("plane %d has pixel (%d, %d) set=%v, its code is %d", k, i, j, got, want)
+				}
+			}
+		}
+	}
+	if p != MonoPalette {
+		return
+	}
+
+	// black and white images are written repacked with -layout
+	written := opts.layoutBytes(x, y, packed)
+	unpacked, err := badgeimg.BytesToImg(x, y, written, opts.Layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shown bytes.Buffer
+	FprintImg(&shown, x, y, written, opts.Layout)
+	shownRows := strings.Split(shown.String(), "\n")
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			black := p.CodeAt(x, y, i, j, packed) == 1
+			if got := unpacked.GrayAt(i, j).Y == 0; got != black {
+				t.Fatalf("the data written unpacks pixel (%d, %d) as black=%v", i, j, got)
+			}
+			if got := shownRows[j][i] == '*'; got != black {
+				t.Fatalf("FprintImg draws pixel (%d, %d) as %q", i, j, shownRows[j][i])
+			}
+		}
+	}
+}
+
+func TestPreviewGIF(t *testing.T) {
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.DisableDithering = "none", "8x8", true
+	opts.PreviewGIF = filepath.Join(t.TempDir(), "preview.gif")
+	if _, failed := opts.ConvertAll([]string{"testdata/restore-background.gif"}, 8, 8); len(failed) != 0 {
+		t.Fatal("expected the preview to be written")
+	}
+	frames, err := opts.LoadFrames("testdata/restore-background.gif")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(opts.PreviewGIF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != len(frames) {
+		t.Fatalf("expected %d frames, got %d", len(frames), len(anim.Image))
+	}
+	for i, frame := range anim.Image {
+		if anim.Delay[i]*10 != frames[i].Delay {
+			t.Errorf("frame %d: expected a %dms delay, got %dms", i, frames[i].Delay, anim.Delay[i]*10)
+		}
+		imgBits := opts.ImgToBytes(8, 8, &frames[i].Image)
+		for j := 0; j < 8; j++ {
+			for k := 0; k < 8; k++ {
+				r, _, _, _ := frame.At(k, j).RGBA()
+				if black := r == 0; black != bitAt(8, k, j, imgBits) {
+					t.Errorf("frame %d: pixel (%d, %d) doesn't match the packed bit", i, k, j)
+				}
+			}
+		}
+	}
+}
+
+func TestPreviewGIFClampsDelays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preview.gif")
+	frame := make([]byte, 8)
+	if err := NewOptions().writePreviewGIF(path, 8, 8, [][]byte{frame, frame, frame}, []int{0, 10, 50}); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, expected := range []int{2, 2, 5} {
+		if anim.Delay[i] != expected {
+			t.Errorf("frame %d: expected a delay of %d, got %d", i, expected, anim.Delay[i])
+		}
+	}
+}
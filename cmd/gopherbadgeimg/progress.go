@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+)
+
+// progressModes are the values of -progress; the first is the default
+var progressModes = []string{"lines", "bar"}
+
+// progressBarWidth is how many cells the bar of -progress bar takes
+const progressBarWidth = 30
+
+// Progress is what Options.OnProgress is told each time ConvertInputs is done
+// with an input: Done of the Total inputs are, Input being the last of them,
+// which failed with Err or converted when it's nil.
+type Progress struct {
+	Done, Total int
+	Input       Input
+	Err         error
+}
+
+// status returns ok, or failed for an input that failed
+func (p Progress) status() string {
+	if p.Err != nil {
+		return "failed"
+	}
+	return "ok"
+}
+
+// progressReporter returns the OnProgress hook of -progress mode, which
+// reports on stderr. Lone inputs aren't reported, there's nothing to wait for.
+// The bar is only drawn when stderr is a terminal, lines are written instead
+// otherwise; while it is drawn, log messages go through it so that they don't
+// end up on top of it.
+func progressReporter(mode string) func(Progress) {
+	if mode == "bar" && stderrIsTerminal() {
+		bar := &progressBar{w: stderr}
+		log.SetOutput(bar)
+		return func(p Progress) {
+			if p.Total > 1 {
+				bar.update(p)
+			}
+		}
+	}
+	return func(p Progress) {
+		if p.Total > 1 {
+			logger.Infof("[%d/%d] %s %s", p.Done, p.Total, p.Input, p.status())
+		}
+	}
+}
+
+// progressBar draws the progress of a batch in place, on the last line of the
+// terminal. Everything else written to stderr must go through its Write,
+// which clears the bar first and draws it again after, since parallel
+// workers log while it is drawn.
+type progressBar struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line string
+}
+
+func (b *progressBar) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.line != "" {
+		io.WriteString(b.w, "\r\x1b[K")
+	}
+	n, err := b.w.Write(p)
+	if b.line != "" {
+		io.WriteString(b.w, b.line)
+	}
+	return n, err
+}
+
+// update draws the bar for p, leaving the line for good once every input is
+// done
+func (b *progressBar) update(p Progress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.line = renderProgressBar(p)
+	io.WriteString(b.w, "\r\x1b[K"+b.line)
+	if p.Done == p.Total {
+		io.WriteString(b.w, "\n")
+		b.line = ""
+	}
+}
+
+// renderProgressBar returns the bar of p, such as
+// "[=========>          ] 12/40 speakers/jane"
+func renderProgressBar(p Progress) string {
+	filled := progressBarWidth * p.Done / p.Total
+	cells := strings.Repeat("=", filled)
+	if filled < progressBarWidth {
+		cells += ">" + strings.Repeat(" ", progressBarWidth-filled-1)
+	}
+	return fmt.Sprintf("[%s] %d/%d %s", cells, p.Done, p.Total, p.Input)
+}
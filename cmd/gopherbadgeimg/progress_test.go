@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestConvertInputsProgress(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	inputs := []Input{
+		{Path: "alice.png", Name: filepath.Join(dir, "alice"), Data: png},
+		{Path: "broken.png", Name: filepath.Join(dir, "broken"), Data: []byte("this is not an image")},
+		{Path: "carol.png", Name: filepath.Join(dir, "carol"), Data: png},
+	}
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio = "bin", "profile"
+	var calls []Progress
+	opts.OnProgress = func(p Progress) {
+		// calls are serialized, so no lock is needed
+		calls = append(calls, p)
+	}
+	opts.ConvertInputs(inputs, 120, 128)
+	if len(calls) != len(inputs) {
+		t.Fatalf("expected %d calls, got %d", len(inputs), len(calls))
+	}
+	seen := map[string]bool{}
+	for i, p := range calls {
+		if p.Done != i+1 || p.Total != len(inputs) {
+			t.Errorf("call %d: expected %d/%d, got %d/%d", i, i+1, len(inputs), p.Done, p.Total)
+		}
+		if failed := p.Input.Path == "broken.png"; (p.Err != nil) != failed {
+			t.Errorf("%s: expected an error: %v, got %v", p.Input.Path, failed, p.Err)
+		}
+		seen[p.Input.Path] = true
+	}
+	if len(seen) != len(inputs) {
+		t.Errorf("expected every input to be reported once, got %v", seen)
+	}
+}
+
+func TestProgressLines(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"alice", "bob"} {
+		writeCheckerboard(t, filepath.Join(dir, name+".png"), 16, 16, 2, 2)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.png"), []byte("this is not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-outmode", "bin", "-ratio", "16x16", "-jobs", "1", filepath.Join(dir, "*.png")}
+	_, _, stderr := runCLI(t, args...)
+	var lines []string
+	line := regexp.MustCompile(`\[\d+/\d+\] .*`)
+	for _, l := range strings.Split(stderr, "\n") {
+		if match := line.FindString(l); match != "" {
+			lines = append(lines, match)
+		}
+	}
+	// inputs are named without their extension in a batch
+	want := []string{
+		"[1/3] " + filepath.Join(dir, "alice") + " ok",
+		"[2/3] " + filepath.Join(dir, "bob") + " ok",
+		"[3/3] " + filepath.Join(dir, "broken") + " failed",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("expected the lines\n%s\ngot\n%s", strings.Join(want, "\n"), stderr)
+	}
+
+	// a lone input has no progress, and -quiet silences it
+	_, _, stderr = runCLI(t, "-outmode", "bin", "-ratio", "16x16", filepath.Join(dir, "alice.png"))
+	if line.MatchString(stderr) {
+		t.Errorf("expected no progress for a lone input, got %q", stderr)
+	}
+	_, _, stderr = runCLI(t, append([]string{"-quiet"}, args...)...)
+	if line.MatchString(stderr) {
+		t.Errorf("expected no progress with -quiet, got %q", stderr)
+	}
+
+	// the bar is only drawn in a terminal
+	_, _, stderr = runCLI(t, append([]string{"-progress", "bar"}, args...)...)
+	if !strings.Contains(stderr, "[3/3] "+filepath.Join(dir, "broken")+" failed") || strings.Contains(stderr, "\r") {
+		t.Errorf("expected lines without a terminal, got %q", stderr)
+	}
+	if code, _, stderr := runCLI(t, "-progress", "dots", "-ratio", "16x16", filepath.Join(dir, "alice.png")); code != 2 || !strings.Contains(stderr, "-progress must be one of") {
+		t.Errorf("expected -progress dots to be refused, got %d: %s", code, stderr)
+	}
+}
+
+func TestProgressBar(t *testing.T) {
+	var out bytes.Buffer
+	bar := &progressBar{w: &out}
+	bar.update(Progress{Done: 1, Total: 2, Input: Input{Name: "alice"}})
+	bar.Write([]byte("warning\n"))
+	bar.update(Progress{Done: 2, Total: 2, Input: Input{Name: "bob"}})
+	bar.Write([]byte("done\n"))
+	half := "[" + strings.Repeat("=", 15) + ">" + strings.Repeat(" ", 14) + "] 1/2 alice"
+	full := "[" + strings.Repeat("=", 30) + "] 2/2 bob"
+	// messages clear the bar and draw it again, until it's finished
+	want := "\r\x1b[K" + half + "\r\x1b[Kwarning\n" + half + "\r\x1b[K" + full + "\ndone\n"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// Generated Go files end with a block recording what they were converted
+// from and how, so that an asset that looks wrong months later tells what
+// produced it, and -verify can check it against its source with nothing but
+// the file:
+//
+//	// gopherbadgeimg provenance:
+//	// source: splash.png
+//	// source-sha256: 5d41402abc4b2a76b9719d911017c592...
+//	// size: 246x128
+//	// dither: floyd-steinberg
+//	// threshold: none
+//	// invert: false
+//	// layout: badger
+//	// data-sha256: 7d793037a0760186574b0282f2f435e7...
+//	// tool: gopherbadgeimg v1.4.0
+//
+// Every key is written, one per line, in this order. The source is named by
+// its base name alone and nothing records where or when the file was
+// written, so that regenerating an unchanged image gives the same bytes on
+// every machine. The size is that of -ratio, before -region or -marquee, and
+// data-sha256 the hash of the packed frames, one after the other, before
+// -compress. Images that aren't read from a file of their own, from stdin,
+// URLs and archives or drawn by -text and -qr, have no block.
+//
+// Given Go files rather than images, -verify reads their block: it finds the
+// source next to the file, or else in the working directory, checks that it
+// hashes the same, then converts it again to the size, dithering, threshold
+// and inversion the block records and checks that the data does too. The
+// other flags, such as -palette, -layout and -frame, are those of the command
+// line, as for any -verify, and must pack with the layout of the block.
+
+// provenanceHeader starts the provenance block of generated Go files
+const provenanceHeader = "// gopherbadgeimg provenance:"
+
+// provenanceKeys are the keys of the provenance block, in order
+var provenanceKeys = []string{"source", "source-sha256", "size", "dither", "threshold", "invert", "layout", "data-sha256", "tool"}
+
+// errNoProvenance is returned by ParseProvenance for files without a
+// provenance block
+var errNoProvenance = errors.New("no provenance block")
+
+// Provenance is what a generated Go file records of the conversion that
+// wrote it, see above
+type Provenance struct {
+	// Source is the base name of the image converted
+	Source string
+	// SourceSHA256 is the hex SHA-256 of the image file
+	SourceSHA256 string
+	// Size is the size the image was converted to
+	Size Ratio
+	// Dither is the dithering algorithm, none, or matrix with -dither-matrix
+	Dither string
+	// Threshold is the -threshold black and white images were cut at, auto,
+	// or none
+	Threshold string
+	Invert    bool
+	// Layout is the order pixels are packed in, as in the manifest
+	Layout string
+	// DataSHA256 is the hex SHA-256 of the packed frames
+	DataSHA256 string
+	// Tool is the version of gopherbadgeimg that wrote the file
+	Tool string
+}
+
+// String returns the provenance block, after a blank line
+func (p *Provenance) String() string {
+	values := []string{p.Source, p.SourceSHA256, p.Size.String(), p.Dither, p.Threshold, strconv.FormatBool(p.Invert), p.Layout, p.DataSHA256, p.Tool}
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s\n", provenanceHeader)
+	for i, key := range provenanceKeys {
+		fmt.Fprintf(&b, "// %s: %s\n", key, values[i])
+	}
+	return b.String()
+}
+
+// ParseProvenance reads back the provenance block of a generated Go file
+func ParseProvenance(src []byte) (*Provenance, error) {
+	i := bytes.LastIndex(src, []byte("\n"+provenanceHeader+"\n"))
+	if i < 0 {
+		return nil, errNoProvenance
+	}
+	values := map[string]string{}
+	for _, line := range strings.Split(string(src[i+len(provenanceHeader)+2:]), "\n") {
+		text, ok := strings.CutPrefix(line, "// ")
+		if !ok {
+			break
+		}
+		key, value, ok := strings.Cut(text, ": ")
+		if !ok {
+			return nil, fmt.Errorf("invalid provenance line `%s`, use key: value", line)
+		}
+		values[key] = value
+	}
+	for _, key := range provenanceKeys {
+		if values[key] == "" {
+			return nil, fmt.Errorf("the provenance block has no %s", key)
+		}
+	}
+	size, err := ParseRatio(values["size"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid provenance size `%s`", values["size"])
+	}
+	invert, err := strconv.ParseBool(values["invert"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid provenance invert `%s`", values["invert"])
+	}
+	return &Provenance{
+		Source:       values["source"],
+		SourceSHA256: values["source-sha256"],
+		Size:         size,
+		Dither:       values["dither"],
+		Threshold:    values["threshold"],
+		Invert:       invert,
+		Layout:       values["layout"],
+		DataSHA256:   values["data-sha256"],
+		Tool:         values["tool"],
+	}, nil
+}
+
+// withProvenance returns a copy of o whose Go files record the conversion
+// of in, read as data, to size, packed as frames. It is o itself when in
+// isn't read from a file of its own.
+func (o *Options) withProvenance(in Input, data []byte, size Ratio, frames [][]byte) *Options {
+	if in.Data != nil || in.Draw != nil || in.Path == stdinName || IsURL(in.Path) {
+		return o
+	}
+	p := &Provenance{
+		Source:       filepath.Base(in.Path),
+		SourceSHA256: sha256Hex(data),
+		Size:         size,
+		Dither:       o.Dither,
+		Threshold:    "none",
+		Invert:       o.Invert,
+		Layout:       o.layoutName(),
+		DataSHA256:   sha256Hex(bytes.Join(frames, nil)),
+		Tool:         toolVersion(),
+	}
+	if o.DitherMatrix != nil {
+		p.Dither = "matrix"
+	}
+	if o.DisableDithering {
+		p.Dither = "none"
+	}
+	switch {
+	case o.Threshold == badgeimg.ThresholdAuto && o.Palette == MonoPalette:
+		p.Threshold = "auto"
+	case o.Threshold > 0 && o.Palette == MonoPalette:
+		p.Threshold = strconv.Itoa(o.Threshold)
+	}
+	recorded := *o
+	recorded.provenance = p
+	return &recorded
+}
+
+// provenanceOptions returns a copy of o converting as p records
+func (o *Options) provenanceOptions(p *Provenance) (*Options, error) {
+	opts := *o
+	opts.Ratio, opts.Transpose = p.Size.String(), false
+	opts.Invert, opts.Threshold = p.Invert, 0
+	if p.Threshold != "none" {
+		threshold, err := parseThreshold(p.Threshold)
+		if err != nil {
+			return nil, fmt.Errorf("invalid provenance threshold `%s`: %w", p.Threshold, err)
+		}
+		opts.Threshold = threshold
+	}
+	switch p.Dither {
+	case "none":
+		opts.DisableDithering = true
+	case "matrix":
+		// the kernel itself isn't recorded
+		if o.DitherMatrix == nil {
+			return nil, errors.New("it was dithered with -dither-matrix, give the same one to verify it")
+		}
+	default:
+		opts.Dither, opts.DisableDithering, opts.DitherMatrix = p.Dither, false, nil
+	}
+	if err := checkImage(&opts); err != nil {
+		return nil, unprefixed(err)
+	}
+	if layout := opts.layoutName(); layout != p.Layout {
+		return nil, fmt.Errorf("it was packed %s, not %s: give the -palette, -planes and -layout it was generated with", p.Layout, layout)
+	}
+	return &opts, nil
+}
+
+// verifyProvenance checks the Go file at path against the source its
+// provenance block names, see above
+func (o *Options) verifyProvenance(path string) error {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return classify(errInput, err)
+	}
+	p, err := ParseProvenance(src)
+	if err != nil {
+		return err
+	}
+	source := filepath.Join(filepath.Dir(path), p.Source)
+	if _, err := os.Stat(source); errors.Is(err, fs.ErrNotExist) {
+		source = p.Source
+	}
+	data, err := ReadInput(source)
+	if err != nil {
+		return err
+	}
+	if sha256Hex(data) != p.SourceSHA256 {
+		return fmt.Errorf("out of date: %s has changed since it was generated", source)
+	}
+	opts, err := o.provenanceOptions(p)
+	if err != nil {
+		return err
+	}
+	in := Input{Path: source}
+	frames, err := opts.decodeFrames(data, opts.picksFrame)
+	if err != nil {
+		return decodeFailed(fmt.Errorf("loading %s: %w", source, err))
+	}
+	if frames, err = opts.pickFrames(in, frames); err != nil {
+		return err
+	}
+	packed, _, _, _, err := opts.packFrames(in, frames, p.Size.Width, p.Size.Height)
+	if err != nil {
+		return err
+	}
+	if sha256Hex(bytes.Join(packed, nil)) != p.DataSHA256 {
+		err := fmt.Errorf("out of date: %s converts to other data with the settings it records and the flags given", source)
+		if p.Tool != toolVersion() {
+			err = fmt.Errorf("%w, it was generated by %s", err, p.Tool)
+		}
+		return err
+	}
+	logger.Debugf("%s is up to date with %s", path, source)
+	return nil
+}
+
+// verifyGoFiles checks the Go files at paths against their sources
+func (o *Options) verifyGoFiles(paths []string) error {
+	var failed []error
+	for _, path := range paths {
+		if err := o.verifyProvenance(path); err != nil {
+			logger.Errorf("error verifying %s: %v", path, unprefixed(err))
+			failed = append(failed, err)
+		}
+	}
+	return failures(failed)
+}
+
+// isGoFile reports whether path is a Go file, which -verify checks against
+// its provenance rather than converting
+func isGoFile(path string) bool {
+	return strings.HasSuffix(path, ".go")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProvenance(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "board.png")
+	writeCheckerboard(t, src, 32, 32, 2, 2)
+	goFile := filepath.Join(dir, "out", "board-generated.go")
+	if err := os.Mkdir(filepath.Dir(goFile), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	args := []string{"-outmode", "rice", "-var", "board", "-ratio", "32x16", "-threshold", "100", "-invert", "-o", goFile, src}
+	if code, _, errOut := runCLI(t, args...); code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	content, err := os.ReadFile(goFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, block, _ := strings.Cut(string(content), provenanceHeader); strings.Contains(block, dir) {
+		t.Errorf("expected the source to be named by its base name alone, got\n%s", block)
+	}
+	p, err := ParseProvenance(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Provenance{
+		Source:       "board.png",
+		SourceSHA256: sha256Hex(data),
+		Size:         Ratio{32, 16},
+		Dither:       "floyd-steinberg",
+		Threshold:    "100",
+		Invert:       true,
+		Layout:       "badger",
+		DataSHA256:   p.DataSHA256,
+		Tool:         toolVersion(),
+	}
+	if *p != want {
+		t.Errorf("expected %+v, got %+v", want, *p)
+	}
+	if !strings.HasSuffix(string(content), "\n\n"+p.String()[1:]) {
+		t.Errorf("expected the file to end with its provenance block, got\n%s", content)
+	}
+
+	// the library writes the same block
+	written := filepath.Join(dir, "lib.go")
+	if err := WriteToGoFileWithProvenance(written, "board", []byte{0xff}, p); err != nil {
+		t.Fatal(err)
+	}
+	content, err = os.ReadFile(written)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ParseProvenance(content); err != nil || *got != *p {
+		t.Errorf("expected WriteToGoFileWithProvenance to record %+v, got %+v, %v", *p, got, err)
+	}
+
+	// the source is looked for next to the file, then in the working
+	// directory
+	if code, _, errOut := runCLI(t, "-verify", goFile); code != exitInput || !strings.Contains(errOut, "open board.png") {
+		t.Errorf("expected exit code %d for a source in neither, got %d: %s", exitInput, code, errOut)
+	}
+	moved := filepath.Join(dir, "board-generated.go")
+	if err := os.Rename(goFile, moved); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := runCLI(t, "-verify", moved); code != 0 {
+		t.Errorf("expected the Go file to match its source, got exit code %d: %s", code, errOut)
+	}
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-layout", "ssd1306"}, "it was packed badger, not ssd1306"},
+		{[]string{"-dither-matrix", "testdata/atkinson.json", "-disable-dithering"}, ""},
+		{[]string{"-frame", "1"}, "frame 1 requested but the image only has 1 frame(s)"},
+	} {
+		code, _, errOut := runCLI(t, append(append([]string{"-verify"}, test.args...), moved)...)
+		switch {
+		case test.want == "" && code != 0:
+			t.Errorf("%v: expected the recorded settings to win, got exit code %d: %s", test.args, code, errOut)
+		case test.want != "" && (code != 1 || !strings.Contains(errOut, test.want)):
+			t.Errorf("%v: expected exit code 1 and %q, got %d: %s", test.args, test.want, code, errOut)
+		}
+	}
+
+	// data that no longer matches, and a source that changed
+	content, err = os.ReadFile(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := filepath.Join(dir, "tampered-generated.go")
+	if err := os.WriteFile(tampered, []byte(strings.Replace(string(content), "invert: true", "invert: false", 1)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, _, errOut := runCLI(t, "-verify", tampered)
+	if code != 1 || !strings.Contains(errOut, "error verifying "+tampered+": out of date: "+src+" converts to other data") {
+		t.Errorf("expected the data not to match without -invert, got %d: %s", code, errOut)
+	}
+	writeCheckerboard(t, src, 32, 32, 4, 4)
+	code, _, errOut = runCLI(t, "-verify", moved)
+	if code != 1 || !strings.Contains(errOut, src+" has changed since it was generated") {
+		t.Errorf("expected the source to have changed, got %d: %s", code, errOut)
+	}
+}
+
+func TestProvenanceErrors(t *testing.T) {
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{"package main\n", "no provenance block"},
+		{"package main\n\n" + provenanceHeader + "\n// source: a.png\n", "has no source-sha256"},
+		{"package main\n\n" + provenanceHeader + "\n// source a.png\n", "invalid provenance line `// source a.png`"},
+	} {
+		if _, err := ParseProvenance([]byte(tc.src)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: expected %q, got %v", tc.src, tc.want, err)
+		}
+	}
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "board.png")
+	writeCheckerboard(t, src, 16, 16, 2, 2)
+	// images drawn or read from stdin have no source to record
+	if code, _, errOut := runCLI(t, "-outmode", "rice", "-ratio", "32x16", "-text", "HI", "-o", filepath.Join(dir, "text.go")); code != 0 {
+		t.Fatalf("exit code %d: %s", code, errOut)
+	}
+	code, _, errOut := runCLI(t, "-verify", filepath.Join(dir, "text.go"))
+	if code != 1 || !strings.Contains(errOut, "no provenance block") {
+		t.Errorf("expected -text files to have no provenance block, got %d: %s", code, errOut)
+	}
+	code, _, errOut = runCLI(t, "-verify", "-outmode", "rice", "-ratio", "16x16", filepath.Join(dir, "text.go"), src)
+	if code != exitUsage || !strings.Contains(errOut, "can't be mixed with other inputs") {
+		t.Errorf("expected exit code %d mixing Go files and images, got %d: %s", exitUsage, code, errOut)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// pythonLineWidth is the column generated Python code is wrapped at
+const pythonLineWidth = 80
+
+// FprintPython writes packed images as a MicroPython module, ready for
+// badger2040.image(name, NAME_WIDTH, NAME_HEIGHT, x, y).
+//
+// The data is written as bytes([0x.., ...]), or as a b"\x.." literal when
+// literal is set, which MicroPython parses with far less memory. Several
+// frames become a list, with their delays in NAME_DELAYS if they have any. The
+// module starts with header.
+func FprintPython(w io.Writer, header, name string, x, y int, frames [][]byte, delays []int, literal bool) error {
+	upper := strings.ToUpper(name)
+
+	var b strings.Builder
+	b.WriteString(header)
+	fmt.Fprintf(&b, "%s_WIDTH = %d\n%s_HEIGHT = %d\n", upper, x, upper, y)
+
+	// writeData writes one frame, every line starting with indent
+	writeData := func(data []byte, indent string) {
+		if literal {
+			// each line is a b"..." piece, which Python joins together
+			b.WriteString("(\n")
+			perLine := (pythonLineWidth - len(indent) - 4 - len(`b""`)) / 4
+			for i := 0; i < len(data); i += perLine {
+				b.WriteString(indent + `    b"`)
+				for _, v := range data[i:min(i+perLine, len(data))] {
+					fmt.Fprintf(&b, `\x%02x`, v)
+				}
+				b.WriteString("\"\n")
+			}
+			b.WriteString(indent + ")")
+			return
+		}
+		b.WriteString("bytes([\n")
+		perLine := (pythonLineWidth - len(indent) - 4 + 1) / len("0x00, ")
+		for i := 0; i < len(data); i += perLine {
+			values := make([]string, 0, perLine)
+			for _, v := range data[i:min(i+perLine, len(data))] {
+				values = append(values, fmt.Sprintf("0x%02x,", v))
+			}
+			b.WriteString(indent + "    " + strings.Join(values, " ") + "\n")
+		}
+		b.WriteString(indent + "])")
+	}
+
+	if len(frames) == 1 {
+		fmt.Fprintf(&b, "\n%s = ", name)
+		writeData(frames[0], "")
+		b.WriteString("\n")
+	} else {
+		if delays != nil {
+			fmt.Fprintf(&b, "%s_DELAYS = [", upper)
+			for i, d := range delays {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "%d", d)
+			}
+			b.WriteString("]  # milliseconds\n\n")
+		}
+		fmt.Fprintf(&b, "%s = [\n", name)
+		for _, frame := range frames {
+			b.WriteString("    ")
+			writeData(frame, "    ")
+			b.WriteString(",\n")
+		}
+		b.WriteString("]\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
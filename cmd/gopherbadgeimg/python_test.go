@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// readPythonBytes is a minimal reader for the Python literals FprintPython
+// writes: it returns the value assigned to name, either bytes([...]) or a
+// parenthesized run of b"\x.." pieces.
+func readPythonBytes(src, name string) ([]byte, error) {
+	start := regexp.MustCompile(`(?m)^` + name + ` = (bytes\(\[|\()\n`).FindStringSubmatchIndex(src)
+	if start == nil {
+		return nil, fmt.Errorf("no assignment to %s", name)
+	}
+	var data []byte
+	for _, line := range strings.Split(src[start[1]:], "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "])" || line == ")":
+			return data, nil
+		case strings.HasPrefix(line, `b"`) && strings.HasSuffix(line, `"`):
+			for _, esc := range strings.Split(line[2:len(line)-1], `\x`)[1:] {
+				v, err := strconv.ParseUint(esc, 16, 8)
+				if err != nil {
+					return nil, err
+				}
+				data = append(data, byte(v))
+			}
+		default:
+			for _, field := range strings.Fields(line) {
+				v, err := strconv.ParseUint(strings.TrimSuffix(field, ","), 0, 8)
+				if err != nil {
+					return nil, err
+				}
+				data = append(data, byte(v))
+			}
+		}
+	}
+	return nil, fmt.Errorf("%s is never closed", name)
+}
+
+func TestPython(t *testing.T) {
+	src, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	imgBits := NewOptions().ImgToBytes(246, 128, src)
+
+	for _, literal := range []bool{false, true} {
+		var buf bytes.Buffer
+		if err := FprintPython(&buf, "", "splash", 246, 128, [][]byte{imgBits}, nil, literal); err != nil {
+			t.Fatal(err)
+		}
+		module := buf.String()
+		for _, constant := range []string{"SPLASH_WIDTH = 246\n", "SPLASH_HEIGHT = 128\n"} {
+			if !strings.Contains(module, constant) {
+				t.Errorf("literal %v: expected %q", literal, constant)
+			}
+		}
+		for i, line := range strings.Split(module, "\n")[1:] {
+			if len(line) > pythonLineWidth {
+				t.Errorf("literal %v: line %d is %d columns wide", literal, i+2, len(line))
+			}
+		}
+		data, err := readPythonBytes(module, "splash")
+		if err != nil {
+			t.Fatalf("literal %v: %v", literal, err)
+		}
+		if !bytes.Equal(data, imgBits) {
+			t.Errorf("literal %v: expected the bin output back, got %d bytes that differ", literal, len(data))
+		}
+	}
+}
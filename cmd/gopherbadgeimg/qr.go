@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// -qr draws a QR code rather than converting one made elsewhere, whose
+// modules would come out of scaling as uneven blobs: each module is a square
+// of a whole number of pixels, as large as the ratio allows around a quiet
+// zone, and the code is centered. It is converted without dithering, so that
+// it is packed exactly as drawn.
+
+// qrQuietZone is the blank margin a QR code needs around it, in modules
+const qrQuietZone = 4
+
+// qrLevels are the error correction levels of -qr-level, from the least to
+// the most tolerant of damage
+const qrLevels = "LMQH"
+
+// qrInput returns the input drawing the QR code of -qr
+func (o *Options) qrInput() (Input, error) {
+	level := strings.Index(qrLevels, strings.ToUpper(o.QRLevel))
+	if level < 0 || len(o.QRLevel) != 1 {
+		return Input{}, usagef("error: invalid -qr-level `%s`, expected one of L, M, Q or H", o.QRLevel)
+	}
+	code, err := qr.Encode(o.QR, qr.Level(level))
+	if err != nil {
+		return Input{}, fmt.Errorf("error: -qr is %d bytes, more than a QR code holds at level %s: use a lower -qr-level or shorter content", len(o.QR), strings.ToUpper(o.QRLevel))
+	}
+	return Input{Path: "-qr", Data: []byte(o.QR), Draw: func(x, y int) (image.Image, error) {
+		return drawQR(code, x, y)
+	}}, nil
+}
+
+// drawQR draws code x by y with modules as large as fit around its quiet
+// zone, black on white
+func drawQR(code *qr.Code, x, y int) (image.Image, error) {
+	side := code.Size + 2*qrQuietZone
+	module := min(x, y) / side
+	if module == 0 {
+		return nil, fmt.Errorf("error: the QR code is %d modules wide, %d with its quiet zone, which doesn't fit in %dx%d: use a larger -ratio, a lower -qr-level or shorter content", code.Size, side, x, y)
+	}
+	img := image.NewGray(image.Rect(0, 0, x, y))
+	draw.Draw(img, img.Rect, image.White, image.Point{}, draw.Src)
+	left, top := (x-code.Size*module)/2, (y-code.Size*module)/2
+	for my := range code.Size {
+		for mx := range code.Size {
+			if code.Black(mx, my) {
+				r := image.Rect(0, 0, module, module).Add(image.Pt(left+mx*module, top+my*module))
+				draw.Draw(img, r, image.NewUniform(color.Black), image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"rsc.io/qr"
+)
+
+func TestQR(t *testing.T) {
+	const url = "https://example.com/jane"
+	out := filepath.Join(t.TempDir(), "qr.bin")
+	// dithering must not turn the edges of modules into noise
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "128x128", "-dither", "atkinson", "-qr", url, "-o", out); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := badgeimg.BytesToImg(128, 128, data, badgeimg.LayoutBadger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := qr.Encode(url, qr.M)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 25 modules and a quiet zone of 4 on each side fit 3 pixels per module
+	module := 128 / (code.Size + 2*qrQuietZone)
+	offset := (128 - code.Size*module) / 2
+	if module != 3 {
+		t.Fatalf("expected 3 pixels per module, got %d", module)
+	}
+	black := func(mx, my int) bool {
+		return img.GrayAt(offset+mx*module, offset+my*module).Y == 0
+	}
+
+	// every pixel of a module is the same, and matches the code
+	for my := range code.Size {
+		for mx := range code.Size {
+			for py := range module {
+				for px := range module {
+					got := img.GrayAt(offset+mx*module+px, offset+my*module+py).Y == 0
+					if got != code.Black(mx, my) {
+						t.Fatalf("expected pixel %d,%d of module %d,%d to be black: %v", px, py, mx, my, code.Black(mx, my))
+					}
+				}
+			}
+		}
+	}
+	// the three finder patterns: a black ring, a white ring and a 3x3 center
+	for _, corner := range [][2]int{{0, 0}, {code.Size - 7, 0}, {0, code.Size - 7}} {
+		for my := range 7 {
+			for mx := range 7 {
+				ring := min(mx, my, 6-mx, 6-my)
+				if want := ring != 1; black(corner[0]+mx, corner[1]+my) != want {
+					t.Errorf("expected module %d,%d of the finder pattern at %v to be black: %v", mx, my, corner, want)
+				}
+			}
+		}
+	}
+	// and a quiet zone all around
+	for p := range 128 {
+		for _, at := range [][2]int{{p, offset - 1}, {p, offset + code.Size*module}, {offset - 1, p}, {offset + code.Size*module, p}} {
+			if img.GrayAt(at[0], at[1]).Y == 0 {
+				t.Fatalf("expected the quiet zone to be blank, got a black pixel at %v", at)
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		args []string
+		code int
+		err  string
+	}{
+		{[]string{"-ratio", "32x32", "-qr", url}, exitFailure, "which doesn't fit in 32x32"},
+		{[]string{"-ratio", "128x128", "-qr-level", "H", "-qr", strings.Repeat("jane", 1000)}, exitFailure, "more than a QR code holds at level H"},
+		{[]string{"-ratio", "128x128", "-qr-level", "X", "-qr", url}, exitUsage, "invalid -qr-level"},
+		{[]string{"-ratio", "128x128", "-qr", url, "-text", "JANE"}, exitUsage, "cannot be combined"},
+	} {
+		code, _, errOut := runCLI(t, append([]string{"-outmode", "bin"}, tc.args...)...)
+		if code != tc.code || !strings.Contains(errOut, tc.err) {
+			t.Errorf("%v: expected exit code %d and %q, got %d and\n%s", tc.args, tc.code, tc.err, code, errOut)
+		}
+	}
+}
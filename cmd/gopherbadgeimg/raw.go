@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"slices"
+	"strings"
+)
+
+// -raw WxH:FORMAT reads inputs as headerless framebuffer dumps instead of
+// decoding them, such as those of a display driver or of another tool: W by
+// H pixels, row by row, in one of rawFormats. The data must be exactly the
+// size that makes, and is then converted like any image.
+//
+// rgb565 is little-endian, as MCUs write it out of their framebuffers;
+// rgb565be reads the big-endian order SPI displays are sent instead.
+
+// rawFormats are the pixel formats of -raw, and their size in bytes
+var rawFormats = map[string]int{
+	"gray8":    1,
+	"rgb24":    3,
+	"rgba32":   4,
+	"rgb565":   2,
+	"rgb565le": 2,
+	"rgb565be": 2,
+}
+
+// rawFormatNames returns the names of rawFormats, sorted
+func rawFormatNames() []string {
+	names := make([]string, 0, len(rawFormats))
+	for name := range rawFormats {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// parseRaw parses the WxH:FORMAT of -raw
+func parseRaw(s string) (w, h int, format string, err error) {
+	size, format, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, "", fmt.Errorf("error: invalid -raw `%s`, expected WxH:FORMAT such as 320x240:rgb565", s)
+	}
+	if w, h, err = parseCells("-raw", size); err != nil {
+		return 0, 0, "", err
+	}
+	if _, ok := rawFormats[format]; !ok {
+		return 0, 0, "", fmt.Errorf("error: invalid -raw format `%s`, use one of: %s", format, strings.Join(rawFormatNames(), ", "))
+	}
+	return w, h, format, nil
+}
+
+// decodeRaw wraps data, a framebuffer of -raw, in an image
+func (o *Options) decodeRaw(data []byte) (image.Image, error) {
+	w, h, format, err := parseRaw(o.Raw)
+	if err != nil {
+		// flags are validated up front, this is a programming error
+		panic(err)
+	}
+	if err := checkPixels(w, h); err != nil {
+		return nil, err
+	}
+	size := rawFormats[format]
+	if want := w * h * size; len(data) != want {
+		return nil, fmt.Errorf("a %dx%d %s framebuffer is %d bytes (%d per pixel), got %d", w, h, format, want, size, len(data))
+	}
+	r := image.Rect(0, 0, w, h)
+	switch format {
+	case "gray8":
+		return &image.Gray{Pix: data, Stride: w, Rect: r}, nil
+	case "rgba32":
+		return &image.NRGBA{Pix: data, Stride: w * 4, Rect: r}, nil
+	}
+	img := image.NewRGBA(r)
+	for i := range w * h {
+		var c color.RGBA
+		switch format {
+		case "rgb24":
+			c = color.RGBA{data[i*3], data[i*3+1], data[i*3+2], 0xff}
+		case "rgb565be":
+			c = rgb565(uint16(data[i*2])<<8 | uint16(data[i*2+1]))
+		default:
+			c = rgb565(uint16(data[i*2]) | uint16(data[i*2+1])<<8)
+		}
+		img.SetRGBA(i%w, i/w, c)
+	}
+	return img, nil
+}
+
+// rgb565 expands a 16 bit color to 8 bits per channel, repeating the top
+// bits of each in the ones it lacks so that white stays white
+func rgb565(v uint16) color.RGBA {
+	r, g, b := uint8(v>>11), uint8(v>>5&0x3f), uint8(v&0x1f)
+	return color.RGBA{r<<3 | r>>2, g<<2 | g>>4, b<<3 | b>>2, 0xff}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRGB565(t *testing.T) {
+	for _, test := range []struct {
+		v    uint16
+		want color.RGBA
+	}{
+		{0x0000, color.RGBA{0, 0, 0, 0xff}},
+		{0xffff, color.RGBA{0xff, 0xff, 0xff, 0xff}},
+		{0xf800, color.RGBA{0xff, 0, 0, 0xff}},
+		{0x07e0, color.RGBA{0, 0xff, 0, 0xff}},
+		{0x001f, color.RGBA{0, 0, 0xff, 0xff}},
+		{0x8410, color.RGBA{0x84, 0x82, 0x84, 0xff}},
+	} {
+		if got := rgb565(test.v); got != test.want {
+			t.Errorf("%#04x: expected %v, got %v", test.v, test.want, got)
+		}
+	}
+}
+
+func TestRaw(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	writePNG := func(name string, img image.Image) string {
+		t.Helper()
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		return write(name, buf.Bytes())
+	}
+	convert := func(path string, args ...string) []byte {
+		t.Helper()
+		out := path + ".out"
+		args = append([]string{"-outmode", "bin", "-ratio", "32x32", "-o", out}, args...)
+		if code, _, errOut := runCLI(t, append(args, path)...); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d and\n%s", args, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	// a 64x32 gradient, dithered the same read raw as decoded
+	grad := gradient(64, 32)
+	want := convert(writePNG("gradient.png", grad))
+	if got := convert(write("gradient.gray", grad.Pix), "-raw", "64x32:gray8"); string(got) != string(want) {
+		t.Error("expected the gray8 framebuffer to convert as the PNG of the gradient")
+	}
+
+	// an rgb565 framebuffer, in either byte order, and the PNG of its colors
+	img := image.NewRGBA(image.Rect(0, 0, 32, 32))
+	var le, be []byte
+	for y := range 32 {
+		for x := range 32 {
+			v := uint16(x)<<11 | uint16(y*2)<<5 | uint16(31-x)
+			img.SetRGBA(x, y, rgb565(v))
+			le = append(le, byte(v), byte(v>>8))
+			be = append(be, byte(v>>8), byte(v))
+		}
+	}
+	want = convert(writePNG("colors.png", img))
+	if got := convert(write("colors.le", le), "-raw", "32x32:rgb565"); string(got) != string(want) {
+		t.Error("expected the rgb565 framebuffer to convert as the PNG of its colors")
+	}
+	if got := convert(write("colors.be", be), "-raw", "32x32:rgb565be"); string(got) != string(want) {
+		t.Error("expected the rgb565be framebuffer to convert as the PNG of its colors")
+	}
+
+	short := write("short.gray", grad.Pix[:100])
+	code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "32x32", "-raw", "64x32:gray8", short)
+	if want := "a 64x32 gray8 framebuffer is 2048 bytes (1 per pixel), got 100"; code != exitDecode || !strings.Contains(errOut, want) {
+		t.Errorf("expected exit code 4 and %q, got %d and\n%s", want, code, errOut)
+	}
+	for _, raw := range []string{"64x32", "64:gray8", "64x32:yuv420"} {
+		if code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "32x32", "-raw", raw, short); code != exitUsage || !strings.Contains(errOut, "error: invalid -raw") {
+			t.Errorf("-raw %s: expected exit code 2 and an error, got %d and\n%s", raw, code, errOut)
+		}
+	}
+}
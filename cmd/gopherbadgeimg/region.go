@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// -region converts a window of the display only, for the partial updates of
+// the UC8151: the image is converted at the size of the display, -ratio, and
+// only the bytes of the window are kept, so that they are exactly those of a
+// full update. An image already the size of the window is converted as it is
+// instead, as an icon. The offset of the window is recorded in the manifest,
+// and as NameOffsetX and NameOffsetY constants in rice mode.
+//
+// The controller updates whole bytes, so the window must start on one: on the
+// badge, whose columns are packed 8 pixels to a byte, its y must be a
+// multiple of 8 (it is the x of the controller, which is mounted sideways);
+// on row-major panels, its x must fill whole bytes.
+
+// parseRegion parses the WxH+X+Y of -region
+func parseRegion(s string) (image.Rectangle, error) {
+	invalid := fmt.Errorf("error: invalid -region `%s`, expected WxH+X+Y such as 64x32+8+16", s)
+	size, offset, _ := strings.Cut(s, "+")
+	xs, ys, _ := strings.Cut(offset, "+")
+	w, h, err := parseCells("-region", size)
+	if err != nil {
+		return image.Rectangle{}, invalid
+	}
+	x, err := strconv.Atoi(xs)
+	if err != nil || x < 0 {
+		return image.Rectangle{}, invalid
+	}
+	y, err := strconv.Atoi(ys)
+	if err != nil || y < 0 {
+		return image.Rectangle{}, invalid
+	}
+	return image.Rect(x, y, x+w, y+h), nil
+}
+
+// checkRegion checks that -region fits in a display of x by y, on whole bytes
+func (o *Options) checkRegion(x, y int) error {
+	r, err := parseRegion(o.Region)
+	if err != nil {
+		return err
+	}
+	if !r.In(image.Rect(0, 0, x, y)) {
+		return fmt.Errorf("error: -region %s goes past the edges of the %dx%d display", o.Region, x, y)
+	}
+	if err := o.Palette.Validate(r.Dx(), r.Dy()); err != nil {
+		return err
+	}
+	if o.Palette.Validate(r.Min.X, r.Min.Y) != nil {
+		axis, offset := "y", r.Min.Y
+		if o.Palette.RowMajor {
+			axis, offset = "x", r.Min.X
+		}
+		return fmt.Errorf("error: -region %s doesn't start on a whole byte of the display, which partial updates need: its %s offset %d must be a multiple of %d", o.Region, axis, offset, 8/o.Palette.Depth)
+	}
+	return nil
+}
+
+// regionBytes converts src to the window r of a display of x by y
+func (o *Options) regionBytes(r image.Rectangle, x, y int, src image.Image) []byte {
+	if b := src.Bounds(); b.Dx() == r.Dx() && b.Dy() == r.Dy() {
+		return o.ImgToBytes(r.Dx(), r.Dy(), &src)
+	}
+	return cropPacked(o.Palette, o.ImgToBytes(x, y, &src), x, y, r)
+}
+
+// cropPacked returns the bytes of the window r of data, an x by y image
+// packed for p, which r must start and end on whole bytes of
+func cropPacked(p *Palette, data []byte, x, y int, r image.Rectangle) []byte {
+	var out []byte
+	if p.RowMajor {
+		stride := x * p.Depth / 8
+		for row := r.Min.Y; row < r.Max.Y; row++ {
+			start := row*stride + r.Min.X*p.Depth/8
+			out = append(out, data[start:start+r.Dx()*p.Depth/8]...)
+		}
+		return out
+	}
+	stride := y * p.Depth / 8
+	for col := r.Min.X; col < r.Max.X; col++ {
+		start := col*stride + r.Min.Y*p.Depth/8
+		out = append(out, data[start:start+r.Dy()*p.Depth/8]...)
+	}
+	return out
+}
+
+// fprintGoOffset writes the nameOffsetX and nameOffsetY constants of an
+// image converted with -region
+func (o *Options) fprintGoOffset(w io.Writer, name string) error {
+	if o.Region == "" {
+		return nil
+	}
+	r, err := parseRegion(o.Region)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "\n// %sOffsetX and %sOffsetY are where %s goes on the display, in pixels\nconst (\n\t%sOffsetX = %d\n\t%sOffsetY = %d\n)\n",
+		name, name, name, name, r.Min.X, name, r.Min.Y)
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRegion(t *testing.T) {
+	dir := t.TempDir()
+	convert := func(name string, args ...string) []byte {
+		t.Helper()
+		out := filepath.Join(dir, name)
+		if code, _, errOut := runCLI(t, append([]string{"-outmode", "bin", "-o", out}, args...)...); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d and\n%s", args, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	full := convert("full.bin", "-ratio", "splash", "testdata/tainigo_128.png")
+	manifest := filepath.Join(dir, "manifest.json")
+	region := convert("region.bin", "-ratio", "splash", "-region", "64x32+8+16", "-manifest", manifest, "testdata/tainigo_128.png")
+	// columns of 128 pixels are 16 bytes, of which the window takes bytes 2
+	// to 5, in columns 8 to 71
+	var want []byte
+	for col := 8; col < 72; col++ {
+		want = append(want, full[col*16+2:col*16+6]...)
+	}
+	if !bytes.Equal(region, want) {
+		t.Errorf("expected the region to be the bytes of its window in a full conversion\n% x\ngot\n% x", want, region)
+	}
+	m, _ := readManifest(t, manifest)
+	if img := m.Images[0]; img.Region == nil || *img.Region != (ManifestRegion{X: 8, Y: 16}) || img.Width != 64 || img.Height != 32 {
+		t.Errorf("expected a 64x32 region at 8,16 in the manifest, got %dx%d at %+v", img.Width, img.Height, img.Region)
+	}
+
+	// an icon the size of the window is converted as it is
+	icon := filepath.Join(dir, "icon.png")
+	writeCheckerboard(t, icon, 64, 32, 4, 2)
+	img, err := LoadImg(icon)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alone := NewOptions().ImgToBytes(64, 32, img)
+	if got := convert("icon.bin", "-ratio", "splash", "-region", "64x32+128+64", icon); !bytes.Equal(got, alone) {
+		t.Errorf("expected the icon to be converted as it is\n% x\ngot\n% x", alone, got)
+	}
+
+	goFile := filepath.Join(dir, "battery.go")
+	if code, _, errOut := runCLI(t, "-outmode", "rice", "-ratio", "splash", "-region", "64x32+8+16", "-export", "-var", "battery", "-o", goFile, "testdata/tainigo_128.png"); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	src, err := os.ReadFile(goFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"BatteryWidth  = 64", "BatteryHeight = 32", "BatteryOffsetX = 8", "BatteryOffsetY = 16"} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("expected %q in\n%s", want, src)
+		}
+	}
+
+	for _, tc := range []struct {
+		region, err string
+	}{
+		{"64x32+8+12", "its y offset 12 must be a multiple of 8"},
+		{"64x32+200+16", "goes past the edges of the 246x128 display"},
+		{"64x12+8+16", "divisible by 8"},
+		{"64x32+8", "invalid -region"},
+	} {
+		code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "splash", "-region", tc.region, "testdata/tainigo_128.png")
+		if code != 2 || !strings.Contains(errOut, tc.err) {
+			t.Errorf("%s: expected exit code 2 and %q, got %d and\n%s", tc.region, tc.err, code, errOut)
+		}
+	}
+}
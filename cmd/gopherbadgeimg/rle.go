@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+// The RLE format is byte oriented, so that a microcontroller can expand it
+// straight into its framebuffer:
+//
+//	flag byte: 0x00 the rest is stored raw, 0x01 the rest is RLE encoded
+//	RLE control byte c, followed by
+//	  c < 0x80:  c+1 literal bytes (1 to 128)
+//	  c >= 0x80: one byte, repeated c-0x80+3 times (3 to 130)
+//
+// Images that wouldn't get any smaller are stored raw, so the output is at
+// most one byte bigger than the packed image.
+const (
+	rleRaw     = 0x00
+	rleEncoded = 0x01
+
+	rleMaxLiteral = 128
+	rleMinRun     = 3
+	rleMaxRun     = 130
+)
+
+// EncodeRLE compresses packed image bytes
+func EncodeRLE(data []byte) []byte {
+	out := []byte{rleEncoded}
+	literal := 0 // start of the pending literal bytes
+	flush := func(end int) {
+		for literal < end {
+			n := min(end-literal, rleMaxLiteral)
+			out = append(out, byte(n-1))
+			out = append(out, data[literal:literal+n]...)
+			literal += n
+		}
+	}
+	for i := 0; i < len(data); {
+		run := 1
+		for i+run < len(data) && data[i+run] == data[i] && run < rleMaxRun {
+			run++
+		}
+		if run < rleMinRun {
+			i += run
+			continue
+		}
+		flush(i)
+		out = append(out, byte(0x80+run-rleMinRun), data[i])
+		i += run
+		literal = i
+	}
+	flush(len(data))
+
+	if len(out) >= len(data)+1 {
+		return append([]byte{rleRaw}, data...)
+	}
+	return out
+}
+
+// DecodeRLE expands data compressed with EncodeRLE into dst, which must be
+// big enough for the whole image, and returns the part of dst that was used.
+// It doesn't allocate, so that firmware can decode into its framebuffer.
+func DecodeRLE(dst, src []byte) []byte {
+	if len(src) == 0 {
+		return dst[:0]
+	}
+	if src[0] == rleRaw {
+		return dst[:copy(dst, src[1:])]
+	}
+	n := 0
+	for i := 1; i < len(src); {
+		c := src[i]
+		i++
+		if c < 0x80 {
+			l := int(c) + 1
+			n += copy(dst[n:], src[i:i+l])
+			i += l
+			continue
+		}
+		for l := int(c-0x80) + rleMinRun; l > 0; l-- {
+			dst[n] = src[i]
+			n++
+		}
+		i++
+	}
+	return dst[:n]
+}
+
+// rleSize returns the size of the data compressed in src, checking that
+// DecodeRLE can expand it, which trusts its input
+func rleSize(src []byte) (int, error) {
+	if len(src) == 0 {
+		return 0, nil
+	}
+	switch src[0] {
+	case rleRaw:
+		return len(src) - 1, nil
+	case rleEncoded:
+	default:
+		return 0, fmt.Errorf("unknown RLE flag byte 0x%02x", src[0])
+	}
+	n := 0
+	for i := 1; i < len(src); {
+		c := src[i]
+		l := 1
+		if c < 0x80 {
+			l = int(c) + 1
+			n += l
+		} else {
+			n += int(c-0x80) + rleMinRun
+		}
+		if i+1+l > len(src) {
+			return 0, errors.New("the RLE data is truncated")
+		}
+		i += 1 + l
+	}
+	return n, nil
+}
+
+// rleDecoderSource is DecodeRLE as written into generated Go files, for the
+// firmware to expand the images at runtime
+const rleDecoderSource = `// DecodeRLE expands an image compressed by gopherbadgeimg -compress rle into
+// dst, which must be big enough for the whole image, and returns the part of
+// dst that was used. It doesn't allocate.
+func DecodeRLE(dst, src []byte) []byte {
+	if len(src) == 0 {
+		return dst[:0]
+	}
+	if src[0] == 0x00 {
+		// stored raw
+		return dst[:copy(dst, src[1:])]
+	}
+	n := 0
+	for i := 1; i < len(src); {
+		c := src[i]
+		i++
+		if c < 0x80 {
+			// c+1 literal bytes
+			l := int(c) + 1
+			n += copy(dst[n:], src[i:i+l])
+			i += l
+			continue
+		}
+		// one byte, repeated c-0x80+3 times
+		for l := int(c-0x80) + 3; l > 0; l-- {
+			dst[n] = src[i]
+			n++
+		}
+		i++
+	}
+	return dst[:n]
+}
+`
+
+// rleDecoderMu keeps concurrent workers from writing the same decoder file
+var rleDecoderMu sync.Mutex
+
+// writeRLEDecoder writes DecodeRLE to rle-generated.go next to output, and
+// returns its path.
+//
+// Every generated file of a package would otherwise declare DecodeRLE, which
+// wouldn't compile, so the decoder gets a file of its own.
+func (o *Options) writeRLEDecoder(output string) (string, error) {
+	rleDecoderMu.Lock()
+	defer rleDecoderMu.Unlock()
+	path := filepath.Join(filepath.Dir(output), "rle-generated.go")
+	return path, o.writeFile(path, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "%spackage %s\n\n%s", o.generatedHeader("//", "//go:generate ", filepath.Dir(path)), o.goPackage(), rleDecoderSource)
+		return err
+	})
+}
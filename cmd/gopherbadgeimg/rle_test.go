@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"math/rand"
+	"testing"
+)
+
+func TestRLERoundTrip(t *testing.T) {
+	// badge art is mostly flat areas
+	src, err := LoadImg("testdata/circle-rect.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := NewOptions()
+	opts.DisableDithering = true
+	typical := opts.ImgToBytes(246, 128, src)
+	random := make([]byte, 246*128/8)
+	rand.New(rand.NewSource(1)).Read(random)
+	blank := make([]byte, 296*128/8)
+	// runs right at the limits of both kinds of chunks
+	edges := append(bytes.Repeat([]byte{0xAA}, rleMaxRun+1), bytes.Repeat([]byte{1, 2}, rleMaxLiteral)...)
+	edges = append(edges, 7, 7, 9, 9, 9)
+
+	for name, data := range map[string][]byte{
+		"typical": typical,
+		"random":  random,
+		"blank":   blank,
+		"edges":   edges,
+		"empty":   {},
+	} {
+		encoded := EncodeRLE(data)
+		if len(encoded) > len(data)+1 {
+			t.Errorf("%s: %d bytes grew to %d", name, len(data), len(encoded))
+		}
+		decoded := DecodeRLE(make([]byte, len(data)), encoded)
+		if !bytes.Equal(decoded, data) {
+			t.Errorf("%s: round trip changed the data", name)
+		}
+	}
+
+	if encoded := EncodeRLE(typical); encoded[0] != rleEncoded || len(encoded) >= len(typical)/2 {
+		t.Errorf("expected badge art to compress well, got %d of %d bytes", len(encoded), len(typical))
+	}
+	if encoded := EncodeRLE(random); encoded[0] != rleRaw {
+		t.Error("expected random data to be stored raw")
+	}
+}
+
+func TestRLEDecoderSource(t *testing.T) {
+	src := "package main\n\n" + rleDecoderSource
+	if _, err := parser.ParseFile(token.NewFileSet(), "rle-generated.go", src, 0); err != nil {
+		t.Errorf("generated decoder doesn't parse: %v", err)
+	}
+}
+
+func TestRLESizeTruncated(t *testing.T) {
+	data := EncodeRLE(append(bytes.Repeat([]byte{0}, 36), 1, 2, 3, 4))
+	if n, err := rleSize(data); err != nil || n != 40 {
+		t.Fatalf("expected 40 bytes, got %d, %v", n, err)
+	}
+	if _, err := rleSize(data[:len(data)-1]); err == nil {
+		t.Error("expected truncated data to be rejected")
+	}
+}
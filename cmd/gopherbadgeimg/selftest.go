@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// -selftest checks that a build converts images to exactly the bytes the
+// build that recorded selftest/golden.txt did. Generated files are build
+// artifacts that must come out the same on every machine, which floating
+// point dithering, the order of a map or an upgraded dependency could
+// silently change. The reference images of selftest/ are converted to
+// selftestSize with every dithering algorithm and without dithering, packed
+// in every layout, and the SHA-256 of the data of each case, as it is
+// written, must be the golden one. The images and their hashes are embedded
+// in the binary, so that a build can check itself wherever it runs.
+//
+// The reference images carry metadata conversions ignore, an ICC profile in
+// gradient.png and an Exif orientation in gopher.jpg, so that the output
+// doesn't come to depend on it unnoticed either.
+//
+// Changes meant to change the output rewrite the golden file with
+// go run . -update-golden, run from this directory, and the diff of
+// selftest/golden.txt tells which cases they change.
+
+// selftestSize is the size the reference images are converted to
+var selftestSize = Ratio{60, 32}
+
+// goldenPath is the golden file of -selftest, relative to this directory
+const goldenPath = "selftest/golden.txt"
+
+//go:embed selftest
+var selftestFiles embed.FS
+
+// goldenHashes is the golden file -selftest checks against
+//
+//go:embed selftest/golden.txt
+var goldenHashes []byte
+
+// selftestCase is a conversion of a reference image checked by -selftest
+type selftestCase struct {
+	// name is image/dither/layout, as the golden file gives it
+	name  string
+	image string
+	opts  *Options
+}
+
+// selftestLayout is a way -selftest packs pixels
+type selftestLayout struct {
+	name    string
+	palette *Palette
+	layout  badgeimg.Layout
+}
+
+// selftestLayouts returns every layout of black and white images, and the
+// palettes packing pixels their own way: ACeP row by row, and the bit planes
+// of a three color palette, concatenated and interleaved
+func selftestLayouts() []selftestLayout {
+	var layouts []selftestLayout
+	for _, name := range badgeimg.LayoutNames {
+		layout, err := badgeimg.LookupLayout(name)
+		if err != nil {
+			// LayoutNames are known, this is a programming error
+			panic(err)
+		}
+		layouts = append(layouts, selftestLayout{name, MonoPalette, layout})
+	}
+	layouts = append(layouts, selftestLayout{"acep", ACePPalette, badgeimg.LayoutBadger})
+	tricolor, err := ParsePalette("black,white,red")
+	if err != nil {
+		panic(err)
+	}
+	for _, planes := range []string{"concat", "interleave"} {
+		planar := *tricolor
+		planar.Planes = planes
+		layouts = append(layouts, selftestLayout{"tricolor-" + planes, &planar, badgeimg.LayoutBadger})
+	}
+	return layouts
+}
+
+// selftestCases returns the conversions -selftest checks, in the order of
+// the golden file
+func selftestCases() ([]selftestCase, error) {
+	entries, err := fs.ReadDir(selftestFiles, "selftest")
+	if err != nil {
+		return nil, err
+	}
+	dithers := append(slices.Clip(badgeimg.DitherAlgorithms), "none")
+	var cases []selftestCase
+	for _, entry := range entries {
+		if path.Join("selftest", entry.Name()) == goldenPath {
+			continue
+		}
+		for _, dither := range dithers {
+			for _, layout := range selftestLayouts() {
+				opts := NewOptions()
+				opts.Ratio = selftestSize.String()
+				opts.Palette, opts.Layout = layout.palette, layout.layout
+				if dither == "none" {
+					opts.DisableDithering = true
+				} else {
+					opts.Dither = dither
+				}
+				cases = append(cases, selftestCase{
+					name:  strings.Join([]string{entry.Name(), dither, layout.name}, "/"),
+					image: entry.Name(),
+					opts:  opts,
+				})
+			}
+		}
+	}
+	return cases, nil
+}
+
+// hash converts the reference image of c and returns the SHA-256 of its data
+// as it is written
+func (c selftestCase) hash() (string, error) {
+	data, err := selftestFiles.ReadFile(path.Join("selftest", c.image))
+	if err != nil {
+		return "", err
+	}
+	frames, err := c.opts.DecodeFrames(data)
+	if err != nil {
+		return "", decodeFailed(err)
+	}
+	x, y := selftestSize.Width, selftestSize.Height
+	packed, _, _, _, err := c.opts.packFrames(Input{Path: c.image}, frames, x, y)
+	if err != nil {
+		return "", err
+	}
+	return sha256Hex(bytes.Join(c.opts.writtenFrames(x, y, packed), nil)), nil
+}
+
+// parseGolden returns the hashes of a golden file by case name: a line per
+// case, its name and hash, after comments starting with #
+func parseGolden(golden []byte) (map[string]string, error) {
+	hashes := map[string]string{}
+	for _, line := range strings.Split(string(golden), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name, hash, ok := strings.Cut(line, " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid golden line `%s`, use name hash", line)
+		}
+		hashes[name] = hash
+	}
+	return hashes, nil
+}
+
+// checkGolden converts every case and checks it against golden, logging
+// each one that drifted
+func checkGolden(golden []byte) error {
+	want, err := parseGolden(golden)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", goldenPath, err)
+	}
+	cases, err := selftestCases()
+	if err != nil {
+		return err
+	}
+	var failed []error
+	for _, c := range cases {
+		hash, err := c.hash()
+		switch {
+		case err != nil:
+			err = fmt.Errorf("selftest %s failed: %w", c.name, unprefixed(err))
+		case want[c.name] == "":
+			err = fmt.Errorf("selftest %s has no golden hash, run go run . -update-golden", c.name)
+		case hash != want[c.name]:
+			err = fmt.Errorf("selftest %s drifted: its data hashes to %s, not %s", c.name, hash, want[c.name])
+		}
+		delete(want, c.name)
+		if err != nil {
+			logger.Errorf("%v", err)
+			failed = append(failed, err)
+		}
+	}
+	stale := make([]string, 0, len(want))
+	for name := range want {
+		stale = append(stale, name)
+	}
+	slices.Sort(stale)
+	for _, name := range stale {
+		err := fmt.Errorf("selftest %s has a golden hash but no longer exists, run go run . -update-golden", name)
+		logger.Errorf("%v", err)
+		failed = append(failed, err)
+	}
+	if len(failed) > 0 {
+		return failures(failed)
+	}
+	logger.Infof("selftest: all %d cases match their golden hashes", len(cases))
+	return nil
+}
+
+// writeGolden converts every case and writes their hashes to the golden file
+// at path
+func writeGolden(path string) error {
+	cases, err := selftestCases()
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	b.WriteString("# The hashes -selftest checks the conversions of the reference images\n# against, see selftest.go. Regenerate with: go run . -update-golden\n")
+	for _, c := range cases {
+		hash, err := c.hash()
+		if err != nil {
+			return fmt.Errorf("error converting selftest %s: %w", c.name, unprefixed(err))
+		}
+		fmt.Fprintf(&b, "%s %s\n", c.name, hash)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0o644); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return classify(badgeimg.ErrWrite, fmt.Errorf("error: -update-golden rewrites %s of a checkout, run it from cmd/gopherbadgeimg", path))
+		}
+		return classify(badgeimg.ErrWrite, fmt.Errorf("error writing %s: %w", path, err))
+	}
+	logger.Infof("wrote the golden hashes of %d selftest cases to %s", len(cases), path)
+	return nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestSelftest fails when a change alters the output of a conversion. If the
+// change is meant to, regenerate the golden file with go run . -update-golden
+// and review its diff.
+func TestSelftest(t *testing.T) {
+	code, _, errOut := runCLI(t, "-selftest")
+	if code != 0 {
+		t.Fatalf("expected every case to match its golden hash, got exit code %d:\n%s", code, errOut)
+	}
+
+	golden := goldenHashes
+	defer func() { goldenHashes = golden }()
+	name, _, _ := strings.Cut(strings.Split(string(golden), "\n")[2], " ")
+	goldenHashes = []byte(strings.Replace(string(golden), name+" ", name+" 00", 1) + "gone.png/bayer/badger 00\n")
+	code, _, errOut = runCLI(t, "-selftest")
+	if code != exitFailure || !strings.Contains(errOut, "selftest "+name+" drifted: its data hashes to ") {
+		t.Errorf("expected %s to drift, got exit code %d: %s", name, code, errOut)
+	}
+	if !strings.Contains(errOut, "selftest gone.png/bayer/badger has a golden hash but no longer exists") {
+		t.Errorf("expected the case missing to be named, got %s", errOut)
+	}
+	if strings.Count(errOut, "selftest ") != 2 {
+		t.Errorf("expected the other cases to match, got %s", errOut)
+	}
+
+	if code, _, errOut := runCLI(t, "-selftest", "splash.png"); code != exitUsage || !strings.Contains(errOut, "they take no inputs") {
+		t.Errorf("expected exit code %d for -selftest with inputs, got %d: %s", exitUsage, code, errOut)
+	}
+}
+
+func TestWriteGolden(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "golden.txt")
+	if err := writeGolden(path); err != nil {
+		t.Fatal(err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(written) != string(goldenHashes) {
+		t.Errorf("expected -update-golden to write the golden file as it is, got\n%s", written)
+	}
+	if err := writeGolden(filepath.Join(t.TempDir(), "selftest", "golden.txt")); exitCode(err) != exitOutput || !strings.Contains(err.Error(), "run it from cmd/gopherbadgeimg") {
+		t.Errorf("expected -update-golden to need a checkout, got %v", err)
+	}
+}
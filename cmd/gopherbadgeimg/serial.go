@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// -send PORT pushes every converted image to a badge over a serial port, such
+// as the USB-CDC console of the gopherbadge, where a receiver like the one of
+// examples/receiver draws it: see badgeimg.Send for the protocol. Images are
+// sent one at a time, the port being opened for each, so a batch or -watch
+// shows them in turn. -list-ports lists the ports a badge may be on.
+
+// serialBauds are the baud rates -baud takes; USB-CDC ports ignore it
+var serialBauds = []int{9600, 19200, 38400, 57600, 115200, 230400, 460800, 921600}
+
+// sendRetries is how many times an image the badge rejects is sent again
+const sendRetries = 3
+
+// serialPort is an open serial port, such as an *os.File
+type serialPort interface {
+	io.ReadWriteCloser
+	SetDeadline(t time.Time) error
+}
+
+// openPort opens the serial port of -send at baud. It is a variable so that
+// tests can put one end of a pipe in its place.
+var openPort = func(path string, baud int) (serialPort, error) {
+	return openSerial(path, baud)
+}
+
+// portInfo is a serial port -list-ports lists, with the name its system
+// gives the device, if any
+type portInfo struct {
+	path, name string
+}
+
+// sendMu keeps the images converted at the same time from being sent at once
+var sendMu sync.Mutex
+
+// checkSend validates the flags of -send
+func checkSend(opts *Options) error {
+	switch {
+	case opts.Send == "":
+		return nil
+	case !slices.Contains(serialBauds, opts.Baud):
+		bauds := make([]string, len(serialBauds))
+		for i, baud := range serialBauds {
+			bauds[i] = strconv.Itoa(baud)
+		}
+		return usagef("error: invalid -baud %d, use one of: %s", opts.Baud, strings.Join(bauds, ", "))
+	case opts.SendTimeout <= 0:
+		return usagef("error: -send-timeout must be positive")
+	case opts.Palette != MonoPalette:
+		return usagef("error: -send only sends black and white images")
+	case opts.Region != "":
+		return usagef("error: -send draws images whole, it can't be used with -region")
+	}
+	return nil
+}
+
+// sendImg sends a converted image to the badge on the port of -send
+func (o *Options) sendImg(x, y int, imgBits []byte) error {
+	sendMu.Lock()
+	defer sendMu.Unlock()
+	port, err := openPort(o.Send, o.Baud)
+	if err != nil {
+		return err
+	}
+	defer port.Close()
+	start := time.Now()
+	frame := badgeimg.Frame{Width: x, Height: y, Data: imgBits}
+	if err := badgeimg.Send(port, frame, badgeimg.SendOptions{Retries: sendRetries, Timeout: o.SendTimeout}); err != nil {
+		return err
+	}
+	logger.Debugf("sent %d bytes to %s in %s", len(imgBits), o.Send, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// printPorts prints the serial ports of -list-ports to w, one per line
+func printPorts(w io.Writer) error {
+	ports, err := serialPorts()
+	if err != nil {
+		return err
+	}
+	if len(ports) == 0 {
+		logger.Warnf("no serial ports found, is the badge plugged in?")
+	}
+	var b strings.Builder
+	for _, port := range ports {
+		b.WriteString(port.path)
+		if port.name != "" {
+			fmt.Fprintf(&b, "\t%s", port.name)
+		}
+		b.WriteString("\n")
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
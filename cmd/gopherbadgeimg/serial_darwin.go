@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/sys/unix"
+)
+
+// openSerial opens the serial port at path in raw mode, 8N1 at baud
+func openSerial(path string, baud int) (*os.File, error) {
+	// the file stays non-blocking, which deadlines need
+	f, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var termErr error
+	err = conn.Control(func(fd uintptr) {
+		var t *unix.Termios
+		if t, termErr = unix.IoctlGetTermios(int(fd), unix.TIOCGETA); termErr != nil {
+			return
+		}
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS
+		t.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL
+		// the speeds are the baud rates themselves
+		t.Ispeed, t.Ospeed = uint64(baud), uint64(baud)
+		t.Cc[unix.VMIN], t.Cc[unix.VTIME] = 1, 0
+		termErr = unix.IoctlSetTermios(int(fd), unix.TIOCSETA, t)
+	})
+	if err == nil {
+		err = termErr
+	}
+	if err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "configure", Path: path, Err: err}
+	}
+	return f, nil
+}
+
+// serialPorts returns the USB serial ports, the call-out devices that don't
+// wait for a carrier
+func serialPorts() ([]portInfo, error) {
+	var paths []string
+	for _, pattern := range []string{"/dev/cu.usbmodem*", "/dev/cu.usbserial*"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+	ports := make([]portInfo, len(paths))
+	for i, path := range paths {
+		ports[i] = portInfo{path: path}
+	}
+	return ports, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/sys/unix"
+)
+
+// serialSpeeds are the termios speeds of serialBauds
+var serialSpeeds = map[int]uint32{
+	9600:   unix.B9600,
+	19200:  unix.B19200,
+	38400:  unix.B38400,
+	57600:  unix.B57600,
+	115200: unix.B115200,
+	230400: unix.B230400,
+	460800: unix.B460800,
+	921600: unix.B921600,
+}
+
+// openSerial opens the serial port at path in raw mode, 8N1 at baud
+func openSerial(path string, baud int) (*os.File, error) {
+	// the file stays non-blocking, which deadlines need
+	f, err := os.OpenFile(path, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := f.SyscallConn()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	var termErr error
+	err = conn.Control(func(fd uintptr) {
+		var t *unix.Termios
+		if t, termErr = unix.IoctlGetTermios(int(fd), unix.TCGETS); termErr != nil {
+			return
+		}
+		speed := serialSpeeds[baud]
+		t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF
+		t.Oflag &^= unix.OPOST
+		t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+		t.Cflag &^= unix.CSIZE | unix.PARENB | unix.CSTOPB | unix.CRTSCTS | unix.CBAUD
+		t.Cflag |= unix.CS8 | unix.CREAD | unix.CLOCAL | speed
+		t.Ispeed, t.Ospeed = speed, speed
+		t.Cc[unix.VMIN], t.Cc[unix.VTIME] = 1, 0
+		termErr = unix.IoctlSetTermios(int(fd), unix.TCSETS, t)
+	})
+	if err == nil {
+		err = termErr
+	}
+	if err != nil {
+		f.Close()
+		return nil, &os.PathError{Op: "configure", Path: path, Err: err}
+	}
+	return f, nil
+}
+
+// serialPorts returns the USB serial ports, named after the devices listed
+// in /dev/serial/by-id
+func serialPorts() ([]portInfo, error) {
+	var paths []string
+	for _, pattern := range []string{"/dev/ttyACM*", "/dev/ttyUSB*"} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, matches...)
+	}
+	slices.Sort(paths)
+	names := map[string]string{}
+	links, _ := filepath.Glob("/dev/serial/by-id/*")
+	for _, link := range links {
+		if target, err := filepath.EvalSymlinks(link); err == nil {
+			names[target] = filepath.Base(link)
+		}
+	}
+	ports := make([]portInfo, len(paths))
+	for i, path := range paths {
+		ports[i] = portInfo{path, names[path]}
+	}
+	return ports, nil
+}
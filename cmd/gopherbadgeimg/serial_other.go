@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// openSerial fails, serial ports are only opened on Linux and macOS
+func openSerial(path string, baud int) (*os.File, error) {
+	return nil, fmt.Errorf("-send isn't supported on %s", runtime.GOOS)
+}
+
+// serialPorts fails, serial ports are only listed on Linux and macOS
+func serialPorts() ([]portInfo, error) {
+	return nil, fmt.Errorf("-list-ports isn't supported on %s", runtime.GOOS)
+}
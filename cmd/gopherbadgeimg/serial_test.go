@@ -0,0 +1,83 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// fakePort puts a pipe in the place of the serial port of -send for the rest
+// of the test, the badge end being handed to badge each time it is opened
+func fakePort(t *testing.T, badge func(port net.Conn)) {
+	t.Helper()
+	old := openPort
+	t.Cleanup(func() { openPort = old })
+	openPort = func(path string, baud int) (serialPort, error) {
+		if path != "/dev/ttyACM0" || baud != 115200 {
+			t.Errorf("expected /dev/ttyACM0 at 115200 baud, got %s at %d", path, baud)
+		}
+		host, end := net.Pipe()
+		go func() {
+			defer end.Close()
+			badge(end)
+		}()
+		return host, nil
+	}
+}
+
+func TestSend(t *testing.T) {
+	dir := t.TempDir()
+	received := make(chan badgeimg.Frame, 1)
+	fakePort(t, func(port net.Conn) {
+		f, err := badgeimg.Receive(port, 1<<16)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		received <- f
+	})
+	out := filepath.Join(dir, "gopher.bin")
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "64x64", "-o", out, "-send", "/dev/ttyACM0", "testdata/tainigo_128.png"); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	want, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := <-received; f.Width != 64 || f.Height != 64 || string(f.Data) != string(want) {
+		t.Errorf("expected the badge to receive the 64x64 image of the bin file, got %dx%d and\n%x", f.Width, f.Height, f.Data)
+	}
+
+	// nothing listens on the port
+	fakePort(t, func(port net.Conn) {
+		io.Copy(io.Discard, port)
+	})
+	code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "64x64", "-send", "/dev/ttyACM0", "-send-timeout", "100ms", "testdata/tainigo_128.png")
+	if want := "error sending image to /dev/ttyACM0: no answer from the badge in 100ms"; code != exitFailure || !strings.Contains(errOut, want) {
+		t.Errorf("expected exit code 1 and %q, got %d and\n%s", want, code, errOut)
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-baud", "1234"}, "invalid -baud 1234"},
+		{[]string{"-send-timeout", "0s"}, "-send-timeout must be positive"},
+		{[]string{"-colors", "acep"}, "-send only sends black and white images"},
+		{[]string{"-region", "16x16+0+0"}, "can't be used with -region"},
+	} {
+		args := append([]string{"-outmode", "none", "-ratio", "64x64", "-send", "/dev/ttyACM0"}, test.args...)
+		if code, _, errOut := runCLI(t, append(args, "testdata/tainigo_128.png")...); code != exitUsage || !strings.Contains(errOut, test.want) {
+			t.Errorf("%v: expected exit code 2 and %q, got %d and\n%s", test.args, test.want, code, errOut)
+		}
+	}
+	code, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "64x64", "-send", "/dev/ttyACM0", "-grid", "2x1", "testdata/tainigo_128.png")
+	if want := "-send sends single images"; code == 0 || !strings.Contains(errOut, want) {
+		t.Errorf("-grid: expected %q, got %d and\n%s", want, code, errOut)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxServePixels bounds the size of the images the server converts, so that
+// a request can't ask for gigabytes of pixels
+const maxServePixels = 4096 * 4096
+
+// serveFormats are the formats /convert answers with, and their content type
+var serveFormats = map[string]string{
+	"bin":    "application/octet-stream",
+	"base64": "text/plain; charset=utf-8",
+	"png":    "image/png",
+}
+
+// acceptFormats are the formats picked by the Accept header of a /convert
+// request without a format, in order; bin is the default
+var acceptFormats = []string{"png", "base64", "bin"}
+
+// serveParams are the query parameters /convert accepts
+var serveParams = []string{"ratio", "dither", "threshold", "invert", "outmode", "format"}
+
+// server converts the images uploaded to POST /convert
+type server struct {
+	// maxUpload is the largest request body accepted, in bytes
+	maxUpload int64
+	// timeout bounds each conversion
+	timeout time.Duration
+	// jobs is how many conversions run at the same time
+	jobs int
+	// slots holds a token for each running conversion, up to jobs
+	slots chan struct{}
+}
+
+// statusError is an error that is answered with its HTTP status
+type statusError struct {
+	status int
+	err    error
+}
+
+func (e *statusError) Error() string {
+	return e.err.Error()
+}
+
+// statusErrorf returns a statusError with the formatted message
+func statusErrorf(status int, format string, args ...any) error {
+	return &statusError{status, fmt.Errorf(format, args...)}
+}
+
+// Handler returns the handler of the server's endpoints
+func (s *server) Handler() http.Handler {
+	if s.slots == nil {
+		s.slots = make(chan struct{}, max(1, s.jobs))
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /convert", s.convert)
+	return mux
+}
+
+// convert answers a multipart upload, whose image field is converted as the
+// query parameters say, with the packed image: raw, as base64 or as a PNG of
+// what the panel shows, from the format parameter or else the Accept header
+func (s *server) convert(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.maxUpload)
+	if err := r.ParseMultipartForm(s.maxUpload); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeHTTPError(w, statusErrorf(http.StatusRequestEntityTooLarge, "the upload is larger than %d bytes", s.maxUpload))
+			return
+		}
+		writeHTTPError(w, statusErrorf(http.StatusBadRequest, "expected a multipart/form-data upload: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	opts, x, y, format, err := parseServeRequest(r)
+	if err != nil {
+		writeHTTPError(w, err)
+		return
+	}
+	file, _, err := r.FormFile("image")
+	if err != nil {
+		writeHTTPError(w, statusErrorf(http.StatusBadRequest, "expected the image in the image field: %v", err))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeHTTPError(w, statusErrorf(http.StatusBadRequest, "error reading the upload: %v", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+	defer cancel()
+	select {
+	case s.slots <- struct{}{}:
+	case <-ctx.Done():
+		writeHTTPError(w, statusErrorf(http.StatusServiceUnavailable, "the server is busy: no conversion finished within %v", s.timeout))
+		return
+	}
+	type result struct {
+		imgBits []byte
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		// the slot is only given back once the conversion is over, so that
+		// conversions outliving their request still count against -jobs
+		defer func() { <-s.slots }()
+		imgBits, err := convertUpload(ctx, opts, data, x, y)
+		done <- result{imgBits, err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		writeHTTPError(w, statusErrorf(http.StatusServiceUnavailable, "the conversion took longer than %v", s.timeout))
+		return
+	}
+	if res.err != nil {
+		writeHTTPError(w, res.err)
+		return
+	}
+
+	w.Header().Set("Content-Type", serveFormats[format])
+	switch format {
+	case "bin":
+		w.Write(res.imgBits)
+	case "base64":
+		io.WriteString(w, EncodeToString(res.imgBits))
+	case "png":
+		png.Encode(w, RenderPreview(x, y, 1, MonoPalette, res.imgBits))
+	}
+}
+
+// convertUpload decodes and converts an uploaded image, answering a panic of
+// the conversion with a 500 instead of taking the server down. It gives up
+// between decoding and converting once ctx is done.
+func convertUpload(ctx context.Context, opts *Options, data []byte, x, y int) (imgBits []byte, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			logger.Errorf("panic converting an upload: %v", p)
+			err = statusErrorf(http.StatusInternalServerError, "error converting the image: %v", p)
+		}
+	}()
+	frames, err := opts.DecodeFrames(data)
+	if err != nil {
+		return nil, statusErrorf(http.StatusUnsupportedMediaType, "error decoding the image: %v", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return opts.ImgToBytes(x, y, &frames[0].Image), nil
+}
+
+// parseServeRequest returns the options, size and answer format of a
+// /convert request
+func parseServeRequest(r *http.Request) (*Options, int, int, string, error) {
+	for name := range r.Form {
+		if !slices.Contains(serveParams, name) {
+			return nil, 0, 0, "", statusErrorf(http.StatusBadRequest, "unknown parameter `%s`, use: %s", name, strings.Join(serveParams, ", "))
+		}
+	}
+	opts := NewOptions()
+	opts.Ratio = r.FormValue("ratio")
+	size, err := opts.ratioSize(opts.Ratio)
+	x, y := size.Width, size.Height
+	if err == nil {
+		err = opts.Palette.Validate(x, y)
+	}
+	if err == nil && (x <= 0 || y <= 0) {
+		err = fmt.Errorf("invalid size %dx%d", x, y)
+	}
+	if err == nil && x*y > maxServePixels {
+		err = fmt.Errorf("%dx%d is more than %d pixels", x, y, maxServePixels)
+	}
+	if err != nil {
+		return nil, 0, 0, "", &statusError{http.StatusBadRequest, err}
+	}
+
+	switch dither := r.FormValue("dither"); dither {
+	case "":
+	case "none":
+		opts.DisableDithering = true
+	default:
+		opts.Dither = dither
+	}
+	if threshold := r.FormValue("threshold"); threshold != "" {
+		if opts.Threshold, err = parseThreshold(threshold); err != nil {
+			return nil, 0, 0, "", statusErrorf(http.StatusBadRequest, "invalid threshold `%s`", threshold)
+		}
+	}
+	if invert := r.FormValue("invert"); invert != "" {
+		if opts.Invert, err = strconv.ParseBool(invert); err != nil {
+			return nil, 0, 0, "", statusErrorf(http.StatusBadRequest, "invalid invert `%s`", invert)
+		}
+	}
+	if err := checkImage(opts); err != nil {
+		return nil, 0, 0, "", &statusError{http.StatusBadRequest, err}
+	}
+
+	format := r.FormValue("format")
+	if format == "" {
+		format = r.FormValue("outmode")
+	}
+	if format == "" {
+		format = "bin"
+		accept := r.Header.Get("Accept")
+		for _, name := range acceptFormats {
+			mediaType, _, _ := strings.Cut(serveFormats[name], ";")
+			if strings.Contains(accept, mediaType) {
+				format = name
+				break
+			}
+		}
+	}
+	if _, ok := serveFormats[format]; !ok {
+		return nil, 0, 0, "", statusErrorf(http.StatusBadRequest, "invalid format `%s`, use bin, base64 or png", format)
+	}
+	return opts, x, y, format, nil
+}
+
+// writeHTTPError answers with err as a JSON object, {"error": "..."}, and its
+// status, or 500 for errors without one
+func writeHTTPError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		status = statusErr.status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": strings.TrimPrefix(err.Error(), "error: ")})
+}
+
+// setupServe sets up the serve command
+func setupServe(fs *flag.FlagSet, _ *Options) func(args []string) error {
+	s := &server{}
+	var addr string
+	fs.StringVar(&addr, "addr", "localhost:8080", "listen on this address")
+	fs.Int64Var(&s.maxUpload, "max-upload", 10<<20, "set the largest upload accepted, in bytes")
+	fs.DurationVar(&s.timeout, "convert-timeout", 10*time.Second, "set how long a conversion may take")
+	fs.IntVar(&s.jobs, "jobs", runtime.NumCPU(), "set how many conversions run at the same time, other requests waiting up to -convert-timeout for one to finish")
+	return func(args []string) error {
+		if len(args) > 0 {
+			return usagef("error: serve takes no arguments")
+		}
+		srv := &http.Server{
+			Addr:              addr,
+			Handler:           s.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			srv.Shutdown(context.Background())
+		}()
+		logger.Infof("listening on http://%s", addr)
+		if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("error: %v", err)
+		}
+		return nil
+	}
+}
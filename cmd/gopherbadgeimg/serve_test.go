@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// upload posts the image to the /convert endpoint of s with the query and
+// Accept header, returning the response
+func upload(t *testing.T, s *server, query, accept string, image []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("image", "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(image)
+	form.Close()
+
+	r := httptest.NewRequest(http.MethodPost, "/convert?"+query, &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, r)
+	return w
+}
+
+// checkHTTPError checks that w is a JSON error with the status and message
+func checkHTTPError(t *testing.T, w *httptest.ResponseRecorder, status int, message string) {
+	t.Helper()
+	var body struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected a JSON error, got %q", w.Body.String())
+	}
+	if w.Code != status || !strings.Contains(body.Error, message) {
+		t.Errorf("expected status %d and %q, got %d and %q", status, message, w.Code, body.Error)
+	}
+}
+
+func TestServeConvert(t *testing.T) {
+	image, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := NewOptions().ImgToBytes(120, 128, img)
+	s := &server{maxUpload: 1 << 20, timeout: time.Minute}
+
+	w := upload(t, s, "ratio=profile", "", image)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/octet-stream" || !bytes.Equal(w.Body.Bytes(), want) {
+		t.Errorf("expected the bin data, got status %d, %s and %d bytes", w.Code, w.Header().Get("Content-Type"), w.Body.Len())
+	}
+
+	w = upload(t, s, "ratio=profile", "text/plain", image)
+	if w.Code != http.StatusOK || w.Body.String() != EncodeToString(want) {
+		t.Errorf("expected the base64 data, got status %d and %q", w.Code, w.Body.String())
+	}
+
+	w = upload(t, s, "ratio=profile&format=png", "", image)
+	preview, err := png.Decode(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := preview.Bounds(); b.Dx() != 120 || b.Dy() != 128 {
+		t.Errorf("expected a 120x128 preview, got %v", b)
+	}
+
+	// parameters mirror the flags
+	opts := NewOptions()
+	opts.Threshold, opts.Invert = 100, true
+	w = upload(t, s, "ratio=profile&threshold=100&invert=true&outmode=bin", "", image)
+	if !bytes.Equal(w.Body.Bytes(), opts.ImgToBytes(120, 128, img)) {
+		t.Error("expected the data converted with -threshold 100 -invert")
+	}
+}
+
+func TestServeTooLarge(t *testing.T) {
+	s := &server{maxUpload: 1024, timeout: time.Minute}
+	w := upload(t, s, "ratio=profile", "", make([]byte, 4096))
+	checkHTTPError(t, w, http.StatusRequestEntityTooLarge, "larger than 1024 bytes")
+}
+
+func TestServeBadRequest(t *testing.T) {
+	image, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{maxUpload: 1 << 20, timeout: time.Minute}
+	tests := []struct {
+		query  string
+		image  []byte
+		status int
+		want   string
+	}{
+		{"", image, http.StatusBadRequest, "a ratio must be provided"},
+		{"ratio=fat", image, http.StatusBadRequest, "invalid ratio"},
+		{"ratio=12x12", image, http.StatusBadRequest, "divisible by 8"},
+		{"ratio=100000x100000", image, http.StatusBadRequest, "more than"},
+		{"ratio=profile&dither=wobbly", image, http.StatusBadRequest, "unknown dithering algorithm"},
+		{"ratio=profile&threshold=dark", image, http.StatusBadRequest, "invalid threshold"},
+		{"ratio=profile&format=gif", image, http.StatusBadRequest, "invalid format"},
+		{"ratio=profile&colour=red", image, http.StatusBadRequest, "unknown parameter"},
+		{"ratio=profile", []byte("not an image"), http.StatusUnsupportedMediaType, "error decoding the image"},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			checkHTTPError(t, upload(t, s, test.query, "", test.image), test.status, test.want)
+		})
+	}
+}
+
+func TestServeBusy(t *testing.T) {
+	image, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &server{maxUpload: 1 << 20, timeout: 50 * time.Millisecond, jobs: 1}
+	s.Handler()
+	// a conversion that outlived its request still holds the only slot
+	s.slots <- struct{}{}
+	checkHTTPError(t, upload(t, s, "ratio=profile", "", image), http.StatusServiceUnavailable, "the server is busy")
+	<-s.slots
+	if w := upload(t, s, "ratio=profile", "", image); w.Code != http.StatusOK {
+		t.Errorf("expected the slot to be free again, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestConvertUploadPanic(t *testing.T) {
+	image, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a negative size panics in dither
+	_, err = convertUpload(context.Background(), NewOptions(), image, -8, 8)
+	var statusErr *statusError
+	if !errors.As(err, &statusErr) || statusErr.status != http.StatusInternalServerError {
+		t.Errorf("expected a panic to be answered with a 500, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := convertUpload(ctx, NewOptions(), image, 32, 32); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a conversion whose request is gone to stop, got %v", err)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// -outmode slideshow packs every input, and every frame of animations, into
+// a single file for firmwares that cycle through images, in the order of the
+// inputs. The file starts with an 18 byte header, little-endian:
+//
+//	offset  size  field
+//	0       4     magic "GBSS"
+//	4       1     version, 1
+//	5       1     depth: bits per pixel
+//	6       1     layout: 0 badger (column-major), 1 row-msb (row-major)
+//	7       1     reserved, 0
+//	8       2     frame count
+//	10      2     width in pixels
+//	12      2     height in pixels
+//	14      4     length of each frame, in bytes
+//
+// followed by the frames back to back, so that frame n is found at
+// 18 + n*length. With -dedupe-frames=global the slideshow is version 2 and
+// holds every distinct frame once: the frames are followed by the order they
+// are shown in, a uint16 count and as many uint16 frame numbers. With -o
+// name.go the slides are written as Go instead: a [][]byte and constants
+// holding their size, and the nameSequence of -dedupe-frames=global.
+const (
+	slideshowHeaderSize = 18
+	slideshowVersion    = 1
+	// slideshowSequenced is the version of slideshows ending with a sequence
+	slideshowSequenced = 2
+)
+
+// slideshowMagic starts every slideshow
+var slideshowMagic = [4]byte{'G', 'B', 'S', 'S'}
+
+var errNoSlideshow = errors.New("not a slideshow")
+
+// Slideshow is the content of a slideshow file
+type Slideshow struct {
+	Version  uint8
+	Depth    uint8
+	RowMajor bool
+	Width    uint16
+	Height   uint16
+	// Frames are the packed frames, all of the same length
+	Frames [][]byte
+	// Sequence is the order Frames are shown in, in version 2 slideshows
+	Sequence []int
+}
+
+// Playback returns the frames of s in the order they are shown in
+func (s *Slideshow) Playback() [][]byte {
+	if s.Sequence == nil {
+		return s.Frames
+	}
+	return playback(s.Frames, s.Sequence)
+}
+
+// EncodeSlideshow returns s as a slideshow file
+func EncodeSlideshow(s Slideshow) []byte {
+	length := 0
+	if len(s.Frames) > 0 {
+		length = len(s.Frames[0])
+	}
+	buf := make([]byte, slideshowHeaderSize, slideshowHeaderSize+len(s.Frames)*length)
+	copy(buf, slideshowMagic[:])
+	buf[4] = s.Version
+	buf[5] = s.Depth
+	if s.RowMajor {
+		buf[6] = headerLayoutRowMajor
+	}
+	binary.LittleEndian.PutUint16(buf[8:], uint16(len(s.Frames)))
+	binary.LittleEndian.PutUint16(buf[10:], s.Width)
+	binary.LittleEndian.PutUint16(buf[12:], s.Height)
+	binary.LittleEndian.PutUint32(buf[14:], uint32(length))
+	for _, frame := range s.Frames {
+		buf = append(buf, frame...)
+	}
+	if s.Version == slideshowSequenced {
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(s.Sequence)))
+		for _, n := range s.Sequence {
+			buf = binary.LittleEndian.AppendUint16(buf, uint16(n))
+		}
+	}
+	return buf
+}
+
+// DecodeSlideshow reads a slideshow file, returning errNoSlideshow for data
+// that doesn't start like one
+func DecodeSlideshow(data []byte) (*Slideshow, error) {
+	if len(data) < slideshowHeaderSize || [4]byte(data[:4]) != slideshowMagic {
+		return nil, errNoSlideshow
+	}
+	s := &Slideshow{
+		Version:  data[4],
+		Depth:    data[5],
+		RowMajor: data[6] == headerLayoutRowMajor,
+		Width:    binary.LittleEndian.Uint16(data[10:]),
+		Height:   binary.LittleEndian.Uint16(data[12:]),
+	}
+	if s.Version != slideshowVersion && s.Version != slideshowSequenced {
+		return nil, fmt.Errorf("unsupported slideshow version %d", s.Version)
+	}
+	if data[6] > headerLayoutRowMajor {
+		return nil, fmt.Errorf("unknown layout %d in the slideshow", data[6])
+	}
+	n := int(binary.LittleEndian.Uint16(data[8:]))
+	length := int(binary.LittleEndian.Uint32(data[14:]))
+	got, end := len(data)-slideshowHeaderSize, slideshowHeaderSize+n*length
+	if s.Version == slideshowSequenced {
+		if got < n*length+2 {
+			return nil, fmt.Errorf("%w: %d frames of %d bytes and their sequence take more than %d bytes, got %d", errSize, n, length, n*length+2, got)
+		}
+		got -= 2 + 2*int(binary.LittleEndian.Uint16(data[end:]))
+	}
+	if got != n*length {
+		return nil, fmt.Errorf("%w: %d frames of %d bytes take %d bytes, got %d", errSize, n, length, n*length, got)
+	}
+	s.Frames = make([][]byte, n)
+	for i := range s.Frames {
+		start := slideshowHeaderSize + i*length
+		s.Frames[i] = data[start : start+length]
+	}
+	if s.Version == slideshowSequenced {
+		s.Sequence = make([]int, binary.LittleEndian.Uint16(data[end:]))
+		for i := range s.Sequence {
+			s.Sequence[i] = int(binary.LittleEndian.Uint16(data[end+2+2*i:]))
+			if s.Sequence[i] >= n {
+				return nil, fmt.Errorf("the sequence of the slideshow shows frame %d, it only has %d", s.Sequence[i], n)
+			}
+		}
+	}
+	return s, nil
+}
+
+// writeSlideshow writes the frames of every input to the slideshow: -o, or a
+// file named after the ratio
+func (o *Options) writeSlideshow(slides []bundleEntry) error {
+	frames := make([][]byte, len(slides))
+	for i, slide := range slides {
+		frames[i] = slide.data
+	}
+	var sequence []int
+	if o.DedupeFrames == "global" {
+		frames, sequence = uniqueFrames(frames)
+	}
+	x, y := slides[0].x, slides[0].y
+	if strings.HasSuffix(o.Output, ".go") {
+		_, err := o.writeOutput(o.Output, func(w io.Writer) error {
+			var buf bytes.Buffer
+			name := o.goVarName(strings.TrimSuffix(filepath.Base(o.Output), ".go"))
+			if err := FprintFramesGo(&buf, o.generatedHeader("//", "//go:generate ", filepath.Dir(o.Output)), o.goPackage(), name, frames, nil); err != nil {
+				return err
+			}
+			if sequence != nil {
+				if err := fprintGoSequence(&buf, name, sequence, nil); err != nil {
+					return err
+				}
+			}
+			if err := fprintGoSize(&buf, name, x, y); err != nil {
+				return err
+			}
+			if err := fprintGoPacking(&buf, name, frameLen(frames), o.layoutName(), o.bitOrderName()); err != nil {
+				return err
+			}
+			if o.Export {
+				if err := fprintGoAccessor(&buf, name, true); err != nil {
+					return err
+				}
+			}
+			src, err := format.Source(buf.Bytes())
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(src)
+			return err
+		})
+		return err
+	}
+	s := Slideshow{
+		Version:  slideshowVersion,
+		Depth:    uint8(o.Palette.Depth),
+		RowMajor: o.Palette.RowMajor,
+		Width:    uint16(x),
+		Height:   uint16(y),
+		Frames:   frames,
+	}
+	if sequence != nil {
+		s.Version, s.Sequence = slideshowSequenced, sequence
+	}
+	_, err := o.writeOutput(filepath.Join(o.OutDir, o.Ratio+"-slideshow.bin"), func(w io.Writer) error {
+		_, err := w.Write(EncodeSlideshow(s))
+		return err
+	})
+	return err
+}
+
+// inspectSlideshow prints what the slideshow s read from path holds to w,
+// followed by its frames when -show is set
+func (o *Options) inspectSlideshow(w io.Writer, path string, s *Slideshow) error {
+	layout, length := packingLayout(s.RowMajor).String(), 0
+	if len(s.Frames) > 0 {
+		length = len(s.Frames[0])
+	}
+	fmt.Fprintf(w, "%s:\n  slideshow version: %d\n  size: %dx%d\n  depth: %d bit(s) per pixel\n  layout: %s\n  frames: %d\n  frame data: %d bytes\n",
+		path, s.Version, s.Width, s.Height, s.Depth, layout, len(s.Frames), length)
+	if s.Sequence != nil {
+		fmt.Fprintf(w, "  sequence: %d frames shown\n", len(s.Sequence))
+	}
+	if !o.Show {
+		return nil
+	}
+	if int(s.Depth) != o.Palette.Depth || s.RowMajor != o.Palette.RowMajor {
+		return fmt.Errorf("can't show a %d bit %s image with the %s palette, pick a matching one with -colors or -palette", s.Depth, layout, o.Palette.Name)
+	}
+	for i, frame := range s.Playback() {
+		if s.Sequence != nil {
+			fmt.Fprintf(w, "frame %d (frame %d stored):\n", i, s.Sequence[i])
+		} else {
+			fmt.Fprintf(w, "frame %d:\n", i)
+		}
+		o.showImg(w, int(s.Width), int(s.Height), frame)
+	}
+	return nil
+}
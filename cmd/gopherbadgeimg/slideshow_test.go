@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSlideshow(t *testing.T) {
+	dir := t.TempDir()
+	// three slides of 1, 2 and 4 cells across, which all pack differently
+	var inputs, want []string
+	for i, cells := range []int{1, 2, 4} {
+		path := filepath.Join(dir, fmt.Sprintf("slide%d.png", i))
+		writeCheckerboard(t, path, 32, 32, cells, cells)
+		bin := filepath.Join(dir, fmt.Sprintf("slide%d.bin", i))
+		if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "32x32", "-o", bin, path); code != 0 {
+			t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+		}
+		data, err := os.ReadFile(bin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputs, want = append(inputs, path), append(want, string(data))
+	}
+	if want[0] == want[1] || want[1] == want[2] {
+		t.Fatal("expected the slides to differ")
+	}
+
+	show := filepath.Join(dir, "show.bin")
+	if code, _, errOut := runCLI(t, append([]string{"-outmode", "slideshow", "-ratio", "32x32", "-o", show}, inputs...)...); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	data, err := os.ReadFile(show)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := DecodeSlideshow(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Width != 32 || s.Height != 32 || s.Depth != 1 || len(s.Frames) != 3 {
+		t.Fatalf("expected 3 frames of 32x32 at 1 bit per pixel, got %d of %dx%d at %d", len(s.Frames), s.Width, s.Height, s.Depth)
+	}
+	for i, frame := range s.Frames {
+		if string(frame) != want[i] {
+			t.Errorf("expected frame %d to be the bin conversion of its input", i)
+		}
+	}
+	if !bytes.Equal(EncodeSlideshow(*s), data) {
+		t.Error("expected the slideshow to encode back to the same file")
+	}
+
+	_, out, _ := runCLI(t, "inspect", show)
+	if !strings.Contains(out, "frames: 3\n") || !strings.Contains(out, "frame data: 128 bytes\n") {
+		t.Errorf("expected inspect to describe the slideshow, got\n%s", out)
+	}
+	if code, _, errOut := runCLI(t, "decode", show); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	for i := range 3 {
+		checkDecoded(t, filepath.Join(dir, fmt.Sprintf("show-%03d.png", i)), 32, 32, []byte(want[i]))
+	}
+	single := filepath.Join(dir, "single.png")
+	if code, _, errOut := runCLI(t, "decode", "-frame", "1", "-o", single, show); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	checkDecoded(t, single, 32, 32, []byte(want[1]))
+
+	goFile := filepath.Join(dir, "show.go")
+	if code, _, errOut := runCLI(t, append([]string{"-outmode", "slideshow", "-ratio", "32x32", "-export", "-pkg", "slides", "-o", goFile}, inputs...)...); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	src, err := os.ReadFile(goFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := runGoModule(t, map[string]string{
+		"slides/show.go": string(src),
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/badge/slides"
+)
+
+func main() {
+	frame, w, h := slides.ShowFrame(2)
+	fmt.Printf("%d %d %d %x\n", len(slides.Show), w, h, frame)
+}
+`,
+	})
+	if wantGo := fmt.Sprintf("3 32 32 %x\n", want[2]); got != wantGo {
+		t.Errorf("expected %q, got %q", wantGo, got)
+	}
+
+	for _, args := range [][]string{
+		{"-outmode", "slideshow,bin", "-ratio", "32x32"},
+		{"-outmode", "slideshow", "-ratio", "32x32,64x64"},
+		{"-outmode", "slideshow", "-ratio", "32x32", "-header"},
+		{"-outmode", "slideshow", "-ratio", "32x32", "-export"},
+	} {
+		code, _, errOut := runCLI(t, append(args, inputs...)...)
+		if code != 2 || !strings.Contains(errOut, "error: ") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ftypBrands names the brands of ISO media files (HEIC and AVIF photos,
+// Canon's CR3 raw photos), which give theirs at offset 8 after an "ftyp" box
+// header at offset 4
+var ftypBrands = map[string]string{
+	"heic": "a HEIC photo",
+	"heix": "a HEIC photo",
+	"hevc": "a HEIC photo",
+	"heim": "a HEIC photo",
+	"heis": "a HEIC photo",
+	"mif1": "a HEIF photo",
+	"msf1": "a HEIF photo",
+	"avif": "an AVIF image",
+	"avis": "an AVIF image",
+	"crx ": "a Canon CR3 raw photo",
+}
+
+// signatures are the magic numbers of formats that can't be converted, but
+// which are common enough to be named when they are given
+var signatures = []struct {
+	magic, name string
+}{
+	{"%PDF-", "a PDF document"},
+	{"II*\x00", "a TIFF image or a camera raw photo (DNG, CR2, NEF, ARW...)"},
+	{"MM\x00*", "a TIFF image or a camera raw photo (DNG, CR2, NEF, ARW...)"},
+	{"FUJIFILMCCD-RAW", "a Fujifilm RAF raw photo"},
+	{"8BPS", "a Photoshop document"},
+	{"\xff\x0a", "a JPEG XL image"},
+	{"\x00\x00\x00\x0cJXL ", "a JPEG XL image"},
+	{"\x1f\x8b", "gzip compressed data, such as an .svgz file, which must be decompressed first"},
+}
+
+// trailers are how files of the formats that have one end, when they aren't
+// truncated; some decoders report a truncated file as corrupted data instead
+var trailers = map[string]string{
+	"png":  "IEND\xaeB`\x82",
+	"jpeg": "\xff\xd9",
+	"gif":  ";",
+}
+
+// truncated reports whether err, the error of decoding data as format, is
+// because data ends too early. Some decoders, such as GIF's, only keep the
+// message of the io.ErrUnexpectedEOF they hit.
+func truncated(data []byte, format string, err error) bool {
+	if errors.Is(err, io.ErrUnexpectedEOF) || strings.Contains(err.Error(), io.ErrUnexpectedEOF.Error()) {
+		return true
+	}
+	trailer, ok := trailers[format]
+	return ok && !bytes.HasSuffix(bytes.TrimRight(data, "\x00"), []byte(trailer))
+}
+
+// sniffUnsupported returns what data is when it's in a format that can't be
+// converted, from its magic number, or "" when it isn't recognized
+func sniffUnsupported(data []byte) string {
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		if name, ok := ftypBrands[string(data[8:12])]; ok {
+			return name
+		}
+	}
+	for _, s := range signatures {
+		if bytes.HasPrefix(data, []byte(s.magic)) {
+			return s.name
+		}
+	}
+	// an SVG document is only recognized by its first bytes, which a byte
+	// order mark, blank lines or a comment can push back
+	head := data[:min(len(data), 1024)]
+	if bytes.Contains(head, []byte("<svg")) {
+		return "an SVG document that doesn't start with <?xml or <svg, which must come first"
+	}
+	return ""
+}
+
+// magicBytes describes the first bytes of data, in hex and as text, for
+// errors about data that isn't recognized
+func magicBytes(data []byte) string {
+	if len(data) == 0 {
+		return "nothing, the file is empty"
+	}
+	head := data[:min(len(data), 8)]
+	text := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return '.'
+		}
+		return r
+	}, string(head))
+	return fmt.Sprintf("% x (%q)", head, text)
+}
+
+// explainDecode adds what may help to err, the error of decoding data as an
+// image of format, which is "" when it wasn't recognized: what the data is
+// when it's in a format that can't be converted, or else its first bytes and
+// the formats that can be, and that a file of a supported format appears to
+// be truncated. The error is still err for errors.Is, so that it exits with
+// the code of a decoding error.
+func explainDecode(data []byte, format string, err error) error {
+	supported := strings.Join(supportedInputs(), ", ")
+	switch {
+	case errors.Is(err, image.ErrFormat):
+		if name := sniffUnsupported(data); name != "" {
+			return fmt.Errorf("%w: this is %s, which can't be converted; convert it to one of %s first", err, name, supported)
+		}
+		return fmt.Errorf("%w: the file starts with %s, which is none of the supported formats: %s", err, magicBytes(data), supported)
+	case format != "" && truncated(data, format, err):
+		return fmt.Errorf("file appears truncated: the %s image ends after %d bytes: %w", format, len(data), err)
+	}
+	return err
+}
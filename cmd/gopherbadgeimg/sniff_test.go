@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func TestDecodeHints(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name        string
+		data        []byte
+		want        string
+		unsupported bool
+	}{
+		{"heic", []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), "this is a HEIC photo, which can't be converted", true},
+		{"avif", []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1"), "this is an AVIF image", true},
+		{"pdf", []byte("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n"), "this is a PDF document", true},
+		{"svg", []byte("\xef\xbb\xbf<!-- drawn by hand -->\n<svg xmlns=\"http://www.w3.org/2000/svg\"/>"), "an SVG document that doesn't start with <?xml or <svg", true},
+		{"text", []byte("hello\n"), `the file starts with 68 65 6c 6c 6f 0a ("hello."), which is none of the supported formats: png, jpeg`, true},
+		{"truncated", png[:len(png)/2], "file appears truncated: the png image ends after", false},
+	} {
+		_, err := NewOptions().DecodeFrames(test.data)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: expected %q, got %v", test.name, test.want, err)
+			continue
+		}
+		// the hint doesn't change the class of the error
+		if got := errors.Is(decodeFailed(err), badgeimg.ErrUnsupportedFormat); got != test.unsupported {
+			t.Errorf("%s: expected an unsupported format: %v, got %v", test.name, test.unsupported, got)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "photo.heic")
+	if err := os.WriteFile(path, []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "32x32", path); code != exitDecode || !strings.Contains(errOut, "HEIC photo") {
+		t.Errorf("expected exit code %d and a HEIC hint, got %d and\n%s", exitDecode, code, errOut)
+	}
+}
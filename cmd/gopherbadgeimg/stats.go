@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// -stats counts the pixels on, which are black, in black and white
+// conversions: over the whole image and in each quarter of it. It warns
+// about images that came out nearly all black or all white, which usually
+// means -threshold, -invert or -background is wrong for them; in a batch the
+// warnings are repeated once every input is converted, so that they aren't
+// lost among the other messages.
+
+// Stats counts the pixels on in a black and white conversion, every frame
+// of an animation together
+type Stats struct {
+	// On is how many of the Pixels are on, and Percent their share
+	On      int     `json:"on"`
+	Pixels  int     `json:"pixels"`
+	Percent float64 `json:"percent"`
+	// Quadrants are the percent of pixels on in the top left, top right,
+	// bottom left and bottom right quarters of the image
+	Quadrants [4]float64 `json:"quadrants"`
+}
+
+// frameStats counts the pixels on in frames, packed x by y
+func frameStats(frames [][]byte, x, y int) (*Stats, error) {
+	var on, pixels [4]int
+	for _, frame := range frames {
+		img, err := badgeimg.BytesToImg(x, y, frame, badgeimg.LayoutBadger)
+		if err != nil {
+			return nil, err
+		}
+		for j := range y {
+			for i := range x {
+				q := 0
+				if i >= x/2 {
+					q++
+				}
+				if j >= y/2 {
+					q += 2
+				}
+				pixels[q]++
+				if img.GrayAt(i, j).Y == 0 {
+					on[q]++
+				}
+			}
+		}
+	}
+	s := &Stats{}
+	for q := range 4 {
+		s.On += on[q]
+		s.Pixels += pixels[q]
+		s.Quadrants[q] = percent(on[q], pixels[q])
+	}
+	s.Percent = percent(s.On, s.Pixels)
+	return s, nil
+}
+
+// percent returns n of total as a percentage rounded to a tenth, 0 when total
+// is
+func percent(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(n)*1000/float64(total)) / 10
+}
+
+// String describes s on a single line
+func (s *Stats) String() string {
+	return fmt.Sprintf("%d of %d pixels on (%.1f%%), by quadrant %.1f%% %.1f%% / %.1f%% %.1f%%",
+		s.On, s.Pixels, s.Percent, s.Quadrants[0], s.Quadrants[1], s.Quadrants[2], s.Quadrants[3])
+}
+
+// warning returns what is wrong with an image more than 99% or less than 1%
+// on, if it is
+func (s *Stats) warning() string {
+	switch {
+	case s.On*100 > s.Pixels*99:
+		return fmt.Sprintf("came out nearly all black (%.1f%% on): try a lower -threshold, -invert, or -background white if it is transparent", s.Percent)
+	case s.On*100 < s.Pixels:
+		return fmt.Sprintf("came out nearly all white (%.1f%% on): try a higher -threshold or -invert", s.Percent)
+	}
+	return ""
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"image/color"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	dir := t.TempDir()
+	white := filepath.Join(dir, "white.png")
+	writeSquare(t, white, color.White, false)
+	checker := filepath.Join(dir, "checker.png")
+	writeCheckerboard(t, checker, 32, 32, 2, 2)
+
+	manifest := filepath.Join(dir, "manifest.json")
+	code, _, errOut := runCLI(t, "-outmode", "none", "-ratio", "32x32", "-stats", "-manifest", manifest, checker)
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	if !strings.Contains(errOut, "checker.png at 32x32: 512 of 1024 pixels on (50.0%), by quadrant 100.0% 0.0% / 0.0% 100.0%") || strings.Contains(errOut, "warning") {
+		t.Errorf("expected the stats of the checkerboard without a warning, got\n%s", errOut)
+	}
+	m, _ := readManifest(t, manifest)
+	if s := m.Images[0].Stats; s == nil || s.On != 512 || s.Pixels != 1024 || s.Percent != 50 {
+		t.Errorf("expected 512 of 1024 pixels on in the manifest, got %+v", s)
+	}
+
+	// a photo has no reason to warn
+	code, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "splash", "-stats", "testdata/tainigo_128.png")
+	if code != 0 || !strings.Contains(errOut, "pixels on") || strings.Contains(errOut, "warning") {
+		t.Errorf("expected exit code 0 and no warning, got %d and\n%s", code, errOut)
+	}
+
+	code, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "32x32", "-stats", white)
+	if code != 0 || !strings.Contains(errOut, "white.png at 32x32 came out nearly all white (0.0% on)") {
+		t.Errorf("expected a warning about the white image, got %d and\n%s", code, errOut)
+	}
+	code, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "32x32", "-stats", "-invert", white)
+	if code != 0 || !strings.Contains(errOut, "came out nearly all black (100.0% on)") {
+		t.Errorf("expected a warning about the inverted image, got %d and\n%s", code, errOut)
+	}
+
+	// in a batch the warnings come last, before the summary
+	_, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "32x32", "-stats", white, checker)
+	summary := strings.Index(errOut, "warning: 1 image(s) came out nearly all black or all white:")
+	if summary < 0 || summary < strings.Index(errOut, "checker at 32x32: ") || !strings.Contains(errOut[summary:], "white at 32x32 came out nearly all white") {
+		t.Errorf("expected the warnings after the stats of every input, got\n%s", errOut)
+	}
+
+	code, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "32x32", "-colors", "acep", "-stats", white)
+	if code != 2 || !strings.Contains(errOut, "error: -stats only counts") {
+		t.Errorf("expected exit code 2 and an error, got %d and\n%s", code, errOut)
+	}
+}
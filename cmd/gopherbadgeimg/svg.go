@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"math"
+	"sync"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+func init() {
+	// SVG files are XML, so they either start with an XML declaration or
+	// directly with the svg element
+	for _, magic := range []string{"<?xml", "<svg", "<!DOCTYPE svg"} {
+		image.RegisterFormat("svg", magic, decodeSVG, decodeSVGConfig)
+	}
+}
+
+// rasterizer is implemented by vector images, which are better drawn straight
+// at the target size than scaled after the fact.
+type rasterizer interface {
+	Rasterize(x, y int, background color.Color) *image.RGBA
+}
+
+// svgImage is a parsed SVG document.
+//
+// It satisfies image.Image so that it flows through LoadImg like any other
+// format, but ImgToBytes uses Rasterize to draw it directly at the target
+// ratio, keeping thin strokes crisp.
+type svgImage struct {
+	icon *oksvg.SvgIcon
+
+	once   sync.Once
+	raster *image.RGBA
+}
+
+func decodeSVG(r io.Reader) (image.Image, error) {
+	// strict mode turns elements oksvg can't draw into errors, rather than
+	// silently leaving them out of the picture
+	icon, err := oksvg.ReadIconStream(r, oksvg.StrictErrorMode)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported SVG feature: %w", err)
+	}
+	// oksvg falls back to width and height when there is no viewBox
+	if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 {
+		return nil, errors.New("SVG has neither a viewBox nor a width and height")
+	}
+	return &svgImage{icon: icon}, nil
+}
+
+func decodeSVGConfig(r io.Reader) (image.Config, error) {
+	img, err := decodeSVG(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	b := img.Bounds()
+	return image.Config{ColorModel: color.RGBAModel, Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+func (s *svgImage) ColorModel() color.Model {
+	return color.RGBAModel
+}
+
+// Bounds is the natural size of the document, from its viewBox (or width and
+// height)
+func (s *svgImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, int(math.Ceil(s.icon.ViewBox.W)), int(math.Ceil(s.icon.ViewBox.H)))
+}
+
+// At renders the document at its natural size the first time it is called,
+// leaving the page transparent like any other image with an alpha channel
+func (s *svgImage) At(x, y int) color.Color {
+	s.once.Do(func() {
+		b := s.Bounds()
+		s.raster = s.Rasterize(b.Dx(), b.Dy(), color.Transparent)
+	})
+	return s.raster.At(x, y)
+}
+
+// Rasterize draws the document stretched to x by y pixels on a page of the
+// background color
+func (s *svgImage) Rasterize(x, y int, background color.Color) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, x, y))
+	draw.Draw(dst, dst.Rect, image.NewUniform(background), image.Point{}, draw.Src)
+	// SetTarget changes the icon's transform, so work on a copy to keep the
+	// image safe to rasterize at several sizes
+	icon := *s.icon
+	icon.SetTarget(0, 0, float64(x), float64(y))
+	scanner := rasterx.NewScannerGV(x, y, dst, dst.Bounds())
+	icon.Draw(rasterx.NewDasher(x, y, scanner), 1)
+	return dst
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSVGRatios(t *testing.T) {
+	opts := NewOptions()
+	opts.DisableDithering = true
+
+	src, err := LoadImg("testdata/circle-rect.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the document is a 100x50 viewBox with a square on the left half and a
+	// circle of radius 20 centered on the right half
+	for _, size := range []struct {
+		name string
+		x, y int
+	}{
+		{"profile", 120, 128},
+		{"splash", 246, 128},
+	} {
+		imgBits := opts.ImgToBytes(size.x, size.y, src)
+		checks := []struct {
+			i, j int
+			on   bool
+		}{
+			{size.x / 4, size.y / 2, true},     // inside the square
+			{size.x * 3 / 4, size.y / 2, true}, // circle center
+			{size.x - 1, 0, false},             // top right corner, outside the circle
+			{size.x - 1, size.y - 1, false},    // bottom right corner
+			{size.x / 2, 0, false},             // between the square and the circle
+		}
+		for _, c := range checks {
+			if got := bitAt(size.y, c.i, c.j, imgBits); got != c.on {
+				t.Errorf("%s: expected pixel (%d, %d) to be %v, got %v", size.name, c.i, c.j, c.on, got)
+			}
+		}
+	}
+}
+
+func TestSVGUnsupported(t *testing.T) {
+	_, err := LoadImg("testdata/unsupported.svg")
+	if err == nil || !strings.Contains(err.Error(), "unsupported SVG feature") {
+		t.Errorf("expected an unsupported feature error, got %v", err)
+	}
+}
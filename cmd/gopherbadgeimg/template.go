@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"golang.org/x/image/draw"
+	"rsc.io/qr"
+)
+
+// -template draws a whole badge face from a JSON file instead of converting
+// inputs: elements placed in boxes on the canvas, which is -ratio, drawn in
+// order over a background, white by default, and the result is converted
+// like any image, dithering and all:
+//
+//	{
+//		"name": "{id}",
+//		"elements": [
+//			{"type": "image", "path": "photos/{id}.jpg", "x": 0, "y": 0, "w": 64, "h": 64},
+//			{"type": "text", "text": "{name}", "size": 26, "x": 64, "y": 0, "w": 182, "h": 40},
+//			{"type": "qr", "text": "https://example.com/{id}", "x": 182, "y": 64, "w": 64, "h": 64},
+//			{"type": "rect", "fill": true, "x": 0, "y": 126, "w": 246, "h": 2}
+//		]
+//	}
+//
+// Images are scaled to fit their box keeping their aspect ratio, and
+// centered in it; relative paths are relative to the template. Text is drawn
+// as -text draws it, with font, size, align, fit and shrink; QR codes as -qr
+// draws them, with level; rectangles are filled, or outlined by a pixel,
+// with color, black by default.
+//
+// With -data, a CSV file whose first row names its columns, one badge is drawn
+// per row, with {column} replaced by the value of the row in every string of
+// the template, and named after the template's name, or else after the data
+// file and the number of the row. A row that can't be drawn, such as one
+// missing a value or whose image goes past the edges of the canvas, fails on
+// its own, naming the row, and the others are still converted.
+
+// templateTypes are the types of the elements of a template
+var templateTypes = []string{"image", "text", "qr", "rect"}
+
+// badgeTemplate is a -template file
+type badgeTemplate struct {
+	// Name is what the badges drawn with -data are named after
+	Name string `json:"name"`
+	// Background is the color of the canvas, as badgeimg.ParseColor parses
+	// it, white when empty
+	Background string            `json:"background"`
+	Elements   []templateElement `json:"elements"`
+	// dir is the directory of the template, the paths in it are relative to
+	dir string
+}
+
+// templateElement is an element of a template, drawn in the box W by H at X
+// and Y on the canvas
+type templateElement struct {
+	Type string `json:"type"`
+	X    int    `json:"x"`
+	Y    int    `json:"y"`
+	W    int    `json:"w"`
+	H    int    `json:"h"`
+	// Path is the image of an image element
+	Path string `json:"path"`
+	// Text is the text of a text or qr element
+	Text string `json:"text"`
+	// Font, Size, Align, Fit and Shrink are -text-font, -text-size, -align,
+	// -fit and -shrink for a text element
+	Font   string  `json:"font"`
+	Size   float64 `json:"size"`
+	Align  string  `json:"align"`
+	Fit    bool    `json:"fit"`
+	Shrink bool    `json:"shrink"`
+	// Level is -qr-level for a qr element
+	Level string `json:"level"`
+	// Color is the color of a rect element, as badgeimg.ParseColor parses
+	// it, black when empty, and Fill fills it instead of outlining it
+	Color string `json:"color"`
+	Fill  bool   `json:"fill"`
+}
+
+// templateField matches the {column} of -data in the strings of a template
+var templateField = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// loadTemplate reads and checks the -template file at path
+func loadTemplate(path string) (*badgeTemplate, []byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, classify(errInput, fmt.Errorf("error reading -template: %w", err))
+	}
+	t := &badgeTemplate{dir: filepath.Dir(path)}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(t); err != nil {
+		return nil, nil, usagef("error: -template %s: %v", path, err)
+	}
+	if err := t.check(); err != nil {
+		return nil, nil, usagef("error: -template %s: %v", path, err)
+	}
+	return t, data, nil
+}
+
+// check checks what can be checked of a template before it is drawn: the
+// rest depends on the values of -data and on the size of the canvas
+func (t *badgeTemplate) check() error {
+	if len(t.Elements) == 0 {
+		return errors.New("no elements")
+	}
+	for i, e := range t.Elements {
+		var err error
+		switch {
+		case !slices.Contains(templateTypes, e.Type):
+			err = fmt.Errorf("invalid type `%s`, expected one of: %s", e.Type, strings.Join(templateTypes, ", "))
+		case e.W <= 0 || e.H <= 0:
+			err = fmt.Errorf("its box is %dx%d, it must have a width and a height", e.W, e.H)
+		case e.Type == "image" && e.Path == "":
+			err = errors.New("no path")
+		case (e.Type == "text" || e.Type == "qr") && e.Text == "":
+			err = errors.New("no text")
+		case e.Size < 0:
+			err = errors.New("the size can't be negative")
+		case e.Fit && e.Shrink:
+			err = errors.New("fit and shrink cannot be combined")
+		case e.Align != "" && e.Align != "left" && e.Align != "center" && e.Align != "right":
+			err = fmt.Errorf("invalid align `%s`, expected left, center or right", e.Align)
+		case e.Level != "" && (len(e.Level) != 1 || !strings.Contains(qrLevels, strings.ToUpper(e.Level))):
+			err = fmt.Errorf("invalid level `%s`, expected one of L, M, Q or H", e.Level)
+		}
+		if err != nil {
+			return fmt.Errorf("element %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// expand replaces the {column} of s with the values of fields, nil without
+// -data
+func expand(s string, fields map[string]string) (string, error) {
+	var err error
+	expanded := templateField.ReplaceAllStringFunc(s, func(m string) string {
+		value, ok := fields[m[1:len(m)-1]]
+		switch {
+		case err != nil:
+		case fields == nil:
+			err = fmt.Errorf("%s needs -data", m)
+		case !ok:
+			err = fmt.Errorf("no value for %s", m)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// templateInputs returns the inputs drawing -template, one per row of -data
+func (o *Options) templateInputs() ([]Input, error) {
+	t, data, err := loadTemplate(o.Template)
+	if err != nil {
+		return nil, err
+	}
+	if o.TemplateData == "" {
+		return []Input{{Path: o.Template, Data: data, Draw: func(x, y int) (image.Image, error) {
+			return t.draw(nil, x, y)
+		}}}, nil
+	}
+
+	columns, rows, err := readTemplateData(o.TemplateData)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(filepath.Base(o.TemplateData), filepath.Ext(o.TemplateData))
+	inputs := make([]Input, len(rows))
+	for i, row := range rows {
+		n := i + 1
+		fields := make(map[string]string, len(columns))
+		for j, column := range columns {
+			if j < len(row) {
+				fields[column] = row[j]
+			}
+		}
+		// the name can lack a value like any string of the template, which
+		// only fails the row
+		name, nameErr := fmt.Sprintf("%s-%03d", base, n), error(nil)
+		if t.Name != "" {
+			expanded, err := expand(t.Name, fields)
+			switch {
+			case err != nil:
+				nameErr = fmt.Errorf("name: %w", err)
+			case strings.TrimSpace(expanded) == "":
+				nameErr = fmt.Errorf("name: %s is empty", t.Name)
+			default:
+				name = expanded
+			}
+		}
+		inputs[i] = Input{
+			Path: fmt.Sprintf("%s row %d", o.TemplateData, n),
+			Name: name,
+			Data: append(append([]byte(nil), data...), strings.Join(row, "\x00")...),
+			Draw: func(x, y int) (image.Image, error) {
+				if nameErr != nil {
+					return nil, fmt.Errorf("row %d: %w", n, nameErr)
+				}
+				img, err := t.draw(fields, x, y)
+				if err != nil {
+					return nil, fmt.Errorf("row %d: %w", n, err)
+				}
+				return img, nil
+			},
+		}
+	}
+	return inputs, nil
+}
+
+// readTemplateData reads the -data CSV file at path, returning the names of
+// its columns and its rows. Rows may have fewer values than there are
+// columns, which fails them only if the template uses those they lack.
+func readTemplateData(path string) ([]string, [][]string, error) {
+	data, err := ReadInput(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading -data: %w", err)
+	}
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	columns, err := r.Read()
+	if err == io.EOF {
+		return nil, nil, usagef("error: -data %s is empty, its first row must name its columns", path)
+	}
+	if err != nil {
+		return nil, nil, usagef("error: -data %s: %v", path, err)
+	}
+	for i := range columns {
+		columns[i] = strings.TrimSpace(columns[i])
+	}
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, usagef("error: -data %s: %v", path, err)
+	}
+	if len(rows) == 0 {
+		return nil, nil, usagef("error: -data %s has no rows below the names of its columns", path)
+	}
+	return columns, rows, nil
+}
+
+// draw draws the template x by y with the values of fields
+func (t *badgeTemplate) draw(fields map[string]string, x, y int) (image.Image, error) {
+	background := color.Color(color.White)
+	if t.Background != "" {
+		hex, err := expand(t.Background, fields)
+		if err != nil {
+			return nil, fmt.Errorf("background: %w", err)
+		}
+		if background, err = badgeimg.ParseColor(hex); err != nil {
+			return nil, fmt.Errorf("background: %w", err)
+		}
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, x, y))
+	draw.Draw(canvas, canvas.Rect, image.NewUniform(background), image.Point{}, draw.Src)
+	for i, e := range t.Elements {
+		if err := t.drawElement(canvas, e, fields); err != nil {
+			return nil, fmt.Errorf("element %d (%s): %w", i+1, e.Type, err)
+		}
+	}
+	return canvas, nil
+}
+
+// drawElement draws e onto canvas
+func (t *badgeTemplate) drawElement(canvas *image.RGBA, e templateElement, fields map[string]string) error {
+	r := image.Rect(e.X, e.Y, e.X+e.W, e.Y+e.H)
+	if !r.In(canvas.Rect) {
+		return fmt.Errorf("its box %dx%d+%d+%d goes past the edges of the %dx%d canvas", e.W, e.H, e.X, e.Y, canvas.Rect.Dx(), canvas.Rect.Dy())
+	}
+	switch e.Type {
+	case "image":
+		path, err := expand(e.Path, fields)
+		if err != nil {
+			return err
+		}
+		if !IsURL(path) && path != stdinName && !filepath.IsAbs(path) {
+			path = filepath.Join(t.dir, path)
+		}
+		src, err := LoadImg(path)
+		if err != nil {
+			return err
+		}
+		drawFitted(canvas, r, *src, "center")
+	case "text":
+		text, err := expand(e.Text, fields)
+		if err != nil {
+			return err
+		}
+		d := &textDrawing{
+			lines:  strings.Split(strings.ReplaceAll(text, `\n`, "\n"), "\n"),
+			size:   e.Size,
+			align:  e.Align,
+			fit:    e.Fit,
+			shrink: e.Shrink,
+			page:   color.Transparent,
+		}
+		if d.size == 0 {
+			d.size = 13
+		}
+		if d.align == "" {
+			d.align = "center"
+		}
+		if e.Font != "" {
+			path, err := expand(e.Font, fields)
+			if err != nil {
+				return err
+			}
+			if !IsURL(path) && !filepath.IsAbs(path) {
+				path = filepath.Join(t.dir, path)
+			}
+			if d.font, err = loadFont(path); err != nil {
+				return err
+			}
+		}
+		img, err := d.draw(e.W, e.H)
+		if err != nil {
+			return unprefixed(err)
+		}
+		draw.Draw(canvas, r, img, image.Point{}, draw.Over)
+	case "qr":
+		text, err := expand(e.Text, fields)
+		if err != nil {
+			return err
+		}
+		level := "M"
+		if e.Level != "" {
+			level = strings.ToUpper(e.Level)
+		}
+		code, err := qr.Encode(text, qr.Level(strings.Index(qrLevels, level)))
+		if err != nil {
+			return fmt.Errorf("%d bytes are more than a QR code holds at level %s", len(text), level)
+		}
+		if side := code.Size + 2*qrQuietZone; min(e.W, e.H) < side {
+			return fmt.Errorf("the QR code is %d modules wide with its quiet zone, which doesn't fit in its %dx%d box: use a larger box, a lower level or shorter text", side, e.W, e.H)
+		}
+		img, err := drawQR(code, e.W, e.H)
+		if err != nil {
+			return err
+		}
+		draw.Draw(canvas, r, img, image.Point{}, draw.Src)
+	case "rect":
+		c := color.Color(color.Black)
+		if e.Color != "" {
+			hex, err := expand(e.Color, fields)
+			if err != nil {
+				return err
+			}
+			if c, err = badgeimg.ParseColor(hex); err != nil {
+				return err
+			}
+		}
+		fill := image.NewUniform(c)
+		if e.Fill {
+			draw.Draw(canvas, r, fill, image.Point{}, draw.Over)
+			break
+		}
+		for _, side := range []image.Rectangle{
+			{r.Min, image.Pt(r.Max.X, r.Min.Y+1)},
+			{image.Pt(r.Min.X, r.Max.Y-1), r.Max},
+			{r.Min, image.Pt(r.Min.X+1, r.Max.Y)},
+			{image.Pt(r.Max.X-1, r.Min.Y), r.Max},
+		} {
+			draw.Draw(canvas, side, fill, image.Point{}, draw.Over)
+		}
+	}
+	return nil
+}
+
+// drawFitted draws src onto dst, scaled to fit r keeping its aspect ratio and
+// placed in it at anchor, one of anchors
+func drawFitted(dst *image.RGBA, r image.Rectangle, src image.Image, anchor string) {
+	b := src.Bounds()
+	w, h := r.Dx(), b.Dy()*r.Dx()/max(1, b.Dx())
+	if h > r.Dy() {
+		w, h = b.Dx()*r.Dy()/max(1, b.Dy()), r.Dy()
+	}
+	if w == 0 || h == 0 {
+		return
+	}
+	at := r.Min.Add(anchorOffset(anchor, image.Pt(r.Dx()-w, r.Dy()-h)))
+	fitted := image.Rectangle{at, at.Add(image.Pt(w, h))}
+	if vector, ok := src.(rasterizer); ok {
+		// vector images are drawn straight at their size, like inputs
+		draw.Draw(dst, fitted, vector.Rasterize(w, h, color.Transparent), image.Point{}, draw.Over)
+		return
+	}
+	draw.NearestNeighbor.Scale(dst, fitted, src, b, draw.Over, nil)
+}
+
+// unprefixed drops the "error: " of the messages written for -text, which
+// the row and element the error comes from go before
+func unprefixed(err error) error {
+	return errors.New(strings.TrimPrefix(err.Error(), "error: "))
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	convert := func(out string, args ...string) []byte {
+		t.Helper()
+		args = append([]string{"-outmode", "bin", "-ratio", "64x64", "-outdir", dir}, args...)
+		if code, _, errOut := runCLI(t, args...); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d and\n%s", args, code, errOut)
+		}
+		data, err := os.ReadFile(filepath.Join(dir, out))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	// a black bar down the left and a QR code on the right
+	badge := write("badge.json", `{
+		"elements": [
+			{"type": "rect", "fill": true, "x": 0, "y": 0, "w": 16, "h": 64},
+			{"type": "qr", "text": "tinygo.org", "level": "L", "x": 24, "y": 16, "w": 40, "h": 32}
+		]
+	}`)
+	golden, err := os.ReadFile("testdata/template.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := convert("64x64.bin", "-template", badge); string(got) != string(golden) {
+		t.Errorf("expected the packed data of testdata/template.golden, got\n%x", got)
+	}
+
+	// a badge per row, the same as the template with the values written in
+	write("people.csv", "id,name,url\nalice,Alice,https://example.com/alice\nbob,Bob,https://example.com/bob\n")
+	write("people.json", `{
+		"name": "{id}",
+		"elements": [
+			{"type": "text", "text": "{name}", "x": 0, "y": 0, "w": 64, "h": 24},
+			{"type": "qr", "text": "{url}", "x": 16, "y": 24, "w": 40, "h": 40}
+		]
+	}`)
+	convert("alice-64x64.bin", "-template", filepath.Join(dir, "people.json"), "-data", filepath.Join(dir, "people.csv"))
+	for _, name := range []string{"alice", "bob"} {
+		data, err := os.ReadFile(filepath.Join(dir, name+"-64x64.bin"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		literal := write(name+".json", `{
+			"elements": [
+				{"type": "text", "text": "`+strings.ToUpper(name[:1])+name[1:]+`", "x": 0, "y": 0, "w": 64, "h": 24},
+				{"type": "qr", "text": "https://example.com/`+name+`", "x": 16, "y": 24, "w": 40, "h": 40}
+			]
+		}`)
+		os.Remove(filepath.Join(dir, "64x64.bin"))
+		if want := convert("64x64.bin", "-template", literal); string(data) != string(want) {
+			t.Errorf("expected the row of %s to draw as the template with its values written in", name)
+		}
+	}
+
+	// rows that can't be drawn fail on their own
+	write("broken.csv", "id,name,url\ncarol,Carol\ndave,Dave,https://example.com/dave\n")
+	write("wide.json", `{
+		"name": "{id}",
+		"elements": [
+			{"type": "text", "text": "{name}", "x": 0, "y": 0, "w": 64, "h": 24},
+			{"type": "qr", "text": "{url}", "x": 32, "y": 24, "w": 40, "h": 40}
+		]
+	}`)
+	for _, test := range []struct {
+		template, want, converted string
+	}{
+		{"people.json", "error converting carol: row 1: element 2 (qr): no value for {url}", "dave-64x64.bin"},
+		{"wide.json", "row 2: element 2 (qr): its box 40x40+32+24 goes past the edges of the 64x64 canvas", ""},
+	} {
+		outdir := filepath.Join(dir, strings.TrimSuffix(test.template, ".json"))
+		code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "64x64", "-outdir", outdir, "-template", filepath.Join(dir, test.template), "-data", filepath.Join(dir, "broken.csv"))
+		if code == 0 || !strings.Contains(errOut, test.want) {
+			t.Errorf("%s: expected %q, got %d and\n%s", test.template, test.want, code, errOut)
+		}
+		if test.converted == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(outdir, test.converted)); err != nil {
+			t.Errorf("%s: expected the other rows to be converted: %v", test.template, err)
+		}
+	}
+
+	for _, test := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"-data", "people.csv", "testdata/tainigo_128.png"}, "-data can only be used with -template"},
+		{[]string{"-template", badge, "-text", "HI"}, "cannot be combined"},
+		{[]string{"-template", badge, "testdata/tainigo_128.png"}, "can't be used with inputs"},
+		{[]string{"-template", write("oval.json", `{"elements": [{"type": "oval", "w": 8, "h": 8}]}`)}, "element 1: invalid type `oval`"},
+		{[]string{"-template", write("flat.json", `{"elements": [{"type": "rect", "w": 8}]}`)}, "element 1: its box is 8x0"},
+		{[]string{"-template", write("empty.json", `{"elements": []}`)}, "no elements"},
+	} {
+		args := append([]string{"-outmode", "none", "-ratio", "64x64"}, test.args...)
+		if code, _, errOut := runCLI(t, args...); code != exitUsage || !strings.Contains(errOut, test.want) {
+			t.Errorf("%v: expected exit code 2 and %q, got %d and\n%s", test.args, test.want, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"golang.org/x/term"
+)
+
+// showStyles are the ways -show can draw a black and white image in the
+// terminal; the first is the default
+var showStyles = []string{"ascii", "braille", "halfblock"}
+
+// brailleDots holds the bit of each dot of a braille character, indexed by
+// its row and column in the 2x4 block (see U+2800)
+var brailleDots = [4][2]rune{
+	{0x01, 0x08},
+	{0x02, 0x10},
+	{0x04, 0x20},
+	{0x40, 0x80},
+}
+
+// showColors are the values of -show-color; the first is the default
+var showColors = []string{"auto", "always", "never"}
+
+// stderrIsTerminal reports whether stderr is a terminal. Tests replace it.
+var stderrIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// terminalWidth returns the width in columns of the terminal on stderr, or 0
+// when stderr isn't a terminal. Tests replace it.
+var terminalWidth = func() int {
+	if !stderrIsTerminal() {
+		return 0
+	}
+	width, _, err := term.GetSize(int(os.Stderr.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// useColor reports whether previews are drawn with ANSI colors: always with
+// -show-color always, and with auto when stderr is a terminal and NO_COLOR
+// (see no-color.org) isn't set
+func (o *Options) useColor() bool {
+	switch o.ShowColor {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return os.Getenv("NO_COLOR") == "" && stderrIsTerminal()
+}
+
+// fprintGlyphs writes a packed image to w one character per pixel: off for
+// the pixels of the color of p closest to white, the paper, and on for the
+// others. With color, on is wrapped in the ANSI color closest to the color of
+// the pixel, except for black which is left in the terminal's own foreground
+// color so that it shows on dark backgrounds too.
+func fprintGlyphs(w io.Writer, x, y int, p *Palette, imgBits []byte, on, off string, color bool) {
+	paper := p.Codes[p.Index(image.White)]
+	sgr := map[byte]int{}
+	if color {
+		for i, code := range p.Codes {
+			if ansi := nearestANSI(p.Colors[i]); ansi != 30 {
+				sgr[code] = ansi
+			}
+		}
+	}
+	var out strings.Builder
+	for j := 0; j < y; j++ {
+		for i := 0; i < x; i++ {
+			code := p.CodeAt(x, y, i, j, imgBits)
+			ansi, colored := sgr[code]
+			switch {
+			case code == paper:
+				out.WriteString(off)
+			case colored:
+				fmt.Fprintf(&out, "\x1b[%dm%s\x1b[0m", ansi, on)
+			default:
+				out.WriteString(on)
+			}
+		}
+		out.WriteByte('\n')
+	}
+	io.WriteString(w, out.String())
+}
+
+// showColumns returns how many columns style takes to draw an image x pixels
+// wide
+func showColumns(style string, x int) int {
+	if style == "braille" {
+		return (x + 1) / 2
+	}
+	return x
+}
+
+// previewScale returns the smallest factor an image x pixels wide must be
+// shrunk by for its preview in style to fit in width columns, 1 when the
+// width is unknown (0)
+func previewScale(style string, x, width int) int {
+	if width <= 0 {
+		return 1
+	}
+	for scale := 1; ; scale++ {
+		if sx := (x + scale - 1) / scale; sx <= 1 || showColumns(style, sx) <= width {
+			return scale
+		}
+	}
+}
+
+// downscale shrinks a black and white packed image by scale, each pixel of the
+// result being on when any pixel of the block it covers is, so that thin lines
+// don't vanish. It returns the new size and the packed pixels.
+func downscale(x, y, scale int, imgBits []byte) (int, int, []byte) {
+	sx, sy := (x+scale-1)/scale, (y+scale-1)/scale
+	scaled := make([]byte, (sx*sy+7)/8)
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			if pixelOn(x, y, i, j, imgBits) {
+				offset := badgeimg.BitIndex(badgeimg.LayoutBadger, i/scale, j/scale, sx, sy)
+				scaled[offset/8] |= badgeimg.LayoutBadger.Mask(offset)
+			}
+		}
+	}
+	return sx, sy, scaled
+}
+
+// fprintScale writes the footer of a preview shrunk by scale to fit in width
+// columns
+func fprintScale(w io.Writer, scale, width int) {
+	fmt.Fprintf(w, "(shown at 1/%d scale to fit %d columns)\n", scale, width)
+}
+
+// pixelOn reports whether pixel (i, j) of a black and white packed image is
+// set, i.e. black
+func pixelOn(x, y, i, j int, imgBits []byte) bool {
+	if i >= x || j >= y {
+		// padding around the image
+		return false
+	}
+	return MonoPalette.CodeAt(x, y, i, j, imgBits) == 1
+}
+
+// FprintBraille writes a black and white packed image to w as braille
+// characters, each one drawing a block of 2x4 pixels, so that a splash image
+// takes 123x32 characters. Blocks that go past the edges of the image are
+// padded with pixels that are off.
+func FprintBraille(w io.Writer, x, y int, imgBits []byte) {
+	var out strings.Builder
+	for j := 0; j < y; j += 4 {
+		for i := 0; i < x; i += 2 {
+			char := rune(0x2800)
+			for row, dots := range brailleDots {
+				for col, dot := range dots {
+					if pixelOn(x, y, i+col, j+row, imgBits) {
+						char |= dot
+					}
+				}
+			}
+			out.WriteRune(char)
+		}
+		out.WriteByte('\n')
+	}
+	io.WriteString(w, out.String())
+}
+
+// FprintHalfBlock writes a black and white packed image to w with half block
+// characters, each one drawing two pixels on top of each other. Terminal cells
+// are about twice as tall as they are wide, so the pixels come out about
+// square. With an odd height the missing bottom row is off.
+func FprintHalfBlock(w io.Writer, x, y int, imgBits []byte) {
+	var out strings.Builder
+	for j := 0; j < y; j += 2 {
+		for i := 0; i < x; i++ {
+			top, bottom := pixelOn(x, y, i, j, imgBits), pixelOn(x, y, i, j+1, imgBits)
+			switch {
+			case top && bottom:
+				out.WriteRune('█')
+			case top:
+				out.WriteRune('▀')
+			case bottom:
+				out.WriteRune('▄')
+			default:
+				out.WriteByte(' ')
+			}
+		}
+		out.WriteByte('\n')
+	}
+	io.WriteString(w, out.String())
+}
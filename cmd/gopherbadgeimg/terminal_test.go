@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+func TestFprintBraille(t *testing.T) {
+	// a 3x8 image: the first column all black, the second with its top pixel
+	// black, the third with its bottom pixel black
+	imgBits := []byte{0xff, 0x80, 0x01}
+
+	var out bytes.Buffer
+	FprintBraille(&out, 3, 8, imgBits)
+	// dots 1, 2, 3, 7 (the left column) and 4 (top right) make U+284F; the
+	// third column is padded with a column that's off
+	want := "⡏⠀\n⡇⡀\n"
+	if out.String() != want {
+		t.Errorf("expected %q, got %q", want, out.String())
+	}
+
+	// -show-style picks it, and a splash image fits in 123x32 characters
+	stubTerminalWidth(t, 0)
+	opts := NewOptions()
+	opts.ShowStyle = "braille"
+	out.Reset()
+	opts.showImg(&out, 246, 128, make([]byte, 246*128/8))
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 32 || len([]rune(lines[0])) != 123 {
+		t.Errorf("expected 32 lines of 123 characters, got %d of %d", len(lines), len([]rune(lines[0])))
+	}
+}
+
+func TestFprintHalfBlock(t *testing.T) {
+	// a 4x5 checkerboard, the top left pixel black
+	x, y := 4, 5
+	imgBits := make([]byte, 3)
+	for i := 0; i < x; i++ {
+		for j := 0; j < y; j++ {
+			if (i+j)%2 == 0 {
+				offset := i*y + j
+				imgBits[offset/8] |= 1 << uint(7-offset%8)
+			}
+		}
+	}
+
+	var out bytes.Buffer
+	FprintHalfBlock(&out, x, y, imgBits)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != (y+1)/2 {
+		t.Fatalf("expected %d lines, got %d", (y+1)/2, len(lines))
+	}
+	// the last row has no row below it, which is off
+	want := []string{"▀▄▀▄", "▀▄▀▄", "▀ ▀ "}
+	for i := range want {
+		if lines[i] != want[i] {
+			t.Errorf("expected line %d to be %q, got %q", i, want[i], lines[i])
+		}
+	}
+}
+
+func TestFprintHalfBlockInvert(t *testing.T) {
+	page := image.NewGray(image.Rect(0, 0, 8, 8))
+	draw.Draw(page, page.Rect, image.White, image.Point{}, draw.Src)
+	white := image.Image(page)
+	opts := NewOptions()
+	opts.DisableDithering, opts.Invert, opts.ShowStyle = true, true, "halfblock"
+
+	var out bytes.Buffer
+	opts.showImg(&out, 8, 8, opts.ImgToBytes(8, 8, &white))
+	if want := strings.Repeat("████████\n", 4); out.String() != want {
+		t.Errorf("expected the inverted white image to be all black, got\n%s", out.String())
+	}
+}
+
+// stubTerminalWidth makes terminalWidth report width for the rest of the test
+func stubTerminalWidth(t *testing.T, width int) {
+	t.Helper()
+	saved := terminalWidth
+	terminalWidth = func() int { return width }
+	t.Cleanup(func() { terminalWidth = saved })
+}
+
+func TestPreviewScale(t *testing.T) {
+	tests := []struct {
+		style    string
+		x, width int
+		want     int
+	}{
+		{"ascii", 296, 0, 1},
+		{"ascii", 296, 300, 1},
+		{"ascii", 296, 296, 1},
+		{"ascii", 296, 80, 4},
+		{"ascii", 246, 80, 4},
+		{"ascii", 240, 80, 3},
+		{"halfblock", 296, 100, 3},
+		{"braille", 246, 123, 1},
+		{"braille", 296, 80, 2},
+		{"braille", 296, 40, 4},
+		{"ascii", 10, 1, 10},
+	}
+	for _, test := range tests {
+		if got := previewScale(test.style, test.x, test.width); got != test.want {
+			t.Errorf("%s %d pixels in %d columns: expected 1/%d, got 1/%d", test.style, test.x, test.width, test.want, got)
+		}
+	}
+}
+
+func TestDownscale(t *testing.T) {
+	// a 6x6 image with a one pixel line down its middle column, which lands
+	// in the second column of 2x2 blocks
+	x, y := 6, 6
+	imgBits := make([]byte, 5)
+	for j := 0; j < y; j++ {
+		offset := 3*y + j
+		imgBits[offset/8] |= 1 << uint(7-offset%8)
+	}
+
+	sx, sy, scaled := downscale(x, y, 2, imgBits)
+	if sx != 3 || sy != 3 {
+		t.Fatalf("expected a 3x3 image, got %dx%d", sx, sy)
+	}
+	var out bytes.Buffer
+	FprintImg(&out, sx, sy, scaled, badgeimg.LayoutBadger)
+	if want := " * \n * \n * \n"; out.String() != want {
+		t.Errorf("expected the line to stay, got\n%s", out.String())
+	}
+}
+
+func TestShowImgWidth(t *testing.T) {
+	imgBits := make([]byte, 296*128/8)
+
+	// output that isn't a terminal keeps every pixel
+	stubTerminalWidth(t, 0)
+	var out bytes.Buffer
+	NewOptions().showImg(&out, 296, 128, imgBits)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 128 || len(lines[0]) != 296 {
+		t.Errorf("expected 128 lines of 296 characters, got %d of %d", len(lines), len(lines[0]))
+	}
+
+	// an 80 column terminal
+	stubTerminalWidth(t, 80)
+	out.Reset()
+	NewOptions().showImg(&out, 296, 128, imgBits)
+	lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 33 || len(lines[0]) != 74 {
+		t.Errorf("expected 32 lines of 74 characters and a footer, got %d of %d", len(lines), len(lines[0]))
+	}
+	if want := "(shown at 1/4 scale to fit 80 columns)"; lines[len(lines)-1] != want {
+		t.Errorf("expected the footer %q, got %q", want, lines[len(lines)-1])
+	}
+
+	// -show-width wins over the terminal
+	opts := NewOptions()
+	opts.ShowWidth, opts.ShowStyle = 100, "braille"
+	out.Reset()
+	opts.showImg(&out, 296, 128, imgBits)
+	lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 17 || len([]rune(lines[0])) != 74 {
+		t.Errorf("expected 16 lines of 74 characters and a footer, got %d of %d", len(lines), len([]rune(lines[0])))
+	}
+}
+
+// stubStderrIsTerminal makes stderrIsTerminal report tty for the rest of the
+// test
+func stubStderrIsTerminal(t *testing.T, tty bool) {
+	t.Helper()
+	saved := stderrIsTerminal
+	stderrIsTerminal = func() bool { return tty }
+	t.Cleanup(func() { stderrIsTerminal = saved })
+}
+
+func TestShowGlyphs(t *testing.T) {
+	stubTerminalWidth(t, 0)
+	x, y := 16, 8
+	imgBits := make([]byte, x*y/8)
+	rand.New(rand.NewSource(1)).Read(imgBits)
+
+	opts := NewOptions()
+	opts.ShowOn, opts.ShowOff, opts.ShowColor = "█", "·", "always"
+	var out bytes.Buffer
+	opts.showImg(&out, x, y, imgBits)
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != y {
+		t.Fatalf("expected %d lines, got %d", y, len(lines))
+	}
+	// read the pixels back from the glyphs
+	got := make([]byte, len(imgBits))
+	for j, line := range lines {
+		glyphs := []rune(line)
+		if len(glyphs) != x {
+			t.Fatalf("expected %d characters on line %d, got %q", x, j, line)
+		}
+		for i, glyph := range glyphs {
+			switch glyph {
+			case '█':
+				offset := i*y + j
+				got[offset/8] |= 1 << uint(7-offset%8)
+			case '·':
+			default:
+				t.Fatalf("unexpected character %q at (%d, %d)", glyph, i, j)
+			}
+		}
+	}
+	if !bytes.Equal(got, imgBits) {
+		t.Errorf("expected % x back, got % x", imgBits, got)
+	}
+}
+
+func TestShowColor(t *testing.T) {
+	p, err := ParsePalette("#000000,#ffffff,#ff0000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a row of black, white and red pixels
+	page := image.NewRGBA(image.Rect(0, 0, 3, 8))
+	for j := 0; j < 8; j++ {
+		page.Set(0, j, color.Black)
+		page.Set(1, j, color.White)
+		page.Set(2, j, color.RGBA{0xff, 0x00, 0x00, 0xff})
+	}
+	imgBits := p.PackPalette(3, 8, page)
+
+	show := func(mode string) string {
+		opts := NewOptions()
+		opts.Palette, opts.ShowColor, opts.ShowOn, opts.ShowOff = p, mode, "#", "."
+		var out bytes.Buffer
+		opts.showImg(&out, 3, 8, imgBits)
+		return out.String()
+	}
+
+	// black stays in the terminal's foreground color, red is wrapped in red
+	if want := strings.Repeat("#.\x1b[31m#\x1b[0m\n", 8); show("always") != want {
+		t.Errorf("expected %q, got %q", want, show("always"))
+	}
+	if want := strings.Repeat("#.#\n", 8); show("never") != want {
+		t.Errorf("expected %q, got %q", want, show("never"))
+	}
+
+	// auto only draws in color on a terminal, and without NO_COLOR
+	t.Setenv("NO_COLOR", "")
+	stubStderrIsTerminal(t, false)
+	if strings.Contains(show("auto"), "\x1b") {
+		t.Error("expected no escape sequences when stderr isn't a terminal")
+	}
+	stubStderrIsTerminal(t, true)
+	if !strings.Contains(show("auto"), "\x1b[31m") {
+		t.Error("expected escape sequences when stderr is a terminal")
+	}
+	t.Setenv("NO_COLOR", "1")
+	if strings.Contains(show("auto"), "\x1b") {
+		t.Error("expected no escape sequences with NO_COLOR set")
+	}
+}
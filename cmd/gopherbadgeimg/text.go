@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// -text draws a badge from a string instead of reading an image: its lines
+// are drawn in black on the -background (white by default) at the size of
+// each ratio, and the drawing is then converted like any image, dithering and
+// all. The built-in font is a 7x13 bitmap font, only scaled by whole
+// multiples so that it stays crisp; TrueType and OpenType fonts are drawn at
+// any size. Lines are aligned on their ink rather than on their advance, so
+// that centered text has equal margins, and the block of lines is centered
+// vertically.
+
+// textDrawing is the text of -text, and how it is drawn
+type textDrawing struct {
+	lines []string
+	// font is nil for the built-in font
+	font        *opentype.Font
+	size        float64
+	align       string
+	fit, shrink bool
+	page        color.Color
+}
+
+// textLayout is the text measured at one size, in pixels
+type textLayout struct {
+	face font.Face
+	// scale is how many times the built-in font is scaled, 1 otherwise
+	scale int
+	// ascent and height are those of a line before scaling, and step how far
+	// apart lines are
+	ascent, height, step int
+	// inks are where the ink of each line starts and ends, before scaling
+	inks [][2]int
+	// w and h are the size of the whole block, scaled
+	w, h int
+}
+
+// textInput returns the input drawing -text, read with \n escapes as
+// newlines
+func (o *Options) textInput() (Input, error) {
+	text := strings.ReplaceAll(o.Text, `\n`, "\n")
+	t := &textDrawing{
+		lines:  strings.Split(text, "\n"),
+		size:   o.TextSize,
+		align:  o.Align,
+		fit:    o.Fit,
+		shrink: o.Shrink,
+		page:   o.Background,
+	}
+	if t.page == nil {
+		t.page = color.White
+	}
+	if o.TextFont != "" {
+		f, err := loadFont(o.TextFont)
+		if err != nil {
+			return Input{}, err
+		}
+		t.font = f
+	}
+	if o.Marquee {
+		return Input{Path: "-text", Data: []byte(text), Draw: t.banner}, nil
+	}
+	return Input{Path: "-text", Data: []byte(text), Draw: t.draw}, nil
+}
+
+// layout measures the text at size: the built-in font comes in whole
+// multiples of its 13 pixels only
+func (t *textDrawing) layout(size float64) (*textLayout, error) {
+	l := &textLayout{face: basicfont.Face7x13, scale: max(1, int(math.Round(size/13)))}
+	if t.font != nil {
+		face, err := newFace(t.font, size)
+		if err != nil {
+			return nil, err
+		}
+		l.face, l.scale = face, 1
+	}
+	metrics := l.face.Metrics()
+	l.ascent = metrics.Ascent.Ceil()
+	l.height = l.ascent + metrics.Descent.Ceil()
+	l.step = metrics.Height.Ceil()
+	for _, line := range t.lines {
+		bounds, _ := font.BoundString(l.face, line)
+		ink := [2]int{bounds.Min.X.Floor(), bounds.Max.X.Ceil()}
+		l.inks = append(l.inks, ink)
+		l.w = max(l.w, (ink[1]-ink[0])*l.scale)
+	}
+	l.h = ((len(t.lines)-1)*l.step + l.height) * l.scale
+	return l, nil
+}
+
+// sizes returns the sizes the text can be fitted at in a y pixels high image,
+// smallest first
+func (t *textDrawing) sizes(y int) []float64 {
+	var sizes []float64
+	if t.font == nil {
+		for scale := 1; scale == 1 || scale*13 <= y; scale++ {
+			sizes = append(sizes, float64(scale*13))
+		}
+		return sizes
+	}
+	for size := 1; size == 1 || size <= y; size++ {
+		sizes = append(sizes, float64(size))
+	}
+	return sizes
+}
+
+// largest returns the layout of the largest of sizes the text fits x by y at,
+// or nil if it doesn't fit at any
+func (t *textDrawing) largest(sizes []float64, x, y int) (*textLayout, error) {
+	var err error
+	// the text grows with its size, so the sizes it fits at come first
+	i := sort.Search(len(sizes), func(i int) bool {
+		l, lerr := t.layout(sizes[i])
+		if lerr != nil {
+			err = lerr
+			return true
+		}
+		return l.w > x || l.h > y
+	})
+	if err != nil || i == 0 {
+		return nil, err
+	}
+	return t.layout(sizes[i-1])
+}
+
+// fitLayout returns the layout the text is drawn x by y with: the largest
+// that fits with -fit, -text-size otherwise, shrunk with -shrink if it
+// doesn't fit
+func (t *textDrawing) fitLayout(x, y int) (*textLayout, error) {
+	if t.fit {
+		l, err := t.largest(t.sizes(y), x, y)
+		if err == nil && l == nil {
+			err = fmt.Errorf("error: the text doesn't fit in %dx%d, even at its smallest", x, y)
+		}
+		return l, err
+	}
+	l, err := t.layout(t.size)
+	if err != nil || (l.w <= x && l.h <= y) {
+		return l, err
+	}
+	if !t.shrink {
+		return nil, fmt.Errorf("error: the text is %dx%d pixels, too large for %dx%d: use -shrink, -fit or a smaller -text-size", l.w, l.h, x, y)
+	}
+	smaller := t.sizes(y)
+	for len(smaller) > 0 && smaller[len(smaller)-1] >= t.size {
+		smaller = smaller[:len(smaller)-1]
+	}
+	found, err := t.largest(smaller, x, y)
+	if err == nil && found == nil {
+		err = fmt.Errorf("error: the text is %dx%d pixels and doesn't fit in %dx%d, even at its smallest", l.w, l.h, x, y)
+	}
+	return found, err
+}
+
+// banner draws the text y pixels high and as wide as it needs, with a margin
+// of a quarter of its height on either side, for -marquee: it is laid out as
+// if it had all the width it wants
+func (t *textDrawing) banner(x, y int) (image.Image, error) {
+	l, err := t.fitLayout(math.MaxInt32, y)
+	if err != nil {
+		return nil, err
+	}
+	l.face.Close()
+	return t.draw(l.w+y/2, y)
+}
+
+// draw draws the text x by y
+func (t *textDrawing) draw(x, y int) (image.Image, error) {
+	l, err := t.fitLayout(x, y)
+	if err != nil {
+		return nil, err
+	}
+	defer l.face.Close()
+
+	img := image.NewRGBA(image.Rect(0, 0, x, y))
+	draw.Draw(img, img.Rect, image.NewUniform(t.page), image.Point{}, draw.Src)
+	top := (y - l.h) / 2
+	for i, line := range t.lines {
+		w := l.inks[i][1] - l.inks[i][0]
+		if w <= 0 {
+			continue
+		}
+		mask := image.NewAlpha(image.Rect(0, 0, w, l.height))
+		d := font.Drawer{Dst: mask, Src: image.Opaque, Face: l.face, Dot: fixed.P(-l.inks[i][0], l.ascent)}
+		d.DrawString(line)
+
+		var left int
+		switch t.align {
+		case "center":
+			left = (x - w*l.scale) / 2
+		case "right":
+			left = x - w*l.scale
+		}
+		r := image.Rect(0, 0, w*l.scale, l.height*l.scale).Add(image.Pt(left, top+i*l.step*l.scale))
+		scaled := image.NewAlpha(r)
+		draw.NearestNeighbor.Scale(scaled, r, mask, mask.Rect, draw.Src, nil)
+		draw.DrawMask(img, r, image.Black, image.Point{}, scaled, r.Min, draw.Over)
+	}
+	return img, nil
+}
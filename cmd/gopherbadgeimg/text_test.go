@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// inkMargins returns how many blank columns a packed x by y image has left and
+// right of its black pixels
+func inkMargins(t *testing.T, x, y int, data []byte) (int, int) {
+	t.Helper()
+	img, err := badgeimg.BytesToImg(x, y, data, badgeimg.LayoutBadger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, last := -1, -1
+	for px := range x {
+		for py := range y {
+			if img.GrayAt(px, py).Y == 0 {
+				if first < 0 {
+					first = px
+				}
+				last = px
+				break
+			}
+		}
+	}
+	if first < 0 {
+		t.Fatal("expected some text to be drawn, got a blank image")
+	}
+	return first, x - 1 - last
+}
+
+func TestText(t *testing.T) {
+	dir := t.TempDir()
+	ttf := filepath.Join(dir, "Go-Regular.ttf")
+	if err := os.WriteFile(ttf, goregular.TTF, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	convert := func(args ...string) []byte {
+		t.Helper()
+		out := filepath.Join(dir, "text.bin")
+		args = append([]string{"-outmode", "bin", "-ratio", "64x64", "-threshold", "128", "-force", "-o", out}, args...)
+		if code, _, errOut := runCLI(t, args...); code != 0 {
+			t.Fatalf("%v: expected exit code 0, got %d and\n%s", args, code, errOut)
+		}
+		data, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	for _, font := range [][]string{nil, {"-text-font", ttf, "-fit"}} {
+		args := append([]string{"-text", `JANE\nDOE`}, font...)
+		first := convert(args...)
+		if again := convert(args...); !bytes.Equal(first, again) {
+			t.Errorf("%v: expected the same text to be drawn the same", font)
+		}
+		if left, right := inkMargins(t, 64, 64, first); left-right > 1 || right-left > 1 {
+			t.Errorf("%v: expected centered text to have equal margins, got %d and %d", font, left, right)
+		}
+		if font != nil {
+			if left, right := inkMargins(t, 64, 64, first); left+right > 8 {
+				t.Errorf("expected -fit to fill the width, got margins of %d and %d", left, right)
+			}
+		}
+	}
+	if left, _ := inkMargins(t, 64, 64, convert("-text", "JANE", "-align", "left")); left != 0 {
+		t.Errorf("expected left aligned text to start at the edge, got a margin of %d", left)
+	}
+	if _, right := inkMargins(t, 64, 64, convert("-text", "JANE", "-align", "right")); right != 0 {
+		t.Errorf("expected right aligned text to end at the edge, got a margin of %d", right)
+	}
+
+	// 13 characters of the built-in font are 91 pixels wide
+	long := []string{"-outmode", "bin", "-ratio", "64x64", "-text", "JANE DOE ACME"}
+	if code, _, errOut := runCLI(t, append(long, "-text-font", ttf, "-text-size", "20")...); code != 1 || !strings.Contains(errOut, "too large for 64x64") {
+		t.Errorf("expected text too large to fail, got %d and\n%s", code, errOut)
+	}
+	shrunk := convert("-text", "JANE DOE ACME", "-text-font", ttf, "-text-size", "20", "-shrink")
+	if left, right := inkMargins(t, 64, 64, shrunk); left+right > 8 {
+		t.Errorf("expected -shrink to shrink the text just enough, got margins of %d and %d", left, right)
+	}
+	if code, _, errOut := runCLI(t, long...); code != 1 || !strings.Contains(errOut, "error: ") {
+		t.Errorf("expected the built-in font too wide to fail, got %d and\n%s", code, errOut)
+	}
+
+	for _, args := range [][]string{
+		{"-text", "JANE", "-align", "middle"},
+		{"-text", "JANE", "-fit", "-shrink"},
+		{"-text", "JANE", "gopher.png"},
+		{"-fit", "gopher.png"},
+	} {
+		code, _, errOut := runCLI(t, append([]string{"-outmode", "bin"}, args...)...)
+		if code != 2 || !strings.Contains(errOut, "error: ") {
+			t.Errorf("%v: expected exit code 2 and an error, got %d and\n%s", args, code, errOut)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// -timings reports how long each stage of the conversion of an input took,
+// and how much it allocated, on stderr and in the manifest. The stages are,
+// in the order they run:
+//
+//	decode      reading the image out of its format, compositing GIF frames
+//	scale       scaling it to -ratio, or rasterizing SVG
+//	preprocess  compositing the -overlay images and -invert
+//	dither      reducing it to the colors of the panel
+//	pack        packing its pixels into bytes
+//	emit        writing the outputs
+//
+// The frames of an animation add up, and each ratio of -ratio is reported on
+// its own, the first one with the decoding. Allocations are those the
+// runtime counts for the whole program: with -jobs above 1, inputs converted
+// at the same time count each other's, and small ones may only be counted by
+// a later stage, once the runtime tallies them.
+//
+// -cpuprofile and -memprofile write pprof profiles of the whole run instead,
+// for go tool pprof.
+
+const (
+	stageDecode = iota
+	stageScale
+	stagePreprocess
+	stageDither
+	stagePack
+	stageEmit
+)
+
+// stageNames are the names of the stages -timings reports
+var stageNames = [...]string{"decode", "scale", "preprocess", "dither", "pack", "emit"}
+
+// StageTiming is what a stage of a conversion took, with -timings
+type StageTiming struct {
+	Stage string `json:"stage"`
+	// Nanoseconds is the wall time of the stage
+	Nanoseconds int64 `json:"ns"`
+	// AllocBytes and Allocs are the bytes and objects allocated
+	AllocBytes uint64 `json:"alloc_bytes"`
+	Allocs     uint64 `json:"allocs"`
+}
+
+// stageTimer adds up what the stages of a conversion took. Its methods do
+// nothing on a nil *stageTimer, which is what Options hold without -timings,
+// so that the stages cost a nil check then. A stageTimer is used by a
+// single goroutine.
+type stageTimer struct {
+	stages  [len(stageNames)]StageTiming
+	samples [2]metrics.Sample
+}
+
+// stageMark is the clock and allocations at the start of a stage
+type stageMark struct {
+	at             time.Time
+	bytes, objects uint64
+}
+
+func newStageTimer() *stageTimer {
+	t := &stageTimer{}
+	t.samples[0].Name = "/gc/heap/allocs:bytes"
+	t.samples[1].Name = "/gc/heap/allocs:objects"
+	for i, name := range stageNames {
+		t.stages[i].Stage = name
+	}
+	return t
+}
+
+// mark returns the clock and allocations now, to start a stage
+func (t *stageTimer) mark() stageMark {
+	if t == nil {
+		return stageMark{}
+	}
+	metrics.Read(t.samples[:])
+	return stageMark{time.Now(), t.samples[0].Value.Uint64(), t.samples[1].Value.Uint64()}
+}
+
+// done adds what stage took since m, and returns the mark starting the next
+// stage
+func (t *stageTimer) done(stage int, m stageMark) stageMark {
+	if t == nil {
+		return m
+	}
+	now := t.mark()
+	s := &t.stages[stage]
+	s.Nanoseconds += now.at.Sub(m.at).Nanoseconds()
+	s.AllocBytes += now.bytes - m.bytes
+	s.Allocs += now.objects - m.objects
+	return now
+}
+
+// timings returns what every stage took, nil for a nil *stageTimer
+func (t *stageTimer) timings() []StageTiming {
+	if t == nil {
+		return nil
+	}
+	return append([]StageTiming(nil), t.stages[:]...)
+}
+
+// String describes what every stage took, as -timings prints it
+func (t *stageTimer) String() string {
+	var b strings.Builder
+	for i, s := range t.stages {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "%s %v (%s in %d allocs)", s.Stage, time.Duration(s.Nanoseconds).Round(time.Microsecond), formatBytes(s.AllocBytes), s.Allocs)
+	}
+	return b.String()
+}
+
+// withTimer returns a copy of o timing its stages with t
+func (o *Options) withTimer(t *stageTimer) *Options {
+	timed := *o
+	timed.timer = t
+	return &timed
+}
+
+// formatBytes formats n bytes in the largest binary unit it makes at least
+// one of
+func formatBytes(n uint64) string {
+	const units = "KMGT"
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	v, unit := float64(n)/1024, 0
+	for v >= 1024 && unit < len(units)-1 {
+		v /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %ciB", v, units[unit])
+}
+
+// startProfiles starts the CPU profile of -cpuprofile, and returns the
+// function stopping it and writing the heap profile of -memprofile, either
+// being empty for none
+func startProfiles(cpuProfile, memProfile string) (func(), error) {
+	var cpu *os.File
+	if cpuProfile != "" {
+		var err error
+		if cpu, err = os.Create(cpuProfile); err != nil {
+			return nil, fmt.Errorf("error writing CPU profile: %w", err)
+		}
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			cpu.Close()
+			return nil, fmt.Errorf("error writing CPU profile: %w", err)
+		}
+	}
+	return func() {
+		if cpu != nil {
+			pprof.StopCPUProfile()
+			if err := cpu.Close(); err != nil {
+				logger.Errorf("error writing CPU profile: %v", err)
+			}
+		}
+		if memProfile != "" {
+			if err := writeHeapProfile(memProfile); err != nil {
+				logger.Errorf("error writing memory profile: %v", err)
+			}
+		}
+	}, nil
+}
+
+// writeHeapProfile writes the profile of the memory allocated so far to path
+func writeHeapProfile(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// up to date statistics, rather than those of the last collection
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTimings(t *testing.T) {
+	dir := t.TempDir()
+	manifest := filepath.Join(dir, "manifest.json")
+	cpu, mem := filepath.Join(dir, "cpu.pprof"), filepath.Join(dir, "mem.pprof")
+	code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "64x64", "-o", filepath.Join(dir, "gopher.bin"), "-timings", "-manifest", manifest, "-cpuprofile", cpu, "-memprofile", mem, "testdata/tainigo_128.png")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	_, report, ok := strings.Cut(errOut, "tainigo_128.png at 64x64: ")
+	if !ok {
+		t.Fatalf("expected the timings of tainigo_128.png, got\n%s", errOut)
+	}
+	for _, stage := range stageNames {
+		if !strings.Contains(report, stage+" ") {
+			t.Errorf("expected the %s stage in\n%s", stage, report)
+		}
+	}
+
+	m, _ := readManifest(t, manifest)
+	timings := m.Images[0].Timings
+	if len(timings) != len(stageNames) {
+		t.Fatalf("expected the manifest to time %d stages, got %+v", len(stageNames), timings)
+	}
+	for i, timing := range timings {
+		if timing.Stage != stageNames[i] {
+			t.Errorf("expected stage %d of the manifest to be %s, got %s", i, stageNames[i], timing.Stage)
+		}
+	}
+	for _, stage := range []int{stageDecode, stageDither} {
+		if timings[stage].Nanoseconds <= 0 || timings[stage].Allocs == 0 {
+			t.Errorf("expected %s to take time and allocate, got %+v", stageNames[stage], timings[stage])
+		}
+	}
+
+	// without -timings, the manifest has none
+	code, _, errOut = runCLI(t, "-outmode", "none", "-ratio", "64x64", "-manifest", manifest, "-force", "testdata/tainigo_128.png")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	if m, data := readManifest(t, manifest); m.Images[0].Timings != nil || strings.Contains(string(data), "timings") {
+		t.Errorf("expected no timings without -timings, got\n%s", data)
+	}
+
+	// the profiles are read by go tool pprof
+	if testing.Short() {
+		t.Skip("skipping go tool pprof in short mode")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go not found")
+	}
+	for _, profile := range []string{cpu, mem} {
+		if info, err := os.Stat(profile); err != nil || info.Size() == 0 {
+			t.Fatalf("expected %s to be written, got %v", profile, err)
+		}
+		out, err := exec.Command(gobin, "tool", "pprof", "-raw", profile).CombinedOutput()
+		if err != nil || !strings.Contains(string(out), "PeriodType:") {
+			t.Errorf("expected go tool pprof to read %s, got %v and\n%s", filepath.Base(profile), err, out)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+	"golang.org/x/term"
+)
+
+// -tune previews an image in the terminal and adjusts the conversion with
+// single keys, drawing it again after each:
+//
+//	'+' '-'  raise or lower -threshold by thresholdStep, from 128 when it is
+//	         off and back off below 1
+//	'd'      switch to the next dithering algorithm, turning -threshold and
+//	         -disable-dithering off
+//	'i'      toggle -invert
+//	'w'      write the outputs with the current settings, and print the
+//	         command line writing them
+//	'q'      quit, as do Escape and Ctrl+C
+const thresholdStep = 8
+
+// stdinIsTerminal reports whether stdin is a terminal. Tests replace it.
+var stdinIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// tuner is the state of -tune: the options being tuned and the flags bound
+// to them, which are set as they change so that generateCommand gives the
+// command line of the current settings
+type tuner struct {
+	opts *Options
+	fs   *flag.FlagSet
+	// path is the input, converted to x by y, and frame its first frame
+	path  string
+	frame image.Image
+	x, y  int
+	// w is where the preview is drawn
+	w io.Writer
+	// message is shown under the preview, such as the command line of the
+	// last write
+	message string
+}
+
+// Tune runs -tune on the input at path, reading keys from stdin and drawing
+// on stderr until q is pressed. It refuses to start when stdin isn't a
+// terminal, and puts the terminal back as it was however it returns.
+func (o *Options) Tune(fs *flag.FlagSet, path string, x, y int) error {
+	if !stdinIsTerminal() {
+		return usagef("error: -tune reads keys from the terminal, stdin isn't one")
+	}
+	t, err := o.newTuner(fs, path, x, y, stderr)
+	if err != nil {
+		return err
+	}
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return err
+	}
+	// deferred calls run on panics too
+	defer term.Restore(int(os.Stdin.Fd()), state)
+	// raw mode stops turning \n into \r\n
+	t.w = crlfWriter{stderr}
+	log.SetOutput(t.w)
+	defer log.SetOutput(stderr)
+	t.render()
+	key := make([]byte, 1)
+	for {
+		if _, err := os.Stdin.Read(key); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if t.handle(key[0]) {
+			io.WriteString(t.w, "\n")
+			return nil
+		}
+		t.render()
+	}
+}
+
+// newTuner decodes the input at path and returns the tuner drawing it on w
+func (o *Options) newTuner(fs *flag.FlagSet, path string, x, y int, w io.Writer) (*tuner, error) {
+	frames, err := o.LoadFrames(path)
+	if err != nil {
+		return nil, decodeFailed(fmt.Errorf("error loading source image: %w", err))
+	}
+	return &tuner{opts: o, fs: fs, path: path, frame: frames[0].Image, x: x, y: y, w: w}, nil
+}
+
+// handle applies a key, and reports whether it quits
+func (t *tuner) handle(key byte) bool {
+	o := t.opts
+	t.message = ""
+	switch key {
+	case '+', '=':
+		if o.Threshold <= 0 {
+			t.set("threshold", "128")
+		} else {
+			t.set("threshold", strconv.Itoa(min(o.Threshold+thresholdStep, 255)))
+		}
+	case '-', '_':
+		switch {
+		case o.Threshold <= 0:
+			t.set("threshold", "128")
+		case o.Threshold <= thresholdStep:
+			t.set("threshold", "0")
+		default:
+			t.set("threshold", strconv.Itoa(o.Threshold-thresholdStep))
+		}
+	case 'd':
+		next := (slices.Index(badgeimg.DitherAlgorithms, o.Dither) + 1) % len(badgeimg.DitherAlgorithms)
+		t.set("dither", badgeimg.DitherAlgorithms[next])
+		t.set("threshold", "0")
+		if o.DisableDithering {
+			t.set("disable-dithering", "false")
+		}
+	case 'i':
+		t.set("invert", strconv.FormatBool(!o.Invert))
+	case 'w':
+		t.write()
+	case 'q', 'Q', 0x1b, 0x03:
+		return true
+	}
+	return false
+}
+
+// set sets the flag name, and the option bound to it, to value
+func (t *tuner) set(name, value string) {
+	if err := t.fs.Set(name, value); err != nil {
+		// the values are the tuner's own, this is a programming error
+		panic(err)
+	}
+}
+
+// write converts the input with the current settings, writing the outputs of
+// -outmode, and keeps the command line doing the same for the message
+func (t *tuner) write() {
+	command := generateCommand(t.fs)
+	t.opts.Command = command
+	if _, failed := t.opts.ConvertAll([]string{t.path}, t.x, t.y); len(failed) > 0 {
+		t.message = fmt.Sprintf("error: %v", failed[0])
+		return
+	}
+	t.message = "written, the command line is:\n" + command.in(".")
+}
+
+// status describes the current settings and the keys changing them
+func (t *tuner) status() string {
+	o := t.opts
+	threshold := "off"
+	if o.Threshold != 0 {
+		threshold = thresholdValue{&o.Threshold}.String()
+	}
+	invert := "off"
+	if o.Invert {
+		invert = "on"
+	}
+	dither := o.Dither
+	if o.Threshold != 0 || o.DisableDithering {
+		dither = "off"
+	}
+	return fmt.Sprintf("threshold %s, dither %s, invert %s\n+/- threshold, d dither, i invert, w write, q quit", threshold, dither, invert)
+}
+
+// render clears the terminal and draws the preview with the current settings,
+// then the status and the message
+func (t *tuner) render() {
+	var out strings.Builder
+	out.WriteString("\x1b[H\x1b[2J")
+	img := t.frame
+	t.opts.showImg(&out, t.x, t.y, t.opts.ImgToBytes(t.x, t.y, &img))
+	out.WriteString(t.status() + "\n")
+	if t.message != "" {
+		out.WriteString(t.message + "\n")
+	}
+	io.WriteString(t.w, out.String())
+}
+
+// crlfWriter ends lines with \r\n, for terminals in raw mode
+type crlfWriter struct {
+	w io.Writer
+}
+
+func (c crlfWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(c.w, strings.ReplaceAll(string(p), "\n", "\r\n")); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
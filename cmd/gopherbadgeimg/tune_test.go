@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTune(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "tuned.bin")
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	opts := NewOptions()
+	setupConvert(fs, opts)
+	if err := fs.Parse([]string{"-outmode", "bin", "-ratio", "32x32", "-o", out, "testdata/tainigo_128.png"}); err != nil {
+		t.Fatal(err)
+	}
+	var screen bytes.Buffer
+	tn, err := opts.newTuner(fs, "testdata/tainigo_128.png", 32, 32, &screen)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tn.render()
+	previews := []string{screen.String()}
+
+	for _, step := range []struct {
+		key    byte
+		status string
+	}{
+		{'+', "threshold 128, dither off, invert off"},
+		{'+', "threshold 136, dither off, invert off"},
+		{'-', "threshold 128, dither off, invert off"},
+		{'d', "threshold off, dither atkinson, invert off"},
+		{'i', "threshold off, dither atkinson, invert on"},
+		{'-', "threshold 128, dither off, invert on"},
+	} {
+		if tn.handle(step.key) {
+			t.Fatalf("%q: expected not to quit", step.key)
+		}
+		if got := tn.status(); !strings.HasPrefix(got, step.status+"\n") {
+			t.Errorf("%q: expected %q, got %q", step.key, step.status, got)
+		}
+		screen.Reset()
+		tn.render()
+		if !strings.HasPrefix(screen.String(), "\x1b[H\x1b[2J") {
+			t.Errorf("%q: expected the screen to be cleared and drawn again", step.key)
+		}
+		previews = append(previews, screen.String())
+	}
+	if previews[0] == previews[1] || previews[4] == previews[5] {
+		t.Error("expected the preview to change with the settings")
+	}
+
+	if tn.handle('w') {
+		t.Fatal("expected w not to quit")
+	}
+	tuned, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, command, ok := strings.Cut(tn.message, "command line is:\n")
+	if !ok {
+		t.Fatalf("expected the command line, got %q", tn.message)
+	}
+	for _, want := range []string{"-threshold 128", "-dither atkinson", "-invert"} {
+		if !strings.Contains(command, want) {
+			t.Errorf("expected %q in %q", want, command)
+		}
+	}
+	// the command line writes the same outputs
+	if err := os.Remove(out); err != nil {
+		t.Fatal(err)
+	}
+	if code, _, errOut := runCLI(t, strings.Fields(command)[1:]...); code != 0 {
+		t.Fatalf("expected %q to succeed, got %d and\n%s", command, code, errOut)
+	}
+	if again, err := os.ReadFile(out); err != nil || !bytes.Equal(again, tuned) {
+		t.Errorf("expected the command line to write what -tune did, got %v", err)
+	}
+
+	for _, key := range []byte{'q', 0x1b, 0x03} {
+		if !tn.handle(key) {
+			t.Errorf("expected %q to quit", key)
+		}
+	}
+}
+
+func TestTuneNeedsTerminal(t *testing.T) {
+	old := stdinIsTerminal
+	defer func() { stdinIsTerminal = old }()
+	stdinIsTerminal = func() bool { return false }
+	code, _, errOut := runCLI(t, "-tune", "-outmode", "none", "-ratio", "32x32", "testdata/tainigo_128.png")
+	if code != exitUsage || !strings.Contains(errOut, "stdin isn't one") {
+		t.Errorf("expected -tune to be refused without a terminal, got %d and\n%s", code, errOut)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+)
+
+// -verify checks that generated files are up to date, for CI: the inputs are
+// converted as usual, but instead of being written every output is compared
+// with the file already there, which must hold exactly what would be
+// written. Since everything goes through writeFile, this covers every output
+// mode, rice mode files being generated again in full, and the manifest,
+// -embed and checksum files along with them. Nothing is written, and
+// directories aren't created.
+
+// verifyFile checks that name holds data, describing where it doesn't
+func verifyFile(name string, data []byte) error {
+	existing, err := os.ReadFile(name)
+	if err != nil {
+		return fmt.Errorf("can't verify %s: %w", name, err)
+	}
+	if bytes.Equal(existing, data) {
+		logger.Debugf("%s is up to date", name)
+		return nil
+	}
+	differ, first := diffBytes(existing, data)
+	err = fmt.Errorf("%s is out of date: %d byte(s) differ, the first at offset %d", name, differ, first)
+	if len(existing) != len(data) {
+		err = fmt.Errorf("%w, and it is %d bytes instead of %d", err, len(existing), len(data))
+	}
+	return err
+}
+
+// diffBytes returns how many bytes of a and b differ, bytes past the end of
+// the shorter one included, and the offset of the first one, -1 if none does
+func diffBytes(a, b []byte) (differ, first int) {
+	first = -1
+	for i := range max(len(a), len(b)) {
+		if i < len(a) && i < len(b) && a[i] == b[i] {
+			continue
+		}
+		if first < 0 {
+			first = i
+		}
+		differ++
+	}
+	return differ, first
+}
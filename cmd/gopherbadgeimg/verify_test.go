@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "icon.png")
+	writeCheckerboard(t, src, 32, 32, 2, 2)
+	out := filepath.Join(dir, "out")
+	args := []string{"-outmode", "rice,bin", "-ratio", "32x32", "-outdir", out, "-manifest", filepath.Join(out, "manifest.json"), src}
+	if code, _, errOut := runCLI(t, args...); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	goFile := filepath.Join(out, "32x32-generated.go")
+	before, err := os.Stat(goFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verify := append([]string{"-verify"}, args...)
+	if code, _, errOut := runCLI(t, verify...); code != 0 {
+		t.Fatalf("expected the outputs to match their source, got exit code %d and\n%s", code, errOut)
+	}
+
+	// the source is edited, but not regenerated
+	writeCheckerboard(t, src, 32, 32, 4, 4)
+	code, _, errOut := runCLI(t, verify...)
+	if code != 1 || !strings.Contains(errOut, "32x32-generated.go is out of date: ") {
+		t.Errorf("expected exit code 1 and the Go file to be out of date, got %d and\n%s", code, errOut)
+	}
+	if strings.Contains(errOut, "manifest.json") {
+		t.Errorf("expected the manifest not to be checked once an input failed, got\n%s", errOut)
+	}
+	// 32 columns of 4 bytes, the second and fourth of which flip from cells of
+	// 16 pixels to cells of 8
+	_, _, errOut = runCLI(t, "-verify", "-outmode", "bin", "-ratio", "32x32", "-outdir", out, src)
+	if !strings.Contains(errOut, "32x32.bin is out of date: 64 byte(s) differ, the first at offset 1") {
+		t.Errorf("expected a summary of the bin file differences, got\n%s", errOut)
+	}
+	if after, err := os.Stat(goFile); err != nil || !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("expected -verify to leave %s alone", goFile)
+	}
+
+	// nothing is written for outputs that don't exist
+	missing := filepath.Join(dir, "missing")
+	code, _, errOut = runCLI(t, "-verify", "-outmode", "bin", "-ratio", "32x32", "-outdir", missing, src)
+	if code != 1 || !strings.Contains(errOut, "can't verify ") {
+		t.Errorf("expected exit code 1 and an error, got %d and\n%s", code, errOut)
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("expected -verify not to create %s", missing)
+	}
+
+	if code, _, errOut := runCLI(t, "-verify", "-outmode", "bin", "-ratio", "32x32", "-o", "-", src); code != 2 || !strings.Contains(errOut, "error: -verify") {
+		t.Errorf("expected exit code 2 and an error, got %d and\n%s", code, errOut)
+	}
+}
+
+func TestDiffBytes(t *testing.T) {
+	for _, tc := range []struct {
+		a, b          string
+		differ, first int
+	}{
+		{"abc", "abc", 0, -1},
+		{"abc", "abd", 1, 2},
+		{"abcd", "xbcy", 2, 0},
+		{"abc", "abcde", 2, 3},
+		{"", "ab", 2, 0},
+	} {
+		if differ, first := diffBytes([]byte(tc.a), []byte(tc.b)); differ != tc.differ || first != tc.first {
+			t.Errorf("%q, %q: expected %d byte(s) differing from %d, got %d from %d", tc.a, tc.b, tc.differ, tc.first, differ, first)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// inputFormats are the image formats that can be converted, named as they
+// are registered with image.RegisterFormat
+var inputFormats = []string{"png", "jpeg", "gif", "bmp", "webp", "svg", "ico", "pnm"}
+
+// supportedInputs returns inputFormats, followed by the formats registered
+// with badgeimg.RegisterDecoder
+func supportedInputs() []string {
+	return append(slices.Clip(inputFormats), badgeimg.Decoders()...)
+}
+
+// outModes are the values of -outmode, which can be listed with commas
+var outModes = []string{"rice", "bin", "pbm", "cheader", "python", "base64", "slideshow", "none"}
+
+// layouts are the orders pixels are packed in, see layoutName
+var layouts = append(slices.Clip(badgeimg.LayoutNames), "planes-concat", "planes-interleave")
+
+// toolVersion returns the release of gopherbadgeimg it was built from,
+// (devel) when built from a checkout. Generated files and the manifest are
+// stamped with it, and -version prints it first.
+func toolVersion() string {
+	version := ""
+	if info, ok := debug.ReadBuildInfo(); ok {
+		version = info.Main.Version
+	}
+	return "gopherbadgeimg " + releaseVersion(version)
+}
+
+// pseudoVersion matches the versions the go command makes up for a commit
+// that isn't a tagged release, such as v0.0.0-20261016093112-3cf40c6a1b2d
+var pseudoVersion = regexp.MustCompile(`[-.]\d{14}-[0-9a-f]{12}(\+incompatible)?(\+dirty)?$`)
+
+// releaseVersion returns the module version a build was made from when it is
+// a release, and (devel) otherwise: pseudo-versions hold the time of the
+// commit and +dirty ones depend on the state of the tree, and stamping
+// generated files with them would change the files every time they are
+// regenerated from another commit, for -verify to fail on
+func releaseVersion(version string) string {
+	if version == "" || strings.HasSuffix(version, "+dirty") || pseudoVersion.MatchString(version) {
+		return "(devel)"
+	}
+	return version
+}
+
+// fprintVersion writes what -version prints: toolVersion, the VCS revision
+// it was built from and whether the tree had changes, when the Go toolchain
+// recorded them, and what the build supports, so that a bug report can say
+// exactly what converted an image
+func fprintVersion(w io.Writer) {
+	fmt.Fprintln(w, toolVersion())
+	if info, ok := debug.ReadBuildInfo(); ok {
+		settings := map[string]string{}
+		for _, s := range info.Settings {
+			settings[s.Key] = s.Value
+		}
+		if revision := settings["vcs.revision"]; revision != "" {
+			if settings["vcs.modified"] == "true" {
+				revision += " (dirty)"
+			}
+			fmt.Fprintf(w, "revision: %s\n", revision)
+		}
+		if built := settings["vcs.time"]; built != "" {
+			fmt.Fprintf(w, "revision time: %s\n", built)
+		}
+		fmt.Fprintf(w, "go: %s\n", info.GoVersion)
+	}
+	fmt.Fprintf(w, "dither algorithms: %s\n", strings.Join(badgeimg.DitherAlgorithms, ", "))
+	fmt.Fprintf(w, "layouts: %s\n", strings.Join(layouts, ", "))
+	var colors []string
+	for name := range palettes {
+		colors = append(colors, name)
+	}
+	slices.Sort(colors)
+	fmt.Fprintf(w, "colors: %s, or -palette\n", strings.Join(colors, ", "))
+	fmt.Fprintf(w, "input formats: %s\n", strings.Join(supportedInputs(), ", "))
+}
+
+// formats is what -list-formats lists: everything a build can convert from and
+// to, and how
+type formats struct {
+	Inputs   []string `json:"inputs"`
+	OutModes []string `json:"outmodes"`
+	Layouts  []string `json:"layouts"`
+	Dithers  []string `json:"dithers"`
+}
+
+// fprintFormats writes what -list-formats prints, as JSON with -json or else
+// one "kind name" pair per line, such as "input png", in the same order every
+// time so that scripts can check what a build supports
+func fprintFormats(w io.Writer, asJSON bool) error {
+	f := formats{
+		Inputs:   supportedInputs(),
+		OutModes: outModes,
+		Layouts:  layouts,
+		Dithers:  badgeimg.DitherAlgorithms,
+	}
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(f)
+	}
+	for _, list := range []struct {
+		kind  string
+		names []string
+	}{{"input", f.Inputs}, {"outmode", f.OutModes}, {"layout", f.Layouts}, {"dither", f.Dithers}} {
+		for _, name := range list.names {
+			if _, err := fmt.Fprintf(w, "%s %s\n", list.kind, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	// no input is needed, for any command
+	for _, args := range [][]string{{"-version"}, {"decode", "-version"}} {
+		code, out, errOut := runCLI(t, args...)
+		if code != 0 || !strings.HasPrefix(out, toolVersion()+"\n") {
+			t.Errorf("%v: expected exit code 0 and the version, got %d and\n%s%s", args, code, out, errOut)
+		}
+		for _, want := range []string{"dither algorithms: floyd-steinberg", "layouts: badger", "input formats: png"} {
+			if !strings.Contains(out, want) {
+				t.Errorf("%v: expected %q in\n%s", args, want, out)
+			}
+		}
+	}
+	// generated files are stamped with the same version
+	if header := NewOptions().generatedHeader("//", "", "."); !strings.Contains(header, toolVersion()) {
+		t.Errorf("expected %q in the header\n%s", toolVersion(), header)
+	}
+}
+
+func TestListFormats(t *testing.T) {
+	code, out, errOut := runCLI(t, "-list-formats")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	lines := strings.Split(out, "\n")
+	for _, want := range []string{"input png", "input jpeg", "input bmp", "input webp", "outmode rice", "outmode bin", "outmode base64", "layout badger", "dither floyd-steinberg"} {
+		if !slices.Contains(lines, want) {
+			t.Errorf("expected the line %q in\n%s", want, out)
+		}
+	}
+
+	code, out, errOut = runCLI(t, "-list-formats", "-json")
+	if code != 0 {
+		t.Fatalf("-json: expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	var f formats
+	if err := json.Unmarshal([]byte(out), &f); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"png", "jpeg", "bmp", "webp"} {
+		if !slices.Contains(f.Inputs, want) {
+			t.Errorf("-json: expected the input %q in %v", want, f.Inputs)
+		}
+	}
+	for _, want := range []string{"rice", "bin", "base64"} {
+		if !slices.Contains(f.OutModes, want) {
+			t.Errorf("-json: expected the outmode %q in %v", want, f.OutModes)
+		}
+	}
+
+	if code, _, _ := runCLI(t, "-json", "-outmode", "none", "-ratio", "32x32", "testdata/tainigo_128.png"); code != exitUsage {
+		t.Errorf("expected -json without -list-formats to be refused, got %d", code)
+	}
+}
+
+func TestReleaseVersion(t *testing.T) {
+	for _, test := range []struct {
+		version, want string
+	}{
+		{"v1.4.0", "v1.4.0"},
+		{"v2.0.0-rc.1", "v2.0.0-rc.1"},
+		{"", "(devel)"},
+		{"(devel)", "(devel)"},
+		{"v0.0.0-20261016093112-3cf40c6a1b2d", "(devel)"},
+		{"v1.4.1-0.20261016093112-3cf40c6a1b2d", "(devel)"},
+		{"v1.5.0-rc.1.0.20261016093112-3cf40c6a1b2d", "(devel)"},
+		{"v1.4.1-0.20261016093112-3cf40c6a1b2d+dirty", "(devel)"},
+		{"v1.4.0+dirty", "(devel)"},
+	} {
+		if got := releaseVersion(test.version); got != test.want {
+			t.Errorf("%q: expected %s, got %s", test.version, test.want, got)
+		}
+	}
+}
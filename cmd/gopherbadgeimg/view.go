@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// ReadBase64 decodes data printed by -outmode base64, with or without its
+// padding, reading it from stdin when data is "-" and from the file data names
+// when there is one. Corrupt data is reported with the offset of the first
+// byte that isn't base64, counting from the start of what was given.
+func ReadBase64(data string) ([]byte, error) {
+	if info, err := os.Stat(data); data == stdinName || err == nil && info.Mode().IsRegular() {
+		in, err := ReadInput(data)
+		if err != nil {
+			return nil, err
+		}
+		data = string(in)
+	}
+	// a string may have been wrapped when it was pasted, offsets maps the
+	// bytes of what is left to where they were
+	var (
+		packed  []byte
+		offsets []int
+	)
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case ' ', '\t', '\n', '\r', '\v', '\f':
+		default:
+			packed = append(packed, data[i])
+			offsets = append(offsets, i)
+		}
+	}
+	packed = bytes.TrimRight(packed, "=")
+	decoded := make([]byte, base64.RawStdEncoding.DecodedLen(len(packed)))
+	n, err := base64.RawStdEncoding.Decode(decoded, packed)
+	var corrupt base64.CorruptInputError
+	if errors.As(err, &corrupt) {
+		if int(corrupt) >= len(packed) || len(packed)%4 == 1 && int(corrupt) == len(packed)-1 {
+			// a lone character at the end holds less than a byte
+			return nil, fmt.Errorf("corrupt base64 data: it ends early, at offset %d", len(data))
+		}
+		offset := offsets[corrupt]
+		return nil, fmt.Errorf("corrupt base64 data: %q at offset %d isn't base64", data[offset], offset)
+	}
+	return decoded[:n], err
+}
+
+// FromBase64 writes -outmode base64 data, read from value by ReadBase64, in
+// the formats of -outmode as if it had just been converted, shown by -show and
+// pictured by -preview too. Its size comes from its header, or else is x by
+// y, and must be the one of the data.
+func (o *Options) FromBase64(value string, x, y int) error {
+	data, err := ReadBase64(value)
+	if err != nil {
+		return classify(badgeimg.ErrDecode, err)
+	}
+	x, y, frames, err := o.readBin("base64", data, x, y, o.Palette)
+	if err != nil {
+		return classify(badgeimg.ErrDecode, err)
+	}
+	if err := o.Palette.Validate(x, y); err != nil {
+		return classify(badgeimg.ErrBadRatio, err)
+	}
+	if len(frames) == 1 {
+		_, err = o.writeImg("base64", x, y, frames[0])
+	} else {
+		_, err = o.writeFrames("base64", x, y, frames, nil)
+	}
+	return err
+}
+
+// View previews data converted earlier, read from name, on w: the size comes
+// from its header, or else is x by y. Nothing is decoded or dithered, what is
+// shown is exactly the data.
+func (o *Options) View(w io.Writer, name string, data []byte, x, y int) error {
+	x, y, frames, err := o.readBin(name, data, x, y, o.Palette)
+	if err != nil {
+		return classify(badgeimg.ErrDecode, err)
+	}
+	if err := o.Palette.Validate(x, y); err != nil {
+		return err
+	}
+	for i, frame := range frames {
+		if len(frames) > 1 {
+			fmt.Fprintf(w, "frame %d:\n", i)
+		}
+		o.showImg(w, x, y, frame)
+	}
+	return nil
+}
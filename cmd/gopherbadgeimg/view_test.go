@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// packedProfile returns the profile picture as converted in bin mode
+func packedProfile(t *testing.T) []byte {
+	t.Helper()
+	img, err := LoadImg("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewOptions().ImgToBytes(120, 128, img)
+}
+
+func TestViewBin(t *testing.T) {
+	packed := packedProfile(t)
+	var want bytes.Buffer
+	FprintImg(&want, 120, 128, packed, badgeimg.LayoutBadger)
+
+	var got bytes.Buffer
+	if err := NewOptions().View(&got, "profile.bin", packed, 120, 128); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Error("expected the data to be shown as converted")
+	}
+
+	// a header gives the size on its own
+	opts := NewOptions()
+	opts.Header = true
+	got.Reset()
+	if err := NewOptions().View(&got, "profile.bin", opts.withHeader(120, 128, packed, false), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Error("expected the data after the header to be shown")
+	}
+}
+
+func TestViewBase64(t *testing.T) {
+	// 16 bytes, which base64 pads with ==
+	packed := []byte{
+		0xff, 0x81, 0x81, 0x81, 0x81, 0x81, 0x81, 0xff,
+		0x00, 0x3c, 0x42, 0x42, 0x42, 0x42, 0x3c, 0x00,
+	}
+	var want bytes.Buffer
+	FprintImg(&want, 8, 16, packed, badgeimg.LayoutBadger)
+
+	padded := base64.StdEncoding.EncodeToString(packed)
+	for name, data := range map[string]string{
+		"padded":   padded,
+		"unpadded": base64.RawStdEncoding.EncodeToString(packed),
+		"wrapped":  padded[:12] + "\n" + padded[12:] + "\n",
+	} {
+		decoded, err := ReadBase64(data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		var got bytes.Buffer
+		if err := NewOptions().View(&got, "base64", decoded, 8, 16); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got.String() != want.String() {
+			t.Errorf("%s: expected\n%s\ngot\n%s", name, want.String(), got.String())
+		}
+	}
+}
+
+func TestViewSizeMismatch(t *testing.T) {
+	packed := packedProfile(t)
+	var got bytes.Buffer
+	if err := NewOptions().View(&got, "profile.bin", packed, 246, 128); !errors.Is(err, errSize) {
+		t.Errorf("expected a size mismatch, got %v", err)
+	}
+	if err := NewOptions().View(&got, "profile.bin", packed[:100], 120, 128); !errors.Is(err, errSize) {
+		t.Errorf("expected a size mismatch, got %v", err)
+	}
+	if got.Len() != 0 {
+		t.Errorf("expected nothing to be shown, got\n%s", got.String())
+	}
+	if _, err := ReadBase64("not base64!"); err == nil {
+		t.Error("expected invalid base64 to be rejected")
+	}
+}
+
+func TestFromBase64(t *testing.T) {
+	dir := t.TempDir()
+	direct := filepath.Join(dir, "direct.bin")
+	if code, _, errOut := runCLI(t, "-outmode", "bin", "-ratio", "32x32", "-o", direct, "testdata/tainigo_128.png"); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	want, err := os.ReadFile(direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, encoded, errOut := runCLI(t, "-outmode", "base64", "-ratio", "32x32", "testdata/tainigo_128.png")
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	file := filepath.Join(dir, "pasted.txt")
+	if err := os.WriteFile(file, []byte(encoded), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	wrapped := strings.TrimRight(encoded, "=\n")
+	wrapped = wrapped[:40] + "\n  " + wrapped[40:]
+	for name, value := range map[string]string{"argument": encoded, "file": file, "unpadded and wrapped": wrapped} {
+		out := filepath.Join(dir, "roundtrip.bin")
+		if code, _, errOut := runCLI(t, "-from-base64", value, "-ratio", "32x32", "-outmode", "bin", "-o", out); code != 0 {
+			t.Errorf("%s: expected exit code 0, got %d and\n%s", name, code, errOut)
+			continue
+		}
+		if got, err := os.ReadFile(out); err != nil || !bytes.Equal(got, want) {
+			t.Errorf("%s: expected the bytes of the conversion, got %v", name, err)
+		}
+	}
+
+	for _, test := range []struct {
+		value, ratio, want string
+	}{
+		{encoded[:10] + "*" + encoded[11:], "32x32", `'*' at offset 10 isn't base64`},
+		{encoded[:5], "32x32", "it ends early, at offset 5"},
+		{encoded, "16x16", "a 16x16 image is 32 bytes, got 128"},
+	} {
+		code, _, errOut := runCLI(t, "-from-base64", test.value, "-ratio", test.ratio, "-outmode", "none")
+		if code != exitDecode || !strings.Contains(errOut, test.want) {
+			t.Errorf("expected exit code %d and %q, got %d and\n%s", exitDecode, test.want, code, errOut)
+		}
+	}
+	if code, _, _ := runCLI(t, "-from-base64", encoded, "-ratio", "32x32", "-outmode", "none", "testdata/tainigo_128.png"); code != exitUsage {
+		t.Errorf("expected -from-base64 with inputs to be refused, got %d", code)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long inputs must be left alone after a change before
+// they are converted again. Editors often save a file in several writes.
+const watchDebounce = 250 * time.Millisecond
+
+// Watch converts args and then converts them again every time one of them
+// changes, until ctx is done. Failed conversions are reported and watching
+// goes on, as a half written file is usually fixed by the next save.
+func (o *Options) Watch(ctx context.Context, args []string, x, y int) error {
+	opts := o
+	convert := func() {
+		converted, failed := opts.ConvertAll(args, x, y)
+		logger.Infof("converted %d input(s), %d failed; watching for changes", converted, len(failed))
+	}
+	convert()
+	// from now on the outputs are the ones written above, which are meant to
+	// be overwritten
+	forced := *o
+	forced.Force = true
+	opts = &forced
+	return watchFiles(ctx, args, watchDebounce, convert)
+}
+
+// watchFiles calls onChange once the files matching patterns (plain paths or
+// glob patterns) have stopped changing for debounce, until ctx is done.
+//
+// The directories holding the files are watched rather than the files
+// themselves, as many editors save by writing a new file and renaming it
+// over the old one.
+func watchFiles(ctx context.Context, patterns []string, debounce time.Duration, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	var watched []string
+	dirs := make(map[string]bool)
+	for _, pattern := range patterns {
+		if pattern == stdinName || IsURL(pattern) {
+			return fmt.Errorf("can't watch %s, only files can be watched", pattern)
+		}
+		if archive, _, ok := splitArchivePath(pattern); ok {
+			pattern = archive
+		}
+		abs, err := filepath.Abs(pattern)
+		if err != nil {
+			return err
+		}
+		watched = append(watched, abs)
+		dir := filepath.Dir(abs)
+		if !dirs[dir] {
+			if err := watcher.Add(dir); err != nil {
+				return fmt.Errorf("watching %s: %w", dir, err)
+			}
+			dirs[dir] = true
+		}
+	}
+	matches := func(name string) bool {
+		for _, pattern := range watched {
+			if ok, _ := filepath.Match(pattern, name); ok || pattern == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			if event.Op == fsnotify.Chmod || !matches(event.Name) {
+				continue
+			}
+			logger.Debugf("%s: %s", event.Op, event.Name)
+			// every change pushes the conversion back
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return errors.New("watcher closed")
+			}
+			logger.Errorf("error watching inputs: %v", err)
+		case <-timer.C:
+			onChange()
+		}
+	}
+}
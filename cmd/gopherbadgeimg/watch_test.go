@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchFilesDebounce(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "splash.png")
+	if err := os.WriteFile(input, []byte("v0"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- watchFiles(ctx, []string{input}, 100*time.Millisecond, func() { changes <- struct{}{} })
+	}()
+	// give the watcher time to start
+	time.Sleep(100 * time.Millisecond)
+
+	// a burst of writes, like an editor saving in chunks, is a single change
+	for i := 0; i < 5; i++ {
+		if err := os.WriteFile(input, []byte("burst"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the writes to trigger a conversion")
+	}
+	select {
+	case <-changes:
+		t.Fatal("expected the burst of writes to be debounced into one conversion")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// other files in the directory are ignored
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("unrelated"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+		t.Fatal("expected changes to other files to be ignored")
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// saving by renaming a new file over the input counts as a change
+	tmp := filepath.Join(dir, "splash.png.tmp")
+	if err := os.WriteFile(tmp, []byte("renamed"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, input); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changes:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the rename to trigger a conversion")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected watching to end cleanly, got %v", err)
+	}
+}
+
+func TestWatchRecoversFromBadInput(t *testing.T) {
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "splash.png")
+	output := filepath.Join(dir, "splash-profile.bin")
+	// the editor is mid-save: the file is truncated
+	if err := os.WriteFile(input, png[:100], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio = "bin", "profile"
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		// the input and a pattern that matches nothing make a batch, so the
+		// output is named after the input
+		done <- opts.Watch(ctx, []string{input, filepath.Join(dir, "*.jpg")}, 120, 128)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	if _, err := os.Stat(output); err == nil {
+		t.Fatal("expected the truncated image not to convert")
+	}
+
+	if err := os.WriteFile(input, png, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, err := os.Stat(output); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the fixed image to be converted")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("expected watching to end cleanly, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/conejoninja/badger2040/cmd/gopherbadgeimg/badgeimg"
+)
+
+// writeFile writes name through write, unless it already holds exactly what
+// would be written: rewriting it would only touch its modification time, and
+// with it everything built from it. -force-write writes it regardless.
+//
+// A name holding something else isn't overwritten without -force, as it may
+// be a hand tuned file that happens to have the same name. The data only
+// replaces name once it has all been written, see replaceFile. With -verify
+// name is only compared with the data, see verifyFile. The errors match
+// badgeimg.ErrWrite, but for those of -verify.
+func (o *Options) writeFile(name string, write func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := write(&buf); err != nil {
+		return classify(badgeimg.ErrWrite, err)
+	}
+	if o.Verify {
+		return verifyFile(name, buf.Bytes())
+	}
+	// a name that can't be read is left for replaceFile to report
+	if existing, err := os.ReadFile(name); err == nil {
+		same := bytes.Equal(existing, buf.Bytes())
+		if same && !o.ForceWrite {
+			logger.Debugf("skipping %s: unchanged", name)
+			return nil
+		}
+		if !same && !o.Force {
+			return classify(badgeimg.ErrWrite, fmt.Errorf("%s already exists and differs, use -force to overwrite it", name))
+		}
+	}
+	return classify(badgeimg.ErrWrite, o.replaceFile(name, buf.Bytes()))
+}
+
+// replaceFile writes data to a temporary file next to name, then renames it
+// to name. An interrupted or failed write leaves name as it was, rather than
+// truncated for go:embed to bake into firmware, and the temporary file is
+// removed. With -durable the data is synced to disk before the rename, and
+// the rename itself after it.
+func (o *Options) replaceFile(name string, data []byte) (err error) {
+	dir := filepath.Dir(name)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err != nil {
+		return err
+	}
+	if o.Durable {
+		if err = tmp.Sync(); err != nil {
+			return err
+		}
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	// temporary files are only readable by their owner, keep the mode of the
+	// file being replaced or the one os.Create would have given
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(name); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	if o.Durable {
+		// best effort: directories can't be synced everywhere, e.g. on Windows
+		if d, err := os.Open(dir); err == nil {
+			d.Sync()
+			d.Close()
+		}
+	}
+	return nil
+}
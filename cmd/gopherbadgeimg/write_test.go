@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// checkDir checks that dir holds exactly the files in want, with their content
+func checkDir(t *testing.T, dir string, want map[string]string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != len(want) {
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		t.Errorf("expected %d files, got %v", len(want), names)
+	}
+	for name, content := range want {
+		got, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("%s: expected %q, got %q", name, content, got)
+		}
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "splash.bin")
+	if err := os.WriteFile(name, []byte("hand tuned"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	opts := NewOptions()
+
+	// a write failing halfway through leaves the original alone
+	errDiskFull := errors.New("disk full")
+	err := opts.writeFile(name, func(w io.Writer) error {
+		if _, err := w.Write([]byte("half")); err != nil {
+			return err
+		}
+		return errDiskFull
+	})
+	if !errors.Is(err, errDiskFull) {
+		t.Errorf("expected the write error, got %v", err)
+	}
+	checkDir(t, dir, map[string]string{"splash.bin": "hand tuned"})
+
+	// so does a rename failing, here over a directory
+	if err := os.Mkdir(filepath.Join(dir, "taken"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "taken", "file"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.replaceFile(filepath.Join(dir, "taken"), []byte("data")); err == nil {
+		t.Error("expected renaming over a directory to fail")
+	}
+	if err := os.RemoveAll(filepath.Join(dir, "taken")); err != nil {
+		t.Fatal(err)
+	}
+	checkDir(t, dir, map[string]string{"splash.bin": "hand tuned"})
+
+	// a successful write replaces the file, keeping its mode
+	opts.Force, opts.Durable = true, true
+	if err := opts.writeFile(name, func(w io.Writer) error {
+		_, err := w.Write([]byte("converted"))
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	checkDir(t, dir, map[string]string{"splash.bin": "converted"})
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0o600 {
+		t.Errorf("expected the mode to stay 0600, got %v", info.Mode().Perm())
+	}
+}
+
+func TestSkipUnchangedOutputs(t *testing.T) {
+	dir := t.TempDir()
+	opts := NewOptions()
+	opts.OutMode, opts.Ratio, opts.OutDir = "rice", "profile", dir
+	output := filepath.Join(dir, "profile-generated.go")
+	old := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// convert converts the image and returns the modification time of the
+	// output, which it then sets back to old
+	convert := func() time.Time {
+		t.Helper()
+		if _, failed := opts.ConvertAll([]string{"testdata/tainigo_128.png"}, 120, 128); len(failed) != 0 {
+			t.Fatal("expected the image to convert")
+		}
+		info, err := os.Stat(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(output, old, old); err != nil {
+			t.Fatal(err)
+		}
+		return info.ModTime()
+	}
+
+	convert()
+	if mtime := convert(); !mtime.Equal(old) {
+		t.Errorf("expected an unchanged output to be left alone, got its modification time updated to %v", mtime)
+	}
+	opts.Invert, opts.Force = true, true
+	if mtime := convert(); mtime.Equal(old) {
+		t.Error("expected a changed output to be written")
+	}
+	opts.ForceWrite = true
+	if mtime := convert(); mtime.Equal(old) {
+		t.Error("expected -force-write to write an unchanged output")
+	}
+}
+
+func TestOverwriteProtection(t *testing.T) {
+	dir := t.TempDir()
+	png, err := os.ReadFile("testdata/tainigo_128.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"alice.png", "bob.png"} {
+		if err := os.WriteFile(filepath.Join(dir, name), png, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	convert := func(flags ...string) (int, string) {
+		t.Helper()
+		args := append([]string{"-outmode", "bin", "-ratio", "profile"}, flags...)
+		code, _, errOut := runCLI(t, append(args, filepath.Join(dir, "*.png"))...)
+		return code, errOut
+	}
+	if code, errOut := convert(); code != 0 {
+		t.Fatalf("expected exit code 0, got %d and\n%s", code, errOut)
+	}
+	if code, errOut := convert(); code != 0 {
+		t.Errorf("expected identical outputs to be left alone, got exit code %d and\n%s", code, errOut)
+	}
+
+	// a hand tuned file fails its own conversion, but not the others
+	alice := filepath.Join(dir, "alice-profile.bin")
+	if err := os.WriteFile(alice, []byte("hand tuned"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	code, errOut := convert()
+	if code == 0 || !strings.Contains(errOut, alice+" already exists") || !strings.Contains(errOut, "converted 1 input(s), 1 failed") {
+		t.Errorf("expected the hand tuned file to be reported and the other input converted, got exit code %d and\n%s", code, errOut)
+	}
+	if data, _ := os.ReadFile(alice); string(data) != "hand tuned" {
+		t.Errorf("expected the hand tuned file to be left alone, got %d bytes", len(data))
+	}
+
+	if code, errOut := convert("-force"); code != 0 {
+		t.Errorf("expected -force to overwrite it, got exit code %d and\n%s", code, errOut)
+	}
+	if data, _ := os.ReadFile(alice); string(data) == "hand tuned" {
+		t.Error("expected -force to overwrite the hand tuned file")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+// A receiver for gopherbadgeimg -send: it waits for images on the USB serial
+// console and draws each one that comes whole, answering ACK, or NAK to ask
+// for it again. The protocol is described in
+// cmd/gopherbadgeimg/badgeimg/send.go.
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"machine"
+	"time"
+
+	"tinygo.org/x/drivers/uc8151"
+)
+
+const (
+	ack = 0x06
+	nak = 0x15
+
+	headerSize = 12
+	// maxLen bounds the data of an image: the whole display
+	maxLen = 296 * 128 / 8
+)
+
+var magic = []byte("GBSN")
+
+func main() {
+	machine.SPI0.Configure(machine.SPIConfig{
+		Frequency: 12000000,
+		SCK:       machine.EPD_SCK_PIN,
+		SDO:       machine.EPD_SDO_PIN,
+	})
+
+	display := uc8151.New(machine.SPI0, machine.EPD_CS_PIN, machine.EPD_DC_PIN, machine.EPD_RESET_PIN, machine.EPD_BUSY_PIN)
+	display.Configure(uc8151.Config{
+		Rotation: uc8151.ROTATION_270,
+		Speed:    uc8151.MEDIUM,
+		Blocking: true,
+	})
+
+	display.ClearBuffer()
+	display.Display()
+
+	buf := make([]byte, headerSize+maxLen+4)
+	for {
+		width, height, data, ok := receive(buf)
+		if !ok {
+			machine.Serial.WriteByte(nak)
+			continue
+		}
+		machine.Serial.WriteByte(ack)
+
+		// images are packed column by column, the way the display is
+		// drawn, so their width and height are swapped
+		display.ClearBuffer()
+		display.DrawBuffer(0, 0, int16(height), int16(width), data)
+		display.Display()
+		display.WaitUntilIdle()
+	}
+}
+
+// receive reads the next image sent into buf, skipping whatever comes before
+// its magic, and reports whether it came whole
+func receive(buf []byte) (width, height int, data []byte, ok bool) {
+	for matched := 0; matched < len(magic); {
+		switch b := readByte(); {
+		case b == magic[matched]:
+			matched++
+		case b == magic[0]:
+			matched = 1
+		default:
+			matched = 0
+		}
+	}
+	copy(buf, magic)
+	for i := len(magic); i < headerSize; i++ {
+		buf[i] = readByte()
+	}
+	width = int(binary.LittleEndian.Uint16(buf[4:]))
+	height = int(binary.LittleEndian.Uint16(buf[6:]))
+	n := binary.LittleEndian.Uint32(buf[8:])
+	if n > maxLen || int(n) != (width*height+7)/8 {
+		return 0, 0, nil, false
+	}
+	end := headerSize + int(n)
+	for i := headerSize; i < end+4; i++ {
+		buf[i] = readByte()
+	}
+	if binary.LittleEndian.Uint32(buf[end:]) != crc32.ChecksumIEEE(buf[:end]) {
+		return 0, 0, nil, false
+	}
+	return width, height, buf[headerSize:end], true
+}
+
+// readByte waits for the next byte from the USB serial console
+func readByte() byte {
+	for machine.Serial.Buffered() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	b, _ := machine.Serial.ReadByte()
+	return b
+}